@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// diagnoser is a storage backend that can report on its own state
+type diagnoser interface {
+	Diagnose() (*storage.Diagnostics, error)
+}
+
+// runDoctor prints diagnostics about the storage the server would use, as
+// selected by the -storage and -storage-location flags, and the git
+// installation. openErr is the error opening that storage, if any. It returns
+// the process exit code: non-zero if a critical check (git missing, storage
+// unavailable or unwritable) failed.
+func runDoctor(w io.Writer, backend string, store storage.Storage, openErr error) int {
+	failed := false
+
+	gitPath, gitVersion, err := git.Version()
+	if err != nil {
+		fmt.Fprintf(w, "git:             FAIL (%v)\n", err)
+		failed = true
+	} else {
+		fmt.Fprintf(w, "git:             %s (%s)\n", gitVersion, gitPath)
+	}
+
+	fmt.Fprintf(w, "backend:         %s\n", backend)
+	if openErr != nil {
+		fmt.Fprintf(w, "storage:         FAIL (%v)\n", openErr)
+		return 1
+	}
+
+	d, ok := store.(diagnoser)
+	if !ok {
+		fmt.Fprintf(w, "diagnostics:     not supported by the %s backend\n", backend)
+		if failed {
+			return 1
+		}
+		return 0
+	}
+	diag, err := d.Diagnose()
+	if err != nil {
+		fmt.Fprintf(w, "diagnostics:     FAIL (%v)\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(w, "storage:         %s\n", diag.Path)
+	if diag.WriteError != nil {
+		fmt.Fprintf(w, "writable:        FAIL (%v)\n", diag.WriteError)
+		failed = true
+	} else {
+		fmt.Fprintf(w, "writable:        yes\n")
+	}
+	fmt.Fprintf(w, "repositories:    %d\n", diag.Repositories)
+	if diag.InRepo {
+		fmt.Fprintf(w, "review states:   kept in each repository's %s directory\n", storage.RepoStorageDir)
+	} else {
+		fmt.Fprintf(w, "review states:   %d (%s)\n", diag.ReviewStates, formatBytes(diag.ReviewStateBytes))
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// formatBytes renders a byte count using binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
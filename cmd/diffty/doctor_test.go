@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// opaqueStorage is a storage backend without diagnostics
+type opaqueStorage struct {
+	storage.Storage
+}
+
+// TestRunDoctorSelectedStorage tests that the doctor checks the storage the
+// flags select rather than the default one
+func TestRunDoctorSelectedStorage(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.OpenStorage(storage.DefaultBackend, storage.Options{Dir: dir, InRepo: true})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+
+	var out bytes.Buffer
+	code := runDoctor(&out, storage.DefaultBackend, store, nil)
+	if code != 0 && !strings.Contains(out.String(), "git:             FAIL") {
+		t.Errorf("Expected the checks to pass, got %d: %s", code, out.String())
+	}
+	for _, expected := range []string{"backend:         " + storage.DefaultBackend, "storage:         " + dir, "kept in each repository's .diffty directory"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in the output, got %s", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	if code := runDoctor(&out, "sqlite", nil, errors.New("unknown storage backend")); code != 1 || !strings.Contains(out.String(), "storage:         FAIL (unknown storage backend)") {
+		t.Errorf("Expected the storage check to fail, got %d: %s", code, out.String())
+	}
+
+	out.Reset()
+	runDoctor(&out, "opaque", opaqueStorage{store}, nil)
+	if !strings.Contains(out.String(), "diagnostics:     not supported by the opaque backend") {
+		t.Errorf("Expected diagnostics to be skipped, got %s", out.String())
+	}
+}
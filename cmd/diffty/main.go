@@ -1,11 +1,25 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/models"
 	"github.com/darccio/diffty/internal/server"
 	"github.com/darccio/diffty/internal/storage"
 )
@@ -13,25 +27,237 @@ import (
 func main() {
 	// Command line flags
 	port := flag.Int("port", 10101, "Port to run the server on")
+	open := flag.Bool("open", false, "Open the default browser once the server is listening")
+	maxRepos := flag.Int("max-repos", 0, "Maximum number of repositories that can be added (0 for unlimited)")
+	requireReason := flag.Bool("require-reject-reason", false, "Require a reason when rejecting a file")
+	requireAllReviewed := flag.Bool("require-all-reviewed", false, "Only allow completing a review once every file has a status")
+	skippedComplete := flag.Bool("skipped-complete", false, "Count skipped files as complete in review progress and navigation")
+	storageLocation := flag.String("storage-location", "global", "Where review states are kept: global, under ~/.diffty, or repo, in a .diffty directory inside each repository")
+	backend := flag.String("storage", storage.DefaultBackend, fmt.Sprintf("Storage backend for review state (one of %s)", strings.Join(storage.Backends(), ", ")))
+	pollInterval := flag.Duration("poll-interval", 5*time.Second, "How often open pages check the compared branches for new commits")
+	authFile := flag.String("auth-file", "", "JSON file mapping user names to tokens; enables per-user review state")
+	noRenames := flag.Bool("no-rename-detection", false, "Turn off git's rename detection to speed up huge diffs; renamed files show as deleted and added")
+	allowedRoots := flag.String("allowed-roots", "", fmt.Sprintf("Directories repositories can be added from, separated by %q (empty allows any)", string(filepath.ListSeparator)))
+	rateLimit := flag.Int("rate-limit", 0, "Maximum requests per minute each client can make to pages and endpoints running git (0 for unlimited)")
+	gitNotes := flag.String("git-notes", "", fmt.Sprintf("Write completed reviews as git notes on the source commit, handling existing notes with one of %s (off by default, since it writes to the repository)", strings.Join(server.NotesPolicies, ", ")))
+	patchDir := flag.String("patch-dir", "", "Directory of .diff and .patch files that can be reviewed without a repository")
+	maxDiffBytes := flag.Int64("max-diff-bytes", 100<<20, "Maximum bytes of a diff read into memory per request; larger diffs can only be downloaded raw (0 for unlimited)")
+	largeFileLines := flag.Int("large-file-lines", 0, "Don't render the diff of files with more changed lines than this until asked for (0 for unlimited)")
+	largeFileBytes := flag.Int64("large-file-bytes", 0, "Don't render the diff of files whose diff is larger than this many bytes until asked for (0 for unlimited)")
+	currentCommits := flag.Bool("current-commits", false, "Refuse to save a file review when the compared branches moved since the page was loaded")
+	autoResume := flag.Bool("auto-resume", false, "Open a repository's comparison straight away when it is the only one in progress, instead of offering to resume it")
+	metrics := flag.Bool("metrics", false, "Serve request counts and git command timings at /metrics in the Prometheus text format")
+	basePath := flag.String("base-path", "", "Path prefix to serve every page and endpoint under, such as /diffty behind a reverse proxy")
+	saveInterval := flag.Duration("save-interval", 0, "Buffer review state saves in memory and write them at most this often (0 writes every save right away)")
+	hashLength := flag.Int("hash-length", 7, "Number of characters commit hashes are displayed with (4 to 40); review states and links keep full hashes")
+	statusLabels := flag.String("status-labels", "", "JSON file mapping review statuses to the label and color they are shown with, such as {\"approved\": {\"label\": \"LGTM\"}}")
+	debugGit := flag.Bool("debug-git", false, "Log every git command run, with its arguments and exit status but not its output")
 	flag.Parse()
 
-	// Initialize storage for review state
-	store, err := storage.NewJSONStorage()
+	if *debugGit {
+		git.SetCommandLogger(log.Default())
+	}
+
+	// Initialize storage for review state, which subcommands use as well
+	if *storageLocation != "global" && *storageLocation != "repo" {
+		log.Fatalf("Invalid -storage-location %q, must be global or repo", *storageLocation)
+	}
+	store, err := storage.OpenStorage(*backend, storage.Options{InRepo: *storageLocation == "repo"})
+
+	// Subcommands; anything else is taken as a repository to open
+	var repoPath string
+	switch flag.Arg(0) {
+	case "":
+	case "doctor", "info":
+		os.Exit(runDoctor(os.Stdout, *backend, store, err))
+	case "status":
+		// Handled once the server is set up with the flags' options
+	case "serve":
+		repoPath = flag.Arg(1)
+	default:
+		repoPath = flag.Arg(0)
+	}
+
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
+	// Rapid review actions are coalesced into one write per interval
+	var buffered *storage.BufferedStorage
+	if *saveInterval > 0 {
+		buffered = storage.NewBufferedStorage(store, *saveInterval)
+		store = buffered
+	}
+
+	opts := []server.Option{
+		server.WithMaxRepositories(*maxRepos),
+		server.WithEventPollInterval(*pollInterval),
+		server.WithRateLimit(*rateLimit),
+		server.WithAllowedRoots(filepath.SplitList(*allowedRoots)),
+		server.WithPatchDir(*patchDir),
+		server.WithMaxDiffBytes(*maxDiffBytes),
+		server.WithLargeFileThreshold(*largeFileLines, *largeFileBytes),
+		server.WithBasePath(*basePath),
+		server.WithHashLength(*hashLength),
+	}
+	if *requireReason {
+		opts = append(opts, server.WithRequiredRejectionReason())
+	}
+	if *requireAllReviewed {
+		opts = append(opts, server.WithCompletionRequiringAllFiles())
+	}
+	if *skippedComplete {
+		opts = append(opts, server.WithSkippedAsComplete())
+	}
+	if *currentCommits {
+		opts = append(opts, server.WithCurrentCommitCheck())
+	}
+	if *autoResume {
+		opts = append(opts, server.WithAutoResume())
+	}
+	if *metrics {
+		opts = append(opts, server.WithMetrics())
+	}
+	if *noRenames {
+		opts = append(opts, server.WithoutRenameDetection())
+	}
+	if *gitNotes != "" {
+		if !slices.Contains(server.NotesPolicies, *gitNotes) {
+			log.Fatalf("Invalid -git-notes policy %q, must be one of %s", *gitNotes, strings.Join(server.NotesPolicies, ", "))
+		}
+		opts = append(opts, server.WithGitNotes(*gitNotes))
+	}
+	if *authFile != "" {
+		tokens, err := loadAuthTokens(*authFile)
+		if err != nil {
+			log.Fatalf("Failed to load auth file: %v", err)
+		}
+		opts = append(opts, server.WithAuthTokens(tokens))
+	}
+
+	if *statusLabels != "" {
+		metas, err := loadStatusMetas(*statusLabels)
+		if err != nil {
+			log.Fatalf("Failed to load status labels: %v", err)
+		}
+		for status, meta := range metas {
+			opts = append(opts, server.WithStatusMeta(status, meta))
+		}
+	}
+
 	// Setup server and routes
-	srv, err := server.New(store)
+	srv, err := server.New(store, opts...)
 	if err != nil {
 		log.Fatalf("Failed to initialize server: %v", err)
 	}
 
-	// Start server
+	if flag.Arg(0) == "status" {
+		os.Exit(runStatus(os.Stdout, os.Stderr, srv, flag.Args()[1:]))
+	}
+
+	if repoPath != "" {
+		if err := srv.OpenRepository(repoPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot open %s: %v\n", repoPath, err)
+			os.Exit(1)
+		}
+	}
+
+	// Bind the listener first so the browser never races the server
 	addr := fmt.Sprintf(":%d", *port)
-	log.Printf("Starting diffty server at http://localhost%s", addr)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", addr, err)
+	}
 
-	if err := http.ListenAndServe(addr, srv.Router()); err != nil {
+	serverURL := fmt.Sprintf("http://localhost%s%s/", addr, srv.BasePath())
+	log.Printf("Starting diffty server at %s", serverURL)
+
+	if *open {
+		if err := openBrowser(serverURL); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	// Start server, shutting down gracefully on interrupt so buffered saves are written
+	httpServer := &http.Server{Handler: srv.Router()}
+	// Open event streams would otherwise hold the shutdown until its timeout
+	httpServer.RegisterOnShutdown(srv.CloseEvents)
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	// stopped is closed once the requests in flight are done
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-shutdown
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Printf("Warning: failed to shut down cleanly: %v", err)
+		}
+	}()
+
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server error: %v", err)
 	}
+	// Serve returns as soon as shutdown starts, before the handlers saving finish
+	<-stopped
+
+	if buffered != nil {
+		if err := buffered.Close(); err != nil {
+			log.Fatalf("Failed to write buffered review states: %v", err)
+		}
+	}
+}
+
+// loadAuthTokens reads the user name to token mapping from a JSON file
+func loadAuthTokens(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens map[string]string
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("invalid auth file %s: %w", path, err)
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("auth file %s has no users", path)
+	}
+	for user, token := range tokens {
+		if user == "" || token == "" {
+			return nil, fmt.Errorf("auth file %s has an empty user name or token", path)
+		}
+	}
+
+	return tokens, nil
+}
+
+// statusColorPattern matches the Tailwind palette names status colors are given as
+var statusColorPattern = regexp.MustCompile(`^[a-z]+$`)
+
+// loadStatusMetas reads the labels and colors of review statuses from a JSON
+// file, keyed by status
+func loadStatusMetas(path string) (models.StatusMetas, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var metas models.StatusMetas
+	if err := json.Unmarshal(data, &metas); err != nil {
+		return nil, fmt.Errorf("invalid status labels file %s: %w", path, err)
+	}
+
+	defaults := models.DefaultStatusMetas()
+	for status, meta := range metas {
+		if _, ok := defaults[status]; !ok {
+			return nil, fmt.Errorf("status labels file %s has unknown status %q", path, status)
+		}
+		if meta.Color != "" && !statusColorPattern.MatchString(meta.Color) {
+			return nil, fmt.Errorf("status labels file %s has invalid color %q for %s, must be a Tailwind palette name such as green", path, meta.Color, status)
+		}
+	}
+
+	return metas, nil
 }
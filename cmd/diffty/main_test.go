@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+func TestLoadStatusMetas(t *testing.T) {
+	write := func(content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "statuses.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write status labels: %v", err)
+		}
+		return path
+	}
+
+	metas, err := loadStatusMetas(write(`{"approved": {"label": "LGTM"}, "rejected": {"label": "Nope", "color": "orange"}}`))
+	if err != nil {
+		t.Fatalf("loadStatusMetas failed: %v", err)
+	}
+	if metas[models.StateApproved].Label != "LGTM" || metas[models.StateRejected].Color != "orange" {
+		t.Errorf("Expected the labels and colors of the file, got %+v", metas)
+	}
+
+	for _, content := range []string{
+		`{"pending": {"label": "Pending"}}`,
+		`{"approved": {"color": "green-500 hidden"}}`,
+		`not json`,
+	} {
+		if _, err := loadStatusMetas(write(content)); err == nil {
+			t.Errorf("Expected an error for %s", content)
+		}
+	}
+}
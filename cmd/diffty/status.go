@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/darccio/diffty/internal/models"
+	"github.com/darccio/diffty/internal/server"
+)
+
+// Exit codes of the status command
+const (
+	statusPassed = 0
+	statusFailed = 1
+	statusError  = 2
+)
+
+// gateStatuses are the file statuses the status command can fail on
+var gateStatuses = []string{models.StateRejected, models.StateUnreviewed, models.StateSkipped, models.StateNeedsReview, models.StateMixed}
+
+// statusReport is the JSON output of the status command
+type statusReport struct {
+	server.ReviewStatus
+	Failing []server.FileStatus `json:"failing"`
+	Passed  bool                `json:"passed"`
+}
+
+// runStatus prints the stored review of a comparison at its current branch
+// tips and returns the process exit code: statusFailed when more files than
+// allowed have one of the failing statuses, so CI can gate on the review.
+func runStatus(stdout, stderr io.Writer, srv *server.Server, args []string) int {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: diffty [flags] status [status flags] <repo> <source> <target>")
+		flags.PrintDefaults()
+	}
+	user := flags.String("user", "", "Reviewer whose review is checked, when authentication is enabled")
+	failOn := flags.String("fail-on", "rejected,unreviewed,needs-review", fmt.Sprintf("Comma-separated file statuses that fail the check, of %s", strings.Join(gateStatuses, ", ")))
+	maxFailing := flags.Int("max-failing", 0, "Number of files with a failing status tolerated before the check fails")
+	requireComplete := flags.Bool("require-complete", false, "Also fail unless the review was completed")
+	asJSON := flags.Bool("json", false, "Print the result as JSON")
+	if err := flags.Parse(args); err != nil {
+		return statusError
+	}
+	if flags.NArg() != 3 {
+		flags.Usage()
+		return statusError
+	}
+
+	var failing []string
+	for _, status := range strings.Split(*failOn, ",") {
+		status = strings.TrimSpace(status)
+		if status == "" {
+			continue
+		}
+		if !slices.Contains(gateStatuses, status) {
+			fmt.Fprintf(stderr, "Invalid -fail-on status %q, must be one of %s\n", status, strings.Join(gateStatuses, ", "))
+			return statusError
+		}
+		failing = append(failing, status)
+	}
+
+	repoPath, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid repository path: %v\n", err)
+		return statusError
+	}
+
+	status, err := srv.ReviewStatus(repoPath, *user, flags.Arg(1), flags.Arg(2))
+	if err != nil {
+		fmt.Fprintf(stderr, "Cannot check review: %v\n", err)
+		return statusError
+	}
+
+	failingFiles := status.FilesWithStatus(failing...)
+	passed := len(failingFiles) <= *maxFailing && (!*requireComplete || status.Completed)
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(statusReport{ReviewStatus: status, Failing: failingFiles, Passed: passed}); err != nil {
+			fmt.Fprintf(stderr, "Cannot write status: %v\n", err)
+			return statusError
+		}
+	} else {
+		printStatus(stdout, status, failingFiles, passed, srv.ShortHash)
+	}
+
+	if !passed {
+		return statusFailed
+	}
+	return statusPassed
+}
+
+// printStatus writes a review status as a file list followed by a summary,
+// abbreviating its commits with shortHash
+func printStatus(w io.Writer, status server.ReviewStatus, failing []server.FileStatus, passed bool, shortHash func(string) string) {
+	fmt.Fprintf(w, "%s → %s (%s..%s)\n", status.SourceBranch, status.TargetBranch, shortHash(status.TargetCommit), shortHash(status.SourceCommit))
+	if status.Description != "" {
+		fmt.Fprintf(w, "  %s\n", strings.ReplaceAll(status.Description, "\n", "\n  "))
+	}
+	for _, file := range status.Files {
+		fmt.Fprintf(w, "  %-11s %s\n", file.Status, file.Path)
+	}
+	fmt.Fprintf(w, "%d files: %d approved, %d rejected, %d skipped, %d needing review, %d mixed, %d unreviewed\n",
+		len(status.Files), status.Approved, status.Rejected, status.Skipped, status.NeedsReview, status.Mixed, status.Unreviewed)
+	if status.Completed {
+		fmt.Fprintln(w, "review completed")
+	}
+	if passed {
+		fmt.Fprintln(w, "PASS")
+	} else {
+		fmt.Fprintf(w, "FAIL (%d failing files)\n", len(failing))
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darccio/diffty/internal/models"
+	"github.com/darccio/diffty/internal/server"
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// setupStatusTest creates a repository whose feature branch changes a.txt and
+// b.txt, registered in a fresh JSON storage, and returns a function saving a
+// review of the feature branch with the given file statuses
+func setupStatusTest(t *testing.T) (*server.Server, string, func(statuses map[string]string, completed bool)) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir, "-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	git("init", "-q", "-b", "main")
+	write("README", "readme\n")
+	git("add", "README")
+	git("commit", "-q", "-m", "Initial commit")
+	git("checkout", "-q", "-b", "feature")
+	write("a.txt", "a\n")
+	write("b.txt", "b\n")
+	git("add", "a.txt", "b.txt")
+	git("commit", "-q", "-m", "Add files")
+
+	store, err := storage.OpenStorage(storage.DefaultBackend, storage.Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	if err := store.SaveRepositories([]string{repoDir}); err != nil {
+		t.Fatalf("Failed to register repository: %v", err)
+	}
+	srv, err := server.New(store)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	sourceCommit, targetCommit := git("rev-parse", "feature"), git("rev-parse", "main")
+	save := func(statuses map[string]string, completed bool) {
+		t.Helper()
+		state := &models.ReviewState{SourceBranch: "feature", TargetBranch: "main", SourceCommit: sourceCommit, TargetCommit: targetCommit}
+		for path, status := range statuses {
+			state.ReviewedFiles = append(state.ReviewedFiles, models.FileReview{Repo: repoDir, Path: path, Lines: map[string]string{"all": status}})
+		}
+		if completed {
+			state.Complete("", time.Now())
+		}
+		if err := store.SaveReviewState(state, repoDir, ""); err != nil {
+			t.Fatalf("Failed to save review state: %v", err)
+		}
+	}
+
+	return srv, repoDir, save
+}
+
+// TestRunStatusExitCode tests that the status command fails when files are
+// rejected or unreviewed, within the configured threshold
+func TestRunStatusExitCode(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  map[string]string
+		completed bool
+		flags     []string
+		expected  int
+	}{
+		{name: "nothing reviewed", expected: statusFailed},
+		{name: "all approved", statuses: map[string]string{"a.txt": models.StateApproved, "b.txt": models.StateApproved}, expected: statusPassed},
+		{name: "one unreviewed", statuses: map[string]string{"a.txt": models.StateApproved}, expected: statusFailed},
+		{name: "one rejected", statuses: map[string]string{"a.txt": models.StateApproved, "b.txt": models.StateRejected}, expected: statusFailed},
+		{name: "skipped passes by default", statuses: map[string]string{"a.txt": models.StateApproved, "b.txt": models.StateSkipped}, expected: statusPassed},
+		{name: "needs review fails by default", statuses: map[string]string{"a.txt": models.StateApproved, "b.txt": models.StateNeedsReview}, expected: statusFailed},
+		{name: "needs review passes when tolerated", statuses: map[string]string{"a.txt": models.StateApproved, "b.txt": models.StateNeedsReview}, flags: []string{"-fail-on", "rejected,unreviewed"}, expected: statusPassed},
+		{name: "skipped fails when asked", statuses: map[string]string{"a.txt": models.StateApproved, "b.txt": models.StateSkipped}, flags: []string{"-fail-on", "rejected,unreviewed,skipped"}, expected: statusFailed},
+		{name: "within threshold", statuses: map[string]string{"a.txt": models.StateApproved}, flags: []string{"-max-failing", "1"}, expected: statusPassed},
+		{name: "only rejections fail", statuses: map[string]string{"a.txt": models.StateApproved}, flags: []string{"-fail-on", "rejected"}, expected: statusPassed},
+		{name: "not completed", statuses: map[string]string{"a.txt": models.StateApproved, "b.txt": models.StateApproved}, flags: []string{"-require-complete"}, expected: statusFailed},
+		{name: "completed", statuses: map[string]string{"a.txt": models.StateApproved, "b.txt": models.StateApproved}, completed: true, flags: []string{"-require-complete"}, expected: statusPassed},
+		{name: "invalid status", flags: []string{"-fail-on", "bogus"}, expected: statusError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, repoDir, save := setupStatusTest(t)
+			if tt.statuses != nil || tt.completed {
+				save(tt.statuses, tt.completed)
+			}
+
+			var stdout, stderr bytes.Buffer
+			args := append(append([]string{}, tt.flags...), repoDir, "feature", "main")
+			if code := runStatus(&stdout, &stderr, srv, args); code != tt.expected {
+				t.Errorf("Expected exit code %d, got %d\n%s%s", tt.expected, code, stdout.String(), stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunStatusOutput(t *testing.T) {
+	srv, repoDir, save := setupStatusTest(t)
+	save(map[string]string{"a.txt": models.StateApproved, "b.txt": models.StateRejected}, false)
+
+	var stdout, stderr bytes.Buffer
+	if code := runStatus(&stdout, &stderr, srv, []string{repoDir, "feature", "main"}); code != statusFailed {
+		t.Fatalf("Expected exit code %d, got %d: %s", statusFailed, code, stderr.String())
+	}
+	out := stdout.String()
+	for _, expected := range []string{"approved    a.txt", "rejected    b.txt", "2 files: 1 approved, 1 rejected", "FAIL (1 failing files)"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected %q in the output, got:\n%s", expected, out)
+		}
+	}
+
+	if !regexp.MustCompile(`\([0-9a-f]{7}\.\.[0-9a-f]{7}\)`).MatchString(out) {
+		t.Errorf("Expected the commits abbreviated to 7 characters by default, got:\n%s", out)
+	}
+
+	// Commits are abbreviated to the -hash-length the server was set up with
+	server.WithHashLength(12)(srv)
+	stdout.Reset()
+	runStatus(&stdout, &stderr, srv, []string{repoDir, "feature", "main"})
+	if out := stdout.String(); !regexp.MustCompile(`\([0-9a-f]{12}\.\.[0-9a-f]{12}\)`).MatchString(out) {
+		t.Errorf("Expected the commits abbreviated to 12 characters, got:\n%s", out)
+	}
+
+	stdout.Reset()
+	runStatus(&stdout, &stderr, srv, []string{"-json", repoDir, "feature", "main"})
+	var report struct {
+		Files   []server.FileStatus `json:"files"`
+		Failing []server.FileStatus `json:"failing"`
+		Passed  bool                `json:"passed"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("Expected JSON output, got %v: %s", err, stdout.String())
+	}
+	if report.Passed || len(report.Files) != 2 || len(report.Failing) != 1 || report.Failing[0].Path != "b.txt" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	if code := runStatus(&stdout, &stderr, srv, []string{repoDir, "feature"}); code != statusError {
+		t.Errorf("Expected missing arguments to exit with %d, got %d", statusError, code)
+	}
+	if code := runStatus(&stdout, &stderr, srv, []string{repoDir, "nonexistent", "main"}); code != statusError {
+		t.Errorf("Expected an unknown branch to exit with %d, got %d", statusError, code)
+	}
+}
@@ -0,0 +1,176 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CodeOwnersPaths are where a CODEOWNERS file is looked up, in the order
+// GitHub does: the first one found is the repository's
+var CodeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// maxCodeOwnersSize is the largest CODEOWNERS file read, as GitHub ignores larger ones
+const maxCodeOwnersSize = 3 << 20
+
+// ErrNoCodeOwners is returned when a ref has no CODEOWNERS file
+var ErrNoCodeOwners = errors.New("no CODEOWNERS file")
+
+// CodeOwners maps the path patterns of a CODEOWNERS file to their owners
+type CodeOwners struct {
+	// Path is where the file was found, one of CodeOwnersPaths
+	Path  string
+	rules []codeOwnersRule
+}
+
+// codeOwnersRule is a line of a CODEOWNERS file
+type codeOwnersRule struct {
+	pattern *regexp.Regexp
+	// owners are the users, teams or email addresses owning the matching
+	// paths; none leaves them without an owner
+	owners []string
+}
+
+// GetCodeOwners reads the CODEOWNERS file of a ref from the first of
+// CodeOwnersPaths it has, or returns ErrNoCodeOwners if it has none
+func (r *Repository) GetCodeOwners(ref string) (*CodeOwners, error) {
+	for _, path := range CodeOwnersPaths {
+		content, err := r.GetFileContent(ref, path, maxCodeOwnersSize)
+		if errors.Is(err, ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CODEOWNERS: %w", err)
+		}
+		owners := ParseCodeOwners(content)
+		owners.Path = path
+		return owners, nil
+	}
+	return nil, fmt.Errorf("%w at %s", ErrNoCodeOwners, ref)
+}
+
+// ParseCodeOwners parses the content of a CODEOWNERS file. Each line is a
+// path pattern followed by its owners, with the gitignore-like pattern syntax
+// GitHub supports; lines with syntax it doesn't, such as negation or
+// character ranges, are skipped as GitHub skips them.
+func ParseCodeOwners(content string) *CodeOwners {
+	owners := &CodeOwners{}
+	for _, line := range strings.Split(content, "\n") {
+		// An escaped # starts a pattern rather than a comment
+		escaped := strings.HasPrefix(line, `\#`)
+		if escaped {
+			line = line[1:]
+		}
+		if i := strings.Index(line, "#"); i >= 0 && !(escaped && i == 0) {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "!") || strings.ContainsAny(fields[0], "[]") {
+			continue
+		}
+		pattern, err := codeOwnersPattern(fields[0])
+		if err != nil {
+			continue
+		}
+		owners.rules = append(owners.rules, codeOwnersRule{pattern: pattern, owners: fields[1:]})
+	}
+	return owners
+}
+
+// codeOwnersPattern turns a CODEOWNERS path pattern into a regular
+// expression matching the paths it applies to. A pattern matches a file or a
+// directory and everything below it; it is anchored at the repository root
+// when it starts with or contains a slash, and matches at any depth
+// otherwise. A trailing slash only matches directories, and a trailing /*
+// only the files right in the directory, as GitHub does.
+func codeOwnersPattern(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.HasPrefix(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	directory := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	if strings.Contains(pattern, "/") {
+		anchored = true
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	segments := strings.Split(pattern, "/")
+	last := segments[len(segments)-1]
+	for i, segment := range segments {
+		switch {
+		case segment == "**" && i == len(segments)-1:
+			// Everything below the directories matched so far
+			b.WriteString(".*")
+		case segment == "**":
+			// Any number of directories, none included
+			b.WriteString("(?:.*/)?")
+		default:
+			b.WriteString(globSegment(segment))
+			if i < len(segments)-1 {
+				b.WriteString("/")
+			}
+		}
+	}
+	switch {
+	case directory:
+		b.WriteString("/.*")
+	case last == "*" || last == "**":
+	default:
+		b.WriteString("(?:/.*)?")
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// globSegment turns a path segment of a pattern into a regular expression,
+// where * matches any characters but a slash and ? a single one
+func globSegment(segment string) string {
+	var b strings.Builder
+	var previous rune
+	for _, r := range segment {
+		switch r {
+		case '*':
+			// A ** within a segment is no different
+			if previous != '*' {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+		previous = r
+	}
+	return b.String()
+}
+
+// Owners returns the owners of a path: those of the last pattern matching
+// it, as later lines take precedence. A path matching no pattern, or one
+// without owners, has none.
+func (c *CodeOwners) Owners(path string) []string {
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].pattern.MatchString(path) {
+			return c.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// IsOwner reports whether owner is one of the owners of a path. Owners are
+// compared without regard to case, as GitHub handles are.
+func (c *CodeOwners) IsOwner(owner, path string) bool {
+	for _, candidate := range c.Owners(path) {
+		if strings.EqualFold(candidate, owner) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCodeOwnersMatching(t *testing.T) {
+	owners := ParseCodeOwners(`# Default owners
+*       @org/everyone
+
+# Later lines take precedence
+*.js    @js-owner # inline comment
+/build/logs/ @build
+apps/   @apps
+docs/*  @docs
+**/tests @testers
+/src/**/gen/ @generators
+/src/vendor
+\#notes @notes
+!negated @ignored
+*.[ch]  @ignored
+/README.md @readme @org/Docs
+`)
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		// The catch-all
+		{path: "main.go", expected: []string{"@org/everyone"}},
+		// Any depth, and the last match wins over the catch-all
+		{path: "web/app.js", expected: []string{"@js-owner"}},
+		// Anchored directory patterns match everything below them
+		{path: "build/logs/today.log", expected: []string{"@build"}},
+		{path: "build/logs/2024/old.log", expected: []string{"@build"}},
+		{path: "other/build/logs/today.log", expected: []string{"@org/everyone"}},
+		// Unanchored directory patterns match at any depth
+		{path: "apps/web/main.go", expected: []string{"@apps"}},
+		{path: "services/apps/main.go", expected: []string{"@apps"}},
+		// A file named like a directory pattern isn't a directory
+		{path: "apps", expected: []string{"@org/everyone"}},
+		// A trailing /* only matches the files right in the directory
+		{path: "docs/intro.md", expected: []string{"@docs"}},
+		{path: "docs/guides/setup.md", expected: []string{"@org/everyone"}},
+		// ** matches any number of directories
+		{path: "tests/unit.go", expected: []string{"@testers"}},
+		{path: "pkg/tests/unit.go", expected: []string{"@testers"}},
+		{path: "src/gen/types.go", expected: []string{"@generators"}},
+		{path: "src/a/b/gen/types.go", expected: []string{"@generators"}},
+		// A pattern without owners leaves the files without one
+		{path: "src/vendor/lib.go", expected: nil},
+		// An escaped # is a pattern
+		{path: "#notes", expected: []string{"@notes"}},
+		// Unsupported syntax is skipped
+		{path: "negated", expected: []string{"@org/everyone"}},
+		{path: "main.c", expected: []string{"@org/everyone"}},
+		{path: "README.md", expected: []string{"@readme", "@org/Docs"}},
+		{path: "docs/README.md", expected: []string{"@docs"}},
+	}
+
+	for _, tt := range tests {
+		if got := owners.Owners(tt.path); len(got)+len(tt.expected) > 0 && !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected owners %v, got %v", tt.path, tt.expected, got)
+		}
+	}
+
+	if !owners.IsOwner("@org/docs", "README.md") {
+		t.Error("Expected owners to be compared without regard to case")
+	}
+	if owners.IsOwner("@org/everyone", "README.md") {
+		t.Error("Expected the last matching pattern to replace the owners of earlier ones")
+	}
+}
+
+func TestCodeOwnersPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		matches []string
+		misses  []string
+	}{
+		{pattern: "*", matches: []string{"a", "a/b/c"}},
+		{pattern: "docs", matches: []string{"docs", "docs/a.md", "x/docs/a.md"}, misses: []string{"docsite/a.md"}},
+		{pattern: "/docs", matches: []string{"docs", "docs/a.md"}, misses: []string{"x/docs/a.md"}},
+		{pattern: "a/b", matches: []string{"a/b", "a/b/c"}, misses: []string{"x/a/b"}},
+		{pattern: "file?.txt", matches: []string{"file1.txt", "d/fileA.txt"}, misses: []string{"file10.txt", "file/.txt"}},
+		{pattern: "/**", matches: []string{"a", "a/b"}},
+		{pattern: "a/**", matches: []string{"a/b", "a/b/c"}, misses: []string{"a", "b/a/c"}},
+		{pattern: "*.min.js", matches: []string{"x.min.js", "d/y.min.js"}, misses: []string{"xmin.js"}},
+	}
+
+	for _, tt := range tests {
+		re, err := codeOwnersPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.pattern, err)
+		}
+		for _, path := range tt.matches {
+			if !re.MatchString(path) {
+				t.Errorf("Expected %q to match %q", tt.pattern, path)
+			}
+		}
+		for _, path := range tt.misses {
+			if re.MatchString(path) {
+				t.Errorf("Expected %q not to match %q", tt.pattern, path)
+			}
+		}
+	}
+}
+
+func TestGetCodeOwners(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	repo := NewRepository(repoDir)
+	if _, err := repo.GetCodeOwners("main"); !errors.Is(err, ErrNoCodeOwners) {
+		t.Fatalf("Expected ErrNoCodeOwners, got %v", err)
+	}
+
+	// The first location found is used
+	if err := os.MkdirAll(filepath.Join(repoDir, ".github"), 0755); err != nil {
+		t.Fatalf("Failed to create .github: %v", err)
+	}
+	for path, content := range map[string]string{"CODEOWNERS": "* @root\n", ".github/CODEOWNERS": "* @github\n"} {
+		if err := os.WriteFile(filepath.Join(repoDir, path), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	for _, args := range [][]string{
+		{"add", "."},
+		{"commit", "-m", "Add code owners"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	owners, err := repo.GetCodeOwners("main")
+	if err != nil {
+		t.Fatalf("GetCodeOwners failed: %v", err)
+	}
+	if owners.Path != ".github/CODEOWNERS" || !owners.IsOwner("@github", "test.txt") {
+		t.Errorf("Expected the owners of .github/CODEOWNERS, got %+v", owners)
+	}
+}
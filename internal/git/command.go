@@ -0,0 +1,87 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// configOverrides pin the settings that change the output diffty parses, so
+// it stays the same whatever the user's git config says. External diff
+// drivers are disabled per command with --no-ext-diff, since diff.external
+// can't be unset from the command line.
+var configOverrides = []string{
+	"-c", "core.pager=cat",
+	"-c", "color.ui=false",
+	"-c", "diff.noprefix=false",
+	"-c", "diff.mnemonicPrefix=false",
+	"-c", "diff.srcPrefix=a/",
+	"-c", "diff.dstPrefix=b/",
+	"-c", "diff.relative=false",
+	"-c", "diff.renames=true",
+	"-c", "log.showSignature=false",
+}
+
+// droppedEnv lists the environment variables that would point git at another
+// repository, inject config or change its output, so they aren't passed on
+var droppedEnv = []string{
+	"GIT_DIR",
+	"GIT_WORK_TREE",
+	"GIT_INDEX_FILE",
+	"GIT_OBJECT_DIRECTORY",
+	"GIT_NAMESPACE",
+	"GIT_EXTERNAL_DIFF",
+	"GIT_DIFF_OPTS",
+	"GIT_PAGER",
+	"PAGER",
+	"GIT_CONFIG_PARAMETERS",
+	"GIT_CONFIG_COUNT",
+}
+
+// command returns a git command run against the repository with a sanitized
+// environment: the system config is ignored, config set through the
+// environment is dropped and messages are in English, since diffError
+// classifies failures by their stderr
+func (r *Repository) command(args ...string) *exec.Cmd {
+	fullArgs := make([]string, 0, len(configOverrides)+len(args)+2)
+	fullArgs = append(fullArgs, configOverrides...)
+	fullArgs = append(fullArgs, "-C", r.Path)
+	fullArgs = append(fullArgs, args...)
+
+	cmd := exec.Command("git", fullArgs...)
+	cmd.Env = sanitizedEnv(os.Environ())
+	return cmd
+}
+
+// sanitizedEnv returns env without droppedEnv and the GIT_CONFIG_KEY_<n> and
+// GIT_CONFIG_VALUE_<n> pairs, with the system config and localized messages
+// turned off
+func sanitizedEnv(env []string) []string {
+	sanitized := make([]string, 0, len(env)+3)
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		if isDroppedEnv(name) {
+			continue
+		}
+		sanitized = append(sanitized, entry)
+	}
+	return append(sanitized, "GIT_CONFIG_NOSYSTEM=1", "LC_ALL=C", "LANGUAGE=C")
+}
+
+// isDroppedEnv reports whether the environment variable name isn't passed to git
+func isDroppedEnv(name string) bool {
+	if strings.HasPrefix(name, "GIT_CONFIG_KEY_") || strings.HasPrefix(name, "GIT_CONFIG_VALUE_") {
+		return true
+	}
+	switch name {
+	case "GIT_CONFIG_NOSYSTEM", "LC_ALL", "LANGUAGE":
+		// Set explicitly
+		return true
+	}
+	for _, dropped := range droppedEnv {
+		if name == dropped {
+			return true
+		}
+	}
+	return false
+}
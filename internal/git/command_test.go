@@ -0,0 +1,84 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestDiffIgnoresOutputAlteringConfig(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	// Config and environment that would replace or reshape the patch output
+	for _, setting := range [][]string{
+		{"diff.external", "echo EXTERNAL"},
+		{"diff.noprefix", "true"},
+		{"diff.mnemonicPrefix", "true"},
+		{"color.ui", "always"},
+		{"core.pager", "sed s/^/PAGED/"},
+	} {
+		cmd := exec.Command("git", "-C", repoDir, "config", "--local", setting[0], setting[1])
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Failed to set %s: %v\n%s", setting[0], err, output)
+		}
+	}
+	t.Setenv("GIT_EXTERNAL_DIFF", "echo EXTERNAL")
+	t.Setenv("GIT_DIR", t.TempDir())
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "diff.noprefix")
+	t.Setenv("GIT_CONFIG_VALUE_0", "true")
+
+	repo := NewRepository(repoDir)
+
+	diff, err := repo.GetDiff("feature", "main")
+	if err != nil {
+		t.Fatalf("GetDiff failed: %v", err)
+	}
+	fileDiff, err := repo.GetFileDiff("feature", "main", "test.txt")
+	if err != nil {
+		t.Fatalf("GetFileDiff failed: %v", err)
+	}
+
+	for name, output := range map[string]string{"diff": diff, "file diff": fileDiff} {
+		if strings.Contains(output, "EXTERNAL") || strings.Contains(output, "PAGED") || strings.Contains(output, "\x1b[") {
+			t.Errorf("Expected the %s not to go through the user's external diff, pager or colors, got:\n%s", name, output)
+		}
+		for _, expected := range []string{"diff --git a/test.txt b/test.txt", "--- a/test.txt", "+++ b/test.txt", "+new line"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("Expected the %s to contain %q, got:\n%s", name, expected, output)
+			}
+		}
+	}
+
+	branches, err := repo.GetBranches()
+	if err != nil {
+		t.Fatalf("GetBranches failed: %v", err)
+	}
+	if len(branches) != 2 {
+		t.Errorf("Expected the repository's own branches despite GIT_DIR, got %v", branches)
+	}
+}
+
+func TestSanitizedEnv(t *testing.T) {
+	env := sanitizedEnv([]string{
+		"HOME=/home/user",
+		"PATH=/usr/bin",
+		"GIT_DIR=/elsewhere",
+		"GIT_EXTERNAL_DIFF=echo",
+		"GIT_CONFIG_KEY_0=diff.external",
+		"GIT_CONFIG_VALUE_0=echo",
+		"LC_ALL=fr_FR.UTF-8",
+	})
+
+	expected := []string{"HOME=/home/user", "PATH=/usr/bin", "GIT_CONFIG_NOSYSTEM=1", "LC_ALL=C", "LANGUAGE=C"}
+	if strings.Join(env, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %v, got %v", expected, env)
+	}
+}
@@ -0,0 +1,71 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// ErrDiffTooLarge is returned when a diff's output grows past the
+// DiffOptions.MaxBytes limit. The diff can still be streamed with WriteDiff.
+var ErrDiffTooLarge = errors.New("diff exceeds limit")
+
+// runLimited runs cmd and returns its standard output. With maxBytes above
+// zero it stops reading once the output grows past maxBytes, kills the
+// command and returns ErrDiffTooLarge, so a pathological diff, such as a
+// multi-gigabyte file changing, can't be buffered into memory.
+func runLimited(cmd *exec.Cmd, maxBytes int64) (string, error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	finish := observeCommand(cmd)
+	if err := cmd.Start(); err != nil {
+		finish(err)
+		return "", err
+	}
+
+	var reader io.Reader = stdout
+	if maxBytes > 0 {
+		reader = io.LimitReader(stdout, maxBytes+1)
+	}
+	var out bytes.Buffer
+	_, readErr := out.ReadFrom(reader)
+	if maxBytes > 0 && int64(out.Len()) > maxBytes {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		err := fmt.Errorf("%w of %d bytes", ErrDiffTooLarge, maxBytes)
+		finish(err)
+		return "", err
+	}
+
+	err = cmd.Wait()
+	finish(err)
+	if err != nil {
+		return "", err
+	}
+	if readErr != nil {
+		return "", readErr
+	}
+	return out.String(), nil
+}
+
+// WriteDiff streams the diff between two branches to w as git writes it,
+// without buffering it, so diffs over the DiffOptions.MaxBytes limit can still
+// be downloaded. The limit itself doesn't apply.
+func (r *Repository) WriteDiff(w io.Writer, sourceBranch, targetBranch string, opts DiffOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	cmd := r.command(diffArgs(sourceBranch, targetBranch, opts)...)
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		return r.diffError("diff", err, stderr.String())
+	}
+	return nil
+}
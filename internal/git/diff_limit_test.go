@@ -0,0 +1,65 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffByteLimit(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	// A text file of about 1 MiB, whose diff is larger still
+	content := strings.Repeat("a line of generated content\n", 40000)
+	if err := os.WriteFile(filepath.Join(repoDir, "huge.txt"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write huge file: %v", err)
+	}
+	for _, args := range [][]string{{"add", "huge.txt"}, {"commit", "-m", "Add huge file"}} {
+		if out, err := exec.Command("git", append([]string{"-C", repoDir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+
+	repo := NewRepository(repoDir)
+	limited := DiffOptions{MaxBytes: 64 * 1024}
+
+	if _, err := repo.GetDiffWithOptions("feature", "main", limited); !errors.Is(err, ErrDiffTooLarge) {
+		t.Errorf("Expected ErrDiffTooLarge for the full diff, got %v", err)
+	}
+	if _, err := repo.GetFileDiffWithOptions("feature", "main", "huge.txt", limited); !errors.Is(err, ErrDiffTooLarge) {
+		t.Errorf("Expected ErrDiffTooLarge for the huge file, got %v", err)
+	}
+
+	// Small diffs are unaffected
+	diff, err := repo.GetFileDiffWithOptions("feature", "main", "test.txt", limited)
+	if err != nil || !strings.Contains(diff, "+new line") {
+		t.Errorf("Expected the diff of test.txt within the limit, got %q, %v", diff, err)
+	}
+
+	// The whole diff can still be streamed
+	var out bytes.Buffer
+	if err := repo.WriteDiff(&out, "feature", "main", limited); err != nil {
+		t.Fatalf("WriteDiff failed: %v", err)
+	}
+	full, err := repo.GetDiff("feature", "main")
+	if err != nil {
+		t.Fatalf("GetDiff failed: %v", err)
+	}
+	if out.String() != full {
+		t.Errorf("Expected the streamed diff to match the unlimited one, got %d bytes, expected %d", out.Len(), len(full))
+	}
+
+	if _, err := repo.GetDiffWithOptions("feature", "main", DiffOptions{MaxBytes: -1}); err == nil {
+		t.Error("Expected a negative limit to be rejected")
+	}
+}
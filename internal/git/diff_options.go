@@ -0,0 +1,161 @@
+package git
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// DiffAlgorithms lists the diff algorithms git supports
+var DiffAlgorithms = []string{"myers", "minimal", "patience", "histogram"}
+
+// IgnoreSubmodulesModes lists the values git accepts for --ignore-submodules
+var IgnoreSubmodulesModes = []string{"all", "dirty", "untracked"}
+
+// MaxContextLines is the most context lines a diff can ask for
+const MaxContextLines = 1000
+
+// DiffOptions tweaks how git computes a diff. The zero value uses git's defaults.
+type DiffOptions struct {
+	// Algorithm selects the diff algorithm, one of DiffAlgorithms
+	Algorithm string
+	// IgnoreSubmodules suppresses submodule changes, one of IgnoreSubmodulesModes
+	IgnoreSubmodules string
+	// SubmoduleDiff shows the changes inside submodules instead of their pointer bumps
+	SubmoduleDiff bool
+	// NoRenames turns rename detection off. Huge changesets diff faster, but
+	// renamed files show as a deletion and an addition.
+	NoRenames bool
+	// FindCopiesHarder detects files copied from any file of the source ref,
+	// not only from files changed in the same diff, as git's -C -C does. It
+	// makes git compare every new file against the whole tree, which is slow
+	// on large repositories, so it is only ever turned on by request.
+	FindCopiesHarder bool
+	// Pathspec limits the diff to a directory or file relative to the
+	// repository root, such as a monorepo service's directory, so git never
+	// looks at changes outside of it
+	Pathspec string
+	// ContextLines is how many unchanged lines surround each change; zero
+	// keeps git's default of 3
+	ContextLines int
+	// FunctionContext widens every hunk to the whole function around its
+	// changes, as git's -W does. Functions are found with the diff driver
+	// .gitattributes sets for the file, or git's default heuristic.
+	FunctionContext bool
+	// MaxBytes caps how much of a diff's output is read into memory; past
+	// it, the diff fails with ErrDiffTooLarge. Zero reads diffs of any size.
+	MaxBytes int64
+}
+
+// Validate checks that every option holds an allowed value, so they can be
+// passed to git without risking argument injection
+func (o DiffOptions) Validate() error {
+	if o.Algorithm != "" && !contains(DiffAlgorithms, o.Algorithm) {
+		return fmt.Errorf("invalid diff algorithm: %s", o.Algorithm)
+	}
+
+	if o.IgnoreSubmodules != "" && !contains(IgnoreSubmodulesModes, o.IgnoreSubmodules) {
+		return fmt.Errorf("invalid ignore-submodules mode: %s", o.IgnoreSubmodules)
+	}
+
+	if o.IgnoreSubmodules == "all" && o.SubmoduleDiff {
+		return fmt.Errorf("submodule diffs can't be shown while ignoring all submodule changes")
+	}
+
+	if o.FindCopiesHarder && o.NoRenames {
+		return fmt.Errorf("copies can't be detected while rename detection is off")
+	}
+
+	if o.Pathspec != "" {
+		if err := validatePathspec(o.Pathspec); err != nil {
+			return err
+		}
+	}
+
+	if o.ContextLines < 0 || o.ContextLines > MaxContextLines {
+		return fmt.Errorf("invalid context lines: %d, must be between 0 and %d", o.ContextLines, MaxContextLines)
+	}
+
+	if o.MaxBytes < 0 {
+		return fmt.Errorf("invalid diff byte limit: %d", o.MaxBytes)
+	}
+
+	return nil
+}
+
+// validatePathspec checks that pathspec is a plain path inside the
+// repository. Wildcards and pathspec magic are refused, so the scope is always
+// a literal subtree and InScope can tell which files belong to it.
+func validatePathspec(pathspec string) error {
+	switch {
+	case strings.HasPrefix(pathspec, "-"):
+		return fmt.Errorf("invalid pathspec: %s", pathspec)
+	case strings.HasPrefix(pathspec, ":"):
+		return fmt.Errorf("invalid pathspec %s: pathspec magic isn't supported", pathspec)
+	case strings.ContainsAny(pathspec, "*?[\\\x00"):
+		return fmt.Errorf("invalid pathspec %s: wildcards aren't supported", pathspec)
+	case path.IsAbs(pathspec):
+		return fmt.Errorf("invalid pathspec %s: must be relative to the repository root", pathspec)
+	}
+
+	if cleaned := path.Clean(pathspec); cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("invalid pathspec %s: must name a path inside the repository", pathspec)
+	}
+
+	return nil
+}
+
+// InScope reports whether filePath is inside the options' pathspec. Every
+// path is in scope when there is none.
+func (o DiffOptions) InScope(filePath string) bool {
+	if o.Pathspec == "" {
+		return true
+	}
+	scope := path.Clean(o.Pathspec)
+	return filePath == scope || strings.HasPrefix(filePath, scope+"/")
+}
+
+// pathspecArgs returns the pathspec arguments to end a git diff command with
+func (o DiffOptions) pathspecArgs() []string {
+	if o.Pathspec == "" {
+		return nil
+	}
+	return []string{"--", path.Clean(o.Pathspec)}
+}
+
+// args returns the git diff arguments matching the options
+func (o DiffOptions) args() []string {
+	var args []string
+	if o.Algorithm != "" {
+		args = append(args, "--diff-algorithm="+o.Algorithm)
+	}
+	if o.IgnoreSubmodules != "" {
+		args = append(args, "--ignore-submodules="+o.IgnoreSubmodules)
+	}
+	if o.SubmoduleDiff {
+		args = append(args, "--submodule=diff")
+	}
+	if o.NoRenames {
+		args = append(args, "--no-renames")
+	}
+	if o.FindCopiesHarder {
+		args = append(args, "--find-copies-harder")
+	}
+	if o.ContextLines > 0 {
+		args = append(args, fmt.Sprintf("--unified=%d", o.ContextLines))
+	}
+	if o.FunctionContext {
+		args = append(args, "--function-context")
+	}
+	return args
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,483 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffOptionsAlgorithm(t *testing.T) {
+	for _, algorithm := range DiffAlgorithms {
+		opts := DiffOptions{Algorithm: algorithm}
+		if err := opts.Validate(); err != nil {
+			t.Errorf("Expected algorithm %s to be valid, got %v", algorithm, err)
+		}
+
+		expected := []string{"--diff-algorithm=" + algorithm}
+		if args := opts.args(); !reflect.DeepEqual(args, expected) {
+			t.Errorf("Expected args %v, got %v", expected, args)
+		}
+	}
+
+	// The zero value passes nothing
+	if args := (DiffOptions{}).args(); len(args) != 0 {
+		t.Errorf("Expected no args for default options, got %v", args)
+	}
+
+	// Anything outside the allowed set is rejected
+	for _, algorithm := range []string{"bogus", "patience --output=/tmp/x", "--output=/tmp/x"} {
+		if err := (DiffOptions{Algorithm: algorithm}).Validate(); err == nil {
+			t.Errorf("Expected algorithm %q to be rejected", algorithm)
+		}
+	}
+}
+
+func TestGetDiffWithOptions(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	// Create a test repository
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	// Create repository instance
+	repo := NewRepository(repoDir)
+
+	for _, algorithm := range DiffAlgorithms {
+		diff, err := repo.GetDiffWithOptions("feature", "main", DiffOptions{Algorithm: algorithm})
+		if err != nil {
+			t.Fatalf("GetDiffWithOptions with %s failed: %v", algorithm, err)
+		}
+
+		if !strings.Contains(diff, "+new line") {
+			t.Errorf("Expected %s diff to contain '+new line', got: %s", algorithm, diff)
+		}
+
+		fileDiff, err := repo.GetFileDiffWithOptions("feature", "main", "test.txt", DiffOptions{Algorithm: algorithm})
+		if err != nil {
+			t.Fatalf("GetFileDiffWithOptions with %s failed: %v", algorithm, err)
+		}
+
+		if !strings.Contains(fileDiff, "+new line") {
+			t.Errorf("Expected %s file diff to contain '+new line', got: %s", algorithm, fileDiff)
+		}
+	}
+
+	// Invalid options never reach git
+	if _, err := repo.GetDiffWithOptions("feature", "main", DiffOptions{Algorithm: "bogus"}); err == nil {
+		t.Error("Expected error for invalid algorithm, got nil")
+	}
+
+	if _, err := repo.GetFileDiffWithOptions("feature", "main", "test.txt", DiffOptions{Algorithm: "bogus"}); err == nil {
+		t.Error("Expected error for invalid algorithm, got nil")
+	}
+}
+
+func TestDiffOptionsSubmodules(t *testing.T) {
+	for _, mode := range IgnoreSubmodulesModes {
+		opts := DiffOptions{IgnoreSubmodules: mode}
+		if err := opts.Validate(); err != nil {
+			t.Errorf("Expected ignore-submodules mode %s to be valid, got %v", mode, err)
+		}
+
+		expected := []string{"--ignore-submodules=" + mode}
+		if args := opts.args(); !reflect.DeepEqual(args, expected) {
+			t.Errorf("Expected args %v, got %v", expected, args)
+		}
+	}
+
+	if args := (DiffOptions{SubmoduleDiff: true}).args(); !reflect.DeepEqual(args, []string{"--submodule=diff"}) {
+		t.Errorf("Expected --submodule=diff, got %v", args)
+	}
+
+	for _, mode := range []string{"none --output=/tmp/x", "bogus", "--output=/tmp/x"} {
+		if err := (DiffOptions{IgnoreSubmodules: mode}).Validate(); err == nil {
+			t.Errorf("Expected ignore-submodules mode %q to be rejected", mode)
+		}
+	}
+
+	// Ignoring every submodule change leaves nothing to recurse into
+	if err := (DiffOptions{IgnoreSubmodules: "all", SubmoduleDiff: true}).Validate(); err == nil {
+		t.Error("Expected ignoring all submodules while recursing to be rejected")
+	}
+}
+
+func TestGetDiffSubmodules(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	runGit := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	// A standalone repository used as the submodule
+	subDir := setupTestRepo(t)
+	defer os.RemoveAll(subDir)
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	runGit(repoDir, "-c", "protocol.file.allow=always", "submodule", "add", subDir, "sub")
+	runGit(repoDir, "commit", "-m", "Add submodule")
+	runGit(repoDir, "checkout", "-b", "bump")
+	runGit(repoDir+"/sub", "checkout", "feature")
+	runGit(repoDir, "commit", "-am", "Bump submodule")
+
+	repo := NewRepository(repoDir)
+
+	diff, err := repo.GetDiffWithOptions("bump", "main", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetDiffWithOptions failed: %v", err)
+	}
+	if !strings.Contains(diff, "Subproject commit") {
+		t.Errorf("Expected submodule pointer change, got: %s", diff)
+	}
+
+	// Suppression removes the submodule from the diff
+	diff, err = repo.GetDiffWithOptions("bump", "main", DiffOptions{IgnoreSubmodules: "all"})
+	if err != nil {
+		t.Fatalf("GetDiffWithOptions with ignored submodules failed: %v", err)
+	}
+	if strings.TrimSpace(diff) != "" {
+		t.Errorf("Expected empty diff with ignored submodules, got: %s", diff)
+	}
+
+	// Recursion shows the changes inside the submodule
+	diff, err = repo.GetDiffWithOptions("bump", "main", DiffOptions{SubmoduleDiff: true})
+	if err != nil {
+		t.Fatalf("GetDiffWithOptions with submodule diff failed: %v", err)
+	}
+	if !strings.Contains(diff, "b/sub/test.txt") || !strings.Contains(diff, "+new line") {
+		t.Errorf("Expected diff inside the submodule, got: %s", diff)
+	}
+
+	fileDiff, err := repo.GetFileDiffWithOptions("bump", "main", "sub/test.txt", DiffOptions{SubmoduleDiff: true})
+	if err != nil {
+		t.Fatalf("GetFileDiffWithOptions with submodule diff failed: %v", err)
+	}
+	if !strings.HasPrefix(fileDiff, "diff --git a/sub/test.txt b/sub/test.txt") || !strings.Contains(fileDiff, "+new line") {
+		t.Errorf("Expected file diff inside the submodule, got: %s", fileDiff)
+	}
+}
+
+func TestDiffOptionsPathspec(t *testing.T) {
+	for _, pathspec := range []string{"services/payments", "services/payments/", "README.md", "./services"} {
+		if err := (DiffOptions{Pathspec: pathspec}).Validate(); err != nil {
+			t.Errorf("Expected pathspec %q to be valid, got %v", pathspec, err)
+		}
+	}
+
+	for _, pathspec := range []string{"--output=/tmp/x", ":(exclude)services", "services/*", "/etc", "..", "../other", "services/../..", "."} {
+		if err := (DiffOptions{Pathspec: pathspec}).Validate(); err == nil {
+			t.Errorf("Expected pathspec %q to be rejected", pathspec)
+		}
+	}
+
+	opts := DiffOptions{Pathspec: "services/payments/"}
+	if args := opts.pathspecArgs(); !reflect.DeepEqual(args, []string{"--", "services/payments"}) {
+		t.Errorf("Expected the cleaned pathspec after --, got %v", args)
+	}
+
+	for path, expected := range map[string]bool{
+		"services/payments":         true,
+		"services/payments/main.go": true,
+		"services/payments-v2/x.go": false,
+		"services/billing/main.go":  false,
+		"README.md":                 false,
+	} {
+		if got := opts.InScope(path); got != expected {
+			t.Errorf("Expected InScope(%q) to be %v, got %v", path, expected, got)
+		}
+	}
+
+	if !(DiffOptions{}).InScope("anything") {
+		t.Error("Expected every path to be in scope without a pathspec")
+	}
+}
+
+func TestGetDiffWithPathspec(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	// The feature branch changes a file in and out of the owned service
+	run("checkout", "-q", "feature")
+	for _, dir := range []string{"services/payments", "services/payments-v2"} {
+		if err := os.MkdirAll(filepath.Join(repoDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+		if err := os.WriteFile(filepath.Join(repoDir, dir, "main.go"), []byte("package main\n"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	run("add", ".")
+	run("commit", "-q", "-m", "Add services")
+
+	repo := NewRepository(repoDir)
+	opts := DiffOptions{Pathspec: "services/payments"}
+
+	diff, err := repo.GetDiffWithOptions("feature", "main", opts)
+	if err != nil {
+		t.Fatalf("GetDiffWithOptions failed: %v", err)
+	}
+	if !strings.Contains(diff, "services/payments/main.go") {
+		t.Errorf("Expected the scoped diff to include the service, got: %s", diff)
+	}
+	if strings.Contains(diff, "test.txt") || strings.Contains(diff, "payments-v2") {
+		t.Errorf("Expected files outside the scope to be left out, got: %s", diff)
+	}
+
+	changes, err := repo.GetFilesWithStatus("feature", "main", opts)
+	if err != nil {
+		t.Fatalf("GetFilesWithStatus failed: %v", err)
+	}
+	if expected := []FileChange{{Path: "services/payments/main.go", ChangeType: "A"}}; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected only the scoped file, got %v", changes)
+	}
+
+	// Asking for a file outside the scope yields nothing rather than widening it
+	fileDiff, err := repo.GetFileDiffWithOptions("feature", "main", "test.txt", opts)
+	if err != nil {
+		t.Fatalf("GetFileDiffWithOptions failed: %v", err)
+	}
+	if fileDiff != "" {
+		t.Errorf("Expected no diff for a file outside the scope, got: %s", fileDiff)
+	}
+
+	if _, err := repo.GetDiffWithOptions("feature", "main", DiffOptions{Pathspec: "../outside"}); err == nil {
+		t.Error("Expected a pathspec outside the repository to be rejected")
+	}
+}
+
+func TestDiffOptionsNoRenames(t *testing.T) {
+	args := (DiffOptions{NoRenames: true}).args()
+	if !reflect.DeepEqual(args, []string{"--no-renames"}) {
+		t.Errorf("Expected --no-renames, got %v", args)
+	}
+	for _, arg := range args {
+		if arg == "-M" || strings.HasPrefix(arg, "--find-renames") || arg == "-C" || strings.HasPrefix(arg, "--find-copies") {
+			t.Errorf("Expected no rename detection argument, got %v", args)
+		}
+	}
+}
+
+func TestDiffOptionsContextLines(t *testing.T) {
+	if args := (DiffOptions{ContextLines: 10}).args(); !reflect.DeepEqual(args, []string{"--unified=10"}) {
+		t.Errorf("Expected --unified=10, got %v", args)
+	}
+	if args := (DiffOptions{}).args(); len(args) != 0 {
+		t.Errorf("Expected git's default context without arguments, got %v", args)
+	}
+
+	for _, lines := range []int{-1, MaxContextLines + 1} {
+		if err := (DiffOptions{ContextLines: lines}).Validate(); err == nil {
+			t.Errorf("Expected %d context lines to be rejected", lines)
+		}
+	}
+}
+
+func TestDiffOptionsFunctionContext(t *testing.T) {
+	if args := (DiffOptions{FunctionContext: true}).args(); !reflect.DeepEqual(args, []string{"--function-context"}) {
+		t.Errorf("Expected --function-context, got %v", args)
+	}
+}
+
+func TestGetDiffWithFunctionContext(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repoDir, "main.go"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write main.go: %v", err)
+		}
+	}
+	body := func(changed string) string {
+		lines := []string{"func first() {"}
+		for i := 1; i <= 10; i++ {
+			lines = append(lines, fmt.Sprintf("\tfirst%d()", i))
+		}
+		lines = append(lines, "}", "", "func second() {")
+		for i := 1; i <= 10; i++ {
+			line := fmt.Sprintf("\tsecond%d()", i)
+			if i == 8 {
+				line = changed
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(append(lines, "}"), "\n") + "\n"
+	}
+	write(body("\tsecond8()"))
+	run("add", "main.go")
+	run("commit", "-q", "-m", "Add main.go")
+	write(body("\tchanged()"))
+	run("commit", "-q", "-a", "-m", "Change second")
+
+	repo := NewRepository(repoDir)
+
+	diff, err := repo.GetFileDiffWithOptions("HEAD", "HEAD~1", "main.go", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetFileDiffWithOptions failed: %v", err)
+	}
+	if strings.Contains(diff, "\tsecond1()") {
+		t.Errorf("Expected only 3 lines of context by default, got: %s", diff)
+	}
+
+	// The hunk grows to the whole enclosing function, and no further
+	diff, err = repo.GetFileDiffWithOptions("HEAD", "HEAD~1", "main.go", DiffOptions{FunctionContext: true})
+	if err != nil {
+		t.Fatalf("GetFileDiffWithOptions failed: %v", err)
+	}
+	if !strings.Contains(diff, "\n func second() {\n") || !strings.Contains(diff, "\n \tsecond1()\n") || !strings.Contains(diff, "+\tchanged()") {
+		t.Errorf("Expected the whole second function, got: %s", diff)
+	}
+	if strings.Contains(diff, "first5()") {
+		t.Errorf("Expected the first function to be left out, got: %s", diff)
+	}
+}
+
+func TestGetDiffWithoutRenames(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	run("mv", "test.txt", "renamed.txt")
+	run("commit", "-q", "-m", "Rename test.txt")
+
+	repo := NewRepository(repoDir)
+
+	changes, err := repo.GetFilesWithStatus("HEAD", "HEAD~1", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetFilesWithStatus failed: %v", err)
+	}
+	if expected := []FileChange{{Path: "renamed.txt", ChangeType: "R"}}; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected the rename to be detected by default, got %v", changes)
+	}
+
+	opts := DiffOptions{NoRenames: true}
+	changes, err = repo.GetFilesWithStatus("HEAD", "HEAD~1", opts)
+	if err != nil {
+		t.Fatalf("GetFilesWithStatus failed: %v", err)
+	}
+	if expected := []FileChange{{Path: "renamed.txt", ChangeType: "A"}, {Path: "test.txt", ChangeType: "D"}}; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected a deletion and an addition without rename detection, got %v", changes)
+	}
+
+	diff, err := repo.GetDiffWithOptions("HEAD", "HEAD~1", opts)
+	if err != nil {
+		t.Fatalf("GetDiffWithOptions failed: %v", err)
+	}
+	if strings.Contains(diff, "rename from") {
+		t.Errorf("Expected no rename in the diff, got: %s", diff)
+	}
+
+	fileDiff, err := repo.GetFileDiffWithOptions("HEAD", "HEAD~1", "renamed.txt", opts)
+	if err != nil {
+		t.Fatalf("GetFileDiffWithOptions failed: %v", err)
+	}
+	if !strings.Contains(fileDiff, "new file mode") || strings.Contains(fileDiff, "rename from") {
+		t.Errorf("Expected the file to show as added, got: %s", fileDiff)
+	}
+}
+
+func TestGetDiffFindCopiesHarder(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	// test.txt is left unchanged, so only --find-copies-harder considers it as a source
+	if err := os.WriteFile(filepath.Join(repoDir, "copy.txt"), []byte("initial content"), 0644); err != nil {
+		t.Fatalf("Failed to write copy: %v", err)
+	}
+	run("add", "copy.txt")
+	run("commit", "-q", "-m", "Copy test.txt")
+
+	repo := NewRepository(repoDir)
+
+	changes, err := repo.GetFilesWithStatus("HEAD", "HEAD~1", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetFilesWithStatus failed: %v", err)
+	}
+	if expected := []FileChange{{Path: "copy.txt", ChangeType: "A"}}; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected the copy to show as added by default, got %v", changes)
+	}
+
+	opts := DiffOptions{FindCopiesHarder: true}
+	changes, err = repo.GetFilesWithStatus("HEAD", "HEAD~1", opts)
+	if err != nil {
+		t.Fatalf("GetFilesWithStatus failed: %v", err)
+	}
+	if expected := []FileChange{{Path: "copy.txt", ChangeType: "C"}}; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected the copy to be detected, got %v", changes)
+	}
+
+	fileDiff, err := repo.GetFileDiffWithOptions("HEAD", "HEAD~1", "copy.txt", opts)
+	if err != nil {
+		t.Fatalf("GetFileDiffWithOptions failed: %v", err)
+	}
+	if !strings.Contains(fileDiff, "copy from test.txt") || strings.Contains(fileDiff, "new file mode") {
+		t.Errorf("Expected the file diff to show the copy, got: %s", fileDiff)
+	}
+
+	if err := (DiffOptions{FindCopiesHarder: true, NoRenames: true}).Validate(); err == nil {
+		t.Error("Expected copy detection without rename detection to be rejected")
+	}
+}
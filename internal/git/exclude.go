@@ -0,0 +1,123 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrExclusionConflict is returned when a commit can't be taken out of a
+// branch because later commits changed the same lines
+var ErrExclusionConflict = errors.New("excluded commit conflicts with later changes")
+
+// Commit is a commit of a branch, as listed by GetCommits
+type Commit struct {
+	Hash    string
+	Subject string
+	// Merge is set for commits with more than one parent
+	Merge bool
+}
+
+// GetCommits returns the commits source has that target doesn't, newest
+// first, as listed by git log target..source. A limit above zero returns at
+// most that many commits.
+func (r *Repository) GetCommits(source, target string, limit int) ([]Commit, error) {
+	// Names come from URLs, so never let one be taken as an option
+	if strings.HasPrefix(source, "-") || strings.HasPrefix(target, "-") {
+		return nil, fmt.Errorf("invalid revision range: %s..%s", target, source)
+	}
+
+	args := []string{"log", "--format=%H%x00%P%x00%s"}
+	if limit > 0 {
+		args = append(args, fmt.Sprintf("--max-count=%d", limit))
+	}
+	args = append(args, target+".."+source, "--")
+
+	cmd := r.command(args...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		return nil, fmt.Errorf("failed to list commits between %s and %s: %w: %s", target, source, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var commits []Commit
+	for _, line := range strings.Split(out.String(), "\n") {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		commits = append(commits, Commit{
+			Hash:    fields[0],
+			Subject: fields[2],
+			Merge:   len(strings.Fields(fields[1])) > 1,
+		})
+	}
+	return commits, nil
+}
+
+// TreeWithout returns the hash of the tree of source with the changes of the
+// given commits reverted, in the given order, so newer commits should come
+// first. A merge commit's changes are those it brought in over its first
+// parent. The tree and its blobs are written to the object database, but no
+// ref, index or working tree file changes. ErrExclusionConflict is returned
+// when a commit's changes can't be reverted cleanly.
+func (r *Repository) TreeWithout(source string, commits []string) (string, error) {
+	if source == "" || strings.HasPrefix(source, "-") {
+		return "", fmt.Errorf("invalid ref: %q", source)
+	}
+	for _, commit := range commits {
+		if !IsCommitHash(commit) {
+			return "", fmt.Errorf("invalid commit: %q", commit)
+		}
+	}
+
+	// A scratch index keeps the repository's own index untouched
+	dir, err := os.MkdirTemp("", "diffty-index-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create index: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	index := filepath.Join(dir, "index")
+
+	run := func(stdin []byte, args ...string) (string, string, error) {
+		cmd := r.command(args...)
+		cmd.Env = append(cmd.Env, "GIT_INDEX_FILE="+index)
+		var out, stderr bytes.Buffer
+		cmd.Stdin = bytes.NewReader(stdin)
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+		err := run(cmd)
+		return out.String(), strings.TrimSpace(stderr.String()), err
+	}
+
+	if _, stderr, err := run(nil, "read-tree", source+"^{tree}"); err != nil {
+		return "", r.diffError("tree of "+source, err, stderr)
+	}
+
+	for _, commit := range commits {
+		parent, err := r.GetParentCommitHash(commit)
+		if err != nil {
+			return "", err
+		}
+		patch, stderr, err := run(nil, "diff-tree", "-p", "--binary", "--full-index", parent, commit)
+		if err != nil {
+			return "", r.diffError("changes of "+commit, err, stderr)
+		}
+		if patch == "" {
+			continue
+		}
+		if _, stderr, err := run([]byte(patch), "apply", "--cached", "--reverse", "--whitespace=nowarn"); err != nil {
+			return "", fmt.Errorf("%w: %s: %s", ErrExclusionConflict, commit, stderr)
+		}
+	}
+
+	tree, stderr, err := run(nil, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("failed to write tree: %w: %s", err, stderr)
+	}
+	return strings.TrimSpace(tree), nil
+}
@@ -0,0 +1,109 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTreeWithout(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(name, content, message string) string {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		run("add", name)
+		run("commit", "-m", message)
+		return run("rev-parse", "HEAD")
+	}
+
+	// On feature: a formatting commit between two real changes, then a merge of main
+	run("checkout", "feature")
+	commit("a.txt", "a\n", "Add a")
+	format := commit("test.txt", "initial content\nnew line\n", "Reformat")
+	commit("c.txt", "c\n", "Add c")
+	run("checkout", "main")
+	commit("m.txt", "m\n", "Add m on main")
+	run("checkout", "feature")
+	run("merge", "--no-edit", "main")
+	merge := run("rev-parse", "HEAD")
+
+	repo := NewRepository(repoDir)
+	commits, err := repo.GetCommits("feature", "main", 0)
+	if err != nil {
+		t.Fatalf("GetCommits failed: %v", err)
+	}
+	var subjects []string
+	for _, c := range commits {
+		subjects = append(subjects, c.Subject)
+		if c.Merge != (c.Hash == merge) {
+			t.Errorf("Expected only the merge commit to be a merge, got %+v", c)
+		}
+	}
+	if strings.Join(subjects, ", ") != "Merge branch 'main' into feature, Add c, Reformat, Add a, Add new line" {
+		t.Errorf("Unexpected commits, newest first: %q", subjects)
+	}
+	if limited, _ := repo.GetCommits("feature", "main", 2); len(limited) != 2 || limited[0].Hash != merge {
+		t.Errorf("Expected the two newest commits, got %+v", limited)
+	}
+
+	tree, err := repo.TreeWithout("feature", []string{format})
+	if err != nil {
+		t.Fatalf("TreeWithout failed: %v", err)
+	}
+	diff, err := repo.GetDiff(tree, "feature")
+	if err != nil {
+		t.Fatalf("GetDiff failed: %v", err)
+	}
+	if !strings.Contains(diff, "-new line\n+new line\n\\ No newline at end of file") || strings.Contains(diff, "a.txt") || strings.Contains(diff, "c.txt") {
+		t.Errorf("Expected only the formatting commit to be reverted, got:\n%s", diff)
+	}
+
+	// A merge's changes are those over its first parent
+	tree, err = repo.TreeWithout("feature", []string{merge, format})
+	if err != nil {
+		t.Fatalf("TreeWithout failed: %v", err)
+	}
+	files, err := repo.GetFiles(tree, "feature")
+	if err != nil {
+		t.Fatalf("GetFiles failed: %v", err)
+	}
+	if strings.Join(files, " ") != "m.txt test.txt" {
+		t.Errorf("Expected the merged and reformatted files to differ, got %q", files)
+	}
+
+	// The repository itself is untouched
+	if status := run("status", "--porcelain"); status != "" {
+		t.Errorf("Expected a clean working tree and index, got %q", status)
+	}
+
+	// A commit later commits build on can't be taken out
+	commit("test.txt", "initial content\nnew line, edited\n", "Edit the new line")
+	if _, err := repo.TreeWithout("feature", []string{format}); !errors.Is(err, ErrExclusionConflict) {
+		t.Errorf("Expected ErrExclusionConflict, got %v", err)
+	}
+
+	if _, err := repo.TreeWithout("feature", []string{"--help"}); err == nil {
+		t.Error("Expected an invalid commit to be rejected")
+	}
+}
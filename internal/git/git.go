@@ -2,17 +2,126 @@ package git
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+// ErrNoMergeBase is returned when two refs don't share any history
+var ErrNoMergeBase = errors.New("no common ancestor")
+
+// ErrUndiffable is returned when git can't produce a diff between the given
+// refs at all, as opposed to failing for an unrelated reason
+var ErrUndiffable = errors.New("refs can't be diffed")
+
+// ErrShallowHistory is returned alongside ErrUndiffable or instead of
+// ErrNoMergeBase when the repository is a shallow or partial clone, whose
+// missing history is the likely cause of the failure
+var ErrShallowHistory = errors.New("history is missing from a shallow or partial clone")
+
+// ErrFileNotFound is returned when a ref has no file at the requested path
+var ErrFileNotFound = errors.New("file not found")
+
+// ErrFileTooLarge is returned when a file is larger than the caller is willing
+// to read
+var ErrFileTooLarge = errors.New("file too large")
+
+// undiffablePatterns are git error messages telling that the refs of a diff
+// are missing, unreadable or not commits
+var undiffablePatterns = []string{
+	"bad object",
+	"bad revision",
+	"unknown revision",
+	"invalid revision range",
+	"not a tree object",
+	"could not parse object",
+	"unable to read tree",
+	"missing tree",
+}
+
+// diffError wraps a failed diff command's error, classifying it as
+// ErrUndiffable when its stderr matches one of undiffablePatterns
+func diffError(what string, err error, stderr string) error {
+	message := strings.TrimSpace(stderr)
+	lower := strings.ToLower(message)
+	for _, pattern := range undiffablePatterns {
+		if strings.Contains(lower, pattern) {
+			return fmt.Errorf("%w: %s", ErrUndiffable, strings.TrimPrefix(message, "fatal: "))
+		}
+	}
+	if message != "" {
+		return fmt.Errorf("failed to get %s: %w: %s", what, err, message)
+	}
+	return fmt.Errorf("failed to get %s: %w", what, err)
+}
+
+// diffError classifies a failed diff command like the diffError function, also
+// blaming the missing history of a shallow or partial clone for refs git
+// can't diff
+func (r *Repository) diffError(what string, err error, stderr string) error {
+	err = diffError(what, err, stderr)
+	if errors.Is(err, ErrUndiffable) && r.IsShallow() {
+		return fmt.Errorf("%w: %w", ErrShallowHistory, err)
+	}
+	return err
+}
+
+// EmptyTreeHash is the hash of git's empty tree, which root commits are diffed against
+const EmptyTreeHash = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// stashRefPattern matches stash references such as stash@{0}
+var stashRefPattern = regexp.MustCompile(`^stash@\{\d+\}$`)
+
 // Repository represents a git repository
 type Repository struct {
 	Name string
 	Path string
+	// Available reports whether the repository was found on disk when it was loaded
+	Available bool
+}
+
+// StashInfo represents a single entry of the stash list
+type StashInfo struct {
+	Ref     string // e.g. stash@{0}
+	Commit  string
+	Message string
+}
+
+// commitHashPattern matches full or abbreviated hexadecimal object names
+var commitHashPattern = regexp.MustCompile(`^[0-9a-f]{4,64}$`)
+
+// IsCommitHash reports whether s looks like a commit hash, so it can be passed
+// to git without being mistaken for an option or a ref name
+func IsCommitHash(s string) bool {
+	return commitHashPattern.MatchString(s)
+}
+
+// IsStashRef reports whether ref names a stash entry (stash@{n})
+func IsStashRef(ref string) bool {
+	return stashRefPattern.MatchString(ref)
+}
+
+// Version returns the path of the git binary in use and its reported version
+func Version() (string, string, error) {
+	path, err := exec.LookPath("git")
+	if err != nil {
+		return "", "", fmt.Errorf("git not found in PATH: %w", err)
+	}
+
+	cmd := exec.Command(path, "--version")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return path, "", fmt.Errorf("failed to get git version: %w", err)
+	}
+
+	return path, strings.TrimPrefix(strings.TrimSpace(out.String()), "git version "), nil
 }
 
 // IsValidRepo checks if the given path is a valid git repository
@@ -30,71 +139,826 @@ func NewRepository(path string) *Repository {
 	}
 }
 
+// IsShallow reports whether the repository is a shallow clone, or a partial
+// clone whose missing objects are fetched on demand
+func (r *Repository) IsShallow() bool {
+	var out bytes.Buffer
+	cmd := r.command("rev-parse", "--is-shallow-repository")
+	cmd.Stdout = &out
+	if err := run(cmd); err == nil && strings.TrimSpace(out.String()) == "true" {
+		return true
+	}
+
+	// Partial clones record the remote to fetch missing objects from
+	out.Reset()
+	cmd = r.command("config", "--get", "extensions.partialClone")
+	cmd.Stdout = &out
+	return run(cmd) == nil && strings.TrimSpace(out.String()) != ""
+}
+
+// IsDirty reports whether the working tree has uncommitted changes, including
+// untracked files. Diffs compare commits, so they are never affected by them.
+// Bare repositories have no working tree and are never dirty.
+func (r *Repository) IsDirty() (bool, error) {
+	var out bytes.Buffer
+	cmd := r.command("rev-parse", "--is-bare-repository")
+	cmd.Stdout = &out
+	if err := run(cmd); err != nil {
+		return false, fmt.Errorf("failed to check for a working tree: %w", err)
+	}
+	if strings.TrimSpace(out.String()) == "true" {
+		return false, nil
+	}
+
+	// Only looking, so git mustn't take the index lock to refresh it, which
+	// would get in the way of the user's own git commands
+	out.Reset()
+	cmd = r.command("status", "--porcelain")
+	cmd.Env = append(cmd.Env, "GIT_OPTIONAL_LOCKS=0")
+	cmd.Stdout = &out
+	if err := run(cmd); err != nil {
+		return false, fmt.Errorf("failed to get working tree status: %w", err)
+	}
+	return strings.TrimSpace(out.String()) != "", nil
+}
+
 // GetBranches returns a list of all branches in the repository
 func (r *Repository) GetBranches() ([]string, error) {
-	cmd := exec.Command("git", "-C", r.Path, "branch", "--format=%(refname:short)")
+	// Full refnames, unlike refname:short, are never disambiguated against
+	// tags or other refs sharing the branch's name
+	cmd := r.command("for-each-ref", "--format=%(refname)", "refs/heads")
 	var out bytes.Buffer
 	cmd.Stdout = &out
-	err := cmd.Run()
+	err := run(cmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list branches: %w", err)
 	}
 
-	branches := strings.Split(strings.TrimSpace(out.String()), "\n")
-	return branches, nil
+	return parseBranchList(out.String()), nil
+}
+
+// parseBranchList returns the branch names of a branch listing, one per line.
+// Besides the full refnames GetBranches asks for, it copes with the output of
+// a plain git branch: the "* " and "+ " markers of the current branch and of
+// branches checked out in other worktrees, indentation, and detached HEAD
+// lines. Branch names can't contain whitespace, so none of this can be part of
+// a name.
+func parseBranchList(output string) []string {
+	branches := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if marker, rest, ok := strings.Cut(line, " "); ok && (marker == "*" || marker == "+") {
+			line = strings.TrimSpace(rest)
+		}
+		// A detached HEAD is listed as "(HEAD detached at ...)", which isn't a branch
+		if line == "" || strings.HasPrefix(line, "(") {
+			continue
+		}
+		if branch := strings.TrimPrefix(line, "refs/heads/"); branch != "" {
+			branches = append(branches, branch)
+		}
+	}
+	return branches
+}
+
+// GetStashes returns the stash entries of the repository, most recent first
+func (r *Repository) GetStashes() ([]StashInfo, error) {
+	cmd := r.command("stash", "list", "--format=%gd%x00%H%x00%gs")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err := run(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stashes: %w", err)
+	}
+
+	stashes := []StashInfo{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		// Handle empty stash list case
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, "\x00", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		stashes = append(stashes, StashInfo{
+			Ref:     parts[0],
+			Commit:  parts[1],
+			Message: parts[2],
+		})
+	}
+
+	return stashes, nil
+}
+
+// GetRemoteDefaultBranch returns the default branch of the given remote as a
+// remote-tracking ref (e.g. origin/main). It resolves the remote's HEAD symbolic
+// ref, falling back to <remote>/main and <remote>/master. An empty string is
+// returned when the remote doesn't exist or none of these refs are present.
+func (r *Repository) GetRemoteDefaultBranch(remote string) (string, error) {
+	cmd := r.command("symbolic-ref", "--quiet", "--short", "refs/remotes/"+remote+"/HEAD")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := run(cmd); err == nil {
+		return strings.TrimSpace(out.String()), nil
+	}
+
+	for _, branch := range []string{"main", "master"} {
+		cmd := r.command("rev-parse", "--verify", "--quiet", "refs/remotes/"+remote+"/"+branch)
+		err := run(cmd)
+		if err == nil {
+			return remote + "/" + branch, nil
+		}
+
+		// rev-parse --verify --quiet exits with 1 when the ref is missing
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", fmt.Errorf("failed to resolve default branch of %s: %w", remote, err)
+		}
+	}
+
+	return "", nil
+}
+
+// GetCurrentBranch returns the branch checked out in the repository's working
+// tree, or an empty string when HEAD is detached
+func (r *Repository) GetCurrentBranch() (string, error) {
+	cmd := r.command("symbolic-ref", "--quiet", "--short", "HEAD")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := run(cmd); err != nil {
+		// symbolic-ref --quiet exits with 1 when HEAD isn't a symbolic ref
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get current branch: %w", err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// GetDefaultBranch returns the branch reviews are usually compared against:
+// the local branch tracking origin's default branch, or origin's default
+// branch itself when there is no such local branch, falling back to a local
+// main or master. An empty string is returned when none of these exist.
+func (r *Repository) GetDefaultBranch() (string, error) {
+	remoteDefault, err := r.GetRemoteDefaultBranch("origin")
+	if err != nil {
+		return "", err
+	}
+
+	candidates := []string{"main", "master"}
+	if remoteDefault != "" {
+		candidates = []string{strings.TrimPrefix(remoteDefault, "origin/")}
+	}
+	for _, branch := range candidates {
+		err := run(r.command("rev-parse", "--verify", "--quiet", "refs/heads/"+branch))
+		if err == nil {
+			return branch, nil
+		}
+
+		// rev-parse --verify --quiet exits with 1 when the ref is missing
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", fmt.Errorf("failed to resolve default branch: %w", err)
+		}
+	}
+
+	return remoteDefault, nil
 }
 
-// GetBranchCommitHash returns the commit hash for a branch
+// GetBranchCommitHash returns the commit hash for a branch. A local branch
+// takes precedence over a tag or remote ref with the same name; other
+// revisions (stash entries, "branch^") are resolved as git would. Reflog
+// revisions such as feature@{1} or feature@{yesterday} are looked up in the
+// branch's reflog, failing with ErrNoReflogEntry when it has no such entry.
+// WorkingTree resolves to a snapshot of the working tree, see
+// SnapshotWorkingTree.
 func (r *Repository) GetBranchCommitHash(branch string) (string, error) {
-	cmd := exec.Command("git", "-C", r.Path, "rev-parse", branch)
+	// Names come from URLs, so never let one be taken as an option
+	if branch == "" || strings.HasPrefix(branch, "-") {
+		return "", fmt.Errorf("invalid branch name: %q", branch)
+	}
+
+	if IsWorkingTree(branch) {
+		return r.SnapshotWorkingTree()
+	}
+
+	if base, selector, ok := parseReflogRef(branch); ok {
+		return r.resolveReflogRef(branch, base, selector)
+	}
+
+	for _, rev := range []string{"refs/heads/" + branch, branch} {
+		cmd := r.command("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		err := run(cmd)
+		if err == nil {
+			return strings.TrimSpace(out.String()), nil
+		}
+
+		// rev-parse --verify --quiet exits with 1 when the revision is missing
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", fmt.Errorf("failed to get commit hash for branch %s: %w", branch, err)
+		}
+	}
+
+	return "", fmt.Errorf("failed to get commit hash for branch %s: unknown revision", branch)
+}
+
+// GetParentCommitHash returns the hash of the first parent of a commit. For a
+// root commit, which has no parent, it returns EmptyTreeHash so the commit can
+// still be diffed against it.
+func (r *Repository) GetParentCommitHash(commit string) (string, error) {
+	cmd := r.command("rev-list", "--parents", "-n", "1", commit, "--")
 	var out bytes.Buffer
 	cmd.Stdout = &out
-	err := cmd.Run()
+	err := run(cmd)
 	if err != nil {
-		return "", fmt.Errorf("failed to get commit hash for branch %s: %w", branch, err)
+		return "", fmt.Errorf("failed to get parent of commit %s: %w", commit, err)
 	}
 
+	// The output is the commit itself followed by its parents
+	fields := strings.Fields(out.String())
+	if len(fields) < 2 {
+		return EmptyTreeHash, nil
+	}
+
+	return fields[1], nil
+}
+
+// GetMergeBase returns the best common ancestor of two branches, the commit
+// git diff target...source diffs source against. It returns ErrNoMergeBase if
+// the two have unrelated histories.
+func (r *Repository) GetMergeBase(source, target string) (string, error) {
+	// Resolve the names the way the diff view does, so a tag can't shadow a branch
+	sourceCommit, err := r.GetBranchCommitHash(source)
+	if err != nil {
+		return "", err
+	}
+	targetCommit, err := r.GetBranchCommitHash(target)
+	if err != nil {
+		return "", err
+	}
+	return r.mergeBase(source, target, sourceCommit, targetCommit)
+}
+
+// mergeBase returns the merge base of two resolved commits, naming them by
+// the refs they were resolved from in errors
+func (r *Repository) mergeBase(source, target, sourceCommit, targetCommit string) (string, error) {
+	cmd := r.command("merge-base", targetCommit, sourceCommit)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		// merge-base exits with 1 and no message when there is no common ancestor
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && stderr.Len() == 0 {
+			// The common ancestor may just not have been fetched
+			if r.IsShallow() {
+				return "", fmt.Errorf("%w: no common ancestor of %s and %s was fetched", ErrShallowHistory, source, target)
+			}
+			return "", ErrNoMergeBase
+		}
+		return "", fmt.Errorf("failed to find merge base of %s and %s: %w", source, target, err)
+	}
 	return strings.TrimSpace(out.String()), nil
 }
 
+// GetAheadBehind returns how many commits source has that target doesn't
+// (ahead) and how many target has that source doesn't (behind). It returns
+// ErrNoMergeBase if the two have unrelated histories.
+func (r *Repository) GetAheadBehind(source, target string) (int, int, error) {
+	// Resolve the names the way the diff view does, so a tag can't shadow a branch
+	sourceCommit, err := r.GetBranchCommitHash(source)
+	if err != nil {
+		return 0, 0, err
+	}
+	targetCommit, err := r.GetBranchCommitHash(target)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if _, err := r.mergeBase(source, target, sourceCommit, targetCommit); err != nil {
+		return 0, 0, err
+	}
+
+	cmd := r.command("rev-list", "--left-right", "--count", targetCommit+"..."+sourceCommit, "--")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := run(cmd); err != nil {
+		return 0, 0, fmt.Errorf("failed to count commits between %s and %s: %w", source, target, err)
+	}
+
+	// The output is "<behind>\t<ahead>": the left side is target, the right side source
+	var ahead, behind int
+	if _, err := fmt.Sscanf(out.String(), "%d\t%d", &behind, &ahead); err != nil {
+		return 0, 0, fmt.Errorf("unexpected rev-list output %q: %w", out.String(), err)
+	}
+
+	return ahead, behind, nil
+}
+
+// GetCommitSubjects returns the subjects of the commits source has that
+// target doesn't, oldest first, as listed by git log target..source
+func (r *Repository) GetCommitSubjects(source, target string) ([]string, error) {
+	// Names come from URLs, so never let one be taken as an option
+	if strings.HasPrefix(source, "-") || strings.HasPrefix(target, "-") {
+		return nil, fmt.Errorf("invalid revision range: %s..%s", target, source)
+	}
+
+	cmd := r.command("log", "--format=%s", "--reverse", target+".."+source, "--")
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		return nil, fmt.Errorf("failed to list commits between %s and %s: %w: %s", target, source, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var subjects []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line != "" {
+			subjects = append(subjects, line)
+		}
+	}
+	return subjects, nil
+}
+
 // GetDiff returns the diff between two branches
 // targetBranch is the base branch (what we're merging INTO, e.g. main)
 // sourceBranch is the feature branch (what we're merging FROM, e.g. feature-branch)
+// When sourceBranch is a stash ref, the stash is diffed against its own base
+// commit and targetBranch is ignored.
 func (r *Repository) GetDiff(sourceBranch, targetBranch string) (string, error) {
-	cmd := exec.Command("git", "-C", r.Path, "diff", "--no-color", targetBranch, sourceBranch)
+	return r.GetDiffWithOptions(sourceBranch, targetBranch, DiffOptions{})
+}
+
+// GetDiffWithOptions returns the diff between two branches computed with the given options
+func (r *Repository) GetDiffWithOptions(sourceBranch, targetBranch string, opts DiffOptions) (string, error) {
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+
+	cmd := r.command(diffArgs(sourceBranch, targetBranch, opts)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := runLimited(cmd, opts.MaxBytes)
+	if errors.Is(err, ErrDiffTooLarge) {
+		return "", err
+	}
+	if err != nil {
+		return "", r.diffError("diff", err, stderr.String())
+	}
+
+	return out, nil
+}
+
+// diffArgs returns the git arguments of the diff between two branches
+func diffArgs(sourceBranch, targetBranch string, opts DiffOptions) []string {
+	if IsStashRef(sourceBranch) && opts.Pathspec == "" {
+		args := []string{"stash", "show", "-p", "--no-color", "--no-ext-diff", "--full-index"}
+		args = append(args, opts.args()...)
+		return append(args, sourceBranch)
+	}
+
+	// git stash show doesn't accept a pathspec, so a scoped stash is diffed against its base instead
+	if IsStashRef(sourceBranch) {
+		targetBranch = sourceBranch + "^1"
+	}
+
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--full-index"}
+	args = append(args, opts.args()...)
+	args = append(args, targetBranch, sourceBranch)
+	return append(args, opts.pathspecArgs()...)
+}
+
+// GetUntrackedFiles returns the files of the working tree git doesn't track,
+// leaving out ignored ones
+func (r *Repository) GetUntrackedFiles() ([]string, error) {
+	cmd := r.command("ls-files", "-z", "--others", "--exclude-standard")
 	var out bytes.Buffer
 	cmd.Stdout = &out
-	err := cmd.Run()
+	if err := run(cmd); err != nil {
+		return nil, fmt.Errorf("failed to list untracked files: %w", err)
+	}
+
+	files := []string{}
+	for _, file := range strings.Split(out.String(), "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// ErrPathNotFound is returned when a path to diff exists at neither of the given refs
+var ErrPathNotFound = errors.New("path not found")
+
+// GetPathDiff returns the diff between oldPath at targetRef and newPath at
+// sourceRef, for files git doesn't relate by itself, such as a file split out
+// of another. A side whose path doesn't exist at its ref is diffed as empty,
+// so the file shows as added or deleted; ErrPathNotFound is returned when
+// neither exists.
+func (r *Repository) GetPathDiff(targetRef, oldPath, sourceRef, newPath string) (string, error) {
+	if oldPath == "" || newPath == "" {
+		return "", fmt.Errorf("both paths are required")
+	}
+
+	targetCommit, err := r.GetBranchCommitHash(targetRef)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUndiffable, err)
+	}
+	sourceCommit, err := r.GetBranchCommitHash(sourceRef)
 	if err != nil {
-		return "", fmt.Errorf("failed to get diff: %w", err)
+		return "", fmt.Errorf("%w: %v", ErrUndiffable, err)
+	}
+
+	oldExists, err := r.blobExists(targetCommit, oldPath)
+	if err != nil {
+		return "", err
+	}
+	newExists, err := r.blobExists(sourceCommit, newPath)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--full-index"}
+	switch {
+	case oldExists && newExists:
+		args = append(args, targetCommit+":"+oldPath, sourceCommit+":"+newPath)
+	case newExists:
+		args = append(args, EmptyTreeHash, sourceCommit, "--", newPath)
+	case oldExists:
+		args = append(args, targetCommit, EmptyTreeHash, "--", oldPath)
+	default:
+		return "", fmt.Errorf("%w: %s at %s, %s at %s", ErrPathNotFound, oldPath, targetRef, newPath, sourceRef)
+	}
+
+	cmd := r.command(args...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		return "", r.diffError("path diff", err, stderr.String())
 	}
 
 	return out.String(), nil
 }
 
+// CommitExists reports whether commit names a commit of the repository, such
+// as to tell a commit hash that belongs to another repository apart from a
+// failing git command
+func (r *Repository) CommitExists(commit string) (bool, error) {
+	if commit == "" || strings.HasPrefix(commit, "-") {
+		return false, nil
+	}
+	if err := run(r.command("cat-file", "-e", commit+"^{commit}")); err != nil {
+		// cat-file exits with 128 when the object doesn't exist or isn't a commit
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to look up commit %s: %w", commit, err)
+	}
+	return true, nil
+}
+
+// ResolveCommit returns the full hash of the commit a full or abbreviated
+// commit hash names, and false when it names no commit of the repository or
+// is ambiguous. Anything but a hash, such as a branch name, isn't resolved.
+func (r *Repository) ResolveCommit(commit string) (string, bool, error) {
+	if !IsCommitHash(commit) {
+		return "", false, nil
+	}
+	cmd := r.command("rev-parse", "--verify", "--quiet", commit+"^{commit}")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := run(cmd); err != nil {
+		// rev-parse --verify --quiet exits with 1 when the revision is missing
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to resolve commit %s: %w", commit, err)
+	}
+	return strings.TrimSpace(out.String()), true, nil
+}
+
+// blobExists reports whether path names a file at commit. Directories and
+// submodules don't count, since they can't be diffed as a file.
+func (r *Repository) blobExists(commit, path string) (bool, error) {
+	cmd := r.command("cat-file", "-t", commit+":"+path)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := run(cmd); err != nil {
+		// cat-file exits with 128 when the path doesn't exist at the commit
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to look up %s: %w", path, err)
+	}
+	return strings.TrimSpace(out.String()) == "blob", nil
+}
+
+// GetFileSize returns the size in bytes of a file at a ref. It returns
+// ErrFileNotFound when the ref has no such file, including when the path
+// names a directory or a submodule there.
+func (r *Repository) GetFileSize(ref, filePath string) (int64, error) {
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return 0, fmt.Errorf("invalid ref: %q", ref)
+	}
+
+	// cat-file would give the size of a tree just as well
+	isBlob, err := r.blobExists(ref, filePath)
+	if err != nil {
+		return 0, err
+	}
+	if !isBlob {
+		return 0, fmt.Errorf("%w: %s at %s", ErrFileNotFound, filePath, ref)
+	}
+
+	cmd := r.command("cat-file", "-s", ref+":"+filePath)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		// cat-file exits with 128 when the path or the ref doesn't exist
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return 0, fmt.Errorf("%w: %s at %s", ErrFileNotFound, filePath, ref)
+		}
+		return 0, fmt.Errorf("failed to look up %s at %s: %w: %s", filePath, ref, err, strings.TrimSpace(stderr.String()))
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected size of %s at %s: %w", filePath, ref, err)
+	}
+	return size, nil
+}
+
+// GetFileContent returns the content of a file at a ref, as shown by
+// "git show <ref>:<path>". Files larger than maxSize bytes aren't read and
+// yield ErrFileTooLarge.
+func (r *Repository) GetFileContent(ref, filePath string, maxSize int64) (string, error) {
+	size, err := r.GetFileSize(ref, filePath)
+	if err != nil {
+		return "", err
+	}
+	if size > maxSize {
+		return "", fmt.Errorf("%w: %s is %d bytes", ErrFileTooLarge, filePath, size)
+	}
+
+	cmd := r.command("show", ref+":"+filePath)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		return "", fmt.Errorf("failed to read %s at %s: %w: %s", filePath, ref, err, strings.TrimSpace(stderr.String()))
+	}
+	return out.String(), nil
+}
+
+// WriteFileContent streams the content of a file at a ref to w as
+// "git show <ref>:<path>" writes it, without reading it into memory. It
+// returns ErrFileNotFound when the ref has no such file.
+func (r *Repository) WriteFileContent(w io.Writer, ref, filePath string) error {
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid ref: %q", ref)
+	}
+
+	cmd := r.command("show", ref+":"+filePath)
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		// show exits with 128 when the path or the ref doesn't exist
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 128 {
+			return fmt.Errorf("%w: %s at %s", ErrFileNotFound, filePath, ref)
+		}
+		return fmt.Errorf("failed to read %s at %s: %w: %s", filePath, ref, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
 // GetFileDiff returns the diff for a specific file between two branches
 // targetBranch is the base branch (what we're merging INTO, e.g. main)
 // sourceBranch is the feature branch (what we're merging FROM, e.g. feature-branch)
 func (r *Repository) GetFileDiff(sourceBranch, targetBranch, filePath string) (string, error) {
-	cmd := exec.Command("git", "-C", r.Path, "diff", "--no-color", targetBranch, sourceBranch, "--", filePath)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+	return r.GetFileDiffWithOptions(sourceBranch, targetBranch, filePath, DiffOptions{})
+}
+
+// GetFileDiffWithOptions returns the diff for a specific file computed with the given options
+func (r *Repository) GetFileDiffWithOptions(sourceBranch, targetBranch, filePath string, opts DiffOptions) (string, error) {
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+
+	// git stash show doesn't accept a pathspec, so diff the stash against its base instead
+	if IsStashRef(sourceBranch) {
+		targetBranch = sourceBranch + "^1"
+	}
+
+	// The file's own pathspec would widen the scope rather than narrow it
+	if !opts.InScope(filePath) {
+		return "", nil
+	}
+
+	// A pathspec can't reach into a submodule, so take the file out of the full diff
+	if opts.SubmoduleDiff {
+		diffText, err := r.GetDiffWithOptions(sourceBranch, targetBranch, opts)
+		if err != nil {
+			return "", err
+		}
+		return ExtractFileDiff(diffText, filePath), nil
+	}
+
+	diffText, err := r.pathsDiff(sourceBranch, targetBranch, opts, filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to get file diff: %w", err)
+		return "", err
 	}
 
-	return out.String(), nil
+	// Limited to its own path, a renamed or copied file looks added, so diff
+	// it along with the path it came from to only show what changed
+	if !opts.NoRenames && strings.Contains(diffText, "\nnew file mode ") {
+		oldPath, err := r.renameSource(sourceBranch, targetBranch, filePath, opts)
+		if err != nil {
+			return "", err
+		}
+		if oldPath != "" {
+			renameDiff, err := r.pathsDiff(sourceBranch, targetBranch, opts, oldPath, filePath)
+			if err != nil {
+				return "", err
+			}
+			return ExtractFileDiff(renameDiff, filePath), nil
+		}
+	}
+
+	return diffText, nil
+}
+
+// pathsDiff returns the diff between two refs limited to the given paths
+func (r *Repository) pathsDiff(sourceBranch, targetBranch string, opts DiffOptions, paths ...string) (string, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--full-index"}
+	args = append(args, opts.args()...)
+	args = append(args, targetBranch, sourceBranch, "--")
+	args = append(args, paths...)
+
+	cmd := r.command(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := runLimited(cmd, opts.MaxBytes)
+	if errors.Is(err, ErrDiffTooLarge) {
+		return "", err
+	}
+	if err != nil {
+		return "", r.diffError("file diff", err, stderr.String())
+	}
+
+	return out, nil
+}
+
+// renameSource returns the path filePath was renamed or copied from between
+// two refs, or an empty string when it was neither. Copies are only detected
+// with DiffOptions.FindCopiesHarder.
+func (r *Repository) renameSource(sourceBranch, targetBranch, filePath string, opts DiffOptions) (string, error) {
+	args := []string{"diff", "--name-status", "-z", "--diff-filter=RC"}
+	args = append(args, opts.args()...)
+	args = append(args, targetBranch, sourceBranch)
+	args = append(args, opts.pathspecArgs()...)
+
+	cmd := r.command(args...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		return "", r.diffError("renamed files", err, stderr.String())
+	}
+
+	// Each rename or copy is "R<score>" or "C<score>", the old path and the new path
+	fields := strings.Split(strings.TrimSuffix(out.String(), "\x00"), "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		if fields[i+2] == filePath {
+			return fields[i+1], nil
+		}
+	}
+	return "", nil
+}
+
+// CombinedDiffPath returns the path of a file header of a combined diff, the
+// format git show and git log --cc use for merge commits: "diff --cc <path>" or
+// "diff --combined <path>". Combined diffs name each file once, without the
+// a/ and b/ prefixes.
+func CombinedDiffPath(line string) (string, bool) {
+	if path, ok := strings.CutPrefix(line, "diff --cc "); ok {
+		return path, true
+	}
+	return strings.CutPrefix(line, "diff --combined ")
+}
+
+// ExtractFileDiff returns the section of a multi-file diff belonging to filePath
+func ExtractFileDiff(diffText, filePath string) string {
+	var section strings.Builder
+	inFile := false
+	for _, line := range strings.SplitAfter(diffText, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			inFile = strings.HasSuffix(strings.TrimSuffix(line, "\n"), " b/"+filePath)
+		} else if path, ok := CombinedDiffPath(strings.TrimSuffix(line, "\n")); ok {
+			inFile = path == filePath
+		}
+		if inFile {
+			section.WriteString(line)
+		}
+	}
+	return section.String()
+}
+
+// ChangeTypes lists the change types a file can have in a diff: added,
+// modified, deleted, renamed, copied and type changed, such as a symbolic
+// link replaced by a regular file
+var ChangeTypes = []string{"A", "M", "D", "R", "C", "T"}
+
+// FileChange is a file changed between two refs along with how it changed
+type FileChange struct {
+	Path string
+	// ChangeType is the file's status letter as git diff --name-status reports
+	// it, one of ChangeTypes for the common cases
+	ChangeType string
+}
+
+// GetFilesWithStatus returns the files changed between two branches along with
+// their change type. Renamed and copied files are listed under their new path.
+func (r *Repository) GetFilesWithStatus(sourceBranch, targetBranch string, opts DiffOptions) ([]FileChange, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	cmd := r.command(changedFilesArgs("--name-status", sourceBranch, targetBranch, opts)...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		return nil, r.diffError("changed files", err, stderr.String())
+	}
+
+	return parseNameStatus(out.String()), nil
+}
+
+// changedFilesArgs returns the arguments listing the files changed between two
+// branches in the given format, such as --name-status, NUL-terminated. A stash
+// is shown against the commit it was created on.
+func changedFilesArgs(format, sourceBranch, targetBranch string, opts DiffOptions) []string {
+	if IsStashRef(sourceBranch) && opts.Pathspec == "" {
+		args := []string{"stash", "show", format, "-z"}
+		args = append(args, opts.args()...)
+		return append(args, sourceBranch)
+	}
+	if IsStashRef(sourceBranch) {
+		targetBranch = sourceBranch + "^1"
+	}
+
+	args := []string{"diff", format, "-z"}
+	args = append(args, opts.args()...)
+	args = append(args, targetBranch, sourceBranch)
+	return append(args, opts.pathspecArgs()...)
+}
+
+// parseNameStatus parses the output of git diff --name-status -z: a status
+// field followed by the path, or by the old and the new path for renames and copies
+func parseNameStatus(output string) []FileChange {
+	fields := strings.Split(strings.TrimSuffix(output, "\x00"), "\x00")
+
+	changes := []FileChange{}
+	for i := 0; i+1 < len(fields) && fields[i] != ""; i += 2 {
+		// Renames and copies carry a similarity score, e.g. R100
+		changeType := fields[i][:1]
+		if changeType == "R" || changeType == "C" {
+			i++
+			if i+1 >= len(fields) {
+				break
+			}
+		}
+		changes = append(changes, FileChange{Path: fields[i+1], ChangeType: changeType})
+	}
+	return changes
 }
 
 // GetFiles returns a list of files that have changed between two branches
 // targetBranch is the base branch (what we're merging INTO, e.g. main)
 // sourceBranch is the feature branch (what we're merging FROM, e.g. feature-branch)
 func (r *Repository) GetFiles(sourceBranch, targetBranch string) ([]string, error) {
-	cmd := exec.Command("git", "-C", r.Path, "diff", "--name-only", targetBranch, sourceBranch)
+	cmd := r.command("diff", "--name-only", targetBranch, sourceBranch)
+	if IsStashRef(sourceBranch) {
+		cmd = r.command("stash", "show", "--name-only", sourceBranch)
+	}
 	var out bytes.Buffer
 	cmd.Stdout = &out
-	err := cmd.Run()
+	err := run(cmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get changed files: %w", err)
 	}
@@ -1,9 +1,11 @@
 package git
 
 import (
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -160,6 +162,48 @@ func TestGetBranches(t *testing.T) {
 	}
 }
 
+func TestParseBranchList(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected []string
+	}{
+		{
+			name:     "full refnames",
+			output:   "refs/heads/feature/x\nrefs/heads/main\n",
+			expected: []string{"feature/x", "main"},
+		},
+		{
+			name:     "git branch markers",
+			output:   "  feature\n* main\n+ worktree-branch\n",
+			expected: []string{"feature", "main", "worktree-branch"},
+		},
+		{
+			name:     "detached HEAD",
+			output:   "* (HEAD detached at 1a2b3c4)\n  main\n",
+			expected: []string{"main"},
+		},
+		{
+			name:     "stray whitespace and carriage returns",
+			output:   "  refs/heads/main \r\n\t+   topic\r\n\n",
+			expected: []string{"main", "topic"},
+		},
+		{
+			name:     "empty",
+			output:   "",
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseBranchList(tt.output); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
 func TestGetBranchCommitHash(t *testing.T) {
 	// Skip if git is not available
 	if _, err := exec.LookPath("git"); err != nil {
@@ -289,6 +333,114 @@ func TestGetFileDiff(t *testing.T) {
 	}
 }
 
+func TestGetFileContent(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	repo := NewRepository(repoDir)
+
+	content, err := repo.GetFileContent("feature", "test.txt", 1024)
+	if err != nil {
+		t.Fatalf("GetFileContent failed: %v", err)
+	}
+	if content != "initial content\nnew line" {
+		t.Errorf("Expected the feature content, got %q", content)
+	}
+
+	if _, err := repo.GetFileContent("feature", "test.txt", 4); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("Expected ErrFileTooLarge, got %v", err)
+	}
+
+	if _, err := repo.GetFileContent("feature", "missing.txt", 1024); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound for a missing file, got %v", err)
+	}
+
+	if size, err := repo.GetFileSize("main", "test.txt"); err != nil || size != int64(len("initial content")) {
+		t.Errorf("Expected the size of test.txt at main, got %d (%v)", size, err)
+	}
+
+	// Directories aren't files
+	if err := os.MkdirAll(filepath.Join(repoDir, "dir"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "dir", "nested.txt"), []byte("nested\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	for _, args := range [][]string{{"add", "dir"}, {"commit", "-m", "Add a directory"}} {
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	for _, dir := range []string{"dir", "dir/", ""} {
+		if _, err := repo.GetFileSize("HEAD", dir); !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("Expected ErrFileNotFound for the directory %q, got %v", dir, err)
+		}
+	}
+
+	if _, err := repo.GetFileContent("--output=/tmp/x", "test.txt", 1024); err == nil {
+		t.Error("Expected an error for a ref looking like an option")
+	}
+
+	var out strings.Builder
+	if err := repo.WriteFileContent(&out, "feature", "test.txt"); err != nil || out.String() != "initial content\nnew line" {
+		t.Errorf("Expected the feature content streamed, got %q (%v)", out.String(), err)
+	}
+	if err := repo.WriteFileContent(&out, "main", "missing.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound for a missing streamed file, got %v", err)
+	}
+}
+
+func TestGetFileDiffRenamedWithEdits(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	content := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\n"
+	if err := os.WriteFile(filepath.Join(repoDir, "old.txt"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	run("add", "old.txt")
+	run("commit", "-q", "-m", "Add old.txt")
+	run("mv", "old.txt", "new.txt")
+	if err := os.WriteFile(filepath.Join(repoDir, "new.txt"), []byte(strings.Replace(content, "four", "FOUR", 1)), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	run("commit", "-q", "-am", "Rename old.txt")
+
+	repo := NewRepository(repoDir)
+	diff, err := repo.GetFileDiff("HEAD", "HEAD~1", "new.txt")
+	if err != nil {
+		t.Fatalf("GetFileDiff failed: %v", err)
+	}
+
+	for _, part := range []string{"rename from old.txt", "rename to new.txt", "similarity index", "-four", "+FOUR"} {
+		if !strings.Contains(diff, part) {
+			t.Errorf("Expected diff to contain %q, got: %s", part, diff)
+		}
+	}
+	if strings.Contains(diff, "new file mode") || strings.Contains(diff, "+one") {
+		t.Errorf("Expected only the edit of the renamed file, got: %s", diff)
+	}
+}
+
 func TestGetFiles(t *testing.T) {
 	// Skip if git is not available
 	if _, err := exec.LookPath("git"); err != nil {
@@ -333,3 +485,988 @@ func isHexString(s string) bool {
 	}
 	return true
 }
+
+func TestGetStashes(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	// Create a test repository
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	// Create repository instance
+	repo := NewRepository(repoDir)
+
+	// No stashes yet
+	stashes, err := repo.GetStashes()
+	if err != nil {
+		t.Fatalf("GetStashes failed: %v", err)
+	}
+
+	if len(stashes) != 0 {
+		t.Errorf("Expected no stashes, got %d: %v", len(stashes), stashes)
+	}
+
+	// Stash a working tree change
+	if err := os.WriteFile(filepath.Join(repoDir, "test.txt"), []byte("initial content\nstashed line"), 0644); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+
+	cmd := exec.Command("git", "-C", repoDir, "stash", "push", "-m", "work in progress")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to stash changes: %v", err)
+	}
+
+	stashes, err = repo.GetStashes()
+	if err != nil {
+		t.Fatalf("GetStashes failed: %v", err)
+	}
+
+	if len(stashes) != 1 {
+		t.Fatalf("Expected 1 stash, got %d: %v", len(stashes), stashes)
+	}
+
+	if stashes[0].Ref != "stash@{0}" {
+		t.Errorf("Expected stash ref 'stash@{0}', got '%s'", stashes[0].Ref)
+	}
+
+	if len(stashes[0].Commit) != 40 || !isHexString(stashes[0].Commit) {
+		t.Errorf("Invalid stash commit hash: %s", stashes[0].Commit)
+	}
+
+	if !strings.Contains(stashes[0].Message, "work in progress") {
+		t.Errorf("Expected stash message to contain 'work in progress', got '%s'", stashes[0].Message)
+	}
+
+	// The stash commit hash is what review state is keyed on
+	hash, err := repo.GetBranchCommitHash("stash@{0}")
+	if err != nil {
+		t.Fatalf("GetBranchCommitHash for stash failed: %v", err)
+	}
+
+	if hash != stashes[0].Commit {
+		t.Errorf("Expected stash hash %s, got %s", stashes[0].Commit, hash)
+	}
+
+	// Diff commands understand stash refs
+	diff, err := repo.GetDiff("stash@{0}", "feature")
+	if err != nil {
+		t.Fatalf("GetDiff for stash failed: %v", err)
+	}
+
+	if !strings.Contains(diff, "+stashed line") {
+		t.Errorf("Expected stash diff to contain '+stashed line', got: %s", diff)
+	}
+
+	fileDiff, err := repo.GetFileDiff("stash@{0}", "feature", "test.txt")
+	if err != nil {
+		t.Fatalf("GetFileDiff for stash failed: %v", err)
+	}
+
+	if !strings.Contains(fileDiff, "+stashed line") {
+		t.Errorf("Expected stash file diff to contain '+stashed line', got: %s", fileDiff)
+	}
+
+	files, err := repo.GetFiles("stash@{0}", "feature")
+	if err != nil {
+		t.Fatalf("GetFiles for stash failed: %v", err)
+	}
+
+	if len(files) != 1 || files[0] != "test.txt" {
+		t.Errorf("Expected stash files to be [test.txt], got %v", files)
+	}
+}
+
+func TestIsStashRef(t *testing.T) {
+	tests := map[string]bool{
+		"stash@{0}":  true,
+		"stash@{12}": true,
+		"stash":      false,
+		"stash@{x}":  false,
+		"main":       false,
+		"feature":    false,
+	}
+
+	for ref, expected := range tests {
+		if got := IsStashRef(ref); got != expected {
+			t.Errorf("IsStashRef(%q) = %v, expected %v", ref, got, expected)
+		}
+	}
+}
+
+func TestIsCommitHash(t *testing.T) {
+	tests := map[string]bool{
+		"4b825dc642cb6eb9a060e54bf8d69288fbee4904": true,
+		"4b825dc":         true,
+		"abc":             false,
+		"main":            false,
+		"--output=/tmp/x": false,
+		"4B825DC":         false,
+		"4b825dc^1":       false,
+		"":                false,
+	}
+
+	for s, expected := range tests {
+		if got := IsCommitHash(s); got != expected {
+			t.Errorf("IsCommitHash(%q) = %v, expected %v", s, got, expected)
+		}
+	}
+}
+
+func TestGetRemoteDefaultBranch(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	// Create a test repository acting as the remote
+	remoteDir := setupTestRepo(t)
+	defer os.RemoveAll(remoteDir)
+
+	// A repository without remotes has no default branch to offer
+	repo := NewRepository(remoteDir)
+	branch, err := repo.GetRemoteDefaultBranch("origin")
+	if err != nil {
+		t.Fatalf("GetRemoteDefaultBranch failed: %v", err)
+	}
+
+	if branch != "" {
+		t.Errorf("Expected no default branch without a remote, got '%s'", branch)
+	}
+
+	// Clone it so origin/HEAD is set up
+	cloneDir, err := os.MkdirTemp("", "diffty-git-clone")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(cloneDir)
+
+	cmd := exec.Command("git", "clone", "--quiet", remoteDir, cloneDir)
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to clone repository: %v", err)
+	}
+
+	clone := NewRepository(cloneDir)
+	branch, err = clone.GetRemoteDefaultBranch("origin")
+	if err != nil {
+		t.Fatalf("GetRemoteDefaultBranch failed: %v", err)
+	}
+
+	if branch != "origin/main" {
+		t.Errorf("Expected 'origin/main', got '%s'", branch)
+	}
+
+	// The resolved ref can be diffed against
+	if _, err := clone.GetDiff("origin/feature", branch); err != nil {
+		t.Errorf("Expected diff against %s to succeed: %v", branch, err)
+	}
+
+	// Without origin/HEAD, fall back to origin/main
+	cmd = exec.Command("git", "-C", cloneDir, "remote", "set-head", "origin", "--delete")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to delete origin/HEAD: %v", err)
+	}
+
+	branch, err = clone.GetRemoteDefaultBranch("origin")
+	if err != nil {
+		t.Fatalf("GetRemoteDefaultBranch failed: %v", err)
+	}
+
+	if branch != "origin/main" {
+		t.Errorf("Expected fallback to 'origin/main', got '%s'", branch)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	path, version, err := Version()
+	if err != nil {
+		t.Fatalf("Failed to get git version: %v", err)
+	}
+
+	if path == "" {
+		t.Error("Expected git path to be set")
+	}
+	if version == "" || strings.HasPrefix(version, "git version") {
+		t.Errorf("Expected bare version number, got %q", version)
+	}
+}
+
+func TestGetParentCommitHash(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	repo := NewRepository(repoDir)
+
+	mainHash, err := repo.GetBranchCommitHash("main")
+	if err != nil {
+		t.Fatalf("GetBranchCommitHash for main failed: %v", err)
+	}
+	featureHash, err := repo.GetBranchCommitHash("feature")
+	if err != nil {
+		t.Fatalf("GetBranchCommitHash for feature failed: %v", err)
+	}
+
+	// The feature tip is a child of main
+	parent, err := repo.GetParentCommitHash(featureHash)
+	if err != nil {
+		t.Fatalf("GetParentCommitHash failed: %v", err)
+	}
+	if parent != mainHash {
+		t.Errorf("Expected parent %s, got %s", mainHash, parent)
+	}
+
+	// The root commit is diffed against the empty tree
+	parent, err = repo.GetParentCommitHash(mainHash)
+	if err != nil {
+		t.Fatalf("GetParentCommitHash for root commit failed: %v", err)
+	}
+	if parent != EmptyTreeHash {
+		t.Errorf("Expected empty tree for root commit, got %s", parent)
+	}
+
+	diff, err := repo.GetDiff(mainHash, parent)
+	if err != nil {
+		t.Fatalf("GetDiff against the empty tree failed: %v", err)
+	}
+	if !strings.Contains(diff, "+initial content") {
+		t.Errorf("Expected root commit diff to add test.txt, got: %s", diff)
+	}
+
+	if _, err := repo.GetParentCommitHash("nonexistent"); err == nil {
+		t.Error("Expected error for non-existent commit, got nil")
+	}
+}
+
+func TestGetAheadBehind(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	repo := NewRepository(repoDir)
+
+	ahead, behind, err := repo.GetAheadBehind("feature", "main")
+	if err != nil {
+		t.Fatalf("GetAheadBehind failed: %v", err)
+	}
+	if ahead != 1 || behind != 0 {
+		t.Errorf("Expected 1 ahead, 0 behind, got %d ahead, %d behind", ahead, behind)
+	}
+
+	// Move main forward
+	if err := os.WriteFile(filepath.Join(repoDir, "main.txt"), []byte("main"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	run("add", "main.txt")
+	run("commit", "-m", "Main change")
+
+	ahead, behind, err = repo.GetAheadBehind("feature", "main")
+	if err != nil {
+		t.Fatalf("GetAheadBehind failed: %v", err)
+	}
+	if ahead != 1 || behind != 1 {
+		t.Errorf("Expected 1 ahead, 1 behind, got %d ahead, %d behind", ahead, behind)
+	}
+
+	// A branch without shared history has no merge base
+	run("checkout", "--orphan", "unrelated")
+	run("commit", "-m", "Unrelated root")
+	run("checkout", "main")
+
+	if _, _, err := repo.GetAheadBehind("unrelated", "main"); !errors.Is(err, ErrNoMergeBase) {
+		t.Errorf("Expected ErrNoMergeBase for unrelated histories, got %v", err)
+	}
+
+	if _, _, err := repo.GetAheadBehind("nonexistent", "main"); err == nil || errors.Is(err, ErrNoMergeBase) {
+		t.Errorf("Expected an error for a non-existent branch, got %v", err)
+	}
+}
+
+func TestGetCommitSubjects(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	run("checkout", "feature")
+	run("commit", "--allow-empty", "-m", "Second change", "-m", "With a body")
+	run("checkout", "main")
+
+	repo := NewRepository(repoDir)
+
+	subjects, err := repo.GetCommitSubjects("feature", "main")
+	if err != nil {
+		t.Fatalf("GetCommitSubjects failed: %v", err)
+	}
+	if expected := []string{"Add new line", "Second change"}; !reflect.DeepEqual(subjects, expected) {
+		t.Errorf("Expected %v, oldest first, got %v", expected, subjects)
+	}
+
+	if subjects, err := repo.GetCommitSubjects("main", "feature"); err != nil || len(subjects) != 0 {
+		t.Errorf("Expected no commits, got %v, %v", subjects, err)
+	}
+	if _, err := repo.GetCommitSubjects("--all", "main"); err == nil {
+		t.Error("Expected a revision starting with a dash to be rejected")
+	}
+}
+
+// TestShallowClone tests that a shallow clone still diffs its branch tips, and
+// blames its missing history when comparing further back fails
+func TestShallowClone(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	originDir := setupTestRepo(t)
+	defer os.RemoveAll(originDir)
+
+	run := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	// Move main past the commit feature branched from
+	if err := os.WriteFile(filepath.Join(originDir, "main.txt"), []byte("main"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	run(originDir, "add", "main.txt")
+	run(originDir, "commit", "-m", "Main change")
+	forkPoint := run(originDir, "rev-parse", "main~1")
+
+	// Only the branch tips are fetched, not the commit they share
+	cloneDir := t.TempDir()
+	run(originDir, "clone", "--quiet", "--depth", "1", "--no-single-branch", "file://"+originDir, cloneDir)
+	run(cloneDir, "branch", "feature", "origin/feature")
+
+	full := NewRepository(originDir)
+	if full.IsShallow() {
+		t.Error("Expected a full clone not to be reported as shallow")
+	}
+	repo := NewRepository(cloneDir)
+	if !repo.IsShallow() {
+		t.Fatal("Expected the clone to be reported as shallow")
+	}
+
+	_, _, err := repo.GetAheadBehind("feature", "main")
+	if !errors.Is(err, ErrShallowHistory) || errors.Is(err, ErrNoMergeBase) {
+		t.Errorf("Expected ErrShallowHistory instead of unrelated histories, got %v", err)
+	}
+
+	// Branch tips are diffed directly, so the missing merge base doesn't matter
+	diff, err := repo.GetDiff("feature", "main")
+	if err != nil {
+		t.Fatalf("Expected the branch tips of a shallow clone to diff, got %v", err)
+	}
+	if !strings.Contains(diff, "+new line") {
+		t.Errorf("Expected the feature change in the diff, got %q", diff)
+	}
+
+	// The fork point itself wasn't fetched
+	_, err = repo.GetDiff(forkPoint, "main")
+	if !errors.Is(err, ErrShallowHistory) || !errors.Is(err, ErrUndiffable) {
+		t.Errorf("Expected a missing commit to be blamed on the shallow clone, got %v", err)
+	}
+}
+
+func TestIsDirty(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+	repo := NewRepository(repoDir)
+
+	if dirty, err := repo.IsDirty(); err != nil || dirty {
+		t.Fatalf("Expected a clean working tree, got %v, %v", dirty, err)
+	}
+
+	// An untracked file makes the working tree dirty
+	untracked := filepath.Join(repoDir, "untracked.txt")
+	if err := os.WriteFile(untracked, []byte("new"), 0644); err != nil {
+		t.Fatalf("Failed to write untracked file: %v", err)
+	}
+	if dirty, err := repo.IsDirty(); err != nil || !dirty {
+		t.Errorf("Expected an untracked file to make the working tree dirty, got %v, %v", dirty, err)
+	}
+	if err := os.Remove(untracked); err != nil {
+		t.Fatalf("Failed to remove untracked file: %v", err)
+	}
+
+	// So does a change to a tracked file
+	if err := os.WriteFile(filepath.Join(repoDir, "test.txt"), []byte("changed content"), 0644); err != nil {
+		t.Fatalf("Failed to write test.txt: %v", err)
+	}
+	if dirty, err := repo.IsDirty(); err != nil || !dirty {
+		t.Errorf("Expected a modified file to make the working tree dirty, got %v, %v", dirty, err)
+	}
+
+	// A bare repository has no working tree to be dirty
+	bareDir := t.TempDir()
+	if out, err := exec.Command("git", "clone", "--quiet", "--bare", repoDir, bareDir).CombinedOutput(); err != nil {
+		t.Fatalf("Failed to clone bare repository: %v\n%s", err, out)
+	}
+	if dirty, err := NewRepository(bareDir).IsDirty(); err != nil || dirty {
+		t.Errorf("Expected a bare repository not to be dirty, got %v, %v", dirty, err)
+	}
+}
+
+func TestBranchNamesWithSpecialCharacters(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	run("branch", "topic/foo-bar", "feature")
+	run("branch", "release-1.2", "main")
+	// A tag named like a branch but pointing elsewhere must not shadow it
+	run("tag", "release-1.2", "feature")
+
+	repo := NewRepository(repoDir)
+
+	branches, err := repo.GetBranches()
+	if err != nil {
+		t.Fatalf("GetBranches failed: %v", err)
+	}
+	for _, expected := range []string{"topic/foo-bar", "release-1.2"} {
+		found := false
+		for _, branch := range branches {
+			found = found || branch == expected
+		}
+		if !found {
+			t.Errorf("Expected branch %s in %v", expected, branches)
+		}
+	}
+
+	mainHash, _ := repo.GetBranchCommitHash("main")
+	releaseHash, err := repo.GetBranchCommitHash("release-1.2")
+	if err != nil {
+		t.Fatalf("GetBranchCommitHash for release-1.2 failed: %v", err)
+	}
+	if releaseHash != mainHash {
+		t.Errorf("Expected release-1.2 to resolve to the branch (%s), got %s", mainHash, releaseHash)
+	}
+
+	topicHash, err := repo.GetBranchCommitHash("topic/foo-bar")
+	if err != nil {
+		t.Fatalf("GetBranchCommitHash for topic/foo-bar failed: %v", err)
+	}
+
+	diff, err := repo.GetDiff(topicHash, releaseHash)
+	if err != nil {
+		t.Fatalf("GetDiff failed: %v", err)
+	}
+	if !strings.Contains(diff, "test.txt") {
+		t.Errorf("Expected the diff to include test.txt, got %s", diff)
+	}
+
+	// The tag would put release-1.2 on feature; the branch is where main is
+	if ahead, behind, err := repo.GetAheadBehind("topic/foo-bar", "release-1.2"); err != nil || ahead != 1 || behind != 0 {
+		t.Errorf("Expected 1 ahead, 0 behind, got %d ahead, %d behind (%v)", ahead, behind, err)
+	}
+
+	// Names that could be taken as options are refused
+	if _, err := repo.GetBranchCommitHash("--all"); err == nil {
+		t.Error("Expected an error for a branch name starting with a dash")
+	}
+}
+
+func TestGetDiffUndiffable(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	repo := NewRepository(repoDir)
+
+	// A well-formed hash that names no object
+	missing := strings.Repeat("1", 40)
+	if _, err := repo.GetDiff(missing, "main"); !errors.Is(err, ErrUndiffable) {
+		t.Errorf("Expected ErrUndiffable for a missing commit, got %v", err)
+	}
+	if _, err := repo.GetFileDiff("feature", missing, "test.txt"); !errors.Is(err, ErrUndiffable) {
+		t.Errorf("Expected ErrUndiffable for a missing commit in a file diff, got %v", err)
+	}
+
+	// Other failures are not mistaken for undiffable refs
+	broken := NewRepository(t.TempDir())
+	if _, err := broken.GetDiff("feature", "main"); err == nil || errors.Is(err, ErrUndiffable) {
+		t.Errorf("Expected a generic error outside a repository, got %v", err)
+	}
+}
+
+func TestGetFilesWithStatus(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	// Give main a file to delete and one to rename
+	run("checkout", "main")
+	content := strings.Repeat("a line that stays the same\n", 20)
+	for _, name := range []string{"old.txt", "gone.txt"} {
+		if err := os.WriteFile(filepath.Join(repoDir, name), []byte(content+name+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	run("add", "old.txt", "gone.txt")
+	run("commit", "-m", "Add files")
+
+	run("checkout", "-b", "changes")
+	run("mv", "old.txt", "new name.txt")
+	run("rm", "gone.txt")
+	if err := os.WriteFile(filepath.Join(repoDir, "added.txt"), []byte("added\n"), 0644); err != nil {
+		t.Fatalf("Failed to write added.txt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "test.txt"), []byte("modified content"), 0644); err != nil {
+		t.Fatalf("Failed to write test.txt: %v", err)
+	}
+	run("add", "-A")
+	run("commit", "-m", "Change files")
+
+	repo := NewRepository(repoDir)
+	changes, err := repo.GetFilesWithStatus("changes", "main", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetFilesWithStatus failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"added.txt":    "A",
+		"gone.txt":     "D",
+		"new name.txt": "R",
+		"test.txt":     "M",
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %+v", len(expected), changes)
+	}
+	for _, change := range changes {
+		if expected[change.Path] != change.ChangeType {
+			t.Errorf("Expected %s to be %s, got %s", change.Path, expected[change.Path], change.ChangeType)
+		}
+	}
+}
+
+func TestParseNameStatus(t *testing.T) {
+	output := "M\x00a.go\x00R087\x00old.go\x00new.go\x00C100\x00src.go\x00copy.go\x00A\x00b.go\x00"
+	expected := []FileChange{
+		{Path: "a.go", ChangeType: "M"},
+		{Path: "new.go", ChangeType: "R"},
+		{Path: "copy.go", ChangeType: "C"},
+		{Path: "b.go", ChangeType: "A"},
+	}
+
+	changes := parseNameStatus(output)
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], changes[i])
+		}
+	}
+
+	if changes := parseNameStatus(""); len(changes) != 0 {
+		t.Errorf("Expected no changes for empty output, got %+v", changes)
+	}
+}
+
+func TestSnapshotWorkingTreeWithUntrackedFiles(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	// A tracked change, an untracked file and an ignored one
+	if err := os.WriteFile(filepath.Join(repoDir, "test.txt"), []byte("changed content"), 0644); err != nil {
+		t.Fatalf("Failed to write test.txt: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(repoDir, "new dir"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "new dir", "untracked.txt"), []byte("first\nsecond\n"), 0644); err != nil {
+		t.Fatalf("Failed to write untracked file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, ".git", "info", "exclude"), []byte("ignored.txt\n"), 0644); err != nil {
+		t.Fatalf("Failed to write exclude file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "ignored.txt"), []byte("ignored"), 0644); err != nil {
+		t.Fatalf("Failed to write ignored file: %v", err)
+	}
+
+	repo := NewRepository(repoDir)
+
+	untracked, err := repo.GetUntrackedFiles()
+	if err != nil {
+		t.Fatalf("GetUntrackedFiles failed: %v", err)
+	}
+	if len(untracked) != 1 || untracked[0] != "new dir/untracked.txt" {
+		t.Errorf("Expected only the untracked file, got %v", untracked)
+	}
+
+	snapshot, err := repo.GetBranchCommitHash(WorkingTree)
+	if err != nil {
+		t.Fatalf("Failed to snapshot the working tree: %v", err)
+	}
+	diff, err := repo.GetDiffWithOptions(snapshot, "feature", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetDiffWithOptions failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		"diff --git a/test.txt b/test.txt",
+		"+changed content",
+		"diff --git a/new dir/untracked.txt b/new dir/untracked.txt",
+		"new file mode 100644",
+		"--- /dev/null",
+		"+first\n+second\n",
+	} {
+		if !strings.Contains(diff, expected) {
+			t.Errorf("Expected the working tree diff to contain %q, got:\n%s", expected, diff)
+		}
+	}
+	if strings.Contains(diff, "ignored.txt") {
+		t.Errorf("Expected ignored files to be left out, got:\n%s", diff)
+	}
+
+	// The repository's own state is left alone, and an unchanged working tree
+	// snapshots to the same commit
+	status, err := exec.Command("git", "-C", repoDir, "status", "--porcelain").Output()
+	if err != nil {
+		t.Fatalf("git status failed: %v", err)
+	}
+	if !strings.Contains(string(status), `?? "new dir/"`) || !strings.Contains(string(status), " M test.txt") {
+		t.Errorf("Expected the working tree still uncommitted, got:\n%s", status)
+	}
+	if again, err := repo.SnapshotWorkingTree(); err != nil || again != snapshot {
+		t.Errorf("Expected the same snapshot %s again, got %s (%v)", snapshot, again, err)
+	}
+
+	// Without changes there is nothing to show
+	clean := NewRepository(setupTestRepo(t))
+	defer os.RemoveAll(clean.Path)
+	snapshot, err = clean.SnapshotWorkingTree()
+	if err != nil {
+		t.Fatalf("Failed to snapshot a clean working tree: %v", err)
+	}
+	if diff, err := clean.GetDiffWithOptions(snapshot, "HEAD", DiffOptions{}); err != nil || diff != "" {
+		t.Errorf("Expected an empty diff for a clean tree, got %q (%v)", diff, err)
+	}
+}
+
+func TestGetPathDiff(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	// Split part of main's big.txt into an unrelated new file on a branch
+	run("checkout", "main")
+	if err := os.WriteFile(filepath.Join(repoDir, "big.txt"), []byte("shared\nkept\nmoved\n"), 0644); err != nil {
+		t.Fatalf("Failed to write big.txt: %v", err)
+	}
+	run("add", "big.txt")
+	run("commit", "-m", "Add big file")
+
+	run("checkout", "-b", "split")
+	if err := os.MkdirAll(filepath.Join(repoDir, "parts"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "parts", "small.txt"), []byte("shared\nmoved\n"), 0644); err != nil {
+		t.Fatalf("Failed to write small.txt: %v", err)
+	}
+	run("add", "parts/small.txt")
+	run("commit", "-m", "Split big file")
+
+	repo := NewRepository(repoDir)
+
+	t.Run("BothSides", func(t *testing.T) {
+		diff, err := repo.GetPathDiff("main", "big.txt", "split", "parts/small.txt")
+		if err != nil {
+			t.Fatalf("GetPathDiff failed: %v", err)
+		}
+		for _, expected := range []string{"--- a/big.txt", "+++ b/parts/small.txt", " shared\n-kept\n moved\n"} {
+			if !strings.Contains(diff, expected) {
+				t.Errorf("Expected the diff to contain %q, got:\n%s", expected, diff)
+			}
+		}
+	})
+
+	t.Run("MissingOldSide", func(t *testing.T) {
+		diff, err := repo.GetPathDiff("main", "parts/small.txt", "split", "parts/small.txt")
+		if err != nil {
+			t.Fatalf("GetPathDiff failed: %v", err)
+		}
+		for _, expected := range []string{"new file mode", "--- /dev/null", "+shared\n+moved\n"} {
+			if !strings.Contains(diff, expected) {
+				t.Errorf("Expected an added file diff containing %q, got:\n%s", expected, diff)
+			}
+		}
+	})
+
+	t.Run("MissingNewSide", func(t *testing.T) {
+		diff, err := repo.GetPathDiff("main", "big.txt", "split", "nope.txt")
+		if err != nil {
+			t.Fatalf("GetPathDiff failed: %v", err)
+		}
+		for _, expected := range []string{"deleted file mode", "+++ /dev/null", "-kept\n"} {
+			if !strings.Contains(diff, expected) {
+				t.Errorf("Expected a deleted file diff containing %q, got:\n%s", expected, diff)
+			}
+		}
+	})
+
+	t.Run("NeitherSide", func(t *testing.T) {
+		_, err := repo.GetPathDiff("main", "nope.txt", "split", "parts")
+		if !errors.Is(err, ErrPathNotFound) {
+			t.Errorf("Expected ErrPathNotFound for missing files and directories, got %v", err)
+		}
+	})
+
+	t.Run("UnknownRef", func(t *testing.T) {
+		_, err := repo.GetPathDiff("main", "big.txt", "no-such-branch", "big.txt")
+		if !errors.Is(err, ErrUndiffable) {
+			t.Errorf("Expected ErrUndiffable for an unknown ref, got %v", err)
+		}
+	})
+}
+
+func TestGetMergeBase(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	repo := NewRepository(repoDir)
+	mainHash, err := repo.GetBranchCommitHash("main")
+	if err != nil {
+		t.Fatalf("GetBranchCommitHash failed: %v", err)
+	}
+
+	// feature forked from main's only commit
+	base, err := repo.GetMergeBase("feature", "main")
+	if err != nil {
+		t.Fatalf("GetMergeBase failed: %v", err)
+	}
+	if base != mainHash {
+		t.Errorf("Expected the merge base to be %s, got %s", mainHash, base)
+	}
+
+	if _, err := repo.GetMergeBase("nonexistent", "main"); err == nil {
+		t.Error("Expected an error for a missing branch")
+	}
+}
+
+func TestOrphanBranch(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	repo := NewRepository(repoDir)
+	mainHash, err := repo.GetBranchCommitHash("main")
+	if err != nil {
+		t.Fatalf("GetBranchCommitHash failed: %v", err)
+	}
+
+	// An orphan branch sharing no history with main, holding a gitlink
+	for _, args := range [][]string{
+		{"checkout", "--orphan", "unrelated"},
+		{"rm", "-rf", "--cached", "."},
+		{"update-index", "--add", "--cacheinfo", "160000," + mainHash + ",vendor/lib"},
+		{"commit", "-m", "Orphan commit"},
+		{"checkout", "-f", "main"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+		}
+	}
+
+	branches, err := repo.GetBranches()
+	if err != nil {
+		t.Fatalf("GetBranches failed: %v", err)
+	}
+	found := false
+	for _, branch := range branches {
+		if branch == "unrelated" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected the orphan branch to be listed, got %v", branches)
+	}
+
+	if _, err := repo.GetMergeBase("unrelated", "main"); !errors.Is(err, ErrNoMergeBase) {
+		t.Errorf("Expected ErrNoMergeBase, got %v", err)
+	}
+
+	diff, err := repo.GetDiff("unrelated", "main")
+	if err != nil {
+		t.Fatalf("GetDiff failed: %v", err)
+	}
+	if !strings.Contains(diff, "Subproject commit "+mainHash) {
+		t.Errorf("Expected the gitlink in the diff, got %s", diff)
+	}
+}
+
+func TestGetCurrentAndDefaultBranch(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	repo := NewRepository(repoDir)
+	if branch, err := repo.GetCurrentBranch(); err != nil || branch != "main" {
+		t.Errorf("Expected main to be checked out, got %q, %v", branch, err)
+	}
+	if branch, err := repo.GetDefaultBranch(); err != nil || branch != "main" {
+		t.Errorf("Expected main as the default branch, got %q, %v", branch, err)
+	}
+
+	run("checkout", "-q", "--detach", "feature")
+	if branch, err := repo.GetCurrentBranch(); err != nil || branch != "" {
+		t.Errorf("Expected no branch on a detached HEAD, got %q, %v", branch, err)
+	}
+
+	// origin's default branch wins over a local main
+	run("update-ref", "refs/remotes/origin/feature", "feature")
+	run("symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/feature")
+	if branch, err := repo.GetDefaultBranch(); err != nil || branch != "feature" {
+		t.Errorf("Expected the local branch tracking origin's default, got %q, %v", branch, err)
+	}
+
+	run("update-ref", "refs/remotes/origin/trunk", "main")
+	run("symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/trunk")
+	if branch, err := repo.GetDefaultBranch(); err != nil || branch != "origin/trunk" {
+		t.Errorf("Expected origin's default without a local branch, got %q, %v", branch, err)
+	}
+}
+
+func TestCommitExists(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	repo := NewRepository(repoDir)
+	out, err := exec.Command("git", "-C", repoDir, "rev-parse", "main", "main^{tree}").Output()
+	if err != nil {
+		t.Fatalf("Failed to resolve main: %v", err)
+	}
+	hashes := strings.Fields(string(out))
+
+	tests := []struct {
+		ref    string
+		exists bool
+	}{
+		{hashes[0], true},
+		{"feature", true},
+		{hashes[1], false}, // a tree, not a commit
+		{strings.Repeat("1", 40), false},
+		{"", false},
+		{"--all", false},
+	}
+	for _, tt := range tests {
+		exists, err := repo.CommitExists(tt.ref)
+		if err != nil {
+			t.Errorf("CommitExists(%q) failed: %v", tt.ref, err)
+		}
+		if exists != tt.exists {
+			t.Errorf("CommitExists(%q) = %v, expected %v", tt.ref, exists, tt.exists)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ReviewNotesRef is the notes ref review summaries are written to, apart from
+// the default refs/notes/commits so they don't show up in every git log. Fetch
+// and push it like any ref to share them, e.g. git push origin refs/notes/diffty.
+const ReviewNotesRef = "refs/notes/diffty"
+
+// ErrNoNote is returned when a commit has no review note
+var ErrNoNote = errors.New("no review note")
+
+// AddReviewNote writes message as the review note of commit. With replace, an
+// existing note is overwritten; otherwise the message is appended to it,
+// separated by a blank line, as git notes append does.
+func (r *Repository) AddReviewNote(commit, message string, replace bool) error {
+	if commit == "" || strings.HasPrefix(commit, "-") {
+		return fmt.Errorf("invalid commit: %q", commit)
+	}
+
+	args := []string{"notes", "--ref=" + ReviewNotesRef, "append"}
+	if replace {
+		args = []string{"notes", "--ref=" + ReviewNotesRef, "add", "--force"}
+	}
+	args = append(args, "--message="+message, commit)
+
+	cmd := r.command(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		return fmt.Errorf("failed to write review note on %s: %w: %s", commit, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// GetReviewNote returns the review note of commit, or ErrNoNote if it has none
+func (r *Repository) GetReviewNote(commit string) (string, error) {
+	if commit == "" || strings.HasPrefix(commit, "-") {
+		return "", fmt.Errorf("invalid commit: %q", commit)
+	}
+
+	cmd := r.command("notes", "--ref="+ReviewNotesRef, "show", commit)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && strings.Contains(stderr.String(), "no note found") {
+			return "", ErrNoNote
+		}
+		return "", fmt.Errorf("failed to read review note of %s: %w: %s", commit, err, strings.TrimSpace(stderr.String()))
+	}
+	return out.String(), nil
+}
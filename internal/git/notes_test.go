@@ -0,0 +1,60 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestReviewNotes(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	repo := NewRepository(repoDir)
+	commit, err := repo.GetBranchCommitHash("feature")
+	if err != nil {
+		t.Fatalf("GetBranchCommitHash failed: %v", err)
+	}
+
+	if _, err := repo.GetReviewNote(commit); !errors.Is(err, ErrNoNote) {
+		t.Fatalf("Expected ErrNoNote before any note is written, got %v", err)
+	}
+
+	if err := repo.AddReviewNote(commit, "First review", false); err != nil {
+		t.Fatalf("AddReviewNote failed: %v", err)
+	}
+	if err := repo.AddReviewNote(commit, "Second review", false); err != nil {
+		t.Fatalf("AddReviewNote failed: %v", err)
+	}
+	note, err := repo.GetReviewNote(commit)
+	if err != nil {
+		t.Fatalf("GetReviewNote failed: %v", err)
+	}
+	if note != "First review\n\nSecond review\n" {
+		t.Errorf("Expected both reviews appended, got %q", note)
+	}
+
+	if err := repo.AddReviewNote(commit, "Final review", true); err != nil {
+		t.Fatalf("AddReviewNote failed: %v", err)
+	}
+	if note, _ := repo.GetReviewNote(commit); note != "Final review\n" {
+		t.Errorf("Expected the note to be replaced, got %q", note)
+	}
+
+	// The default notes, shown by git log, are left alone
+	out, err := exec.Command("git", "-C", repoDir, "notes", "list").CombinedOutput()
+	if err != nil || strings.TrimSpace(string(out)) != "" {
+		t.Errorf("Expected no default notes, got %q, %v", out, err)
+	}
+
+	if err := repo.AddReviewNote("--help", "x", false); err == nil {
+		t.Error("Expected a commit starting with a dash to be rejected")
+	}
+}
@@ -0,0 +1,70 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseNumstat(t *testing.T) {
+	output := "3\t1\ta.go\x0010\t0\t\x00old.go\x00new.go\x00-\t-\tlogo.png\x00"
+	expected := []FileLineStat{
+		{Path: "a.go", Additions: 3, Deletions: 1},
+		{Path: "new.go", Additions: 10},
+		{Path: "logo.png", Binary: true},
+	}
+
+	stats := parseNumstat(output)
+	if len(stats) != len(expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, stats)
+	}
+	for i := range expected {
+		if stats[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], stats[i])
+		}
+	}
+
+	if stats := parseNumstat(""); len(stats) != 0 {
+		t.Errorf("Expected no stats for empty output, got %+v", stats)
+	}
+}
+
+func TestGetFileLineStats(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	run("checkout", "-b", "bundle", "main")
+	if err := os.WriteFile(filepath.Join(repoDir, "bundle.js"), []byte(strings.Repeat("var x;\n", 50)), 0644); err != nil {
+		t.Fatalf("Failed to write bundle.js: %v", err)
+	}
+	run("add", "bundle.js")
+	run("commit", "-m", "Add bundle")
+
+	repo := NewRepository(repoDir)
+	stats, err := repo.GetFileLineStats("bundle", "main", DiffOptions{})
+	if err != nil {
+		t.Fatalf("GetFileLineStats failed: %v", err)
+	}
+	if len(stats) != 1 || stats[0] != (FileLineStat{Path: "bundle.js", Additions: 50}) {
+		t.Errorf("Expected 50 added lines in bundle.js, got %+v", stats)
+	}
+
+	if _, err := repo.GetFileLineStats("bundle", "no-such-branch", DiffOptions{}); err == nil {
+		t.Error("Expected an error for an unknown branch")
+	}
+}
@@ -0,0 +1,138 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// CommandObserver is told about every git command run against a repository,
+// such as to export how long they take as metrics. Its methods are called
+// from concurrent requests.
+type CommandObserver interface {
+	// CommandStarted is called right before a command starts
+	CommandStarted(subcommand string)
+	// CommandFinished is called once the command exited, with how long it
+	// ran and the error it failed with, if any
+	CommandFinished(subcommand string, elapsed time.Duration, err error)
+}
+
+// observerHolder lets a nil observer be stored in an atomic.Value
+type observerHolder struct {
+	observer CommandObserver
+}
+
+var commandObserver atomic.Value
+
+// SetCommandObserver makes o observe the git commands of every repository of
+// the process, replacing the previous observer. A nil o stops observing.
+func SetCommandObserver(o CommandObserver) {
+	commandObserver.Store(observerHolder{observer: o})
+}
+
+// Limits on how much of a command line is logged, so a command with many or
+// huge arguments, such as a long pathspec list, can't flood the log
+const (
+	maxLoggedArgs      = 64
+	maxLoggedArgLength = 200
+)
+
+var commandLogger atomic.Pointer[log.Logger]
+
+// SetCommandLogger logs every git command of every repository of the process
+// to l once it exited, at debug level: its arguments, exit status and how long
+// it ran, but never its output, which holds the repository's content. A nil l
+// stops logging.
+func SetCommandLogger(l *log.Logger) {
+	commandLogger.Store(l)
+}
+
+// observeCommand tells the observer that cmd is starting, returning the
+// function to call with its error once it exited
+func observeCommand(cmd *exec.Cmd) func(error) {
+	holder, _ := commandObserver.Load().(observerHolder)
+	logger := commandLogger.Load()
+	if holder.observer == nil && logger == nil {
+		return func(error) {}
+	}
+
+	name := subcommand(cmd.Args)
+	if holder.observer != nil {
+		holder.observer.CommandStarted(name)
+	}
+	start := time.Now()
+	return func(err error) {
+		elapsed := time.Since(start)
+		if holder.observer != nil {
+			holder.observer.CommandFinished(name, elapsed, err)
+		}
+		if logger != nil {
+			logger.Printf("Debug: %s: %s in %s", formatCommandLine(cmd.Args), exitStatus(err), elapsed.Round(time.Microsecond))
+		}
+	}
+}
+
+// formatCommandLine returns args as they could be typed in a shell, quoting
+// the ones that need it. Arguments past maxLoggedArgs are counted instead of
+// listed, and each one is cut to maxLoggedArgLength bytes.
+func formatCommandLine(args []string) string {
+	shown := args
+	if len(shown) > maxLoggedArgs {
+		shown = shown[:maxLoggedArgs]
+	}
+
+	parts := make([]string, 0, len(shown)+1)
+	for _, arg := range shown {
+		if len(arg) > maxLoggedArgLength {
+			arg = fmt.Sprintf("%s...(%d more bytes)", arg[:maxLoggedArgLength], len(arg)-maxLoggedArgLength)
+		}
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`*?[]{}()<>|&;#~") {
+			arg = strconv.Quote(arg)
+		}
+		parts = append(parts, arg)
+	}
+	if len(args) > len(shown) {
+		parts = append(parts, fmt.Sprintf("...(%d more arguments)", len(args)-len(shown)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// exitStatus describes how a command exited from the error it returned
+func exitStatus(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return "exit status " + strconv.Itoa(exitErr.ExitCode())
+	}
+	return "failed: " + err.Error()
+}
+
+// run runs cmd, letting the observer know about it
+func run(cmd *exec.Cmd) error {
+	finish := observeCommand(cmd)
+	err := cmd.Run()
+	finish(err)
+	return err
+}
+
+// subcommand returns the git subcommand of args, such as "diff", skipping
+// the global options in front of it
+func subcommand(args []string) string {
+	for i := 1; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-c" || arg == "-C":
+			i++
+		case strings.HasPrefix(arg, "-"):
+		default:
+			return arg
+		}
+	}
+	return ""
+}
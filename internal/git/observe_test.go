@@ -0,0 +1,172 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingObserver records the commands it is told about
+type recordingObserver struct {
+	mu       sync.Mutex
+	started  []string
+	finished []string
+	failed   []string
+}
+
+func (o *recordingObserver) CommandStarted(subcommand string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started = append(o.started, subcommand)
+}
+
+func (o *recordingObserver) CommandFinished(subcommand string, elapsed time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.finished = append(o.finished, subcommand)
+	if err != nil {
+		o.failed = append(o.failed, subcommand)
+	}
+}
+
+func TestCommandObserver(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+	repo := NewRepository(repoDir)
+
+	observer := &recordingObserver{}
+	SetCommandObserver(observer)
+	t.Cleanup(func() { SetCommandObserver(nil) })
+
+	if _, err := repo.GetBranchCommitHash("feature"); err != nil {
+		t.Fatalf("Failed to resolve feature: %v", err)
+	}
+	if _, err := repo.GetDiffWithOptions("feature", "main", DiffOptions{MaxBytes: 1 << 20}); err != nil {
+		t.Fatalf("Failed to diff: %v", err)
+	}
+	if _, err := repo.GetDiffWithOptions("feature", "main", DiffOptions{MaxBytes: 1}); !errors.Is(err, ErrDiffTooLarge) {
+		t.Fatalf("Expected ErrDiffTooLarge, got %v", err)
+	}
+
+	want := []string{"rev-parse", "diff", "diff"}
+	if len(observer.started) != len(want) || len(observer.finished) != len(want) {
+		t.Fatalf("Expected %v to start and finish, got started %v, finished %v", want, observer.started, observer.finished)
+	}
+	for i := range want {
+		if observer.started[i] != want[i] || observer.finished[i] != want[i] {
+			t.Errorf("Expected command %d to be %s, got started %s, finished %s", i, want[i], observer.started[i], observer.finished[i])
+		}
+	}
+	if len(observer.failed) != 1 || observer.failed[0] != "diff" {
+		t.Errorf("Expected the diff over the limit to be reported as failed, got %v", observer.failed)
+	}
+
+	// Nothing is observed once the observer is removed
+	SetCommandObserver(nil)
+	if _, err := repo.GetBranchCommitHash("main"); err != nil {
+		t.Fatalf("Failed to resolve main: %v", err)
+	}
+	if len(observer.started) != len(want) {
+		t.Errorf("Expected no more commands to be observed, got %v", observer.started)
+	}
+}
+
+func TestSubcommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"git", "-c", "core.pager=cat", "-C", "/repo", "diff", "--no-ext-diff", "a", "b"}, want: "diff"},
+		{args: []string{"git", "--no-pager", "log"}, want: "log"},
+		{args: []string{"git", "--version"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := subcommand(tt.args); got != tt.want {
+			t.Errorf("subcommand(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestCommandLogger tests that git commands are logged at debug level with
+// their arguments and exit status, but without their output
+func TestCommandLogger(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+	repo := NewRepository(repoDir)
+
+	var out bytes.Buffer
+	SetCommandLogger(log.New(&out, "", 0))
+	t.Cleanup(func() { SetCommandLogger(nil) })
+
+	if _, err := repo.GetDiffWithOptions("feature", "main", DiffOptions{}); err != nil {
+		t.Fatalf("Failed to diff: %v", err)
+	}
+	if _, err := repo.GetMergeBase("nonexistent", "main"); err == nil {
+		t.Fatal("Expected an error for a missing branch")
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("Expected a line per command, got %q", out.String())
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "Debug: git ") || !strings.Contains(line, "-C "+repoDir) {
+			t.Errorf("Expected a debug line with the full command, got %q", line)
+		}
+	}
+	if !strings.Contains(lines[0], " diff ") || !strings.Contains(lines[0], ": exit status 0 in ") {
+		t.Errorf("Expected the diff to be logged as succeeding, got %q", lines[0])
+	}
+	if last := lines[len(lines)-1]; !strings.Contains(last, `"nonexistent^{commit}"`) || !strings.Contains(last, ": exit status 1 in ") {
+		t.Errorf("Expected the failed lookup to be logged with its exit status, got %q", last)
+	}
+	// The diff itself is never logged
+	if strings.Contains(out.String(), "new line") || strings.Contains(out.String(), "@@") {
+		t.Errorf("Expected no command output in the log, got %q", out.String())
+	}
+
+	// Nothing is logged once the logger is removed
+	SetCommandLogger(nil)
+	out.Reset()
+	if _, err := repo.GetBranchCommitHash("main"); err != nil {
+		t.Fatalf("Failed to resolve main: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no more commands to be logged, got %q", out.String())
+	}
+}
+
+func TestFormatCommandLine(t *testing.T) {
+	if got := formatCommandLine([]string{"git", "-C", "/my repo", "log", "--format=%H%x00%s", ""}); got != `git -C "/my repo" log --format=%H%x00%s ""` {
+		t.Errorf("Unexpected command line %s", got)
+	}
+
+	// Huge arguments and argument lists are cut short
+	args := []string{"git", "diff", strings.Repeat("a", maxLoggedArgLength+50)}
+	for i := 0; i < maxLoggedArgs; i++ {
+		args = append(args, fmt.Sprintf("file%d", i))
+	}
+	got := formatCommandLine(args)
+	if !strings.Contains(got, strings.Repeat("a", maxLoggedArgLength)+"...(50 more bytes)") || strings.Contains(got, strings.Repeat("a", maxLoggedArgLength+1)) {
+		t.Errorf("Expected the long argument to be cut, got %s", got)
+	}
+	if !strings.HasSuffix(got, "...(3 more arguments)") {
+		t.Errorf("Expected the arguments past the limit to be counted, got %s", got)
+	}
+}
@@ -0,0 +1,124 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrNoReflogEntry is returned when a reflog revision such as feature@{3}
+// names an entry the reflog doesn't have, or the ref has no reflog at all
+var ErrNoReflogEntry = errors.New("no such reflog entry")
+
+// reflogRefPattern matches reflog revisions such as feature@{1} or
+// feature@{yesterday}, capturing the ref and the selector
+var reflogRefPattern = regexp.MustCompile(`^(.+?)@\{([^{}]+)\}$`)
+
+// ReflogEntry represents a previous position of a branch
+type ReflogEntry struct {
+	Ref     string // e.g. feature@{1}
+	Commit  string
+	Message string // e.g. "commit: Fix typo" or "rebase (finish): ..."
+}
+
+// IsReflogRef reports whether ref is a reflog revision such as feature@{1} or
+// feature@{2.days.ago}. Stash references and the @{upstream} and @{push}
+// shorthands aren't reflog revisions in this sense.
+func IsReflogRef(ref string) bool {
+	_, _, ok := parseReflogRef(ref)
+	return ok
+}
+
+// parseReflogRef splits a reflog revision into its ref and selector
+func parseReflogRef(ref string) (base, selector string, ok bool) {
+	if stashRefPattern.MatchString(ref) {
+		return "", "", false
+	}
+	m := reflogRefPattern.FindStringSubmatch(ref)
+	if m == nil {
+		return "", "", false
+	}
+	switch strings.ToLower(m[2]) {
+	case "u", "upstream", "push":
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// resolveReflogRef returns the commit a reflog revision points to. Local
+// branches take precedence over other refs, as for plain names, and a ref
+// without a reflog or a missing entry is reported as ErrNoReflogEntry
+// rather than as an unknown revision.
+func (r *Repository) resolveReflogRef(ref, base, selector string) (string, error) {
+	qualified := ""
+	for _, name := range []string{"refs/heads/" + base, "refs/remotes/" + base, base} {
+		if r.reflogExists(name) {
+			qualified = name
+			break
+		}
+	}
+	if qualified == "" {
+		return "", fmt.Errorf("%w: %s has no reflog; it doesn't exist or its updates aren't logged (see core.logAllRefUpdates)", ErrNoReflogEntry, base)
+	}
+
+	cmd := r.command("rev-parse", "--verify", qualified+"@{"+selector+"}^{commit}")
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := run(cmd); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", fmt.Errorf("failed to get commit hash for %s: %w", ref, err)
+		}
+		msg := strings.TrimPrefix(strings.SplitN(strings.TrimSpace(stderr.String()), "\n", 2)[0], "fatal: ")
+		if msg == "" {
+			msg = "entry not found"
+		}
+		return "", fmt.Errorf("%w: %s: %s", ErrNoReflogEntry, ref, msg)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// reflogExists reports whether the fully qualified ref has a reflog
+func (r *Repository) reflogExists(ref string) bool {
+	return run(r.command("reflog", "exists", ref)) == nil
+}
+
+// GetReflog returns up to limit earlier positions of a local branch, most
+// recent first, leaving out its current tip. A branch without a reflog has no
+// entries.
+func (r *Repository) GetReflog(branch string, limit int) ([]ReflogEntry, error) {
+	if branch == "" || strings.HasPrefix(branch, "-") {
+		return nil, fmt.Errorf("invalid branch name: %q", branch)
+	}
+	ref := "refs/heads/" + branch
+	if !r.reflogExists(ref) {
+		return []ReflogEntry{}, nil
+	}
+
+	// One more entry than asked for, as the first one is the current tip
+	cmd := r.command("log", "--walk-reflogs", "--format=%H%x00%gs", "-n", strconv.Itoa(limit+1), ref, "--")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := run(cmd); err != nil {
+		return nil, fmt.Errorf("failed to read reflog of %s: %w", branch, err)
+	}
+
+	entries := []ReflogEntry{}
+	for i, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		parts := strings.SplitN(line, "\x00", 2)
+		if i == 0 || len(parts) != 2 {
+			continue
+		}
+		entries = append(entries, ReflogEntry{
+			Ref:     fmt.Sprintf("%s@{%d}", branch, i),
+			Commit:  parts[0],
+			Message: parts[1],
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,120 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestGetBranchCommitHashReflog(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	repo := NewRepository(repoDir)
+	mainHash, _ := repo.GetBranchCommitHash("main")
+	featureHash, _ := repo.GetBranchCommitHash("feature")
+
+	// feature was created at main's commit before its own commit was added
+	hash, err := repo.GetBranchCommitHash("feature@{1}")
+	if err != nil {
+		t.Fatalf("GetBranchCommitHash for feature@{1} failed: %v", err)
+	}
+	if hash != mainHash {
+		t.Errorf("Expected feature@{1} to be %s, got %s", mainHash, hash)
+	}
+
+	hash, err = repo.GetBranchCommitHash("feature@{now}")
+	if err != nil {
+		t.Fatalf("GetBranchCommitHash for feature@{now} failed: %v", err)
+	}
+	if hash != featureHash {
+		t.Errorf("Expected feature@{now} to be %s, got %s", featureHash, hash)
+	}
+
+	// The reflog only has two entries
+	_, err = repo.GetBranchCommitHash("feature@{5}")
+	if !errors.Is(err, ErrNoReflogEntry) {
+		t.Fatalf("Expected ErrNoReflogEntry for feature@{5}, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "only has 2 entries") {
+		t.Errorf("Expected git's reason in the error, got %v", err)
+	}
+
+	_, err = repo.GetBranchCommitHash("nonexistent@{1}")
+	if !errors.Is(err, ErrNoReflogEntry) {
+		t.Errorf("Expected ErrNoReflogEntry for a missing branch, got %v", err)
+	}
+
+	// A branch created while reflogs are disabled has none to look up
+	cmd := exec.Command("git", "-C", repoDir, "-c", "core.logAllRefUpdates=false", "branch", "nolog", "main")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to create branch: %v\n%s", err, output)
+	}
+	if _, err := repo.GetBranchCommitHash("nolog"); err != nil {
+		t.Fatalf("GetBranchCommitHash for nolog failed: %v", err)
+	}
+	_, err = repo.GetBranchCommitHash("nolog@{1}")
+	if !errors.Is(err, ErrNoReflogEntry) {
+		t.Fatalf("Expected ErrNoReflogEntry without a reflog, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "has no reflog") {
+		t.Errorf("Expected the error to mention the missing reflog, got %v", err)
+	}
+}
+
+func TestGetReflog(t *testing.T) {
+	// Skip if git is not available
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := setupTestRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	repo := NewRepository(repoDir)
+	mainHash, _ := repo.GetBranchCommitHash("main")
+
+	entries, err := repo.GetReflog("feature", 10)
+	if err != nil {
+		t.Fatalf("GetReflog failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 earlier entry, got %+v", entries)
+	}
+	if entries[0].Ref != "feature@{1}" || entries[0].Commit != mainHash {
+		t.Errorf("Unexpected entry: %+v", entries[0])
+	}
+	if !strings.HasPrefix(entries[0].Message, "branch: Created from") {
+		t.Errorf("Expected the reflog message, got %q", entries[0].Message)
+	}
+
+	entries, err = repo.GetReflog("nonexistent", 10)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Expected no entries for a missing branch, got %+v, %v", entries, err)
+	}
+}
+
+func TestIsReflogRef(t *testing.T) {
+	tests := map[string]bool{
+		"feature@{1}":              true,
+		"feature@{yesterday}":      true,
+		"origin/main@{2.days.ago}": true,
+		"feature":                  false,
+		"stash@{0}":                false,
+		"feature@{upstream}":       false,
+		"feature@{u}":              false,
+		"feature@{push}":           false,
+	}
+	for ref, want := range tests {
+		if got := IsReflogRef(ref); got != want {
+			t.Errorf("IsReflogRef(%q) = %v, want %v", ref, got, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WorkingTree names the working tree of a repository as the source of a
+// comparison, so uncommitted changes and untracked files can be reviewed. It
+// can't be mistaken for a branch, as ref names can't contain a colon.
+const WorkingTree = ":worktree"
+
+// workingTreeEnv is the identity and date working tree snapshots are made
+// with, fixed so the same working tree always snapshots to the same commit
+var workingTreeEnv = []string{
+	"GIT_AUTHOR_NAME=diffty",
+	"GIT_AUTHOR_EMAIL=diffty@localhost",
+	"GIT_AUTHOR_DATE=@0 +0000",
+	"GIT_COMMITTER_NAME=diffty",
+	"GIT_COMMITTER_EMAIL=diffty@localhost",
+	"GIT_COMMITTER_DATE=@0 +0000",
+}
+
+// IsWorkingTree reports whether ref names the working tree (WorkingTree)
+func IsWorkingTree(ref string) bool {
+	return ref == WorkingTree
+}
+
+// SnapshotWorkingTree records the working tree as a commit on top of HEAD and
+// returns its hash: tracked files as they are on disk, whether staged or not,
+// and the untracked files GetUntrackedFiles lists, so these show up as added
+// files. The snapshot is built in a copy of the index and no ref points to
+// it, leaving the repository's state alone. An unchanged working tree gives
+// the same commit, so reviews of it are kept until a file changes.
+func (r *Repository) SnapshotWorkingTree() (string, error) {
+	head, err := r.GetBranchCommitHash("HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	index, err := r.copyIndex()
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(index)
+
+	// indexed runs a git command on the copy of the index
+	indexed := func(stdin io.Reader, args ...string) (string, error) {
+		cmd := r.command(args...)
+		cmd.Env = append(cmd.Env, "GIT_INDEX_FILE="+index)
+		cmd.Env = append(cmd.Env, workingTreeEnv...)
+		cmd.Stdin = stdin
+		var out, stderr bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+		if err := run(cmd); err != nil {
+			return "", fmt.Errorf("failed to snapshot the working tree: git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(out.String()), nil
+	}
+
+	if _, err := os.Stat(index); errors.Is(err, os.ErrNotExist) {
+		if _, err := indexed(nil, "read-tree", head); err != nil {
+			return "", err
+		}
+	}
+	if _, err := indexed(nil, "add", "--update"); err != nil {
+		return "", err
+	}
+
+	untracked, err := r.GetUntrackedFiles()
+	if err != nil {
+		return "", err
+	}
+	if len(untracked) > 0 {
+		names := strings.Join(untracked, "\x00") + "\x00"
+		if _, err := indexed(strings.NewReader(names), "update-index", "--add", "-z", "--stdin"); err != nil {
+			return "", err
+		}
+	}
+
+	tree, err := indexed(nil, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	return indexed(nil, "commit-tree", tree, "-p", head, "-m", "Working tree")
+}
+
+// copyIndex copies the repository's index to a temporary file, whose stat
+// information spares git hashing unchanged files again, and returns its path.
+// A repository without an index gets a path where none exists yet.
+func (r *Repository) copyIndex() (string, error) {
+	cmd := r.command("rev-parse", "--git-path", "index")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := run(cmd); err != nil {
+		return "", fmt.Errorf("failed to find the index: %w", err)
+	}
+	path := strings.TrimSpace(out.String())
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.Path, path)
+	}
+
+	tmp, err := os.CreateTemp("", "diffty-index-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to copy the index: %w", err)
+	}
+	defer tmp.Close()
+
+	src, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		os.Remove(tmp.Name())
+		return tmp.Name(), nil
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to copy the index: %w", err)
+	}
+	defer src.Close()
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to copy the index: %w", err)
+	}
+	return tmp.Name(), nil
+}
@@ -1,26 +1,421 @@
 package models
 
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
 // FileReview represents the review state of a file
 type FileReview struct {
-	Repo  string            `json:"repo"`
-	Path  string            `json:"path"`
-	Lines map[string]string `json:"lines"` // line number or range -> state (approved, skipped, rejected)
+	Repo     string            `json:"repo"`
+	Path     string            `json:"path"`
+	Lines    map[string]string `json:"lines"`               // "all", line number, range or hunk ("-1,3 +1,4") -> state (approved, skipped, rejected, needs-review)
+	BlobHash string            `json:"blob_hash,omitempty"` // "<target blob>..<source blob>" the review was recorded against
+	Hunks    []string          `json:"hunks,omitempty"`     // hunk ranges ("-1,3 +1,4") of the diff the review was recorded against
+	Reason   string            `json:"reason,omitempty"`    // why the file was rejected
+}
+
+// HasLineReviews reports whether the review holds statuses for specific lines
+// rather than only a whole-file status
+func (r FileReview) HasLineReviews() bool {
+	for key := range r.Lines {
+		if key != "all" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStale reports whether the review's line numbers may no longer point at the
+// reviewed content, because the diff's hunks moved since the review was
+// recorded. Whole-file reviews and reviews recorded without hunks are never
+// reported as stale.
+func (r FileReview) IsStale(hunks []string) bool {
+	if !r.HasLineReviews() || len(r.Hunks) == 0 {
+		return false
+	}
+	if len(r.Hunks) != len(hunks) {
+		return true
+	}
+	for i := range hunks {
+		if r.Hunks[i] != hunks[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// IsHunkKey reports whether a Lines key names a hunk by its range, such as
+// "-1,3 +1,4", rather than the whole file or a line
+func IsHunkKey(key string) bool {
+	return strings.HasPrefix(key, "-") && strings.Contains(key, " +")
+}
+
+// SetStatus gives the whole file a status, replacing any hunk statuses
+func (r *FileReview) SetStatus(status string) {
+	if r.Lines == nil {
+		r.Lines = make(map[string]string)
+	}
+	for key := range r.Lines {
+		if IsHunkKey(key) {
+			delete(r.Lines, key)
+		}
+	}
+	r.Lines["all"] = status
+}
+
+// SetHunkStatus gives a single hunk of the file a status. hunks are the
+// ranges of all the hunks of the file's current diff: a whole-file status is
+// split into a status per hunk first, so the other hunks keep it.
+func (r *FileReview) SetHunkStatus(hunk, status string, hunks []string) {
+	if r.Lines == nil {
+		r.Lines = make(map[string]string)
+	}
+	if all, ok := r.Lines["all"]; ok {
+		for _, h := range hunks {
+			if _, reviewed := r.Lines[h]; !reviewed {
+				r.Lines[h] = all
+			}
+		}
+		delete(r.Lines, "all")
+	}
+	r.Lines[hunk] = status
+	r.Hunks = hunks
+}
+
+// HunkStatus returns the status of a hunk, from its own review or the whole
+// file's, and "unreviewed" when it has neither
+func (r FileReview) HunkStatus(hunk string) string {
+	if status, ok := r.Lines[hunk]; ok {
+		return status
+	}
+	if status, ok := r.Lines["all"]; ok {
+		return status
+	}
+	return StateUnreviewed
+}
+
+// Status returns the file's overall status derived from its line statuses.
+// A rejected line rejects the whole file, and a line needing another reviewer
+// hands the whole file over; otherwise a file with hunks still pending review
+// is "unreviewed", a file whose lines were approved and skipped is "mixed",
+// and one without line statuses is "unreviewed".
+func (r FileReview) Status() string {
+	var approved, rejected, skipped, needsReview bool
+	for _, status := range r.Lines {
+		switch status {
+		case StateApproved:
+			approved = true
+		case StateRejected:
+			rejected = true
+		case StateSkipped:
+			skipped = true
+		case StateNeedsReview:
+			needsReview = true
+		}
+	}
+
+	switch {
+	case rejected:
+		return StateRejected
+	case needsReview:
+		return StateNeedsReview
+	case r.hasPendingHunks():
+		return StateUnreviewed
+	case approved && skipped:
+		return StateMixed
+	case approved:
+		return StateApproved
+	case skipped:
+		return StateSkipped
+	}
+	return StateUnreviewed
+}
+
+// hasPendingHunks reports whether the file is reviewed hunk by hunk and some
+// of the hunks it was last reviewed against have no status yet
+func (r FileReview) hasPendingHunks() bool {
+	if _, ok := r.Lines["all"]; ok || !r.hasHunkReviews() {
+		return false
+	}
+
+	for _, hunk := range r.Hunks {
+		if _, ok := r.Lines[hunk]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasHunkReviews reports whether any hunk of the file has a status of its own
+func (r FileReview) hasHunkReviews() bool {
+	for key := range r.Lines {
+		if IsHunkKey(key) {
+			return true
+		}
+	}
+	return false
 }
 
+// CurrentSchemaVersion is the version of the review state format written by
+// this version of diffty. Documents saved before versioning was introduced
+// have no version and are read as version 0.
+const CurrentSchemaVersion = 1
+
 // ReviewState represents the overall review state
 type ReviewState struct {
-	ReviewedFiles []FileReview `json:"reviewed_files"`
-	SourceBranch  string       `json:"source_branch"`
-	TargetBranch  string       `json:"target_branch"`
-	SourceCommit  string       `json:"source_commit"`
-	TargetCommit  string       `json:"target_commit"`
+	SchemaVersion  int          `json:"schema_version"` // format version the state was saved with
+	ReviewedFiles  []FileReview `json:"reviewed_files"`
+	RepoPath       string       `json:"repo_path,omitempty"` // repository the state was saved for, empty in states saved before it was recorded
+	User           string       `json:"user,omitempty"`      // reviewer the state belongs to, empty in single-user mode
+	SourceBranch   string       `json:"source_branch"`
+	TargetBranch   string       `json:"target_branch"`
+	SourceCommit   string       `json:"source_commit"`
+	TargetCommit   string       `json:"target_commit"`
+	CompletedBy    string       `json:"completed_by,omitempty"`     // reviewer who signed off the whole comparison
+	CompletedAt    *time.Time   `json:"completed_at,omitempty"`     // when the comparison was signed off
+	Description    string       `json:"description,omitempty"`      // free-text note on the whole review
+	LastViewedFile string       `json:"last_viewed_file,omitempty"` // file the reviewer viewed last, to resume at
+	ChangedFiles   int          `json:"changed_files,omitempty"`    // files of the comparison's diff when a review was last saved, zero if unknown
+	SquashMessage  string       `json:"squash_message,omitempty"`   // edited message of a squash merge, empty for the proposed one
+
+	// fileIndex maps each reviewed file to its position in ReviewedFiles. It
+	// is built on the first lookup and dropped by AddFile and RemoveFile;
+	// fileIndexLen is the length of ReviewedFiles it was built for.
+	fileIndex    map[fileKey]int
+	fileIndexLen int
+}
+
+// fileKey identifies a reviewed file in a ReviewState's index
+type fileKey struct {
+	repo, path string
+}
+
+// Migrate upgrades a state read from storage to the current schema version,
+// filling the defaults older versions didn't write. States written by a newer
+// version are left as they are, since the fields this version knows were
+// already decoded; it reports whether the state is newer than supported.
+func (s *ReviewState) Migrate() (newer bool) {
+	if s.SchemaVersion > CurrentSchemaVersion {
+		return true
+	}
+
+	// Version 0 predates versioning and may lack the file list or line maps
+	if s.ReviewedFiles == nil {
+		s.ReviewedFiles = []FileReview{}
+	}
+	for i := range s.ReviewedFiles {
+		if s.ReviewedFiles[i].Lines == nil {
+			s.ReviewedFiles[i].Lines = make(map[string]string)
+		}
+	}
+
+	s.SchemaVersion = CurrentSchemaVersion
+	return false
 }
 
-// LineState constants
+// Clone returns a deep copy of the state, sharing nothing with it
+func (s *ReviewState) Clone() *ReviewState {
+	clone := *s
+	if s.ReviewedFiles != nil {
+		clone.ReviewedFiles = make([]FileReview, len(s.ReviewedFiles))
+		for i, review := range s.ReviewedFiles {
+			if review.Lines != nil {
+				lines := make(map[string]string, len(review.Lines))
+				for k, v := range review.Lines {
+					lines[k] = v
+				}
+				review.Lines = lines
+			}
+			if review.Hunks != nil {
+				review.Hunks = append([]string(nil), review.Hunks...)
+			}
+			clone.ReviewedFiles[i] = review
+		}
+	}
+	if s.CompletedAt != nil {
+		completedAt := *s.CompletedAt
+		clone.CompletedAt = &completedAt
+	}
+	return &clone
+}
+
+// Complete signs off the whole comparison as reviewed by user at the given time
+func (s *ReviewState) Complete(user string, at time.Time) {
+	s.CompletedBy = user
+	s.CompletedAt = &at
+}
+
+// IsCompleted reports whether the comparison was signed off as reviewed
+func (s *ReviewState) IsCompleted() bool {
+	return s.CompletedAt != nil
+}
+
+// UnreviewedFiles returns how many files of the comparison's diff have no
+// review yet, going by the file count recorded with the state rather than the
+// diff itself. ok is false when no file count was recorded.
+func (s *ReviewState) UnreviewedFiles() (unreviewed int, ok bool) {
+	if s.ChangedFiles <= 0 {
+		return 0, false
+	}
+	reviewed := 0
+	for _, review := range s.ReviewedFiles {
+		if review.Status() != StateUnreviewed {
+			reviewed++
+		}
+	}
+	return max(s.ChangedFiles-reviewed, 0), true
+}
+
+// File returns the review of the file at path in repo, if there is one
+func (s *ReviewState) File(repo, path string) (*FileReview, bool) {
+	key := fileKey{repo, path}
+	i, ok := s.index()[key]
+	if ok && (s.ReviewedFiles[i].Repo != repo || s.ReviewedFiles[i].Path != path) {
+		// ReviewedFiles was reordered behind the index's back
+		s.fileIndex = nil
+		i, ok = s.index()[key]
+	}
+	if !ok {
+		return nil, false
+	}
+	return &s.ReviewedFiles[i], true
+}
+
+// AddFile appends a file review and returns it, for changes made in place
+func (s *ReviewState) AddFile(review FileReview) *FileReview {
+	s.ReviewedFiles = append(s.ReviewedFiles, review)
+	s.fileIndex = nil
+	return &s.ReviewedFiles[len(s.ReviewedFiles)-1]
+}
+
+// RemoveFile drops the review of the file at path in repo, if there is one
+func (s *ReviewState) RemoveFile(repo, path string) {
+	kept := s.ReviewedFiles[:0]
+	for _, review := range s.ReviewedFiles {
+		if review.Repo != repo || review.Path != path {
+			kept = append(kept, review)
+		}
+	}
+	s.ReviewedFiles = kept
+	s.fileIndex = nil
+}
+
+// index returns the position of every reviewed file, building it when there's
+// none yet or ReviewedFiles grew or shrank without going through AddFile and
+// RemoveFile
+func (s *ReviewState) index() map[fileKey]int {
+	if s.fileIndex != nil && s.fileIndexLen == len(s.ReviewedFiles) {
+		return s.fileIndex
+	}
+	s.fileIndex = make(map[fileKey]int, len(s.ReviewedFiles))
+	s.fileIndexLen = len(s.ReviewedFiles)
+	for i, review := range s.ReviewedFiles {
+		key := fileKey{review.Repo, review.Path}
+		// The first review of a file listed twice wins, as a linear scan would find it
+		if _, ok := s.fileIndex[key]; !ok {
+			s.fileIndex[key] = i
+		}
+	}
+	return s.fileIndex
+}
+
+// FileStatus returns the status of the file at path in repo and whether the
+// file has a review at all
+func (s *ReviewState) FileStatus(repo, path string) (string, bool) {
+	review, ok := s.File(repo, path)
+	if !ok {
+		return StateUnreviewed, false
+	}
+	return review.Status(), true
+}
+
+// FileStatuses returns the status of every reviewed file in repo, keyed by
+// path, for callers that look up many files at once
+func (s *ReviewState) FileStatuses(repo string) map[string]string {
+	statuses := make(map[string]string)
+	for _, review := range s.ReviewedFiles {
+		if review.Repo == repo {
+			statuses[review.Path] = review.Status()
+		}
+	}
+	return statuses
+}
+
+// CarryOver copies file reviews from a previous review state whose blob hash
+// still matches the file's current content, so unchanged files keep their
+// status when the branches move. Files already reviewed in the current state
+// are left untouched. It returns the number of reviews carried over.
+//
+// Files reviewed hunk by hunk whose content changed keep the statuses of the
+// hunks still found at the same ranges in the file's current diff, as given
+// by hunks. The hunks they were reviewed against are kept too, so IsStale
+// flags the review, and the statuses of hunks that moved are dropped, leaving
+// the file pending. Changed files whose hunks all kept their ranges aren't
+// carried over, since the change is within the reviewed hunks.
+func (s *ReviewState) CarryOver(previous *ReviewState, blobHashes map[string]string, hunks func(path string) []string) int {
+	if previous == nil {
+		return 0
+	}
+
+	reviewed := make(map[string]bool)
+	for _, review := range s.ReviewedFiles {
+		reviewed[review.Repo+"\x00"+review.Path] = true
+	}
+
+	carried := 0
+	for _, review := range previous.ReviewedFiles {
+		if review.BlobHash == "" || reviewed[review.Repo+"\x00"+review.Path] {
+			continue
+		}
+
+		lines := make(map[string]string, len(review.Lines))
+		if blobHashes[review.Path] == review.BlobHash {
+			for k, v := range review.Lines {
+				lines[k] = v
+			}
+		} else if _, ok := blobHashes[review.Path]; ok && review.hasHunkReviews() && len(review.Hunks) > 0 {
+			current := hunks(review.Path)
+			if !review.IsStale(current) {
+				continue
+			}
+			for k, v := range review.Lines {
+				if slices.Contains(current, k) {
+					lines[k] = v
+				}
+			}
+			if len(lines) == 0 {
+				continue
+			}
+			review.Hunks = append([]string(nil), review.Hunks...)
+		} else {
+			continue
+		}
+		review.Lines = lines
+
+		s.AddFile(review)
+		carried++
+	}
+
+	return carried
+}
+
+// LineState constants, the values stored in review states
 const (
 	StateApproved = "approved"
 	StateRejected = "rejected"
 	StateSkipped  = "skipped"
+	// StateNeedsReview asks for a second opinion from another reviewer
+	StateNeedsReview = "needs-review"
+)
+
+// Statuses derived from the stored ones, which are never stored themselves
+const (
+	// StateMixed is a file whose lines were approved and skipped
+	StateMixed = "mixed"
+	// StateUnreviewed is a file or hunk without a status yet
+	StateUnreviewed = "unreviewed"
 )
 
 // DiffFile represents a file diff
@@ -0,0 +1,303 @@
+package models
+
+import "testing"
+
+func TestReviewStateCarryOver(t *testing.T) {
+	previous := &ReviewState{
+		ReviewedFiles: []FileReview{
+			{Repo: "/repo", Path: "unchanged.go", Lines: map[string]string{"all": StateApproved}, BlobHash: "aaa..bbb"},
+			{Repo: "/repo", Path: "changed.go", Lines: map[string]string{"all": StateRejected}, BlobHash: "aaa..ccc"},
+			{Repo: "/repo", Path: "nohash.go", Lines: map[string]string{"all": StateApproved}},
+			{Repo: "/repo", Path: "already.go", Lines: map[string]string{"all": StateSkipped}, BlobHash: "ddd..eee"},
+		},
+	}
+
+	current := &ReviewState{
+		ReviewedFiles: []FileReview{
+			{Repo: "/repo", Path: "already.go", Lines: map[string]string{"all": StateApproved}, BlobHash: "ddd..eee"},
+		},
+	}
+
+	hashes := map[string]string{
+		"unchanged.go": "aaa..bbb",
+		"changed.go":   "aaa..fff",
+		"nohash.go":    "111..222",
+		"already.go":   "ddd..eee",
+	}
+
+	carried := current.CarryOver(previous, hashes, noHunks)
+	if carried != 1 {
+		t.Fatalf("Expected 1 review carried over, got %d", carried)
+	}
+
+	if len(current.ReviewedFiles) != 2 {
+		t.Fatalf("Expected 2 reviewed files, got %d", len(current.ReviewedFiles))
+	}
+
+	if current.ReviewedFiles[0].Lines["all"] != StateApproved {
+		t.Errorf("Expected existing review of already.go to be kept, got %s", current.ReviewedFiles[0].Lines["all"])
+	}
+
+	carriedReview := current.ReviewedFiles[1]
+	if carriedReview.Path != "unchanged.go" || carriedReview.Lines["all"] != StateApproved {
+		t.Errorf("Expected unchanged.go to be carried over as approved, got %+v", carriedReview)
+	}
+
+	// The carried review must not share its line map with the previous state
+	carriedReview.Lines["all"] = StateRejected
+	if previous.ReviewedFiles[0].Lines["all"] != StateApproved {
+		t.Error("Carried over review should not alias the previous state's lines")
+	}
+
+	if current.CarryOver(nil, hashes, noHunks) != 0 {
+		t.Error("Expected nothing to be carried over from a nil previous state")
+	}
+}
+
+// noHunks stands for the current hunks of files whose diff isn't looked at
+func noHunks(string) []string { return nil }
+
+// TestReviewStateCarryOverStaleHunks tests that hunk reviews of a changed file
+// are carried over flagged as stale, keeping only the hunks still in place
+func TestReviewStateCarryOverStaleHunks(t *testing.T) {
+	reviewed := []string{"-1,3 +1,4", "-10,2 +11,3"}
+	previous := &ReviewState{
+		ReviewedFiles: []FileReview{
+			{Repo: "/repo", Path: "moved.go", Lines: map[string]string{"-1,3 +1,4": StateApproved, "-10,2 +11,3": StateApproved}, BlobHash: "aaa..bbb", Hunks: reviewed},
+			{Repo: "/repo", Path: "edited.go", Lines: map[string]string{"-1,3 +1,4": StateApproved}, BlobHash: "aaa..bbb", Hunks: reviewed[:1]},
+			{Repo: "/repo", Path: "rewritten.go", Lines: map[string]string{"-1,3 +1,4": StateApproved}, BlobHash: "aaa..bbb", Hunks: reviewed[:1]},
+		},
+	}
+	hashes := map[string]string{"moved.go": "aaa..ccc", "edited.go": "aaa..ccc", "rewritten.go": "aaa..ccc"}
+	current := map[string][]string{
+		// Lines were inserted between the hunks
+		"moved.go": {"-1,3 +1,4", "-10,2 +14,3"},
+		// The change is within the reviewed hunk
+		"edited.go": {"-1,3 +1,4"},
+		// No reviewed hunk is left in place
+		"rewritten.go": {"-1,3 +1,8"},
+	}
+
+	state := &ReviewState{}
+	if carried := state.CarryOver(previous, hashes, func(path string) []string { return current[path] }); carried != 1 {
+		t.Fatalf("Expected 1 review carried over, got %d: %+v", carried, state.ReviewedFiles)
+	}
+
+	review := state.ReviewedFiles[0]
+	if review.Path != "moved.go" || !review.IsStale(current["moved.go"]) {
+		t.Errorf("Expected the review of moved.go carried over as stale, got %+v", review)
+	}
+	if review.HunkStatus("-1,3 +1,4") != StateApproved || review.HunkStatus("-10,2 +14,3") != StateUnreviewed {
+		t.Errorf("Expected only the hunk left in place approved, got %v", review.Lines)
+	}
+	if status := review.Status(); status != StateUnreviewed {
+		t.Errorf("Expected the file pending while a hunk moved, got %s", status)
+	}
+}
+
+func TestFileReviewIsStale(t *testing.T) {
+	current := []string{"-1,3 +1,4", "-10,2 +11,3"}
+
+	tests := []struct {
+		name     string
+		review   FileReview
+		expected bool
+	}{
+		{
+			name:     "matching hunks",
+			review:   FileReview{Lines: map[string]string{"2": StateApproved}, Hunks: []string{"-1,3 +1,4", "-10,2 +11,3"}},
+			expected: false,
+		},
+		{
+			name:     "shifted hunk",
+			review:   FileReview{Lines: map[string]string{"2": StateApproved}, Hunks: []string{"-1,3 +1,4", "-8,2 +9,3"}},
+			expected: true,
+		},
+		{
+			name:     "different hunk count",
+			review:   FileReview{Lines: map[string]string{"2-4": StateRejected}, Hunks: []string{"-1,3 +1,4"}},
+			expected: true,
+		},
+		{
+			name:     "whole-file review",
+			review:   FileReview{Lines: map[string]string{"all": StateApproved}, Hunks: []string{"-5,1 +5,1"}},
+			expected: false,
+		},
+		{
+			name:     "no recorded hunks",
+			review:   FileReview{Lines: map[string]string{"2": StateApproved}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if stale := tt.review.IsStale(current); stale != tt.expected {
+				t.Errorf("Expected stale=%v, got %v", tt.expected, stale)
+			}
+		})
+	}
+}
+
+func TestReviewStateFileStatus(t *testing.T) {
+	state := &ReviewState{
+		ReviewedFiles: []FileReview{
+			{Repo: "/repo", Path: "approved.go", Lines: map[string]string{"all": StateApproved}},
+			{Repo: "/repo", Path: "skipped.go", Lines: map[string]string{"all": StateSkipped}},
+			{Repo: "/repo", Path: "rejected.go", Lines: map[string]string{"1": StateApproved, "2": StateSkipped, "3": StateRejected}},
+			{Repo: "/repo", Path: "mixed.go", Lines: map[string]string{"1": StateApproved, "2": StateSkipped}},
+			{Repo: "/repo", Path: "second.go", Lines: map[string]string{"1": StateApproved, "2": StateNeedsReview}},
+			{Repo: "/repo", Path: "contested.go", Lines: map[string]string{"1": StateNeedsReview, "2": StateRejected}},
+			{Repo: "/repo", Path: "empty.go", Lines: map[string]string{}},
+			{Repo: "/other", Path: "other.go", Lines: map[string]string{"all": StateRejected}},
+		},
+	}
+
+	tests := []struct {
+		repo     string
+		path     string
+		expected string
+		reviewed bool
+	}{
+		{repo: "/repo", path: "approved.go", expected: StateApproved, reviewed: true},
+		{repo: "/repo", path: "skipped.go", expected: StateSkipped, reviewed: true},
+		{repo: "/repo", path: "rejected.go", expected: StateRejected, reviewed: true},
+		{repo: "/repo", path: "mixed.go", expected: "mixed", reviewed: true},
+		{repo: "/repo", path: "second.go", expected: StateNeedsReview, reviewed: true},
+		{repo: "/repo", path: "contested.go", expected: StateRejected, reviewed: true},
+		{repo: "/repo", path: "empty.go", expected: "unreviewed", reviewed: true},
+		{repo: "/repo", path: "missing.go", expected: "unreviewed", reviewed: false},
+		{repo: "/repo", path: "other.go", expected: "unreviewed", reviewed: false},
+		{repo: "/other", path: "other.go", expected: StateRejected, reviewed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repo+"/"+tt.path, func(t *testing.T) {
+			status, reviewed := state.FileStatus(tt.repo, tt.path)
+			if status != tt.expected || reviewed != tt.reviewed {
+				t.Errorf("Expected (%s, %v), got (%s, %v)", tt.expected, tt.reviewed, status, reviewed)
+			}
+		})
+	}
+
+	statuses := state.FileStatuses("/repo")
+	if len(statuses) != 7 || statuses["rejected.go"] != StateRejected || statuses["mixed.go"] != "mixed" {
+		t.Errorf("Unexpected statuses for /repo: %v", statuses)
+	}
+}
+
+// TestReviewStateFileIndex tests that file lookups follow the reviews added
+// and removed, whether through AddFile and RemoveFile or not
+func TestReviewStateFileIndex(t *testing.T) {
+	state := &ReviewState{}
+	lookup := func(repo, path string) string {
+		t.Helper()
+		review, ok := state.File(repo, path)
+		if !ok {
+			return ""
+		}
+		return review.Lines["all"]
+	}
+
+	state.AddFile(FileReview{Repo: "/repo", Path: "a.go", Lines: map[string]string{"all": StateApproved}})
+	state.AddFile(FileReview{Repo: "/other", Path: "a.go", Lines: map[string]string{"all": StateRejected}})
+	if lookup("/repo", "a.go") != StateApproved || lookup("/other", "a.go") != StateRejected {
+		t.Errorf("Expected both reviews of a.go found, got %+v", state.ReviewedFiles)
+	}
+
+	// Changes made through the returned review show in later lookups
+	review := state.AddFile(FileReview{Repo: "/repo", Path: "b.go", Lines: map[string]string{}})
+	review.SetStatus(StateSkipped)
+	if lookup("/repo", "b.go") != StateSkipped {
+		t.Errorf("Expected b.go skipped, got %q", lookup("/repo", "b.go"))
+	}
+
+	state.RemoveFile("/repo", "a.go")
+	if lookup("/repo", "a.go") != "" || lookup("/other", "a.go") != StateRejected || lookup("/repo", "b.go") != StateSkipped {
+		t.Errorf("Expected only /repo's a.go removed, got %+v", state.ReviewedFiles)
+	}
+
+	// Changes made to the slice directly are picked up too
+	state.ReviewedFiles = append(state.ReviewedFiles, FileReview{Repo: "/repo", Path: "c.go", Lines: map[string]string{"all": StateApproved}})
+	if lookup("/repo", "c.go") != StateApproved {
+		t.Errorf("Expected c.go found once appended, got %+v", state.ReviewedFiles)
+	}
+	state.ReviewedFiles[0], state.ReviewedFiles[2] = state.ReviewedFiles[2], state.ReviewedFiles[0]
+	if lookup("/repo", "c.go") != StateApproved || lookup("/other", "a.go") != StateRejected {
+		t.Errorf("Expected the files found once reordered, got %+v", state.ReviewedFiles)
+	}
+}
+
+func TestReviewStateUnreviewedFiles(t *testing.T) {
+	state := &ReviewState{
+		ReviewedFiles: []FileReview{
+			{Repo: "/repo", Path: "approved.go", Lines: map[string]string{"all": StateApproved}},
+			{Repo: "/repo", Path: "second.go", Lines: map[string]string{"all": StateNeedsReview}},
+			{Repo: "/repo", Path: "empty.go", Lines: map[string]string{}},
+		},
+	}
+
+	if _, ok := state.UnreviewedFiles(); ok {
+		t.Error("Expected no count without a recorded file count")
+	}
+
+	state.ChangedFiles = 4
+	if unreviewed, ok := state.UnreviewedFiles(); !ok || unreviewed != 2 {
+		t.Errorf("Expected 2 unreviewed files, got (%d, %v)", unreviewed, ok)
+	}
+
+	// A count older than the reviews doesn't go below zero
+	state.ChangedFiles = 1
+	if unreviewed, ok := state.UnreviewedFiles(); !ok || unreviewed != 0 {
+		t.Errorf("Expected no unreviewed files, got (%d, %v)", unreviewed, ok)
+	}
+}
+
+func TestFileReviewHunkStatuses(t *testing.T) {
+	hunks := []string{"-1,3 +1,4", "-20,2 +21,2", "-40 +41,0"}
+
+	review := FileReview{Repo: "/repo", Path: "main.go"}
+	review.SetHunkStatus(hunks[0], StateApproved, hunks)
+	if status := review.Status(); status != "unreviewed" {
+		t.Errorf("Expected a file with pending hunks to be unreviewed, got %s", status)
+	}
+	if status := review.HunkStatus(hunks[1]); status != "unreviewed" {
+		t.Errorf("Expected an unreviewed hunk, got %s", status)
+	}
+
+	review.SetHunkStatus(hunks[1], StateApproved, hunks)
+	review.SetHunkStatus(hunks[2], StateSkipped, hunks)
+	if status := review.Status(); status != "mixed" {
+		t.Errorf("Expected approved and skipped hunks to make the file mixed, got %s", status)
+	}
+
+	review.SetHunkStatus(hunks[1], StateRejected, hunks)
+	if status := review.Status(); status != StateRejected {
+		t.Errorf("Expected a rejected hunk to reject the file, got %s", status)
+	}
+
+	// A whole-file status replaces the hunk statuses
+	review.SetStatus(StateApproved)
+	if len(review.Lines) != 1 || review.Status() != StateApproved {
+		t.Errorf("Expected only the whole-file status to remain, got %v", review.Lines)
+	}
+	if status := review.HunkStatus(hunks[2]); status != StateApproved {
+		t.Errorf("Expected hunks to inherit the whole-file status, got %s", status)
+	}
+
+	// Reviewing a hunk afterwards splits the whole-file status between the hunks
+	review.SetHunkStatus(hunks[0], StateRejected, hunks)
+	expected := map[string]string{hunks[0]: StateRejected, hunks[1]: StateApproved, hunks[2]: StateApproved}
+	if len(review.Lines) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, review.Lines)
+	}
+	for hunk, status := range expected {
+		if review.Lines[hunk] != status {
+			t.Errorf("Expected %s for hunk %q, got %s", status, hunk, review.Lines[hunk])
+		}
+	}
+
+	if !IsHunkKey(hunks[2]) || IsHunkKey("all") || IsHunkKey("12") || IsHunkKey("10-20") {
+		t.Error("Unexpected hunk key classification")
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+// StatusMeta is how a review status is presented. It is kept apart from the
+// status values, which are what review states store, so labels and colors
+// can change without touching stored data.
+type StatusMeta struct {
+	// Label is the name shown for the status
+	Label string `json:"label"`
+	// Color is a Tailwind palette name, such as "green", that the UI derives
+	// the badge classes from
+	Color string `json:"color"`
+}
+
+// StatusMetas holds the presentation of review statuses, keyed by status
+type StatusMetas map[string]StatusMeta
+
+// DefaultStatusMetas returns the built-in presentation of every status
+func DefaultStatusMetas() StatusMetas {
+	return StatusMetas{
+		StateApproved:    {Label: "Approved", Color: "green"},
+		StateRejected:    {Label: "Rejected", Color: "red"},
+		StateSkipped:     {Label: "Skipped", Color: "yellow"},
+		StateNeedsReview: {Label: "Needs second opinion", Color: "blue"},
+		StateMixed:       {Label: "Mixed", Color: "purple"},
+		StateUnreviewed:  {Label: "Unreviewed", Color: "gray"},
+	}
+}
+
+// For returns the presentation of a status. Unknown statuses are shown as
+// they are, in gray.
+func (m StatusMetas) For(status string) StatusMeta {
+	if meta, ok := m[status]; ok {
+		return meta
+	}
+	return StatusMeta{Label: status, Color: "gray"}
+}
+
+// Set changes how a status is presented, for localized or custom labels and
+// colors. Empty fields keep their current value.
+func (m StatusMetas) Set(status string, meta StatusMeta) {
+	current := m.For(status)
+	if meta.Label != "" {
+		current.Label = meta.Label
+	}
+	if meta.Color != "" {
+		current.Color = meta.Color
+	}
+	m[status] = current
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestStatusMetaLabelsDontChangeStoredValues tests that custom labels and
+// colors only change how statuses are shown, not what review states store
+func TestStatusMetaLabelsDontChangeStoredValues(t *testing.T) {
+	metas := DefaultStatusMetas()
+	if meta := metas.For(StateApproved); meta.Label != "Approved" || meta.Color != "green" {
+		t.Errorf("Expected the default approved presentation, got %+v", meta)
+	}
+	if meta := metas.For("pending"); meta.Label != "pending" || meta.Color != "gray" {
+		t.Errorf("Expected an unknown status to be shown as is, got %+v", meta)
+	}
+
+	metas.Set(StateApproved, StatusMeta{Label: "Aprobado"})
+	metas.Set(StateRejected, StatusMeta{Label: "Rechazado", Color: "orange"})
+
+	if meta := metas.For(StateApproved); meta.Label != "Aprobado" || meta.Color != "green" {
+		t.Errorf("Expected a custom label keeping the default color, got %+v", meta)
+	}
+	if meta := metas[StateRejected]; meta.Label != "Rechazado" || meta.Color != "orange" {
+		t.Errorf("Expected a custom label and color, got %+v", meta)
+	}
+
+	// Stored and derived values are untouched
+	review := FileReview{Repo: "/repo", Path: "a.go", Lines: map[string]string{"-1 +1": StateApproved, "-5 +5": StateSkipped}}
+	if status := review.Status(); status != "mixed" {
+		t.Errorf("Expected status mixed, got %s", status)
+	}
+	review.Lines["-5 +5"] = StateRejected
+	data, err := json.Marshal(review)
+	if err != nil {
+		t.Fatalf("Failed to marshal review: %v", err)
+	}
+	if !strings.Contains(string(data), `"approved"`) || !strings.Contains(string(data), `"rejected"`) || strings.Contains(string(data), "Aprobado") {
+		t.Errorf("Expected the stored values to stay the same, got %s", data)
+	}
+
+	// Each set of metas is independent of the others
+	if meta := DefaultStatusMetas().For(StateApproved); meta.Label != "Approved" {
+		t.Errorf("Expected the defaults left alone, got %+v", meta)
+	}
+}
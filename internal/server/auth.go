@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// userContextKey is the request context key holding the authenticated user
+type userContextKey struct{}
+
+// WithAuthTokens enables authentication. tokens maps each user name to the
+// token it authenticates with, and every user gets a review state of their own.
+// Without tokens the server runs in single-user mode.
+func WithAuthTokens(tokens map[string]string) Option {
+	return func(s *Server) {
+		s.authTokens = tokens
+	}
+}
+
+// authEnabled reports whether requests must be authenticated
+func (s *Server) authEnabled() bool {
+	return len(s.authTokens) > 0
+}
+
+// requireAuth rejects unauthenticated requests and records the user of the
+// authenticated ones in the request context. Browsers authenticate through
+// HTTP basic auth with the token as password; API clients can send it as a
+// bearer token instead.
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := s.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="diffty"`)
+			s.respondError(w, r, "Unauthorized", "Valid credentials are required", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	})
+}
+
+// authenticate returns the user the request's credentials belong to
+func (s *Server) authenticate(r *http.Request) (string, bool) {
+	if name, token, ok := r.BasicAuth(); ok {
+		expected, exists := s.authTokens[name]
+		if exists && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			return name, true
+		}
+		return "", false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	for name, expected := range s.authTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// userFromRequest returns the authenticated user of a request, or an empty
+// string in single-user mode
+func userFromRequest(r *http.Request) string {
+	user, _ := r.Context().Value(userContextKey{}).(string)
+	return user
+}
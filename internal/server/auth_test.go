@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+func TestRequireAuth(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	WithAuthTokens(map[string]string{"alice": "alice-token", "bob": "bob-token"})(server)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("source", "feature")
+	query.Set("target", "main")
+	query.Set("source_commit", runGit(t, repoDir, "rev-parse", "feature"))
+	query.Set("target_commit", runGit(t, repoDir, "rev-parse", "main"))
+	query.Set("file", "test.txt")
+
+	tests := []struct {
+		name         string
+		authorize    func(r *http.Request)
+		expectedCode int
+		expectedUser string
+	}{
+		{name: "anonymous", authorize: func(r *http.Request) {}, expectedCode: http.StatusUnauthorized},
+		{name: "wrong token", authorize: func(r *http.Request) { r.SetBasicAuth("alice", "bob-token") }, expectedCode: http.StatusUnauthorized},
+		{name: "basic auth", authorize: func(r *http.Request) { r.SetBasicAuth("alice", "alice-token") }, expectedCode: http.StatusOK, expectedUser: "alice"},
+		{name: "bearer token", authorize: func(r *http.Request) { r.Header.Set("Authorization", "Bearer bob-token") }, expectedCode: http.StatusOK, expectedUser: "bob"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage.lastUser = ""
+
+			req := httptest.NewRequest("POST", "/api/review/approve?"+query.Encode(), nil)
+			tt.authorize(req)
+			w := httptest.NewRecorder()
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedCode, w.Code, w.Body.String())
+			}
+
+			if tt.expectedCode == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("Expected a WWW-Authenticate challenge")
+			}
+
+			// The review is stored under the authenticated user
+			if mockStorage.lastUser != tt.expectedUser {
+				t.Errorf("Expected review state of %q, got %q", tt.expectedUser, mockStorage.lastUser)
+			}
+		})
+	}
+}
+
+func TestSingleUserModeSkipsAuth(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d without authentication, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestHandleDiffViewReviewers(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	WithAuthTokens(map[string]string{"alice": "alice-token"})(server)
+	overrideTemplate(t, server, "diff.html", `{{range .Reviewers}}{{.User}}={{.Status}};{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+	mockStorage.userStates = []*models.ReviewState{
+		{User: "bob", ReviewedFiles: []models.FileReview{{Repo: repoDir, Path: "test.txt", Lines: map[string]string{"all": models.StateRejected}}}},
+		{User: "alice", ReviewedFiles: []models.FileReview{{Repo: repoDir, Path: "test.txt", Lines: map[string]string{"all": models.StateApproved}}}},
+		{User: "carol", ReviewedFiles: []models.FileReview{}},
+	}
+
+	req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&file=test.txt", nil)
+	req.SetBasicAuth("alice", "alice-token")
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	if body := w.Body.String(); !strings.Contains(body, "alice=approved;bob=rejected;carol=unreviewed;") {
+		t.Errorf("Expected aggregated reviewer statuses, got %s", body)
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// WithBasePath serves every route under a path prefix, such as "/diffty" for
+// a server behind a reverse proxy at https://tools.example.com/diffty/. Links,
+// assets and redirects carry the prefix too. A missing leading slash is added
+// and a trailing one dropped; an empty path or "/" serves from the root.
+func WithBasePath(path string) Option {
+	return func(s *Server) {
+		s.basePath = normalizeBasePath(path)
+	}
+}
+
+// normalizeBasePath returns path with a leading slash and without a trailing
+// one, or an empty string for the root
+func normalizeBasePath(path string) string {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// BasePath returns the path prefix the server is served under, without a
+// trailing slash, or an empty string when it's served from the root
+func (s *Server) BasePath() string {
+	return s.basePath
+}
+
+// url returns the URL of a path of this server, such as "/diff?repo=...",
+// under its base path. Redirects and URLs handed to API clients go through it;
+// templates prefix the links they render with the basePath function instead.
+func (s *Server) url(path string) string {
+	return s.basePath + path
+}
+
+// withBasePath serves handler under the base path, with the prefix stripped
+// from the request paths it sees. Requests outside of the base path aren't
+// found, except the base path itself, which redirects to its trailing slash.
+func (s *Server) withBasePath(handler http.Handler) http.Handler {
+	if s.basePath == "" {
+		return handler
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(s.basePath+"/", http.StripPrefix(s.basePath, handler))
+	mux.HandleFunc(s.basePath, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, s.basePath+"/", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, fmt.Sprintf("Not found: this server is served under %s/", s.basePath), http.StatusNotFound)
+	})
+	return mux
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeBasePath(t *testing.T) {
+	tests := map[string]string{
+		"":               "",
+		"/":              "",
+		"diffty":         "/diffty",
+		"/diffty/":       "/diffty",
+		" /tools/diffty": "/tools/diffty",
+	}
+
+	for path, expected := range tests {
+		if got := normalizeBasePath(path); got != expected {
+			t.Errorf("%q: expected %q, got %q", path, expected, got)
+		}
+	}
+}
+
+// TestBasePathRoutes tests that the routes are served under the base path only
+func TestBasePathRoutes(t *testing.T) {
+	server, _ := setupTestServer(t)
+	WithBasePath("/diffty/")(server)
+	router := server.Router()
+
+	tests := []struct {
+		target   string
+		status   int
+		location string
+	}{
+		{target: "/diffty/", status: http.StatusOK},
+		{target: "/diffty/static/css/main.css", status: http.StatusOK},
+		{target: "/diffty", status: http.StatusMovedPermanently, location: "/diffty/"},
+		{target: "/", status: http.StatusNotFound},
+		{target: "/static/css/main.css", status: http.StatusNotFound},
+		// Incomplete comparisons send the client back to the index
+		{target: "/diffty/diff?repo=/test/repo", status: http.StatusSeeOther, location: "/diffty/"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.target, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("%s: expected status code %d, got %d", test.target, test.status, w.Code)
+		}
+		if location := w.Header().Get("Location"); location != test.location {
+			t.Errorf("%s: expected a redirect to %q, got %q", test.target, test.location, location)
+		}
+	}
+}
+
+// TestBasePathReviewRedirect tests that reviews redirect back under the base
+// path, and that JSON clients are handed prefixed URLs
+func TestBasePathReviewRedirect(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	WithBasePath("diffty")(server)
+	router := server.Router()
+
+	query := reviewComparisonQuery(t)
+	mockStorage.repositories = []string{query.Get("repo")}
+	query.Set("file", "test.txt")
+	query.Set("status", "approved")
+
+	req := httptest.NewRequest("POST", "/diffty/api/review-state?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+	if location := w.Header().Get("Location"); !strings.HasPrefix(location, "/diffty/diff?") {
+		t.Errorf("Expected a redirect under the base path, got %s", location)
+	}
+
+	req = httptest.NewRequest("POST", "/diffty/api/review-state?"+query.Encode(), nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"redirect":"/diffty/diff?`) {
+		t.Errorf("Expected the JSON redirect under the base path, got %s", w.Body.String())
+	}
+}
+
+// TestBasePathTemplates tests that the bundled templates prefix their links
+// and assets with the base path
+func TestBasePathTemplates(t *testing.T) {
+	mockStorage := &MockStorage{repositories: []string{"/test/repo"}}
+	server, err := New(mockStorage, WithBasePath("/diffty"))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/diffty/", nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	body := w.Body.String()
+	for _, expected := range []string{
+		`href="/diffty/static/css/main.css"`,
+		`action="/diffty/api/theme"`,
+		`action="/diffty/api/repository/add"`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected the index to contain %s", expected)
+		}
+	}
+	if strings.Contains(body, `href="/static/`) || strings.Contains(body, `action="/api/`) {
+		t.Error("Expected no links outside of the base path")
+	}
+}
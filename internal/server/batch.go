@@ -0,0 +1,164 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/models"
+)
+
+// reviewProgress summarizes how far the review of a comparison has come
+type reviewProgress struct {
+	Total    int
+	Approved int
+	Rejected int
+	Skipped  int
+	// NeedsReview counts the files waiting on a second opinion
+	NeedsReview int
+	Mixed       int
+	Unreviewed  int
+	// Complete counts the files whose review is done under the skipped policy
+	Complete int
+}
+
+// Percent returns the share of complete files, rounded down
+func (p reviewProgress) Percent() int {
+	if p.Total == 0 {
+		return 0
+	}
+	return p.Complete * 100 / p.Total
+}
+
+// isComplete reports whether a file with the given status needs no further
+// review. Skipped files only count as complete with WithSkippedAsComplete;
+// files needing a second opinion never do until another reviewer settles them.
+func (s *Server) isComplete(status string) bool {
+	switch status {
+	case "", models.StateUnreviewed, models.StateNeedsReview:
+		return false
+	case models.StateSkipped:
+		return s.skippedComplete
+	}
+	return true
+}
+
+// comparisonProgress counts the files of a comparison by review status
+func (s *Server) comparisonProgress(c comparison) (reviewProgress, error) {
+	paths, statuses, err := s.loadReviewFiles(c)
+	if err != nil {
+		return reviewProgress{}, err
+	}
+	return s.countProgress(paths, statuses), nil
+}
+
+// countProgress counts paths by their review status in statuses
+func (s *Server) countProgress(paths []string, statuses map[string]string) reviewProgress {
+	progress := reviewProgress{Total: len(paths)}
+	for _, path := range paths {
+		switch statuses[path] {
+		case models.StateApproved:
+			progress.Approved++
+		case models.StateRejected:
+			progress.Rejected++
+		case models.StateSkipped:
+			progress.Skipped++
+		case models.StateNeedsReview:
+			progress.NeedsReview++
+		case models.StateMixed:
+			progress.Mixed++
+		default:
+			progress.Unreviewed++
+		}
+		if s.isComplete(statuses[path]) {
+			progress.Complete++
+		}
+	}
+
+	return progress
+}
+
+// batchEntry is a single source branch of a batch comparison
+type batchEntry struct {
+	Comparison comparison
+	Progress   reviewProgress
+	// Error explains why the comparison couldn't be loaded, if it couldn't
+	Error string
+}
+
+// handleBatch renders the combined review progress of several source branches
+// compared against one target
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	repoPath := query.Get("repo")
+	targetBranch := query.Get("target")
+	sources := query["source"]
+
+	if repoPath == "" || targetBranch == "" || len(sources) == 0 {
+		s.renderError(w, r, "Missing Parameters", "A repository, a target branch and at least one source branch are required", http.StatusBadRequest)
+		return
+	}
+
+	repo, exists, err := s.GetRepository(repoPath)
+	if err != nil {
+		s.renderError(w, r, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
+		return
+	}
+	if !exists {
+		s.renderError(w, r, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	targetCommit, err := repo.GetBranchCommitHash(targetBranch)
+	if err != nil {
+		s.renderError(w, r, "Branch Error", fmt.Sprintf("Failed to get commit hash for target branch '%s': %v", targetBranch, err), branchErrorStatus(err))
+		return
+	}
+
+	// A broken source branch shouldn't hide the progress of the others
+	entries := make([]batchEntry, 0, len(sources))
+	for _, source := range sources {
+		entry := batchEntry{
+			Comparison: comparison{
+				RepoPath:     repoPath,
+				SourceBranch: source,
+				TargetBranch: targetBranch,
+				TargetCommit: targetCommit,
+				User:         userFromRequest(r),
+				Pathspec:     strings.TrimSpace(query.Get("pathspec")),
+			},
+		}
+
+		sourceCommit, err := repo.GetBranchCommitHash(source)
+		if err != nil {
+			entry.Error = fmt.Sprintf("Failed to get commit hash: %v", err)
+			entries = append(entries, entry)
+			continue
+		}
+		entry.Comparison.SourceCommit = sourceCommit
+		if git.IsStashRef(source) {
+			if entry.Comparison.TargetCommit, err = targetCommitOf(repo, source, sourceCommit, targetBranch); err != nil {
+				entry.Error = fmt.Sprintf("Failed to get the base commit: %v", err)
+				entries = append(entries, entry)
+				continue
+			}
+		}
+
+		entry.Progress, err = s.comparisonProgress(entry.Comparison)
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		entries = append(entries, entry)
+	}
+
+	data := map[string]interface{}{
+		"RepoPath":     repoPath,
+		"RepoName":     filepath.Base(repoPath),
+		"TargetBranch": targetBranch,
+		"Entries":      entries,
+	}
+
+	s.render(w, r, "batch.html", data)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+func TestHandleBatch(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "batch.html", `{{range .Entries}}{{.Comparison.SourceBranch}}={{if .Error}}error{{else}}{{.Progress.Complete}}/{{.Progress.Total}}{{end}};{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "branch", "merged", "main")
+	mockStorage.repositories = []string{repoDir}
+	mockStorage.reviewState = &models.ReviewState{
+		ReviewedFiles: []models.FileReview{
+			{Repo: repoDir, Path: "test.txt", Lines: map[string]string{"all": models.StateApproved}},
+		},
+	}
+
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("target", "main")
+	query["source"] = []string{"feature", "merged", "missing"}
+
+	req := httptest.NewRequest("GET", "/batch?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// A branch without changes has nothing to review, a missing one doesn't hide the rest
+	if body := w.Body.String(); !strings.Contains(body, "feature=1/1;merged=0/0;missing=error;") {
+		t.Errorf("Expected per-branch progress, got %s", body)
+	}
+
+	// Sources are required
+	req = httptest.NewRequest("GET", "/batch?repo="+url.QueryEscape(repoDir)+"&target=main", nil)
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestReviewProgress(t *testing.T) {
+	progress := reviewProgress{Total: 4, Approved: 1, Rejected: 1, Unreviewed: 2, Complete: 2}
+
+	if progress.Percent() != 50 {
+		t.Errorf("Expected 50 percent, got %d", progress.Percent())
+	}
+	if (reviewProgress{}).Percent() != 0 {
+		t.Error("Expected an empty comparison to be at 0 percent")
+	}
+}
+
+// TestComparisonProgressSkippedPolicy tests that skipped files count as complete only when configured
+func TestComparisonProgressSkippedPolicy(t *testing.T) {
+	for _, skippedComplete := range []bool{false, true} {
+		t.Run(fmt.Sprintf("skippedComplete=%v", skippedComplete), func(t *testing.T) {
+			server, _, query := setupReviewAPITest(t)
+			if skippedComplete {
+				WithSkippedAsComplete()(server)
+			}
+
+			doReviewAPI(t, server, "POST", "/api/review/approve", query, "a.txt")
+			doReviewAPI(t, server, "POST", "/api/review/skip", query, "b.txt")
+			doReviewAPI(t, server, "POST", "/api/review/needs-review", query, "test.txt")
+
+			progress, err := server.comparisonProgress(comparisonFromRequest(httptest.NewRequest("GET", "/?"+query.Encode(), nil)))
+			if err != nil {
+				t.Fatalf("Failed to compute progress: %v", err)
+			}
+
+			// Files needing a second opinion are never complete
+			expected := reviewProgress{Total: 3, Approved: 1, Skipped: 1, NeedsReview: 1, Complete: 1}
+			if skippedComplete {
+				expected.Complete = 2
+			}
+			if progress != expected {
+				t.Errorf("Expected %+v, got %+v", expected, progress)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// changeTypeLabels names the change types in the file list filter chips
+var changeTypeLabels = map[string]string{
+	"A": "added",
+	"M": "modified",
+	"D": "deleted",
+	"R": "renamed",
+	"C": "copied",
+	"T": "type changed",
+}
+
+// annotateChangeTypes records each file's change type under the "Change" key
+func annotateChangeTypes(files []map[string]string, changes []git.FileChange) {
+	changeTypes := make(map[string]string, len(changes))
+	for _, change := range changes {
+		changeTypes[change.Path] = change.ChangeType
+	}
+
+	for _, file := range files {
+		file["Change"] = changeTypes[file["Path"]]
+	}
+}
+
+// diffSection is how a single section of a diff changes its file
+type diffSection struct {
+	changeType string
+	// mode is the mode the file was created or deleted with
+	mode string
+}
+
+// parseChangeTypes derives the change type of each file of a diff from its
+// section headers, for diffs git can't be asked about, such as patch files.
+// A path with several sections, such as one deleted and then re-added by a
+// patch series, or a symbolic link replaced by a regular file, gets its net
+// change; a file added and then deleted again has none and is left out.
+func parseChangeTypes(diffText string) []git.FileChange {
+	var paths []string
+	sections := make(map[string][]diffSection)
+
+	var path string
+	for _, line := range strings.Split(diffText, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			path = ""
+			if found := extractFilePathsFromDiff(line); len(found) == 1 {
+				path = found[0]
+				if _, seen := sections[path]; !seen {
+					paths = append(paths, path)
+				}
+				sections[path] = append(sections[path], diffSection{changeType: "M"})
+			}
+		case path == "":
+		case strings.HasPrefix(line, "new file mode "):
+			sections[path][len(sections[path])-1] = diffSection{changeType: "A", mode: strings.TrimPrefix(line, "new file mode ")}
+		case strings.HasPrefix(line, "deleted file mode "):
+			sections[path][len(sections[path])-1] = diffSection{changeType: "D", mode: strings.TrimPrefix(line, "deleted file mode ")}
+		case strings.HasPrefix(line, "rename to "):
+			sections[path][len(sections[path])-1].changeType = "R"
+		case strings.HasPrefix(line, "copy to "):
+			sections[path][len(sections[path])-1].changeType = "C"
+		}
+	}
+
+	changes := []git.FileChange{}
+	for _, path := range paths {
+		if changeType := netChangeType(sections[path]); changeType != "" {
+			changes = append(changes, git.FileChange{Path: path, ChangeType: changeType})
+		}
+	}
+	return changes
+}
+
+// netChangeType returns the change the sections of a file make together,
+// telling from the first one whether the file existed before and from the
+// last one whether it exists after
+func netChangeType(sections []diffSection) string {
+	first, last := sections[0], sections[len(sections)-1]
+	if len(sections) == 1 {
+		return first.changeType
+	}
+
+	existedBefore := first.changeType != "A"
+	existsAfter := last.changeType != "D"
+	switch {
+	case existedBefore && existsAfter:
+		// Deleted and re-added as another kind of file, such as a symbolic link
+		// replaced by a regular file. Git reports it as a type change.
+		if first.changeType == "D" && last.changeType == "A" && fileType(first.mode) != fileType(last.mode) {
+			return "T"
+		}
+		return "M"
+	case existsAfter:
+		return "A"
+	case existedBefore:
+		return "D"
+	}
+	return ""
+}
+
+// fileType returns the file type bits of a git mode, such as "120" for
+// symbolic links and "100" for regular files
+func fileType(mode string) string {
+	if len(mode) > 3 {
+		return mode[:len(mode)-3]
+	}
+	return ""
+}
+
+// filterFilesByChangeType returns the files with the given change type,
+// preserving order. An empty change type matches every file.
+func filterFilesByChangeType(files []map[string]string, changeType string) []map[string]string {
+	if changeType == "" {
+		return files
+	}
+	filtered := []map[string]string{}
+	for _, file := range files {
+		if file["Change"] == changeType {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
+
+// ChangeTypeFilter represents a change type filter chip in the file list
+type ChangeTypeFilter struct {
+	ChangeType string
+	Label      string
+	Count      int
+	Active     bool
+}
+
+// buildChangeTypeFilters returns a filter chip per change type present in the
+// files, plus the active one even when no file has it
+func buildChangeTypeFilters(files []map[string]string, active string) []ChangeTypeFilter {
+	counts := make(map[string]int)
+	for _, file := range files {
+		counts[file["Change"]]++
+	}
+
+	filters := []ChangeTypeFilter{}
+	for _, changeType := range git.ChangeTypes {
+		if counts[changeType] == 0 && changeType != active {
+			continue
+		}
+		filters = append(filters, ChangeTypeFilter{
+			ChangeType: changeType,
+			Label:      changeTypeLabels[changeType],
+			Count:      counts[changeType],
+			Active:     changeType == active,
+		})
+	}
+	return filters
+}
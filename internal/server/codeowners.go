@@ -0,0 +1,111 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// annotateOwners records each file's code owners under the "Owners" key,
+// separated by spaces
+func annotateOwners(files []map[string]string, owners *git.CodeOwners) {
+	for _, file := range files {
+		file["Owners"] = strings.Join(owners.Owners(file["Path"]), " ")
+	}
+}
+
+// ownsFile reports whether owner is one of the owners annotateOwners recorded
+// for file, without regard to case
+func ownsFile(file map[string]string, owner string) bool {
+	for _, candidate := range strings.Fields(file["Owners"]) {
+		if strings.EqualFold(candidate, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterFilesByOwner returns the files owned by owner, preserving order. An
+// empty owner matches every file.
+func filterFilesByOwner(files []map[string]string, owner string) []map[string]string {
+	if owner == "" {
+		return files
+	}
+	filtered := []map[string]string{}
+	for _, file := range files {
+		if ownsFile(file, owner) {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
+
+// OwnerFilter represents a code owner filter chip in the file list
+type OwnerFilter struct {
+	Owner  string
+	Count  int
+	Active bool
+}
+
+// buildOwnerFilters returns a filter chip per owner of the files, sorted by
+// name, plus the active one even when it owns none of them
+func buildOwnerFilters(files []map[string]string, active string) []OwnerFilter {
+	counts := make(map[string]int)
+	// Owners differing in case only are the same, listed as first written
+	names := make(map[string]string)
+	for _, file := range files {
+		for _, owner := range strings.Fields(file["Owners"]) {
+			key := strings.ToLower(owner)
+			if _, ok := names[key]; !ok {
+				names[key] = owner
+			}
+			counts[key]++
+		}
+	}
+	if key := strings.ToLower(active); active != "" && counts[key] == 0 {
+		names[key] = active
+	}
+
+	filters := make([]OwnerFilter, 0, len(names))
+	for key, name := range names {
+		filters = append(filters, OwnerFilter{Owner: name, Count: counts[key], Active: strings.EqualFold(name, active)})
+	}
+	sort.Slice(filters, func(i, j int) bool {
+		return strings.ToLower(filters[i].Owner) < strings.ToLower(filters[j].Owner)
+	})
+	return filters
+}
+
+// setOwnerFilter restricts the diff view's file list to the files of the
+// owner filter, if any, going by the CODEOWNERS file of the comparison's
+// target, as the owners of the branch merged into review its changes. It
+// returns the files left. Without a CODEOWNERS file the filter isn't offered
+// and an owner asked for is ignored.
+func setOwnerFilter(data map[string]interface{}, repo *git.Repository, target string, files []map[string]string, viewOpts viewOptions) []map[string]string {
+	if len(files) == 0 {
+		return files
+	}
+
+	codeOwners, err := repo.GetCodeOwners(target)
+	if err != nil {
+		if !errors.Is(err, git.ErrNoCodeOwners) {
+			// Owners only drive the file list filter, so a failure isn't fatal
+			log.Printf("Warning: failed to load code owners: %v", err)
+		}
+		if viewOpts.Owner != "" {
+			data["OwnerFilterUnavailable"] = true
+		}
+		return files
+	}
+
+	annotateOwners(files, codeOwners)
+	data["CodeOwnersPath"] = codeOwners.Path
+	data["OwnerFilters"] = buildOwnerFilters(files, viewOpts.Owner)
+	data["OwnerFilter"] = viewOpts.Owner
+	data["OwnerFilterTotal"] = len(files)
+	data["OwnerQuery"] = viewOpts.withOwner("").querySuffix()
+	return filterFilesByOwner(files, viewOpts.Owner)
+}
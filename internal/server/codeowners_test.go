@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOwnerFilters(t *testing.T) {
+	files := []map[string]string{
+		{"Path": "docs/a.md", "Owners": "@docs"},
+		{"Path": "src/b.go", "Owners": "@org/backend @Docs"},
+		{"Path": "vendor/c.go", "Owners": ""},
+	}
+
+	var paths []string
+	for _, file := range filterFilesByOwner(files, "@docs") {
+		paths = append(paths, file["Path"])
+	}
+	if !reflect.DeepEqual(paths, []string{"docs/a.md", "src/b.go"}) {
+		t.Errorf("Expected the files owned by @docs without regard to case, got %v", paths)
+	}
+	if got := filterFilesByOwner(files, ""); len(got) != 3 {
+		t.Errorf("Expected every file without an owner filter, got %d", len(got))
+	}
+
+	expected := []OwnerFilter{
+		{Owner: "@docs", Count: 2},
+		{Owner: "@nobody", Count: 0, Active: true},
+		{Owner: "@org/backend", Count: 1},
+	}
+	if got := buildOwnerFilters(files, "@nobody"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected filters %+v, got %+v", expected, got)
+	}
+}
+
+func TestParseViewOptionsOwner(t *testing.T) {
+	opts, err := parseViewOptions(url.Values{"owner": {"@org/team"}})
+	if err != nil {
+		t.Fatalf("parseViewOptions failed: %v", err)
+	}
+	if opts.Owner != "@org/team" || opts.querySuffix() != "&owner=%40org%2Fteam" {
+		t.Errorf("Expected the owner filter to round-trip, got %q and %q", opts.Owner, opts.querySuffix())
+	}
+
+	if _, err := parseViewOptions(url.Values{"owner": {"@a @b"}}); err == nil {
+		t.Error("Expected an error for an owner with spaces")
+	}
+}
+
+// TestHandleDiffViewOwnerFilter tests that the file list can be restricted to
+// the files an owner has in the target's CODEOWNERS, and that the filter is
+// only offered when there's such a file
+func TestHandleDiffViewOwnerFilter(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `[{{range .OwnerFilters}}{{.Owner}}={{.Count}};{{end}}#{{range .Files}}{{.Path}}[{{.Owners}}];{{end}}#{{if .OwnerFilterUnavailable}}unavailable{{end}}]`)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	get := func(query string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main"+query, nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	// Without a CODEOWNERS file there's nothing to filter by
+	if body := get(""); !strings.Contains(body, "[#test.txt[];#]") {
+		t.Errorf("Expected no owner filter, got %s", body)
+	}
+	if body := get("&owner=@docs"); !strings.Contains(body, "[#test.txt[];#unavailable]") {
+		t.Errorf("Expected the owner filter to be ignored, got %s", body)
+	}
+
+	// Owners come from the target, so the feature branch can't reassign its own files
+	writeFile(t, repoDir, ".github/CODEOWNERS", "* @everyone\ndocs/ @docs\n")
+	runGit(t, repoDir, "add", ".github/CODEOWNERS")
+	runGit(t, repoDir, "commit", "-m", "Add code owners")
+	runGit(t, repoDir, "checkout", "feature")
+	runGit(t, repoDir, "merge", "main")
+	writeFile(t, repoDir, "docs/guide.md", "guide\n")
+	writeFile(t, repoDir, ".github/CODEOWNERS", "* @feature\n")
+	runGit(t, repoDir, "add", ".")
+	runGit(t, repoDir, "commit", "-m", "Add a guide")
+	runGit(t, repoDir, "checkout", "main")
+
+	if body := get(""); !strings.Contains(body, "[@docs=1;@everyone=2;#.github/CODEOWNERS[@everyone];docs/guide.md[@docs];test.txt[@everyone];#]") {
+		t.Errorf("Expected the owners of main, got %s", body)
+	}
+	if body := get("&owner=@DOCS"); !strings.Contains(body, "#docs/guide.md[@docs];#]") {
+		t.Errorf("Expected only the files of @docs, got %s", body)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// ErrCommitNotFound is returned when a comparison names a commit its
+// repository doesn't have, such as a link whose repo parameter was swapped
+// for another repository's
+var ErrCommitNotFound = errors.New("commit not found")
+
+// verifyCommitsExist checks that the comparison's commits are commits of
+// repo, returning ErrCommitNotFound naming the first one that isn't. Review
+// states are keyed by repository and commits, so a mismatched pair would
+// otherwise fail in git with a confusing message, or be recorded for a
+// comparison that can't exist. The empty tree a root commit is reviewed
+// against is taken as a target, as every repository has it.
+func verifyCommitsExist(repo *git.Repository, c comparison) error {
+	for _, commit := range []string{c.SourceCommit, c.TargetCommit} {
+		if commit == git.EmptyTreeHash && commit == c.TargetCommit {
+			continue
+		}
+		exists, err := repo.CommitExists(commit)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w in repository %s: %s", ErrCommitNotFound, c.RepoPath, commit)
+		}
+	}
+	return nil
+}
+
+// resolveCommits replaces the comparison's commits, which may be abbreviated,
+// with their full hashes, as review states are keyed by them. It returns
+// ErrCommitNotFound naming the first one that names no commit of repo. The
+// empty tree a root commit is reviewed against is kept as a target.
+func resolveCommits(repo *git.Repository, c *comparison) error {
+	for _, commit := range []*string{&c.SourceCommit, &c.TargetCommit} {
+		if *commit == git.EmptyTreeHash && commit == &c.TargetCommit {
+			continue
+		}
+		hash, exists, err := repo.ResolveCommit(*commit)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w in repository %s: %s", ErrCommitNotFound, c.RepoPath, *commit)
+		}
+		*commit = hash
+	}
+	return nil
+}
+
+// verifyComparisonCommits checks that the comparison's commits are commits of
+// its registered repository, see verifyCommitsExist
+func (s *Server) verifyComparisonCommits(c comparison) error {
+	repo, exists, err := s.GetRepository(c.RepoPath)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("repository not found: %s", c.RepoPath)
+	}
+	return verifyCommitsExist(repo, c)
+}
+
+// commitErrorStatus maps an error verifying a comparison's commits to an HTTP status
+func commitErrorStatus(err error) int {
+	if errors.Is(err, ErrCommitNotFound) {
+		return http.StatusNotFound
+	}
+	return repositoryErrorStatus(err)
+}
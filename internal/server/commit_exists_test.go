@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestMismatchedRepositoryCommits tests that the diff and review state
+// handlers refuse commits of another repository with a clear error, leaving
+// the review state alone
+func TestMismatchedRepositoryCommits(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	repoDir := setupGitRepo(t)
+	otherDir := setupGitRepo(t)
+	runGit(t, otherDir, "checkout", "feature")
+	writeFile(t, otherDir, "other.txt", "only in the other repository\n")
+	runGit(t, otherDir, "add", "other.txt")
+	runGit(t, otherDir, "commit", "-m", "Diverge")
+	runGit(t, otherDir, "checkout", "main")
+	mockStorage.repositories = []string{repoDir, otherDir}
+
+	// The other repository's feature commit, with this repository's main
+	otherCommit := runGit(t, otherDir, "rev-parse", "feature")
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("source", "feature")
+	query.Set("target", "main")
+	query.Set("source_commit", otherCommit)
+	query.Set("target_commit", runGit(t, repoDir, "rev-parse", "main"))
+	expected := "commit not found in repository " + repoDir + ": " + otherCommit
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+	}{
+		{"ReviewState", "POST", "/api/review-state?" + query.Encode() + "&file=test.txt&status=approved"},
+		{"Complete", "POST", "/api/review-state/complete?" + query.Encode()},
+		{"Description", "POST", "/api/review-state/description?" + query.Encode() + "&description=Notes"},
+		{"Batch", "POST", "/api/review-state/batch?" + query.Encode()},
+		{"ReviewAPI", "POST", "/api/review/approve?" + query.Encode() + "&file=test.txt"},
+		{"Navigation", "GET", "/api/review/next?" + query.Encode() + "&file=test.txt"},
+		{"PinnedDiff", "GET", "/diff?" + query.Encode() + "&pin=1"},
+		{"Rereview", "GET", "/rereview?" + query.Encode()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage.saveCalled = false
+
+			body := strings.NewReader(`[{"path": "test.txt", "status": "approved"}]`)
+			req := httptest.NewRequest(tt.method, tt.target, body)
+			w := httptest.NewRecorder()
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("Expected %q, got %s", expected, w.Body.String())
+			}
+			if mockStorage.saveCalled {
+				t.Error("Expected no review state to be saved")
+			}
+		})
+	}
+
+	// The commits of the right repository are accepted
+	query.Set("repo", otherDir)
+	query.Set("target_commit", runGit(t, otherDir, "rev-parse", "main"))
+	req := httptest.NewRequest("POST", "/api/review-state?"+query.Encode()+"&file=other.txt&status=approved", nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther || !mockStorage.saveCalled {
+		t.Errorf("Expected the review to be saved, got %d: %s", w.Code, w.Body.String())
+	}
+}
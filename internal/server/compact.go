@@ -0,0 +1,54 @@
+package server
+
+import "strings"
+
+// returnToList is the value of the return parameter of file reviews sent from
+// the file list, which come back to the list instead of opening the file
+const returnToList = "list"
+
+// compactLines keeps only the added and removed lines of a parsed file diff,
+// dropping headers, hunk headers and context for the compact view
+func compactLines(lines []diffLine) []diffLine {
+	compact := make([]diffLine, 0, len(lines))
+	for _, line := range lines {
+		if line.Kind == lineKindAdded || line.Kind == lineKindRemoved {
+			compact = append(compact, line)
+		}
+	}
+	return compact
+}
+
+// compactFileLines returns the added and removed lines of every listed file of
+// a diff, keyed by path, laid out as the file's own view would: in the given
+// line order and with tabs expanded to tabWidth. Large files are left out, as
+// their diff isn't shown until asked for.
+func compactFileLines(diffText string, files []map[string]string, order string, tabWidth int) map[string][]diffLine {
+	sections := diffSections(diffText)
+
+	lines := make(map[string][]diffLine, len(files))
+	for _, file := range files {
+		path := file["Path"]
+		if file["Large"] == "true" {
+			continue
+		}
+		parsed := parseDiffLines(path, reorderDiffLines(sections[path], order))
+		expandTabs(parsed, tabWidth)
+		lines[path] = compactLines(parsed)
+	}
+	return lines
+}
+
+// diffSections splits a diff into the lines of each file's sections, keyed by path
+func diffSections(diffText string) map[string][]string {
+	sections := make(map[string][]string)
+	path := ""
+	for _, line := range strings.Split(sanitizeUTF8(diffText), "\n") {
+		if p, ok := diffSectionPath(line); ok {
+			path = p
+		}
+		if path != "" {
+			sections[path] = append(sections[path], line)
+		}
+	}
+	return sections
+}
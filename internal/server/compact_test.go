@@ -0,0 +1,137 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCompactLines(t *testing.T) {
+	lines := compactLines(parseDiffLines("main.go", []string{
+		"diff --git a/main.go b/main.go",
+		"--- a/main.go",
+		"+++ b/main.go",
+		"@@ -1,3 +1,3 @@",
+		" package main",
+		"-var x = 1",
+		"+var x = 2",
+		"\\ No newline at end of file",
+		"",
+	}))
+
+	if len(lines) != 2 || lines[0].Text != "-var x = 1" || lines[1].Text != "+var x = 2" {
+		t.Fatalf("Expected only the changed lines, got %v", lines)
+	}
+	// Anchors stay those of the full view, so links to the lines keep working
+	if lines[1].Anchor != lineAnchorPrefix("main.go")+"R2" {
+		t.Errorf("Expected the added line to keep its anchor, got %q", lines[1].Anchor)
+	}
+}
+
+func TestCompactFileLines(t *testing.T) {
+	diffText := strings.Join([]string{
+		"diff --git a/a.go b/a.go",
+		"--- a/a.go",
+		"+++ b/a.go",
+		"@@ -1,2 +1,2 @@",
+		" func a() {",
+		"-\treturn 1",
+		"+\treturn 2",
+		"diff --git a/big.go b/big.go",
+		"--- a/big.go",
+		"+++ b/big.go",
+		"@@ -1 +1 @@",
+		"-old",
+		"+new",
+		"diff --git a/logo.png b/logo.png",
+		"Binary files a/logo.png and b/logo.png differ",
+		"",
+	}, "\n")
+	files := []map[string]string{
+		{"Path": "a.go"},
+		{"Path": "big.go", "Large": "true"},
+		{"Path": "logo.png"},
+	}
+
+	lines := compactFileLines(diffText, files, lineOrderAdditionsFirst, 2)
+
+	if got := lines["a.go"]; len(got) != 2 || got[0].Text != "+  return 2" || got[1].Text != "-  return 1" {
+		t.Errorf("Expected a.go's changes in the line order with tabs expanded, got %v", got)
+	}
+	if _, ok := lines["big.go"]; ok {
+		t.Error("Expected the large file's lines left out")
+	}
+	if got, ok := lines["logo.png"]; !ok || len(got) != 0 {
+		t.Errorf("Expected no lines for the binary file, got %v", got)
+	}
+}
+
+func TestParseViewOptionsCompact(t *testing.T) {
+	opts, err := parseViewOptions(url.Values{"compact": {"1"}})
+	if err != nil {
+		t.Fatalf("parseViewOptions failed: %v", err)
+	}
+	if !opts.Compact || opts.querySuffix() != "&compact=1" {
+		t.Errorf("Expected the compact mode to round-trip, got %v and %q", opts.Compact, opts.querySuffix())
+	}
+}
+
+// TestHandleDiffViewCompact tests that the compact mode lists the changed
+// lines under each file and drops the context of a file's own view
+func TestHandleDiffViewCompact(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range $path, $lines := .CompactLines}}{{$path}}:{{range $lines}}{{.Text}}|{{end}}{{end}}#{{range .DiffLines}}{{.Text}}|{{end}}{{.ViewQuery}}`)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	base := "/diff?repo=" + url.QueryEscape(repoDir) + "&source=feature&target=main"
+	get := func(target string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	if body := get(base + "&compact=1"); !strings.Contains(body, "test.txt:&#43;new line|#") || !strings.Contains(body, "&amp;compact=1") {
+		t.Errorf("Expected the file list to show the added line and keep the mode in links, got %s", body)
+	}
+	if body := get(base); strings.Contains(body, "test.txt:") {
+		t.Errorf("Expected no compact lines without the option, got %s", body)
+	}
+	if body := get(base + "&file=test.txt&compact=1"); !strings.Contains(body, ">#&#43;new line|&amp;compact=1") {
+		t.Errorf("Expected only the added line in the file view, got %s", body)
+	}
+}
+
+// TestHandleReviewStateReturnToList tests that file reviews sent from the
+// compact file list come back to the list
+func TestHandleReviewStateReturnToList(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	query := reviewComparisonQuery(t)
+	mockStorage.repositories = []string{query.Get("repo")}
+	query.Set("file", "test.txt")
+	query.Set("status", "approved")
+	query.Set("return", returnToList)
+
+	form := url.Values{"compact": {"1"}}
+	req := httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.handleReviewState(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+	if strings.Contains(location, "file=") || !strings.Contains(location, "compact=1") {
+		t.Errorf("Expected a redirect to the compact file list, got %s", location)
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os/user"
+	"time"
+
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/models"
+)
+
+// WithCompletionRequiringAllFiles only lets a comparison be signed off as
+// reviewed once every file has a status
+func WithCompletionRequiringAllFiles() Option {
+	return func(s *Server) {
+		s.completionRequiresAllFiles = true
+	}
+}
+
+// completionResponse describes a signed off comparison
+type completionResponse struct {
+	CompletedBy string    `json:"completed_by"`
+	CompletedAt time.Time `json:"completed_at"`
+	Redirect    string    `json:"redirect"`
+	// Note is the notes ref the review summary was written to, see WithGitNotes
+	Note string `json:"note,omitempty"`
+}
+
+// handleCompleteReview signs off a whole comparison as reviewed by the current
+// user, independently of the statuses of its files
+func (s *Server) handleCompleteReview(w http.ResponseWriter, r *http.Request) {
+	c := comparisonFromRequest(r)
+	if !c.complete() {
+		s.respondError(w, r, "Missing Parameters", "Missing required parameters for completing the review", http.StatusBadRequest)
+		return
+	}
+
+	paths, statuses, err := s.loadReviewFiles(c)
+	if err != nil {
+		s.respondError(w, r, "Review State Error", err.Error(), diffErrorStatus(err))
+		return
+	}
+
+	if s.completionRequiresAllFiles {
+		if pending := len(paths) - len(statuses); pending > 0 {
+			s.respondError(w, r, "Review Incomplete", fmt.Sprintf("%d of %d files still need a review before the comparison can be completed", pending, len(paths)), http.StatusConflict)
+			return
+		}
+	}
+
+	unlock := s.reviewLocks.lock(c)
+	reviewState, err := s.storage.LoadReviewState(c.RepoPath, c.User, c.SourceBranch, c.TargetBranch, c.SourceCommit, c.TargetCommit)
+	if err != nil {
+		unlock()
+		s.respondError(w, r, "Review State Error", fmt.Sprintf("Failed to load review state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	reviewState.Complete(reviewerName(c.User), time.Now().UTC())
+	err = s.storage.SaveReviewState(reviewState, c.RepoPath, c.User)
+	unlock()
+	if err != nil {
+		s.respondError(w, r, "Review State Error", fmt.Sprintf("Failed to save review state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// The sign-off is saved either way, so a note that can't be written is only logged
+	var note string
+	if s.gitNotes != "" {
+		if err := s.writeReviewNote(c, reviewState, paths, statuses); err != nil {
+			log.Printf("Warning: %v", err)
+		} else {
+			note = git.ReviewNotesRef
+		}
+	}
+
+	redirectPath := s.url(fmt.Sprintf("/diff?repo=%s&source=%s&target=%s&source_commit=%s&target_commit=%s",
+		url.QueryEscape(c.RepoPath),
+		url.QueryEscape(c.SourceBranch),
+		url.QueryEscape(c.TargetBranch),
+		url.QueryEscape(c.SourceCommit),
+		url.QueryEscape(c.TargetCommit)))
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, completionResponse{
+			CompletedBy: reviewState.CompletedBy,
+			CompletedAt: *reviewState.CompletedAt,
+			Redirect:    redirectPath,
+			Note:        note,
+		})
+		return
+	}
+
+	http.Redirect(w, r, redirectPath, http.StatusSeeOther)
+}
+
+// reviewerName returns the name a sign-off is recorded under: the
+// authenticated user or, in single-user mode, the local account running diffty
+func reviewerName(authUser string) string {
+	if authUser != "" {
+		return authUser
+	}
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	return "local user"
+}
+
+// completionBadge returns the sign-off shown on the diff view, or an empty
+// string if the comparison wasn't completed
+func completionBadge(state *models.ReviewState) string {
+	if !state.IsCompleted() {
+		return ""
+	}
+	return fmt.Sprintf("Reviewed by %s on %s", state.CompletedBy, state.CompletedAt.Format("2006-01-02"))
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// completeReview posts to the completion endpoint for the comparison in query
+func completeReview(t *testing.T, server *Server, query string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/api/review-state/complete?"+query, nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleCompleteReview(t *testing.T) {
+	server, mockStorage, query := setupReviewAPITest(t)
+
+	w := completeReview(t, server, query.Encode())
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var resp completionResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.CompletedBy == "" || resp.CompletedAt.IsZero() {
+		t.Errorf("Expected a signature, got %+v", resp)
+	}
+
+	state := mockStorage.reviewState
+	if !mockStorage.saveCalled || !state.IsCompleted() || state.CompletedBy != resp.CompletedBy {
+		t.Errorf("Expected the completion to be saved, got %+v", state)
+	}
+
+	// With authentication, the sign-off carries the user's name
+	server, _, query = setupReviewAPITest(t)
+	WithAuthTokens(map[string]string{"alice": "secret"})(server)
+
+	req := httptest.NewRequest("POST", "/api/review-state/complete?"+query.Encode(), nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"completed_by":"alice"`) {
+		t.Errorf("Expected alice's sign-off, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleCompleteReviewRequiringAllFiles(t *testing.T) {
+	server, mockStorage, query := setupReviewAPITest(t)
+	WithCompletionRequiringAllFiles()(server)
+
+	if w := completeReview(t, server, query.Encode()); w.Code != http.StatusConflict {
+		t.Fatalf("Expected status code %d with unreviewed files, got %d", http.StatusConflict, w.Code)
+	}
+	if mockStorage.reviewState != nil && mockStorage.reviewState.IsCompleted() {
+		t.Error("Expected the comparison not to be completed")
+	}
+
+	// Skipping counts as acting on a file
+	for _, file := range []string{"a.txt", "b.txt", "test.txt"} {
+		if code, _ := doReviewAPI(t, server, "POST", "/api/review/skip", query, file); code != http.StatusOK {
+			t.Fatalf("Failed to skip %s: %d", file, code)
+		}
+	}
+
+	if w := completeReview(t, server, query.Encode()); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d once every file was acted on, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestCompletionBadge(t *testing.T) {
+	state := &models.ReviewState{}
+	if badge := completionBadge(state); badge != "" {
+		t.Errorf("Expected no badge before completion, got %q", badge)
+	}
+
+	state.Complete("alice", time.Date(2024, 3, 1, 15, 4, 5, 0, time.UTC))
+	if badge := completionBadge(state); badge != "Reviewed by alice on 2024-03-01" {
+		t.Errorf("Unexpected badge %q", badge)
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrStaleCommits is returned when a review is submitted for commits its
+// branches have moved away from since the page was loaded
+var ErrStaleCommits = errors.New("the compared branches moved")
+
+// WithCurrentCommitCheck makes saving a file review check that the submitted
+// commits are still the tips of their branches, refusing the save with a 409
+// when a branch moved since the page was loaded. Without it the review is
+// recorded against the submitted commit pair, whichever it is. Pinned views
+// review exactly the commits they name and aren't checked.
+func WithCurrentCommitCheck() Option {
+	return func(s *Server) {
+		s.checkCurrentCommits = true
+	}
+}
+
+// verifyCurrentCommits checks that the comparison's commits are still the tips
+// of its branches, returning ErrStaleCommits naming the branch that moved
+func (s *Server) verifyCurrentCommits(c comparison) error {
+	repo, exists, err := s.GetRepository(c.RepoPath)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("repository not found: %s", c.RepoPath)
+	}
+
+	sourceCommit, err := repo.GetBranchCommitHash(c.SourceBranch)
+	if err != nil {
+		return err
+	}
+	targetCommit, err := targetCommitOf(repo, c.SourceBranch, sourceCommit, c.TargetBranch)
+	if err != nil {
+		return err
+	}
+
+	for _, side := range []struct{ branch, commit, current string }{
+		{c.SourceBranch, c.SourceCommit, sourceCommit},
+		{c.TargetBranch, c.TargetCommit, targetCommit},
+	} {
+		// Submitted hashes can be abbreviated
+		if !strings.HasPrefix(side.current, side.commit) {
+			return fmt.Errorf("%w: %s is at %s now, not %s; reload the page to review the current commits",
+				ErrStaleCommits, side.branch, s.ShortHash(side.current), s.ShortHash(side.commit))
+		}
+	}
+	return nil
+}
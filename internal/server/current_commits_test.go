@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandleReviewStateCurrentCommits(t *testing.T) {
+	repoDir := setupGitRepo(t)
+	staleSource := strings.TrimSpace(runGit(t, repoDir, "rev-parse", "feature"))
+	targetCommit := strings.TrimSpace(runGit(t, repoDir, "rev-parse", "main"))
+
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "test.txt", "initial content\nnew line\nanother line\n")
+	runGit(t, repoDir, "commit", "-am", "Move feature")
+	runGit(t, repoDir, "checkout", "main")
+	currentSource := strings.TrimSpace(runGit(t, repoDir, "rev-parse", "feature"))
+
+	tests := []struct {
+		name         string
+		check        bool
+		sourceCommit string
+		pin          bool
+		wantStatus   int
+	}{
+		{name: "stale commits", check: true, sourceCommit: staleSource, wantStatus: http.StatusConflict},
+		{name: "abbreviated stale commit", check: true, sourceCommit: staleSource[:7], wantStatus: http.StatusConflict},
+		{name: "current commits", check: true, sourceCommit: currentSource, wantStatus: http.StatusSeeOther},
+		{name: "abbreviated current commit", check: true, sourceCommit: currentSource[:7], wantStatus: http.StatusSeeOther},
+		{name: "pinned stale commits", check: true, sourceCommit: staleSource, pin: true, wantStatus: http.StatusSeeOther},
+		{name: "check disabled", sourceCommit: staleSource, wantStatus: http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, mockStorage := setupTestServer(t)
+			mockStorage.repositories = []string{repoDir}
+			mockStorage.reviewState = nil
+			if tt.check {
+				WithCurrentCommitCheck()(server)
+			}
+
+			query := url.Values{
+				"repo":          {repoDir},
+				"source":        {"feature"},
+				"target":        {"main"},
+				"source_commit": {tt.sourceCommit},
+				"target_commit": {targetCommit},
+				"file":          {"test.txt"},
+				"status":        {"approved"},
+			}
+			form := url.Values{}
+			if tt.pin {
+				form.Set("pin", "1")
+			}
+			req := httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			server.handleReviewState(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusConflict {
+				return
+			}
+			if mockStorage.saveCalled {
+				t.Error("A review of stale commits should not be saved")
+			}
+			if body := w.Body.String(); !strings.Contains(body, "feature") || !strings.Contains(body, "reload") {
+				t.Errorf("Expected the error to name the moved branch and ask for a reload, got %q", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// Kinds of rendered diff lines
+const (
+	lineKindHeader  = "header"
+	lineKindHunk    = "hunk"
+	lineKindContext = "context"
+	lineKindAdded   = "added"
+	lineKindRemoved = "removed"
+	lineKindNote    = "note" // "\ No newline at end of file"
+)
+
+// diffLine is a single line of a rendered file diff with its line numbers.
+// OldLine and NewLine are zero when the line doesn't exist on that side.
+type diffLine struct {
+	Text    string
+	Kind    string
+	OldLine int
+	NewLine int
+	// Anchor is the line's element ID, empty for lines without a line number
+	Anchor string
+	// Hunk is the range of a hunk header line ("-1,3 +1,4"), which identifies the hunk for hunk reviews
+	Hunk string
+	// HunkStatus is the review status of a hunk header's hunk, empty when it can't be reviewed on its own
+	HunkStatus string
+}
+
+// String returns the raw diff line
+func (l diffLine) String() string {
+	return l.Text
+}
+
+// parseDiffLines numbers the lines of a file diff and gives every numbered
+// line an anchor derived from the file path and its line number. Anchors only
+// depend on the diff content, so they stay the same across renders of the same
+// commit pair and links to them can be shared.
+func parseDiffLines(filePath string, lines []string) []diffLine {
+	prefix := lineAnchorPrefix(filePath)
+
+	parsed := make([]diffLine, 0, len(lines))
+	inHunk := false
+	oldLine, newLine := 0, 0
+	// parents is the number of prefix columns of a hunk's lines, one per
+	// parent: more than one in a combined diff of a merge commit
+	parents := 1
+	for _, text := range lines {
+		line := diffLine{Text: text, Kind: lineKindHeader}
+
+		switch {
+		case strings.HasPrefix(text, "diff --git "):
+			inHunk = false
+		case isCombinedDiffHeader(text):
+			inHunk = false
+		case strings.HasPrefix(text, "@@"):
+			line.Kind = lineKindHunk
+			line.Hunk, _ = hunkRange(text)
+			parents = len(text) - len(strings.TrimLeft(text, "@")) - 1
+			if start, ok := parseHunkStart(text); ok {
+				oldLine, newLine = start[0], start[1]
+				inHunk = true
+			}
+		case !inHunk:
+			// File headers, including the "---" and "+++" lines
+		case parents > 1 && text != "" && !strings.HasPrefix(text, "\\"):
+			// Old line numbers follow the first parent, as git's own
+			// first-parent diff would
+			columns := text[:min(parents, len(text))]
+			inResult := !strings.Contains(columns, "-")
+			inFirstParent := columns[0] == '-' || (inResult && columns[0] == ' ')
+			switch {
+			case !inResult:
+				line.Kind = lineKindRemoved
+			case strings.Contains(columns, "+"):
+				line.Kind = lineKindAdded
+			default:
+				line.Kind = lineKindContext
+			}
+			if inFirstParent {
+				line.OldLine = oldLine
+				line.Anchor = fmt.Sprintf("%sL%d", prefix, oldLine)
+				oldLine++
+			}
+			if inResult {
+				line.NewLine = newLine
+				line.Anchor = fmt.Sprintf("%sR%d", prefix, newLine)
+				newLine++
+			}
+		case strings.HasPrefix(text, "+"):
+			line.Kind = lineKindAdded
+			line.NewLine = newLine
+			line.Anchor = fmt.Sprintf("%sR%d", prefix, newLine)
+			newLine++
+		case strings.HasPrefix(text, "-"):
+			line.Kind = lineKindRemoved
+			line.OldLine = oldLine
+			line.Anchor = fmt.Sprintf("%sL%d", prefix, oldLine)
+			oldLine++
+		case strings.HasPrefix(text, "\\"):
+			line.Kind = lineKindNote
+		case text == "":
+			// The trailing newline of the diff output
+			line.Kind = lineKindContext
+		default:
+			line.Kind = lineKindContext
+			line.OldLine = oldLine
+			line.NewLine = newLine
+			line.Anchor = fmt.Sprintf("%sR%d", prefix, newLine)
+			oldLine++
+			newLine++
+		}
+
+		parsed = append(parsed, line)
+	}
+
+	return parsed
+}
+
+// isCombinedDiffHeader reports whether line starts a file of a combined diff
+func isCombinedDiffHeader(line string) bool {
+	_, ok := git.CombinedDiffPath(line)
+	return ok
+}
+
+// lineAnchorPrefix returns the anchor prefix of a file's lines. The path is
+// hashed so any file name yields a valid, fixed-length element ID.
+func lineAnchorPrefix(filePath string) string {
+	sum := sha256.Sum256([]byte(filePath))
+	return "diff-" + hex.EncodeToString(sum[:]) + "-"
+}
+
+// parseHunkStart returns the first old and new line numbers of a hunk header
+// such as "@@ -10,7 +12,8 @@ func main() {". In the header of a combined diff,
+// "@@@ -10,7 -10,6 +12,8 @@@", the old line is the first parent's.
+func parseHunkStart(header string) ([2]int, bool) {
+	var start [2]int
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return start, false
+	}
+
+	ranges := []string{fields[1], fields[2]}
+	for _, field := range fields[2:] {
+		if strings.HasPrefix(field, "+") {
+			ranges[1] = field
+			break
+		}
+	}
+	for i, field := range ranges {
+		number, _, _ := strings.Cut(field[1:], ",")
+		if _, err := fmt.Sscanf(number, "%d", &start[i]); err != nil {
+			return start, false
+		}
+	}
+
+	return start, true
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+func TestParseDiffLines(t *testing.T) {
+	lines := []string{
+		"diff --git a/main.go b/main.go",
+		"index 1111111..2222222 100644",
+		"--- a/main.go",
+		"+++ b/main.go",
+		"@@ -10,3 +10,4 @@ func main() {",
+		" context",
+		"-removed",
+		"+added1",
+		"+added2",
+		" tail",
+		"\\ No newline at end of file",
+		"",
+	}
+
+	parsed := parseDiffLines("main.go", lines)
+	prefix := lineAnchorPrefix("main.go")
+
+	expected := []diffLine{
+		{Kind: lineKindHeader},
+		{Kind: lineKindHeader},
+		{Kind: lineKindHeader},
+		{Kind: lineKindHeader},
+		{Kind: lineKindHunk, Hunk: "-10,3 +10,4"},
+		{Kind: lineKindContext, OldLine: 10, NewLine: 10, Anchor: prefix + "R10"},
+		{Kind: lineKindRemoved, OldLine: 11, Anchor: prefix + "L11"},
+		{Kind: lineKindAdded, NewLine: 11, Anchor: prefix + "R11"},
+		{Kind: lineKindAdded, NewLine: 12, Anchor: prefix + "R12"},
+		{Kind: lineKindContext, OldLine: 12, NewLine: 13, Anchor: prefix + "R13"},
+		{Kind: lineKindNote},
+		{Kind: lineKindContext},
+	}
+
+	if len(parsed) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d", len(expected), len(parsed))
+	}
+
+	for i, want := range expected {
+		want.Text = lines[i]
+		if parsed[i] != want {
+			t.Errorf("Line %d: expected %+v, got %+v", i, want, parsed[i])
+		}
+	}
+
+	// Anchors are deterministic and depend on the file
+	if again := parseDiffLines("main.go", lines); again[5].Anchor != parsed[5].Anchor {
+		t.Errorf("Expected stable anchors, got %s and %s", parsed[5].Anchor, again[5].Anchor)
+	}
+	if other := parseDiffLines("other.go", lines); other[5].Anchor == parsed[5].Anchor {
+		t.Errorf("Expected anchors to differ between files, got %s for both", other[5].Anchor)
+	}
+}
+
+func TestHandleDiffViewLineAnchors(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .DiffLines}}{{if .Anchor}}{{.Anchor}}={{.Text}};{{end}}{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	render := func() string {
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&file=test.txt", nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	first := render()
+	prefix := lineAnchorPrefix("test.txt")
+	if !strings.Contains(first, prefix+"R1= initial content;") || !strings.Contains(first, prefix+"R2=&#43;new line;") {
+		t.Errorf("Expected anchors for both lines, got %s", first)
+	}
+
+	if second := render(); second != first {
+		t.Errorf("Expected identical anchors across renders, got %s and %s", first, second)
+	}
+}
+
+// TestParseDiffLinesCombined tests the numbering of a combined diff of a merge,
+// whose old line numbers follow the first parent
+func TestParseDiffLinesCombined(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "merge.diff"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	lines := strings.Split(git.ExtractFileDiff(string(content), "app.txt"), "\n")
+	parsed := parseDiffLines("app.txt", lines)
+	prefix := lineAnchorPrefix("app.txt")
+
+	expected := []diffLine{
+		{Kind: lineKindHeader},
+		{Kind: lineKindHeader},
+		{Kind: lineKindHeader},
+		{Kind: lineKindHeader},
+		{Kind: lineKindHunk},
+		{Kind: lineKindContext, OldLine: 1, NewLine: 1, Anchor: prefix + "R1"},
+		{Kind: lineKindRemoved, OldLine: 2, Anchor: prefix + "L2"},
+		{Kind: lineKindRemoved},
+		{Kind: lineKindAdded, NewLine: 2, Anchor: prefix + "R2"},
+		{Kind: lineKindContext, OldLine: 3, NewLine: 3, Anchor: prefix + "R3"},
+		{Kind: lineKindContext, OldLine: 4, NewLine: 4, Anchor: prefix + "R4"},
+		{Kind: lineKindContext, OldLine: 5, NewLine: 5, Anchor: prefix + "R5"},
+		{Kind: lineKindContext},
+	}
+
+	if len(parsed) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d: %q", len(expected), len(parsed), lines)
+	}
+	for i, want := range expected {
+		want.Text = lines[i]
+		if parsed[i] != want {
+			t.Errorf("Line %d: expected %+v, got %+v", i, want, parsed[i])
+		}
+	}
+
+	// A line added by the second parent has no first parent line number
+	notes := parseDiffLines("notes.md", strings.Split(git.ExtractFileDiff(string(content), "notes.md"), "\n"))
+	if main, topic := notes[6], notes[7]; main.Kind != lineKindAdded || main.OldLine != 2 || main.NewLine != 2 ||
+		topic.Kind != lineKindAdded || topic.OldLine != 0 || topic.NewLine != 3 {
+		t.Errorf("Unexpected numbering of merged additions: %+v, %+v", main, topic)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// dirtyWorkingTreeTTL is how long a working tree's uncommitted changes are
+// remembered, sparing a git status of large trees on every page of a review
+const dirtyWorkingTreeTTL = 10 * time.Second
+
+// dirtyWorkingTrees caches whether the working trees of repositories have
+// uncommitted changes
+type dirtyWorkingTrees struct {
+	mu      sync.Mutex
+	entries map[string]dirtyWorkingTreeEntry
+	// now returns the current time, swapped in tests
+	now func() time.Time
+}
+
+// dirtyWorkingTreeEntry is the cached state of a working tree
+type dirtyWorkingTreeEntry struct {
+	dirty   bool
+	expires time.Time
+}
+
+// get reports whether the working tree of repo has uncommitted changes,
+// asking git when that isn't cached or expired. Failures are logged and
+// report false without being cached, as the note is informational.
+func (d *dirtyWorkingTrees) get(repo *git.Repository) bool {
+	now := time.Now()
+	if d.now != nil {
+		now = d.now()
+	}
+
+	d.mu.Lock()
+	entry, ok := d.entries[repo.Path]
+	d.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.dirty
+	}
+
+	dirty, err := repo.IsDirty()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return false
+	}
+
+	d.mu.Lock()
+	if d.entries == nil {
+		d.entries = make(map[string]dirtyWorkingTreeEntry)
+	}
+	d.entries[repo.Path] = dirtyWorkingTreeEntry{dirty: dirty, expires: now.Add(dirtyWorkingTreeTTL)}
+	d.mu.Unlock()
+
+	return dirty
+}
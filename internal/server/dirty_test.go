@@ -0,0 +1,36 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// TestDirtyWorkingTrees tests that a working tree's uncommitted changes are
+// looked up once until the cached answer expires
+func TestDirtyWorkingTrees(t *testing.T) {
+	now := time.Now()
+	trees := &dirtyWorkingTrees{now: func() time.Time { return now }}
+
+	repoDir := setupGitRepo(t)
+	repo := git.NewRepository(repoDir)
+	if trees.get(repo) {
+		t.Fatal("Expected a clean working tree")
+	}
+
+	writeFile(t, repoDir, "untracked.txt", "new\n")
+	if trees.get(repo) {
+		t.Error("Expected the cached clean state until it expires")
+	}
+
+	now = now.Add(dirtyWorkingTreeTTL)
+	if !trees.get(repo) {
+		t.Error("Expected the untracked file to be noticed once the cache expired")
+	}
+
+	// A repository git can't read isn't cached as clean
+	if trees.get(git.NewRepository(t.TempDir())) {
+		t.Error("Expected an unreadable repository not to be reported dirty")
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultEventPollInterval is how often the events endpoint polls the branches
+// unless WithEventPollInterval says otherwise
+const defaultEventPollInterval = 5 * time.Second
+
+// WithEventPollInterval sets how often the events endpoint checks the compared
+// branches for new commits
+func WithEventPollInterval(d time.Duration) Option {
+	return func(s *Server) {
+		if d > 0 {
+			s.eventPollInterval = d
+		}
+	}
+}
+
+// CloseEvents ends the open event streams and those opened later. Streams
+// never end on their own, so register it with http.Server.RegisterOnShutdown
+// for a shutdown not to wait on them.
+func (s *Server) CloseEvents() {
+	s.closeEvents()
+}
+
+// commitsEvent is the payload of the "commits" event, sent when a compared
+// branch points at a different commit than before
+type commitsEvent struct {
+	SourceCommit string `json:"source_commit"`
+	TargetCommit string `json:"target_commit"`
+}
+
+// handleEvents streams Server-Sent Events for a comparison. It polls the
+// source and target branches and sends a "commits" event whenever either of
+// them moves, so an open page can offer to reload. The commits the page shows
+// can be passed as source_commit and target_commit, so moves that happened
+// before the stream was opened are reported too. The stream ends when the
+// client disconnects or CloseEvents is called.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	c := comparisonFromRequest(r)
+	if c.RepoPath == "" || c.SourceBranch == "" || c.TargetBranch == "" {
+		writeJSONError(w, "Missing Parameters", "Missing required parameters for events", http.StatusBadRequest)
+		return
+	}
+
+	repo, exists, err := s.GetRepository(c.RepoPath)
+	if err != nil {
+		writeJSONError(w, "Repository Error", err.Error(), repositoryErrorStatus(err))
+		return
+	}
+	if !exists {
+		writeJSONError(w, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, "Streaming Unsupported", "The connection doesn't support streaming", http.StatusInternalServerError)
+		return
+	}
+
+	resolve := func() (commitsEvent, error) {
+		sourceCommit, err := repo.GetBranchCommitHash(c.SourceBranch)
+		if err != nil {
+			return commitsEvent{}, err
+		}
+		targetCommit, err := targetCommitOf(repo, c.SourceBranch, sourceCommit, c.TargetBranch)
+		if err != nil {
+			return commitsEvent{}, err
+		}
+		return commitsEvent{SourceCommit: sourceCommit, TargetCommit: targetCommit}, nil
+	}
+
+	current := commitsEvent{SourceCommit: c.SourceCommit, TargetCommit: c.TargetCommit}
+	if current.SourceCommit == "" || current.TargetCommit == "" {
+		if current, err = resolve(); err != nil {
+			writeJSONError(w, "Branch Error", err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// A comment line gets the headers to the client right away
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(s.eventPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.eventsClosed.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// A branch may briefly fail to resolve while it is being updated; try again next time
+		latest, err := resolve()
+		if err != nil || latest == current {
+			continue
+		}
+		current = latest
+
+		data, err := json.Marshal(current)
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: commits\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
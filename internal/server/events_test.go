@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleEvents(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	WithEventPollInterval(10 * time.Millisecond)(server)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	httpServer := httptest.NewServer(server.Router())
+	defer httpServer.Close()
+
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("source", "feature")
+	query.Set("target", "main")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", httpServer.URL+"/api/events?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Push a commit to the source branch once the stream is open
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, ":") {
+		t.Fatalf("Expected the stream to open with a comment, got %q (%v)", line, err)
+	}
+
+	writeFile(t, repoDir, "pushed.txt", "pushed\n")
+	runGit(t, repoDir, "add", "pushed.txt")
+	runGit(t, repoDir, "commit", "-m", "Pushed to main")
+	newTarget := runGit(t, repoDir, "rev-parse", "main")
+
+	var event, data string
+	for data == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Stream ended before an event was sent: %v", err)
+		}
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+		}
+	}
+
+	if event != "commits" || !strings.Contains(data, `"target_commit":"`+newTarget+`"`) {
+		t.Errorf("Expected a commits event with the new target commit, got %s: %s", event, data)
+	}
+}
+
+func TestHandleEventsMissingParameters(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	req := httptest.NewRequest("GET", "/api/events?repo=/test/repo", nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestHandleEventsShutdown tests that shutting the HTTP server down ends the
+// open event streams instead of waiting for them
+func TestHandleEventsShutdown(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	httpServer := httptest.NewUnstartedServer(server.Router())
+	httpServer.Config.RegisterOnShutdown(server.CloseEvents)
+	httpServer.Start()
+	defer httpServer.Close()
+
+	query := url.Values{"repo": {repoDir}, "source": {"feature"}, "target": {"main"}}
+	resp, err := http.Get(httpServer.URL + "/api/events?" + query.Encode())
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, ":") {
+		t.Fatalf("Expected the stream to open with a comment, got %q (%v)", line, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("Expected the shutdown not to wait for the stream, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// maxListedCommits is the most commits of a branch the diff view lists for
+// excluding, newest first
+const maxListedCommits = 200
+
+// ErrUnknownExcludedCommit is returned when an excluded commit isn't one of the
+// compared branch's own commits
+var ErrUnknownExcludedCommit = errors.New("excluded commit isn't part of the branch")
+
+// branchCommit is a commit listed in the diff view's commit picker
+type branchCommit struct {
+	git.Commit
+	Excluded bool
+}
+
+// isExcluded reports whether the view options take commit out of the diff.
+// Excluded hashes can be abbreviated.
+func (o viewOptions) isExcluded(commit git.Commit) bool {
+	if o.NoMerges && commit.Merge {
+		return true
+	}
+	for _, hash := range o.Exclude {
+		if strings.HasPrefix(commit.Hash, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedCommits returns the hashes of the commits the view options take out
+// of the diff, newest first, as commits lists them. Every excluded hash must
+// name one of the commits.
+func excludedCommits(commits []git.Commit, viewOpts viewOptions) ([]string, error) {
+	for _, hash := range viewOpts.Exclude {
+		found := false
+		for _, commit := range commits {
+			found = found || strings.HasPrefix(commit.Hash, hash)
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownExcludedCommit, hash)
+		}
+	}
+
+	var excluded []string
+	for _, commit := range commits {
+		if viewOpts.isExcluded(commit) {
+			excluded = append(excluded, commit.Hash)
+		}
+	}
+	return excluded, nil
+}
+
+// excludeCommits returns what stands in for source in a diff against target
+// once the commits the view options exclude are taken out: the tree of source
+// with their changes reverted, or source itself when none is excluded. It also
+// returns how many commits were excluded.
+func excludeCommits(repo *git.Repository, source, target string, viewOpts viewOptions) (string, int, error) {
+	commits, err := repo.GetCommits(source, target, 0)
+	if err != nil {
+		return "", 0, err
+	}
+	excluded, err := excludedCommits(commits, viewOpts)
+	if err != nil || len(excluded) == 0 {
+		return source, 0, err
+	}
+
+	tree, err := repo.TreeWithout(source, excluded)
+	if err != nil {
+		return "", 0, err
+	}
+	return tree, len(excluded), nil
+}
+
+// setBranchCommits lists the newest commits of the compared branch in the
+// diff view, for picking the ones to exclude. Stashes have no commits of
+// their own, and failing to list them only leaves the picker out.
+func setBranchCommits(data map[string]interface{}, repo *git.Repository, sourceBranch, source, target string, viewOpts viewOptions) {
+	if git.IsStashRef(sourceBranch) {
+		return
+	}
+
+	commits, err := repo.GetCommits(source, target, maxListedCommits)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	if len(commits) == 0 {
+		return
+	}
+
+	listed := make([]branchCommit, 0, len(commits))
+	for _, commit := range commits {
+		listed = append(listed, branchCommit{Commit: commit, Excluded: viewOpts.isExcluded(commit)})
+	}
+	data["BranchCommits"] = listed
+	data["BranchCommitCount"] = len(listed)
+
+	// The picker's own checkboxes replace the current exclusions
+	picker := viewOpts
+	picker.Exclude, picker.NoMerges = nil, false
+	data["CommitPickerParams"] = picker.values()
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+func TestExcludedCommits(t *testing.T) {
+	commits := []git.Commit{
+		{Hash: "cccccccc", Subject: "Merge main", Merge: true},
+		{Hash: "bbbbbbbb", Subject: "Reformat"},
+		{Hash: "aaaaaaaa", Subject: "Add a"},
+	}
+
+	tests := []struct {
+		name     string
+		opts     viewOptions
+		expected string
+		wantErr  bool
+	}{
+		{"none", viewOptions{}, "", false},
+		{"abbreviated", viewOptions{Exclude: []string{"bbbb"}}, "bbbbbbbb", false},
+		{"merges", viewOptions{NoMerges: true, Exclude: []string{"aaaaaaaa"}}, "cccccccc aaaaaaaa", false},
+		{"unknown", viewOptions{Exclude: []string{"dddd"}}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			excluded, err := excludedCommits(commits, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if got := strings.Join(excluded, " "); got != tt.expected {
+				t.Errorf("Expected %q excluded, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestHandleDiffViewExcludedCommits tests that excluded commits' changes are
+// left out of the file list and diffs of a branch review
+func TestHandleDiffViewExcludedCommits(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{.ExcludedCommits}} {{range .Files}}[{{.Path}}]{{end}} {{range .BranchCommits}}{{.Subject}}{{if .Excluded}} (excluded){{end}};{{end}}{{range .DiffLines}}{{.Text}}|{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "a.txt", "a\n")
+	runGit(t, repoDir, "add", "a.txt")
+	runGit(t, repoDir, "commit", "-m", "Add a")
+	writeFile(t, repoDir, "b.txt", "b\n")
+	runGit(t, repoDir, "add", "b.txt")
+	runGit(t, repoDir, "commit", "-m", "Add b")
+	added := runGit(t, repoDir, "rev-parse", "HEAD~1")
+	runGit(t, repoDir, "checkout", "main")
+	mockStorage.repositories = []string{repoDir}
+
+	get := func(params string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main"+params, nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		return w
+	}
+
+	w := get("&exclude=" + added[:10])
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "1 [b.txt][test.txt] Add b;Add a (excluded);Add new line;") {
+		t.Errorf("Expected a.txt to be left out, got %s", body)
+	}
+
+	// Files of the remaining commits still diff normally
+	if body := get("&exclude=" + added + "&file=b.txt").Body.String(); !strings.Contains(body, "|&#43;b|") {
+		t.Errorf("Expected the diff of b.txt, got %s", body)
+	}
+
+	// Without merges there's nothing to exclude
+	if body := get("&no_merges=1").Body.String(); !strings.Contains(body, "0 [a.txt][b.txt][test.txt]") {
+		t.Errorf("Expected every file without merge commits, got %s", body)
+	}
+
+	if w := get("&exclude=" + strings.Repeat("1", 40)); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a commit outside of the branch, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// A commit later commits build on can't be excluded
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "a.txt", "a, edited\n")
+	runGit(t, repoDir, "commit", "-am", "Edit a")
+	runGit(t, repoDir, "checkout", "main")
+	if w := get("&exclude=" + added); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for a conflicting exclusion, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+}
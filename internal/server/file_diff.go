@@ -0,0 +1,158 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// fileDiffResponse is the answer of /api/file-diff: the hunks of a file's diff
+// containing a line of the new version
+type fileDiffResponse struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	// Anchor is the element ID of the line in the diff view, for linking to it
+	Anchor string         `json:"anchor"`
+	Hunks  []fileDiffHunk `json:"hunks"`
+}
+
+// fileDiffHunk is a hunk of a file's diff, header included
+type fileDiffHunk struct {
+	// Range identifies the hunk, as in hunk reviews ("-1,3 +1,4")
+	Range string             `json:"range"`
+	Lines []fileDiffHunkLine `json:"lines"`
+}
+
+// fileDiffHunkLine is a line of a hunk, numbered on the sides it belongs to
+type fileDiffHunkLine struct {
+	Kind    string `json:"kind"`
+	Text    string `json:"text"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+	Anchor  string `json:"anchor,omitempty"`
+}
+
+// handleFileDiff returns the hunks of a file's diff containing a line of the
+// new version, so external systems can link to a location, such as a line a
+// review comment points at. The context parameter widens the hunks with that
+// many unchanged lines around each change, which also brings unchanged lines
+// near a change into the diff.
+func (s *Server) handleFileDiff(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	repoPath := query.Get("repo")
+	filePath := query.Get("file")
+	sourceRef := query.Get("source_commit")
+	if sourceRef == "" {
+		sourceRef = query.Get("source")
+	}
+	targetRef := query.Get("target_commit")
+	if targetRef == "" {
+		targetRef = query.Get("target")
+	}
+	if repoPath == "" || filePath == "" || sourceRef == "" || targetRef == "" || query.Get("line") == "" {
+		writeJSONError(w, "Missing Parameters", "Missing required parameters for a file diff", http.StatusBadRequest)
+		return
+	}
+	if strings.HasPrefix(sourceRef, "-") || strings.HasPrefix(targetRef, "-") {
+		writeJSONError(w, "Invalid Ref", "Refs can't start with a dash", http.StatusBadRequest)
+		return
+	}
+
+	line, err := strconv.Atoi(query.Get("line"))
+	if err != nil || line < 1 {
+		writeJSONError(w, "Invalid Line", fmt.Sprintf("Invalid line number: %s", query.Get("line")), http.StatusBadRequest)
+		return
+	}
+
+	opts := s.diffOptions()
+	if context := query.Get("context"); context != "" {
+		opts.ContextLines, err = strconv.Atoi(context)
+		if err != nil {
+			writeJSONError(w, "Invalid Context", fmt.Sprintf("Invalid context lines: %s", context), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		writeJSONError(w, "Invalid Context", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo, exists, err := s.GetRepository(repoPath)
+	if err != nil {
+		writeJSONError(w, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
+		return
+	}
+	if !exists {
+		writeJSONError(w, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	diffText, err := repo.GetFileDiffWithOptions(sourceRef, targetRef, filePath, opts)
+	if err != nil {
+		writeJSONError(w, "Diff Error", err.Error(), diffErrorStatus(err))
+		return
+	}
+
+	diffLines := parseDiffLines(filePath, strings.Split(sanitizeUTF8(diffText), "\n"))
+	hunks := hunksAtLine(diffLines, line)
+	if len(hunks) == 0 {
+		writeJSONError(w, "Not Found", fmt.Sprintf("Line %d of %s is not part of the diff", line, filePath), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fileDiffResponse{
+		File:   filePath,
+		Line:   line,
+		Anchor: fmt.Sprintf("%sR%d", lineAnchorPrefix(filePath), line),
+		Hunks:  hunks,
+	})
+}
+
+// hunksAtLine returns the hunks of a parsed file diff holding line of the new
+// version, as an added or unchanged line. Removed lines only exist in the old
+// version, so they never match.
+func hunksAtLine(lines []diffLine, line int) []fileDiffHunk {
+	var hunks []fileDiffHunk
+	var current *fileDiffHunk
+	found := false
+
+	flush := func() {
+		if current != nil && found {
+			hunks = append(hunks, *current)
+		}
+		current, found = nil, false
+	}
+
+	for _, l := range lines {
+		switch {
+		case l.Kind == lineKindHunk:
+			flush()
+			current = &fileDiffHunk{Range: l.Hunk}
+		case current == nil:
+			// File headers before the first hunk
+			continue
+		case l.Kind == lineKindHeader:
+			// The next file's headers end the hunk
+			flush()
+			continue
+		case l.Kind == lineKindContext && l.Text == "":
+			// The trailing newline of the diff output
+			continue
+		}
+
+		if l.NewLine == line && (l.Kind == lineKindAdded || l.Kind == lineKindContext) {
+			found = true
+		}
+		current.Lines = append(current.Lines, fileDiffHunkLine{
+			Kind:    l.Kind,
+			Text:    l.Text,
+			OldLine: l.OldLine,
+			NewLine: l.NewLine,
+			Anchor:  l.Anchor,
+		})
+	}
+	flush()
+
+	return hunks
+}
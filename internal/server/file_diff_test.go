@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHunksAtLine(t *testing.T) {
+	lines := parseDiffLines("file.txt", []string{
+		"diff --git a/file.txt b/file.txt",
+		"--- a/file.txt",
+		"+++ b/file.txt",
+		"@@ -1,3 +1,3 @@",
+		" one",
+		"-two",
+		"+TWO",
+		" three",
+		"@@ -10,2 +10,3 @@",
+		" ten",
+		"+ten and a half",
+		" eleven",
+		"",
+	})
+
+	tests := []struct {
+		line   int
+		ranges []string
+	}{
+		{1, []string{"-1,3 +1,3"}},
+		{2, []string{"-1,3 +1,3"}},
+		{11, []string{"-10,2 +10,3"}},
+		{12, []string{"-10,2 +10,3"}},
+		// Between the hunks and past the end
+		{5, nil},
+		{13, nil},
+	}
+
+	for _, tt := range tests {
+		hunks := hunksAtLine(lines, tt.line)
+		var ranges []string
+		for _, hunk := range hunks {
+			ranges = append(ranges, hunk.Range)
+		}
+		if fmt.Sprint(ranges) != fmt.Sprint(tt.ranges) {
+			t.Errorf("hunksAtLine(%d) = %v; expected %v", tt.line, ranges, tt.ranges)
+		}
+	}
+
+	hunk := hunksAtLine(lines, 11)[0]
+	if len(hunk.Lines) != 4 || hunk.Lines[0].Kind != lineKindHunk || hunk.Lines[2].Text != "+ten and a half" || hunk.Lines[2].NewLine != 11 {
+		t.Errorf("Expected the hunk header and its three lines, got %+v", hunk.Lines)
+	}
+}
+
+func TestHandleFileDiff(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	repoDir := setupGitRepo(t)
+	var original, changed strings.Builder
+	for i := 1; i <= 30; i++ {
+		fmt.Fprintf(&original, "line %d\n", i)
+		if i == 5 || i == 25 {
+			fmt.Fprintf(&changed, "changed line %d\n", i)
+		} else {
+			fmt.Fprintf(&changed, "line %d\n", i)
+		}
+	}
+	runGit(t, repoDir, "checkout", "main")
+	writeFile(t, repoDir, "long.txt", original.String())
+	runGit(t, repoDir, "add", "long.txt")
+	runGit(t, repoDir, "commit", "-m", "Add long.txt")
+	runGit(t, repoDir, "checkout", "-b", "anchors")
+	writeFile(t, repoDir, "long.txt", changed.String())
+	runGit(t, repoDir, "commit", "-am", "Change long.txt")
+	mockStorage.repositories = []string{repoDir}
+
+	get := func(params string) (*httptest.ResponseRecorder, fileDiffResponse) {
+		req := httptest.NewRequest("GET", "/api/file-diff?repo="+url.QueryEscape(repoDir)+"&source=anchors&target=main&file=long.txt"+params, nil)
+		w := httptest.NewRecorder()
+		server.handleFileDiff(w, req)
+
+		var resp fileDiffResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return w, resp
+	}
+
+	w, resp := get("&line=25")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(resp.Hunks) != 1 || resp.Hunks[0].Range != "-22,7 +22,7" {
+		t.Fatalf("Expected the hunk around line 25, got %+v", resp.Hunks)
+	}
+	if resp.Anchor != lineAnchorPrefix("long.txt")+"R25" {
+		t.Errorf("Expected the anchor of line 25, got %s", resp.Anchor)
+	}
+
+	// Line 15 is far from both changes, unless the context reaches it
+	if w, _ := get("&line=15"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a line outside of the diff, got %d", http.StatusNotFound, w.Code)
+	}
+	w, resp = get("&line=15&context=10")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d with more context, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(resp.Hunks) != 1 || resp.Hunks[0].Range != "-1,30 +1,30" {
+		t.Errorf("Expected a single hunk merging both changes, got %+v", resp.Hunks)
+	}
+
+	for _, params := range []string{"", "&line=0", "&line=abc", "&line=5&context=-1", "&line=5&context=5000"} {
+		if w, _ := get(params); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %q, got %d", http.StatusBadRequest, params, w.Code)
+		}
+	}
+}
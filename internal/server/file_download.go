@@ -0,0 +1,106 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// fileDownloadURL returns the /api/file URL of a file at a ref
+func fileDownloadURL(repoPath, ref, filePath string) string {
+	query := url.Values{}
+	query.Set("repo", repoPath)
+	query.Set("ref", ref)
+	query.Set("path", filePath)
+	return "/api/file?" + query.Encode()
+}
+
+// setFileDownloads links the diff view to the old version of a file at
+// targetRef and its new version at sourceRef, leaving out the side an added or
+// deleted file doesn't exist on
+func setFileDownloads(data map[string]interface{}, repoPath, sourceRef, targetRef, oldPath, filePath, diffText string) {
+	changeType := ""
+	for _, change := range parseChangeTypes(diffText) {
+		if change.Path == filePath {
+			changeType = change.ChangeType
+		}
+	}
+	if changeType != "A" {
+		data["OldFileURL"] = fileDownloadURL(repoPath, targetRef, oldPath)
+	}
+	if changeType != "D" {
+		data["NewFileURL"] = fileDownloadURL(repoPath, sourceRef, filePath)
+	}
+}
+
+// fileContentType guesses the content type of a file from its extension,
+// falling back to a plain byte stream
+func fileContentType(filePath string) string {
+	if contentType := mime.TypeByExtension(path.Ext(filePath)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// handleFileDownload streams a file as stored at a ref as a download, so
+// either side of a diff can be opened in an editor. Unlike /api/blob, any
+// file of any size is served, always as an attachment.
+func (s *Server) handleFileDownload(w http.ResponseWriter, r *http.Request) {
+	repoPath := r.URL.Query().Get("repo")
+	ref := r.URL.Query().Get("ref")
+	filePath := r.URL.Query().Get("path")
+	if repoPath == "" || ref == "" || filePath == "" {
+		writeJSONError(w, "Missing Parameters", "Missing required parameters for downloading a file", http.StatusBadRequest)
+		return
+	}
+	if strings.HasPrefix(ref, "-") {
+		writeJSONError(w, "Invalid Ref", fmt.Sprintf("Invalid ref: %s", ref), http.StatusBadRequest)
+		return
+	}
+
+	repo, exists, err := s.GetRepository(repoPath)
+	if err != nil {
+		writeJSONError(w, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
+		return
+	}
+	if !exists {
+		writeJSONError(w, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	size, err := repo.GetFileSize(ref, filePath)
+	switch {
+	case errors.Is(err, git.ErrFileNotFound):
+		writeJSONError(w, "Not Found", err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		writeJSONError(w, "File Error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", fileContentType(filePath))
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(filePath)}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+
+	out := &countingWriter{w: w}
+	if err := repo.WriteFileContent(out, ref, filePath); err != nil {
+		// Once the file started streaming, its status can't change anymore
+		if out.n > 0 {
+			log.Printf("Warning: download of %s at %s interrupted: %v", filePath, ref, err)
+			return
+		}
+		w.Header().Del("Content-Disposition")
+		w.Header().Del("Content-Length")
+		writeJSONError(w, "File Error", err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFileContentType(t *testing.T) {
+	tests := map[string]string{
+		"logo.png":  "image/png",
+		"page.html": "text/html; charset=utf-8",
+		"Makefile":  "application/octet-stream",
+		"data.zzz":  "application/octet-stream",
+	}
+
+	for filePath, expected := range tests {
+		if contentType := fileContentType(filePath); contentType != expected {
+			t.Errorf("%s: expected content type %q, got %q", filePath, expected, contentType)
+		}
+	}
+}
+
+func TestHandleFileDownload(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	get := func(ref, filePath string) *httptest.ResponseRecorder {
+		t.Helper()
+		query := url.Values{"repo": {repoDir}, "ref": {ref}, "path": {filePath}}
+		req := httptest.NewRequest("GET", "/api/file?"+query.Encode(), nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	// Both sides of a changed file can be downloaded
+	for ref, expected := range map[string]string{"main": "initial content\n", "feature": "initial content\nnew line\n"} {
+		w := get(ref, "test.txt")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d for %s, got %d: %s", http.StatusOK, ref, w.Code, w.Body.String())
+		}
+		if w.Body.String() != expected {
+			t.Errorf("Expected the file at %s, got %q", ref, w.Body.String())
+		}
+		if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename=test.txt` {
+			t.Errorf("Expected the file as an attachment, got %q", disposition)
+		}
+	}
+
+	// A file missing at the ref isn't found
+	w := get("main", "missing.txt")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a missing file, got %d", http.StatusNotFound, w.Code)
+	}
+	var response map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response["error"] != "Not Found" {
+		t.Errorf("Expected a JSON not found error, got %s", w.Body.String())
+	}
+	if w.Header().Get("Content-Disposition") != "" {
+		t.Error("Expected no attachment for a missing file")
+	}
+
+	// Nor is a directory
+	writeFile(t, repoDir, "dir/nested.txt", "nested\n")
+	runGit(t, repoDir, "add", "dir")
+	runGit(t, repoDir, "commit", "-m", "Add a directory")
+	if w := get("main", "dir"); w.Code != http.StatusNotFound || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("Expected status code %d for a directory, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+
+	if w := get("--output=/tmp/x", "test.txt"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a ref looking like an option, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestHandleDiffViewFileDownloads tests that the file view links to the
+// versions of the file that exist
+func TestHandleDiffViewFileDownloads(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `old={{.OldFileURL}} new={{.NewFileURL}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "added.txt", "added\n")
+	runGit(t, repoDir, "add", "added.txt")
+	runGit(t, repoDir, "commit", "-m", "Add a file")
+	runGit(t, repoDir, "checkout", "main")
+	mockStorage.repositories = []string{repoDir}
+
+	get := func(filePath string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&file="+filePath, nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	if body := get("test.txt"); !strings.Contains(body, "old=/api/file?") || !strings.Contains(body, "new=/api/file?") {
+		t.Errorf("Expected links to both versions of a modified file, got %s", body)
+	}
+	if body := get("added.txt"); !strings.Contains(body, "old= new=/api/file?") {
+		t.Errorf("Expected only a link to the new version of an added file, got %s", body)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// fileHistoryEntry is a comparison of /api/file-history in which the file was reviewed
+type fileHistoryEntry struct {
+	User         string    `json:"user,omitempty"`
+	SourceBranch string    `json:"source"`
+	TargetBranch string    `json:"target"`
+	SourceCommit string    `json:"source_commit"`
+	TargetCommit string    `json:"target_commit"`
+	Status       string    `json:"status"`
+	Reason       string    `json:"reason,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// handleFileHistory lists the stored comparisons of a repository in which a
+// file was reviewed, with its status in each, for finding which reviews
+// touched it. The comparisons are written out as they are found, so the
+// response is streamed rather than built in memory.
+func (s *Server) handleFileHistory(w http.ResponseWriter, r *http.Request) {
+	repoPath := r.URL.Query().Get("repo")
+	filePath := r.URL.Query().Get("path")
+	if repoPath == "" || filePath == "" {
+		writeJSONError(w, "Missing Parameters", "Repository and file path are required", http.StatusBadRequest)
+		return
+	}
+
+	// Stored reviews outlive the repository on disk, so only its registration matters
+	_, exists, err := s.GetRepository(repoPath)
+	if err != nil && !errors.Is(err, ErrRepositoryUnavailable) {
+		writeJSONError(w, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
+		return
+	}
+	if !exists {
+		writeJSONError(w, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	// The response starts with the first comparison, so a scan failing before
+	// any is found can still be reported with an error status
+	encoder := json.NewEncoder(w)
+	started := false
+	start := func() {
+		started = true
+		repo, _ := json.Marshal(repoPath)
+		path, _ := json.Marshal(filePath)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"repo":%s,"path":%s,"comparisons":[`, repo, path)
+	}
+
+	err = s.storage.ScanFileReviews(repoPath, filePath, func(record storage.FileReviewRecord) error {
+		if started {
+			if _, err := w.Write([]byte(",")); err != nil {
+				return err
+			}
+		} else {
+			start()
+		}
+		return encoder.Encode(fileHistoryEntry{
+			User:         record.User,
+			SourceBranch: record.SourceBranch,
+			TargetBranch: record.TargetBranch,
+			SourceCommit: record.SourceCommit,
+			TargetCommit: record.TargetCommit,
+			Status:       record.Status,
+			Reason:       record.Reason,
+			UpdatedAt:    record.ModTime,
+		})
+	})
+	if err != nil {
+		if !started {
+			writeJSONError(w, "Storage Error", fmt.Sprintf("Failed to scan review states: %v", err), http.StatusInternalServerError)
+			return
+		}
+		// The body is left unterminated, so the failure can't pass for a complete list
+		log.Printf("Warning: file history of %s in %s interrupted: %v", filePath, repoPath, err)
+		return
+	}
+
+	if !started {
+		start()
+	}
+	w.Write([]byte("]}\n"))
+}
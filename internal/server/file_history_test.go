@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/darccio/diffty/internal/models"
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// failingScanStorage fails scans after the given records
+type failingScanStorage struct {
+	*MockStorage
+	records []storage.FileReviewRecord
+}
+
+func (f *failingScanStorage) ScanFileReviews(repoPath, filePath string, fn func(storage.FileReviewRecord) error) error {
+	for _, record := range f.records {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return errors.New("disk on fire")
+}
+
+func TestHandleFileHistory(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	mockStorage.repositories = []string{"/repo"}
+	updated := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	mockStorage.fileReviews = []storage.FileReviewRecord{
+		{SourceBranch: "feature", TargetBranch: "main", SourceCommit: "aaa", TargetCommit: "bbb", Status: models.StateApproved, ModTime: updated},
+		{User: "alice", SourceBranch: "fix", TargetBranch: "main", SourceCommit: "ccc", TargetCommit: "bbb", Status: models.StateRejected, Reason: "Needs tests", ModTime: updated},
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/file-history?"+query, nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("repo=/repo&path=" + url.QueryEscape("src/payment.go"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Repo        string             `json:"repo"`
+		Path        string             `json:"path"`
+		Comparisons []fileHistoryEntry `json:"comparisons"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Repo != "/repo" || resp.Path != "src/payment.go" || len(resp.Comparisons) != 2 {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+	if alice := resp.Comparisons[1]; alice.User != "alice" || alice.Status != models.StateRejected || alice.Reason != "Needs tests" || !alice.UpdatedAt.Equal(updated) {
+		t.Errorf("Unexpected comparison: %+v", alice)
+	}
+
+	// No reviews is an empty list
+	mockStorage.fileReviews = nil
+	if w := get("repo=/repo&path=new.go"); w.Code != http.StatusOK || w.Body.String() != `{"repo":"/repo","path":"new.go","comparisons":[]}`+"\n" {
+		t.Errorf("Expected an empty history, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := get("repo=/repo"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without a path, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := get("repo=/unknown&path=a.go"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for an unknown repository, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// A scan failing before any comparison is reported, one failing later
+	// leaves the list unterminated
+	failing := &failingScanStorage{MockStorage: mockStorage}
+	server.storage = failing
+	if w := get("repo=/repo&path=a.go"); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d for a failed scan, got %d", http.StatusInternalServerError, w.Code)
+	}
+	failing.records = []storage.FileReviewRecord{{SourceCommit: "aaa", Status: models.StateApproved}}
+	w = get("repo=/repo&path=a.go")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err == nil {
+		t.Errorf("Expected an interrupted history to be invalid JSON, got %s", w.Body.String())
+	}
+}
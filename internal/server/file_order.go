@@ -0,0 +1,59 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// File list orders. The empty order is fileOrderUnreviewedFirst.
+const (
+	fileOrderUnreviewedFirst = "unreviewed-first"
+	fileOrderRejectedFirst   = "rejected-first"
+	fileOrderPath            = "path"
+)
+
+// fileOrders lists the orders the file list can be sorted in
+var fileOrders = []string{fileOrderUnreviewedFirst, fileOrderRejectedFirst, fileOrderPath}
+
+// fileOrderPriorities ranks every file status in each order; lower comes
+// first. Files needing a second opinion come right after the ones each order
+// puts first, as they wait on another reviewer rather than on this one. Mixed
+// files, whose lines were approved and skipped, come right after the skipped
+// ones.
+var fileOrderPriorities = map[string]map[string]int{
+	fileOrderUnreviewedFirst: {
+		models.StateUnreviewed:  0,
+		models.StateNeedsReview: 1,
+		models.StateSkipped:     2,
+		models.StateMixed:       3,
+		models.StateRejected:    4,
+		models.StateApproved:    5,
+	},
+	fileOrderRejectedFirst: {
+		models.StateRejected:    0,
+		models.StateNeedsReview: 1,
+		models.StateUnreviewed:  2,
+		models.StateSkipped:     3,
+		models.StateMixed:       4,
+		models.StateApproved:    5,
+	},
+}
+
+// sortFiles sorts the file list in place by the given order, then by path.
+// The path order ignores statuses altogether.
+func sortFiles(files []map[string]string, order string) {
+	if order == "" {
+		order = fileOrderUnreviewedFirst
+	}
+	priorities := fileOrderPriorities[order]
+
+	sort.SliceStable(files, func(i, j int) bool {
+		iPriority := priorities[files[i]["Status"]]
+		jPriority := priorities[files[j]["Status"]]
+		if iPriority != jPriority {
+			return iPriority < jPriority
+		}
+		return files[i]["Path"] < files[j]["Path"]
+	})
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+func TestSortFiles(t *testing.T) {
+	newFiles := func() []map[string]string {
+		return []map[string]string{
+			{"Path": "e.go", "Status": models.StateApproved},
+			{"Path": "d.go", "Status": models.StateRejected},
+			{"Path": "c.go", "Status": models.StateSkipped},
+			{"Path": "b.go", "Status": "unreviewed"},
+			{"Path": "a.go", "Status": models.StateRejected},
+			{"Path": "f.go", "Status": "unreviewed"},
+			{"Path": "g.go", "Status": models.StateNeedsReview},
+			{"Path": "h.go", "Status": models.StateMixed},
+		}
+	}
+
+	tests := []struct {
+		order    string
+		expected string
+	}{
+		{order: "", expected: "b.go f.go g.go c.go h.go a.go d.go e.go"},
+		{order: fileOrderUnreviewedFirst, expected: "b.go f.go g.go c.go h.go a.go d.go e.go"},
+		{order: fileOrderRejectedFirst, expected: "a.go d.go g.go b.go f.go c.go h.go e.go"},
+		{order: fileOrderPath, expected: "a.go b.go c.go d.go e.go f.go g.go h.go"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			files := newFiles()
+			sortFiles(files, tt.order)
+
+			paths := make([]string, len(files))
+			for i, file := range files {
+				paths[i] = file["Path"]
+			}
+			if got := strings.Join(paths, " "); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestFileOrderPrioritiesRankEveryStatus tests that no status falls back to
+// the zero priority of the statuses an order puts first
+func TestFileOrderPrioritiesRankEveryStatus(t *testing.T) {
+	for order, priorities := range fileOrderPriorities {
+		for status := range models.DefaultStatusMetas() {
+			if _, ok := priorities[status]; !ok {
+				t.Errorf("Expected %s to rank %s", order, status)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import "strings"
+
+// statBarWidth is the widest stat bar of a file, as in git's --stat
+const statBarWidth = 20
+
+// fileStat is the one-line summary shown above a file's diff, such as
+// "main.go | +12 −3 ++++++++++++--- | approved"
+type fileStat struct {
+	Path      string
+	Additions int
+	Deletions int
+	// Binary is set for binary files, which have no line counts
+	Binary bool
+	// PlusBar and MinusBar are the two parts of the stat bar
+	PlusBar  string
+	MinusBar string
+	Status   string
+}
+
+// buildFileStat summarises the parsed diff of a file along with its review status
+func buildFileStat(filePath string, lines []diffLine, status string) fileStat {
+	stat := fileStat{Path: filePath, Status: status}
+	for _, line := range lines {
+		switch {
+		case line.Kind == lineKindAdded:
+			stat.Additions++
+		case line.Kind == lineKindRemoved:
+			stat.Deletions++
+		case line.Kind == lineKindHeader && (strings.HasPrefix(line.Text, "Binary files ") || line.Text == "GIT binary patch"):
+			stat.Binary = true
+		}
+	}
+	stat.PlusBar, stat.MinusBar = statBar(stat.Additions, stat.Deletions, statBarWidth)
+	return stat
+}
+
+// statBar draws the "+++---" bar of git's --stat for a file's additions and
+// deletions. Up to width changes get a character each; larger counts are
+// scaled down to width the way git does, keeping at least one character for
+// each kind of change there is.
+func statBar(additions, deletions, width int) (string, string) {
+	total := additions + deletions
+	if width > 0 && total > width {
+		scale := func(n int) int {
+			if n == 0 {
+				return 0
+			}
+			return 1 + n*(width-1)/total
+		}
+		scaledTotal := scale(total)
+		additions = scale(additions)
+		deletions = scaledTotal - additions
+	}
+	return strings.Repeat("+", additions), strings.Repeat("-", deletions)
+}
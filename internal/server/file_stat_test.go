@@ -0,0 +1,123 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+func TestStatBar(t *testing.T) {
+	tests := []struct {
+		additions, deletions int
+		plus, minus          string
+	}{
+		{0, 0, "", ""},
+		{3, 0, "+++", ""},
+		{0, 2, "", "--"},
+		{12, 3, "++++++++++++", "---"},
+		{10, 10, "++++++++++", "----------"},
+		// Larger counts are scaled down to the width
+		{40, 0, "++++++++++++++++++++", ""},
+		{30, 10, "+++++++++++++++", "-----"},
+		// A single change still gets a character
+		{1000, 1, "+++++++++++++++++++", "-"},
+		{1, 1000, "+", "-------------------"},
+	}
+
+	for _, tt := range tests {
+		plus, minus := statBar(tt.additions, tt.deletions, statBarWidth)
+		if plus != tt.plus || minus != tt.minus {
+			t.Errorf("statBar(%d, %d) = %q, %q; expected %q, %q", tt.additions, tt.deletions, plus, minus, tt.plus, tt.minus)
+		}
+		if width := len(plus) + len(minus); width > statBarWidth {
+			t.Errorf("statBar(%d, %d) is %d characters wide, more than %d", tt.additions, tt.deletions, width, statBarWidth)
+		}
+	}
+}
+
+func TestBuildFileStat(t *testing.T) {
+	lines := parseDiffLines("file.txt", []string{
+		"diff --git a/file.txt b/file.txt",
+		"--- a/file.txt",
+		"+++ b/file.txt",
+		"@@ -1,3 +1,4 @@",
+		" one",
+		"-two",
+		"+TWO",
+		"+2.5",
+		" three",
+	})
+
+	stat := buildFileStat("file.txt", lines, "approved")
+	if stat.Additions != 2 || stat.Deletions != 1 || stat.Binary {
+		t.Errorf("Expected +2 -1, got %+v", stat)
+	}
+	if stat.PlusBar != "++" || stat.MinusBar != "-" || stat.Status != "approved" {
+		t.Errorf("Unexpected summary %+v", stat)
+	}
+
+	binary := buildFileStat("logo.png", parseDiffLines("logo.png", []string{
+		"diff --git a/logo.png b/logo.png",
+		"index 1111111..2222222 100644",
+		"Binary files a/logo.png and b/logo.png differ",
+	}), "unreviewed")
+	if !binary.Binary || binary.Additions != 0 || binary.PlusBar != "" {
+		t.Errorf("Expected a binary summary, got %+v", binary)
+	}
+}
+
+func TestHandleDiffViewFileStat(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{with .FileStat}}{{.Path}} | +{{.Additions}} -{{.Deletions}} {{.PlusBar}}{{.MinusBar}} | {{.Status}}{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&file=test.txt", nil)
+	w := httptest.NewRecorder()
+	server.handleDiffView(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "test.txt | +1 -0 &#43; | unreviewed") {
+		t.Errorf("Expected the file summary, got %s", body)
+	}
+}
+
+// TestHandleDiffViewCustomStatusLabel tests that a custom status label shows in
+// the diff view while the stored status keeps its value
+func TestHandleDiffViewCustomStatusLabel(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	WithStatusMeta(models.StateApproved, models.StatusMeta{Label: "Looks good"})(server)
+	overrideTemplate(t, server, "diff.html", `{{.FileStatus}}: {{(statusMeta .FileStatus).Label}}`)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+	mockStorage.reviewState = &models.ReviewState{ReviewedFiles: []models.FileReview{
+		{Repo: repoDir, Path: "test.txt", Lines: map[string]string{"all": models.StateApproved}},
+	}}
+
+	req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&file=test.txt", nil)
+	w := httptest.NewRecorder()
+	server.handleDiffView(w, req)
+
+	if body := w.Body.String(); !strings.Contains(body, "approved: Looks good") {
+		t.Errorf("Expected the custom label of the stored status, got %s", body)
+	}
+
+	// The label belongs to that server alone
+	other, otherStorage := setupTestServer(t)
+	overrideTemplate(t, other, "diff.html", `{{.FileStatus}}: {{(statusMeta .FileStatus).Label}}`)
+	otherStorage.repositories = mockStorage.repositories
+	otherStorage.reviewState = mockStorage.reviewState
+	w = httptest.NewRecorder()
+	other.handleDiffView(w, req)
+	if body := w.Body.String(); !strings.Contains(body, "approved: Approved") {
+		t.Errorf("Expected the default label on another server, got %s", body)
+	}
+}
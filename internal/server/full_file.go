@@ -0,0 +1,124 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// fullFileMaxSize is the largest file, in bytes, the full file view shows in
+// full. Larger files keep the hunk view.
+const fullFileMaxSize = 256 * 1024
+
+// overlayFullFile lays the parsed diff of a file over the file's full new-side
+// content, so the unchanged lines between and around the hunks are shown too.
+// Headers, hunk headers and the changed lines are kept as parsed, the unchanged
+// lines git left out become context lines numbered on both sides. It reports
+// false when the diff has no hunks or doesn't match the content, in which case
+// the hunk view should be shown instead.
+func overlayFullFile(filePath string, diffLines []diffLine, content string) ([]diffLine, bool) {
+	contentLines := []string{}
+	if content != "" {
+		contentLines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+	prefix := lineAnchorPrefix(filePath)
+
+	overlaid := make([]diffLine, 0, len(contentLines)+len(diffLines))
+	// The next old and new line numbers following the lines seen so far
+	oldNext, newNext := 1, 1
+	hunks := 0
+
+	// fill adds the unchanged lines up to and including the given new line number
+	fill := func(last int) bool {
+		if last > len(contentLines) {
+			return false
+		}
+		for ; newNext <= last; newNext++ {
+			overlaid = append(overlaid, diffLine{
+				Text:    " " + contentLines[newNext-1],
+				Kind:    lineKindContext,
+				OldLine: oldNext,
+				NewLine: newNext,
+				Anchor:  fmt.Sprintf("%sR%d", prefix, newNext),
+			})
+			oldNext++
+		}
+		return true
+	}
+
+	for _, line := range diffLines {
+		switch line.Kind {
+		case lineKindHunk:
+			start, ok := parseHunkStart(line.Text)
+			if !ok {
+				return nil, false
+			}
+			// A hunk adding no lines starts at the line its deletions follow
+			last := start[1] - 1
+			if hunkAddsNoLines(line.Hunk) {
+				last = start[1]
+			}
+			if !fill(last) {
+				return nil, false
+			}
+			hunks++
+		case lineKindContext:
+			// The trailing newline of the diff output has no line numbers
+			if line.NewLine == 0 {
+				continue
+			}
+			oldNext, newNext = line.OldLine+1, line.NewLine+1
+		case lineKindAdded:
+			newNext = line.NewLine + 1
+		case lineKindRemoved:
+			oldNext = line.OldLine + 1
+		}
+		overlaid = append(overlaid, line)
+	}
+
+	if hunks == 0 || newNext-1 > len(contentLines) || !fill(len(contentLines)) {
+		return nil, false
+	}
+
+	return overlaid, true
+}
+
+// hunkAddsNoLines reports whether a hunk range such as "-3,2 +2,0" has no lines
+// on the new side
+func hunkAddsNoLines(hunk string) bool {
+	_, newRange, ok := strings.Cut(hunk, " +")
+	if !ok {
+		return false
+	}
+	_, count, ok := strings.Cut(newRange, ",")
+	return ok && count == "0"
+}
+
+// fullFileLines returns the diff lines of a file overlaid on its content at the
+// source ref. It reports false when the file is too large, can't be read, such
+// as a deleted file, or its diff can't be laid over it.
+func (s *Server) fullFileLines(repo *git.Repository, sourceRef, filePath string, diffLines []diffLine) ([]diffLine, bool) {
+	// Deleted files have no content left, binary ones no hunks to overlay
+	hasHunks := false
+	for _, line := range diffLines {
+		if strings.HasPrefix(line.Text, "deleted file mode ") {
+			return nil, false
+		}
+		hasHunks = hasHunks || line.Kind == lineKindHunk
+	}
+	if !hasHunks {
+		return nil, false
+	}
+
+	content, err := repo.GetFileContent(sourceRef, filePath, fullFileMaxSize)
+	if err != nil {
+		if !errors.Is(err, git.ErrFileTooLarge) {
+			log.Printf("Warning: failed to load full file: %v", err)
+		}
+		return nil, false
+	}
+	return overlayFullFile(filePath, diffLines, sanitizeUTF8(content))
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// renderLines formats diff lines as "old:new:text" for comparison
+func renderLines(lines []diffLine) []string {
+	rendered := make([]string, len(lines))
+	for i, line := range lines {
+		rendered[i] = fmt.Sprintf("%d:%d:%s", line.OldLine, line.NewLine, line.Text)
+	}
+	return rendered
+}
+
+func TestOverlayFullFile(t *testing.T) {
+	// Line 2 changed, line 6 deleted and line 9 added, with one line of context
+	diff := []string{
+		"diff --git a/file.txt b/file.txt",
+		"index 1111111..2222222 100644",
+		"--- a/file.txt",
+		"+++ b/file.txt",
+		"@@ -1,3 +1,3 @@",
+		" one",
+		"-two",
+		"+TWO",
+		" three",
+		"@@ -6 +5,0 @@",
+		"-six",
+		"@@ -9 +8,2 @@",
+		" nine",
+		"+ten",
+		"",
+	}
+	content := "one\nTWO\nthree\nfour\nfive\nseven\neight\nnine\nten\n"
+
+	lines, ok := overlayFullFile("file.txt", parseDiffLines("file.txt", diff), content)
+	if !ok {
+		t.Fatal("Expected the diff to be overlaid on the content")
+	}
+
+	expected := []string{
+		"0:0:diff --git a/file.txt b/file.txt",
+		"0:0:index 1111111..2222222 100644",
+		"0:0:--- a/file.txt",
+		"0:0:+++ b/file.txt",
+		"0:0:@@ -1,3 +1,3 @@",
+		"1:1: one",
+		"2:0:-two",
+		"0:2:+TWO",
+		"3:3: three",
+		"4:4: four",
+		"5:5: five",
+		"0:0:@@ -6 +5,0 @@",
+		"6:0:-six",
+		"7:6: seven",
+		"8:7: eight",
+		"0:0:@@ -9 +8,2 @@",
+		"9:8: nine",
+		"0:9:+ten",
+	}
+	if got := renderLines(lines); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected overlay:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+
+	// Filled-in lines are anchored like the context lines of the diff
+	if anchor := lineAnchorPrefix("file.txt") + "R4"; lines[9].Anchor != anchor {
+		t.Errorf("Expected anchor %s, got %s", anchor, lines[9].Anchor)
+	}
+}
+
+func TestOverlayFullFileFallback(t *testing.T) {
+	diff := parseDiffLines("file.txt", []string{
+		"diff --git a/file.txt b/file.txt",
+		"--- a/file.txt",
+		"+++ b/file.txt",
+		"@@ -4,2 +4,2 @@",
+		" four",
+		"-five",
+		"+FIVE",
+	})
+
+	// The content is shorter than the diff claims
+	if _, ok := overlayFullFile("file.txt", diff, "one\ntwo\n"); ok {
+		t.Error("Expected a diff not matching the content to be refused")
+	}
+
+	binary := parseDiffLines("image.png", []string{
+		"diff --git a/image.png b/image.png",
+		"Binary files a/image.png and b/image.png differ",
+	})
+	if _, ok := overlayFullFile("image.png", binary, "\x89PNG"); ok {
+		t.Error("Expected a diff without hunks to be refused")
+	}
+}
+
+func TestHandleDiffViewFullFile(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{if .FullFileUnavailable}}unavailable|{{end}}{{range .DiffLines}}{{.NewLine}}={{.Text}};{{end}}|{{.ViewQuery}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	var content strings.Builder
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	writeFile(t, repoDir, "long.txt", content.String())
+	runGit(t, repoDir, "add", "long.txt")
+	runGit(t, repoDir, "commit", "-m", "Add long file")
+	runGit(t, repoDir, "checkout", "main")
+	writeFile(t, repoDir, "long.txt", strings.Replace(content.String(), "line 15\n", "", 1))
+	runGit(t, repoDir, "add", "long.txt")
+	runGit(t, repoDir, "commit", "-m", "Add long file without line 15")
+	mockStorage.repositories = []string{repoDir}
+
+	render := func(query string) string {
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main"+query, nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	if body := render("&file=long.txt"); strings.Contains(body, "1= line 1;") {
+		t.Errorf("Expected the hunk view to leave out distant lines, got %s", body)
+	}
+
+	body := render("&file=long.txt&full_file=1")
+	if !strings.Contains(body, "1= line 1;") || !strings.Contains(body, "15=&#43;line 15;") || !strings.Contains(body, "20= line 20;") {
+		t.Errorf("Expected the whole file with the added line, got %s", body)
+	}
+	if !strings.Contains(body, "&amp;full_file=1") {
+		t.Errorf("Expected the option to persist, got %s", body)
+	}
+
+	// A file deleted on the source side falls back to its hunks
+	runGit(t, repoDir, "checkout", "feature")
+	runGit(t, repoDir, "rm", "--quiet", "test.txt")
+	runGit(t, repoDir, "commit", "-m", "Remove test file")
+	runGit(t, repoDir, "checkout", "main")
+	if body := render("&file=test.txt&full_file=1"); !strings.Contains(body, "unavailable|") || !strings.Contains(body, "-initial content") {
+		t.Errorf("Expected the hunk view of the deleted file, got %s", body)
+	}
+}
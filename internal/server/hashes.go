@@ -0,0 +1,35 @@
+package server
+
+// defaultHashLength is the displayed length of commit hashes unless
+// WithHashLength sets another, as git abbreviates them in small repositories
+const defaultHashLength = 7
+
+// minHashLength is the shortest abbreviation git accepts for a commit
+const minHashLength = 4
+
+// WithHashLength sets how many characters of commit hashes are displayed.
+// Only the display is abbreviated: review states, links and forms keep the
+// full hashes, so they stay stable as the repository grows. Lengths below
+// git's minimum of 4 are raised to it, and 40 or more shows full hashes.
+// Zero or less keeps the default of 7.
+func WithHashLength(n int) Option {
+	return func(s *Server) {
+		if n <= 0 {
+			n = defaultHashLength
+		}
+		s.hashLength = max(n, minHashLength)
+	}
+}
+
+// ShortHash abbreviates a commit hash for display, to the length set by WithHashLength
+func (s *Server) ShortHash(hash string) string {
+	return abbreviateHash(hash, s.hashLength)
+}
+
+// abbreviateHash shortens a hash to length characters, leaving shorter ones as they are
+func abbreviateHash(hash string, length int) string {
+	if len(hash) > length {
+		return hash[:length]
+	}
+	return hash
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+	"github.com/darccio/diffty/internal/storage"
+)
+
+func TestWithHashLength(t *testing.T) {
+	hash := "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		length   int
+		expected string
+	}{
+		{length: 0, expected: "0123456"},
+		{length: -1, expected: "0123456"},
+		{length: 2, expected: "0123"},
+		{length: 12, expected: "0123456789ab"},
+		{length: 40, expected: hash},
+		{length: 64, expected: hash},
+	}
+
+	for _, test := range tests {
+		server := &Server{hashLength: defaultHashLength}
+		WithHashLength(test.length)(server)
+		if got := server.ShortHash(hash); got != test.expected {
+			t.Errorf("length %d: expected %q, got %q", test.length, test.expected, got)
+		}
+	}
+
+	if got := abbreviateHash("abc", 7); got != "abc" {
+		t.Errorf("Expected a short hash to be left alone, got %q", got)
+	}
+}
+
+// TestHashLengthDisplayOnly tests that the hash length only abbreviates the
+// displayed commits, while review states and links keep full hashes
+func TestHashLengthDisplayOnly(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.OpenStorage(storage.DefaultBackend, storage.Options{Dir: dir})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	server, err := New(store, WithHashLength(10))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	repoDir := setupGitRepo(t)
+	if err := store.SaveRepositories([]string{repoDir}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+	featureCommit := runGit(t, repoDir, "rev-parse", "feature")
+	mainCommit := runGit(t, repoDir, "rev-parse", "main")
+
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("source", "feature")
+	query.Set("target", "main")
+	query.Set("source_commit", featureCommit)
+	query.Set("target_commit", mainCommit)
+	query.Set("file", "test.txt")
+	query.Set("status", models.StateApproved)
+	req := httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+	if location := w.Header().Get("Location"); !strings.Contains(location, "source_commit="+featureCommit) {
+		t.Errorf("Expected the redirect to keep the full source commit, got %s", location)
+	}
+
+	// The review state is stored under the full commits
+	matches, err := filepath.Glob(filepath.Join(dir, "*", featureCommit, mainCommit, "review-state.json"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("Expected the review state stored under the full commits, got %v (%v)", matches, err)
+	}
+
+	get := func(path string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d for %s, got %d: %s", http.StatusOK, path, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	body := get("/")
+	if !strings.Contains(body, "<code>"+featureCommit[:10]+"</code>") || strings.Contains(body, "<code>"+featureCommit+"</code>") {
+		t.Errorf("Expected the recent review's commits abbreviated to 10 characters, got %s", body)
+	}
+
+	body = get("/diff?repo=" + url.QueryEscape(repoDir) + "&source=feature&target=main")
+	if !strings.Contains(body, `<span class="font-mono text-gray-500">`+featureCommit[:10]+"</span>") {
+		t.Errorf("Expected the branch's commits abbreviated to 10 characters, got %s", body)
+	}
+	if !strings.Contains(body, `value="`+featureCommit+`"`) || !strings.Contains(body, "source_commit="+featureCommit) {
+		t.Errorf("Expected the forms and links to keep the full commits, got %s", body)
+	}
+}
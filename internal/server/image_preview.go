@@ -0,0 +1,134 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// imageContentTypes maps the extensions of the images the diff view previews
+// to their content type. SVG is left out, since it can carry scripts.
+var imageContentTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".bmp":  "image/bmp",
+	".ico":  "image/x-icon",
+}
+
+// imagePreviewMaxSize is the largest image, in bytes, that is previewed and
+// served by the blob endpoint
+var imagePreviewMaxSize int64 = 5 << 20
+
+// imageContentType returns the content type of an image path, and whether the
+// path is a previewable image at all
+func imageContentType(filePath string) (string, bool) {
+	contentType, ok := imageContentTypes[strings.ToLower(path.Ext(filePath))]
+	return contentType, ok
+}
+
+// imagePreview holds the two versions of a changed image shown side by side
+type imagePreview struct {
+	// Old and New are nil when the image doesn't exist on that side
+	Old *imageVersion
+	New *imageVersion
+}
+
+// imageVersion is one side of an image preview
+type imageVersion struct {
+	// URL serves the image from the blob endpoint
+	URL string
+	// TooLarge is set when the image exceeds imagePreviewMaxSize and isn't shown
+	TooLarge bool
+}
+
+// buildImagePreview describes the image at oldPath in targetRef and at newPath
+// in sourceRef, for the diff view to show them side by side
+func buildImagePreview(repo *git.Repository, repoPath, targetRef, oldPath, sourceRef, newPath string) imagePreview {
+	return imagePreview{
+		Old: imageVersionAt(repo, repoPath, targetRef, oldPath),
+		New: imageVersionAt(repo, repoPath, sourceRef, newPath),
+	}
+}
+
+// imageVersionAt describes the image at filePath in ref, or returns nil when
+// there is none
+func imageVersionAt(repo *git.Repository, repoPath, ref, filePath string) *imageVersion {
+	size, err := repo.GetFileSize(ref, filePath)
+	if err != nil {
+		if !errors.Is(err, git.ErrFileNotFound) {
+			log.Printf("Warning: failed to look up image: %v", err)
+		}
+		return nil
+	}
+
+	query := url.Values{}
+	query.Set("repo", repoPath)
+	query.Set("ref", ref)
+	query.Set("path", filePath)
+	return &imageVersion{
+		URL:      "/api/blob?" + query.Encode(),
+		TooLarge: size > imagePreviewMaxSize,
+	}
+}
+
+// handleBlob serves an image file as stored at a ref, for the image previews
+// of the diff view. Only previewable images up to imagePreviewMaxSize are
+// served.
+func (s *Server) handleBlob(w http.ResponseWriter, r *http.Request) {
+	repoPath := r.URL.Query().Get("repo")
+	ref := r.URL.Query().Get("ref")
+	filePath := r.URL.Query().Get("path")
+	if repoPath == "" || ref == "" || filePath == "" {
+		writeJSONError(w, "Missing Parameters", "Missing required parameters for serving a file", http.StatusBadRequest)
+		return
+	}
+	if strings.HasPrefix(ref, "-") {
+		writeJSONError(w, "Invalid Ref", fmt.Sprintf("Invalid ref: %s", ref), http.StatusBadRequest)
+		return
+	}
+
+	contentType, ok := imageContentType(filePath)
+	if !ok {
+		writeJSONError(w, "Unsupported File", fmt.Sprintf("Only images can be served: %s", filePath), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	repo, exists, err := s.GetRepository(repoPath)
+	if err != nil {
+		writeJSONError(w, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
+		return
+	}
+	if !exists {
+		writeJSONError(w, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	content, err := repo.GetFileContent(ref, filePath, imagePreviewMaxSize)
+	switch {
+	case errors.Is(err, git.ErrFileNotFound):
+		writeJSONError(w, "Not Found", err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, git.ErrFileTooLarge):
+		writeJSONError(w, "File Too Large", err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		writeJSONError(w, "File Error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	if _, err := w.Write([]byte(content)); err != nil {
+		log.Printf("Error writing file: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Fake image contents, binary as far as git is concerned
+const (
+	oldImage = "\x89PNG\r\n\x1a\n\x00old"
+	newImage = "\x89PNG\r\n\x1a\n\x00new"
+)
+
+// setupImageRepo creates a repository whose feature branch changes logo.png
+// and adds a notes.txt file
+func setupImageRepo(t *testing.T) (*Server, *MockStorage, string) {
+	t.Helper()
+
+	server, mockStorage := setupTestServer(t)
+
+	repoDir := setupGitRepo(t)
+	writeFile(t, repoDir, "logo.png", oldImage)
+	runGit(t, repoDir, "add", "logo.png")
+	runGit(t, repoDir, "commit", "-m", "Add logo")
+	runGit(t, repoDir, "checkout", "feature")
+	runGit(t, repoDir, "merge", "--quiet", "main")
+	writeFile(t, repoDir, "logo.png", newImage)
+	writeFile(t, repoDir, "notes.txt", "notes\n")
+	runGit(t, repoDir, "add", "logo.png", "notes.txt")
+	runGit(t, repoDir, "commit", "-m", "Update logo")
+	runGit(t, repoDir, "checkout", "main")
+
+	mockStorage.repositories = []string{repoDir}
+	return server, mockStorage, repoDir
+}
+
+func TestImageContentType(t *testing.T) {
+	tests := map[string]string{
+		"logo.png":           "image/png",
+		"photos/Beach.JPG":   "image/jpeg",
+		"anim.gif":           "image/gif",
+		"icon.svg":           "",
+		"main.go":            "",
+		"png":                "",
+		"archive.png.tar":    "",
+		"assets/.hidden.ico": "image/x-icon",
+	}
+
+	for filePath, expected := range tests {
+		contentType, ok := imageContentType(filePath)
+		if ok != (expected != "") || contentType != expected {
+			t.Errorf("%s: expected content type %q, got %q (%v)", filePath, expected, contentType, ok)
+		}
+	}
+}
+
+func TestHandleBlob(t *testing.T) {
+	server, _, repoDir := setupImageRepo(t)
+
+	get := func(ref, filePath string) *httptest.ResponseRecorder {
+		query := url.Values{}
+		query.Set("repo", repoDir)
+		query.Set("ref", ref)
+		query.Set("path", filePath)
+		req := httptest.NewRequest("GET", "/api/blob?"+query.Encode(), nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("feature", "logo.png")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w.Body.String() != newImage {
+		t.Errorf("Expected the image at feature, got %q", w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "image/png" {
+		t.Errorf("Expected Content-Type image/png, got %s", contentType)
+	}
+	if nosniff := w.Header().Get("X-Content-Type-Options"); nosniff != "nosniff" {
+		t.Errorf("Expected X-Content-Type-Options nosniff, got %q", nosniff)
+	}
+
+	if w := get("main", "logo.png"); w.Body.String() != oldImage {
+		t.Errorf("Expected the image at main, got %q", w.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		ref      string
+		path     string
+		expected int
+	}{
+		{"not an image", "feature", "notes.txt", http.StatusUnsupportedMediaType},
+		{"missing file", "feature", "missing.png", http.StatusNotFound},
+		{"missing ref", "nonexistent", "logo.png", http.StatusNotFound},
+		{"option as ref", "--output=/tmp/x", "logo.png", http.StatusBadRequest},
+		{"missing path", "feature", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := get(tt.ref, tt.path); w.Code != tt.expected {
+			t.Errorf("%s: expected status code %d, got %d: %s", tt.name, tt.expected, w.Code, w.Body.String())
+		}
+	}
+
+	origMaxSize := imagePreviewMaxSize
+	imagePreviewMaxSize = 4
+	t.Cleanup(func() {
+		imagePreviewMaxSize = origMaxSize
+	})
+	if w := get("feature", "logo.png"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d for a large image, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/api/blob?repo=%2Funknown&ref=main&path=logo.png", nil)
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for an unknown repository, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandleDiffViewImagePreview(t *testing.T) {
+	server, _, repoDir := setupImageRepo(t)
+	overrideTemplate(t, server, "diff.html", `{{with .ImagePreview}}{{with .Old}}old={{.URL}};{{end}}{{with .New}}new={{.URL}};{{end}}{{else}}none{{end}}`)
+
+	render := func(filePath string) string {
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&file="+filePath, nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	body := render("logo.png")
+	for _, ref := range []string{"main", "feature"} {
+		if !strings.Contains(body, "ref="+ref) {
+			t.Errorf("Expected a preview of the image at %s, got %s", ref, body)
+		}
+	}
+	if !strings.Contains(body, "old=/api/blob?") || !strings.Contains(body, "new=/api/blob?") {
+		t.Errorf("Expected both sides to be previewed, got %s", body)
+	}
+
+	if body := render("notes.txt"); !strings.Contains(body, "none") {
+		t.Errorf("Expected no preview for a text file, got %s", body)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// showLargeParam is the query parameter rendering a large file's diff anyway
+const showLargeParam = "show_large"
+
+// WithLargeFileThreshold skips rendering the diff of files with more than
+// lines changed lines, or whose diff is more than bytes long, such as
+// minified bundles or lock files. The file view shows a placeholder with a
+// link to render the diff anyway, and the file can be reviewed as usual.
+// Zero or less turns the respective limit off.
+func WithLargeFileThreshold(lines int, bytes int64) Option {
+	return func(s *Server) {
+		s.largeFileLines = max(lines, 0)
+		s.largeFileBytes = max(bytes, 0)
+	}
+}
+
+// largeFilesEnabled reports whether any large file limit is set
+func (s *Server) largeFilesEnabled() bool {
+	return s.largeFileLines > 0 || s.largeFileBytes > 0
+}
+
+// isLargeFile reports whether a file's diff is over either of the limits
+func (s *Server) isLargeFile(stat git.FileLineStat, diffBytes int) bool {
+	return (s.largeFileLines > 0 && stat.Additions+stat.Deletions > s.largeFileLines) ||
+		(s.largeFileBytes > 0 && int64(diffBytes) > s.largeFileBytes)
+}
+
+// annotateLargeFiles sets "Large" on the files over the large file limits,
+// along with their line counts under "Additions" and "Deletions". The counts
+// come from git diff --numstat and the sizes from the diff the file list was
+// built from, so the file's own diff needn't be loaded to tell.
+func (s *Server) annotateLargeFiles(files []map[string]string, stats []git.FileLineStat, diffText string) {
+	byPath := make(map[string]git.FileLineStat, len(stats))
+	for _, stat := range stats {
+		byPath[stat.Path] = stat
+	}
+	sizes := diffSectionSizes(diffText)
+
+	for _, file := range files {
+		stat, ok := byPath[file["Path"]]
+		if !ok || !s.isLargeFile(stat, sizes[file["Path"]]) {
+			continue
+		}
+		file["Large"] = "true"
+		file["Additions"] = fmt.Sprint(stat.Additions)
+		file["Deletions"] = fmt.Sprint(stat.Deletions)
+		if stat.Binary {
+			file["Binary"] = "true"
+		}
+	}
+}
+
+// diffSectionSizes returns the size in bytes of each file's section of a diff
+func diffSectionSizes(diffText string) map[string]int {
+	sizes := make(map[string]int)
+	path := ""
+	for _, line := range strings.SplitAfter(diffText, "\n") {
+		if p, ok := diffSectionPath(strings.TrimSuffix(line, "\n")); ok {
+			path = p
+		}
+		if path != "" {
+			sizes[path] += len(line)
+		}
+	}
+	return sizes
+}
+
+// largeFileStat summarises a large file from its file list entry, whose diff
+// wasn't loaded
+func largeFileStat(file map[string]string, status string) fileStat {
+	stat := fileStat{Path: file["Path"], Binary: file["Binary"] == "true", Status: status}
+	stat.Additions, _ = strconv.Atoi(file["Additions"])
+	stat.Deletions, _ = strconv.Atoi(file["Deletions"])
+	stat.PlusBar, stat.MinusBar = statBar(stat.Additions, stat.Deletions, statBarWidth)
+	return stat
+}
+
+// showLargeURL returns the URL of the current page rendering large files anyway
+func showLargeURL(r *http.Request) string {
+	query := r.URL.Query()
+	query.Set(showLargeParam, "1")
+	return r.URL.Path + "?" + query.Encode()
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestLargeFileThreshold tests that files over the line or byte threshold are
+// listed but not rendered unless asked for, and can still be reviewed
+func TestLargeFileThreshold(t *testing.T) {
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "bundle.min.js", strings.Repeat("x", 5000)+"\n")
+	writeFile(t, repoDir, "package-lock.json", strings.Repeat("{}\n", 100))
+	runGit(t, repoDir, "add", ".")
+	runGit(t, repoDir, "commit", "-m", "Add generated files")
+	runGit(t, repoDir, "checkout", "main")
+	base := "/diff?repo=" + url.QueryEscape(repoDir) + "&source=feature&target=main"
+
+	tests := []struct {
+		name  string
+		lines int
+		bytes int64
+		large []string
+	}{
+		{"Off", 0, 0, nil},
+		{"Lines", 50, 0, []string{"package-lock.json"}},
+		{"Bytes", 0, 1024, []string{"bundle.min.js"}},
+		{"Both", 50, 1024, []string{"bundle.min.js", "package-lock.json"}},
+		{"AtThreshold", 100, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, mockStorage := setupTestServer(t)
+			overrideTemplate(t, server, "diff.html", `[{{range .Files}}{{if .Large}}{{.Path}} {{.Additions}};{{end}}{{end}}]`)
+			WithLargeFileThreshold(tt.lines, tt.bytes)(server)
+			mockStorage.repositories = []string{repoDir}
+
+			w := httptest.NewRecorder()
+			server.Router().ServeHTTP(w, httptest.NewRequest("GET", base, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+
+			var expected string
+			for _, path := range tt.large {
+				expected += path + " " + map[string]string{"bundle.min.js": "1", "package-lock.json": "100"}[path] + ";"
+			}
+			if body := w.Body.String(); !strings.Contains(body, "["+expected+"]") {
+				t.Errorf("Expected large files %q, got %q", expected, body)
+			}
+		})
+	}
+}
+
+// TestLargeFileView tests that a large file's view shows a placeholder with
+// its line counts and a link rendering its diff anyway
+func TestLargeFileView(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{if .LargeFile}}placeholder {{.FileStat.Additions}} {{.FileStatus}} {{.ShowLargeURL}}{{else}}{{range .DiffLines}}|{{end}}{{end}}`)
+	WithLargeFileThreshold(50, 0)(server)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "package-lock.json", strings.Repeat("{}\n", 100))
+	runGit(t, repoDir, "add", ".")
+	runGit(t, repoDir, "commit", "-m", "Add lock file")
+	runGit(t, repoDir, "checkout", "main")
+	mockStorage.repositories = []string{repoDir}
+	base := "/diff?repo=" + url.QueryEscape(repoDir) + "&source=feature&target=main"
+
+	get := func(target string) string {
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	body := get(base + "&file=package-lock.json")
+	if !strings.Contains(body, "placeholder 100 unreviewed /diff?") || !strings.Contains(body, "show_large=1") {
+		t.Fatalf("Expected a placeholder for the large file, got %s", body)
+	}
+	if body := get(base + "&file=package-lock.json&show_large=1"); strings.Contains(body, "placeholder") {
+		t.Errorf("Expected the diff of the large file when asked for, got %s", body)
+	}
+	if body := get(base + "&file=test.txt"); strings.Contains(body, "placeholder") {
+		t.Errorf("Expected the diff of a small file, got %s", body)
+	}
+}
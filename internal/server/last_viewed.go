@@ -0,0 +1,135 @@
+package server
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// lastViewedDelay is how long a file has to stay the last one viewed in a
+// comparison before it is saved, so paging through files saves once
+const lastViewedDelay = 2 * time.Second
+
+// lastViewedFiles records the file last viewed in each comparison, so the
+// review can be resumed there. Views are debounced: a file is saved once no
+// other file of the comparison was viewed for the delay, and the file waiting
+// to be saved is served from memory meanwhile.
+type lastViewedFiles struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	pending map[comparison]*pendingView
+	// save writes the last viewed file of a comparison to its review state
+	save func(c comparison, file string)
+}
+
+// pendingView is a viewed file waiting for its save
+type pendingView struct {
+	file  string
+	timer *time.Timer
+	// generation tells the latest view apart from those its timer replaced
+	generation int
+}
+
+// newLastViewedFiles returns a recorder saving views through save once they
+// settled for delay. A zero delay saves every view right away.
+func newLastViewedFiles(delay time.Duration, save func(c comparison, file string)) *lastViewedFiles {
+	return &lastViewedFiles{delay: delay, pending: make(map[comparison]*pendingView), save: save}
+}
+
+// viewKey identifies a comparison's review state, whatever the view's scope
+func viewKey(c comparison) comparison {
+	return comparison{RepoPath: c.RepoPath, User: c.User, SourceBranch: c.SourceBranch, TargetBranch: c.TargetBranch, SourceCommit: c.SourceCommit, TargetCommit: c.TargetCommit}
+}
+
+// record notes that file was viewed in the comparison
+func (l *lastViewedFiles) record(c comparison, file string) {
+	key := viewKey(c)
+	if l.delay <= 0 {
+		l.save(key, file)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	view, ok := l.pending[key]
+	if !ok {
+		view = &pendingView{}
+		l.pending[key] = view
+	} else {
+		view.timer.Stop()
+	}
+	view.file = file
+	view.generation++
+	generation := view.generation
+	view.timer = time.AfterFunc(l.delay, func() { l.flush(key, generation) })
+}
+
+// flush saves the comparison's pending view, unless a later view replaced it
+func (l *lastViewedFiles) flush(key comparison, generation int) {
+	l.mu.Lock()
+	view, ok := l.pending[key]
+	if !ok || view.generation != generation {
+		l.mu.Unlock()
+		return
+	}
+	delete(l.pending, key)
+	l.mu.Unlock()
+
+	l.save(key, view.file)
+}
+
+// discard drops the pending views of a repository's comparisons, so views
+// recorded before its review states were cleared aren't saved into new ones
+func (l *lastViewedFiles) discard(repoPath string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, view := range l.pending {
+		if key.RepoPath == repoPath {
+			view.timer.Stop()
+			delete(l.pending, key)
+		}
+	}
+}
+
+// pendingFile returns the file viewed in the comparison that isn't saved yet
+func (l *lastViewedFiles) pendingFile(c comparison) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	view, ok := l.pending[viewKey(c)]
+	if !ok {
+		return "", false
+	}
+	return view.file, true
+}
+
+// saveLastViewedFile writes the file last viewed in a comparison to its review state
+func (s *Server) saveLastViewedFile(c comparison, file string) {
+	unlock := s.reviewLocks.lock(c)
+	defer unlock()
+
+	reviewState, err := s.storage.LoadReviewState(c.RepoPath, c.User, c.SourceBranch, c.TargetBranch, c.SourceCommit, c.TargetCommit)
+	if err != nil {
+		log.Printf("Warning: failed to load review state: %v", err)
+		return
+	}
+	if reviewState.LastViewedFile == file {
+		return
+	}
+
+	reviewState.LastViewedFile = file
+	if err := s.storage.SaveReviewState(reviewState, c.RepoPath, c.User); err != nil {
+		log.Printf("Warning: failed to save the last viewed file: %v", err)
+	}
+}
+
+// lastViewedFile returns the file the reviewer last viewed in the comparison,
+// saved or not
+func (s *Server) lastViewedFile(c comparison, saved string) string {
+	if file, ok := s.lastViewed.pendingFile(c); ok {
+		return file
+	}
+	return saved
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLastViewedFilesDebounce tests that views in quick succession are saved
+// once, with the file viewed last, which is served from memory meanwhile
+func TestLastViewedFilesDebounce(t *testing.T) {
+	var mu sync.Mutex
+	saved := []string{}
+	done := make(chan struct{}, 1)
+	views := newLastViewedFiles(20*time.Millisecond, func(c comparison, file string) {
+		mu.Lock()
+		saved = append(saved, c.SourceCommit+":"+file)
+		mu.Unlock()
+		done <- struct{}{}
+	})
+
+	// The scope of the view doesn't matter
+	c := comparison{RepoPath: "/repo", SourceBranch: "feature", TargetBranch: "main", SourceCommit: "abc", TargetCommit: "def"}
+	scoped := c
+	scoped.Pathspec = "docs"
+
+	views.record(c, "a.txt")
+	views.record(scoped, "b.txt")
+	views.record(c, "c.txt")
+	if file, ok := views.pendingFile(scoped); !ok || file != "c.txt" {
+		t.Errorf("Expected c.txt to be pending, got %q, %v", file, ok)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the view to be saved")
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(saved) != 1 || saved[0] != "abc:c.txt" {
+		t.Errorf("Expected a single save of c.txt, got %v", saved)
+	}
+	if _, ok := views.pendingFile(c); ok {
+		t.Error("Expected nothing pending once saved")
+	}
+}
+
+// TestLastViewedFilesDiscard tests that the pending views of a repository
+// whose reviews are cleared are never saved, leaving other repositories' alone
+func TestLastViewedFilesDiscard(t *testing.T) {
+	saved := make(chan string, 2)
+	views := newLastViewedFiles(20*time.Millisecond, func(c comparison, file string) {
+		saved <- c.RepoPath + ":" + file
+	})
+
+	views.record(comparison{RepoPath: "/cleared", SourceCommit: "abc", TargetCommit: "def"}, "a.txt")
+	views.record(comparison{RepoPath: "/other", SourceCommit: "abc", TargetCommit: "def"}, "b.txt")
+	views.discard("/cleared")
+	if _, ok := views.pendingFile(comparison{RepoPath: "/cleared", SourceCommit: "abc", TargetCommit: "def"}); ok {
+		t.Error("Expected the discarded view not to be pending")
+	}
+
+	select {
+	case file := <-saved:
+		if file != "/other:b.txt" {
+			t.Errorf("Expected only the other repository's view saved, got %s", file)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the other repository's view to be saved")
+	}
+	select {
+	case file := <-saved:
+		t.Errorf("Expected the discarded view not to be saved, got %s", file)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestResumeAtLastViewedFile tests that viewing a file records it in the review
+// state and that the file list offers to resume there
+func TestResumeAtLastViewedFile(t *testing.T) {
+	server, mockStorage, query := setupReviewAPITest(t)
+	overrideTemplate(t, server, "diff.html", `{{define "diff.html"}}[{{.ResumeFile}}]{{end}}`)
+	server.lastViewed.delay = 0
+
+	get := func(file string) string {
+		q := query.Encode()
+		if file != "" {
+			q += "&file=" + file
+		}
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest("GET", "/diff?"+q, nil))
+		return w.Body.String()
+	}
+
+	if body := get(""); !strings.Contains(body, "[]") {
+		t.Errorf("Expected nothing to resume before viewing a file, got %s", body)
+	}
+
+	get("b.txt")
+	if mockStorage.reviewState == nil || mockStorage.reviewState.LastViewedFile != "b.txt" {
+		t.Fatalf("Expected b.txt to be recorded as viewed last, got %+v", mockStorage.reviewState)
+	}
+	if body := get(""); !strings.Contains(body, "[b.txt]") {
+		t.Errorf("Expected to resume at b.txt, got %s", body)
+	}
+
+	// Reloading the same file doesn't save again, and unknown files aren't recorded
+	mockStorage.saveCalled = false
+	get("b.txt")
+	get("missing.txt")
+	if mockStorage.saveCalled || mockStorage.reviewState.LastViewedFile != "b.txt" {
+		t.Errorf("Expected no further save, got %+v", mockStorage.reviewState)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import "strings"
+
+// Intra-hunk line orders. The empty order keeps git's native interleaving.
+const (
+	lineOrderDeletionsFirst = "deletions-first"
+	lineOrderAdditionsFirst = "additions-first"
+)
+
+// lineOrders lists the non-default intra-hunk line orders
+var lineOrders = []string{lineOrderDeletionsFirst, lineOrderAdditionsFirst}
+
+// reorderDiffLines regroups the removed and added lines of every run of changes
+// inside the diff's hunks, so that deletions or additions come first. Context
+// lines and headers stay in place, and the relative order of lines of the same
+// kind is preserved. The empty order returns the lines unchanged, and so do
+// the hunks of combined diffs.
+func reorderDiffLines(lines []string, order string) []string {
+	if order != lineOrderDeletionsFirst && order != lineOrderAdditionsFirst {
+		return lines
+	}
+
+	reordered := make([]string, 0, len(lines))
+	var deletions, additions [][]string
+	// last points at the group the previous change line was added to, so a
+	// "\ No newline at end of file" marker travels with its line
+	var last *[][]string
+
+	flush := func() {
+		first, second := deletions, additions
+		if order == lineOrderAdditionsFirst {
+			first, second = additions, deletions
+		}
+		for _, group := range append(first, second...) {
+			reordered = append(reordered, group...)
+		}
+		deletions, additions, last = nil, nil, nil
+	}
+
+	inHunk := false
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			inHunk = false
+		case isCombinedDiffHeader(line):
+			flush()
+			inHunk = false
+		case strings.HasPrefix(line, "@@"):
+			flush()
+			// Lines of combined diffs have a column per parent, which a
+			// single order can't regroup, so they keep git's order
+			inHunk = !strings.HasPrefix(line, "@@@")
+		case inHunk && strings.HasPrefix(line, "-"):
+			deletions = append(deletions, []string{line})
+			last = &deletions
+			continue
+		case inHunk && strings.HasPrefix(line, "+"):
+			additions = append(additions, []string{line})
+			last = &additions
+			continue
+		case inHunk && strings.HasPrefix(line, "\\") && last != nil:
+			group := *last
+			group[len(group)-1] = append(group[len(group)-1], line)
+			continue
+		default:
+			flush()
+		}
+		reordered = append(reordered, line)
+	}
+	flush()
+
+	return reordered
+}
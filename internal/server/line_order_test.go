@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestReorderDiffLines(t *testing.T) {
+	lines := []string{
+		"diff --git a/file.txt b/file.txt",
+		"index 1111111..2222222 100644",
+		"--- a/file.txt",
+		"+++ b/file.txt",
+		"@@ -1,5 +1,5 @@",
+		" context",
+		"+added1",
+		"-removed1",
+		"+added2",
+		"-removed2",
+		" middle",
+		"+added3",
+		"-removed3",
+		"\\ No newline at end of file",
+	}
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{
+			order:    "",
+			expected: lines,
+		},
+		{
+			order: lineOrderDeletionsFirst,
+			expected: []string{
+				"diff --git a/file.txt b/file.txt",
+				"index 1111111..2222222 100644",
+				"--- a/file.txt",
+				"+++ b/file.txt",
+				"@@ -1,5 +1,5 @@",
+				" context",
+				"-removed1",
+				"-removed2",
+				"+added1",
+				"+added2",
+				" middle",
+				"-removed3",
+				"\\ No newline at end of file",
+				"+added3",
+			},
+		},
+		{
+			order: lineOrderAdditionsFirst,
+			expected: []string{
+				"diff --git a/file.txt b/file.txt",
+				"index 1111111..2222222 100644",
+				"--- a/file.txt",
+				"+++ b/file.txt",
+				"@@ -1,5 +1,5 @@",
+				" context",
+				"+added1",
+				"+added2",
+				"-removed1",
+				"-removed2",
+				" middle",
+				"+added3",
+				"-removed3",
+				"\\ No newline at end of file",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			if got := reorderDiffLines(lines, tt.order); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected:\n%v\ngot:\n%v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseViewOptionsLineOrder(t *testing.T) {
+	opts, err := parseViewOptions(url.Values{"line_order": {lineOrderDeletionsFirst}})
+	if err != nil {
+		t.Fatalf("parseViewOptions failed: %v", err)
+	}
+
+	if suffix := opts.querySuffix(); suffix != "&line_order=deletions-first" {
+		t.Errorf("Expected line order to persist in the query, got %q", suffix)
+	}
+
+	if _, err := parseViewOptions(url.Values{"line_order": {"bogus"}}); err == nil {
+		t.Error("Expected error for invalid line order, got nil")
+	}
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// gitDurationBuckets are the upper bounds, in seconds, of the git command
+// duration histogram
+var gitDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// WithMetrics counts the requests of every route and times the git commands
+// run for them, serving the counts in the Prometheus text format at /metrics.
+// Git commands are observed process-wide, so only one server of a process
+// should have metrics.
+func WithMetrics() Option {
+	return func(s *Server) {
+		s.metrics = newMetrics()
+		git.SetCommandObserver(s.metrics)
+	}
+}
+
+// requestKey identifies the requests counted together
+type requestKey struct {
+	route string
+	code  int
+}
+
+// histogram counts observations into cumulative buckets
+type histogram struct {
+	// counts[i] counts the observations up to gitDurationBuckets[i]
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// metrics holds the counters exported at /metrics. It implements
+// git.CommandObserver.
+type metrics struct {
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[string]*histogram
+	gitErrors map[string]uint64
+	// inFlight counts the git commands running right now
+	inFlight int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:  make(map[requestKey]uint64),
+		durations: make(map[string]*histogram),
+		gitErrors: make(map[string]uint64),
+	}
+}
+
+// CommandStarted counts a git command as running
+func (m *metrics) CommandStarted(subcommand string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight++
+}
+
+// CommandFinished records how long a git command ran and whether it failed
+func (m *metrics) CommandFinished(subcommand string, elapsed time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inFlight--
+	h, ok := m.durations[subcommand]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(gitDurationBuckets))}
+		m.durations[subcommand] = h
+	}
+	seconds := elapsed.Seconds()
+	for i, bound := range gitDurationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+
+	if err != nil {
+		m.gitErrors[subcommand]++
+	}
+}
+
+// countRequest counts a request served by route with the given status code
+func (m *metrics) countRequest(route string, code int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{route: route, code: code}]++
+}
+
+// write writes the metrics in the Prometheus text format, sorted so the
+// output is stable
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP diffty_http_requests_total Requests served, by route and status code.")
+	fmt.Fprintln(w, "# TYPE diffty_http_requests_total counter")
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "diffty_http_requests_total{route=%s,code=\"%d\"} %d\n", quoteLabel(key.route), key.code, m.requests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP diffty_git_commands_in_flight Git commands running right now.")
+	fmt.Fprintln(w, "# TYPE diffty_git_commands_in_flight gauge")
+	fmt.Fprintf(w, "diffty_git_commands_in_flight %d\n", m.inFlight)
+
+	fmt.Fprintln(w, "# HELP diffty_git_command_duration_seconds How long git commands ran, by subcommand.")
+	fmt.Fprintln(w, "# TYPE diffty_git_command_duration_seconds histogram")
+	for _, command := range sortedKeys(m.durations) {
+		h := m.durations[command]
+		label := quoteLabel(command)
+		for i, bound := range gitDurationBuckets {
+			fmt.Fprintf(w, "diffty_git_command_duration_seconds_bucket{command=%s,le=\"%s\"} %d\n", label, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "diffty_git_command_duration_seconds_bucket{command=%s,le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(w, "diffty_git_command_duration_seconds_sum{command=%s} %s\n", label, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "diffty_git_command_duration_seconds_count{command=%s} %d\n", label, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP diffty_git_command_errors_total Git commands that failed, by subcommand.")
+	fmt.Fprintln(w, "# TYPE diffty_git_command_errors_total counter")
+	for _, command := range sortedKeys(m.gitErrors) {
+		fmt.Fprintf(w, "diffty_git_command_errors_total{command=%s} %d\n", quoteLabel(command), m.gitErrors[command])
+	}
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// quoteLabel quotes a label value, escaping what the text format requires
+func quoteLabel(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return `"` + value + `"`
+}
+
+// statusRecorder remembers the status code a handler responded with. It
+// passes flushes on, so the events stream keeps working when it's measured.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// measured counts the requests next serves by the route pattern of mux that
+// matches them, so paths with parameters in the query don't each get a count
+func (s *Server) measured(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.code == 0 {
+			recorder.code = http.StatusOK
+		}
+		s.metrics.countRequest(route, recorder.code)
+	})
+}
+
+// handleMetrics serves the metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.write(w)
+}
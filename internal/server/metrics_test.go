@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+func TestMetrics(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	WithMetrics()(server)
+	t.Cleanup(func() { git.SetCommandObserver(nil) })
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+	router := server.Router()
+
+	get := func(target string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	get("/api/repositories")
+	get("/api/repositories")
+	get("/api/raw-diff?repo=" + url.QueryEscape(repoDir) + "&source=feature&target=main")
+	get("/api/raw-diff?repo=" + url.QueryEscape(repoDir) + "&source=does-not-exist&target=main")
+	get("/api/blob")
+
+	w := get("/metrics")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("Expected the Prometheus text format, got %s", contentType)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`diffty_http_requests_total{route="GET /api/repositories",code="200"} 2`,
+		`diffty_http_requests_total{route="GET /api/raw-diff",code="200"} 1`,
+		`diffty_http_requests_total{route="GET /api/raw-diff",code="422"} 1`,
+		`diffty_http_requests_total{route="GET /api/blob",code="400"} 1`,
+		"diffty_git_commands_in_flight 0",
+		`diffty_git_command_duration_seconds_bucket{command="diff",le="+Inf"} 2`,
+		`diffty_git_command_duration_seconds_count{command="diff"} 2`,
+		`diffty_git_command_errors_total{command="diff"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+
+	// The scrape itself is counted by the next one
+	if body := get("/metrics").Body.String(); !strings.Contains(body, `diffty_http_requests_total{route="GET /metrics",code="200"} 1`) {
+		t.Errorf("Expected the previous scrape to be counted, got:\n%s", body)
+	}
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	if strings.Contains(w.Body.String(), "diffty_http_requests_total") {
+		t.Error("Expected no metrics without WithMetrics")
+	}
+}
+
+func TestMetricsHistogram(t *testing.T) {
+	m := newMetrics()
+	m.CommandStarted("log")
+	m.CommandStarted("log")
+	m.CommandFinished("log", 20*time.Millisecond, nil)
+
+	var out strings.Builder
+	m.write(&out)
+	body := out.String()
+	for _, want := range []string{
+		"diffty_git_commands_in_flight 1",
+		`diffty_git_command_duration_seconds_bucket{command="log",le="0.01"} 0`,
+		`diffty_git_command_duration_seconds_bucket{command="log",le="0.025"} 1`,
+		`diffty_git_command_duration_seconds_bucket{command="log",le="10"} 1`,
+		`diffty_git_command_duration_seconds_sum{command="log"} 0.02`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+
+	m.CommandFinished("log", 30*time.Second, errors.New("killed"))
+	out.Reset()
+	m.write(&out)
+	body = out.String()
+	for _, want := range []string{
+		"diffty_git_commands_in_flight 0",
+		`diffty_git_command_duration_seconds_bucket{command="log",le="10"} 1`,
+		`diffty_git_command_duration_seconds_bucket{command="log",le="+Inf"} 2`,
+		`diffty_git_command_errors_total{command="log"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestStatusRecorderFlushes(t *testing.T) {
+	var w http.ResponseWriter = &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	if _, ok := w.(http.Flusher); !ok {
+		t.Error("Expected measured responses to support flushing, which the events stream needs")
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// modeChange is a change of a file's mode, such as its executable bit, read
+// from the "old mode" and "new mode" headers of its diff
+type modeChange struct {
+	Old string
+	New string
+	// ContentChanged reports whether the diff changes the file's content too
+	ContentChanged bool
+}
+
+// String summarises the change, such as "mode changed 644→755"
+func (m modeChange) String() string {
+	return fmt.Sprintf("mode changed %s→%s", shortMode(m.Old), shortMode(m.New))
+}
+
+// shortMode drops the file type from a git mode, leaving its permission bits
+func shortMode(mode string) string {
+	if len(mode) > 3 {
+		return mode[len(mode)-3:]
+	}
+	return mode
+}
+
+// parseModeChanges returns the mode changes of a diff, keyed by path. Files
+// whose mode didn't change aren't included.
+func parseModeChanges(diffText string) map[string]modeChange {
+	changes := make(map[string]modeChange)
+
+	var path string
+	var change modeChange
+	flush := func() {
+		if path != "" && change.Old != "" && change.New != "" {
+			changes[path] = change
+		}
+	}
+
+	for _, line := range strings.Split(diffText, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			path, change = "", modeChange{}
+			if paths := extractFilePathsFromDiff(line); len(paths) == 1 {
+				path = paths[0]
+			}
+		case strings.HasPrefix(line, "old mode "):
+			change.Old = strings.TrimPrefix(line, "old mode ")
+		case strings.HasPrefix(line, "new mode "):
+			change.New = strings.TrimPrefix(line, "new mode ")
+		case strings.HasPrefix(line, "@@"), strings.HasPrefix(line, "Binary files "):
+			change.ContentChanged = true
+		}
+	}
+	flush()
+
+	return changes
+}
+
+// annotateModeChanges records the mode change summary of each file under the
+// "ModeChange" key, and marks files whose only change is their mode under
+// "ModeOnly"
+func annotateModeChanges(files []map[string]string, diffText string) {
+	changes := parseModeChanges(diffText)
+	for _, file := range files {
+		change, ok := changes[file["Path"]]
+		if !ok {
+			continue
+		}
+		file["ModeChange"] = change.String()
+		if !change.ContentChanged {
+			file["ModeOnly"] = "true"
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// modeOnlyDiff is the diff of a file whose only change is its executable bit
+const modeOnlyDiff = `diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+`
+
+// modeAndContentDiff changes the mode and the content of one file, and only the content of another
+const modeAndContentDiff = `diff --git a/build.sh b/build.sh
+old mode 100755
+new mode 100644
+index 1111111..2222222
+--- a/build.sh
++++ b/build.sh
+@@ -1 +1,2 @@
+ echo build
++echo done
+diff --git a/main.go b/main.go
+index 3333333..4444444 100644
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-package old
++package main
+`
+
+func TestParseModeChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		diff     string
+		expected map[string]modeChange
+	}{
+		{
+			name:     "mode only",
+			diff:     modeOnlyDiff,
+			expected: map[string]modeChange{"run.sh": {Old: "100644", New: "100755"}},
+		},
+		{
+			name:     "mode and content",
+			diff:     modeAndContentDiff,
+			expected: map[string]modeChange{"build.sh": {Old: "100755", New: "100644", ContentChanged: true}},
+		},
+		{
+			name:     "both files",
+			diff:     modeOnlyDiff + modeAndContentDiff,
+			expected: map[string]modeChange{"run.sh": {Old: "100644", New: "100755"}, "build.sh": {Old: "100755", New: "100644", ContentChanged: true}},
+		},
+		{
+			name:     "new file",
+			diff:     "diff --git a/new.sh b/new.sh\nnew file mode 100755\nindex 0000000..1111111\n",
+			expected: map[string]modeChange{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := parseModeChanges(tt.diff)
+			if len(changes) != len(tt.expected) {
+				t.Fatalf("Expected %d mode changes, got %v", len(tt.expected), changes)
+			}
+			for path, expected := range tt.expected {
+				if changes[path] != expected {
+					t.Errorf("Expected %+v for %s, got %+v", expected, path, changes[path])
+				}
+			}
+		})
+	}
+
+	if summary := (modeChange{Old: "100644", New: "100755"}).String(); summary != "mode changed 644→755" {
+		t.Errorf("Unexpected summary: %s", summary)
+	}
+}
+
+func TestAnnotateModeChanges(t *testing.T) {
+	files := []map[string]string{{"Path": "run.sh"}, {"Path": "build.sh"}, {"Path": "main.go"}}
+	annotateModeChanges(files, modeOnlyDiff+modeAndContentDiff)
+
+	expected := []struct{ modeChange, modeOnly string }{
+		{"mode changed 644→755", "true"},
+		{"mode changed 755→644", ""},
+		{"", ""},
+	}
+	for i, file := range files {
+		if file["ModeChange"] != expected[i].modeChange || file["ModeOnly"] != expected[i].modeOnly {
+			t.Errorf("Unexpected annotation for %s: %q %q", file["Path"], file["ModeChange"], file["ModeOnly"])
+		}
+	}
+}
+
+// TestHandleDiffViewModeChange tests that mode changes are summarised in the file list and file view
+func TestHandleDiffViewModeChange(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .Files}}[{{.Path}}:{{.ModeChange}}:{{.ModeOnly}}]{{end}}{{if .SelectedFile}}|{{.ModeChange}}|{{.ModeOnly}}{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "config", "--local", "core.fileMode", "true")
+	writeFile(t, repoDir, "run.sh", "echo run\n")
+	writeFile(t, repoDir, "build.sh", "echo build\n")
+	runGit(t, repoDir, "add", "run.sh", "build.sh")
+	runGit(t, repoDir, "commit", "-m", "Add scripts")
+
+	runGit(t, repoDir, "checkout", "feature")
+	runGit(t, repoDir, "merge", "main")
+	writeFile(t, repoDir, "build.sh", "echo build\necho done\n")
+	for _, name := range []string{"run.sh", "build.sh"} {
+		if err := os.Chmod(filepath.Join(repoDir, name), 0755); err != nil {
+			t.Fatalf("Failed to make %s executable: %v", name, err)
+		}
+	}
+	runGit(t, repoDir, "add", "run.sh", "build.sh")
+	runGit(t, repoDir, "commit", "-m", "Make scripts executable")
+	runGit(t, repoDir, "checkout", "main")
+
+	mockStorage.repositories = []string{repoDir}
+
+	base := "/diff?repo=" + url.QueryEscape(repoDir) + "&source=feature&target=main"
+
+	w := httptest.NewRecorder()
+	server.handleDiffView(w, httptest.NewRequest("GET", base, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	for _, expected := range []string{"[run.sh:mode changed 644→755:true]", "[build.sh:mode changed 644→755:]", "[test.txt::]"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected the file list to contain %q, got %s", expected, body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	server.handleDiffView(w, httptest.NewRequest("GET", base+"&file=run.sh", nil))
+	if body := w.Body.String(); !strings.Contains(body, "|mode changed 644→755|true") {
+		t.Errorf("Expected the file view to summarise the mode change, got %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleDiffView(w, httptest.NewRequest("GET", base+"&file=build.sh", nil))
+	if body := w.Body.String(); !strings.Contains(body, "|mode changed 644→755|false") {
+		t.Errorf("Expected the file view to show the mode and content change, got %s", body)
+	}
+}
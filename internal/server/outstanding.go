@@ -0,0 +1,141 @@
+package server
+
+import (
+	"log"
+	"sync"
+
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/models"
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// outstandingStatesLimit bounds the review states read, newest first, to tell
+// the reviews in progress, so the index doesn't read the whole storage
+const outstandingStatesLimit = 200
+
+// maxChangedFileCounts bounds the comparisons changedFileCounts remembers
+const maxChangedFileCounts = 1024
+
+// changedFileCounts remembers the number of files of comparisons' default
+// diffs by repository and commit pair, which never changes, so saving a
+// review doesn't list the comparison's files again
+type changedFileCounts struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// changedFileCountKey names a comparison's commit pair in changedFileCounts
+func changedFileCountKey(repoPath, sourceCommit, targetCommit string) string {
+	return repoPath + "\x00" + sourceCommit + "\x00" + targetCommit
+}
+
+// get returns the remembered number of files of a commit pair's default diff
+func (c *changedFileCounts) get(repoPath, sourceCommit, targetCommit string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count, ok := c.counts[changedFileCountKey(repoPath, sourceCommit, targetCommit)]
+	return count, ok
+}
+
+// set remembers the number of files of a commit pair's default diff. Once
+// full, the remembered counts are dropped rather than growing without bound.
+func (c *changedFileCounts) set(repoPath, sourceCommit, targetCommit string, count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil || len(c.counts) >= maxChangedFileCounts {
+		c.counts = make(map[string]int)
+	}
+	c.counts[changedFileCountKey(repoPath, sourceCommit, targetCommit)] = count
+}
+
+// changedFiles returns the number of files of a comparison's default diff,
+// so the index can tell outstanding reviews from stored states alone. The
+// count is remembered from the diff view listing the files, or from the
+// first save of the commit pair, so later saves don't diff again. It's zero,
+// meaning unknown, for comparisons narrowed to a pathspec or when the files
+// can't be listed.
+func (s *Server) changedFiles(c comparison) int {
+	if c.Pathspec != "" {
+		return 0
+	}
+	if count, ok := s.changedFileCounts.get(c.RepoPath, c.SourceCommit, c.TargetCommit); ok {
+		return count
+	}
+	repo, exists, err := s.GetRepository(c.RepoPath)
+	if err != nil || !exists {
+		return 0
+	}
+	changes, err := repo.GetFilesWithStatus(c.SourceCommit, c.TargetCommit, s.diffOptions())
+	if err != nil {
+		log.Printf("Warning: failed to count the changed files: %v", err)
+		return 0
+	}
+	s.changedFileCounts.set(c.RepoPath, c.SourceCommit, c.TargetCommit, len(changes))
+	return len(changes)
+}
+
+// recordChangedFiles keeps the number of files of the comparison's default
+// diff with a review state about to be saved, unless it's unknown
+func recordChangedFiles(state *models.ReviewState, changed int) {
+	if changed > 0 {
+		state.ChangedFiles = changed
+	}
+}
+
+// markOutstanding sets the unreviewed files of each repository's comparisons
+// against its default branch that the user has in progress, going by the
+// stored review states only. A three-dot comparison counts when the merge base
+// it was stored against is its source's merge base with the default branch.
+// Comparisons are told apart by their branches, so only the newest state of a
+// branch pair counts; completed comparisons and states without a recorded
+// file count have nothing outstanding.
+func markOutstanding(entries []indexRepository, summaries []storage.ReviewStateSummary, user string) {
+	index := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		if entry.DefaultBranch != "" {
+			index[entry.Path] = i
+		}
+	}
+
+	type branches struct{ repo, source, target string }
+	seen := make(map[branches]bool)
+	mergeBases := make(map[string]string)
+	for _, summary := range summaries {
+		i, ok := index[summary.RepoPath]
+		if !ok || summary.User != user {
+			continue
+		}
+		entry := &entries[i]
+		if summary.TargetBranch != entry.DefaultBranch && !isMergeBaseOf(entry, summary, mergeBases) {
+			continue
+		}
+		key := branches{summary.RepoPath, summary.SourceBranch, entry.DefaultBranch}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if !summary.Completed && summary.Unreviewed > 0 {
+			entry.UnreviewedFiles += summary.Unreviewed
+			entry.OutstandingReviews++
+		}
+	}
+}
+
+// isMergeBaseOf reports whether summary is of a three-dot comparison against
+// the entry's default branch, whose target was replaced by the merge base.
+// Merge bases are cached in mergeBases by source commit.
+func isMergeBaseOf(entry *indexRepository, summary storage.ReviewStateSummary, mergeBases map[string]string) bool {
+	if summary.TargetBranch != summary.TargetCommit || !git.IsCommitHash(summary.TargetCommit) || !git.IsCommitHash(summary.SourceCommit) {
+		return false
+	}
+	key := entry.Path + "\x00" + summary.SourceCommit
+	base, ok := mergeBases[key]
+	if !ok {
+		var err error
+		if base, err = entry.GetMergeBase(summary.SourceCommit, entry.DefaultBranch); err != nil {
+			base = ""
+		}
+		mergeBases[key] = base
+	}
+	return base == summary.TargetCommit
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/models"
+	"github.com/darccio/diffty/internal/storage"
+)
+
+func TestMarkOutstanding(t *testing.T) {
+	now := time.Now()
+	summary := func(repo, source, target string, unreviewed int, age time.Duration) storage.ReviewStateSummary {
+		return storage.ReviewStateSummary{RepoPath: repo, SourceBranch: source, TargetBranch: target, ChangedFiles: 5, Unreviewed: unreviewed, ModTime: now.Add(-age)}
+	}
+	completed := summary("/one", "done", "main", 2, 0)
+	completed.Completed = true
+	otherUser := summary("/one", "theirs", "main", 3, 0)
+	otherUser.User = "alice"
+
+	entries := []indexRepository{
+		{Repository: &git.Repository{Path: "/one"}, DefaultBranch: "main"},
+		{Repository: &git.Repository{Path: "/two"}, DefaultBranch: "trunk"},
+		{Repository: &git.Repository{Path: "/three"}, DefaultBranch: "main"},
+		{Repository: &git.Repository{Path: "/unavailable"}},
+	}
+	// Newest first, as listed by the storage
+	markOutstanding(entries, []storage.ReviewStateSummary{
+		summary("/one", "feature", "main", 2, 0),
+		summary("/one", "fix", "main", 1, time.Minute),
+		summary("/one", "feature", "main", 4, time.Hour),
+		completed,
+		otherUser,
+		summary("/two", "feature", "main", 3, 0),
+		summary("/three", "feature", "main", 0, 0),
+		summary("/unavailable", "feature", "main", 3, 0),
+	}, "")
+
+	expected := []struct{ reviews, files int }{
+		// The older state of feature and the completed or other user's comparisons don't count
+		{reviews: 2, files: 3},
+		// Only comparisons against the default branch count
+		{reviews: 0, files: 0},
+		// Every file was reviewed
+		{reviews: 0, files: 0},
+		// Without a default branch there's nothing to compare against
+		{reviews: 0, files: 0},
+	}
+	for i, entry := range entries {
+		if entry.OutstandingReviews != expected[i].reviews || entry.UnreviewedFiles != expected[i].files {
+			t.Errorf("%s: expected %d reviews with %d unreviewed files, got %d with %d", entry.Path, expected[i].reviews, expected[i].files, entry.OutstandingReviews, entry.UnreviewedFiles)
+		}
+	}
+}
+
+// TestHandleIndexOutstanding tests that the index badges a repository whose
+// review against the default branch has files left, once the diff view
+// recorded how many files there are
+func TestHandleIndexOutstanding(t *testing.T) {
+	store, err := storage.OpenStorage(storage.DefaultBackend, storage.Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	server, err := New(store)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "other.txt", "other\n")
+	runGit(t, repoDir, "add", "other.txt")
+	runGit(t, repoDir, "commit", "-m", "Add other file")
+	runGit(t, repoDir, "checkout", "main")
+	runGit(t, repoDir, "commit", "--allow-empty", "-m", "Move main on")
+	if err := store.SaveRepositories([]string{repoDir}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+
+	get := func(path string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d for %s, got %d: %s", http.StatusOK, path, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	if body := get("/"); strings.Contains(body, `class="outstanding`) {
+		t.Error("Expected no badge before anything was reviewed")
+	}
+
+	review := func(target, targetCommit string) {
+		t.Helper()
+		query := url.Values{}
+		query.Set("repo", repoDir)
+		query.Set("source", "feature")
+		query.Set("target", target)
+		query.Set("source_commit", runGit(t, repoDir, "rev-parse", "feature"))
+		query.Set("target_commit", targetCommit)
+		query.Set("file", "test.txt")
+		query.Set("status", models.StateApproved)
+		req := httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+		}
+	}
+
+	// Saving the review records how many files there are
+	review("main", runGit(t, repoDir, "rev-parse", "main"))
+	summaries, err := store.ListRecentReviews(0)
+	if err != nil || len(summaries) != 1 {
+		t.Fatalf("Expected one stored review, got %v: %v", summaries, err)
+	}
+	if summaries[0].ChangedFiles != 2 {
+		t.Errorf("Expected the review to record 2 changed files, got %d", summaries[0].ChangedFiles)
+	}
+	if body := get("/"); !strings.Contains(body, `class="outstanding`) || !strings.Contains(body, "1 unreviewed") {
+		t.Errorf("Expected the repository to be badged with 1 unreviewed file, got %s", body)
+	}
+
+	// Viewing the diff doesn't save anything
+	get("/diff?repo=" + url.QueryEscape(repoDir) + "&source=feature&target=main")
+	if after, err := store.ListRecentReviews(0); err != nil || len(after) != 1 || !after[0].ModTime.Equal(summaries[0].ModTime) {
+		t.Errorf("Expected the stored review left alone by a GET, got %v: %v", after, err)
+	}
+
+	// A three-dot comparison is stored against the merge base, which still
+	// makes it a comparison against the default branch
+	mergeBase := runGit(t, repoDir, "merge-base", "main", "feature")
+	review(mergeBase, mergeBase)
+	summaries, err = store.ListRecentReviews(0)
+	if err != nil {
+		t.Fatalf("ListRecentReviews failed: %v", err)
+	}
+	var threeDot []storage.ReviewStateSummary
+	for _, summary := range summaries {
+		if summary.TargetBranch == mergeBase {
+			threeDot = append(threeDot, summary)
+		}
+	}
+	entries := server.indexRepositories([]*git.Repository{{Path: repoDir, Available: true}})
+	markOutstanding(entries, threeDot, "")
+	if entries[0].OutstandingReviews != 1 || entries[0].UnreviewedFiles != 1 {
+		t.Errorf("Expected the three-dot review outstanding with 1 unreviewed file, got %d with %d", entries[0].OutstandingReviews, entries[0].UnreviewedFiles)
+	}
+}
+
+// TestChangedFilesCached tests that the number of changed files is listed
+// once per commit pair, and taken from the diff view when it listed them
+func TestChangedFilesCached(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+	c := comparison{
+		RepoPath:     repoDir,
+		SourceCommit: runGit(t, repoDir, "rev-parse", "feature"),
+		TargetCommit: runGit(t, repoDir, "rev-parse", "main"),
+	}
+
+	if _, ok := server.changedFileCounts.get(c.RepoPath, c.SourceCommit, c.TargetCommit); ok {
+		t.Fatal("Expected nothing remembered before the comparison was viewed")
+	}
+	req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main", nil)
+	w := httptest.NewRecorder()
+	server.handleDiffView(w, req)
+	if count, ok := server.changedFileCounts.get(c.RepoPath, c.SourceCommit, c.TargetCommit); !ok || count != 1 {
+		t.Errorf("Expected the diff view to remember 1 changed file, got %d, %v", count, ok)
+	}
+
+	// A remembered count is used without asking git
+	server.changedFileCounts.set(c.RepoPath, c.SourceCommit, c.TargetCommit, 7)
+	if count := server.changedFiles(c); count != 7 {
+		t.Errorf("Expected the remembered count, got %d", count)
+	}
+
+	// Other view options list the files differently, so they aren't remembered
+	server.changedFileCounts = &changedFileCounts{}
+	req = httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&algorithm=patience", nil)
+	server.handleDiffView(httptest.NewRecorder(), req)
+	if _, ok := server.changedFileCounts.get(c.RepoPath, c.SourceCommit, c.TargetCommit); ok {
+		t.Error("Expected no count remembered from a view with other diff options")
+	}
+	if count := server.changedFiles(c); count != 1 {
+		t.Errorf("Expected 1 changed file listed by git, got %d", count)
+	}
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/models"
+)
+
+// Patch files are diffs generated outside of diffty, such as semantic diffs or
+// archived patches, reviewed from a directory set with WithPatchDir instead of
+// a live repository. The diff view shows one when its query has a patch
+// parameter naming a .diff or .patch file relative to that directory. Review
+// states of a patch are stored under the patch's path, keyed on a hash of its
+// content, so editing the file starts a new review.
+
+// patchMaxSize is the largest patch file, in bytes, that is loaded
+var patchMaxSize int64 = 10 << 20
+
+// Names shown as the compared refs of a patch
+const (
+	patchSourceName = "patched"
+	patchTargetName = "original"
+)
+
+// Errors returned when a patch file can't be loaded
+var (
+	ErrPatchesDisabled = errors.New("patch files aren't enabled on this server")
+	ErrPatchNotAllowed = errors.New("patch file is outside of the patch directory")
+	ErrPatchTooLarge   = errors.New("patch file is too large")
+)
+
+// WithPatchDir lets the diff view review the .diff and .patch files of dir,
+// named relative to it by the patch query parameter
+func WithPatchDir(dir string) Option {
+	return func(s *Server) {
+		if dir == "" {
+			s.patchDir = ""
+			return
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		s.patchDir = resolvePath(dir)
+	}
+}
+
+// patchFile is a loaded patch file
+type patchFile struct {
+	// Path is the absolute path of the file, which review states are stored under
+	Path string
+	// Name is the path of the file relative to the patch directory
+	Name string
+	Text string
+	// Hash is the SHA-256 of the file's content, standing in for both commits
+	Hash string
+}
+
+// comparison returns the comparison the review state of the patch is stored
+// under, reviewed by user
+func (p *patchFile) comparison(user string) comparison {
+	return comparison{
+		RepoPath:     p.Path,
+		SourceBranch: patchSourceName,
+		TargetBranch: patchTargetName,
+		SourceCommit: p.Hash,
+		TargetCommit: p.Hash,
+		User:         user,
+	}
+}
+
+// loadPatch reads the patch file name from the patch directory, refusing files
+// outside of it, without a .diff or .patch extension or over patchMaxSize
+func (s *Server) loadPatch(name string) (*patchFile, error) {
+	if s.patchDir == "" {
+		return nil, ErrPatchesDisabled
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext != ".diff" && ext != ".patch" {
+		return nil, fmt.Errorf("%w: %s isn't a .diff or .patch file", ErrPatchNotAllowed, name)
+	}
+
+	path := filepath.Join(s.patchDir, filepath.FromSlash(name))
+	if filepath.IsAbs(name) {
+		path = filepath.Clean(name)
+	}
+	path = resolvePath(path)
+	if !pathWithin(s.patchDir, path) {
+		return nil, fmt.Errorf("%w: %s", ErrPatchNotAllowed, name)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open patch %s: %w", name, err)
+	}
+	if info.Size() > patchMaxSize {
+		return nil, fmt.Errorf("%w: %s is %d bytes", ErrPatchTooLarge, name, info.Size())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch %s: %w", name, err)
+	}
+
+	rel, err := filepath.Rel(s.patchDir, path)
+	if err != nil {
+		rel = name
+	}
+	sum := sha256.Sum256(data)
+	return &patchFile{
+		Path: path,
+		Name: filepath.ToSlash(rel),
+		Text: normalizePatch(sanitizeUTF8(string(data))),
+		Hash: hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// patchErrorStatus maps a loadPatch failure to an HTTP status
+func patchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrPatchesDisabled), errors.Is(err, os.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, ErrPatchNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, ErrPatchTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// normalizePatch gives every file of a plain unified diff, as written by diff -u
+// and most other tools, the "diff --git" header git writes, which the diff
+// parsing relies on to tell files apart. Diffs written by git are unchanged.
+func normalizePatch(text string) string {
+	lines := strings.Split(text, "\n")
+	normalized := make([]string, 0, len(lines))
+	hasHeader := false
+	for i, line := range lines {
+		if _, combined := git.CombinedDiffPath(line); combined || strings.HasPrefix(line, "diff --git ") {
+			hasHeader = true
+		}
+
+		// A file starts with "--- old" directly followed by "+++ new"
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			if !hasHeader {
+				oldPath := patchHeaderPath(strings.TrimPrefix(line, "--- "), "a/")
+				newPath := patchHeaderPath(strings.TrimPrefix(lines[i+1], "+++ "), "b/")
+				if newPath == "/dev/null" {
+					newPath = oldPath
+				}
+				if oldPath == "/dev/null" {
+					oldPath = newPath
+				}
+				normalized = append(normalized, "diff --git a/"+oldPath+" b/"+newPath)
+			}
+			hasHeader = false
+		}
+
+		normalized = append(normalized, line)
+	}
+	return strings.Join(normalized, "\n")
+}
+
+// isCombinedDiff reports whether a diff has files in the combined format git
+// writes for merge commits
+func isCombinedDiff(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if isCombinedDiffHeader(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// patchHeaderPath returns the path of a "---" or "+++" header, without the
+// timestamp diff -u appends after a tab or git's a/ and b/ prefix
+func patchHeaderPath(header, prefix string) string {
+	path, _, _ := strings.Cut(header, "\t")
+	path = strings.TrimSpace(path)
+	if path == "/dev/null" {
+		return path
+	}
+	return strings.TrimPrefix(path, prefix)
+}
+
+// handlePatchView renders the diff view of a patch file, reusing the file list,
+// diff rendering and review states of the git diff view
+func (s *Server) handlePatchView(w http.ResponseWriter, r *http.Request, viewOpts viewOptions) {
+	patch, err := s.loadPatch(viewOpts.Patch)
+	if err != nil {
+		s.renderError(w, r, "Patch Error", err.Error(), patchErrorStatus(err))
+		return
+	}
+
+	filePath := r.URL.Query().Get("file")
+	user := userFromRequest(r)
+
+	c := patch.comparison(user)
+	reviewState, err := s.storage.LoadReviewState(c.RepoPath, c.User, c.SourceBranch, c.TargetBranch, c.SourceCommit, c.TargetCommit)
+	if err != nil {
+		reviewState = &models.ReviewState{
+			ReviewedFiles: []models.FileReview{},
+			SourceBranch:  patchSourceName,
+			TargetBranch:  patchTargetName,
+			SourceCommit:  patch.Hash,
+			TargetCommit:  patch.Hash,
+		}
+	}
+
+	data := map[string]interface{}{
+		"Patch":               patch.Name,
+		"RepoPath":            patch.Path,
+		"RepoName":            patch.Name,
+		"SourceBranch":        patchSourceName,
+		"TargetBranch":        patchTargetName,
+		"SourceCommit":        patch.Hash,
+		"TargetCommit":        patch.Hash,
+		"Error":               "",
+		"NoDiff":              strings.TrimSpace(patch.Text) == "",
+		"ReviewState":         reviewState,
+		"ViewOptions":         viewOpts,
+		"ViewQuery":           viewOpts.querySuffix(),
+		"FilterQuery":         viewOpts.withFilter("").querySuffix(),
+		"ViewParams":          viewOpts.values(),
+		"RequireRejectReason": s.requireRejectReason,
+		"Completion":          completionBadge(reviewState),
+		"CombinedDiff":        isCombinedDiff(patch.Text),
+	}
+
+	files := extractFilesFromDiff(patch.Text, reviewState, patch.Path)
+	annotateModeChanges(files, patch.Text)
+	annotateRenames(files, patch.Text)
+	annotateChangeTypes(files, parseChangeTypes(patch.Text))
+	if viewOpts.FileOrder != "" {
+		sortFiles(files, viewOpts.FileOrder)
+	}
+	data["Files"] = files
+	data["TotalFiles"] = len(files)
+
+	if filePath == "" {
+		setFileListFilters(data, files, viewOpts)
+		s.render(w, r, "diff.html", data)
+		return
+	}
+
+	diffText := git.ExtractFileDiff(patch.Text, filePath)
+	if diffText == "" {
+		log.Printf("Warning: file %s isn't part of patch %s", filePath, patch.Name)
+		s.renderError(w, r, "Not Found", fmt.Sprintf("File %s is not part of this patch", filePath), http.StatusNotFound)
+		return
+	}
+
+	data["SelectedFile"] = filePath
+	diffLines := parseDiffLines(filePath, reorderDiffLines(strings.Split(diffText, "\n"), viewOpts.LineOrder))
+	expandTabs(diffLines, viewOpts.TabWidth)
+	data["DiffLines"] = diffLines
+	if change, ok := parseModeChanges(diffText)[filePath]; ok {
+		data["ModeChange"] = change.String()
+		data["ModeOnly"] = !change.ContentChanged
+	}
+	if rename, ok := parseRenames(diffText)[filePath]; ok {
+		data["Rename"] = rename.String()
+		data["RenamedFrom"] = rename.From
+	}
+
+	fileStatus, _ := reviewState.FileStatus(patch.Path, filePath)
+	data["FileStatus"] = fileStatus
+	data["FileStat"] = buildFileStat(filePath, diffLines, fileStatus)
+
+	for i, file := range files {
+		if file["Path"] != filePath {
+			continue
+		}
+		data["RejectReason"] = file["Reason"]
+		if i+1 < len(files) {
+			data["NextFilePath"] = files[i+1]["Path"]
+		}
+	}
+
+	s.render(w, r, "diff.html", data)
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPatch is a git diff changing one file and adding another
+const testPatch = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+ package main
+-var answer = 41
++var answer = 42
+ func main() {}
+diff --git a/docs/notes.md b/docs/notes.md
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/docs/notes.md
+@@ -0,0 +1 @@
++Remember the answer
+`
+
+// setupPatchDir writes a patch file to a new patch directory of the server
+func setupPatchDir(t *testing.T, server *Server, name, content string) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create patch directory: %v", err)
+	}
+	writeFile(t, filepath.Dir(path), filepath.Base(path), content)
+	WithPatchDir(dir)(server)
+	return dir
+}
+
+func TestNormalizePatch(t *testing.T) {
+	plain := strings.Join([]string{
+		"--- src/app.c\t2024-01-01 12:00:00.000000000 +0100",
+		"+++ src/app.c\t2024-01-02 12:00:00.000000000 +0100",
+		"@@ -1 +1 @@",
+		"-old",
+		"+new",
+		"--- /dev/null",
+		"+++ b/added.txt",
+		"@@ -0,0 +1 @@",
+		"+added",
+	}, "\n")
+
+	normalized := normalizePatch(plain)
+	for _, header := range []string{"diff --git a/src/app.c b/src/app.c", "diff --git a/added.txt b/added.txt"} {
+		if !strings.Contains(normalized, header+"\n") {
+			t.Errorf("Expected header %q, got:\n%s", header, normalized)
+		}
+	}
+
+	if got := normalizePatch(testPatch); got != testPatch {
+		t.Errorf("Expected a git diff to be unchanged, got:\n%s", got)
+	}
+}
+
+func TestHandlePatchView(t *testing.T) {
+	server, _ := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{.Patch}} {{.SourceCommit}} {{range .Files}}[{{.Path}}]{{end}}{{range .DiffLines}}{{.Text}}|{{end}}`)
+	setupPatchDir(t, server, "fixes/answer.patch", testPatch)
+
+	sum := sha256.Sum256([]byte(testPatch))
+	hash := hex.EncodeToString(sum[:])
+
+	req := httptest.NewRequest("GET", "/diff?patch="+url.QueryEscape("fixes/answer.patch"), nil)
+	w := httptest.NewRecorder()
+	server.handleDiffView(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "fixes/answer.patch "+hash) {
+		t.Errorf("Expected the patch to be keyed on its hash, got %s", body)
+	}
+	if !strings.Contains(body, "[main.go]") || !strings.Contains(body, "[docs/notes.md]") {
+		t.Errorf("Expected both files of the patch, got %s", body)
+	}
+
+	req = httptest.NewRequest("GET", "/diff?patch="+url.QueryEscape("fixes/answer.patch")+"&file=main.go", nil)
+	w = httptest.NewRecorder()
+	server.handleDiffView(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	body = w.Body.String()
+	if !strings.Contains(body, "-var answer = 41|&#43;var answer = 42|") {
+		t.Errorf("Expected the diff of main.go, got %s", body)
+	}
+	if strings.Contains(body, "Remember the answer") {
+		t.Errorf("Expected only the diff of main.go, got %s", body)
+	}
+
+	req = httptest.NewRequest("GET", "/diff?patch="+url.QueryEscape("fixes/answer.patch")+"&file=missing.go", nil)
+	w = httptest.NewRecorder()
+	server.handleDiffView(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a file outside of the patch, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestHandlePatchViewRefused tests that only .diff and .patch files inside of
+// the patch directory and below the size cap are loaded
+func TestHandlePatchViewRefused(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	get := func(name string) int {
+		req := httptest.NewRequest("GET", "/diff?patch="+url.QueryEscape(name), nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		return w.Code
+	}
+
+	if code := get("answer.patch"); code != http.StatusNotFound {
+		t.Errorf("Expected status code %d without a patch directory, got %d", http.StatusNotFound, code)
+	}
+
+	dir := setupPatchDir(t, server, "answer.patch", testPatch)
+	outside := filepath.Join(t.TempDir(), "secret.patch")
+	writeFile(t, filepath.Dir(outside), "secret.patch", testPatch)
+	if err := os.Symlink(outside, filepath.Join(dir, "link.patch")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	writeFile(t, dir, "notes.txt", testPatch)
+
+	tests := []struct {
+		name string
+		code int
+	}{
+		{"answer.patch", http.StatusOK},
+		{"missing.diff", http.StatusNotFound},
+		{"notes.txt", http.StatusForbidden},
+		{"../" + filepath.Base(filepath.Dir(outside)) + "/secret.patch", http.StatusForbidden},
+		{outside, http.StatusForbidden},
+		{"link.patch", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if code := get(tt.name); code != tt.code {
+			t.Errorf("Expected status code %d for %s, got %d", tt.code, tt.name, code)
+		}
+	}
+
+	original := patchMaxSize
+	patchMaxSize = int64(len(testPatch) - 1)
+	t.Cleanup(func() { patchMaxSize = original })
+	if code := get("answer.patch"); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d for a patch over the size cap, got %d", http.StatusRequestEntityTooLarge, code)
+	}
+}
+
+// TestHandleReviewStatePatch tests that reviewing a file of a patch comes back
+// to the patch
+func TestHandleReviewStatePatch(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	dir := setupPatchDir(t, server, "answer.patch", testPatch)
+	patchPath := filepath.Join(resolvePath(dir), "answer.patch")
+
+	query := url.Values{
+		"repo":          {patchPath},
+		"source":        {patchSourceName},
+		"target":        {patchTargetName},
+		"source_commit": {"abc"},
+		"target_commit": {"abc"},
+		"file":          {"main.go"},
+		"status":        {"approved"},
+	}
+	form := url.Values{"patch": {"answer.patch"}}
+	req := httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.handleReviewState(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+	if location := w.Header().Get("Location"); !strings.Contains(location, "patch=answer.patch") {
+		t.Errorf("Expected the redirect to keep the patch, got %s", location)
+	}
+	if status, _ := mockStorage.reviewState.FileStatus(patchPath, "main.go"); status != "approved" {
+		t.Errorf("Expected main.go to be approved, got %s", status)
+	}
+}
+
+// TestHandleReviewStateFromPatchView tests reviewing a file with the
+// comparison a patch view renders into its review forms, which names the patch
+// file instead of a repository
+func TestHandleReviewStateFromPatchView(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	WithCurrentCommitCheck()(server)
+	overrideTemplate(t, server, "diff.html", `[{{.RepoPath}}|{{.SourceBranch}}|{{.TargetBranch}}|{{.SourceCommit}}|{{.TargetCommit}}]`)
+	setupPatchDir(t, server, "answer.patch", testPatch)
+
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, httptest.NewRequest("GET", "/diff?patch=answer.patch&file=main.go", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	fields := strings.Split(body[strings.Index(body, "[")+1:strings.Index(body, "]")], "|")
+	if len(fields) != 5 {
+		t.Fatalf("Expected the comparison of the patch view, got %s", body)
+	}
+	patchPath := fields[0]
+
+	query := url.Values{
+		"repo":          {patchPath},
+		"source":        {fields[1]},
+		"target":        {fields[2]},
+		"source_commit": {fields[3]},
+		"target_commit": {fields[4]},
+		"file":          {"main.go"},
+		"status":        {"approved"},
+	}
+	form := url.Values{"patch": {"answer.patch"}}
+	req := httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+	if status, _ := mockStorage.reviewState.FileStatus(patchPath, "main.go"); status != "approved" {
+		t.Errorf("Expected main.go to be approved, got %s", status)
+	}
+
+	// The patch decides where the review is stored, not the posted comparison
+	query.Set("repo", "/somewhere/else")
+	req = httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if location := w.Header().Get("Location"); !strings.Contains(location, url.QueryEscape(patchPath)) {
+		t.Errorf("Expected the review to stay on the patch, got %d redirecting to %s", w.Code, location)
+	}
+}
+
+// TestHandlePatchViewCombinedDiff tests that a combined diff of a merge lists
+// its files and is flagged as such instead of being mangled
+func TestHandlePatchViewCombinedDiff(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "merge.diff"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	if paths := extractFilePathsFromDiff(string(content)); strings.Join(paths, " ") != "app.txt notes.md" {
+		t.Errorf("Expected the files of the combined diff, got %q", paths)
+	}
+	if got := normalizePatch(string(content)); got != string(content) {
+		t.Errorf("Expected a combined diff to be unchanged, got:\n%s", got)
+	}
+	if got := reorderDiffLines(strings.Split(string(content), "\n"), lineOrderAdditionsFirst); strings.Join(got, "\n") != string(content) {
+		t.Errorf("Expected combined hunks to keep their order, got:\n%s", strings.Join(got, "\n"))
+	}
+
+	server, _ := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{if .CombinedDiff}}combined {{end}}{{range .Files}}[{{.Path}}]{{end}}{{range .DiffLines}}{{.Text}}|{{end}}`)
+	setupPatchDir(t, server, "merge.diff", string(content))
+
+	req := httptest.NewRequest("GET", "/diff?patch=merge.diff&file=notes.md", nil)
+	w := httptest.NewRecorder()
+	server.handleDiffView(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "combined [app.txt][notes.md]diff --cc notes.md|") {
+		t.Errorf("Expected the combined diff of notes.md, got %s", body)
+	}
+	if strings.Contains(body, "TWO merged") {
+		t.Errorf("Expected only the diff of notes.md, got %s", body)
+	}
+}
+
+// TestHandlePatchViewReaddedFile tests that a patch series deleting a file and
+// adding it back lists it once, as modified, with both sections in its diff
+func TestHandlePatchViewReaddedFile(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "readd.patch"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	server, _ := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .Files}}[{{.Path}}:{{.Change}}]{{end}}{{range .DiffLines}}{{.Text}}|{{end}}`)
+	setupPatchDir(t, server, "readd.patch", string(content))
+
+	req := httptest.NewRequest("GET", "/diff?patch=readd.patch", nil)
+	w := httptest.NewRecorder()
+	server.handleDiffView(w, req)
+	if body := w.Body.String(); strings.Count(body, "[config.yml:") != 1 || !strings.Contains(body, "[config.yml:M]") || !strings.Contains(body, "[link:T]") || !strings.Contains(body, "[scratch.txt:]") {
+		t.Errorf("Expected every file once with its net change type, got %s", body)
+	}
+
+	req = httptest.NewRequest("GET", "/diff?patch=readd.patch&file=config.yml", nil)
+	w = httptest.NewRecorder()
+	server.handleDiffView(w, req)
+	if body := w.Body.String(); !strings.Contains(body, "|-port: 80|") || !strings.Contains(body, "|&#43;port: 8080|") {
+		t.Errorf("Expected the diff of config.yml to show the deletion and the re-addition, got %s", body)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// handlePathDiff compares two explicitly chosen files across the branches:
+// the old path at the target branch against the new path at the source
+// branch. It covers files git doesn't relate by itself, such as a file split
+// out of another. Without both paths it only shows the form to pick them.
+// Given source_commit and target_commit, as the diff view links with, the
+// files are read at those commits rather than at the branch tips.
+func (s *Server) handlePathDiff(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	repoPath := query.Get("repo")
+	sourceBranch := query.Get("source")
+	targetBranch := query.Get("target")
+	oldPath := query.Get("old")
+	newPath := query.Get("new")
+
+	if repoPath == "" || sourceBranch == "" || targetBranch == "" {
+		s.renderError(w, r, "Missing Parameters", "Missing required parameters for path comparison", http.StatusBadRequest)
+		return
+	}
+
+	repo, exists, err := s.GetRepository(repoPath)
+	if err != nil {
+		s.renderError(w, r, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
+		return
+	}
+	if !exists {
+		s.renderError(w, r, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	c := comparison{RepoPath: repoPath, SourceCommit: query.Get("source_commit"), TargetCommit: query.Get("target_commit")}
+	sourceRef, targetRef := sourceBranch, targetBranch
+	if c.SourceCommit != "" || c.TargetCommit != "" {
+		if c.SourceCommit == "" || c.TargetCommit == "" {
+			s.renderError(w, r, "Missing Parameters", "Both source_commit and target_commit are required to compare files at pinned commits", http.StatusBadRequest)
+			return
+		}
+		if err := verifyCommitsExist(repo, c); err != nil {
+			s.renderError(w, r, "Commit Not Found", err.Error(), commitErrorStatus(err))
+			return
+		}
+		sourceRef, targetRef = c.SourceCommit, c.TargetCommit
+	}
+
+	data := map[string]interface{}{
+		"RepoPath":     repoPath,
+		"RepoName":     filepath.Base(repoPath),
+		"SourceBranch": sourceBranch,
+		"TargetBranch": targetBranch,
+		"OldPath":      oldPath,
+		"NewPath":      newPath,
+		"SourceCommit": c.SourceCommit,
+		"TargetCommit": c.TargetCommit,
+	}
+
+	if oldPath != "" && newPath != "" {
+		diffText, err := repo.GetPathDiff(targetRef, oldPath, sourceRef, newPath)
+		switch {
+		case errors.Is(err, git.ErrPathNotFound):
+			w.WriteHeader(http.StatusNotFound)
+			data["Error"] = fmt.Sprintf("Neither %s at %s nor %s at %s exists", oldPath, targetBranch, newPath, sourceBranch)
+		case err != nil:
+			w.WriteHeader(diffErrorStatus(err))
+			data["Error"] = fmt.Sprintf("Failed to load diff: %v", err)
+		case diffText == "":
+			data["Identical"] = true
+		default:
+			data["DiffLines"] = parseDiffLines(newPath, strings.Split(sanitizeUTF8(diffText), "\n"))
+		}
+	}
+
+	s.render(w, r, "paths.html", data)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestHandlePathDiff tests comparing two differently named files across the branches
+func TestHandlePathDiff(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "paths.html", `{{define "paths.html"}}{{.OldPath}}->{{.NewPath}}|{{.Error}}|{{.Identical}}|{{range .DiffLines}}{{.Text}}
+{{end}}{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	reviewed := runGit(t, repoDir, "rev-parse", "feature")
+	mainCommit := runGit(t, repoDir, "rev-parse", "main")
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "split.txt", "new line\n")
+	runGit(t, repoDir, "add", "split.txt")
+	runGit(t, repoDir, "commit", "-m", "Split a file")
+	runGit(t, repoDir, "checkout", "main")
+
+	mockStorage.repositories = []string{repoDir}
+	base := "/paths?repo=" + url.QueryEscape(repoDir) + "&target=main"
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expected       []string
+	}{
+		{
+			name:           "form only",
+			query:          "&source=feature",
+			expectedStatus: http.StatusOK,
+			expected:       []string{"->||"},
+		},
+		{
+			name:           "different names",
+			query:          "&source=feature&old=test.txt&new=split.txt",
+			expectedStatus: http.StatusOK,
+			expected:       []string{"--- a/test.txt", "&#43;&#43;&#43; b/split.txt", "-initial content", "&#43;new line"},
+		},
+		{
+			name:           "missing old side",
+			query:          "&source=feature&old=split.txt&new=split.txt",
+			expectedStatus: http.StatusOK,
+			expected:       []string{"--- /dev/null", "&#43;new line"},
+		},
+		{
+			name:           "identical",
+			query:          "&source=main&old=test.txt&new=test.txt",
+			expectedStatus: http.StatusOK,
+			expected:       []string{"|true|"},
+		},
+		{
+			name:           "neither side",
+			query:          "&source=feature&old=nope.txt&new=nope.txt",
+			expectedStatus: http.StatusNotFound,
+			expected:       []string{"Neither nope.txt at main nor nope.txt at feature exists"},
+		},
+		{
+			// The file split out after the reviewed commit isn't there yet
+			name:           "pinned commits",
+			query:          "&source=feature&old=test.txt&new=split.txt&source_commit=" + reviewed + "&target_commit=" + mainCommit,
+			expectedStatus: http.StatusOK,
+			expected:       []string{"--- a/test.txt", "&#43;&#43;&#43; /dev/null", "-initial content"},
+		},
+		{
+			name:           "one pinned commit",
+			query:          "&source=feature&old=test.txt&new=split.txt&source_commit=" + reviewed,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown pinned commit",
+			query:          "&source=feature&old=test.txt&new=split.txt&source_commit=0123456789012345678901234567890123456789&target_commit=" + mainCommit,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			server.handlePathDiff(w, httptest.NewRequest("GET", base+tt.query, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, w.Code)
+			}
+			body := w.Body.String()
+			for _, expected := range tt.expected {
+				if !strings.Contains(body, expected) {
+					t.Errorf("Expected body to contain %q, got %s", expected, body)
+				}
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	server.handlePathDiff(w, httptest.NewRequest("GET", "/paths?repo="+url.QueryEscape(repoDir), nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without branches, got %d", http.StatusBadRequest, w.Code)
+	}
+}
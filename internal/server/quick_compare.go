@@ -0,0 +1,101 @@
+package server
+
+import (
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// quickCompareTTL is how long the branches detected for the index's quick
+// comparisons are reused before git is asked again
+const quickCompareTTL = 30 * time.Second
+
+// indexRepository is a repository as listed on the index, with the quick
+// comparison of its current branch against its default branch
+type indexRepository struct {
+	*git.Repository
+	CurrentBranch string
+	DefaultBranch string
+	// QuickCompareURL opens the diff of the current branch against the default
+	// branch; empty when there's nothing to compare, such as on the default
+	// branch itself or on a detached HEAD
+	QuickCompareURL string
+	// OutstandingReviews counts the comparisons against the default branch
+	// in progress with files left to review, see markOutstanding
+	OutstandingReviews int
+	// UnreviewedFiles is the number of files left to review in them
+	UnreviewedFiles int
+}
+
+// repositoryBranches caches the current and default branches of repositories
+type repositoryBranches struct {
+	mu      sync.Mutex
+	entries map[string]repositoryBranchesEntry
+	// now returns the current time, swapped in tests
+	now func() time.Time
+}
+
+// repositoryBranchesEntry is the cached branches of a repository
+type repositoryBranchesEntry struct {
+	current, defaultBranch string
+	expires                time.Time
+}
+
+// get returns the current and default branches of repo, asking git when
+// they aren't cached or expired. Failures are logged and leave the branches
+// empty, as the index works without them.
+func (b *repositoryBranches) get(repo *git.Repository) (current, defaultBranch string) {
+	now := time.Now()
+	if b.now != nil {
+		now = b.now()
+	}
+
+	b.mu.Lock()
+	entry, ok := b.entries[repo.Path]
+	b.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.current, entry.defaultBranch
+	}
+
+	current, err := repo.GetCurrentBranch()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	defaultBranch, err = repo.GetDefaultBranch()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	b.mu.Lock()
+	if b.entries == nil {
+		b.entries = make(map[string]repositoryBranchesEntry)
+	}
+	b.entries[repo.Path] = repositoryBranchesEntry{current: current, defaultBranch: defaultBranch, expires: now.Add(quickCompareTTL)}
+	b.mu.Unlock()
+
+	return current, defaultBranch
+}
+
+// indexRepositories adds the quick comparison of each available repository
+// to the index's repository list
+func (s *Server) indexRepositories(repos []*git.Repository) []indexRepository {
+	entries := make([]indexRepository, 0, len(repos))
+	for _, repo := range repos {
+		entry := indexRepository{Repository: repo}
+		if repo.Available {
+			entry.CurrentBranch, entry.DefaultBranch = s.repositoryBranches.get(repo)
+		}
+		if entry.CurrentBranch != "" && entry.DefaultBranch != "" && entry.CurrentBranch != entry.DefaultBranch {
+			query := url.Values{}
+			query.Set("repo", repo.Path)
+			query.Set("source", entry.CurrentBranch)
+			query.Set("target", entry.DefaultBranch)
+			entry.QuickCompareURL = "/diff?" + query.Encode()
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// TestIndexRepositories tests that the index offers to review the current
+// branch against the default branch, caching the branches it detected
+func TestIndexRepositories(t *testing.T) {
+	server, _ := setupTestServer(t)
+	now := time.Now()
+	server.repositoryBranches.now = func() time.Time { return now }
+
+	repoDir := setupGitRepo(t)
+	repo := git.NewRepository(repoDir)
+	repo.Available = true
+	unavailable := git.NewRepository(t.TempDir())
+
+	entries := server.indexRepositories([]*git.Repository{repo, unavailable})
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].CurrentBranch != "main" || entries[0].DefaultBranch != "main" || entries[0].QuickCompareURL != "" {
+		t.Errorf("Expected nothing to compare on the default branch, got %+v", entries[0])
+	}
+	if entries[1].CurrentBranch != "" || entries[1].QuickCompareURL != "" {
+		t.Errorf("Expected no branches for an unavailable repository, got %+v", entries[1])
+	}
+
+	// The branches are reused until they expire
+	runGit(t, repoDir, "checkout", "feature")
+	if entry := server.indexRepositories([]*git.Repository{repo})[0]; entry.CurrentBranch != "main" {
+		t.Errorf("Expected the cached current branch, got %+v", entry)
+	}
+
+	now = now.Add(quickCompareTTL)
+	entry := server.indexRepositories([]*git.Repository{repo})[0]
+	expected := "/diff?" + url.Values{"repo": {repoDir}, "source": {"feature"}, "target": {"main"}}.Encode()
+	if entry.CurrentBranch != "feature" || entry.QuickCompareURL != expected {
+		t.Errorf("Expected a quick comparison of feature against main, got %+v", entry)
+	}
+
+	// A detached HEAD has no branch to review
+	runGit(t, repoDir, "checkout", "--detach", "feature")
+	now = now.Add(quickCompareTTL)
+	if entry := server.indexRepositories([]*git.Repository{repo})[0]; entry.CurrentBranch != "" || entry.QuickCompareURL != "" {
+		t.Errorf("Expected no quick comparison on a detached HEAD, got %+v", entry)
+	}
+}
+
+// TestHandleIndexQuickCompare tests that the index renders the quick comparison
+func TestHandleIndexQuickCompare(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "index.html", `{{define "index.html"}}{{range .Repositories}}{{.Name}}:{{.CurrentBranch}}:{{.QuickCompareURL}};{{end}}{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	mockStorage.repositories = []string{repoDir}
+
+	w := httptest.NewRecorder()
+	server.handleIndex(w, httptest.NewRequest("GET", "/", nil))
+
+	if body := w.Body.String(); !strings.Contains(body, ":feature:/diff?repo=") {
+		t.Errorf("Expected a quick comparison of feature, got %s", body)
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxEventStreams is how many event streams a client may hold open at once
+// when the rate is limited
+const maxEventStreams = 8
+
+// maxRateLimitClients is how many clients the rate limiter tracks before it
+// forgets the ones that are back to a full allowance
+const maxRateLimitClients = 1024
+
+// WithRateLimit limits every client to perMinute requests per minute on the
+// routes that run git, in bursts of up to perMinute requests. Clients are told
+// apart by user when authentication is enabled, and by IP address otherwise.
+// Zero or a negative value means unlimited.
+func WithRateLimit(perMinute int) Option {
+	return func(s *Server) {
+		if perMinute > 0 {
+			s.rateLimiter = newRateLimiter(perMinute, time.Minute)
+			s.eventStreams = &streamLimiter{max: maxEventStreams}
+		}
+	}
+}
+
+// rateLimiter is a token bucket per client: each client may spend burst
+// requests at once, and gets them back at a steady rate
+type rateLimiter struct {
+	mu sync.Mutex
+	// rate is how many requests a client gets back per second
+	rate    float64
+	burst   float64
+	clients map[string]*rateBucket
+	// now returns the current time, swapped in tests
+	now func() time.Time
+}
+
+// rateBucket is the allowance left to a client as of its last request
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing requests per the given period
+func newRateLimiter(requests int, period time.Duration) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(requests) / period.Seconds(),
+		burst:   float64(requests),
+		clients: make(map[string]*rateBucket),
+		now:     time.Now,
+	}
+}
+
+// allow spends one request of the client's allowance. When none is left, it
+// returns false along with how long until the next request is allowed.
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	bucket, ok := l.clients[client]
+	if !ok {
+		if len(l.clients) >= maxRateLimitClients {
+			l.forgetIdle(now)
+		}
+		bucket = &rateBucket{tokens: l.burst, last: now}
+		l.clients[client] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// forgetIdle drops the clients whose allowance is full again, since a new
+// bucket would be the same
+func (l *rateLimiter) forgetIdle(now time.Time) {
+	for client, bucket := range l.clients {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// rateLimited wraps a handler that runs git with the rate limit, if enabled.
+// Requests over the limit are answered with 429 and a Retry-After header.
+func (s *Server) rateLimited(next http.HandlerFunc) http.HandlerFunc {
+	if s.rateLimiter == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed, wait := s.rateLimiter.allow(rateLimitClient(r))
+		if !allowed {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			s.respondError(w, r, "Too Many Requests", fmt.Sprintf("Too many requests, try again in %d seconds", seconds), http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// streamLimiter counts the streams each client holds open
+type streamLimiter struct {
+	mu      sync.Mutex
+	max     int
+	clients map[string]int
+}
+
+// acquire opens a stream for the client, unless it holds max of them already
+func (l *streamLimiter) acquire(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.clients[client] >= l.max {
+		return false
+	}
+	if l.clients == nil {
+		l.clients = make(map[string]int)
+	}
+	l.clients[client]++
+	return true
+}
+
+// release closes a stream of the client
+func (l *streamLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.clients[client] <= 1 {
+		delete(l.clients, client)
+		return
+	}
+	l.clients[client]--
+}
+
+// streamLimited wraps a streaming handler with the limit of open streams per
+// client, if the rate is limited. Streams aren't charged to the rate limit:
+// a page keeps one open while it's shown and browsers reconnect it on their
+// own, which would use up the allowance of the requests that review. Clients
+// holding too many streams are answered with 429.
+func (s *Server) streamLimited(next http.HandlerFunc) http.HandlerFunc {
+	if s.eventStreams == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := rateLimitClient(r)
+		if !s.eventStreams.acquire(client) {
+			s.respondError(w, r, "Too Many Requests", fmt.Sprintf("Too many open event streams, at most %d are allowed", s.eventStreams.max), http.StatusTooManyRequests)
+			return
+		}
+		defer s.eventStreams.release(client)
+		next(w, r)
+	}
+}
+
+// rateLimitClient identifies the client of a request for rate limiting: its
+// user when authenticated, its IP address otherwise
+func rateLimitClient(r *http.Request) string {
+	if user := userFromRequest(r); user != "" {
+		return "user:" + user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(2, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.allow("a"); !allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	allowed, wait := limiter.allow("a")
+	if allowed {
+		t.Fatal("Expected the third request to be limited")
+	}
+	if wait != 30*time.Second {
+		t.Errorf("Expected to wait 30s for the next request, got %v", wait)
+	}
+
+	// Other clients have an allowance of their own
+	if allowed, _ := limiter.allow("b"); !allowed {
+		t.Error("Expected another client to be allowed")
+	}
+
+	now = now.Add(30 * time.Second)
+	if allowed, _ := limiter.allow("a"); !allowed {
+		t.Error("Expected a request to be allowed once the allowance refilled")
+	}
+	if allowed, _ := limiter.allow("a"); allowed {
+		t.Error("Expected the refilled allowance to be a single request")
+	}
+}
+
+// TestRateLimitedRoutes tests that the routes running git answer 429 past the
+// limit while the others keep working
+func TestRateLimitedRoutes(t *testing.T) {
+	server, _ := setupTestServer(t)
+	WithRateLimit(3)(server)
+	router := server.Router()
+
+	get := func(target, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := get("/diff", "192.0.2.1:1234"); w.Code == http.StatusTooManyRequests {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	w := get("/compare", "192.0.2.1:5678")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d past the limit, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retryAfter < 1 {
+		t.Errorf("Expected a Retry-After in seconds, got %q", w.Header().Get("Retry-After"))
+	}
+
+	if w := get("/diff", "192.0.2.2:1234"); w.Code == http.StatusTooManyRequests {
+		t.Error("Expected another client to be allowed")
+	}
+	if w := get("/api/repositories", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected routes not running git to be unlimited, got %d", w.Code)
+	}
+
+	// The index checks the repositories' branches, file history scans the
+	// stored reviews and saving a description loads the commits, so they are
+	// limited as well
+	for _, route := range []struct{ method, target string }{
+		{"GET", "/"},
+		{"GET", "/api/file-history"},
+		{"POST", "/api/review-state/description"},
+	} {
+		req := httptest.NewRequest(route.method, route.target, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected %s %s to be limited, got %d", route.method, route.target, w.Code)
+		}
+	}
+
+	// Without the option nothing is limited
+	server, _ = setupTestServer(t)
+	router = server.Router()
+	for i := 0; i < 10; i++ {
+		if w := get("/diff", "192.0.2.1:1234"); w.Code == http.StatusTooManyRequests {
+			t.Fatal("Expected no rate limit by default")
+		}
+	}
+}
+
+// TestStreamLimited tests that event streams aren't charged to the rate limit,
+// but that a client can only hold so many of them open
+func TestStreamLimited(t *testing.T) {
+	server, _ := setupTestServer(t)
+	WithRateLimit(1)(server)
+	router := server.Router()
+
+	serve := func(handler http.Handler, target, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	serve(router, "/diff", "192.0.2.1:1234")
+	if w := serve(router, "/diff", "192.0.2.1:1234"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the allowance to be used up, got %d", w.Code)
+	}
+	if w := serve(router, "/api/events", "192.0.2.1:1234"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the event stream not to be rate limited, got %d", w.Code)
+	}
+
+	// Streams count while they are open
+	opened := make(chan struct{})
+	closeStreams := make(chan struct{})
+	stream := server.streamLimited(func(w http.ResponseWriter, r *http.Request) {
+		opened <- struct{}{}
+		<-closeStreams
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < maxEventStreams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(stream, "/api/events", "192.0.2.1:1234")
+		}()
+		<-opened
+	}
+
+	if w := serve(stream, "/api/events", "192.0.2.1:5678"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d past the open streams limit, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	go serve(stream, "/api/events", "192.0.2.2:1234")
+	<-opened
+
+	close(closeStreams)
+	wg.Wait()
+	go serve(stream, "/api/events", "192.0.2.1:1234")
+	select {
+	case <-opened:
+	case <-time.After(time.Second):
+		t.Error("Expected a stream to be allowed again once the others closed")
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// defaultMaxDiffBytes is the diff byte limit unless WithMaxDiffBytes sets another
+const defaultMaxDiffBytes = 100 << 20
+
+// WithMaxDiffBytes caps how many bytes of a diff's output are read into
+// memory for a request. The diff view shows diffs over the limit as such,
+// with a link to download them from /api/raw-diff, which streams them instead.
+// Zero or less reads diffs of any size.
+func WithMaxDiffBytes(n int64) Option {
+	return func(s *Server) {
+		s.maxDiffBytes = max(n, 0)
+	}
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// rawDiffURL returns the /api/raw-diff URL of the diff between two refs with
+// the given view's diff options, limited to filePath unless it's empty
+func rawDiffURL(repoPath, sourceRef, targetRef, filePath string, viewOpts viewOptions) string {
+	query := viewOptions{Diff: viewOpts.Diff}.values()
+	query.Set("repo", repoPath)
+	query.Set("source", sourceRef)
+	query.Set("target", targetRef)
+	if filePath != "" {
+		query.Set("file", filePath)
+	}
+	return (&url.URL{Path: "/api/raw-diff", RawQuery: query.Encode()}).String()
+}
+
+// handleRawDiff streams the plain diff between two refs as a download,
+// straight from git and without the diff byte limit, so diffs too large to
+// show can still be read. The file parameter limits it to a single file, and
+// the diff options of the diff view, such as the algorithm, apply.
+func (s *Server) handleRawDiff(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	repoPath := query.Get("repo")
+	filePath := query.Get("file")
+	sourceRef := query.Get("source_commit")
+	if sourceRef == "" {
+		sourceRef = query.Get("source")
+	}
+	targetRef := query.Get("target_commit")
+	if targetRef == "" {
+		targetRef = query.Get("target")
+	}
+	if repoPath == "" || sourceRef == "" || targetRef == "" {
+		writeJSONError(w, "Missing Parameters", "Missing required parameters for a raw diff", http.StatusBadRequest)
+		return
+	}
+	if strings.HasPrefix(sourceRef, "-") || strings.HasPrefix(targetRef, "-") {
+		writeJSONError(w, "Invalid Ref", "Refs can't start with a dash", http.StatusBadRequest)
+		return
+	}
+
+	viewOpts, err := parseViewOptions(query)
+	if err != nil {
+		writeJSONError(w, "Invalid View Options", err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := viewOpts.Diff
+	if s.noRenames {
+		opts.NoRenames = true
+		opts.FindCopiesHarder = false
+	}
+	if filePath != "" {
+		if !opts.InScope(filePath) {
+			writeJSONError(w, "Not Found", fmt.Sprintf("File %s is outside of the pathspec", filePath), http.StatusNotFound)
+			return
+		}
+		opts.Pathspec = filePath
+		if err := opts.Validate(); err != nil {
+			writeJSONError(w, "Invalid File", err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	repo, exists, err := s.GetRepository(repoPath)
+	if err != nil {
+		writeJSONError(w, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
+		return
+	}
+	if !exists {
+		writeJSONError(w, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	name := filepath.Base(repoPath)
+	if filePath != "" {
+		name = filepath.Base(filePath)
+	}
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".diff"}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	out := &countingWriter{w: w}
+	if err := repo.WriteDiff(out, sourceRef, targetRef, opts); err != nil {
+		// Once the diff started streaming, its status can't change anymore
+		if out.n > 0 {
+			log.Printf("Warning: raw diff of %s interrupted: %v", repoPath, err)
+			return
+		}
+		w.Header().Del("Content-Disposition")
+		writeJSONError(w, "Diff Error", err.Error(), diffErrorStatus(err))
+	}
+}
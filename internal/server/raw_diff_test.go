@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestDiffTooLarge tests that diffs over the byte limit are shown as such with
+// a link to the raw diff, which streams them in full
+func TestDiffTooLarge(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{if .DiffTooLarge}}too large {{.RawDiffURL}}{{else}}{{range .DiffLines}}{{.Text}}|{{end}}{{end}}`)
+	WithMaxDiffBytes(4096)(server)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "huge.txt", strings.Repeat("generated line\n", 1000))
+	runGit(t, repoDir, "add", "huge.txt")
+	runGit(t, repoDir, "commit", "-m", "Add huge file")
+	runGit(t, repoDir, "checkout", "main")
+	mockStorage.repositories = []string{repoDir}
+	base := "repo=" + url.QueryEscape(repoDir) + "&source=feature&target=main"
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+	rawURL := func(body string) string {
+		_, link, found := strings.Cut(body, "too large ")
+		if !found {
+			t.Fatalf("Expected the diff to be too large, got %s", body)
+		}
+		link, _, _ = strings.Cut(link, "<")
+		return strings.ReplaceAll(link, "&amp;", "&")
+	}
+
+	w := get("/diff?" + base)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	raw := get(rawURL(w.Body.String()))
+	if raw.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d for the raw diff, got %d: %s", http.StatusOK, raw.Code, raw.Body.String())
+	}
+	if body := raw.Body.String(); !strings.Contains(body, "diff --git a/huge.txt b/huge.txt") || !strings.Contains(body, "+new line") ||
+		strings.Count(body, "+generated line") != 1000 {
+		t.Errorf("Expected the whole raw diff, got %d bytes", len(body))
+	}
+	if disposition := raw.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment") {
+		t.Errorf("Expected the raw diff as a download, got %q", disposition)
+	}
+
+	// Small files still show, the huge one links to its own raw diff
+	if body := get("/diff?" + base + "&file=test.txt").Body.String(); !strings.Contains(body, "|&#43;new line|") {
+		t.Errorf("Expected the diff of test.txt, got %s", body)
+	}
+	w = get("/diff?" + base + "&file=huge.txt")
+	raw = get(rawURL(w.Body.String()))
+	if body := raw.Body.String(); strings.Contains(body, "test.txt") || strings.Count(body, "+generated line") != 1000 {
+		t.Errorf("Expected the raw diff of huge.txt alone, got %d bytes", len(body))
+	}
+
+	if w := get("/api/file-diff?" + base + "&file=huge.txt&line=1"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d from the file diff API, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	if w := get("/api/raw-diff?repo=" + url.QueryEscape(repoDir) + "&source=does-not-exist&target=main"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code %d for a missing ref, got %d: %s", http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	}
+}
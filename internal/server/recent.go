@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/url"
+	"path/filepath"
+
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// recentReviewsLimit is the number of recent reviews listed on the index
+const recentReviewsLimit = 10
+
+// recentReview is a recently saved review state as listed on the index
+type recentReview struct {
+	storage.ReviewStateSummary
+	RepoName string
+	// Moved reports whether either branch no longer points at the commit the
+	// review was recorded against, or no longer exists
+	Moved bool
+	// ResumeURL opens the review at the commits it was recorded against and
+	// the file viewed last
+	ResumeURL string
+	// LatestURL opens the comparison at the current branch tips
+	LatestURL string
+}
+
+// recentReviews turns the summaries of the user's recent review states into
+// index entries, checking each against the current branch tips. Reviews of
+// other users and of repositories that are no longer available are left out
+// before keeping the first limit entries, or all of them for a limit of 0.
+func recentReviews(summaries []storage.ReviewStateSummary, user string, limit int) []recentReview {
+	reviews := []recentReview{}
+	for _, summary := range summaries {
+		if limit > 0 && len(reviews) == limit {
+			break
+		}
+		if summary.User != user || !git.IsValidRepo(summary.RepoPath) {
+			continue
+		}
+
+		latest := url.Values{}
+		latest.Set("repo", summary.RepoPath)
+		latest.Set("source", summary.SourceBranch)
+		latest.Set("target", summary.TargetBranch)
+
+		review := recentReview{
+			ReviewStateSummary: summary,
+			RepoName:           filepath.Base(summary.RepoPath),
+			LatestURL:          "/diff?" + latest.Encode(),
+		}
+
+		repo := git.NewRepository(summary.RepoPath)
+		sourceCommit, sourceErr := repo.GetBranchCommitHash(summary.SourceBranch)
+		targetCommit, targetErr := targetCommitOf(repo, summary.SourceBranch, sourceCommit, summary.TargetBranch)
+		review.Moved = sourceErr != nil || targetErr != nil ||
+			sourceCommit != summary.SourceCommit || targetCommit != summary.TargetCommit
+
+		review.ResumeURL = review.LatestURL
+		if review.Moved && git.IsCommitHash(summary.SourceCommit) && git.IsCommitHash(summary.TargetCommit) {
+			// Pin the recorded commits so the review resumes where it was left
+			pinned := url.Values{}
+			pinned.Set("repo", summary.RepoPath)
+			pinned.Set("source", summary.SourceBranch)
+			pinned.Set("target", summary.TargetBranch)
+			pinned.Set("source_commit", summary.SourceCommit)
+			pinned.Set("target_commit", summary.TargetCommit)
+			pinned.Set("pin", "1")
+			review.ResumeURL = "/diff?" + pinned.Encode()
+		}
+
+		// Resume at the file viewed last
+		if summary.LastViewedFile != "" {
+			review.ResumeURL += "&file=" + url.QueryEscape(summary.LastViewedFile)
+		}
+
+		reviews = append(reviews, review)
+	}
+
+	return reviews
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// TestRecentReviews tests that recent reviews link to where they were left and flag moved branches
+func TestRecentReviews(t *testing.T) {
+	repoDir := setupGitRepo(t)
+	mainCommit := strings.TrimSpace(runGit(t, repoDir, "rev-parse", "main"))
+	oldFeatureCommit := strings.TrimSpace(runGit(t, repoDir, "rev-parse", "feature"))
+
+	// Move feature past the commit the first review was recorded against
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "test.txt", "initial content\nnew line\nanother line\n")
+	runGit(t, repoDir, "commit", "-am", "Add another line")
+	runGit(t, repoDir, "checkout", "main")
+	featureCommit := strings.TrimSpace(runGit(t, repoDir, "rev-parse", "feature"))
+
+	summaries := []storage.ReviewStateSummary{
+		{RepoPath: repoDir, SourceBranch: "feature", TargetBranch: "main", SourceCommit: featureCommit, TargetCommit: mainCommit, ModTime: time.Now()},
+		{RepoPath: repoDir, SourceBranch: "feature", TargetBranch: "main", SourceCommit: oldFeatureCommit, TargetCommit: mainCommit, LastViewedFile: "test.txt", ModTime: time.Now()},
+		{RepoPath: repoDir, SourceBranch: "gone", TargetBranch: "main", SourceCommit: oldFeatureCommit, TargetCommit: mainCommit, ModTime: time.Now()},
+		{RepoPath: repoDir, User: "alice", SourceBranch: "feature", TargetBranch: "main", SourceCommit: featureCommit, TargetCommit: mainCommit},
+		{RepoPath: t.TempDir(), SourceBranch: "feature", TargetBranch: "main", SourceCommit: featureCommit, TargetCommit: mainCommit},
+	}
+
+	reviews := recentReviews(summaries, "", 0)
+	if len(reviews) != 3 {
+		t.Fatalf("Expected the other user's review and the unavailable repository to be left out, got %d reviews", len(reviews))
+	}
+
+	latest := "/diff?" + url.Values{"repo": {repoDir}, "source": {"feature"}, "target": {"main"}}.Encode()
+
+	current := reviews[0]
+	if current.Moved {
+		t.Error("Expected a review at the branch tips not to be flagged as moved")
+	}
+	if current.ResumeURL != latest || current.LatestURL != latest {
+		t.Errorf("Expected a review at the branch tips to resume at the latest commits, got %s and %s", current.ResumeURL, current.LatestURL)
+	}
+
+	moved := reviews[1]
+	if !moved.Moved {
+		t.Error("Expected a review of an older commit to be flagged as moved")
+	}
+	resume, err := url.Parse(moved.ResumeURL)
+	if err != nil {
+		t.Fatalf("Failed to parse resume URL: %v", err)
+	}
+	query := resume.Query()
+	if query.Get("pin") != "1" || query.Get("source_commit") != oldFeatureCommit || query.Get("target_commit") != mainCommit {
+		t.Errorf("Expected the moved review to resume pinned at its recorded commits, got %s", moved.ResumeURL)
+	}
+	if query.Get("file") != "test.txt" {
+		t.Errorf("Expected the moved review to resume at the file viewed last, got %s", moved.ResumeURL)
+	}
+	if moved.LatestURL != latest {
+		t.Errorf("Expected the latest link to follow the branches, got %s", moved.LatestURL)
+	}
+
+	if !reviews[2].Moved {
+		t.Error("Expected a review of a deleted branch to be flagged as moved")
+	}
+}
+
+// TestHandleIndexRecentReviews tests that the index lists the recent reviews
+func TestHandleIndexRecentReviews(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "index.html", `{{define "index.html"}}{{range .RecentReviews}}<a href="{{.ResumeURL}}">{{.RepoName}}</a>{{end}}{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	mainCommit := strings.TrimSpace(runGit(t, repoDir, "rev-parse", "main"))
+	featureCommit := strings.TrimSpace(runGit(t, repoDir, "rev-parse", "feature"))
+	mockStorage.recent = []storage.ReviewStateSummary{
+		{RepoPath: repoDir, SourceBranch: "feature", TargetBranch: "main", SourceCommit: featureCommit, TargetCommit: mainCommit},
+	}
+
+	w := httptest.NewRecorder()
+	server.handleIndex(w, httptest.NewRequest("GET", "/", nil))
+
+	body := w.Body.String()
+	if !strings.Contains(body, "/diff?repo="+url.QueryEscape(repoDir)) {
+		t.Errorf("Expected the index to link to the recent review, got %s", body)
+	}
+}
+
+// TestHandleIndexRecentReviewsOfUser tests that the index lists the user's
+// recent reviews when other users saved more reviews since
+func TestHandleIndexRecentReviewsOfUser(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	WithAuthTokens(map[string]string{"alice": "alice-token", "bob": "bob-token"})(server)
+	overrideTemplate(t, server, "index.html", `{{define "index.html"}}{{range .RecentReviews}}[{{.User}}]{{end}}{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	mainCommit := runGit(t, repoDir, "rev-parse", "main")
+	featureCommit := runGit(t, repoDir, "rev-parse", "feature")
+	mockStorage.recent = nil
+	for i := 0; i < recentReviewsLimit+2; i++ {
+		mockStorage.recent = append(mockStorage.recent, storage.ReviewStateSummary{RepoPath: repoDir, User: "alice", SourceBranch: "feature", TargetBranch: "main", SourceCommit: featureCommit, TargetCommit: mainCommit})
+	}
+	mockStorage.recent = append(mockStorage.recent, storage.ReviewStateSummary{RepoPath: repoDir, User: "bob", SourceBranch: "feature", TargetBranch: "main", SourceCommit: featureCommit, TargetCommit: mainCommit})
+
+	get := func(token string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	if body := get("bob-token"); strings.Count(body, "[bob]") != 1 || strings.Contains(body, "[alice]") {
+		t.Errorf("Expected bob's own review, got %s", body)
+	}
+	if body := get("alice-token"); strings.Count(body, "[alice]") != recentReviewsLimit {
+		t.Errorf("Expected %d of alice's reviews, got %s", recentReviewsLimit, body)
+	}
+}
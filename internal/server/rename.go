@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fileRename is a rename git detected in a diff, read from the "similarity
+// index", "rename from" and "rename to" headers of the renamed file. Copies,
+// with "copy from" and "copy to" headers, are read the same way.
+type fileRename struct {
+	From string
+	To   string
+	// Similarity is the percentage of the file's content left unchanged
+	Similarity int
+	// Copy tells a copy, which leaves From in place, apart from a rename
+	Copy bool
+}
+
+// String summarises the rename, such as "renamed (87% similar)" or
+// "copied (100% similar)"
+func (r fileRename) String() string {
+	if r.Copy {
+		return fmt.Sprintf("copied (%d%% similar)", r.Similarity)
+	}
+	return fmt.Sprintf("renamed (%d%% similar)", r.Similarity)
+}
+
+// parseRenames returns the renames and copies of a diff, keyed by the new path
+func parseRenames(diffText string) map[string]fileRename {
+	renames := make(map[string]fileRename)
+
+	var rename fileRename
+	flush := func() {
+		if rename.From != "" && rename.To != "" {
+			renames[rename.To] = rename
+		}
+	}
+
+	for _, line := range strings.Split(diffText, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			rename = fileRename{}
+		case strings.HasPrefix(line, "similarity index "):
+			percent := strings.TrimSuffix(strings.TrimPrefix(line, "similarity index "), "%")
+			rename.Similarity, _ = strconv.Atoi(percent)
+		case strings.HasPrefix(line, "rename from "):
+			rename.From = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to "):
+			rename.To = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "copy from "):
+			rename.From = strings.TrimPrefix(line, "copy from ")
+			rename.Copy = true
+		case strings.HasPrefix(line, "copy to "):
+			rename.To = strings.TrimPrefix(line, "copy to ")
+		}
+	}
+	flush()
+
+	return renames
+}
+
+// annotateRenames records the path each renamed or copied file came from
+// under the "RenamedFrom" key, and its summary under "Rename"
+func annotateRenames(files []map[string]string, diffText string) {
+	renames := parseRenames(diffText)
+	for _, file := range files {
+		rename, ok := renames[file["Path"]]
+		if !ok {
+			continue
+		}
+		file["RenamedFrom"] = rename.From
+		file["Rename"] = rename.String()
+	}
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// renameWithEditsDiff renames a file while changing one of its lines, next to
+// a plain rename and a modified file
+const renameWithEditsDiff = `diff --git a/pkg/old_name.go b/pkg/new_name.go
+similarity index 87%
+rename from pkg/old_name.go
+rename to pkg/new_name.go
+index 1111111..2222222 100644
+--- a/pkg/old_name.go
++++ b/pkg/new_name.go
+@@ -1,4 +1,4 @@
+ package pkg
+ 
+-func Old() {}
++func New() {}
+ 
+diff --git a/docs/a.md b/docs/b.md
+similarity index 100%
+rename from docs/a.md
+rename to docs/b.md
+diff --git a/main.go b/main.go
+index 3333333..4444444 100644
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-package old
++package main
+`
+
+func TestParseRenames(t *testing.T) {
+	renames := parseRenames(renameWithEditsDiff)
+
+	expected := map[string]fileRename{
+		"pkg/new_name.go": {From: "pkg/old_name.go", To: "pkg/new_name.go", Similarity: 87},
+		"docs/b.md":       {From: "docs/a.md", To: "docs/b.md", Similarity: 100},
+	}
+	if len(renames) != len(expected) {
+		t.Fatalf("Expected %d renames, got %v", len(expected), renames)
+	}
+	for path, rename := range expected {
+		if renames[path] != rename {
+			t.Errorf("Expected %+v for %s, got %+v", rename, path, renames[path])
+		}
+	}
+
+	if summary := renames["pkg/new_name.go"].String(); summary != "renamed (87% similar)" {
+		t.Errorf("Unexpected summary: %s", summary)
+	}
+}
+
+// copyDiff copies a file without changing it, as git diff --find-copies-harder shows it
+const copyDiff = `diff --git a/pkg/util.go b/pkg/util_copy.go
+similarity index 100%
+copy from pkg/util.go
+copy to pkg/util_copy.go
+`
+
+func TestParseRenamesCopy(t *testing.T) {
+	renames := parseRenames(copyDiff)
+
+	expected := fileRename{From: "pkg/util.go", To: "pkg/util_copy.go", Similarity: 100, Copy: true}
+	if renames["pkg/util_copy.go"] != expected {
+		t.Fatalf("Expected %+v, got %v", expected, renames)
+	}
+	if summary := expected.String(); summary != "copied (100% similar)" {
+		t.Errorf("Unexpected summary: %s", summary)
+	}
+}
+
+func TestAnnotateRenames(t *testing.T) {
+	files := []map[string]string{{"Path": "pkg/new_name.go"}, {"Path": "docs/b.md"}, {"Path": "main.go"}}
+	annotateRenames(files, renameWithEditsDiff)
+
+	expected := []struct{ rename, from string }{
+		{"renamed (87% similar)", "pkg/old_name.go"},
+		{"renamed (100% similar)", "docs/a.md"},
+		{"", ""},
+	}
+	for i, file := range files {
+		if file["Rename"] != expected[i].rename || file["RenamedFrom"] != expected[i].from {
+			t.Errorf("Unexpected annotation for %s: %q %q", file["Path"], file["Rename"], file["RenamedFrom"])
+		}
+	}
+}
+
+// TestHandleDiffViewRenameWithEdits tests that a file renamed with edits shows
+// its similarity and only the lines that changed
+func TestHandleDiffViewRenameWithEdits(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .Files}}[{{.Path}}:{{.Rename}}:{{.RenamedFrom}}]{{end}}{{if .SelectedFile}}|{{.Rename}}|{{.RenamedFrom}}|{{range .DiffLines}}{{.}};{{end}}{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	content := "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\nline 9\nline 10\n"
+	writeFile(t, repoDir, "old.txt", content)
+	runGit(t, repoDir, "add", "old.txt")
+	runGit(t, repoDir, "commit", "-m", "Add old.txt")
+
+	runGit(t, repoDir, "checkout", "feature")
+	runGit(t, repoDir, "merge", "main")
+	runGit(t, repoDir, "mv", "old.txt", "new.txt")
+	writeFile(t, repoDir, "new.txt", strings.Replace(content, "line 5", "line five", 1))
+	runGit(t, repoDir, "commit", "-am", "Rename old.txt")
+	runGit(t, repoDir, "checkout", "main")
+
+	mockStorage.repositories = []string{repoDir}
+
+	base := "/diff?repo=" + url.QueryEscape(repoDir) + "&source=feature&target=main"
+
+	w := httptest.NewRecorder()
+	server.handleDiffView(w, httptest.NewRequest("GET", base, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "[new.txt:renamed (86% similar):old.txt]") {
+		t.Errorf("Expected the file list to show the rename, got %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleDiffView(w, httptest.NewRequest("GET", base+"&file=new.txt", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, "|renamed (86% similar)|old.txt|") {
+		t.Errorf("Expected the file view to show the rename, got %s", body)
+	}
+	if !strings.Contains(body, "-line 5;") || !strings.Contains(body, "&#43;line five;") {
+		t.Errorf("Expected the file view to show the edit, got %s", body)
+	}
+	if strings.Contains(body, "&#43;line 1;") {
+		t.Errorf("Expected the file view to show only the edit, not the whole file, got %s", body)
+	}
+}
+
+// TestHandleDiffViewWithoutRenames tests that rename detection can be turned
+// off per view and for the whole server
+func TestHandleDiffViewWithoutRenames(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .Files}}[{{.Path}}:{{.Change}}:{{.Rename}}]{{end}}|{{.ViewQuery}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	runGit(t, repoDir, "mv", "test.txt", "renamed.txt")
+	runGit(t, repoDir, "commit", "-m", "Rename test.txt")
+	runGit(t, repoDir, "checkout", "main")
+
+	mockStorage.repositories = []string{repoDir}
+
+	render := func(query string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	if body := render(""); !strings.Contains(body, "[renamed.txt:R:renamed (") {
+		t.Errorf("Expected the rename to be detected by default, got %s", body)
+	}
+
+	body := render("&no_renames=1")
+	if !strings.Contains(body, "[renamed.txt:A:]") || !strings.Contains(body, "[test.txt:D:]") {
+		t.Errorf("Expected a deletion and an addition without rename detection, got %s", body)
+	}
+	if !strings.Contains(body, "no_renames=1") {
+		t.Errorf("Expected the option to persist in the view query, got %s", body)
+	}
+
+	// Turned off server-wide, it applies to every view
+	WithoutRenameDetection()(server)
+	if body := render(""); !strings.Contains(body, "[renamed.txt:A:]") {
+		t.Errorf("Expected the server option to turn rename detection off, got %s", body)
+	}
+}
+
+// TestHandleDiffViewFindCopies tests that copies of unchanged files are only
+// detected when asked for
+func TestHandleDiffViewFindCopies(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .Files}}[{{.Path}}:{{.Change}}:{{.Rename}}:{{.RenamedFrom}}]{{end}}|{{.ViewQuery}}`)
+
+	// test.txt is the same on both sides, so only -C -C considers it as a source
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "-b", "copy")
+	writeFile(t, repoDir, "copy.txt", "initial content\n")
+	runGit(t, repoDir, "add", "copy.txt")
+	runGit(t, repoDir, "commit", "-m", "Copy test.txt")
+	runGit(t, repoDir, "checkout", "main")
+
+	mockStorage.repositories = []string{repoDir}
+
+	render := func(query string) (int, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=copy&target=main"+query, nil))
+		return w.Code, w.Body.String()
+	}
+
+	if _, body := render(""); !strings.Contains(body, "[copy.txt:A::]") {
+		t.Errorf("Expected the copy to show as added by default, got %s", body)
+	}
+
+	code, body := render("&find_copies=1")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, code, body)
+	}
+	if !strings.Contains(body, "[copy.txt:C:copied (100% similar):test.txt]") {
+		t.Errorf("Expected the copy to be detected, got %s", body)
+	}
+	if !strings.Contains(body, "find_copies=1") {
+		t.Errorf("Expected the option to persist in the view query, got %s", body)
+	}
+
+	if code, _ := render("&find_copies=1&no_renames=1"); code != http.StatusBadRequest {
+		t.Errorf("Expected copy detection without rename detection to be refused, got %d", code)
+	}
+
+	// Turned off server-wide, rename detection takes copy detection with it
+	WithoutRenameDetection()(server)
+	if _, body := render("&find_copies=1"); !strings.Contains(body, "[copy.txt:A::]") {
+		t.Errorf("Expected the server option to turn copy detection off, got %s", body)
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/models"
+)
+
+// reportFormatHTML is a single HTML document with its styles inlined, which
+// opens without diffty or a network connection
+const reportFormatHTML = "html"
+
+// reportFormats lists the formats /api/report can export a review in
+var reportFormats = []string{reportFormatHTML}
+
+// reportFile is a changed file of a review report
+type reportFile struct {
+	Path   string
+	Status string
+	// Reason is why the file was rejected, if it was
+	Reason string
+	// Lines is the file's diff, with the status of each hunk on its header
+	Lines []diffLine
+	// Omitted explains why the diff isn't included, such as a large file
+	Omitted string
+}
+
+// handleReport exports the review of a comparison as a downloadable report:
+// the reviewed diff with the status of every file and hunk, rejection reasons
+// and the review description inlined. The report follows the diff view's
+// limits: a diff over the byte limit only lists the reviewed files, and the
+// diffs of large files are left out.
+func (s *Server) handleReport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = reportFormatHTML
+	}
+	if format != reportFormatHTML {
+		writeJSONError(w, "Invalid Format", fmt.Sprintf("Unknown report format %q, must be one of %v", format, reportFormats), http.StatusBadRequest)
+		return
+	}
+
+	c := comparisonFromRequest(r)
+	if !c.complete() {
+		writeJSONError(w, "Missing Parameters", "Missing required parameters for a report", http.StatusBadRequest)
+		return
+	}
+	if err, broken := s.brokenTemplates["report.html"]; broken {
+		writeJSONError(w, "Template Error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	repo, exists, err := s.GetRepository(c.RepoPath)
+	if err != nil {
+		writeJSONError(w, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
+		return
+	}
+	if !exists {
+		writeJSONError(w, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+	if err := verifyCommitsExist(repo, c); err != nil {
+		writeJSONError(w, "Commit Not Found", err.Error(), commitErrorStatus(err))
+		return
+	}
+
+	reviewState, err := s.storage.LoadReviewState(c.RepoPath, c.User, c.SourceBranch, c.TargetBranch, c.SourceCommit, c.TargetCommit)
+	if err != nil {
+		writeJSONError(w, "Review State Error", fmt.Sprintf("Failed to load review state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"RepoName":     filepath.Base(c.RepoPath),
+		"RepoPath":     c.RepoPath,
+		"SourceBranch": c.SourceBranch,
+		"TargetBranch": c.TargetBranch,
+		"SourceCommit": c.SourceCommit,
+		"TargetCommit": c.TargetCommit,
+		"Pathspec":     c.Pathspec,
+		"Description":  reviewState.Description,
+		"CompletedBy":  reviewState.CompletedBy,
+		"CompletedAt":  reviewState.CompletedAt,
+		"GeneratedAt":  time.Now().UTC(),
+	}
+
+	// The squash merge message as edited in the diff view, or as proposed
+	if reviewState.SquashMessage != "" {
+		data["SquashMessage"] = reviewState.SquashMessage
+	} else if message, _ := proposedSquashMessage(repo, c.SourceBranch, c.SourceCommit, c.TargetCommit); message != "" {
+		data["SquashMessage"] = message
+	}
+
+	// Reviews are recorded against the default diff, so the report shows that
+	opts := s.diffOptions()
+	opts.Pathspec = c.Pathspec
+	diffText, err := repo.GetDiffWithOptions(c.SourceCommit, c.TargetCommit, opts)
+	switch {
+	case errors.Is(err, git.ErrDiffTooLarge):
+		log.Printf("Warning: diff of %s is too large to report: %v", c.RepoPath, err)
+		data["DiffTooLarge"] = true
+		data["Files"] = reviewedReportFiles(reviewState, c.RepoPath)
+	case err != nil:
+		writeJSONError(w, "Diff Error", fmt.Sprintf("Failed to load diff: %v", err), diffErrorStatus(err))
+		return
+	default:
+		files := s.reportFiles(repo, c, opts, diffText, reviewState)
+		paths := make([]string, len(files))
+		statuses := make(map[string]string, len(files))
+		for i, file := range files {
+			paths[i] = file.Path
+			statuses[file.Path] = file.Status
+		}
+		data["Files"] = files
+		data["Progress"] = s.countProgress(paths, statuses)
+	}
+
+	// Render before answering, so a failure can still be reported as such
+	var buf bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&buf, "report.html", data); err != nil {
+		log.Printf("Error rendering report template: %v", err)
+		writeJSONError(w, "Template Error", "Failed to render the report", http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("%s-%s-review.html", filepath.Base(c.RepoPath), s.ShortHash(c.SourceCommit))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// The report carries its styles inline and must not load anything else
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Write(buf.Bytes())
+}
+
+// reportFiles returns the changed files of a diff in diff order, each with its
+// review status and diff. Hunk statuses are only shown for the default diff,
+// which they were recorded against.
+func (s *Server) reportFiles(repo *git.Repository, c comparison, opts git.DiffOptions, diffText string, reviewState *models.ReviewState) []reportFile {
+	listed := make(map[string]map[string]string)
+	files := extractFilesFromDiff(diffText, reviewState, c.RepoPath)
+	for _, file := range files {
+		listed[file["Path"]] = file
+	}
+
+	// Line counts only tell large files apart, so a failure isn't fatal
+	if s.largeFilesEnabled() {
+		if stats, err := repo.GetFileLineStats(c.SourceCommit, c.TargetCommit, opts); err != nil {
+			log.Printf("Warning: failed to load line counts: %v", err)
+		} else {
+			s.annotateLargeFiles(files, stats, diffText)
+		}
+	}
+
+	sections := diffSections(diffText)
+	report := make([]reportFile, 0, len(files))
+	for _, path := range extractFilePathsFromDiff(diffText) {
+		file := listed[path]
+		entry := reportFile{Path: path, Status: file["Status"], Reason: file["Reason"]}
+		if file["Large"] == "true" {
+			entry.Omitted = fmt.Sprintf("Large file: %s lines added and %s removed, not included", file["Additions"], file["Deletions"])
+			report = append(report, entry)
+			continue
+		}
+
+		entry.Lines = parseDiffLines(path, sections[path])
+		var hunks []string
+		for _, line := range entry.Lines {
+			if line.Hunk != "" {
+				hunks = append(hunks, line.Hunk)
+			}
+		}
+		review, _ := reviewState.File(c.RepoPath, path)
+		annotateHunkStatuses(entry.Lines, hunks, review)
+		report = append(report, entry)
+	}
+	return report
+}
+
+// reviewedReportFiles lists the files of a review state with their statuses,
+// for a report whose diff couldn't be loaded
+func reviewedReportFiles(state *models.ReviewState, repoPath string) []reportFile {
+	var files []reportFile
+	for _, review := range state.ReviewedFiles {
+		if review.Repo != repoPath {
+			continue
+		}
+		file := reportFile{Path: review.Path, Status: review.Status(), Omitted: "The diff is too large to include"}
+		if file.Status == models.StateRejected {
+			file.Reason = review.Reason
+		}
+		files = append(files, file)
+	}
+	return files
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// setupReportTest returns a server with the bundled templates and a review of
+// the feature branch of a test repository rejecting test.txt, along with the
+// comparison's query
+func setupReportTest(t *testing.T, opts ...Option) (*Server, url.Values) {
+	t.Helper()
+
+	store, err := storage.OpenStorage(storage.DefaultBackend, storage.Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	server, err := New(store, opts...)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	repoDir := setupGitRepo(t)
+	if err := store.SaveRepositories([]string{repoDir}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("source", "feature")
+	query.Set("target", "main")
+	query.Set("source_commit", runGit(t, repoDir, "rev-parse", "feature"))
+	query.Set("target_commit", runGit(t, repoDir, "rev-parse", "main"))
+
+	state := &models.ReviewState{
+		SourceBranch: "feature",
+		TargetBranch: "main",
+		SourceCommit: query.Get("source_commit"),
+		TargetCommit: query.Get("target_commit"),
+		Description:  "Focus on <the> parser",
+		ReviewedFiles: []models.FileReview{
+			{Repo: repoDir, Path: "test.txt", Lines: map[string]string{"all": models.StateRejected}, Reason: "Needs tests"},
+		},
+	}
+	if err := store.SaveReviewState(state, repoDir, ""); err != nil {
+		t.Fatalf("Failed to save review state: %v", err)
+	}
+
+	return server, query
+}
+
+// getReport requests the report of the comparison in query
+func getReport(t *testing.T, server *Server, query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/report?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleReport(t *testing.T) {
+	server, query := setupReportTest(t)
+	query.Set("format", "html")
+
+	w := getReport(t, server, query)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if disposition := w.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment; filename=") || !strings.HasSuffix(disposition, "-review.html") {
+		t.Errorf("Expected the report as an HTML attachment, got %q", disposition)
+	}
+
+	body := w.Body.String()
+	for _, expected := range []string{
+		"<!DOCTYPE html>",
+		"<style>",
+		"Review of feature into main",
+		"Focus on &lt;the&gt; parser",
+		`<span class="status status-red">Rejected</span>`,
+		"Needs tests",
+		"&#43;new line",
+		"1 rejected",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected the report to contain %q, got %s", expected, body)
+		}
+	}
+
+	// Nothing is loaded from elsewhere: no scripts, stylesheets or URLs
+	if strings.Contains(body, "<script") || strings.Contains(body, "<link") {
+		t.Error("Expected no scripts or linked stylesheets in the report")
+	}
+	if external := regexp.MustCompile(`(?i)(src|href)\s*=|https?://|url\(`).FindString(body); external != "" {
+		t.Errorf("Expected no external references in the report, found %q", external)
+	}
+}
+
+// TestHandleReportLimits tests that the report leaves out what the diff view
+// doesn't show either
+func TestHandleReportLimits(t *testing.T) {
+	server, query := setupReportTest(t, WithLargeFileThreshold(0, 16))
+	body := getReport(t, server, query).Body.String()
+	if !strings.Contains(body, "Large file: 1 lines added and 0 removed, not included") || strings.Contains(body, "&#43;new line") {
+		t.Errorf("Expected the large file's diff to be left out, got %s", body)
+	}
+
+	server, query = setupReportTest(t, WithMaxDiffBytes(16))
+	w := getReport(t, server, query)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	body = w.Body.String()
+	if !strings.Contains(body, "This diff is too large to include") || !strings.Contains(body, "test.txt") || !strings.Contains(body, "Needs tests") {
+		t.Errorf("Expected the reviewed files of a diff too large to include, got %s", body)
+	}
+}
+
+func TestHandleReportErrors(t *testing.T) {
+	server, query := setupReportTest(t)
+
+	invalid := url.Values{}
+	for key := range query {
+		invalid.Set(key, query.Get(key))
+	}
+	invalid.Set("format", "pdf")
+	if w := getReport(t, server, invalid); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unknown format, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	query.Del("source_commit")
+	if w := getReport(t, server, query); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a missing commit, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// repositoryPreview describes what adding a repository path would register,
+// without registering it
+type repositoryPreview struct {
+	// Path is the path as submitted, possibly relative
+	Path string `json:"path"`
+	// Resolved is the absolute path that would be stored
+	Resolved string `json:"resolved"`
+	// Registered tells whether the resolved path is already stored, in which
+	// case adding it changes nothing
+	Registered bool `json:"registered"`
+	// Allowed tells whether the path lies inside the allowed roots
+	Allowed bool `json:"allowed"`
+	// Valid tells whether the path is a git repository. Like Registered, it's
+	// only checked for allowed paths, so the preview can't be used to probe
+	// the file system outside of the allowed roots.
+	Valid bool `json:"valid"`
+	// Problem explains why adding the path would fail, if it would
+	Problem string `json:"problem,omitempty"`
+}
+
+// previewRepository resolves path the way AddRepository does and reports what
+// adding it would register, without storing anything
+func (s *Server) previewRepository(path string) (repositoryPreview, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return repositoryPreview{}, fmt.Errorf("failed to get absolute path for %s: %w", path, err)
+	}
+
+	// Same checks, in the same order, as AddRepository
+	preview := repositoryPreview{Path: path, Resolved: absPath}
+	if !s.isAllowedPath(absPath) {
+		preview.Problem = fmt.Sprintf("%v: %s", ErrRepositoryNotAllowed, absPath)
+		return preview, nil
+	}
+
+	repos, err := s.storage.LoadRepositories()
+	if err != nil {
+		return repositoryPreview{}, fmt.Errorf("failed to load repositories: %w", err)
+	}
+
+	preview.Allowed = true
+	preview.Registered = slices.Contains(repos, absPath)
+	preview.Valid = git.IsValidRepo(absPath)
+	switch {
+	case !preview.Valid:
+		preview.Problem = fmt.Sprintf("not a valid git repository: %s", absPath)
+	case !preview.Registered && s.maxRepos > 0 && len(repos) >= s.maxRepos:
+		preview.Problem = fmt.Sprintf("%v: at most %d repositories can be registered", ErrRepositoryLimit, s.maxRepos)
+	}
+
+	return preview, nil
+}
+
+// handlePreviewRepository reports what adding the repository at the path
+// parameter would register, so the add form can confirm it first
+func (s *Server) handlePreviewRepository(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		writeJSONError(w, "Missing Path", "Repository path is required", http.StatusBadRequest)
+		return
+	}
+
+	preview, err := s.previewRepository(path)
+	if err != nil {
+		writeJSONError(w, "Repository Error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, preview)
+}
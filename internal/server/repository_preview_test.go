@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandlePreviewRepository(t *testing.T) {
+	repoDir := setupGitRepo(t)
+	parent := filepath.Dir(repoDir)
+	name := filepath.Base(repoDir)
+
+	// Relative paths resolve against the working directory, like in AddRepository
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(parent); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	tests := []struct {
+		name           string
+		path           string
+		registered     []string
+		options        []Option
+		wantResolved   string
+		wantRegistered bool
+		wantValid      bool
+		wantProblem    string
+	}{
+		{name: "relative path", path: name, wantResolved: repoDir, wantValid: true},
+		{name: "dot segments", path: "./" + name + "/../" + name, wantResolved: repoDir, wantValid: true},
+		{name: "already registered", path: name, registered: []string{repoDir}, wantResolved: repoDir, wantRegistered: true, wantValid: true},
+		{name: "not a repository", path: ".", wantResolved: parent, wantProblem: "not a valid git repository"},
+		// Outside the allowed roots, repositories and other paths look the same
+		{name: "outside allowed roots", path: name, options: []Option{WithAllowedRoots([]string{t.TempDir()})}, wantResolved: repoDir, wantProblem: "outside of the allowed directories"},
+		{name: "registered outside allowed roots", path: name, registered: []string{repoDir}, options: []Option{WithAllowedRoots([]string{t.TempDir()})}, wantResolved: repoDir, wantProblem: "outside of the allowed directories"},
+		{name: "not a repository outside allowed roots", path: ".", options: []Option{WithAllowedRoots([]string{t.TempDir()})}, wantResolved: parent, wantProblem: "outside of the allowed directories"},
+		{name: "limit reached", path: name, registered: []string{"/other/repo"}, options: []Option{WithMaxRepositories(1)}, wantResolved: repoDir, wantValid: true, wantProblem: "at most 1"},
+		{name: "registered at the limit", path: name, registered: []string{repoDir}, options: []Option{WithMaxRepositories(1)}, wantResolved: repoDir, wantRegistered: true, wantValid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, mockStorage := setupTestServer(t)
+			mockStorage.repositories = tt.registered
+			for _, opt := range tt.options {
+				opt(server)
+			}
+
+			req := httptest.NewRequest("GET", "/api/repository/preview?path="+url.QueryEscape(tt.path), nil)
+			w := httptest.NewRecorder()
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+
+			var preview repositoryPreview
+			if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil {
+				t.Fatalf("Failed to decode preview: %v", err)
+			}
+			if preview.Path != tt.path || preview.Resolved != tt.wantResolved {
+				t.Errorf("Expected %q to resolve to %q, got %q to %q", tt.path, tt.wantResolved, preview.Path, preview.Resolved)
+			}
+			if preview.Registered != tt.wantRegistered || preview.Valid != tt.wantValid {
+				t.Errorf("Expected registered=%v valid=%v, got %+v", tt.wantRegistered, tt.wantValid, preview)
+			}
+			if tt.wantProblem == "" && preview.Problem != "" || !strings.Contains(preview.Problem, tt.wantProblem) {
+				t.Errorf("Expected problem containing %q, got %q", tt.wantProblem, preview.Problem)
+			}
+			if len(mockStorage.repositories) != len(tt.registered) {
+				t.Errorf("A preview should not store anything, got %v", mockStorage.repositories)
+			}
+		})
+	}
+}
+
+func TestHandlePreviewRepositoryMissingPath(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	req := httptest.NewRequest("GET", "/api/repository/preview", nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
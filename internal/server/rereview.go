@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/models"
+)
+
+// rereviewFile is a file rejected in the previous review, along with what
+// changed in it since
+type rereviewFile struct {
+	Path   string
+	Reason string
+	// DiffLines is the diff from the previously reviewed source commit to the current one
+	DiffLines []diffLine
+}
+
+// rereviewFiles returns the files rejected in the previous review of a
+// comparison, sorted by path. Nothing needs a re-review when there is no
+// previous review or its source commit is the current one.
+func rereviewFiles(previous *models.ReviewState, c comparison) []models.FileReview {
+	if previous == nil || previous.SourceCommit == c.SourceCommit {
+		return nil
+	}
+
+	var files []models.FileReview
+	for _, review := range previous.ReviewedFiles {
+		if review.Repo == c.RepoPath && review.Status() == models.StateRejected {
+			files = append(files, review)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files
+}
+
+// handleRereview shows what changed in the files rejected in the previous
+// review of the branch pair since the source commit that review was recorded
+// against, so a re-review only needs to cover the requested changes
+func (s *Server) handleRereview(w http.ResponseWriter, r *http.Request) {
+	c := comparisonFromRequest(r)
+	if !c.complete() {
+		s.renderError(w, r, "Missing Parameters", "Missing required parameters for re-review", http.StatusBadRequest)
+		return
+	}
+	if !git.IsCommitHash(c.SourceCommit) {
+		s.renderError(w, r, "Invalid Commit", "The source commit must be a commit hash", http.StatusBadRequest)
+		return
+	}
+
+	repo, exists, err := s.GetRepository(c.RepoPath)
+	if err != nil {
+		s.renderError(w, r, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
+		return
+	}
+	if !exists {
+		s.renderError(w, r, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+	if err := verifyCommitsExist(repo, c); err != nil {
+		s.renderError(w, r, "Commit Not Found", err.Error(), commitErrorStatus(err))
+		return
+	}
+
+	previous, err := s.storage.FindPreviousReviewState(c.RepoPath, c.User, c.SourceBranch, c.TargetBranch, c.SourceCommit, c.TargetCommit)
+	if err != nil {
+		s.renderError(w, r, "Review State Error", fmt.Sprintf("Failed to find previous review state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	reviews := rereviewFiles(previous, c)
+	files := make([]rereviewFile, 0, len(reviews))
+	if len(reviews) > 0 {
+		if !git.IsCommitHash(previous.SourceCommit) {
+			s.renderError(w, r, "Review State Error", "The previous review wasn't recorded against a commit hash", http.StatusInternalServerError)
+			return
+		}
+
+		for _, review := range reviews {
+			diffText, err := repo.GetFileDiffWithOptions(c.SourceCommit, previous.SourceCommit, review.Path, s.diffOptions())
+			if err != nil {
+				s.renderError(w, r, "Diff Error", fmt.Sprintf("Failed to load diff: %v", err), diffErrorStatus(err))
+				return
+			}
+
+			file := rereviewFile{Path: review.Path, Reason: review.Reason}
+			if diffText != "" {
+				file.DiffLines = parseDiffLines(review.Path, strings.Split(sanitizeUTF8(diffText), "\n"))
+			}
+			files = append(files, file)
+		}
+	}
+
+	data := map[string]interface{}{
+		"RepoPath":     c.RepoPath,
+		"RepoName":     filepath.Base(c.RepoPath),
+		"SourceBranch": c.SourceBranch,
+		"TargetBranch": c.TargetBranch,
+		"SourceCommit": c.SourceCommit,
+		"TargetCommit": c.TargetCommit,
+		"Files":        files,
+	}
+	if previous != nil {
+		data["PreviousSourceCommit"] = previous.SourceCommit
+	}
+
+	s.render(w, r, "rereview.html", data)
+}
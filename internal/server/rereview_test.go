@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+func TestRereviewFiles(t *testing.T) {
+	c := comparison{RepoPath: "/repo", SourceCommit: "new"}
+
+	previous := &models.ReviewState{
+		SourceCommit: "old",
+		ReviewedFiles: []models.FileReview{
+			{Repo: "/repo", Path: "z.go", Lines: map[string]string{"all": models.StateRejected}, Reason: "Needs a test"},
+			{Repo: "/repo", Path: "a.go", Lines: map[string]string{"1": models.StateApproved, "2": models.StateRejected}},
+			{Repo: "/repo", Path: "ok.go", Lines: map[string]string{"all": models.StateApproved}},
+			{Repo: "/repo", Path: "skipped.go", Lines: map[string]string{"all": models.StateSkipped}},
+			{Repo: "/other", Path: "b.go", Lines: map[string]string{"all": models.StateRejected}},
+		},
+	}
+
+	files := rereviewFiles(previous, c)
+	if len(files) != 2 || files[0].Path != "a.go" || files[1].Path != "z.go" || files[1].Reason != "Needs a test" {
+		t.Errorf("Expected the rejected files a.go and z.go, got %+v", files)
+	}
+
+	// Nothing to re-review without a previous review or when the source didn't move
+	if files := rereviewFiles(nil, c); len(files) != 0 {
+		t.Errorf("Expected no files without a previous review, got %+v", files)
+	}
+	previous.SourceCommit = "new"
+	if files := rereviewFiles(previous, c); len(files) != 0 {
+		t.Errorf("Expected no files when the source commit didn't change, got %+v", files)
+	}
+}
+
+func TestHandleRereview(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "rereview.html", `{{range .Files}}{{.Path}}:{{range .DiffLines}}{{.Text}}|{{end}};{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	// Add a second file on feature, then address the review of test.txt only
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "other.txt", "other\n")
+	runGit(t, repoDir, "add", "other.txt")
+	runGit(t, repoDir, "commit", "-m", "Add other")
+	oldSource := runGit(t, repoDir, "rev-parse", "feature")
+
+	writeFile(t, repoDir, "test.txt", "initial content\nfixed line\n")
+	writeFile(t, repoDir, "other.txt", "other changed\n")
+	runGit(t, repoDir, "commit", "-am", "Address review")
+	runGit(t, repoDir, "checkout", "main")
+	newSource := runGit(t, repoDir, "rev-parse", "feature")
+	target := runGit(t, repoDir, "rev-parse", "main")
+
+	mockStorage.reviewState = nil
+	mockStorage.previousState = &models.ReviewState{
+		SourceBranch: "feature",
+		TargetBranch: "main",
+		SourceCommit: oldSource,
+		TargetCommit: target,
+		ReviewedFiles: []models.FileReview{
+			{Repo: repoDir, Path: "test.txt", Lines: map[string]string{"all": models.StateRejected}},
+			{Repo: repoDir, Path: "other.txt", Lines: map[string]string{"all": models.StateApproved}},
+		},
+	}
+
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("source", "feature")
+	query.Set("target", "main")
+	query.Set("source_commit", newSource)
+	query.Set("target_commit", target)
+
+	req := httptest.NewRequest("GET", "/rereview?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Only the rejected file shows up, with the change since the review
+	body := w.Body.String()
+	if !strings.Contains(body, "test.txt:") || !strings.Contains(body, "-new line|&#43;fixed line|") {
+		t.Errorf("Expected the incremental diff of test.txt, got %s", body)
+	}
+	if strings.Contains(body, "other.txt") {
+		t.Errorf("Expected approved files to be left out, got %s", body)
+	}
+
+	// A non-hash source commit is refused
+	query.Set("source_commit", "--output=x")
+	req = httptest.NewRequest("GET", "/rereview?"+query.Encode(), nil)
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
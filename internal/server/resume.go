@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// WithAutoResume makes opening a repository that has exactly one comparison
+// in progress go straight to that comparison. By default the compare page
+// offers to resume it instead.
+func WithAutoResume() Option {
+	return func(s *Server) {
+		s.autoResume = true
+	}
+}
+
+// singleComparisonInProgress returns the comparison of a repository the user
+// has in progress, as a recent review, when it is the only one. Comparisons
+// are told apart by their branches, so the states of a branch pair at older
+// commits count once, as the newest of them. Completed comparisons aren't in
+// progress. Only the newest outstandingStatesLimit states are looked at.
+func (s *Server) singleComparisonInProgress(repoPath, user string) (recentReview, bool, error) {
+	summaries, err := s.storage.ListRecentReviews(outstandingStatesLimit)
+	if err != nil {
+		return recentReview{}, false, err
+	}
+
+	type branches struct{ source, target string }
+	var found []storage.ReviewStateSummary
+	seen := make(map[branches]bool)
+	for _, summary := range summaries {
+		if summary.RepoPath != repoPath || summary.User != user {
+			continue
+		}
+		key := branches{summary.SourceBranch, summary.TargetBranch}
+		if seen[key] {
+			continue
+		}
+		// The newest state of a branch pair tells whether it was completed
+		seen[key] = true
+		if !summary.Completed {
+			found = append(found, summary)
+		}
+	}
+	if len(found) != 1 {
+		return recentReview{}, false, nil
+	}
+
+	reviews := recentReviews(found, user, 0)
+	if len(reviews) != 1 {
+		return recentReview{}, false, nil
+	}
+	return reviews[0], true, nil
+}
+
+// shouldAutoResume reports whether a compare page request opens the
+// repository afresh, from the repository list, so it can be taken straight to
+// the comparison in progress. Pages that link back to the compare form, or
+// name branches, want the form.
+func (s *Server) shouldAutoResume(r *http.Request) bool {
+	query := r.URL.Query()
+	return s.autoResume && query.Get("open") != "" &&
+		query.Get("source") == "" && query.Get("target") == ""
+}
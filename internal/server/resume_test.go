@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// TestSingleComparisonInProgress tests that only a repository with exactly one
+// uncompleted comparison of the user has one to resume
+func TestSingleComparisonInProgress(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	repoDir := setupGitRepo(t)
+	otherRepo := setupGitRepo(t)
+
+	now := time.Now()
+	feature := storage.ReviewStateSummary{RepoPath: repoDir, SourceBranch: "feature", TargetBranch: "main", SourceCommit: "aaa", TargetCommit: "bbb", Files: 2, ModTime: now}
+	older := feature
+	older.SourceCommit = "ccc"
+	older.ModTime = now.Add(-time.Hour)
+	completed := feature
+	completed.Completed = true
+	other := feature
+	other.SourceBranch = "other"
+	otherUser := other
+	otherUser.User = "alice"
+	otherRepoReview := other
+	otherRepoReview.RepoPath = otherRepo
+
+	tests := []struct {
+		name      string
+		summaries []storage.ReviewStateSummary
+		expected  bool
+	}{
+		{name: "none", summaries: nil, expected: false},
+		{name: "one", summaries: []storage.ReviewStateSummary{feature}, expected: true},
+		{name: "one at several commits", summaries: []storage.ReviewStateSummary{feature, older}, expected: true},
+		{name: "two", summaries: []storage.ReviewStateSummary{feature, other}, expected: false},
+		{name: "completed", summaries: []storage.ReviewStateSummary{completed, older}, expected: false},
+		{name: "one besides completed", summaries: []storage.ReviewStateSummary{completed, other}, expected: true},
+		{name: "other user", summaries: []storage.ReviewStateSummary{feature, otherUser}, expected: true},
+		{name: "other repository", summaries: []storage.ReviewStateSummary{feature, otherRepoReview}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage.recent = tt.summaries
+			review, ok, err := server.singleComparisonInProgress(repoDir, "")
+			if err != nil {
+				t.Fatalf("singleComparisonInProgress failed: %v", err)
+			}
+			if ok != tt.expected {
+				t.Fatalf("Expected %v, got %v (%+v)", tt.expected, ok, review)
+			}
+			if ok && review.RepoPath != repoDir {
+				t.Errorf("Expected a comparison of %s, got %+v", repoDir, review)
+			}
+		})
+	}
+}
+
+// TestHandleCompareResume tests that the compare page offers the comparison in
+// progress, and opens it from the repository list with auto-resume
+func TestHandleCompareResume(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "compare.html", `{{with .Resume}}resume {{.SourceBranch}} at {{.ResumeURL}}{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+	mockStorage.recent = []storage.ReviewStateSummary{{
+		RepoPath:     repoDir,
+		SourceBranch: "feature",
+		TargetBranch: "main",
+		SourceCommit: runGit(t, repoDir, "rev-parse", "feature"),
+		TargetCommit: runGit(t, repoDir, "rev-parse", "main"),
+		Files:        1,
+	}}
+	resumeURL := "/diff?" + url.Values{"repo": {repoDir}, "source": {"feature"}, "target": {"main"}}.Encode()
+
+	compare := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/compare?repo="+url.QueryEscape(repoDir)+query, nil)
+		w := httptest.NewRecorder()
+		server.handleCompare(w, req)
+		return w
+	}
+
+	// Prompting is the default, even when opened from the repository list
+	w := compare("&open=1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "resume feature") {
+		t.Errorf("Expected the comparison to be offered, got %s", body)
+	}
+
+	// Naming branches asks for them, not for the comparison in progress
+	if body := compare("&source=feature&target=main").Body.String(); strings.Contains(body, "resume") {
+		t.Errorf("Expected no offer when branches are named, got %s", body)
+	}
+
+	WithAutoResume()(server)
+	w = compare("&open=1")
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+	if location := w.Header().Get("Location"); location != resumeURL {
+		t.Errorf("Expected a redirect to %s, got %s", resumeURL, location)
+	}
+
+	// Links back to the form keep showing it
+	w = compare("")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "resume feature") {
+		t.Errorf("Expected the form with the offer, got %d: %s", w.Code, w.Body.String())
+	}
+}
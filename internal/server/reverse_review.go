@@ -0,0 +1,73 @@
+package server
+
+import (
+	"log"
+	"net/url"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// reverseReview links the diff view to the review of the same refs compared
+// the other way around, whose diff is the inverse of this one
+type reverseReview struct {
+	// SourceBranch and TargetBranch are the refs of the reverse comparison
+	SourceBranch string
+	TargetBranch string
+	// Reviewed is the number of files with a stored review
+	Reviewed  int
+	Completed bool
+	URL       string
+}
+
+// findReverseReview returns the stored review of c with its refs swapped, or
+// nil when there's none. Both orderings keep their own review state: the
+// reverse one is only looked up, so reviewing the same change twice by
+// accident can be noticed.
+func (s *Server) findReverseReview(c comparison, pinned bool) *reverseReview {
+	if c.SourceCommit == c.TargetCommit {
+		return nil
+	}
+
+	// Loading creates the state's directory, so most comparisons, which have
+	// no reverse review, are ruled out without loading anything
+	exists, err := s.storage.HasReviewState(c.RepoPath, c.User, c.TargetCommit, c.SourceCommit)
+	if err != nil {
+		log.Printf("Warning: failed to look for the reverse review state: %v", err)
+		return nil
+	}
+	if !exists {
+		return nil
+	}
+
+	state, err := s.storage.LoadReviewState(c.RepoPath, c.User, c.TargetBranch, c.SourceBranch, c.TargetCommit, c.SourceCommit)
+	if err != nil {
+		log.Printf("Warning: failed to load the reverse review state: %v", err)
+		return nil
+	}
+	if !hasStoredReviews(state) {
+		return nil
+	}
+
+	query := url.Values{}
+	query.Set("repo", c.RepoPath)
+	query.Set("source", c.TargetBranch)
+	query.Set("target", c.SourceBranch)
+	query.Set("source_commit", c.TargetCommit)
+	query.Set("target_commit", c.SourceCommit)
+	if pinned {
+		query.Set("pin", "1")
+	}
+	return &reverseReview{
+		SourceBranch: c.TargetBranch,
+		TargetBranch: c.SourceBranch,
+		Reviewed:     len(state.ReviewedFiles),
+		Completed:    state.IsCompleted(),
+		URL:          "/diff?" + query.Encode(),
+	}
+}
+
+// hasStoredReviews reports whether a review state holds anything a reviewer
+// recorded, as opposed to the empty state of a comparison never reviewed
+func hasStoredReviews(state *models.ReviewState) bool {
+	return state != nil && (len(state.ReviewedFiles) > 0 || state.IsCompleted() || state.Description != "")
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+	"github.com/darccio/diffty/internal/storage"
+)
+
+func TestHasStoredReviews(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    *models.ReviewState
+		expected bool
+	}{
+		{name: "missing", state: nil, expected: false},
+		{name: "empty", state: &models.ReviewState{ReviewedFiles: []models.FileReview{}}, expected: false},
+		{name: "reviewed file", state: &models.ReviewState{ReviewedFiles: []models.FileReview{{Path: "a.go"}}}, expected: true},
+		{name: "description", state: &models.ReviewState{Description: "Focus on the parser"}, expected: true},
+	}
+
+	for _, test := range tests {
+		if got := hasStoredReviews(test.state); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+// TestHandleDiffViewReverseReview tests that the diff view points at the
+// review of the same refs compared the other way around, without touching it
+func TestHandleDiffViewReverseReview(t *testing.T) {
+	storageDir := t.TempDir()
+	store, err := storage.OpenStorage(storage.DefaultBackend, storage.Options{Dir: storageDir})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	server, err := New(store)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	repoDir := setupGitRepo(t)
+	if err := store.SaveRepositories([]string{repoDir}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+	featureCommit := runGit(t, repoDir, "rev-parse", "feature")
+	mainCommit := runGit(t, repoDir, "rev-parse", "main")
+
+	view := func(source, target string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source="+source+"&target="+target, nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	if body := view("main", "feature"); strings.Contains(body, `id="reverse-review"`) {
+		t.Error("Expected no warning before either ordering was reviewed")
+	}
+	// Looking for the reverse review leaves nothing behind
+	if matches, _ := filepath.Glob(filepath.Join(storageDir, "*", featureCommit)); len(matches) > 0 {
+		t.Errorf("Expected no directory for the unreviewed reverse ordering, got %v", matches)
+	}
+
+	// Review feature against main
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("source", "feature")
+	query.Set("target", "main")
+	query.Set("source_commit", featureCommit)
+	query.Set("target_commit", mainCommit)
+	query.Set("file", "test.txt")
+	query.Set("status", models.StateApproved)
+	req := httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+
+	body := view("main", "feature")
+	if !strings.Contains(body, `id="reverse-review"`) || !strings.Contains(body, "with 1 file reviewed") {
+		t.Errorf("Expected a warning about the reverse review, got %s", body)
+	}
+	if !strings.Contains(body, "source=feature&amp;source_commit="+featureCommit+"&amp;target=main&amp;target_commit="+mainCommit) {
+		t.Errorf("Expected a link to the reverse review, got %s", body)
+	}
+	if body := view("feature", "main"); strings.Contains(body, `id="reverse-review"`) {
+		t.Error("Expected no warning on the reviewed ordering itself")
+	}
+
+	// The two orderings keep their own states
+	reverse, err := store.LoadReviewState(repoDir, "", "main", "feature", mainCommit, featureCommit)
+	if err != nil {
+		t.Fatalf("LoadReviewState failed: %v", err)
+	}
+	if len(reverse.ReviewedFiles) != 0 {
+		t.Errorf("Expected the reverse ordering to stay unreviewed, got %v", reverse.ReviewedFiles)
+	}
+}
@@ -0,0 +1,360 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// The review API is a small JSON surface for keyboard-driven and scripted
+// clients. Every endpoint takes the comparison (repo, source, target,
+// source_commit, target_commit, optionally pathspec) and the current file as
+// query parameters and answers with a reviewAPIResponse describing a file and
+// where to go from it.
+//
+// Actions (POST) are idempotent: repeating one leaves the review state exactly
+// as the first call did.
+//
+//	POST /api/review/approve          mark the file as approved
+//	POST /api/review/reject           mark the file as rejected, with an optional
+//	                                  reason (required with WithRequiredRejectionReason)
+//	POST /api/review/skip             mark the file as skipped
+//	POST /api/review/needs-review     mark the file as needing a second opinion
+//	POST /api/review/reset            forget the file's review (back to unreviewed)
+//
+// Navigation (GET) never modifies state and answers with the target file:
+//
+//	GET  /api/review/next             the file after the current one
+//	GET  /api/review/prev             the file before the current one
+//	GET  /api/review/next-unreviewed  the first unreviewed file after the current
+//	                                  one, wrapping around; file may be omitted.
+//	                                  Skipped files count as unreviewed unless
+//	                                  WithSkippedAsComplete is set
+//
+// Navigation follows diff order (paths as git lists them), which unlike the
+// status-sorted file list doesn't change as files get reviewed.
+//
+// OPTIONS on any of them, or on /api/review itself for all of them, describes
+// the methods and parameters they take as a reviewEndpoint, with an Allow header.
+
+// reviewAPIResponse is the response shape shared by all review API endpoints
+type reviewAPIResponse struct {
+	File           string `json:"file"`
+	Status         string `json:"status"`
+	Prev           string `json:"prev,omitempty"`
+	Next           string `json:"next,omitempty"`
+	NextUnreviewed string `json:"next_unreviewed,omitempty"`
+}
+
+// reviewActions maps review API actions to the status they set
+var reviewActions = map[string]string{
+	"approve":      models.StateApproved,
+	"reject":       models.StateRejected,
+	"skip":         models.StateSkipped,
+	"needs-review": models.StateNeedsReview,
+	"reset":        "",
+}
+
+// reviewNavigation lists the review API navigation targets
+var reviewNavigation = []string{"next", "prev", "next-unreviewed"}
+
+// reviewParameter describes a query parameter of a review API endpoint
+type reviewParameter struct {
+	Name        string `json:"name"`
+	Required    bool   `json:"required"`
+	Description string `json:"description"`
+}
+
+// reviewEndpoint describes a review API endpoint in OPTIONS responses
+type reviewEndpoint struct {
+	Path       string            `json:"path"`
+	Methods    []string          `json:"methods"`
+	Idempotent bool              `json:"idempotent"`
+	Effect     string            `json:"effect"`
+	Parameters []reviewParameter `json:"parameters"`
+}
+
+// reviewActionEffects describes what each review action does
+var reviewActionEffects = map[string]string{
+	"approve":      "Marks the file as approved",
+	"reject":       "Marks the file as rejected, replacing any previous reason",
+	"skip":         "Marks the file as skipped",
+	"needs-review": "Marks the file as needing a second opinion from another reviewer",
+	"reset":        "Forgets the file's review, leaving it unreviewed",
+}
+
+// reviewNavigationEffects describes the file each navigation target answers with
+var reviewNavigationEffects = map[string]string{
+	"next":            "Describes the file after the current one, without changing any state",
+	"prev":            "Describes the file before the current one, without changing any state",
+	"next-unreviewed": "Describes the first unreviewed file after the current one, wrapping around, without changing any state",
+}
+
+// reviewActionOrder lists the review actions in documentation order
+var reviewActionOrder = []string{"approve", "reject", "skip", "needs-review", "reset"}
+
+// reviewEndpointFor describes the review API endpoint named name, reporting
+// whether there is one
+func (s *Server) reviewEndpointFor(name string) (reviewEndpoint, bool) {
+	params := []reviewParameter{
+		{Name: "repo", Required: true, Description: "Path of the repository"},
+		{Name: "source", Required: true, Description: "Source branch of the comparison"},
+		{Name: "target", Required: true, Description: "Target branch of the comparison"},
+		{Name: "source_commit", Required: true, Description: "Source commit the review applies to"},
+		{Name: "target_commit", Required: true, Description: "Target commit the review applies to"},
+		{Name: "pathspec", Description: "Limits the comparison to the files matching this git pathspec"},
+	}
+
+	if _, ok := reviewActions[name]; ok {
+		params = append(params, reviewParameter{Name: "file", Required: true, Description: "File to apply the action to"})
+		if name == "reject" {
+			params = append(params, reviewParameter{Name: "reason", Required: s.requireRejectReason, Description: "Why the file is rejected"})
+		}
+		return reviewEndpoint{
+			Path:       s.url("/api/review/" + name),
+			Methods:    []string{http.MethodPost, http.MethodOptions},
+			Idempotent: true,
+			Effect:     reviewActionEffects[name],
+			Parameters: params,
+		}, true
+	}
+
+	if indexOf(reviewNavigation, name) != -1 {
+		params = append(params, reviewParameter{Name: "file", Required: name != "next-unreviewed", Description: "File to navigate from"})
+		return reviewEndpoint{
+			Path:       s.url("/api/review/" + name),
+			Methods:    []string{http.MethodGet, http.MethodOptions},
+			Idempotent: true,
+			Effect:     reviewNavigationEffects[name],
+			Parameters: params,
+		}, true
+	}
+
+	return reviewEndpoint{}, false
+}
+
+// handleReviewOptions describes a review API endpoint, or all of them when
+// none is named
+func (s *Server) handleReviewOptions(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" {
+		endpoints := make([]reviewEndpoint, 0, len(reviewActionOrder)+len(reviewNavigation))
+		for _, name := range append(append([]string{}, reviewActionOrder...), reviewNavigation...) {
+			endpoint, _ := s.reviewEndpointFor(name)
+			endpoints = append(endpoints, endpoint)
+		}
+		w.Header().Set("Allow", http.MethodOptions)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"endpoints": endpoints})
+		return
+	}
+
+	endpoint, ok := s.reviewEndpointFor(name)
+	if !ok {
+		writeJSONError(w, "Not Found", fmt.Sprintf("Unknown review endpoint: %s", name), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Allow", strings.Join(endpoint.Methods, ", "))
+	writeJSON(w, http.StatusOK, endpoint)
+}
+
+// methodNotAllowed answers a request to the review API endpoint named name
+// made with a method it doesn't take, such as GET on an action, since the
+// router can't tell actions and navigation targets apart by path
+func (s *Server) methodNotAllowed(w http.ResponseWriter, name string) {
+	endpoint, _ := s.reviewEndpointFor(name)
+	w.Header().Set("Allow", strings.Join(endpoint.Methods, ", "))
+	writeJSONError(w, "Method Not Allowed", fmt.Sprintf("%s only takes %s", endpoint.Path, strings.Join(endpoint.Methods, " and ")), http.StatusMethodNotAllowed)
+}
+
+// handleReviewAction applies a review action to the current file
+func (s *Server) handleReviewAction(w http.ResponseWriter, r *http.Request) {
+	action := r.PathValue("action")
+	status, ok := reviewActions[action]
+	if !ok && indexOf(reviewNavigation, action) != -1 {
+		s.methodNotAllowed(w, action)
+		return
+	}
+	if !ok {
+		writeJSONError(w, "Unknown Action", fmt.Sprintf("Unknown review action: %s", action), http.StatusNotFound)
+		return
+	}
+
+	c := comparisonFromRequest(r)
+	filePath := r.URL.Query().Get("file")
+	if !c.complete() || filePath == "" {
+		writeJSONError(w, "Missing Parameters", "Missing required parameters for updating review state", http.StatusBadRequest)
+		return
+	}
+
+	reason := r.URL.Query().Get("reason")
+	if err := s.checkRejectReason(status, reason); err != nil {
+		writeJSONError(w, "Missing Reason", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	paths, statuses, err := s.loadReviewFiles(c)
+	if err != nil {
+		writeJSONError(w, "Review State Error", err.Error(), diffErrorStatus(err))
+		return
+	}
+
+	if indexOf(paths, filePath) == -1 {
+		writeJSONError(w, "Not Found", fmt.Sprintf("File %s is not part of this comparison", filePath), http.StatusNotFound)
+		return
+	}
+
+	if _, err := s.updateFileReview(c, filePath, status, reason); err != nil {
+		writeJSONError(w, "Review State Error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if status == "" {
+		delete(statuses, filePath)
+	} else {
+		statuses[filePath] = status
+	}
+
+	writeJSON(w, http.StatusOK, buildReviewAPIResponse(paths, statuses, s.isComplete, filePath))
+}
+
+// handleReviewNavigation resolves a navigation target relative to the current file
+func (s *Server) handleReviewNavigation(w http.ResponseWriter, r *http.Request) {
+	target := r.PathValue("target")
+	if _, isAction := reviewActions[target]; isAction {
+		s.methodNotAllowed(w, target)
+		return
+	}
+	if indexOf(reviewNavigation, target) == -1 {
+		writeJSONError(w, "Unknown Navigation", fmt.Sprintf("Unknown navigation target: %s", target), http.StatusNotFound)
+		return
+	}
+
+	c := comparisonFromRequest(r)
+	filePath := r.URL.Query().Get("file")
+	if !c.complete() || (filePath == "" && target != "next-unreviewed") {
+		writeJSONError(w, "Missing Parameters", "Missing required parameters for review navigation", http.StatusBadRequest)
+		return
+	}
+
+	paths, statuses, err := s.loadReviewFiles(c)
+	if err != nil {
+		writeJSONError(w, "Review State Error", err.Error(), diffErrorStatus(err))
+		return
+	}
+
+	if filePath != "" && indexOf(paths, filePath) == -1 {
+		writeJSONError(w, "Not Found", fmt.Sprintf("File %s is not part of this comparison", filePath), http.StatusNotFound)
+		return
+	}
+
+	current := buildReviewAPIResponse(paths, statuses, s.isComplete, filePath)
+
+	var destination string
+	switch target {
+	case "next":
+		destination = current.Next
+	case "prev":
+		destination = current.Prev
+	case "next-unreviewed":
+		destination = current.NextUnreviewed
+	}
+
+	if destination == "" {
+		writeJSONError(w, "Not Found", fmt.Sprintf("There is no %s file", target), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, buildReviewAPIResponse(paths, statuses, s.isComplete, destination))
+}
+
+// loadReviewFiles returns the comparison's file paths in diff order along with
+// the status of each reviewed file
+func (s *Server) loadReviewFiles(c comparison) ([]string, map[string]string, error) {
+	repo, exists, err := s.GetRepository(c.RepoPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading repository: %w", err)
+	}
+	if !exists {
+		return nil, nil, fmt.Errorf("repository not found: %s", c.RepoPath)
+	}
+	if err := verifyCommitsExist(repo, c); err != nil {
+		return nil, nil, err
+	}
+
+	opts := s.diffOptions()
+	opts.Pathspec = c.Pathspec
+	diffText, err := repo.GetDiffWithOptions(c.SourceCommit, c.TargetCommit, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load diff: %w", err)
+	}
+
+	reviewState, err := s.storage.LoadReviewState(c.RepoPath, c.User, c.SourceBranch, c.TargetBranch, c.SourceCommit, c.TargetCommit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load review state: %w", err)
+	}
+
+	statuses := make(map[string]string)
+	for _, file := range extractFilesFromDiff(diffText, reviewState, c.RepoPath) {
+		if file["Status"] != models.StateUnreviewed {
+			statuses[file["Path"]] = file["Status"]
+		}
+	}
+
+	return extractFilePathsFromDiff(diffText), statuses, nil
+}
+
+// buildReviewAPIResponse describes filePath and its navigation targets, using
+// complete to tell which files still need a review.
+// An empty filePath describes the position before the first file.
+func buildReviewAPIResponse(paths []string, statuses map[string]string, complete func(string) bool, filePath string) reviewAPIResponse {
+	resp := reviewAPIResponse{
+		File:   filePath,
+		Status: models.StateUnreviewed,
+	}
+	if status, ok := statuses[filePath]; ok {
+		resp.Status = status
+	}
+
+	current := indexOf(paths, filePath)
+	if current > 0 {
+		resp.Prev = paths[current-1]
+	}
+	if current+1 < len(paths) {
+		resp.Next = paths[current+1]
+	}
+
+	// Look for an unreviewed file after the current one, wrapping around
+	for i := 1; i <= len(paths); i++ {
+		candidate := paths[(current+i+len(paths))%len(paths)]
+		if candidate == filePath {
+			continue
+		}
+		if !complete(statuses[candidate]) {
+			resp.NextUnreviewed = candidate
+			break
+		}
+	}
+
+	return resp
+}
+
+// indexOf returns the index of value in values, or -1 if it isn't there
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeJSONError writes an error in the JSON shape used by the API endpoints
+func writeJSONError(w http.ResponseWriter, title string, message string, statusCode int) {
+	writeJSON(w, statusCode, map[string]string{
+		"error":   title,
+		"message": message,
+	})
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// setupReviewAPITest creates a server over a real repository whose feature
+// branch changes a.txt, b.txt and test.txt, and returns the comparison query
+func setupReviewAPITest(t *testing.T) (*Server, *MockStorage, url.Values) {
+	t.Helper()
+
+	server, mockStorage := setupTestServer(t)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "a.txt", "a\n")
+	writeFile(t, repoDir, "b.txt", "b\n")
+	runGit(t, repoDir, "add", "a.txt", "b.txt")
+	runGit(t, repoDir, "commit", "-m", "Add files")
+	runGit(t, repoDir, "checkout", "main")
+
+	mockStorage.repositories = []string{repoDir}
+	mockStorage.reviewState = nil
+
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("source", "feature")
+	query.Set("target", "main")
+	query.Set("source_commit", runGit(t, repoDir, "rev-parse", "feature"))
+	query.Set("target_commit", runGit(t, repoDir, "rev-parse", "main"))
+
+	return server, mockStorage, query
+}
+
+// doReviewAPI performs a review API request through the router
+func doReviewAPI(t *testing.T, server *Server, method, endpoint string, query url.Values, file string) (int, reviewAPIResponse) {
+	t.Helper()
+
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	if file != "" {
+		q.Set("file", file)
+	}
+
+	req := httptest.NewRequest(method, endpoint+"?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	var resp reviewAPIResponse
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+
+	return w.Code, resp
+}
+
+// TestReviewAPIActionsAreIdempotent tests that repeating an action leaves the state unchanged
+func TestReviewAPIActionsAreIdempotent(t *testing.T) {
+	server, mockStorage, query := setupReviewAPITest(t)
+
+	tests := []struct {
+		action   string
+		expected string
+	}{
+		{action: "approve", expected: models.StateApproved},
+		{action: "reject", expected: models.StateRejected},
+		{action: "skip", expected: models.StateSkipped},
+		{action: "reset", expected: "unreviewed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			var states [][]models.FileReview
+			for i := 0; i < 2; i++ {
+				code, resp := doReviewAPI(t, server, "POST", "/api/review/"+tt.action, query, "b.txt")
+				if code != http.StatusOK {
+					t.Fatalf("Expected status code %d, got %d", http.StatusOK, code)
+				}
+
+				expected := reviewAPIResponse{File: "b.txt", Status: tt.expected, Prev: "a.txt", Next: "test.txt", NextUnreviewed: "test.txt"}
+				if resp != expected {
+					t.Errorf("Expected %+v, got %+v", expected, resp)
+				}
+
+				states = append(states, append([]models.FileReview{}, mockStorage.reviewState.ReviewedFiles...))
+			}
+
+			if !reflect.DeepEqual(states[0], states[1]) {
+				t.Errorf("Expected repeated %s to leave the state unchanged: %+v vs %+v", tt.action, states[0], states[1])
+			}
+		})
+	}
+
+	// Unknown actions and files are rejected
+	if code, _ := doReviewAPI(t, server, "POST", "/api/review/bogus", query, "b.txt"); code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for unknown action, got %d", http.StatusNotFound, code)
+	}
+	if code, _ := doReviewAPI(t, server, "POST", "/api/review/approve", query, "missing.txt"); code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for unknown file, got %d", http.StatusNotFound, code)
+	}
+	if code, _ := doReviewAPI(t, server, "POST", "/api/review/approve", query, ""); code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without a file, got %d", http.StatusBadRequest, code)
+	}
+}
+
+// TestReviewAPINavigation tests the navigation endpoints
+func TestReviewAPINavigation(t *testing.T) {
+	server, _, query := setupReviewAPITest(t)
+
+	if code, _ := doReviewAPI(t, server, "POST", "/api/review/approve", query, "b.txt"); code != http.StatusOK {
+		t.Fatalf("Failed to approve b.txt: %d", code)
+	}
+
+	tests := []struct {
+		target   string
+		file     string
+		code     int
+		expected string
+	}{
+		{target: "next", file: "a.txt", code: http.StatusOK, expected: "b.txt"},
+		{target: "prev", file: "b.txt", code: http.StatusOK, expected: "a.txt"},
+		{target: "next", file: "test.txt", code: http.StatusNotFound},
+		{target: "prev", file: "a.txt", code: http.StatusNotFound},
+		{target: "next-unreviewed", file: "a.txt", code: http.StatusOK, expected: "test.txt"},
+		{target: "next-unreviewed", file: "test.txt", code: http.StatusOK, expected: "a.txt"},
+		{target: "next-unreviewed", file: "", code: http.StatusOK, expected: "a.txt"},
+		{target: "bogus", file: "a.txt", code: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		code, resp := doReviewAPI(t, server, "GET", "/api/review/"+tt.target, query, tt.file)
+		if code != tt.code {
+			t.Errorf("%s from %q: expected status code %d, got %d", tt.target, tt.file, tt.code, code)
+			continue
+		}
+		if code == http.StatusOK && resp.File != tt.expected {
+			t.Errorf("%s from %q: expected %s, got %s", tt.target, tt.file, tt.expected, resp.File)
+		}
+	}
+
+	// The navigation target carries its own status
+	_, resp := doReviewAPI(t, server, "GET", "/api/review/next", query, "a.txt")
+	if resp.Status != models.StateApproved {
+		t.Errorf("Expected b.txt to be approved, got %s", resp.Status)
+	}
+}
+
+// TestReviewAPIRequiredRejectReason tests that the reject action honors the required reason mode
+func TestReviewAPIRequiredRejectReason(t *testing.T) {
+	server, mockStorage, query := setupReviewAPITest(t)
+	WithRequiredRejectionReason()(server)
+
+	if code, _ := doReviewAPI(t, server, "POST", "/api/review/reject", query, "b.txt"); code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without a reason, got %d", http.StatusBadRequest, code)
+	}
+
+	query.Set("reason", "Needs a test")
+	if code, _ := doReviewAPI(t, server, "POST", "/api/review/reject", query, "b.txt"); code != http.StatusOK {
+		t.Fatalf("Expected status code %d with a reason, got %d", http.StatusOK, code)
+	}
+
+	if reason := mockStorage.reviewState.ReviewedFiles[0].Reason; reason != "Needs a test" {
+		t.Errorf("Expected the reason to be stored, got %q", reason)
+	}
+
+	// The reason shows up in the file list
+	for _, file := range extractFilesFromDiff(runGit(t, query.Get("repo"), "diff", "main", "feature"), mockStorage.reviewState, query.Get("repo")) {
+		if file["Path"] == "b.txt" && file["Reason"] != "Needs a test" {
+			t.Errorf("Expected the file list to carry the reason, got %q", file["Reason"])
+		}
+	}
+}
+
+// TestReviewAPINextUnreviewedSkippedPolicy tests that next-unreviewed follows the skipped policy
+func TestReviewAPINextUnreviewedSkippedPolicy(t *testing.T) {
+	tests := []struct {
+		skippedComplete bool
+		expected        string
+	}{
+		{skippedComplete: false, expected: "b.txt"},
+		{skippedComplete: true, expected: "test.txt"},
+	}
+
+	for _, tt := range tests {
+		server, _, query := setupReviewAPITest(t)
+		if tt.skippedComplete {
+			WithSkippedAsComplete()(server)
+		}
+
+		doReviewAPI(t, server, "POST", "/api/review/skip", query, "b.txt")
+
+		code, resp := doReviewAPI(t, server, "GET", "/api/review/next-unreviewed", query, "a.txt")
+		if code != http.StatusOK || resp.File != tt.expected {
+			t.Errorf("skippedComplete=%v: expected %s, got %s (%d)", tt.skippedComplete, tt.expected, resp.File, code)
+		}
+	}
+}
+
+// TestReviewAPIOptions tests that OPTIONS describes the methods and parameters
+// of every review API endpoint
+func TestReviewAPIOptions(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	options := func(path string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("OPTIONS", path, nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+	required := func(endpoint reviewEndpoint) []string {
+		var names []string
+		for _, param := range endpoint.Parameters {
+			if param.Required {
+				names = append(names, param.Name)
+			}
+		}
+		return names
+	}
+	comparison := []string{"repo", "source", "target", "source_commit", "target_commit"}
+
+	tests := []struct {
+		name         string
+		allow        string
+		wantRequired []string
+	}{
+		{name: "approve", allow: "POST, OPTIONS", wantRequired: append(comparison, "file")},
+		{name: "reject", allow: "POST, OPTIONS", wantRequired: append(comparison, "file")},
+		{name: "skip", allow: "POST, OPTIONS", wantRequired: append(comparison, "file")},
+		{name: "needs-review", allow: "POST, OPTIONS", wantRequired: append(comparison, "file")},
+		{name: "reset", allow: "POST, OPTIONS", wantRequired: append(comparison, "file")},
+		{name: "next", allow: "GET, OPTIONS", wantRequired: append(comparison, "file")},
+		{name: "prev", allow: "GET, OPTIONS", wantRequired: append(comparison, "file")},
+		{name: "next-unreviewed", allow: "GET, OPTIONS", wantRequired: comparison},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := options("/api/review/" + tt.name)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.allow {
+				t.Errorf("Expected Allow %q, got %q", tt.allow, allow)
+			}
+
+			var endpoint reviewEndpoint
+			if err := json.NewDecoder(w.Body).Decode(&endpoint); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if endpoint.Path != "/api/review/"+tt.name || !endpoint.Idempotent || endpoint.Effect == "" {
+				t.Errorf("Expected an idempotent endpoint with an effect, got %+v", endpoint)
+			}
+			if got := required(endpoint); !reflect.DeepEqual(got, tt.wantRequired) {
+				t.Errorf("Expected required parameters %v, got %v", tt.wantRequired, got)
+			}
+		})
+	}
+
+	// The reason becomes required along with the option
+	WithRequiredRejectionReason()(server)
+	var endpoint reviewEndpoint
+	if err := json.NewDecoder(options("/api/review/reject").Body).Decode(&endpoint); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got := required(endpoint); !reflect.DeepEqual(got, append(comparison, "file", "reason")) {
+		t.Errorf("Expected the reason to be required, got %v", got)
+	}
+
+	// All of them are listed on the API root
+	w := options("/api/review")
+	var all struct {
+		Endpoints []reviewEndpoint `json:"endpoints"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&all); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(all.Endpoints) != len(tests) {
+		t.Errorf("Expected %d endpoints, got %+v", len(tests), all.Endpoints)
+	}
+
+	if w := options("/api/review/bogus"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for an unknown endpoint, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestReviewAPIWrongMethod tests that actions and navigation targets called
+// with each other's method are refused with the methods they take
+func TestReviewAPIWrongMethod(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	tests := []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{method: "GET", path: "/api/review/approve", allow: "POST, OPTIONS"},
+		{method: "POST", path: "/api/review/next", allow: "GET, OPTIONS"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: expected status code %d, got %d", tt.method, tt.path, http.StatusMethodNotAllowed, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("%s %s: expected Allow %q, got %q", tt.method, tt.path, tt.allow, allow)
+		}
+	}
+}
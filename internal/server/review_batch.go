@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// maxReviewBatchSize bounds the request body of a review batch
+const maxReviewBatchSize = 1 << 20
+
+// reviewBatchEntry is one file of a review batch. Status sets the whole file,
+// Lines the statuses of single hunks keyed by their range ("-1,3 +1,4"); when
+// both are set the hunk statuses apply on top of the file's.
+type reviewBatchEntry struct {
+	Path   string            `json:"path"`
+	Status string            `json:"status,omitempty"`
+	Lines  map[string]string `json:"lines,omitempty"`
+	Reason string            `json:"reason,omitempty"`
+
+	// blobHash and hunks are the shape of the file's current diff
+	blobHash string
+	hunks    []string
+}
+
+// handleReviewBatch applies a list of file reviews to a comparison at once.
+// The comparison is taken from the query parameters like the review API, the
+// body is a JSON array of reviewBatchEntry. Every entry is validated first, so
+// either all of them are saved together or none is; the response is the
+// resulting review state.
+func (s *Server) handleReviewBatch(w http.ResponseWriter, r *http.Request) {
+	c := comparisonFromRequest(r)
+	if !c.complete() {
+		writeJSONError(w, "Missing Parameters", "Missing required parameters for updating review state", http.StatusBadRequest)
+		return
+	}
+
+	var entries []reviewBatchEntry
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReviewBatchSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&entries); err != nil {
+		writeJSONError(w, "Invalid Batch", fmt.Sprintf("Invalid review batch: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(entries) == 0 {
+		writeJSONError(w, "Invalid Batch", "The review batch has no files", http.StatusBadRequest)
+		return
+	}
+
+	paths, _, err := s.loadReviewFiles(c)
+	if err != nil {
+		writeJSONError(w, "Review State Error", err.Error(), diffErrorStatus(err))
+		return
+	}
+
+	if err := s.validateReviewBatch(c, entries, paths); err != nil {
+		writeJSONError(w, "Invalid Batch", err.Error(), http.StatusBadRequest)
+		return
+	}
+	changed := s.changedFiles(c)
+
+	unlock := s.reviewLocks.lock(c)
+	defer unlock()
+
+	state, err := s.storage.LoadReviewState(c.RepoPath, c.User, c.SourceBranch, c.TargetBranch, c.SourceCommit, c.TargetCommit)
+	if err != nil {
+		writeJSONError(w, "Review State Error", fmt.Sprintf("failed to load review state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.Status != "" {
+			setFileReview(state, c.RepoPath, entry.Path, entry.Status, entry.Reason, entry.blobHash, entry.hunks)
+		}
+		for hunk, status := range entry.Lines {
+			setHunkReview(state, c.RepoPath, entry.Path, hunk, status, entry.Reason, entry.blobHash, entry.hunks)
+		}
+	}
+	recordChangedFiles(state, changed)
+
+	if err := s.storage.SaveReviewState(state, c.RepoPath, c.User); err != nil {
+		writeJSONError(w, "Review State Error", fmt.Sprintf("failed to save review state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, state)
+}
+
+// validateReviewBatch checks every entry of a batch against the comparison's
+// files and their hunks, and records the diff shape of each file on its entry.
+// The returned error lists every invalid entry.
+func (s *Server) validateReviewBatch(c comparison, entries []reviewBatchEntry, paths []string) error {
+	var errs []error
+	seen := make(map[string]bool, len(entries))
+
+	for i := range entries {
+		entry := &entries[i]
+		invalid := func(format string, args ...interface{}) {
+			errs = append(errs, fmt.Errorf("entry %d (%s): %s", i, entry.Path, fmt.Sprintf(format, args...)))
+		}
+
+		switch {
+		case entry.Path == "":
+			invalid("missing path")
+			continue
+		case seen[entry.Path]:
+			invalid("file listed more than once")
+			continue
+		case indexOf(paths, entry.Path) == -1:
+			invalid("file is not part of this comparison")
+			continue
+		}
+		seen[entry.Path] = true
+
+		if entry.Status == "" && len(entry.Lines) == 0 {
+			invalid("missing status or lines")
+			continue
+		}
+		if entry.Status != "" && !isReviewStatus(entry.Status) {
+			invalid("invalid status %q", entry.Status)
+		}
+		if err := s.checkRejectReason(entry.Status, entry.Reason); err != nil {
+			invalid("%v", err)
+		}
+
+		entry.blobHash, entry.hunks = s.getFileDiffShape(c.RepoPath, c.SourceCommit, c.TargetCommit, entry.Path)
+		for hunk, status := range entry.Lines {
+			if indexOf(entry.hunks, hunk) == -1 {
+				invalid("%v: no hunk %q", ErrUnknownHunk, hunk)
+			}
+			if !isReviewStatus(status) {
+				invalid("invalid status %q for hunk %q", status, hunk)
+			}
+			if err := s.checkRejectReason(status, entry.Reason); err != nil {
+				invalid("hunk %q: %v", hunk, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isReviewStatus reports whether status is one a file or hunk can be given
+func isReviewStatus(status string) bool {
+	return status == models.StateApproved || status == models.StateRejected || status == models.StateSkipped || status == models.StateNeedsReview
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// doReviewBatch posts a review batch body through the router
+func doReviewBatch(t *testing.T, server *Server, query url.Values, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/api/review-state/batch?"+query.Encode(), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	return w
+}
+
+func TestReviewBatch(t *testing.T) {
+	server, mockStorage, query := setupReviewAPITest(t)
+
+	_, hunks := server.getFileDiffShape(query.Get("repo"), query.Get("source_commit"), query.Get("target_commit"), "test.txt")
+	if len(hunks) != 1 {
+		t.Fatalf("Expected test.txt to have one hunk, got %v", hunks)
+	}
+
+	body, _ := json.Marshal([]map[string]interface{}{
+		{"path": "a.txt", "status": "approved"},
+		{"path": "b.txt", "status": "rejected", "reason": "Needs tests"},
+		{"path": "test.txt", "lines": map[string]string{hunks[0]: "skipped"}},
+	})
+	w := doReviewBatch(t, server, query, string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var state models.ReviewState
+	if err := json.NewDecoder(w.Body).Decode(&state); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	repoPath := query.Get("repo")
+	expected := map[string]string{"a.txt": "approved", "b.txt": "rejected", "test.txt": "skipped"}
+	for path, status := range expected {
+		if got, _ := state.FileStatus(repoPath, path); got != status {
+			t.Errorf("Expected %s to be %s in the response, got %s", path, status, got)
+		}
+		if got, _ := mockStorage.reviewState.FileStatus(repoPath, path); got != status {
+			t.Errorf("Expected %s to be saved as %s, got %s", path, status, got)
+		}
+	}
+	if review, _ := state.File(repoPath, "b.txt"); review.Reason != "Needs tests" {
+		t.Errorf("Expected the rejection reason to be kept, got %q", review.Reason)
+	}
+}
+
+// TestReviewBatchIsAllOrNothing tests that a batch with any invalid entry is
+// rejected without saving its valid entries
+func TestReviewBatchIsAllOrNothing(t *testing.T) {
+	server, mockStorage, query := setupReviewAPITest(t)
+
+	tests := map[string]struct {
+		body     string
+		messages []string
+	}{
+		"invalid entries": {
+			body: `[{"path": "a.txt", "status": "approved"},
+				{"path": "b.txt", "status": "bogus"},
+				{"path": "missing.txt", "status": "approved"},
+				{"path": "test.txt", "lines": {"-9,9 +9,9": "approved"}}]`,
+			messages: []string{`entry 1 (b.txt): invalid status "bogus"`, "entry 2 (missing.txt)", "entry 3 (test.txt): unknown hunk"},
+		},
+		"duplicate path": {
+			body:     `[{"path": "a.txt", "status": "approved"}, {"path": "a.txt", "status": "rejected"}]`,
+			messages: []string{"entry 1 (a.txt): file listed more than once"},
+		},
+		"missing status": {
+			body:     `[{"path": "a.txt"}]`,
+			messages: []string{"missing status or lines"},
+		},
+		"empty batch": {
+			body:     `[]`,
+			messages: []string{"no files"},
+		},
+		"unknown field": {
+			body:     `[{"path": "a.txt", "state": "approved"}]`,
+			messages: []string{"state"},
+		},
+	}
+
+	for name, tt := range tests {
+		mockStorage.saveCalled = false
+
+		w := doReviewBatch(t, server, query, tt.body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d: %s", name, http.StatusBadRequest, w.Code, w.Body.String())
+			continue
+		}
+		if mockStorage.saveCalled {
+			t.Errorf("%s: expected nothing to be saved", name)
+		}
+
+		var resp map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", name, err)
+		}
+		for _, message := range tt.messages {
+			if !strings.Contains(resp["message"], message) {
+				t.Errorf("%s: expected the error to mention %q, got %q", name, message, resp["message"])
+			}
+		}
+	}
+
+	// A rejection without a reason fails the whole batch when reasons are required
+	server.requireRejectReason = true
+	w := doReviewBatch(t, server, query, `[{"path": "a.txt", "status": "approved"}, {"path": "b.txt", "status": "rejected"}]`)
+	if w.Code != http.StatusBadRequest || mockStorage.saveCalled {
+		t.Errorf("Expected a missing reason to reject the batch, got %d (saved: %v)", w.Code, mockStorage.saveCalled)
+	}
+}
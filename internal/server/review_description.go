@@ -0,0 +1,89 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// maxDescriptionLength is the most characters a review description can have
+const maxDescriptionLength = 4000
+
+// descriptionResponse describes a comparison's saved description
+type descriptionResponse struct {
+	Description string `json:"description"`
+	Redirect    string `json:"redirect"`
+}
+
+// handleReviewDescription sets the free-text description of a whole
+// comparison's review, such as what it should focus on. An empty description
+// clears it.
+func (s *Server) handleReviewDescription(w http.ResponseWriter, r *http.Request) {
+	c := comparisonFromRequest(r)
+	if !c.complete() {
+		s.respondError(w, r, "Missing Parameters", "Missing required parameters for describing the review", http.StatusBadRequest)
+		return
+	}
+
+	description := strings.TrimSpace(strings.ReplaceAll(r.FormValue("description"), "\r\n", "\n"))
+	if n := utf8.RuneCountInString(description); n > maxDescriptionLength {
+		s.respondError(w, r, "Description Too Long", fmt.Sprintf("The description has %d characters, the limit is %d", n, maxDescriptionLength), http.StatusBadRequest)
+		return
+	}
+
+	redirectPath, ok := s.updateReviewState(w, r, c, func(state *models.ReviewState) {
+		state.Description = description
+	})
+	if !ok {
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, descriptionResponse{Description: description, Redirect: redirectPath})
+		return
+	}
+
+	http.Redirect(w, r, redirectPath, http.StatusSeeOther)
+}
+
+// updateReviewState applies update to the stored review state of c and saves
+// it, for the forms setting a field of the whole comparison's review. It
+// returns the diff page the form was posted from, to go back to, and whether
+// it saved; otherwise the error was already answered.
+func (s *Server) updateReviewState(w http.ResponseWriter, r *http.Request, c comparison, update func(*models.ReviewState)) (string, bool) {
+	if err := s.verifyComparisonCommits(c); err != nil {
+		s.respondError(w, r, "Commit Not Found", err.Error(), commitErrorStatus(err))
+		return "", false
+	}
+
+	unlock := s.reviewLocks.lock(c)
+	reviewState, err := s.storage.LoadReviewState(c.RepoPath, c.User, c.SourceBranch, c.TargetBranch, c.SourceCommit, c.TargetCommit)
+	if err != nil {
+		unlock()
+		s.respondError(w, r, "Review State Error", fmt.Sprintf("Failed to load review state: %v", err), http.StatusInternalServerError)
+		return "", false
+	}
+
+	update(reviewState)
+	err = s.storage.SaveReviewState(reviewState, c.RepoPath, c.User)
+	unlock()
+	if err != nil {
+		s.respondError(w, r, "Review State Error", fmt.Sprintf("Failed to save review state: %v", err), http.StatusInternalServerError)
+		return "", false
+	}
+
+	redirectPath := s.url(fmt.Sprintf("/diff?repo=%s&source=%s&target=%s&source_commit=%s&target_commit=%s",
+		url.QueryEscape(c.RepoPath),
+		url.QueryEscape(c.SourceBranch),
+		url.QueryEscape(c.TargetBranch),
+		url.QueryEscape(c.SourceCommit),
+		url.QueryEscape(c.TargetCommit)))
+	if file := r.URL.Query().Get("file"); file != "" {
+		redirectPath += "&file=" + url.QueryEscape(file)
+	}
+	return redirectPath, true
+}
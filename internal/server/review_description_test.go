@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// describeReview posts a description for the comparison in query
+func describeReview(t *testing.T, server *Server, query url.Values, description string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{"description": {description}}
+	req := httptest.NewRequest("POST", "/api/review-state/description?"+query.Encode(), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleReviewDescription(t *testing.T) {
+	server, mockStorage, query := setupReviewAPITest(t)
+	overrideTemplate(t, server, "diff.html", `{{define "diff.html"}}[{{.ReviewState.Description}}]{{end}}`)
+
+	w := describeReview(t, server, query, "  Payments refactor\r\nFocus on error handling \n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp descriptionResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := "Payments refactor\nFocus on error handling"
+	if resp.Description != expected || !strings.HasPrefix(resp.Redirect, "/diff?") {
+		t.Errorf("Expected the trimmed description and a redirect, got %+v", resp)
+	}
+	if !mockStorage.saveCalled || mockStorage.reviewState.Description != expected {
+		t.Errorf("Expected the description to be saved, got %+v", mockStorage.reviewState)
+	}
+
+	// The description shows on every page of the comparison
+	for _, file := range []string{"", "a.txt"} {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		if file != "" {
+			q.Set("file", file)
+		}
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest("GET", "/diff?"+q.Encode(), nil))
+		if body := w.Body.String(); !strings.Contains(body, "[Payments refactor\nFocus on error handling]") {
+			t.Errorf("Expected the description on the diff page of %q, got %s", file, body)
+		}
+	}
+
+	// The form redirects back to the page it was posted from, and an empty
+	// description clears it
+	query.Set("file", "a.txt")
+	req := httptest.NewRequest("POST", "/api/review-state/description?"+query.Encode(), strings.NewReader("description="))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if location := w.Header().Get("Location"); w.Code != http.StatusSeeOther || !strings.HasSuffix(location, "&file=a.txt") {
+		t.Errorf("Expected a redirect to a.txt, got %d to %q", w.Code, location)
+	}
+	if mockStorage.reviewState.Description != "" {
+		t.Errorf("Expected the description to be cleared, got %q", mockStorage.reviewState.Description)
+	}
+}
+
+func TestHandleReviewDescriptionErrors(t *testing.T) {
+	server, mockStorage, query := setupReviewAPITest(t)
+
+	if w := describeReview(t, server, query, strings.Repeat("x", maxDescriptionLength+1)); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a description over the limit, got %d", http.StatusBadRequest, w.Code)
+	}
+	if mockStorage.saveCalled {
+		t.Error("Expected a description over the limit not to be saved")
+	}
+
+	query.Del("target_commit")
+	if w := describeReview(t, server, query, "Notes"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without the commits, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// maxReviewImportSize bounds the request body of a review state import
+const maxReviewImportSize = 4 << 20
+
+// Modes of a review state import, for a comparison that already has a stored state
+const (
+	// importMerge adds the imported file reviews to the stored ones, keeping
+	// the stored status of files reviewed differently and reporting them
+	importMerge = "merge"
+	// importOverwrite replaces the stored state with the imported one
+	importOverwrite = "overwrite"
+	// importFailIfExists refuses the import
+	importFailIfExists = "fail-if-exists"
+)
+
+// importModes lists the valid import modes, merging by default
+var importModes = []string{importMerge, importOverwrite, importFailIfExists}
+
+// reviewImportConflict is a file the imported state gives another status than
+// the stored one, which is kept
+type reviewImportConflict struct {
+	Path           string `json:"path"`
+	Status         string `json:"status"`
+	ImportedStatus string `json:"imported_status"`
+}
+
+// reviewImportResponse is the JSON answer to a review state import
+type reviewImportResponse struct {
+	Mode string `json:"mode"`
+	// Imported is the number of file reviews taken from the imported state
+	Imported  int                    `json:"imported"`
+	Conflicts []reviewImportConflict `json:"conflicts"`
+	State     *models.ReviewState    `json:"state"`
+}
+
+// handleReviewImport stores a review state handed over from elsewhere, such as
+// another reviewer's review-state.json, as the requesting user's review of
+// the same commits in the repository named by the repo parameter. The body is
+// the review state document; its branches and commits, which may be
+// abbreviated, name the comparison. Unknown fields are refused.
+// The mode parameter, one of importModes, decides what happens when the
+// comparison was already reviewed here.
+func (s *Server) handleReviewImport(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = importMerge
+	}
+	if indexOf(importModes, mode) == -1 {
+		writeJSONError(w, "Invalid Mode", fmt.Sprintf("Unknown import mode %q, must be one of %v", mode, importModes), http.StatusBadRequest)
+		return
+	}
+
+	var imported models.ReviewState
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReviewImportSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&imported); err != nil {
+		writeJSONError(w, "Invalid Review State", fmt.Sprintf("Invalid review state: %v", err), http.StatusBadRequest)
+		return
+	}
+	if imported.Migrate() {
+		writeJSONError(w, "Invalid Review State", fmt.Sprintf("The review state has schema version %d, newer than the supported %d", imported.SchemaVersion, models.CurrentSchemaVersion), http.StatusBadRequest)
+		return
+	}
+
+	c := comparison{
+		RepoPath:     r.URL.Query().Get("repo"),
+		SourceBranch: imported.SourceBranch,
+		TargetBranch: imported.TargetBranch,
+		SourceCommit: imported.SourceCommit,
+		TargetCommit: imported.TargetCommit,
+		User:         userFromRequest(r),
+	}
+	if !c.complete() {
+		writeJSONError(w, "Missing Parameters", "A repository, and branches and commits in the review state, are required for an import", http.StatusBadRequest)
+		return
+	}
+	if err := validateImportedReviews(&imported, c.RepoPath); err != nil {
+		writeJSONError(w, "Invalid Review State", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo, exists, err := s.GetRepository(c.RepoPath)
+	if err != nil {
+		writeJSONError(w, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
+		return
+	}
+	if !exists {
+		writeJSONError(w, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+	// The state is stored under full hashes, whatever the document gave
+	if err := resolveCommits(repo, &c); err != nil {
+		writeJSONError(w, "Commit Not Found", err.Error(), commitErrorStatus(err))
+		return
+	}
+	imported.SourceCommit, imported.TargetCommit = c.SourceCommit, c.TargetCommit
+	imported.RepoPath = c.RepoPath
+
+	unlock := s.reviewLocks.lock(c)
+	defer unlock()
+
+	state, err := s.storage.LoadReviewState(c.RepoPath, c.User, c.SourceBranch, c.TargetBranch, c.SourceCommit, c.TargetCommit)
+	if err != nil {
+		writeJSONError(w, "Review State Error", fmt.Sprintf("failed to load review state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := reviewImportResponse{Mode: mode, Conflicts: []reviewImportConflict{}}
+	switch {
+	case !hasStoredReviews(state) || mode == importOverwrite:
+		imported.User = c.User
+		state = &imported
+		response.Imported = len(imported.ReviewedFiles)
+	case mode == importFailIfExists:
+		writeJSONError(w, "Review State Exists", "The comparison already has a stored review state; import it with the merge or overwrite mode", http.StatusConflict)
+		return
+	default:
+		response.Imported, response.Conflicts = mergeReviewState(state, &imported)
+	}
+
+	if err := s.storage.SaveReviewState(state, c.RepoPath, c.User); err != nil {
+		writeJSONError(w, "Review State Error", fmt.Sprintf("failed to save review state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response.State = state
+	writeJSON(w, http.StatusOK, response)
+}
+
+// validateImportedReviews checks the file reviews of an imported state and
+// moves them to repoPath, as the state may come from a clone elsewhere. The
+// returned error lists every invalid file review.
+func validateImportedReviews(state *models.ReviewState, repoPath string) error {
+	var errs []error
+	seen := make(map[string]bool, len(state.ReviewedFiles))
+	for i := range state.ReviewedFiles {
+		review := &state.ReviewedFiles[i]
+		switch {
+		case review.Path == "":
+			errs = append(errs, fmt.Errorf("file review %d: missing path", i))
+			continue
+		case seen[review.Path]:
+			errs = append(errs, fmt.Errorf("file review %d (%s): file listed more than once", i, review.Path))
+			continue
+		}
+		seen[review.Path] = true
+
+		for key, status := range review.Lines {
+			if !isReviewStatus(status) {
+				errs = append(errs, fmt.Errorf("file review %d (%s): invalid status %q for %q", i, review.Path, status, key))
+			}
+		}
+		review.Repo = repoPath
+	}
+	return errors.Join(errs...)
+}
+
+// mergeReviewState adds the file reviews of imported to state. Files state
+// reviewed already keep their review; those imported with another status are
+// returned as conflicts. The description and sign-off are only taken when
+// state has none. It returns the number of file reviews taken.
+func mergeReviewState(state, imported *models.ReviewState) (int, []reviewImportConflict) {
+	taken := 0
+	conflicts := []reviewImportConflict{}
+	for _, review := range imported.ReviewedFiles {
+		existing, ok := state.File(review.Repo, review.Path)
+		if !ok {
+			state.AddFile(review)
+			taken++
+			continue
+		}
+		if status, importedStatus := existing.Status(), review.Status(); status != importedStatus {
+			conflicts = append(conflicts, reviewImportConflict{Path: review.Path, Status: status, ImportedStatus: importedStatus})
+		}
+	}
+
+	if state.Description == "" {
+		state.Description = imported.Description
+	}
+	if !state.IsCompleted() && imported.IsCompleted() {
+		state.Complete(imported.CompletedBy, *imported.CompletedAt)
+	}
+	if state.ChangedFiles == 0 {
+		state.ChangedFiles = imported.ChangedFiles
+	}
+	return taken, conflicts
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// setupReviewImportTest returns a server with real storage, a test repository
+// and a review state of its feature branch as exported from another clone
+func setupReviewImportTest(t *testing.T) (*Server, storage.Storage, string, models.ReviewState) {
+	t.Helper()
+
+	store, err := storage.OpenStorage(storage.DefaultBackend, storage.Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	server, err := New(store)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	repoDir := setupGitRepo(t)
+	if err := store.SaveRepositories([]string{repoDir}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+
+	bundle := models.ReviewState{
+		SchemaVersion: models.CurrentSchemaVersion,
+		SourceBranch:  "feature",
+		TargetBranch:  "main",
+		SourceCommit:  runGit(t, repoDir, "rev-parse", "feature"),
+		TargetCommit:  runGit(t, repoDir, "rev-parse", "main"),
+		Description:   "Handed over",
+		ReviewedFiles: []models.FileReview{
+			{Repo: "/elsewhere/clone", Path: "test.txt", Lines: map[string]string{"all": models.StateRejected}, Reason: "Needs tests"},
+			{Repo: "/elsewhere/clone", Path: "other.txt", Lines: map[string]string{"all": models.StateApproved}},
+		},
+	}
+	return server, store, repoDir, bundle
+}
+
+// importReviewState posts a review state to the import endpoint
+func importReviewState(t *testing.T, server *Server, repoDir, mode string, state models.ReviewState) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("Failed to encode review state: %v", err)
+	}
+	query := url.Values{"repo": {repoDir}}
+	if mode != "" {
+		query.Set("mode", mode)
+	}
+	req := httptest.NewRequest("POST", "/api/review-state/import?"+query.Encode(), bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	return w
+}
+
+// storeLocalReview saves a review of the bundle's comparison approving test.txt
+func storeLocalReview(t *testing.T, store storage.Storage, repoDir string, bundle models.ReviewState) {
+	t.Helper()
+	local := &models.ReviewState{
+		SourceBranch: bundle.SourceBranch,
+		TargetBranch: bundle.TargetBranch,
+		SourceCommit: bundle.SourceCommit,
+		TargetCommit: bundle.TargetCommit,
+		ReviewedFiles: []models.FileReview{
+			{Repo: repoDir, Path: "test.txt", Lines: map[string]string{"all": models.StateApproved}},
+		},
+	}
+	if err := store.SaveReviewState(local, repoDir, ""); err != nil {
+		t.Fatalf("Failed to save review state: %v", err)
+	}
+}
+
+// loadStatuses returns the stored file statuses of the bundle's comparison
+func loadStatuses(t *testing.T, store storage.Storage, repoDir string, bundle models.ReviewState) map[string]string {
+	t.Helper()
+	state, err := store.LoadReviewState(repoDir, "", bundle.SourceBranch, bundle.TargetBranch, bundle.SourceCommit, bundle.TargetCommit)
+	if err != nil {
+		t.Fatalf("LoadReviewState failed: %v", err)
+	}
+	return state.FileStatuses(repoDir)
+}
+
+func TestHandleReviewImportNew(t *testing.T) {
+	server, store, repoDir, bundle := setupReviewImportTest(t)
+
+	w := importReviewState(t, server, repoDir, "fail-if-exists", bundle)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// The reviews move to the local clone
+	expected := map[string]string{"test.txt": models.StateRejected, "other.txt": models.StateApproved}
+	if statuses := loadStatuses(t, store, repoDir, bundle); !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected statuses %v, got %v", expected, statuses)
+	}
+}
+
+// TestHandleReviewImportAbbreviatedCommits tests that a state naming its
+// commits abbreviated is stored under their full hashes
+func TestHandleReviewImportAbbreviatedCommits(t *testing.T) {
+	server, store, repoDir, bundle := setupReviewImportTest(t)
+	storeLocalReview(t, store, repoDir, bundle)
+
+	abbreviated := bundle
+	abbreviated.SourceCommit = bundle.SourceCommit[:7]
+	abbreviated.TargetCommit = bundle.TargetCommit[:10]
+	w := importReviewState(t, server, repoDir, "fail-if-exists", abbreviated)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected the stored review of the full hashes found, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = importReviewState(t, server, repoDir, "overwrite", abbreviated)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response reviewImportResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.State.SourceCommit != bundle.SourceCommit || response.State.TargetCommit != bundle.TargetCommit {
+		t.Errorf("Expected the full hashes stored, got %s and %s", response.State.SourceCommit, response.State.TargetCommit)
+	}
+	expected := map[string]string{"test.txt": models.StateRejected, "other.txt": models.StateApproved}
+	if statuses := loadStatuses(t, store, repoDir, bundle); !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected the imported statuses under the full hashes, got %v", statuses)
+	}
+}
+
+func TestHandleReviewImportFailIfExists(t *testing.T) {
+	server, store, repoDir, bundle := setupReviewImportTest(t)
+	storeLocalReview(t, store, repoDir, bundle)
+
+	if w := importReviewState(t, server, repoDir, "fail-if-exists", bundle); w.Code != http.StatusConflict {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+	expected := map[string]string{"test.txt": models.StateApproved}
+	if statuses := loadStatuses(t, store, repoDir, bundle); !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected the stored review left alone, got %v", statuses)
+	}
+}
+
+func TestHandleReviewImportOverwrite(t *testing.T) {
+	server, store, repoDir, bundle := setupReviewImportTest(t)
+	storeLocalReview(t, store, repoDir, bundle)
+
+	w := importReviewState(t, server, repoDir, "overwrite", bundle)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expected := map[string]string{"test.txt": models.StateRejected, "other.txt": models.StateApproved}
+	if statuses := loadStatuses(t, store, repoDir, bundle); !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected the imported statuses, got %v", statuses)
+	}
+}
+
+func TestHandleReviewImportMerge(t *testing.T) {
+	server, store, repoDir, bundle := setupReviewImportTest(t)
+	storeLocalReview(t, store, repoDir, bundle)
+
+	// Merging is the default
+	w := importReviewState(t, server, repoDir, "", bundle)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response reviewImportResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Mode != "merge" || response.Imported != 1 {
+		t.Errorf("Expected one file merged in, got %+v", response)
+	}
+	expectedConflicts := []reviewImportConflict{{Path: "test.txt", Status: models.StateApproved, ImportedStatus: models.StateRejected}}
+	if !reflect.DeepEqual(response.Conflicts, expectedConflicts) {
+		t.Errorf("Expected conflicts %+v, got %+v", expectedConflicts, response.Conflicts)
+	}
+
+	// The stored status of a conflicting file is kept
+	expected := map[string]string{"test.txt": models.StateApproved, "other.txt": models.StateApproved}
+	if statuses := loadStatuses(t, store, repoDir, bundle); !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected statuses %v, got %v", expected, statuses)
+	}
+	if response.State.Description != "Handed over" {
+		t.Errorf("Expected the description taken over, got %q", response.State.Description)
+	}
+
+	// Files given the same status don't conflict
+	w = importReviewState(t, server, repoDir, "merge", bundle)
+	response = reviewImportResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Imported != 0 || len(response.Conflicts) != 1 {
+		t.Errorf("Expected only the conflict on test.txt again, got %+v", response)
+	}
+}
+
+func TestHandleReviewImportErrors(t *testing.T) {
+	server, _, repoDir, bundle := setupReviewImportTest(t)
+
+	if w := importReviewState(t, server, repoDir, "replace", bundle); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unknown mode, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	invalid := bundle
+	invalid.ReviewedFiles = []models.FileReview{{Path: "test.txt", Lines: map[string]string{"all": "maybe"}}}
+	if w := importReviewState(t, server, repoDir, "", invalid); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid status, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	missing := bundle
+	missing.SourceCommit = ""
+	if w := importReviewState(t, server, repoDir, "", missing); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a missing commit, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	ref := bundle
+	ref.SourceCommit = "feature"
+	if w := importReviewState(t, server, repoDir, "", ref); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a branch name as commit, got %d", http.StatusNotFound, w.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/api/review-state/import?repo="+url.QueryEscape(repoDir), strings.NewReader(`{"source_branch": "feature", "reviewed_file": []}`))
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unknown field") {
+		t.Errorf("Expected status code %d for an unknown field, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+
+	unknown := bundle
+	unknown.SourceCommit = "0123456789012345678901234567890123456789"
+	if w := importReviewState(t, server, repoDir, "", unknown); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for an unknown commit, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import "sync"
+
+// reviewLockKey identifies a review state the way storage files it
+type reviewLockKey struct {
+	repoPath, user, sourceCommit, targetCommit string
+}
+
+// reviewLocks serializes the load-modify-save sequences on review states, so
+// concurrent updates of the same comparison from several tabs or API clients
+// build on each other instead of the last save overwriting the others. The
+// zero value is ready to use.
+type reviewLocks struct {
+	mu    sync.Mutex
+	locks map[reviewLockKey]*reviewLock
+}
+
+// reviewLock is the lock of a single review state, dropped once nobody holds
+// or waits for it
+type reviewLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock locks the review state of the comparison and returns the function
+// unlocking it
+func (l *reviewLocks) lock(c comparison) (unlock func()) {
+	key := reviewLockKey{c.RepoPath, c.User, c.SourceCommit, c.TargetCommit}
+
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[reviewLockKey]*reviewLock)
+	}
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &reviewLock{}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
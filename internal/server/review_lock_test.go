@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// TestConcurrentReviewUpdates tests that concurrent updates of the same
+// comparison are all kept rather than overwriting each other
+func TestConcurrentReviewUpdates(t *testing.T) {
+	store, err := storage.OpenStorage(storage.DefaultBackend, storage.Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	server, err := New(store)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	const files = 20
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	for i := 0; i < files; i++ {
+		writeFile(t, repoDir, fmt.Sprintf("file%02d.txt", i), "content\n")
+	}
+	runGit(t, repoDir, "add", ".")
+	runGit(t, repoDir, "commit", "-m", "Add files")
+	runGit(t, repoDir, "checkout", "main")
+	if err := store.SaveRepositories([]string{repoDir}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("source", "feature")
+	query.Set("target", "main")
+	query.Set("source_commit", runGit(t, repoDir, "rev-parse", "feature"))
+	query.Set("target_commit", runGit(t, repoDir, "rev-parse", "main"))
+	query.Set("status", models.StateApproved)
+	query.Set("ajax", "1")
+
+	// Every file is approved at once, along with completing the review
+	var wg sync.WaitGroup
+	codes := make(chan int, files+1)
+	for i := 0; i < files; i++ {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("file", fmt.Sprintf("file%02d.txt", i))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			server.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/review-state?"+q.Encode(), nil))
+			codes <- w.Code
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/review-state/complete?"+query.Encode(), nil))
+		codes <- w.Code
+	}()
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, code)
+		}
+	}
+
+	state, err := store.LoadReviewState(repoDir, "", "feature", "main", query.Get("source_commit"), query.Get("target_commit"))
+	if err != nil {
+		t.Fatalf("Failed to load review state: %v", err)
+	}
+	if len(state.ReviewedFiles) != files {
+		t.Errorf("Expected all %d reviews to be kept, got %d", files, len(state.ReviewedFiles))
+	}
+	for i := 0; i < files; i++ {
+		path := fmt.Sprintf("file%02d.txt", i)
+		if status, _ := state.FileStatus(repoDir, path); status != models.StateApproved {
+			t.Errorf("Expected %s to be approved, got %s", path, status)
+		}
+	}
+	if !state.IsCompleted() {
+		t.Error("Expected the completion to be kept too")
+	}
+}
+
+func TestReviewLocksAreReleased(t *testing.T) {
+	var locks reviewLocks
+	c := comparison{RepoPath: "/repo", SourceCommit: "a", TargetCommit: "b"}
+
+	unlock := locks.lock(c)
+	other := locks.lock(comparison{RepoPath: "/repo", User: "alice", SourceCommit: "a", TargetCommit: "b"})
+	if len(locks.locks) != 2 {
+		t.Errorf("Expected each user's state to have its own lock, got %d", len(locks.locks))
+	}
+	unlock()
+	other()
+
+	if len(locks.locks) != 0 {
+		t.Errorf("Expected unused locks to be dropped, got %d", len(locks.locks))
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// Policies for writing a review note on a commit that already has one
+const (
+	// NotesAppend adds the review summary after the existing note
+	NotesAppend = "append"
+	// NotesReplace overwrites the existing note with the review summary
+	NotesReplace = "replace"
+)
+
+// NotesPolicies lists the policies WithGitNotes accepts
+var NotesPolicies = []string{NotesAppend, NotesReplace}
+
+// WithGitNotes writes the summary of every completed review as a git note on
+// the reviewed source commit, under git.ReviewNotesRef, so approvals travel
+// with the repository. It writes to the repository, hence it is off unless
+// enabled. policy is one of NotesPolicies.
+func WithGitNotes(policy string) Option {
+	return func(s *Server) {
+		s.gitNotes = policy
+	}
+}
+
+// writeReviewNote records the summary of a completed review as a git note on
+// its source commit
+func (s *Server) writeReviewNote(c comparison, state *models.ReviewState, paths []string, statuses map[string]string) error {
+	repo, exists, err := s.GetRepository(c.RepoPath)
+	if err != nil {
+		return fmt.Errorf("error loading repository: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("repository not found: %s", c.RepoPath)
+	}
+
+	return repo.AddReviewNote(c.SourceCommit, reviewNote(c, state, paths, statuses, s.hashLength), s.gitNotes == NotesReplace)
+}
+
+// reviewNote summarises a completed review: its description and the status of
+// every file, then the sign-off as trailers that git interpret-trailers can
+// read. The heading abbreviates the commits to hashLength characters; the
+// trailers keep them whole.
+func reviewNote(c comparison, state *models.ReviewState, paths []string, statuses map[string]string, hashLength int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Review of %s (%s) into %s (%s)\n\n", c.SourceBranch, abbreviateHash(c.SourceCommit, hashLength), c.TargetBranch, abbreviateHash(c.TargetCommit, hashLength))
+	if state.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", state.Description)
+	}
+
+	for _, path := range paths {
+		status, ok := statuses[path]
+		if !ok {
+			status = models.StateUnreviewed
+		}
+		fmt.Fprintf(&b, "%-10s %s", status, path)
+		if review, ok := state.File(c.RepoPath, path); ok && status == models.StateRejected && review.Reason != "" {
+			fmt.Fprintf(&b, ": %s", review.Reason)
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "\nReviewed-by: %s\n", state.CompletedBy)
+	if state.CompletedAt != nil {
+		fmt.Fprintf(&b, "Reviewed-at: %s\n", state.CompletedAt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "Review-target: %s\n", c.TargetCommit)
+	return b.String()
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/models"
+)
+
+func TestReviewNote(t *testing.T) {
+	completedAt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	state := &models.ReviewState{
+		ReviewedFiles: []models.FileReview{
+			{Repo: "/repo", Path: "a.go", Lines: map[string]string{"all": models.StateApproved}},
+			{Repo: "/repo", Path: "b.go", Lines: map[string]string{"all": models.StateRejected}, Reason: "Needs tests"},
+		},
+		CompletedBy: "alice",
+		CompletedAt: &completedAt,
+	}
+	c := comparison{RepoPath: "/repo", SourceBranch: "feature", TargetBranch: "main", SourceCommit: "1111111111111111", TargetCommit: "2222222222222222"}
+	statuses := map[string]string{"a.go": models.StateApproved, "b.go": models.StateRejected}
+
+	note := reviewNote(c, state, []string{"a.go", "b.go", "c.go"}, statuses, defaultHashLength)
+	expected := "Review of feature (1111111) into main (2222222)\n\n" +
+		"approved   a.go\n" +
+		"rejected   b.go: Needs tests\n" +
+		"unreviewed c.go\n\n" +
+		"Reviewed-by: alice\n" +
+		"Reviewed-at: 2024-05-01T10:30:00Z\n" +
+		"Review-target: 2222222222222222\n"
+	if note != expected {
+		t.Errorf("Unexpected note:\n%s\nexpected:\n%s", note, expected)
+	}
+
+	// The review's description leads the file list
+	state.Description = "Focus on error handling"
+	if note := reviewNote(c, state, []string{"a.go"}, statuses, defaultHashLength); !strings.HasPrefix(note, "Review of feature (1111111) into main (2222222)\n\nFocus on error handling\n\napproved   a.go\n") {
+		t.Errorf("Expected the description in the note, got:\n%s", note)
+	}
+}
+
+// TestCompleteReviewWritesGitNote tests that completing a review writes its
+// summary as a git note only when enabled, following the policy for existing notes
+func TestCompleteReviewWritesGitNote(t *testing.T) {
+	server, _, query := setupReviewAPITest(t)
+	repo := git.NewRepository(query.Get("repo"))
+	sourceCommit := query.Get("source_commit")
+
+	// Notes are off by default
+	if w := completeReview(t, server, query.Encode()); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if _, err := repo.GetReviewNote(sourceCommit); !errors.Is(err, git.ErrNoNote) {
+		t.Fatalf("Expected no note without the option, got %v", err)
+	}
+
+	WithGitNotes(NotesAppend)(server)
+	rejectQuery := url.Values{}
+	for k, v := range query {
+		rejectQuery[k] = v
+	}
+	rejectQuery.Set("reason", "Needs tests")
+	if code, _ := doReviewAPI(t, server, "POST", "/api/review/reject", rejectQuery, "b.txt"); code != http.StatusOK {
+		t.Fatalf("Failed to reject b.txt: %d", code)
+	}
+
+	w := completeReview(t, server, query.Encode())
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp completionResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Note != git.ReviewNotesRef {
+		t.Errorf("Expected the response to name the notes ref, got %+v", resp)
+	}
+
+	note, err := repo.GetReviewNote(sourceCommit)
+	if err != nil {
+		t.Fatalf("Expected a note on the source commit, got %v", err)
+	}
+	for _, expected := range []string{"rejected   b.txt: Needs tests", "unreviewed a.txt", "Reviewed-by: "} {
+		if !strings.Contains(note, expected) {
+			t.Errorf("Expected the note to contain %q, got:\n%s", expected, note)
+		}
+	}
+
+	// Appending keeps the earlier summary, replacing drops it
+	completeReview(t, server, query.Encode())
+	if note, _ := repo.GetReviewNote(sourceCommit); strings.Count(note, "Review of feature") != 2 {
+		t.Errorf("Expected two appended summaries, got:\n%s", note)
+	}
+	WithGitNotes(NotesReplace)(server)
+	completeReview(t, server, query.Encode())
+	if note, _ := repo.GetReviewNote(sourceCommit); strings.Count(note, "Review of feature") != 1 {
+		t.Errorf("Expected a single summary after replacing, got:\n%s", note)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// noMergeBaseParam is the diff view parameter telling that a three-dot range
+// was diffed two-dot, because its sides have no common ancestor
+const noMergeBaseParam = "no_merge_base"
+
+// revisionRange is a comparison entered as a git range expression, such as
+// main..feature or v1.0...v1.1
+type revisionRange struct {
+	// Target is the left side of the range, the base the source is compared against
+	Target string
+	// Source is the right side of the range
+	Source string
+	// MergeBase diffs the source against its merge base with the target, as
+	// the three-dot form git diff A...B does, instead of against the target itself
+	MergeBase bool
+}
+
+// parseRevisionRange parses a two-dot (A..B) or three-dot (A...B) range
+// expression. Both sides are required, since git's implied HEAD means
+// whatever happens to be checked out, and each side must be a single
+// revision: another range, whitespace or a leading dash is refused.
+func parseRevisionRange(expr string) (revisionRange, error) {
+	expr = strings.TrimSpace(expr)
+
+	operator := ".."
+	if strings.Contains(expr, "...") {
+		operator = "..."
+	}
+	target, source, ok := strings.Cut(expr, operator)
+	if !ok {
+		return revisionRange{}, fmt.Errorf("invalid range %q: expected A..B or A...B", expr)
+	}
+	if target == "" || source == "" {
+		return revisionRange{}, fmt.Errorf("invalid range %q: both sides are required", expr)
+	}
+
+	for _, side := range []string{target, source} {
+		if err := validateRangeSide(side); err != nil {
+			return revisionRange{}, fmt.Errorf("invalid range %q: %w", expr, err)
+		}
+	}
+
+	return revisionRange{Target: target, Source: source, MergeBase: operator == "..."}, nil
+}
+
+// validateRangeSide checks that one side of a range expression is a single
+// revision that can be passed to git without being taken for an option
+func validateRangeSide(side string) error {
+	switch {
+	case strings.HasPrefix(side, "-"):
+		return fmt.Errorf("%q can't start with a dash", side)
+	case strings.Contains(side, ".."):
+		return fmt.Errorf("%q is not a single revision", side)
+	case strings.HasPrefix(side, ".") || strings.HasSuffix(side, "."):
+		return fmt.Errorf("%q can't start or end with a dot", side)
+	case strings.IndexFunc(side, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) != -1:
+		return fmt.Errorf("%q can't contain whitespace", side)
+	}
+	return nil
+}
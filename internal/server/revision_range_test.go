@@ -0,0 +1,154 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseRevisionRange(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected revisionRange
+		wantErr  bool
+	}{
+		{expr: "main..feature", expected: revisionRange{Target: "main", Source: "feature"}},
+		{expr: "v1.0..v1.1", expected: revisionRange{Target: "v1.0", Source: "v1.1"}},
+		{expr: "main...feature", expected: revisionRange{Target: "main", Source: "feature", MergeBase: true}},
+		{expr: "  origin/main...feature/x  ", expected: revisionRange{Target: "origin/main", Source: "feature/x", MergeBase: true}},
+		{expr: "abc1234..HEAD~2", expected: revisionRange{Target: "abc1234", Source: "HEAD~2"}},
+		{expr: "feature@{1}..feature", expected: revisionRange{Target: "feature@{1}", Source: "feature"}},
+		{expr: "main", wantErr: true},
+		{expr: "", wantErr: true},
+		{expr: "main..", wantErr: true},
+		{expr: "..feature", wantErr: true},
+		{expr: "...", wantErr: true},
+		{expr: "a..b..c", wantErr: true},
+		{expr: "a....b", wantErr: true},
+		{expr: "main..-feature", wantErr: true},
+		{expr: "--output=x..main", wantErr: true},
+		{expr: "main ..feature", wantErr: true},
+		{expr: "main..feature branch", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRevisionRange(tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %+v", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %+v, got %+v", tt.expr, tt.expected, got)
+		}
+	}
+}
+
+// TestHandleCompareRange tests that a range expression on the compare form
+// picks the branches, diffing three-dot ranges from the merge base
+func TestHandleCompareRange(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	repoDir := setupGitRepo(t)
+	writeFile(t, repoDir, "main.txt", "main\n")
+	runGit(t, repoDir, "add", "main.txt")
+	runGit(t, repoDir, "commit", "-m", "Main change")
+	mockStorage.repositories = []string{repoDir}
+
+	compare := func(expr string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Set("repo", repoDir)
+		form.Set("source", "main")
+		form.Set("target", "main")
+		form.Set("range", expr)
+
+		req := httptest.NewRequest("POST", "/compare", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.handleCompare(w, req)
+		return w
+	}
+
+	mergeBase := runGit(t, repoDir, "merge-base", "main", "feature")
+	tests := []struct {
+		expr           string
+		expectedTarget string
+		expectedCommit string
+	}{
+		{expr: "main..feature", expectedTarget: "main", expectedCommit: runGit(t, repoDir, "rev-parse", "main")},
+		{expr: "main...feature", expectedTarget: mergeBase, expectedCommit: mergeBase},
+	}
+
+	for _, tt := range tests {
+		w := compare(tt.expr)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("%s: expected status code %d, got %d: %s", tt.expr, http.StatusSeeOther, w.Code, w.Body.String())
+		}
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("Failed to parse redirect location: %v", err)
+		}
+		query := location.Query()
+		if query.Get("source") != "feature" || query.Get("source_commit") != runGit(t, repoDir, "rev-parse", "feature") {
+			t.Errorf("%s: expected feature as the source, got %s", tt.expr, location)
+		}
+		if query.Get("target") != tt.expectedTarget || query.Get("target_commit") != tt.expectedCommit {
+			t.Errorf("%s: expected target %s at %s, got %s", tt.expr, tt.expectedTarget, tt.expectedCommit, location)
+		}
+	}
+
+	if w := compare("main..feature..x"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a malformed range to be refused, got %d", w.Code)
+	}
+
+	runGit(t, repoDir, "checkout", "--orphan", "unrelated")
+	runGit(t, repoDir, "commit", "-m", "Unrelated root")
+	runGit(t, repoDir, "checkout", "main")
+
+	// Without a merge base, a three-dot range falls back to the two-dot diff
+	w := compare("main...unrelated")
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected unrelated branches to be compared, got %d: %s", w.Code, w.Body.String())
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to parse redirect location: %v", err)
+	}
+	query := location.Query()
+	if query.Get("target") != "main" || query.Get("target_commit") != runGit(t, repoDir, "rev-parse", "main") || query.Get(noMergeBaseParam) != "1" {
+		t.Errorf("Expected a two-dot diff against main, got %s", location)
+	}
+}
+
+// TestHandleDiffViewOrphanBranch tests that an orphan branch compared without
+// a merge base gets the full diff of its contents, with a note saying why
+func TestHandleDiffViewOrphanBranch(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{if .NoMergeBase}}no merge base{{end}}{{range .Files}}|{{.Path}}{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "--orphan", "unrelated")
+	runGit(t, repoDir, "rm", "-rf", "--quiet", ".")
+	writeFile(t, repoDir, "other.txt", "other\n")
+	runGit(t, repoDir, "add", "other.txt")
+	runGit(t, repoDir, "commit", "-m", "Unrelated root")
+	runGit(t, repoDir, "checkout", "main")
+	mockStorage.repositories = []string{repoDir}
+
+	req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=unrelated&target=main&"+noMergeBaseParam+"=1", nil)
+	w := httptest.NewRecorder()
+	server.handleDiffView(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "no merge base|other.txt|test.txt") {
+		t.Errorf("Expected the note and the full diff of both trees, got %s", body)
+	}
+}
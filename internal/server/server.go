@@ -2,7 +2,10 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
@@ -11,7 +14,10 @@ import (
 	"net/url"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/darccio/diffty/internal/git"
 	"github.com/darccio/diffty/internal/models"
@@ -30,35 +36,232 @@ var getTemplateDir = func() fs.FS {
 //go:embed static
 var staticDir embed.FS
 
+// ErrRepositoryUnavailable is returned when a registered repository was moved or deleted on disk
+var ErrRepositoryUnavailable = errors.New("repository is no longer available")
+
+// ErrRepositoryLimit is returned when adding a repository would exceed the configured maximum
+var ErrRepositoryLimit = errors.New("repository limit reached")
+
+// ErrRepositoryNotAllowed is returned when adding a repository outside of the allowed roots
+var ErrRepositoryNotAllowed = errors.New("repository is outside of the allowed directories")
+
 // Server represents the HTTP server
 type Server struct {
 	storage storage.Storage
 	tmpl    *template.Template
-	mux     *http.ServeMux
+	// brokenTemplates holds the parse errors of the templates that failed to load
+	brokenTemplates map[string]error
+	mux             *http.ServeMux
+	maxRepos        int
+	// authTokens maps user names to their tokens; empty disables authentication
+	authTokens map[string]string
+	// requireRejectReason makes rejecting a file without a reason an error
+	requireRejectReason bool
+	// skippedComplete counts skipped files as done in progress and navigation
+	skippedComplete bool
+	// startRepo is the repository the index opens straight away, if any
+	startRepo string
+	// startRepoPending is set until the index opened startRepo, which it
+	// only does on the first visit so the index stays reachable
+	startRepoPending *atomic.Bool
+	// completionRequiresAllFiles refuses to complete a review while files lack a status
+	completionRequiresAllFiles bool
+	// eventPollInterval is how often the events endpoint checks the branches for new commits
+	eventPollInterval time.Duration
+	// eventsClosed is done once CloseEvents ended the event streams
+	eventsClosed context.Context
+	closeEvents  context.CancelFunc
+	// reviewLocks serializes updates of each review state
+	reviewLocks *reviewLocks
+	// noRenames turns git's rename detection off for every diff
+	noRenames bool
+	// rateLimiter limits the rate of requests running git; nil means unlimited
+	rateLimiter *rateLimiter
+	// eventStreams caps the event streams each client holds open when the rate
+	// is limited, as streams aren't charged to it; nil means unlimited
+	eventStreams *streamLimiter
+	// allowedRoots are the directories repositories can be added from; empty allows any
+	allowedRoots []string
+	// patchDir is the directory patch files are reviewed from; empty disables them
+	patchDir string
+	// gitNotes is the policy for writing completed reviews as git notes; empty disables them
+	gitNotes string
+	// maxDiffBytes caps the diff output read for a request; zero means unlimited
+	maxDiffBytes int64
+	// checkCurrentCommits refuses file reviews of commits the branches moved away from
+	checkCurrentCommits bool
+	// themes are the names of the bundled themes clients can pick from
+	themes []string
+	// metrics counts requests and git commands; nil when they aren't exported
+	metrics *metrics
+	// autoResume opens the only comparison in progress of a repository instead of offering it
+	autoResume bool
+	// repositoryBranches caches the branches of the index's quick comparisons
+	repositoryBranches *repositoryBranches
+	// dirtyWorkingTrees caches whether the repositories' working trees have uncommitted changes
+	dirtyWorkingTrees *dirtyWorkingTrees
+	// changedFileCounts caches the number of files of comparisons' default diffs
+	changedFileCounts *changedFileCounts
+	// largeFileLines and largeFileBytes are the sizes over which a file's diff
+	// isn't rendered unless asked for; zero means no limit
+	largeFileLines int
+	largeFileBytes int64
+	// lastViewed records the file last viewed in each comparison
+	lastViewed *lastViewedFiles
+	// basePath is the path prefix every route is served under; empty serves from the root
+	basePath string
+	// hashLength is how many characters of commit hashes are displayed
+	hashLength int
+	// statusMetas are the labels and colors review statuses are shown with
+	statusMetas models.StatusMetas
+}
+
+// Option configures optional Server behavior
+type Option func(*Server)
+
+// WithMaxRepositories limits how many repositories can be registered.
+// Zero or a negative value means unlimited.
+func WithMaxRepositories(n int) Option {
+	return func(s *Server) {
+		s.maxRepos = n
+	}
+}
+
+// WithRequiredRejectionReason makes every rejection carry a reason
+func WithRequiredRejectionReason() Option {
+	return func(s *Server) {
+		s.requireRejectReason = true
+	}
+}
+
+// WithSkippedAsComplete counts skipped files as complete in the review progress
+// and next-unreviewed navigation. By default they still count as outstanding.
+func WithSkippedAsComplete() Option {
+	return func(s *Server) {
+		s.skippedComplete = true
+	}
+}
+
+// WithoutRenameDetection turns git's rename detection off for every diff,
+// which speeds up huge changesets at the cost of showing renamed files as a
+// deletion and an addition
+func WithoutRenameDetection() Option {
+	return func(s *Server) {
+		s.noRenames = true
+	}
+}
+
+// WithAllowedRoots only lets repositories inside one of the given directories
+// be added, so the add repository form can't point git at arbitrary paths.
+// Without roots any directory is allowed.
+func WithAllowedRoots(roots []string) Option {
+	return func(s *Server) {
+		s.allowedRoots = nil
+		for _, root := range roots {
+			if root == "" {
+				continue
+			}
+			if abs, err := filepath.Abs(root); err == nil {
+				root = abs
+			}
+			s.allowedRoots = append(s.allowedRoots, resolvePath(root))
+		}
+	}
+}
+
+// resolvePath resolves the symbolic links of an absolute path, so a link can't
+// lead out of an allowed root. Paths that can't be resolved are only cleaned.
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+// isAllowedPath reports whether an absolute path lies inside one of the
+// allowed roots, or whether any path is allowed
+func (s *Server) isAllowedPath(absPath string) bool {
+	if len(s.allowedRoots) == 0 {
+		return true
+	}
+
+	path := resolvePath(absPath)
+	for _, root := range s.allowedRoots {
+		if pathWithin(root, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathWithin reports whether a resolved path is root or lies inside of it
+func pathWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
 
+// ErrMissingRejectReason is returned when a rejection lacks a reason while reasons are required
+var ErrMissingRejectReason = errors.New("a reason is required to reject a file")
+
 // New creates a new Server instance
-func New(storage storage.Storage) (*Server, error) {
+func New(storage storage.Storage, opts ...Option) (*Server, error) {
+	// Declared ahead for the template functions depending on its options
+	var server *Server
+
 	// Create template functions map
 	funcMap := template.FuncMap{
-		"hasPrefix": strings.HasPrefix, // Used to check if a string starts with a prefix
-		"add":       func(a, b int) int { return a + b },
-		"sub":       func(a, b int) int { return a - b },
-		"index":     func(arr []map[string]string, i int) map[string]string { return arr[i] },
-		"len":       func(arr []map[string]string) int { return len(arr) },
+		"hasPrefix":  strings.HasPrefix, // Used to check if a string starts with a prefix
+		"add":        func(a, b int) int { return a + b },
+		"sub":        func(a, b int) int { return a - b },
+		"index":      func(arr []map[string]string, i int) map[string]string { return arr[i] },
+		"len":        func(arr []map[string]string) int { return len(arr) },
+		"shortHash":  func(hash string) string { return server.ShortHash(hash) },
+		"hunkReview": newHunkReview,
+		// Labels and colors of review statuses, see WithStatusMeta
+		"statusMeta":  func(status string) models.StatusMeta { return server.statusMetas.For(status) },
+		"statusMetas": func() models.StatusMetas { return server.statusMetas },
+		// Prefix of the links rendered by the templates, see WithBasePath
+		"basePath": func() string { return server.basePath },
 	}
 
 	// Parse all templates with the function map
-	tmpl, err := template.New("").Funcs(funcMap).ParseFS(getTemplateDir(), "templates/*.html")
+	tmpl, brokenTemplates, err := parseTemplates(getTemplateDir(), funcMap)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load templates: %w", err)
 	}
 
+	themes, err := listThemes(staticDir)
+	if err != nil {
+		return nil, err
+	}
+
+	eventsClosed, closeEvents := context.WithCancel(context.Background())
+
 	// Create server
-	server := &Server{
-		storage: storage,
-		tmpl:    tmpl,
-		mux:     http.NewServeMux(),
+	server = &Server{
+		storage:            storage,
+		tmpl:               tmpl,
+		brokenTemplates:    brokenTemplates,
+		mux:                http.NewServeMux(),
+		eventPollInterval:  defaultEventPollInterval,
+		eventsClosed:       eventsClosed,
+		closeEvents:        closeEvents,
+		reviewLocks:        &reviewLocks{},
+		repositoryBranches: &repositoryBranches{},
+		dirtyWorkingTrees:  &dirtyWorkingTrees{},
+		changedFileCounts:  &changedFileCounts{},
+		maxDiffBytes:       defaultMaxDiffBytes,
+		themes:             themes,
+		hashLength:         defaultHashLength,
+		statusMetas:        models.DefaultStatusMetas(),
+	}
+	server.lastViewed = newLastViewedFiles(lastViewedDelay, server.saveLastViewedFile)
+
+	for _, opt := range opts {
+		opt(server)
 	}
 
 	return server, nil
@@ -72,6 +275,10 @@ func (s *Server) AddRepository(path string) (bool, error) {
 		return false, fmt.Errorf("failed to get absolute path for %s: %w", path, err)
 	}
 
+	if !s.isAllowedPath(absPath) {
+		return false, fmt.Errorf("%w: %s", ErrRepositoryNotAllowed, absPath)
+	}
+
 	// Check if it's a valid git repository
 	if !git.IsValidRepo(absPath) {
 		return false, fmt.Errorf("not a valid git repository: %s", absPath)
@@ -91,6 +298,11 @@ func (s *Server) AddRepository(path string) (bool, error) {
 		}
 	}
 
+	// Enforce the configured repository limit
+	if s.maxRepos > 0 && len(repos) >= s.maxRepos {
+		return false, fmt.Errorf("%w: cannot add %s, at most %d repositories can be registered", ErrRepositoryLimit, absPath, s.maxRepos)
+	}
+
 	// Add new repository path
 	repos = append(repos, absPath)
 
@@ -102,6 +314,24 @@ func (s *Server) AddRepository(path string) (bool, error) {
 	return true, nil
 }
 
+// OpenRepository adds the repository at path and makes the first visit of the
+// index page open its compare page, for single-repository sessions started
+// from the command line
+func (s *Server) OpenRepository(path string) error {
+	if _, err := s.AddRepository(path); err != nil {
+		return err
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for %s: %w", path, err)
+	}
+	s.startRepo = absPath
+	s.startRepoPending = new(atomic.Bool)
+	s.startRepoPending.Store(true)
+	return nil
+}
+
 // GetRepository returns a repository by path
 func (s *Server) GetRepository(path string) (*git.Repository, bool, error) {
 	repos, err := s.storage.LoadRepositories()
@@ -112,13 +342,79 @@ func (s *Server) GetRepository(path string) (*git.Repository, bool, error) {
 	// Check if repository exists
 	for _, repo := range repos {
 		if repo == path {
-			return git.NewRepository(path), true, nil
+			// Make sure it's still there before anyone runs git against it
+			if !git.IsValidRepo(path) {
+				return nil, true, fmt.Errorf("%w: %s was moved or deleted, remove it from the repository list", ErrRepositoryUnavailable, path)
+			}
+
+			repository := git.NewRepository(path)
+			repository.Available = true
+			return repository, true, nil
 		}
 	}
 
 	return nil, false, nil
 }
 
+// RemoveRepository removes a repository from the stored list. It reports
+// whether the repository was registered.
+func (s *Server) RemoveRepository(path string) (bool, error) {
+	repos, err := s.storage.LoadRepositories()
+	if err != nil {
+		return false, fmt.Errorf("failed to load repositories: %w", err)
+	}
+
+	kept := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		if repo != path {
+			kept = append(kept, repo)
+		}
+	}
+
+	if len(kept) == len(repos) {
+		return false, nil
+	}
+
+	if err := s.storage.SaveRepositories(kept); err != nil {
+		return false, fmt.Errorf("failed to save repositories: %w", err)
+	}
+
+	return true, nil
+}
+
+// repositoryErrorStatus returns the HTTP status code matching a GetRepository error
+func repositoryErrorStatus(err error) int {
+	if errors.Is(err, ErrRepositoryUnavailable) {
+		return http.StatusGone
+	}
+	return http.StatusInternalServerError
+}
+
+// diffErrorStatus maps a diff failure to an HTTP status, telling refs git
+// can't diff apart from server-side failures
+func diffErrorStatus(err error) int {
+	if errors.Is(err, ErrCommitNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, git.ErrUndiffable) {
+		return http.StatusUnprocessableEntity
+	}
+	if errors.Is(err, git.ErrDiffTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// branchErrorStatus maps a failure to resolve a branch to an HTTP status, so
+// a reflog revision naming an entry that doesn't exist isn't taken for a
+// server-side failure
+func branchErrorStatus(err error) int {
+	if errors.Is(err, git.ErrNoReflogEntry) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
 // GetRepositories returns all repositories
 func (s *Server) GetRepositories() (map[string]*git.Repository, error) {
 	repos, err := s.storage.LoadRepositories()
@@ -127,53 +423,184 @@ func (s *Server) GetRepositories() (map[string]*git.Repository, error) {
 	}
 
 	// Create a map of repositories
-	reposMap := make(map[string]*git.Repository)
+	reposMap := make(map[string]*git.Repository, len(repos))
 	for _, path := range repos {
-		reposMap[path] = git.NewRepository(path)
+		repo := git.NewRepository(path)
+		repo.Available = git.IsValidRepo(path)
+		reposMap[path] = repo
 	}
 
 	return reposMap, nil
 }
 
+// repositoriesPerPage is the number of repositories listed per index page
+const repositoriesPerPage = 50
+
+// maxReflogEntries is the number of earlier states of the source branch
+// offered as targets on the compare page
+const maxReflogEntries = 10
+
+// GetRepositoryPage returns one page of the repositories sorted by path, along
+// with the total number of repositories. Pages start at 1, and a page past the
+// end returns the last one. Only the repositories of the page are checked on
+// disk, so large repository lists stay cheap to browse.
+func (s *Server) GetRepositoryPage(page, perPage int) ([]*git.Repository, int, error) {
+	paths, err := s.storage.LoadRepositories()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load repositories: %w", err)
+	}
+
+	sorted := make([]string, len(paths))
+	copy(sorted, paths)
+	sort.Strings(sorted)
+
+	start, end := pageBounds(len(sorted), page, perPage)
+
+	repos := make([]*git.Repository, 0, end-start)
+	for _, path := range sorted[start:end] {
+		repo := git.NewRepository(path)
+		repo.Available = git.IsValidRepo(path)
+		repos = append(repos, repo)
+	}
+
+	return repos, len(sorted), nil
+}
+
+// pageCount returns the number of pages needed for total items, at least one
+func pageCount(total, perPage int) int {
+	if perPage <= 0 || total <= perPage {
+		return 1
+	}
+	return (total + perPage - 1) / perPage
+}
+
+// pageBounds returns the slice bounds of page among total items, clamping the
+// page to the existing ones. A perPage of zero or less puts everything on one page.
+func pageBounds(total, page, perPage int) (int, int) {
+	if perPage <= 0 {
+		return 0, total
+	}
+
+	page = min(max(page, 1), pageCount(total, perPage))
+	start := (page - 1) * perPage
+	return start, min(start+perPage, total)
+}
+
 // Router sets up and returns the HTTP router
 func (s *Server) Router() http.Handler {
 	mux := http.NewServeMux()
 
-	// Static files
-	//staticDir := filepath.Join("internal", "server", "static")
-	fileServer := http.FileServer(http.FS(staticDir))
+	// Static files, served from the root of the embedded static directory
+	staticFS, err := fs.Sub(staticDir, "static")
+	if err != nil {
+		panic(fmt.Sprintf("embedded static directory is missing: %v", err))
+	}
+	fileServer := http.FileServer(http.FS(staticFS))
 	mux.Handle("GET /static/", http.StripPrefix("/static/", fileServer))
 
 	// API routes
 	mux.HandleFunc("POST /api/repository/add", s.handleAddRepository)
-	mux.HandleFunc("POST /api/review-state", s.handleReviewState)
+	mux.HandleFunc("POST /api/repository/remove", s.handleRemoveRepository)
+	mux.HandleFunc("POST /api/repository/clear-reviews", s.handleClearReviews)
+	mux.HandleFunc("GET /api/repositories", s.handleListRepositories)
+	mux.HandleFunc("GET /api/repository/preview", s.handlePreviewRepository)
+
+	// Routes running git or scanning the stored reviews are rate limited
+	mux.HandleFunc("POST /api/review-state", s.rateLimited(s.handleReviewState))
+	mux.HandleFunc("POST /api/review-state/complete", s.rateLimited(s.handleCompleteReview))
+	mux.HandleFunc("POST /api/review-state/description", s.rateLimited(s.handleReviewDescription))
+	mux.HandleFunc("POST /api/review-state/squash-message", s.rateLimited(s.handleSquashMessage))
+	mux.HandleFunc("POST /api/review-state/batch", s.rateLimited(s.handleReviewBatch))
+	mux.HandleFunc("POST /api/review-state/import", s.rateLimited(s.handleReviewImport))
+	mux.HandleFunc("POST /api/review/{action}", s.rateLimited(s.handleReviewAction))
+	mux.HandleFunc("GET /api/review/{target}", s.rateLimited(s.handleReviewNavigation))
+	mux.HandleFunc("GET /api/events", s.streamLimited(s.handleEvents))
+	mux.HandleFunc("GET /api/blob", s.rateLimited(s.handleBlob))
+	mux.HandleFunc("GET /api/file", s.rateLimited(s.handleFileDownload))
+	mux.HandleFunc("GET /api/file-diff", s.rateLimited(s.handleFileDiff))
+	mux.HandleFunc("GET /api/raw-diff", s.rateLimited(s.handleRawDiff))
+	mux.HandleFunc("GET /api/report", s.rateLimited(s.handleReport))
+	mux.HandleFunc("GET /api/file-history", s.rateLimited(s.handleFileHistory))
+	mux.HandleFunc("OPTIONS /api/review", s.handleReviewOptions)
+	mux.HandleFunc("OPTIONS /api/review/{name}", s.handleReviewOptions)
+	mux.HandleFunc("GET /api/themes", s.handleListThemes)
+	mux.HandleFunc("POST /api/theme", s.handleSetTheme)
 
 	// HTML routes
-	mux.HandleFunc("GET /compare", s.handleCompare)
-	mux.HandleFunc("POST /compare", s.handleCompare)
-	mux.HandleFunc("GET /diff", s.handleDiffView)
-	mux.HandleFunc("GET /", s.handleIndex)
+	mux.HandleFunc("GET /compare", s.rateLimited(s.handleCompare))
+	mux.HandleFunc("POST /compare", s.rateLimited(s.handleCompare))
+	mux.HandleFunc("GET /diff", s.rateLimited(s.handleDiffView))
+	mux.HandleFunc("GET /batch", s.rateLimited(s.handleBatch))
+	mux.HandleFunc("GET /rereview", s.rateLimited(s.handleRereview))
+	mux.HandleFunc("GET /paths", s.rateLimited(s.handlePathDiff))
+	mux.HandleFunc("GET /", s.rateLimited(s.handleIndex))
+
+	var handler http.Handler = mux
+	if s.authEnabled() {
+		handler = s.requireAuth(mux)
+	}
+
+	// Metrics are off the HTML routes, and count requests refused by auth too
+	if s.metrics != nil {
+		mux.HandleFunc("GET /metrics", s.handleMetrics)
+		handler = s.measured(mux, handler)
+	}
 
-	return mux
+	return s.withBasePath(handler)
 }
 
 // handleIndex renders the index page
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
-	repos, err := s.GetRepositories()
+	// A repository opened from the command line goes straight to its compare
+	// page on the first visit; the index is shown from then on
+	if s.startRepoPending != nil && s.startRepoPending.CompareAndSwap(true, false) {
+		http.Redirect(w, r, s.url("/compare?repo="+url.QueryEscape(s.startRepo)), http.StatusSeeOther)
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil {
+		page = 1
+	}
+
+	repos, total, err := s.GetRepositoryPage(page, repositoriesPerPage)
 	if err != nil {
-		s.renderError(w, "Repository Error", fmt.Sprintf("Error loading repositories: %v", err), http.StatusInternalServerError)
+		s.renderError(w, r, "Repository Error", fmt.Sprintf("Error loading repositories: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	// Check if we have any repositories
-	hasRepos := len(repos) > 0
+	hasRepos := total > 0
+
+	pages := pageCount(total, repositoriesPerPage)
+	page = min(max(page, 1), pages)
+
+	// The outstanding reviews are told from the recent states too
+	summaries, err := s.storage.ListRecentReviews(outstandingStatesLimit)
+	if err != nil {
+		// The index still works without the recent reviews
+		log.Printf("Warning: failed to list recent reviews: %v", err)
+	}
+	user := userFromRequest(r)
+	entries := s.indexRepositories(repos)
+	markOutstanding(entries, summaries, user)
 
 	data := map[string]interface{}{
-		"Repositories": repos,
-		"HasRepos":     hasRepos,
+		"Repositories":    entries,
+		"HasRepos":        hasRepos,
+		"RepositoryCount": total,
+		"Page":            page,
+		"Pages":           pages,
+		"RecentReviews":   recentReviews(summaries, user, recentReviewsLimit),
+	}
+	if page > 1 {
+		data["PrevPage"] = page - 1
+	}
+	if page < pages {
+		data["NextPage"] = page + 1
 	}
 
-	s.render(w, "index.html", data)
+	s.render(w, r, "index.html", data)
 }
 
 // handleCompare renders the comparison page
@@ -185,7 +612,7 @@ func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		// Parse form data
 		if err := r.ParseForm(); err != nil {
-			s.renderError(w, "Invalid Form", "Invalid form data submitted", http.StatusBadRequest)
+			s.renderError(w, r, "Invalid Form", "Invalid form data submitted", http.StatusBadRequest)
 			return
 		}
 
@@ -200,7 +627,7 @@ func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
 
 		// Make sure we have a repository path
 		if repoPath == "" {
-			s.renderError(w, "Missing Repository", "Repository path is required", http.StatusBadRequest)
+			s.renderError(w, r, "Missing Repository", "Repository path is required", http.StatusBadRequest)
 			return
 		}
 
@@ -213,34 +640,106 @@ func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
 			targetBranch = formTargetBranch
 		}
 
+		// The "compare against remote default" shortcut overrides the selected target
+		if remoteTarget := r.FormValue("remote_target"); remoteTarget != "" {
+			targetBranch = remoteTarget
+		}
+
+		// A range expression such as main..feature names both branches at once
+		mergeBase := false
+		if expr := strings.TrimSpace(r.FormValue("range")); expr != "" {
+			revRange, err := parseRevisionRange(expr)
+			if err != nil {
+				s.renderError(w, r, "Invalid Range", err.Error(), http.StatusBadRequest)
+				return
+			}
+			if revRange.MergeBase && r.FormValue("latest_commit") != "" {
+				s.renderError(w, r, "Invalid Range", "A three-dot range can't be reviewed by latest commit", http.StatusBadRequest)
+				return
+			}
+			sourceBranch, targetBranch, mergeBase = revRange.Source, revRange.Target, revRange.MergeBase
+		}
+
 		// Make sure we have source and target branches
 		if sourceBranch == "" || targetBranch == "" {
-			s.renderError(w, "Missing Branches", "Source and target branches are required", http.StatusBadRequest)
+			s.renderError(w, r, "Missing Branches", "Source and target branches are required", http.StatusBadRequest)
 			return
 		}
 
 		// Check if the repository exists
 		repo, exists, err := s.GetRepository(repoPath)
 		if err != nil {
-			s.renderError(w, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), http.StatusInternalServerError)
+			s.renderError(w, r, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
 			return
 		}
 		if !exists {
-			s.renderError(w, "Not Found", "Repository not found", http.StatusNotFound)
+			s.renderError(w, r, "Not Found", "Repository not found", http.StatusNotFound)
 			return
 		}
 
 		// Get commit hashes for the branches
 		sourceCommit, err := repo.GetBranchCommitHash(sourceBranch)
 		if err != nil {
-			s.renderError(w, "Branch Error", fmt.Sprintf("Failed to get commit hash for source branch '%s': %v", sourceBranch, err), http.StatusInternalServerError)
+			s.renderError(w, r, "Branch Error", fmt.Sprintf("Failed to get commit hash for source branch '%s': %v", sourceBranch, err), branchErrorStatus(err))
 			return
 		}
 
-		targetCommit, err := repo.GetBranchCommitHash(targetBranch)
-		if err != nil {
-			s.renderError(w, "Branch Error", fmt.Sprintf("Failed to get commit hash for target branch '%s': %v", targetBranch, err), http.StatusInternalServerError)
-			return
+		var targetCommit string
+		// noMergeBase is set when a three-dot range fell back to a two-dot diff
+		noMergeBase := false
+		if r.FormValue("latest_commit") != "" {
+			// Review only the tip commit of the source branch: diff it against its
+			// parent, which scopes the review state to that single commit
+			if git.IsStashRef(sourceBranch) {
+				s.renderError(w, r, "Invalid Comparison", "Stashes can't be reviewed by latest commit", http.StatusBadRequest)
+				return
+			}
+
+			targetCommit, err = repo.GetParentCommitHash(sourceCommit)
+			if err != nil {
+				s.renderError(w, r, "Branch Error", fmt.Sprintf("Failed to get parent commit of source branch '%s': %v", sourceBranch, err), http.StatusInternalServerError)
+				return
+			}
+			targetBranch = sourceBranch + "^"
+			if targetCommit == git.EmptyTreeHash {
+				// A root commit has no parent to name, so the empty tree is kept as
+				// the target, as a three-dot range keeps its merge base
+				targetBranch = targetCommit
+			}
+		} else if git.IsStashRef(sourceBranch) {
+			// A stash is diffed against the commit it was created on, whatever
+			// the target, so its review is stored against that commit
+			targetCommit, err = targetCommitOf(repo, sourceBranch, sourceCommit, targetBranch)
+			if err != nil {
+				s.renderError(w, r, "Branch Error", fmt.Sprintf("Failed to get the base commit of stash '%s': %v", sourceBranch, err), http.StatusInternalServerError)
+				return
+			}
+		} else if mergeBase {
+			// A three-dot range diffs the source against the commit it forked
+			// from, which is kept as the target so it holds when the target moves on
+			targetCommit, err = repo.GetMergeBase(sourceBranch, targetBranch)
+			switch {
+			case errors.Is(err, git.ErrNoMergeBase):
+				// Unrelated histories, such as an orphan branch's, didn't fork from
+				// anything: fall back to the two-dot diff of their full contents
+				targetCommit, err = repo.GetBranchCommitHash(targetBranch)
+				if err != nil {
+					s.renderError(w, r, "Branch Error", fmt.Sprintf("Failed to get commit hash for target branch '%s': %v", targetBranch, err), branchErrorStatus(err))
+					return
+				}
+				noMergeBase = true
+			case err != nil:
+				s.renderError(w, r, "Branch Error", fmt.Sprintf("Failed to find the merge base of '%s' and '%s': %v", targetBranch, sourceBranch, err), branchErrorStatus(err))
+				return
+			default:
+				targetBranch = targetCommit
+			}
+		} else {
+			targetCommit, err = repo.GetBranchCommitHash(targetBranch)
+			if err != nil {
+				s.renderError(w, r, "Branch Error", fmt.Sprintf("Failed to get commit hash for target branch '%s': %v", targetBranch, err), branchErrorStatus(err))
+				return
+			}
 		}
 
 		// Redirect to diff view with commit hashes
@@ -250,35 +749,54 @@ func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
 			url.QueryEscape(targetBranch),
 			url.QueryEscape(sourceCommit),
 			url.QueryEscape(targetCommit))
+		if noMergeBase {
+			redirectURL += "&" + noMergeBaseParam + "=1"
+		}
 
-		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		http.Redirect(w, r, s.url(redirectURL), http.StatusSeeOther)
 		return
 	}
 
 	// Handle GET request
 	if repoPath == "" {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, s.url("/"), http.StatusSeeOther)
 		return
 	}
 
 	// Check if the repository exists
 	repo, exists, err := s.GetRepository(repoPath)
 	if err != nil {
-		s.renderError(w, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), http.StatusInternalServerError)
+		s.renderError(w, r, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
 		return
 	}
 	if !exists {
-		s.renderError(w, "Not Found", "Repository not found", http.StatusNotFound)
+		s.renderError(w, r, "Not Found", "Repository not found", http.StatusNotFound)
 		return
 	}
 
+	// A single comparison in progress is offered when no branches are named,
+	// or opened right away with auto-resume
+	var resume *recentReview
+	if sourceBranch == "" && targetBranch == "" {
+		review, ok, err := s.singleComparisonInProgress(repoPath, userFromRequest(r))
+		switch {
+		case err != nil:
+			log.Printf("Warning: %v", err)
+		case ok && s.shouldAutoResume(r):
+			http.Redirect(w, r, s.url(review.ResumeURL), http.StatusSeeOther)
+			return
+		case ok:
+			resume = &review
+		}
+	}
+
 	// Get repository name from path for display
 	repoName := filepath.Base(repoPath)
 
 	// Load branches from the repository
 	branches, err := repo.GetBranches()
 	if err != nil {
-		s.renderError(w, "Branch Error", fmt.Sprintf("Failed to load branches: %v", err), http.StatusInternalServerError)
+		s.renderError(w, r, "Branch Error", fmt.Sprintf("Failed to load branches: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -297,55 +815,212 @@ func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
 		targetBranch = branches[0]
 	}
 
+	// Load stashes so they can be reviewed as a source
+	stashes, err := repo.GetStashes()
+	if err != nil {
+		s.renderError(w, r, "Stash Error", fmt.Sprintf("Failed to load stashes: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Offer the remote's default branch as a target when there is one
+	remoteDefault, err := repo.GetRemoteDefaultBranch("origin")
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// Earlier states of the source branch can be compared against, e.g. to
+	// review what changed since the last review of a rebased branch
+	reflog := []git.ReflogEntry{}
+	if sourceBranch != "" && !git.IsStashRef(sourceBranch) && !git.IsReflogRef(sourceBranch) && !git.IsWorkingTree(sourceBranch) {
+		reflog, err = repo.GetReflog(sourceBranch, maxReflogEntries)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
 	data := map[string]interface{}{
-		"RepoPath":     repoPath,
-		"RepoName":     repoName,
-		"SourceBranch": sourceBranch,
-		"TargetBranch": targetBranch,
-		"Branches":     branches,
+		"RepoPath":      repoPath,
+		"RepoName":      repoName,
+		"SourceBranch":  sourceBranch,
+		"TargetBranch":  targetBranch,
+		"Branches":      branches,
+		"Stashes":       stashes,
+		"RemoteDefault": remoteDefault,
+		"Reflog":        reflog,
+		"Resume":        resume,
+		"WorkingTree":   git.WorkingTree,
 	}
 
-	s.render(w, "compare.html", data)
+	// Uncommitted changes don't show up in diffs, which is worth telling
+	s.setDirtyWorkingTree(data, repo)
+
+	// Tell how far the selected branches diverged; stashes and the working tree
+	// don't have a history to compare
+	if sourceBranch != "" && targetBranch != "" && !git.IsStashRef(sourceBranch) && !git.IsWorkingTree(sourceBranch) {
+		ahead, behind, err := repo.GetAheadBehind(sourceBranch, targetBranch)
+		switch {
+		case errors.Is(err, git.ErrNoMergeBase):
+			data["Unrelated"] = true
+		case errors.Is(err, git.ErrShallowHistory):
+			data["ShallowHistory"] = true
+		case err != nil:
+			log.Printf("Warning: %v", err)
+		default:
+			data["AheadBehind"] = aheadBehind{Ahead: ahead, Behind: behind}
+		}
+	}
+
+	s.render(w, r, "compare.html", data)
+}
+
+// aheadBehind counts the commits the source branch has over the target and lacks from it
+type aheadBehind struct {
+	Ahead  int
+	Behind int
 }
 
 // handleAddRepository adds a new repository
 func (s *Server) handleAddRepository(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		s.renderError(w, "Method Not Allowed", "This method is not allowed for this endpoint", http.StatusMethodNotAllowed)
+		s.renderError(w, r, "Method Not Allowed", "This method is not allowed for this endpoint", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Parse the form data
 	if err := r.ParseForm(); err != nil {
-		s.renderError(w, "Invalid Form", "Invalid form data submitted", http.StatusBadRequest)
+		s.renderError(w, r, "Invalid Form", "Invalid form data submitted", http.StatusBadRequest)
 		return
 	}
 
 	repoPath := r.Form.Get("path")
 	if repoPath == "" {
-		s.renderError(w, "Missing Path", "Repository path is required", http.StatusBadRequest)
+		s.renderError(w, r, "Missing Path", "Repository path is required", http.StatusBadRequest)
 		return
 	}
 
 	// Add the repository
 	success, err := s.AddRepository(repoPath)
 	if !success {
-		if err != nil {
-			s.renderError(w, "Repository Error", err.Error(), http.StatusInternalServerError)
+		if errors.Is(err, ErrRepositoryLimit) {
+			s.renderError(w, r, "Repository Limit Reached", err.Error(), http.StatusBadRequest)
+		} else if errors.Is(err, ErrRepositoryNotAllowed) {
+			s.renderError(w, r, "Repository Not Allowed", err.Error(), http.StatusForbidden)
+		} else if err != nil {
+			s.renderError(w, r, "Repository Error", err.Error(), http.StatusInternalServerError)
 		} else {
-			s.renderError(w, "Repository Error", "Failed to add repository", http.StatusInternalServerError)
+			s.renderError(w, r, "Repository Error", "Failed to add repository", http.StatusInternalServerError)
 		}
 		return
 	}
 
 	// Redirect to the index page
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	http.Redirect(w, r, s.url("/"), http.StatusSeeOther)
+}
+
+// repositoryResponse describes a stored repository in the JSON API
+type repositoryResponse struct {
+	Path      string `json:"path"`
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+}
+
+// handleListRepositories returns the stored repositories as JSON, in the order they were added
+func (s *Server) handleListRepositories(w http.ResponseWriter, r *http.Request) {
+	paths, err := s.storage.LoadRepositories()
+	if err != nil {
+		writeJSONError(w, "Repository Error", fmt.Sprintf("Error loading repositories: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	repos := make([]repositoryResponse, 0, len(paths))
+	for _, path := range paths {
+		repo := git.NewRepository(path)
+		repos = append(repos, repositoryResponse{
+			Path:      repo.Path,
+			Name:      repo.Name,
+			Available: git.IsValidRepo(path),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, repos)
+}
+
+// handleRemoveRepository removes a repository from the list, leaving its review states on disk
+func (s *Server) handleRemoveRepository(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, "Invalid Form", "Invalid form data submitted", http.StatusBadRequest)
+		return
+	}
+
+	repoPath := r.Form.Get("path")
+	if repoPath == "" {
+		s.renderError(w, r, "Missing Path", "Repository path is required", http.StatusBadRequest)
+		return
+	}
+
+	removed, err := s.RemoveRepository(repoPath)
+	if err != nil {
+		s.renderError(w, r, "Repository Error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		s.renderError(w, r, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	// Redirect to the index page
+	http.Redirect(w, r, s.url("/"), http.StatusSeeOther)
+}
+
+// clearReviewsResponse reports how many comparisons lost their review state
+type clearReviewsResponse struct {
+	Repo    string `json:"repo"`
+	Cleared int    `json:"cleared"`
+}
+
+// handleClearReviews removes every review state of a repository, leaving it
+// registered. Since this can't be undone, the request must carry confirm=1.
+func (s *Server) handleClearReviews(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSONError(w, "Invalid Form", "Invalid form data submitted", http.StatusBadRequest)
+		return
+	}
+
+	repoPath := r.Form.Get("path")
+	if repoPath == "" {
+		writeJSONError(w, "Missing Path", "Repository path is required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Form.Get("confirm") != "1" {
+		writeJSONError(w, "Confirmation Required", "Clearing review states can't be undone; repeat the request with confirm=1", http.StatusBadRequest)
+		return
+	}
+
+	repos, err := s.storage.LoadRepositories()
+	if err != nil {
+		writeJSONError(w, "Repository Error", fmt.Sprintf("Error loading repositories: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if indexOf(repos, repoPath) == -1 {
+		writeJSONError(w, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	s.lastViewed.discard(repoPath)
+	cleared, err := s.storage.ClearReviewStates(repoPath)
+	if err != nil {
+		writeJSONError(w, "Review State Error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, clearReviewsResponse{Repo: repoPath, Cleared: cleared})
 }
 
 // handleReviewState handles saving and loading review state
 func (s *Server) handleReviewState(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		s.renderError(w, "Method Not Allowed", "This method is not allowed for this endpoint", http.StatusMethodNotAllowed)
+		s.respondError(w, r, "Method Not Allowed", "This method is not allowed for this endpoint", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -360,114 +1035,414 @@ func (s *Server) handleReviewState(w http.ResponseWriter, r *http.Request) {
 	nextFilePath := r.URL.Query().Get("next")
 
 	if repoPath == "" || sourceBranch == "" || targetBranch == "" || sourceCommit == "" || targetCommit == "" || filePath == "" || status == "" {
-		s.renderError(w, "Missing Parameters", "Missing required parameters for updating review state", http.StatusBadRequest)
+		s.respondError(w, r, "Missing Parameters", "Missing required parameters for updating review state", http.StatusBadRequest)
 		return
 	}
 
 	// Validate status value
-	if status != models.StateApproved && status != models.StateRejected && status != models.StateSkipped {
-		s.renderError(w, "Invalid Status", "Invalid status value for file review", http.StatusBadRequest)
+	if !isReviewStatus(status) {
+		s.respondError(w, r, "Invalid Status", "Invalid status value for file review", http.StatusBadRequest)
 		return
 	}
 
-	// Load existing review state
-	existingState, err := s.storage.LoadReviewState(repoPath, sourceBranch, targetBranch, sourceCommit, targetCommit)
+	// View options travel in the form body, since the query already uses "status"
+	if err := r.ParseForm(); err != nil {
+		s.respondError(w, r, "Invalid Form", "Invalid form data submitted", http.StatusBadRequest)
+		return
+	}
+
+	viewOpts, err := parseViewOptions(r.PostForm)
 	if err != nil {
-		s.renderError(w, "Review State Error", fmt.Sprintf("Failed to load review state: %v", err), http.StatusInternalServerError)
+		s.respondError(w, r, "Invalid View Options", err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Look for the file in the existing review state
-	fileFound := false
-	for i := range existingState.ReviewedFiles {
-		if existingState.ReviewedFiles[i].Path == filePath && existingState.ReviewedFiles[i].Repo == repoPath {
-			// Update existing file review
-			if existingState.ReviewedFiles[i].Lines == nil {
-				existingState.ReviewedFiles[i].Lines = make(map[string]string)
-			}
-			existingState.ReviewedFiles[i].Lines["all"] = status
-			fileFound = true
-			break
-		}
+	reason := r.FormValue("reason")
+	if err := s.checkRejectReason(status, reason); err != nil {
+		s.respondError(w, r, "Missing Reason", err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// If file not found, add it to the review state
-	if !fileFound {
-		existingState.ReviewedFiles = append(existingState.ReviewedFiles, models.FileReview{
-			Repo:  repoPath,
-			Path:  filePath,
-			Lines: map[string]string{"all": status},
-		})
+	// Apply the status and persist it
+	c := comparison{
+		RepoPath:     repoPath,
+		SourceBranch: sourceBranch,
+		TargetBranch: targetBranch,
+		SourceCommit: sourceCommit,
+		TargetCommit: targetCommit,
+		User:         userFromRequest(r),
+	}
+	if viewOpts.Patch != "" {
+		// Patches are reviewed without a repository, under the review state of
+		// the patch file whatever comparison was posted
+		patch, err := s.loadPatch(viewOpts.Patch)
+		if err != nil {
+			s.respondError(w, r, "Patch Error", err.Error(), patchErrorStatus(err))
+			return
+		}
+		c = patch.comparison(c.User)
+		repoPath, sourceBranch, targetBranch = c.RepoPath, c.SourceBranch, c.TargetBranch
+		sourceCommit, targetCommit = c.SourceCommit, c.TargetCommit
+	} else if err := s.verifyComparisonCommits(c); err != nil {
+		s.respondError(w, r, "Commit Not Found", err.Error(), commitErrorStatus(err))
+		return
+	}
+	if s.checkCurrentCommits && !viewOpts.Pinned && viewOpts.Patch == "" {
+		if err := s.verifyCurrentCommits(c); errors.Is(err, ErrStaleCommits) {
+			s.respondError(w, r, "Branches Moved", err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			s.respondError(w, r, "Review State Error", err.Error(), repositoryErrorStatus(err))
+			return
+		}
 	}
+	// A hunk parameter narrows the review to that hunk of the file
+	hunk := r.URL.Query().Get("hunk")
+	fileStatus := status
+	if hunk != "" {
+		state, err := s.updateHunkReview(c, filePath, hunk, status, reason)
+		if errors.Is(err, ErrUnknownHunk) {
+			s.respondError(w, r, "Invalid Hunk", err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			s.respondError(w, r, "Review State Error", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fileStatus, _ = state.FileStatus(repoPath, filePath)
 
-	// Save updated review state
-	if err := s.storage.SaveReviewState(existingState, repoPath); err != nil {
-		s.renderError(w, "Review State Error", fmt.Sprintf("Failed to save review state: %v", err), http.StatusInternalServerError)
+		// Stay on the file until all of its hunks are reviewed
+		if fileStatus == models.StateUnreviewed {
+			nextFilePath = ""
+		}
+	} else if _, err := s.updateFileReview(c, filePath, status, reason); err != nil {
+		s.respondError(w, r, "Review State Error", err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Determine where to redirect
-	redirectPath := fmt.Sprintf("/diff?repo=%s&source=%s&target=%s&source_commit=%s&target_commit=%s",
+	redirectPath := s.url(fmt.Sprintf("/diff?repo=%s&source=%s&target=%s&source_commit=%s&target_commit=%s",
 		url.QueryEscape(repoPath),
 		url.QueryEscape(sourceBranch),
 		url.QueryEscape(targetBranch),
 		url.QueryEscape(sourceCommit),
-		url.QueryEscape(targetCommit))
+		url.QueryEscape(targetCommit)))
 
-	// If next file specified and this was approved, rejected, or skipped, go to next file
-	if nextFilePath != "" && (status == models.StateApproved || status == models.StateRejected || status == models.StateSkipped) {
+	// If next file specified and the file was given a status, go to next file
+	if nextFilePath != "" && isReviewStatus(status) {
 		redirectPath += "&file=" + url.QueryEscape(nextFilePath)
-	} else if filePath != "" {
-		// Otherwise stay on current file
+	} else if filePath != "" && r.URL.Query().Get("return") != returnToList {
+		// Otherwise stay on current file, unless the review was sent from the file list
 		redirectPath += "&file=" + url.QueryEscape(filePath)
 	}
 
+	// Come back in the same view configuration
+	redirectPath += string(viewOpts.querySuffix())
+
+	// AJAX clients get the updated state instead of a redirect
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, reviewStateResponse{
+			File:       filePath,
+			Status:     status,
+			Hunk:       hunk,
+			FileStatus: fileStatus,
+			NextFile:   nextFilePath,
+			Redirect:   redirectPath,
+		})
+		return
+	}
+
 	// Redirect to the appropriate diff view
 	http.Redirect(w, r, redirectPath, http.StatusSeeOther)
 }
 
-// handleDiffView renders the diff visualization page
-func (s *Server) handleDiffView(w http.ResponseWriter, r *http.Request) {
-	repoPath := r.URL.Query().Get("repo")
-	sourceBranch := r.URL.Query().Get("source")
-	targetBranch := r.URL.Query().Get("target")
-	filePath := r.URL.Query().Get("file")
+// comparison identifies a review: a repository and the two refs being compared,
+// pinned to the commits they resolved to, as seen by one reviewer
+type comparison struct {
+	RepoPath     string
+	SourceBranch string
+	TargetBranch string
+	SourceCommit string
+	TargetCommit string
+	// User is the reviewer, empty in single-user mode
+	User string
+	// Pathspec limits the comparison to a subtree of the repository, see git.DiffOptions
+	Pathspec string
+}
 
-	if repoPath == "" || sourceBranch == "" || targetBranch == "" {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+// comparisonFromRequest reads a comparison from the standard query parameters
+// and the authenticated user
+func comparisonFromRequest(r *http.Request) comparison {
+	query := r.URL.Query()
+	return comparison{
+		RepoPath:     query.Get("repo"),
+		SourceBranch: query.Get("source"),
+		TargetBranch: query.Get("target"),
+		SourceCommit: query.Get("source_commit"),
+		TargetCommit: query.Get("target_commit"),
+		User:         userFromRequest(r),
+		Pathspec:     strings.TrimSpace(query.Get("pathspec")),
 	}
+}
 
-	// Check if the repository exists
-	repo, exists, err := s.GetRepository(repoPath)
+// complete reports whether every comparison field except the user is set
+func (c comparison) complete() bool {
+	return c.RepoPath != "" && c.SourceBranch != "" && c.TargetBranch != "" && c.SourceCommit != "" && c.TargetCommit != ""
+}
+
+// checkRejectReason enforces the rejection reason requirement, if enabled
+func (s *Server) checkRejectReason(status, reason string) error {
+	if s.requireRejectReason && status == models.StateRejected && strings.TrimSpace(reason) == "" {
+		return ErrMissingRejectReason
+	}
+	return nil
+}
+
+// updateFileReview sets the whole-file status of filePath in the comparison's
+// review state and saves it. An empty status resets the file to unreviewed.
+// The reason is only kept for rejections.
+func (s *Server) updateFileReview(c comparison, filePath, status, reason string) (*models.ReviewState, error) {
+	// Record the content the review applies to, so it can survive branch moves
+	// and line reviews can be checked against the current diff shape
+	var blobHash string
+	var hunks []string
+	if status != "" {
+		blobHash, hunks = s.getFileDiffShape(c.RepoPath, c.SourceCommit, c.TargetCommit, filePath)
+	}
+	changed := s.changedFiles(c)
+
+	unlock := s.reviewLocks.lock(c)
+	defer unlock()
+
+	// Load existing review state
+	existingState, err := s.storage.LoadReviewState(c.RepoPath, c.User, c.SourceBranch, c.TargetBranch, c.SourceCommit, c.TargetCommit)
 	if err != nil {
-		s.renderError(w, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), http.StatusInternalServerError)
+		return nil, fmt.Errorf("failed to load review state: %w", err)
+	}
+
+	setFileReview(existingState, c.RepoPath, filePath, status, reason, blobHash, hunks)
+	recordChangedFiles(existingState, changed)
+
+	// Save updated review state
+	if err := s.storage.SaveReviewState(existingState, c.RepoPath, c.User); err != nil {
+		return nil, fmt.Errorf("failed to save review state: %w", err)
+	}
+
+	return existingState, nil
+}
+
+// setFileReview sets the whole-file status of filePath in state, recording the
+// blob hash and hunks the review applies to. An empty status drops the file's
+// review. The reason is only kept for rejections.
+func setFileReview(state *models.ReviewState, repoPath, filePath, status, reason, blobHash string, hunks []string) {
+	if status == "" {
+		// Drop the file's review entirely
+		state.RemoveFile(repoPath, filePath)
 		return
 	}
-	if !exists {
-		s.renderError(w, "Not Found", "Repository not found", http.StatusNotFound)
+
+	if status != models.StateRejected {
+		reason = ""
+	}
+
+	review, ok := state.File(repoPath, filePath)
+	if !ok {
+		review = state.AddFile(models.FileReview{
+			Repo:  repoPath,
+			Path:  filePath,
+			Lines: map[string]string{},
+		})
+	}
+
+	review.SetStatus(status)
+	review.BlobHash = blobHash
+	review.Hunks = hunks
+	review.Reason = strings.TrimSpace(reason)
+}
+
+// setHunkReview gives a single hunk of filePath a status in state. hunks are
+// the ranges of all the hunks of the file's current diff.
+func setHunkReview(state *models.ReviewState, repoPath, filePath, hunk, status, reason, blobHash string, hunks []string) {
+	review, ok := state.File(repoPath, filePath)
+	if !ok {
+		review = state.AddFile(models.FileReview{Repo: repoPath, Path: filePath})
+	}
+
+	review.SetHunkStatus(hunk, status, hunks)
+	review.BlobHash = blobHash
+	if status == models.StateRejected {
+		review.Reason = strings.TrimSpace(reason)
+	} else if review.Status() != models.StateRejected {
+		review.Reason = ""
+	}
+}
+
+// ErrUnknownHunk is returned when a hunk to review isn't one of the file's current hunks
+var ErrUnknownHunk = errors.New("unknown hunk")
+
+// updateHunkReview applies a review status to a single hunk of a file,
+// identified by its range ("-1,3 +1,4") in the file's default diff, and
+// persists the review state
+func (s *Server) updateHunkReview(c comparison, filePath, hunk, status, reason string) (*models.ReviewState, error) {
+	blobHash, hunks := s.getFileDiffShape(c.RepoPath, c.SourceCommit, c.TargetCommit, filePath)
+	if indexOf(hunks, hunk) == -1 {
+		return nil, fmt.Errorf("%w: %s has no hunk %q", ErrUnknownHunk, filePath, hunk)
+	}
+	changed := s.changedFiles(c)
+
+	unlock := s.reviewLocks.lock(c)
+	defer unlock()
+
+	existingState, err := s.storage.LoadReviewState(c.RepoPath, c.User, c.SourceBranch, c.TargetBranch, c.SourceCommit, c.TargetCommit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load review state: %w", err)
+	}
+
+	setHunkReview(existingState, c.RepoPath, filePath, hunk, status, reason, blobHash, hunks)
+	recordChangedFiles(existingState, changed)
+
+	if err := s.storage.SaveReviewState(existingState, c.RepoPath, c.User); err != nil {
+		return nil, fmt.Errorf("failed to save review state: %w", err)
+	}
+
+	return existingState, nil
+}
+
+// reviewStateResponse is the JSON answer to an AJAX review state update
+type reviewStateResponse struct {
+	File   string `json:"file"`
+	Status string `json:"status"`
+	// Hunk is the range of the reviewed hunk, empty for a whole-file review
+	Hunk string `json:"hunk,omitempty"`
+	// FileStatus is the file's overall status after the update
+	FileStatus string `json:"file_status"`
+	NextFile   string `json:"next_file,omitempty"`
+	Redirect   string `json:"redirect"`
+}
+
+// handleDiffView renders the diff visualization page
+func (s *Server) handleDiffView(w http.ResponseWriter, r *http.Request) {
+	repoPath := r.URL.Query().Get("repo")
+	sourceBranch := r.URL.Query().Get("source")
+	targetBranch := r.URL.Query().Get("target")
+	filePath := r.URL.Query().Get("file")
+	user := userFromRequest(r)
+
+	// Patch files are reviewed without a repository
+	if r.URL.Query().Get("patch") != "" {
+		viewOpts, err := parseViewOptions(r.URL.Query())
+		if err != nil {
+			s.renderError(w, r, "Invalid View Options", err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.handlePatchView(w, r, viewOpts)
 		return
 	}
 
-	// Get repository name from path for display
-	repoName := filepath.Base(repoPath)
+	if repoPath == "" || sourceBranch == "" || targetBranch == "" {
+		http.Redirect(w, r, s.url("/"), http.StatusSeeOther)
+		return
+	}
 
-	// Get commit hashes for the branches
-	sourceCommit, err := repo.GetBranchCommitHash(sourceBranch)
+	// Validate the view options
+	viewOpts, err := parseViewOptions(r.URL.Query())
 	if err != nil {
-		s.renderError(w, "Branch Error", fmt.Sprintf("Failed to get commit hash for source branch: %v", err), http.StatusInternalServerError)
+		s.renderError(w, r, "Invalid View Options", err.Error(), http.StatusBadRequest)
 		return
 	}
+	if s.noRenames {
+		viewOpts.Diff.NoRenames = true
+		viewOpts.Diff.FindCopiesHarder = false
+	}
+	viewOpts.Diff.MaxBytes = s.maxDiffBytes
 
-	targetCommit, err := repo.GetBranchCommitHash(targetBranch)
+	// Check if the repository exists
+	repo, exists, err := s.GetRepository(repoPath)
 	if err != nil {
-		s.renderError(w, "Branch Error", fmt.Sprintf("Failed to get commit hash for target branch: %v", err), http.StatusInternalServerError)
+		s.renderError(w, r, "Repository Error", fmt.Sprintf("Error loading repository: %v", err), repositoryErrorStatus(err))
 		return
 	}
+	if !exists {
+		s.renderError(w, r, "Not Found", "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	// Get repository name from path for display
+	repoName := filepath.Base(repoPath)
+
+	// The refs the diff is computed between: the branch tips, unless pinned
+	diffSource, diffTarget := sourceBranch, targetBranch
+
+	var sourceCommit, targetCommit string
+	if viewOpts.Pinned {
+		// Permalinks review exactly the commits they name, wherever the branches moved since
+		sourceCommit = r.URL.Query().Get("source_commit")
+		targetCommit = r.URL.Query().Get("target_commit")
+		if !git.IsCommitHash(sourceCommit) || !git.IsCommitHash(targetCommit) {
+			s.renderError(w, r, "Invalid Permalink", "Pinned links require valid source and target commit hashes", http.StatusBadRequest)
+			return
+		}
+		if err := verifyCommitsExist(repo, comparison{RepoPath: repoPath, SourceCommit: sourceCommit, TargetCommit: targetCommit}); err != nil {
+			s.renderError(w, r, "Commit Not Found", err.Error(), commitErrorStatus(err))
+			return
+		}
+
+		diffSource, diffTarget = sourceCommit, targetCommit
+		// A stash is diffed against the commit it was created on
+		if git.IsStashRef(sourceBranch) {
+			diffTarget = sourceCommit + "^1"
+		}
+	} else {
+		// Get commit hashes for the branches
+		sourceCommit, err = repo.GetBranchCommitHash(sourceBranch)
+		if err != nil {
+			s.renderError(w, r, "Branch Error", fmt.Sprintf("Failed to get commit hash for source branch: %v", err), branchErrorStatus(err))
+			return
+		}
+
+		// The empty tree a root commit is reviewed against isn't a revision to resolve
+		// The working tree is diffed as the snapshot it resolved to, since
+		// resolving it again gives another one once a file changes
+		if git.IsWorkingTree(sourceBranch) {
+			diffSource = sourceCommit
+		}
+
+		targetCommit = git.EmptyTreeHash
+		if targetBranch != git.EmptyTreeHash || git.IsStashRef(sourceBranch) {
+			targetCommit, err = targetCommitOf(repo, sourceBranch, sourceCommit, targetBranch)
+			if err != nil {
+				s.renderError(w, r, "Branch Error", fmt.Sprintf("Failed to get commit hash for target branch: %v", err), branchErrorStatus(err))
+				return
+			}
+		}
+	}
+
+	// Excluded commits are taken out of the source side, which becomes a tree of
+	// its own; commitSource keeps naming the commits for listing them
+	commitSource := diffSource
+	excludedCount := 0
+	if viewOpts.excludesCommits() {
+		if git.IsStashRef(sourceBranch) {
+			s.renderError(w, r, "Invalid View Options", "Commits can't be excluded from a stash", http.StatusBadRequest)
+			return
+		}
+		diffSource, excludedCount, err = excludeCommits(repo, commitSource, diffTarget, viewOpts)
+		switch {
+		case errors.Is(err, ErrUnknownExcludedCommit):
+			s.renderError(w, r, "Invalid View Options", err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, git.ErrExclusionConflict):
+			s.renderError(w, r, "Exclusion Conflict", fmt.Sprintf("The excluded commits can't be taken out of the diff: %v", err), http.StatusConflict)
+			return
+		case err != nil:
+			s.renderError(w, r, "Exclusion Error", fmt.Sprintf("Failed to exclude commits: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
 
 	// Load review state
 	var reviewState *models.ReviewState
-	reviewState, err = s.storage.LoadReviewState(repoPath, sourceBranch, targetBranch, sourceCommit, targetCommit)
+	reviewState, err = s.storage.LoadReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit)
 	if err != nil {
 		reviewState = &models.ReviewState{
 			ReviewedFiles: []models.FileReview{},
@@ -480,185 +1455,631 @@ func (s *Server) handleDiffView(w http.ResponseWriter, r *http.Request) {
 
 	// Data to pass to the template
 	data := map[string]interface{}{
-		"RepoPath":     repoPath,
-		"RepoName":     repoName,
-		"SourceBranch": sourceBranch,
-		"TargetBranch": targetBranch,
-		"SourceCommit": sourceCommit,
-		"TargetCommit": targetCommit,
-		"Error":        "",
-		"NoDiff":       false,
-		"ReviewState":  reviewState,
+		"RepoPath":              repoPath,
+		"RepoName":              repoName,
+		"SourceBranch":          sourceBranch,
+		"TargetBranch":          targetBranch,
+		"SourceCommit":          sourceCommit,
+		"TargetCommit":          targetCommit,
+		"Error":                 "",
+		"NoDiff":                false,
+		"ReviewState":           reviewState,
+		"ViewOptions":           viewOpts,
+		"ViewQuery":             viewOpts.querySuffix(),
+		"FilterQuery":           viewOpts.withFilter("").querySuffix(),
+		"ViewParams":            viewOpts.values(),
+		"Permalink":             s.permalink(r, comparison{RepoPath: repoPath, SourceBranch: sourceBranch, TargetBranch: targetBranch, SourceCommit: sourceCommit, TargetCommit: targetCommit}, filePath, viewOpts),
+		"Pinned":                viewOpts.Pinned,
+		"RequireRejectReason":   s.requireRejectReason,
+		"DiffAlgorithms":        git.DiffAlgorithms,
+		"IgnoreSubmodulesModes": git.IgnoreSubmodulesModes,
+		"LineOrders":            lineOrders,
+		"TabWidths":             tabWidths,
+		"FileOrders":            fileOrders,
+		"Completion":            completionBadge(reviewState),
 	}
 
+	// Turned off server-wide, rename detection can't be turned back on from the view
+	data["RenameDetectionDisabled"] = s.noRenames
+	data["ExcludedCommits"] = excludedCount
+	data["NoMergeBase"] = r.URL.Query().Get(noMergeBaseParam) == "1"
+
 	// Get the diff
 	var diffText string
 	var err2 error
 	var files []map[string]string
 
 	// Always get full diff to extract file list (needed for navigation)
-	fullDiffText, fullDiffErr := repo.GetDiff(sourceBranch, targetBranch)
-	if fullDiffErr != nil {
+	fullDiffText, fullDiffErr := repo.GetDiffWithOptions(diffSource, diffTarget, viewOpts.Diff)
+	if errors.Is(fullDiffErr, git.ErrUndiffable) {
+		s.renderUndiffable(w, r, repoPath, fullDiffErr)
+		return
+	}
+	// A stash is diffed against its base, which its commits don't tell, and
+	// excluded commits leave a tree in place of the source commit
+	rawSource, rawTarget := sourceCommit, targetCommit
+	if git.IsStashRef(sourceBranch) || excludedCount > 0 {
+		rawSource, rawTarget = diffSource, diffTarget
+	}
+
+	fullDiffTooLarge := errors.Is(fullDiffErr, git.ErrDiffTooLarge)
+	if fullDiffTooLarge {
+		// Without the full diff there's no file list, but files can still be opened one by one
+		log.Printf("Warning: diff of %s is too large: %v", repoPath, fullDiffErr)
+	} else if fullDiffErr != nil {
 		data["Error"] = fmt.Sprintf("Failed to load diff: %v", fullDiffErr)
 	} else if fullDiffText == "" {
 		data["NoDiff"] = true
 	} else {
+		// A fresh commit pair inherits reviews of files whose content didn't change
+		if len(reviewState.ReviewedFiles) == 0 {
+			s.carryOverReviews(reviewState, repoPath, user, fullDiffText)
+		}
+
 		// Extract file paths from diff
 		files = extractFilesFromDiff(fullDiffText, reviewState, repoPath)
+		annotateModeChanges(files, fullDiffText)
+		annotateRenames(files, fullDiffText)
+		if viewOpts.FileOrder != "" {
+			sortFiles(files, viewOpts.FileOrder)
+		}
+
+		// Change types only drive the file list filter, so a failure isn't fatal
+		if changes, err := repo.GetFilesWithStatus(diffSource, diffTarget, viewOpts.Diff); err != nil {
+			log.Printf("Warning: failed to load change types: %v", err)
+		} else {
+			annotateChangeTypes(files, changes)
+			// Saving a review records the count, which the default diff gives
+			if viewOpts.Diff == s.diffOptions() && rawSource == sourceCommit && rawTarget == targetCommit {
+				s.changedFileCounts.set(repoPath, sourceCommit, targetCommit, len(changes))
+			}
+		}
+
+		// Line counts only tell large files apart, so a failure isn't fatal either
+		if s.largeFilesEnabled() {
+			if stats, err := repo.GetFileLineStats(diffSource, diffTarget, viewOpts.Diff); err != nil {
+				log.Printf("Warning: failed to load line counts: %v", err)
+			} else {
+				s.annotateLargeFiles(files, stats, fullDiffText)
+			}
+		}
+
 		data["Files"] = files
+		data["TotalFiles"] = len(files)
 	}
 
+	c := comparison{RepoPath: repoPath, SourceBranch: sourceBranch, TargetBranch: targetBranch, SourceCommit: sourceCommit, TargetCommit: targetCommit, User: user}
+
+	lastViewed := s.lastViewedFile(c, reviewState.LastViewedFile)
+
 	if filePath == "" {
-		s.render(w, "diff.html", data)
+		// Offer to resume the review at the file viewed last
+		if lastViewed != "" && isListedFile(files, lastViewed) {
+			data["ResumeFile"] = lastViewed
+		}
+
+		// Offer an incremental re-review when files were rejected at an earlier source commit
+		if previous, err := s.storage.FindPreviousReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit); err != nil {
+			log.Printf("Warning: failed to find previous review state: %v", err)
+		} else if rejected := rereviewFiles(previous, c); len(rejected) > 0 {
+			data["RereviewFiles"] = len(rejected)
+		}
+
+		// Warn about reviewing the same change twice, once in each direction
+		if reverse := s.findReverseReview(c, viewOpts.Pinned); reverse != nil {
+			data["ReverseReview"] = reverse
+		}
+
+		if fullDiffTooLarge {
+			data["DiffTooLarge"] = true
+			data["RawDiffURL"] = rawDiffURL(repoPath, rawSource, rawTarget, "", viewOpts)
+		}
+		files = setOwnerFilter(data, repo, diffTarget, files, viewOpts)
+		if viewOpts.Compact {
+			data["CompactLines"] = compactFileLines(fullDiffText, files, viewOpts.LineOrder, viewOpts.TabWidth)
+		}
+		setFileListFilters(data, files, viewOpts)
+		if !git.IsWorkingTree(sourceBranch) {
+			s.setDirtyWorkingTree(data, repo)
+		}
+		s.setSquashMessage(data, repo, reviewState, sourceBranch, commitSource, diffTarget)
+		setBranchCommits(data, repo, sourceBranch, commitSource, diffTarget, viewOpts)
+		s.render(w, r, "diff.html", data)
 		return
 	}
 
+	// The review resumes at the file viewed last
+	if filePath != lastViewed && (fullDiffTooLarge || isListedFile(files, filePath)) {
+		s.lastViewed.record(c, filePath)
+	}
+
+	// A large file's diff isn't loaded unless asked for; it's reviewed as any other
+	for _, file := range files {
+		if file["Path"] == filePath && file["Large"] == "true" && r.URL.Query().Get(showLargeParam) != "1" {
+			fileStatus, _ := reviewState.FileStatus(repoPath, filePath)
+			data["SelectedFile"] = filePath
+			data["LargeFile"] = true
+			data["ShowLargeURL"] = showLargeURL(r)
+			data["FileStatus"] = fileStatus
+			data["FileStat"] = largeFileStat(file, fileStatus)
+			data["RejectReason"] = file["Reason"]
+			data["NextFilePath"] = nextFilePath(files, filePath)
+			s.render(w, r, "diff.html", data)
+			return
+		}
+	}
+
 	// If a specific file is requested, load its diff
-	diffText, err2 = repo.GetFileDiff(sourceBranch, targetBranch, filePath)
-	if err2 != nil {
+	diffText, err2 = repo.GetFileDiffWithOptions(diffSource, diffTarget, filePath, viewOpts.Diff)
+	if errors.Is(err2, git.ErrDiffTooLarge) {
+		data["SelectedFile"] = filePath
+		data["DiffTooLarge"] = true
+		data["RawDiffURL"] = rawDiffURL(repoPath, rawSource, rawTarget, filePath, viewOpts)
+	} else if err2 != nil {
 		data["Error"] = fmt.Sprintf("Failed to load diff: %v", err2)
 	} else {
 		data["SelectedFile"] = filePath
-		data["DiffLines"] = strings.Split(diffText, "\n")
+		diffLines := parseDiffLines(filePath, reorderDiffLines(strings.Split(sanitizeUTF8(diffText), "\n"), viewOpts.LineOrder))
+		if viewOpts.FullFile && !viewOpts.Compact {
+			if full, ok := s.fullFileLines(repo, diffSource, filePath, diffLines); ok {
+				diffLines = full
+			} else {
+				data["FullFileUnavailable"] = true
+			}
+		}
+		expandTabs(diffLines, viewOpts.TabWidth)
+		data["DiffLines"] = diffLines
+		if change, ok := parseModeChanges(diffText)[filePath]; ok {
+			data["ModeChange"] = change.String()
+			data["ModeOnly"] = !change.ContentChanged
+		}
+		oldPath := filePath
+		if rename, ok := parseRenames(diffText)[filePath]; ok {
+			data["Rename"] = rename.String()
+			data["RenamedFrom"] = rename.From
+			oldPath = rename.From
+		}
+		setFileDownloads(data, repoPath, diffSource, diffTarget, oldPath, filePath, diffText)
+		if _, ok := imageContentType(filePath); ok {
+			data["ImagePreview"] = buildImagePreview(repo, repoPath, diffTarget, oldPath, diffSource, filePath)
+		}
 
 		// Determine the file status for display in the UI
-		fileStatus := "unreviewed"
-		for _, review := range reviewState.ReviewedFiles {
-			if review.Path == filePath && review.Repo == repoPath {
-				// Check if all lines have the same status
-				statuses := make(map[string]bool)
-				for _, status := range review.Lines {
-					statuses[status] = true
-				}
+		fileStatus, _ := reviewState.FileStatus(repoPath, filePath)
+		data["FileStatus"] = fileStatus
+		data["FileStat"] = buildFileStat(filePath, diffLines, fileStatus)
 
-				if len(statuses) == 1 {
-					for status := range statuses {
-						fileStatus = status
-					}
-				} else if len(statuses) > 1 {
-					fileStatus = "mixed"
-				}
-				break
+		// Line and hunk reviews are recorded against the default diff, so compare with that
+		_, hunks := s.getFileDiffShape(repoPath, sourceCommit, targetCommit, filePath)
+		review, reviewed := reviewState.File(repoPath, filePath)
+		if reviewed && review.HasLineReviews() {
+			data["ReviewStale"] = review.IsStale(hunks)
+		}
+		// A pathspec doesn't change the file's own hunks
+		hunkOpts := viewOpts.Diff
+		hunkOpts.Pathspec = ""
+		if hunkOpts == s.diffOptions() && !viewOpts.excludesCommits() {
+			annotateHunkStatuses(diffLines, hunks, review)
+		}
+		for _, file := range files {
+			if file["Path"] == filePath {
+				data["RejectReason"] = file["Reason"]
 			}
 		}
-		data["FileStatus"] = fileStatus
+		// The stat above still counts the binary header the compact view drops
+		if viewOpts.Compact {
+			data["DiffLines"] = compactLines(diffLines)
+		}
+
+		// With authentication, show how every reviewer judged the file
+		if s.authEnabled() {
+			data["Reviewers"] = s.fileReviewers(repoPath, sourceCommit, targetCommit, filePath, diffText)
+		}
 
 		// Find next file for navigation
-		if len(files) > 0 {
-			currentIndex := -1
-			for i, file := range files {
-				if file["Path"] == filePath {
-					currentIndex = i
-					break
-				}
-			}
+		if next := nextFilePath(files, filePath); next != "" {
+			data["NextFilePath"] = next
+		}
+	}
 
-			if currentIndex != -1 && currentIndex < len(files)-1 {
-				data["NextFilePath"] = files[currentIndex+1]["Path"]
-			}
+	s.render(w, r, "diff.html", data)
+}
+
+// isListedFile reports whether filePath is in the file list
+func isListedFile(files []map[string]string, filePath string) bool {
+	for _, file := range files {
+		if file["Path"] == filePath {
+			return true
 		}
 	}
+	return false
+}
 
-	s.render(w, "diff.html", data)
+// nextFilePath returns the path of the file following filePath in the file
+// list, or an empty string for the last file or one that isn't listed
+func nextFilePath(files []map[string]string, filePath string) string {
+	for i, file := range files {
+		if file["Path"] == filePath && i < len(files)-1 {
+			return files[i+1]["Path"]
+		}
+	}
+	return ""
 }
 
-// extractFilesFromDiff extracts file paths from a diff output
-func extractFilesFromDiff(diffText string, reviewState *models.ReviewState, repoPath string) []map[string]string {
-	var files []map[string]string
-	lines := strings.Split(diffText, "\n")
+// setFileListFilters filters the file list of the diff view and sets up its
+// filter chips. Only the file list is filtered, navigation between files spans
+// all of them. Each set of chips counts the files the other filter lets through.
+func setFileListFilters(data map[string]interface{}, files []map[string]string, viewOpts viewOptions) {
+	byChangeType := filterFilesByChangeType(files, viewOpts.ChangeType)
+	byStatus := filterFilesByStatus(files, viewOpts.Filter)
+	if len(files) > 0 {
+		data["StatusFilters"] = buildStatusFilters(byChangeType, viewOpts.Filter)
+		data["ChangeTypeFilters"] = buildChangeTypeFilters(byStatus, viewOpts.ChangeType)
+	}
+	data["Files"] = filterFilesByStatus(byChangeType, viewOpts.Filter)
+	data["StatusFilter"] = viewOpts.Filter
+	data["StatusFilterTotal"] = len(byChangeType)
+	data["ChangeTypeFilter"] = viewOpts.ChangeType
+	data["ChangeTypeFilterTotal"] = len(byStatus)
+	data["ChangeTypeQuery"] = viewOpts.withChangeType("").querySuffix()
+}
 
-	// Map to store file status
-	fileStatusMap := make(map[string]string)
+// permalink returns an absolute link to the diff view pinned to the
+// comparison's commits, so it shows the same diff however the branches move
+func (s *Server) permalink(r *http.Request, c comparison, filePath string, viewOpts viewOptions) string {
+	query := url.Values{}
+	query.Set("repo", c.RepoPath)
+	query.Set("source", c.SourceBranch)
+	query.Set("target", c.TargetBranch)
+	query.Set("source_commit", c.SourceCommit)
+	query.Set("target_commit", c.TargetCommit)
+	if filePath != "" {
+		query.Set("file", filePath)
+	}
+	viewOpts.Pinned = true
+	for key, values := range viewOpts.values() {
+		query[key] = values
+	}
 
-	// Process review state to determine file status
-	for _, review := range reviewState.ReviewedFiles {
-		if review.Repo != repoPath {
-			continue
-		}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return (&url.URL{Scheme: scheme, Host: r.Host, Path: s.url("/diff"), RawQuery: query.Encode()}).String()
+}
+
+// reviewerStatus is the status one reviewer gave to a file
+type reviewerStatus struct {
+	User   string
+	Status string
+}
+
+// fileReviewers aggregates the status every reviewer of a commit pair gave to
+// a file, ordered by user name
+func (s *Server) fileReviewers(repoPath, sourceCommit, targetCommit, filePath, diffText string) []reviewerStatus {
+	states, err := s.storage.LoadUserReviewStates(repoPath, sourceCommit, targetCommit)
+	if err != nil {
+		log.Printf("Warning: failed to load reviewer states: %v", err)
+		return nil
+	}
 
-		// Determine file status based on line statuses
-		var approved, rejected, skipped bool
-		for _, status := range review.Lines {
-			switch status {
-			case models.StateApproved:
-				approved = true
-			case models.StateRejected:
-				rejected = true
-			case models.StateSkipped:
-				skipped = true
+	reviewers := make([]reviewerStatus, 0, len(states))
+	for _, state := range states {
+		reviewer := reviewerStatus{User: state.User, Status: models.StateUnreviewed}
+		for _, file := range extractFilesFromDiff(diffText, state, repoPath) {
+			if file["Path"] == filePath {
+				reviewer.Status = file["Status"]
 			}
 		}
+		reviewers = append(reviewers, reviewer)
+	}
 
-		// Prioritize rejection, then approval, then skipped
-		status := "unreviewed"
-		if rejected {
-			status = models.StateRejected
-		} else if approved {
-			status = models.StateApproved
-		} else if skipped {
-			status = models.StateSkipped
+	sort.Slice(reviewers, func(i, j int) bool {
+		return reviewers[i].User < reviewers[j].User
+	})
+
+	return reviewers
+}
+
+// carryOverReviews copies still-valid file reviews from the previous commit pair
+// of the same branches into reviewState and persists the result. Hunk reviews
+// of files that changed are carried over flagged as stale, see
+// models.ReviewState.CarryOver.
+func (s *Server) carryOverReviews(reviewState *models.ReviewState, repoPath, user, diffText string) {
+	previous, err := s.storage.FindPreviousReviewState(repoPath, user, reviewState.SourceBranch, reviewState.TargetBranch, reviewState.SourceCommit, reviewState.TargetCommit)
+	if err != nil {
+		log.Printf("Warning: failed to find previous review state: %v", err)
+		return
+	}
+
+	c := comparison{RepoPath: repoPath, User: user, SourceCommit: reviewState.SourceCommit, TargetCommit: reviewState.TargetCommit}
+	unlock := s.reviewLocks.lock(c)
+	defer unlock()
+
+	// Another request may have reviewed files since the state was loaded
+	current, err := s.storage.LoadReviewState(repoPath, user, reviewState.SourceBranch, reviewState.TargetBranch, reviewState.SourceCommit, reviewState.TargetCommit)
+	if err != nil {
+		log.Printf("Warning: failed to reload review state: %v", err)
+		return
+	}
+	if len(current.ReviewedFiles) > 0 {
+		*reviewState = *current
+		return
+	}
+
+	// Hunk reviews are recorded against the default diff, whatever diffText's options
+	hunks := func(path string) []string {
+		_, hunks := s.getFileDiffShape(repoPath, reviewState.SourceCommit, reviewState.TargetCommit, path)
+		return hunks
+	}
+	if reviewState.CarryOver(previous, extractBlobHashesFromDiff(diffText), hunks) == 0 {
+		return
+	}
+
+	if err := s.storage.SaveReviewState(reviewState, repoPath, user); err != nil {
+		log.Printf("Warning: failed to save carried over review state: %v", err)
+	}
+}
+
+// targetCommitOf resolves the target commit a comparison's review is stored
+// against: the tip of the target branch, except for a stash, which is diffed
+// against the commit it was created on whatever the target
+func targetCommitOf(repo *git.Repository, sourceBranch, sourceCommit, targetBranch string) (string, error) {
+	if git.IsStashRef(sourceBranch) {
+		return repo.GetParentCommitHash(sourceCommit)
+	}
+	return repo.GetBranchCommitHash(targetBranch)
+}
+
+// diffOptions returns the options of the default diff, which review states
+// record line and hunk reviews against
+func (s *Server) diffOptions() git.DiffOptions {
+	return git.DiffOptions{NoRenames: s.noRenames, MaxBytes: s.maxDiffBytes}
+}
+
+// getFileDiffShape returns the blob hash pair and the hunk ranges of a file's
+// default diff between two commits, or zero values if they can't be determined
+func (s *Server) getFileDiffShape(repoPath, sourceCommit, targetCommit, filePath string) (string, []string) {
+	repo, exists, err := s.GetRepository(repoPath)
+	if err != nil || !exists {
+		return "", nil
+	}
+
+	diffText, err := repo.GetFileDiffWithOptions(sourceCommit, targetCommit, filePath, s.diffOptions())
+	if err != nil {
+		return "", nil
+	}
+
+	return extractBlobHashesFromDiff(diffText)[filePath], extractHunkRanges(diffText)
+}
+
+// extractHunkRanges returns the line ranges of each hunk header ("@@ -1,3 +1,4 @@")
+// of a single-file diff, in order
+func extractHunkRanges(diffText string) []string {
+	var hunks []string
+	for _, line := range strings.Split(diffText, "\n") {
+		if hunk, ok := hunkRange(line); ok {
+			hunks = append(hunks, hunk)
 		}
+	}
+	return hunks
+}
+
+// hunkReview is the data of the review controls of a hunk header: the diff
+// page's data, for the comparison and view options, and the header line
+type hunkReview struct {
+	Page map[string]interface{}
+	Line diffLine
+}
+
+// newHunkReview bundles the diff page's data with a hunk header line for the hunk-review template
+func newHunkReview(page map[string]interface{}, line diffLine) hunkReview {
+	return hunkReview{Page: page, Line: line}
+}
 
-		fileStatusMap[review.Path] = status
+// annotateHunkStatuses sets the review status of every hunk header whose hunk
+// is one of hunks, the ranges of the file's default diff, so those hunks can
+// be reviewed on their own. review may be nil for an unreviewed file.
+func annotateHunkStatuses(lines []diffLine, hunks []string, review *models.FileReview) {
+	known := make(map[string]bool, len(hunks))
+	for _, hunk := range hunks {
+		known[hunk] = true
 	}
 
-	// Extract files from diff
-	for _, line := range lines {
+	for i := range lines {
+		if !known[lines[i].Hunk] {
+			continue
+		}
+		lines[i].HunkStatus = models.StateUnreviewed
+		if review != nil {
+			lines[i].HunkStatus = review.HunkStatus(lines[i].Hunk)
+		}
+	}
+}
+
+// hunkRange returns the range of a hunk header line, such as "-1,3 +1,4" for
+// "@@ -1,3 +1,4 @@ func main() {"
+func hunkRange(line string) (string, bool) {
+	if !strings.HasPrefix(line, "@@ ") {
+		return "", false
+	}
+	end := strings.Index(line[3:], " @@")
+	if end == -1 {
+		return "", false
+	}
+	return line[3 : 3+end], true
+}
+
+// extractBlobHashesFromDiff maps each file in a diff to the blob hash pair
+// from its "index <target>..<source>" header line
+func extractBlobHashesFromDiff(diffText string) map[string]string {
+	hashes := make(map[string]string)
+
+	currentFile := ""
+	for _, line := range strings.Split(diffText, "\n") {
 		if strings.HasPrefix(line, "diff --git ") {
-			// Extract file path from the diff line
-			// Format is typically: diff --git a/path/to/file b/path/to/file
+			currentFile = ""
 			parts := strings.Split(line, " ")
-			if len(parts) >= 4 {
-				bPath := parts[3]
-				// Remove the "b/" prefix
-				if strings.HasPrefix(bPath, "b/") {
-					filePath := bPath[2:] // Skip the "b/" prefix
-
-					// Get status, default to "unreviewed"
-					status, exists := fileStatusMap[filePath]
-					if !exists {
-						status = "unreviewed"
-					}
-
-					files = append(files, map[string]string{
-						"Path":   filePath,
-						"Status": status,
-					})
-				}
+			if len(parts) >= 4 && strings.HasPrefix(parts[3], "b/") {
+				currentFile = parts[3][2:]
 			}
+			continue
+		}
+
+		if currentFile != "" && strings.HasPrefix(line, "index ") {
+			// Format is: index <target>..<source> [mode]
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				hashes[currentFile] = fields[1]
+			}
+			currentFile = ""
 		}
 	}
 
-	// Sort files by status and then alphabetically
-	sort.Slice(files, func(i, j int) bool {
-		// First sort by status
-		iStatus := files[i]["Status"]
-		jStatus := files[j]["Status"]
+	return hashes
+}
 
-		// Priority order: unreviewed > skipped > rejected > approved
-		statusPriority := map[string]int{
-			"unreviewed":         0,
-			models.StateSkipped:  1,
-			models.StateRejected: 2,
-			models.StateApproved: 3,
+// sanitizeUTF8 replaces invalid UTF-8 sequences in git output with the
+// replacement character, so content in legacy encodings renders as readable
+// text instead of mojibake. Only rendered text goes through it; the git layer
+// keeps returning the raw bytes.
+func sanitizeUTF8(s string) string {
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
+
+// extractFilePathsFromDiff returns the paths of the files in a diff, in diff order
+func extractFilePathsFromDiff(diffText string) []string {
+	var paths []string
+	// A path can head several sections, such as a symbolic link replaced by a
+	// regular file, which git diffs as a deletion and an addition
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	for _, line := range strings.Split(diffText, "\n") {
+		if path, ok := diffSectionPath(line); ok {
+			add(path)
+		}
+	}
+	return paths
+}
+
+// diffSectionPath returns the path of the file a line of a diff starts the
+// section of, if it's a section header
+func diffSectionPath(line string) (string, bool) {
+	if strings.HasPrefix(line, "diff --git ") {
+		// Extract file path from the diff line
+		// Format is typically: diff --git a/path/to/file b/path/to/file
+		parts := strings.Split(line, " ")
+		if len(parts) >= 4 {
+			bPath := parts[3]
+			// Remove the "b/" prefix
+			if strings.HasPrefix(bPath, "b/") {
+				return bPath[2:], true
+			}
 		}
+		return "", false
+	}
+	return git.CombinedDiffPath(line)
+}
 
-		iPriority := statusPriority[iStatus]
-		jPriority := statusPriority[jStatus]
+// extractFilesFromDiff extracts file paths from a diff output
+func extractFilesFromDiff(diffText string, reviewState *models.ReviewState, repoPath string) []map[string]string {
+	var files []map[string]string
 
-		if iPriority != jPriority {
-			return iPriority < jPriority
+	// Map to store file status
+	fileStatusMap := reviewState.FileStatuses(repoPath)
+	reasons := make(map[string]string)
+	for _, review := range reviewState.ReviewedFiles {
+		if review.Repo == repoPath && fileStatusMap[review.Path] == models.StateRejected {
+			reasons[review.Path] = review.Reason
 		}
+	}
 
-		// Then sort alphabetically
-		return files[i]["Path"] < files[j]["Path"]
-	})
+	// Extract files from diff
+	for _, filePath := range extractFilePathsFromDiff(diffText) {
+		// Get status, default to "unreviewed"
+		status, exists := fileStatusMap[filePath]
+		if !exists {
+			status = models.StateUnreviewed
+		}
+
+		files = append(files, map[string]string{
+			"Path":   filePath,
+			"Status": status,
+			"Reason": reasons[filePath],
+		})
+	}
+
+	sortFiles(files, fileOrderUnreviewedFirst)
 
 	return files
 }
 
+// filterableStatuses lists the file statuses the file list can be filtered by, in display order
+var filterableStatuses = []string{models.StateUnreviewed, models.StateApproved, models.StateRejected, models.StateSkipped, models.StateNeedsReview, models.StateMixed}
+
+// isFilterableStatus reports whether status is a valid file list filter
+func isFilterableStatus(status string) bool {
+	for _, s := range filterableStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// filterFilesByStatus returns the files whose status matches, preserving order.
+// An empty status matches every file.
+func filterFilesByStatus(files []map[string]string, status string) []map[string]string {
+	if status == "" {
+		return files
+	}
+	filtered := []map[string]string{}
+	for _, file := range files {
+		if file["Status"] == status {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
+
+// StatusFilter represents a status filter chip in the file list
+type StatusFilter struct {
+	Status string
+	Count  int
+	Active bool
+}
+
+// buildStatusFilters returns a filter chip per status with the number of files in it
+func buildStatusFilters(files []map[string]string, active string) []StatusFilter {
+	counts := make(map[string]int)
+	for _, file := range files {
+		counts[file["Status"]]++
+	}
+
+	filters := make([]StatusFilter, 0, len(filterableStatuses))
+	for _, status := range filterableStatuses {
+		filters = append(filters, StatusFilter{
+			Status: status,
+			Count:  counts[status],
+			Active: status == active,
+		})
+	}
+	return filters
+}
+
 // render renders a template with the given data
-func (s *Server) render(w http.ResponseWriter, templateName string, data interface{}) {
+func (s *Server) render(w http.ResponseWriter, r *http.Request, templateName string, data interface{}) {
+	if err, broken := s.brokenTemplates[templateName]; broken {
+		s.renderBrokenTemplate(w, r, templateName, err)
+		return
+	}
+
 	// Set content type
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
@@ -672,11 +2093,17 @@ func (s *Server) render(w http.ResponseWriter, templateName string, data interfa
 		return
 	}
 
-	// Then render the layout with the pre-rendered content
+	// Then render the layout with the pre-rendered content. Marking it as
+	// template.HTML is safe only because it was produced by html/template above,
+	// which already escaped every value (file paths, diff lines) it interpolated.
+	// Never wrap untrusted data in template.HTML.
 	layoutData := map[string]interface{}{
 		"Content":         templateName,
 		"ContentData":     data,
 		"RenderedContent": template.HTML(contentBuf.String()),
+		"Theme":           s.themeFromRequest(r),
+		"Themes":          s.themes,
+		"ReturnURL":       returnURL(r),
 	}
 
 	if err := s.tmpl.ExecuteTemplate(w, "layout.html", layoutData); err != nil {
@@ -688,8 +2115,61 @@ func (s *Server) render(w http.ResponseWriter, templateName string, data interfa
 	}
 }
 
+// wantsJSON reports whether the client asked for a JSON response instead of HTML,
+// either through the Accept header or the ajax=1 query parameter
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Query().Get("ajax") == "1" {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
+// respondError reports an error as JSON to clients that asked for it, and as
+// an error page otherwise
+func (s *Server) respondError(w http.ResponseWriter, r *http.Request, title string, message string, statusCode int) {
+	if wantsJSON(r) {
+		writeJSONError(w, title, message, statusCode)
+		return
+	}
+
+	s.renderError(w, r, title, message, statusCode)
+}
+
+// setDirtyWorkingTree flags a repository whose working tree has uncommitted
+// changes, which the compared branch tips don't include. The answer is cached
+// briefly, see dirtyWorkingTrees.
+func (s *Server) setDirtyWorkingTree(data map[string]interface{}, repo *git.Repository) {
+	data["DirtyWorkingTree"] = s.dirtyWorkingTrees.get(repo)
+}
+
+// renderUndiffable explains that git can't diff the selected refs at all,
+// which unlike other diff failures calls for picking different refs
+func (s *Server) renderUndiffable(w http.ResponseWriter, r *http.Request, repoPath string, err error) {
+	hint := "Git couldn't read one of the commits being compared. It may have been removed by a rebase or garbage collection, or the repository may be damaged. Pick the branches again to compare their current commits."
+	if errors.Is(err, git.ErrShallowHistory) {
+		hint = "This repository is a shallow or partial clone, and one of the commits being compared wasn't fetched. Run \"git fetch --unshallow\" in the repository to fetch its full history, then reload this page."
+	}
+
+	w.WriteHeader(diffErrorStatus(err))
+	s.render(w, r, "error.html", map[string]interface{}{
+		"Title":   "These Refs Can't Be Diffed",
+		"Message": err.Error(),
+		"Hint":    hint,
+		"BackURL": "/compare?repo=" + url.QueryEscape(repoPath),
+	})
+}
+
 // renderError renders an error page with the given status code and message
-func (s *Server) renderError(w http.ResponseWriter, title string, message string, statusCode int) {
+func (s *Server) renderError(w http.ResponseWriter, r *http.Request, title string, message string, statusCode int) {
 	// Set the HTTP status code
 	w.WriteHeader(statusCode)
 
@@ -700,5 +2180,5 @@ func (s *Server) renderError(w http.ResponseWriter, title string, message string
 	}
 
 	// Render the error template
-	s.render(w, "error.html", errorData)
+	s.render(w, r, "error.html", errorData)
 }
@@ -1,38 +1,57 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"io/fs"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
+	"unicode/utf8"
 
 	"github.com/darccio/diffty/internal/git"
 	"github.com/darccio/diffty/internal/models"
+	"github.com/darccio/diffty/internal/storage"
 )
 
 // MockStorage is a mock implementation of the Storage interface for testing
 type MockStorage struct {
-	repositories []string
-	reviewState  *models.ReviewState
-	saveCalled   bool
-	loadCalled   bool
+	repositories  []string
+	reviewState   *models.ReviewState
+	previousState *models.ReviewState
+	userStates    []*models.ReviewState
+	recent        []storage.ReviewStateSummary
+	fileReviews   []storage.FileReviewRecord
+	// cleared lists the repositories whose review states were cleared
+	cleared    []string
+	saveCalled bool
+	loadCalled bool
+	// lastUser is the user of the last review state saved or loaded
+	lastUser string
 }
 
-func (m *MockStorage) SaveReviewState(state *models.ReviewState, repoPath string) error {
+func (m *MockStorage) SaveReviewState(state *models.ReviewState, repoPath, user string) error {
 	m.reviewState = state
 	m.saveCalled = true
+	m.lastUser = user
 	return nil
 }
 
-func (m *MockStorage) LoadReviewState(repoPath, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error) {
+func (m *MockStorage) LoadReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error) {
 	m.loadCalled = true
+	m.lastUser = user
 	if m.reviewState != nil {
 		return m.reviewState, nil
 	}
@@ -45,6 +64,40 @@ func (m *MockStorage) LoadReviewState(repoPath, sourceBranch, targetBranch, sour
 	}, nil
 }
 
+func (m *MockStorage) HasReviewState(repoPath, user, sourceCommit, targetCommit string) (bool, error) {
+	return m.reviewState != nil, nil
+}
+
+func (m *MockStorage) FindPreviousReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error) {
+	return m.previousState, nil
+}
+
+func (m *MockStorage) LoadUserReviewStates(repoPath, sourceCommit, targetCommit string) ([]*models.ReviewState, error) {
+	return m.userStates, nil
+}
+
+func (m *MockStorage) ListRecentReviews(limit int) ([]storage.ReviewStateSummary, error) {
+	return m.recent, nil
+}
+
+func (m *MockStorage) ScanFileReviews(repoPath, filePath string, fn func(storage.FileReviewRecord) error) error {
+	for _, record := range m.fileReviews {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MockStorage) ClearReviewStates(repoPath string) (int, error) {
+	m.cleared = append(m.cleared, repoPath)
+	if m.reviewState == nil {
+		return 0, nil
+	}
+	m.reviewState = nil
+	return 1, nil
+}
+
 func (m *MockStorage) SaveRepositories(repos []string) error {
 	m.repositories = repos
 	return nil
@@ -118,7 +171,7 @@ func (s *TestServer) GetRepository(path string) (*git.Repository, bool, error) {
 func (s *TestServer) handleCompare(w http.ResponseWriter, r *http.Request) {
 	// For GET requests
 	if r.Method == http.MethodGet {
-		s.render(w, "compare.html", map[string]interface{}{
+		s.render(w, r, "compare.html", map[string]interface{}{
 			"RepoPath":     "/test/repo",
 			"RepoName":     "test-repo",
 			"SourceBranch": "feature",
@@ -131,7 +184,7 @@ func (s *TestServer) handleCompare(w http.ResponseWriter, r *http.Request) {
 	// For POST requests, redirect to diff view
 	if r.Method == http.MethodPost {
 		if err := r.ParseForm(); err != nil {
-			s.renderError(w, "Invalid Form", "Invalid form data submitted", http.StatusBadRequest)
+			s.renderError(w, r, "Invalid Form", "Invalid form data submitted", http.StatusBadRequest)
 			return
 		}
 
@@ -149,7 +202,7 @@ func (s *TestServer) handleCompare(w http.ResponseWriter, r *http.Request) {
 
 // Override handleDiffView to use our mock data
 func (s *TestServer) handleDiffView(w http.ResponseWriter, r *http.Request) {
-	s.render(w, "diff.html", map[string]interface{}{
+	s.render(w, r, "diff.html", map[string]interface{}{
 		"RepoPath":     "/test/repo",
 		"RepoName":     "test-repo",
 		"SourceBranch": "feature",
@@ -196,6 +249,18 @@ func setupTestServer(t *testing.T) (*Server, *MockStorage) {
 				Data: []byte(`{{define "diff.html"}}Diff Page{{end}}`),
 				Mode: 0644,
 			},
+			"templates/batch.html": &fstest.MapFile{
+				Data: []byte(`{{define "batch.html"}}Batch Page{{end}}`),
+				Mode: 0644,
+			},
+			"templates/rereview.html": &fstest.MapFile{
+				Data: []byte(`{{define "rereview.html"}}Rereview Page{{end}}`),
+				Mode: 0644,
+			},
+			"templates/paths.html": &fstest.MapFile{
+				Data: []byte(`{{define "paths.html"}}Paths Page{{end}}`),
+				Mode: 0644,
+			},
 			"templates/error.html": &fstest.MapFile{
 				Data: []byte(`{{define "error.html"}}Error: {{.Title}} - {{.Message}}{{end}}`),
 				Mode: 0644,
@@ -258,6 +323,47 @@ func TestHandleIndex(t *testing.T) {
 	}
 }
 
+// TestHandleIndexRedirectsToOpenedRepository tests that a repository opened at
+// startup skips the index on the first visit
+func TestHandleIndexRedirectsToOpenedRepository(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	repoDir := setupGitRepo(t)
+	if err := server.OpenRepository(repoDir); err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	if indexOf(mockStorage.repositories, repoDir) == -1 {
+		t.Errorf("Expected %s to be added, got %v", repoDir, mockStorage.repositories)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	server.handleIndex(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	if location := w.Header().Get("Location"); location != "/compare?repo="+url.QueryEscape(repoDir) {
+		t.Errorf("Unexpected redirect location: %s", location)
+	}
+
+	// Only the first visit is redirected, so the index can be reached afterwards
+	w = httptest.NewRecorder()
+	server.handleIndex(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Index Page") {
+		t.Errorf("Expected the index on the second visit, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// An invalid path is an error and leaves the index alone
+	other, _ := setupTestServer(t)
+	if err := other.OpenRepository(t.TempDir()); err == nil {
+		t.Error("Expected an error for a path that is not a git repository")
+	}
+	if other.startRepo != "" {
+		t.Errorf("Expected no start repository, got %s", other.startRepo)
+	}
+}
+
 // TestHandleCompare tests the compare handler
 func TestHandleCompare(t *testing.T) {
 	server, _ := setupTestServerWithMockRepo(t)
@@ -329,15 +435,26 @@ func TestHandleDiffView(t *testing.T) {
 }
 
 // TestHandleReviewState tests the review state handler
+// reviewComparisonQuery returns the comparison parameters of feature against
+// main in a fresh repository, which still needs registering
+func reviewComparisonQuery(t *testing.T) url.Values {
+	t.Helper()
+
+	repoDir := setupGitRepo(t)
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("source", "feature")
+	query.Set("target", "main")
+	query.Set("source_commit", runGit(t, repoDir, "rev-parse", "feature"))
+	query.Set("target_commit", runGit(t, repoDir, "rev-parse", "main"))
+	return query
+}
+
 func TestHandleReviewState(t *testing.T) {
 	server, mockStorage := setupTestServer(t)
 
-	formData := url.Values{}
-	formData.Set("repo", "/test/repo")
-	formData.Set("source", "feature")
-	formData.Set("target", "main")
-	formData.Set("source_commit", "feature-commit-hash")
-	formData.Set("target_commit", "main-commit-hash")
+	formData := reviewComparisonQuery(t)
+	mockStorage.repositories = []string{formData.Get("repo")}
 	formData.Set("file", "file.txt")
 	formData.Set("status", "approved")
 
@@ -365,6 +482,243 @@ func TestHandleReviewState(t *testing.T) {
 	}
 }
 
+// TestHandleReviewStateNeedsReview tests that a file can be handed over to
+// another reviewer, moving on to the next file like the other statuses
+func TestHandleReviewStateNeedsReview(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .Files}}{{.Path}}={{.Status}} {{end}}`)
+
+	query := reviewComparisonQuery(t)
+	mockStorage.repositories = []string{query.Get("repo")}
+	query.Set("file", "test.txt")
+	query.Set("status", models.StateNeedsReview)
+	query.Set("next", "next.txt")
+
+	req := httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+	if location := w.Header().Get("Location"); !strings.Contains(location, "file=next.txt") {
+		t.Errorf("Expected a redirect to the next file, got %s", location)
+	}
+	if status, _ := mockStorage.reviewState.FileStatus(query.Get("repo"), "test.txt"); status != models.StateNeedsReview {
+		t.Errorf("Expected the file to need another review, got %s", status)
+	}
+
+	// The file list can be filtered down to the files needing another review
+	view := url.Values{}
+	for _, key := range []string{"repo", "source", "target", "source_commit", "target_commit"} {
+		view.Set(key, query.Get(key))
+	}
+	view.Set("status", models.StateNeedsReview)
+	req = httptest.NewRequest("GET", "/diff?"+view.Encode(), nil)
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "test.txt=needs-review") {
+		t.Errorf("Expected the file needing another review, got %s", body)
+	}
+}
+
+// TestHandleReviewStatePreservesViewOptions tests that view options posted with a
+// review survive the redirect back to the diff view
+func TestHandleReviewStatePreservesViewOptions(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	query := reviewComparisonQuery(t)
+	mockStorage.repositories = []string{query.Get("repo")}
+	query.Set("file", "file.txt")
+	query.Set("status", "approved")
+	query.Set("next", "next.txt")
+
+	form := url.Values{}
+	form.Set("algorithm", "patience")
+	form.Set("status", "rejected")
+
+	req := httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	server.handleReviewState(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to parse redirect location: %v", err)
+	}
+
+	redirectQuery := location.Query()
+	expected := map[string]string{
+		"file":      "next.txt",
+		"algorithm": "patience",
+		"status":    "rejected",
+	}
+	for key, value := range expected {
+		if got := redirectQuery.Get(key); got != value {
+			t.Errorf("Expected redirect %s=%s, got %q (%s)", key, value, got, location)
+		}
+	}
+
+	// Invalid view options are rejected
+	form.Set("algorithm", "bogus")
+	req = httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+
+	server.handleReviewState(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestHandleReviewStateRejectReason tests the optional and required rejection reason modes
+func TestHandleReviewStateRejectReason(t *testing.T) {
+	comparison := reviewComparisonQuery(t)
+	post := func(server *Server, status, reason string) *httptest.ResponseRecorder {
+		query := url.Values{}
+		for key, values := range comparison {
+			query[key] = values
+		}
+		query.Set("file", "file.txt")
+		query.Set("status", status)
+
+		form := url.Values{}
+		if reason != "" {
+			form.Set("reason", reason)
+		}
+
+		req := httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.handleReviewState(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name     string
+		required bool
+		status   string
+		reason   string
+		code     int
+		stored   string
+	}{
+		{name: "optional without reason", status: models.StateRejected, code: http.StatusSeeOther},
+		{name: "optional with reason", status: models.StateRejected, reason: "Breaks the build", code: http.StatusSeeOther, stored: "Breaks the build"},
+		{name: "required without reason", required: true, status: models.StateRejected, code: http.StatusBadRequest},
+		{name: "required with blank reason", required: true, status: models.StateRejected, reason: "   ", code: http.StatusBadRequest},
+		{name: "required with reason", required: true, status: models.StateRejected, reason: " Missing tests ", code: http.StatusSeeOther, stored: "Missing tests"},
+		{name: "required only for rejections", required: true, status: models.StateApproved, reason: "ignored", code: http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, mockStorage := setupTestServer(t)
+			if tt.required {
+				WithRequiredRejectionReason()(server)
+			}
+			mockStorage.reviewState = nil
+			mockStorage.repositories = []string{comparison.Get("repo")}
+
+			w := post(server, tt.status, tt.reason)
+			if w.Code != tt.code {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+
+			if tt.code != http.StatusSeeOther {
+				if mockStorage.saveCalled {
+					t.Error("Expected the rejected request not to be saved")
+				}
+				return
+			}
+
+			if got := mockStorage.reviewState.ReviewedFiles[0].Reason; got != tt.stored {
+				t.Errorf("Expected stored reason %q, got %q", tt.stored, got)
+			}
+		})
+	}
+}
+
+// TestHandleReviewStateJSON tests the AJAX response mode of the review state handler
+func TestHandleReviewStateJSON(t *testing.T) {
+	query := reviewComparisonQuery(t)
+	query.Set("file", "file.txt")
+	query.Set("status", "rejected")
+	query.Set("next", "other.txt")
+
+	tests := []struct {
+		name   string
+		url    string
+		accept string
+	}{
+		{name: "accept header", url: "/api/review-state?" + query.Encode(), accept: "application/json"},
+		{name: "ajax parameter", url: "/api/review-state?" + query.Encode() + "&ajax=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, mockStorage := setupTestServer(t)
+			mockStorage.repositories = []string{query.Get("repo")}
+
+			req := httptest.NewRequest("POST", tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			server.handleReviewState(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+			}
+
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected JSON content type, got %s", ct)
+			}
+
+			var resp reviewStateResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if resp.File != "file.txt" || resp.Status != models.StateRejected || resp.NextFile != "other.txt" {
+				t.Errorf("Unexpected response: %+v", resp)
+			}
+
+			if !strings.Contains(resp.Redirect, "file=other.txt") {
+				t.Errorf("Expected redirect to the next file, got %s", resp.Redirect)
+			}
+
+			if !mockStorage.saveCalled {
+				t.Error("SaveReviewState should have been called")
+			}
+		})
+	}
+
+	// Errors are reported as JSON too
+	server, _ := setupTestServer(t)
+	req := httptest.NewRequest("POST", "/api/review-state?ajax=1", nil)
+	w := httptest.NewRecorder()
+
+	server.handleReviewState(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var errResp map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil || errResp["error"] == "" {
+		t.Errorf("Expected a JSON error, got %v (%v)", errResp, err)
+	}
+}
+
 // TestExtractFilesFromDiff tests the extractFilesFromDiff function
 func TestExtractFilesFromDiff(t *testing.T) {
 	diffText := `diff --git a/file1.txt b/file1.txt
@@ -419,52 +773,1493 @@ index 8765..4321 100644
 	}
 }
 
-// TestAddRepository tests the AddRepository method
-func TestAddRepository(t *testing.T) {
+// TestExtractBlobHashesFromDiff tests the extractBlobHashesFromDiff function
+func TestExtractBlobHashesFromDiff(t *testing.T) {
+	diffText := `diff --git a/file1.txt b/file1.txt
+index 1111111111111111111111111111111111111111..2222222222222222222222222222222222222222 100644
+--- a/file1.txt
++++ b/file1.txt
+@@ -1 +1,2 @@
+ line1
++index not a header
+diff --git a/script.sh b/script.sh
+old mode 100644
+new mode 100755
+diff --git a/new.txt b/new.txt
+new file mode 100644
+index 0000000000000000000000000000000000000000..3333333333333333333333333333333333333333
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++hello`
+
+	hashes := extractBlobHashesFromDiff(diffText)
+
+	expected := map[string]string{
+		"file1.txt": "1111111111111111111111111111111111111111..2222222222222222222222222222222222222222",
+		"new.txt":   "0000000000000000000000000000000000000000..3333333333333333333333333333333333333333",
+	}
+
+	if len(hashes) != len(expected) {
+		t.Errorf("Expected %d hashes, got %d: %v", len(expected), len(hashes), hashes)
+	}
+
+	for path, hash := range expected {
+		if hashes[path] != hash {
+			t.Errorf("Expected hash %s for %s, got %s", hash, path, hashes[path])
+		}
+	}
+}
+
+// TestExtractHunkRanges tests reading the hunk ranges of a diff
+func TestExtractHunkRanges(t *testing.T) {
+	diffText := `diff --git a/file.txt b/file.txt
+index 1111111..2222222 100644
+--- a/file.txt
++++ b/file.txt
+@@ -1,3 +1,4 @@ func main() {
+ line1
++line2
+@@ -10 +11,2 @@
+ line10
++line11`
+
+	expected := []string{"-1,3 +1,4", "-10 +11,2"}
+	if hunks := extractHunkRanges(diffText); !reflect.DeepEqual(hunks, expected) {
+		t.Errorf("Expected hunks %v, got %v", expected, hunks)
+	}
+}
+
+// TestHandleDiffViewStaleReview tests that hunk reviews are flagged as stale
+// once the branch moves and lines are inserted above a reviewed hunk
+func TestHandleDiffViewStaleReview(t *testing.T) {
+	store, err := storage.OpenStorage(storage.DefaultBackend, storage.Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	server, err := New(store)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	overrideTemplate(t, server, "diff.html", `stale={{.ReviewStale}} status={{.FileStatus}} {{range .DiffLines}}{{if .HunkStatus}}[{{.Hunk}}={{.HunkStatus}}]{{end}}{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	if err := store.SaveRepositories([]string{repoDir}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+	lines := make([]string, 30)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	writeFile(t, repoDir, "multi.txt", strings.Join(lines, "\n")+"\n")
+	runGit(t, repoDir, "add", "multi.txt")
+	runGit(t, repoDir, "commit", "-m", "Add multi-hunk file")
+	runGit(t, repoDir, "checkout", "feature")
+	runGit(t, repoDir, "merge", "main")
+	lines[1] = "changed near the top"
+	lines[27] = "changed near the bottom"
+	writeFile(t, repoDir, "multi.txt", strings.Join(lines, "\n")+"\n")
+	runGit(t, repoDir, "commit", "-am", "Change both ends")
+	runGit(t, repoDir, "checkout", "main")
+
+	render := func() string {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&file=multi.txt", nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+	review := func(hunk string) {
+		t.Helper()
+		query := url.Values{
+			"repo":          {repoDir},
+			"source":        {"feature"},
+			"target":        {"main"},
+			"source_commit": {runGit(t, repoDir, "rev-parse", "feature")},
+			"target_commit": {runGit(t, repoDir, "rev-parse", "main")},
+			"file":          {"multi.txt"},
+			"status":        {models.StateApproved},
+			"hunk":          {hunk},
+		}
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), nil))
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("Expected the hunk review saved, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	// Reviews made against the current diff aren't stale
+	review("-1,5 +1,5")
+	review("-25,6 +25,6")
+	if body := render(); !strings.Contains(body, "stale=false status=approved") {
+		t.Errorf("Expected a current review, got %s", body)
+	}
+
+	// Lines inserted between the hunks add a hunk and move the last one
+	runGit(t, repoDir, "checkout", "feature")
+	lines = append(lines[:10], append([]string{"inserted 1", "inserted 2"}, lines[10:]...)...)
+	writeFile(t, repoDir, "multi.txt", strings.Join(lines, "\n")+"\n")
+	runGit(t, repoDir, "commit", "-am", "Insert lines in the middle")
+	runGit(t, repoDir, "checkout", "main")
+
+	body := render()
+	if !strings.Contains(body, "stale=true status=unreviewed") {
+		t.Errorf("Expected the carried over review flagged as stale and pending, got %s", body)
+	}
+	if !strings.Contains(body, "[-1,5 &#43;1,5=approved]") || !strings.Contains(body, "=unreviewed]") {
+		t.Errorf("Expected only the hunk left in place approved, got %s", body)
+	}
+
+	// Reviewing the inserted and moved hunks brings the review up to date
+	review("-8,6 +8,8")
+	review("-25,6 +27,6")
+	if body := render(); !strings.Contains(body, "stale=false status=approved") {
+		t.Errorf("Expected the review up to date, got %s", body)
+	}
+}
+
+// TestHandleDiffViewCarriesOverReviews tests that unchanged files keep their review
+// status when the branches move to a new commit pair
+func TestHandleDiffViewCarriesOverReviews(t *testing.T) {
 	server, mockStorage := setupTestServer(t)
 
-	// Create a temporary directory that will be our mock git repo
-	tempDir, err := os.MkdirTemp("", "diffty-test-repo")
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+	mockStorage.reviewState = nil
+
+	repo := git.NewRepository(repoDir)
+	diffText, err := repo.GetDiff("feature", "main")
 	if err != nil {
-		t.Fatalf("Failed to create temporary directory: %v", err)
+		t.Fatalf("Failed to get diff: %v", err)
 	}
-	defer os.RemoveAll(tempDir)
+	hashes := extractBlobHashesFromDiff(diffText)
 
-	// Create a .git directory to make it look like a git repo
-	if err := os.Mkdir(filepath.Join(tempDir, ".git"), 0755); err != nil {
-		t.Fatalf("Failed to create .git directory: %v", err)
+	mockStorage.previousState = &models.ReviewState{
+		SourceBranch: "feature",
+		TargetBranch: "main",
+		SourceCommit: "old-feature-commit",
+		TargetCommit: "old-main-commit",
+		ReviewedFiles: []models.FileReview{
+			{Repo: repoDir, Path: "test.txt", Lines: map[string]string{"all": models.StateApproved}, BlobHash: hashes["test.txt"]},
+		},
 	}
 
-	// Add the repository
-	success, err := server.AddRepository(tempDir)
+	req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main", nil)
+	w := httptest.NewRecorder()
 
-	if !success || err != nil {
-		t.Errorf("AddRepository failed: %v", err)
+	server.handleDiffView(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
 	}
 
-	// Check that the repository was added to the storage
-	if len(mockStorage.repositories) != 2 || mockStorage.repositories[1] != tempDir {
-		t.Errorf("Repository not added to storage correctly: %v", mockStorage.repositories)
+	if !mockStorage.saveCalled {
+		t.Fatal("Expected carried over review state to be saved")
+	}
+
+	if len(mockStorage.reviewState.ReviewedFiles) != 1 || mockStorage.reviewState.ReviewedFiles[0].Lines["all"] != models.StateApproved {
+		t.Errorf("Expected test.txt review to be carried over, got %+v", mockStorage.reviewState.ReviewedFiles)
 	}
 }
 
-// TestRenderError tests the renderError method
-func TestRenderError(t *testing.T) {
-	server, _ := setupTestServer(t)
+// TestFilterFilesByStatus tests filtering the file list by each status
+func TestFilterFilesByStatus(t *testing.T) {
+	files := []map[string]string{
+		{"Path": "a.go", "Status": "unreviewed"},
+		{"Path": "b.go", "Status": "unreviewed"},
+		{"Path": "c.go", "Status": models.StateSkipped},
+		{"Path": "d.go", "Status": models.StateRejected},
+		{"Path": "e.go", "Status": models.StateApproved},
+		{"Path": "f.go", "Status": "mixed"},
+	}
 
+	expected := map[string][]string{
+		"unreviewed":         {"a.go", "b.go"},
+		models.StateSkipped:  {"c.go"},
+		models.StateRejected: {"d.go"},
+		models.StateApproved: {"e.go"},
+		"mixed":              {"f.go"},
+	}
+
+	for status, paths := range expected {
+		t.Run(status, func(t *testing.T) {
+			if !isFilterableStatus(status) {
+				t.Fatalf("Expected %s to be a valid filter", status)
+			}
+
+			filtered := filterFilesByStatus(files, status)
+			if len(filtered) != len(paths) {
+				t.Fatalf("Expected %d files, got %d: %v", len(paths), len(filtered), filtered)
+			}
+			for i, path := range paths {
+				if filtered[i]["Path"] != path {
+					t.Errorf("Expected file %d to be %s, got %s", i, path, filtered[i]["Path"])
+				}
+			}
+		})
+	}
+
+	if isFilterableStatus("bogus") {
+		t.Error("Expected bogus to be an invalid filter")
+	}
+
+	filters := buildStatusFilters(files, models.StateRejected)
+	if len(filters) != len(filterableStatuses) {
+		t.Fatalf("Expected %d filters, got %d", len(filterableStatuses), len(filters))
+	}
+	for _, filter := range filters {
+		if filter.Count != len(expected[filter.Status]) {
+			t.Errorf("Expected count %d for %s, got %d", len(expected[filter.Status]), filter.Status, filter.Count)
+		}
+		if filter.Active != (filter.Status == models.StateRejected) {
+			t.Errorf("Unexpected active state %v for %s", filter.Active, filter.Status)
+		}
+	}
+}
+
+// TestHandleDiffViewStatusFilter tests the status query parameter of the diff view
+func TestHandleDiffViewStatusFilter(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .Files}}[{{.Path}}:{{.Status}}]{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "added.txt", "added\n")
+	runGit(t, repoDir, "add", "added.txt")
+	runGit(t, repoDir, "commit", "-m", "Add file")
+	runGit(t, repoDir, "checkout", "main")
+
+	mockStorage.repositories = []string{repoDir}
+	mockStorage.reviewState = &models.ReviewState{
+		ReviewedFiles: []models.FileReview{
+			{Repo: repoDir, Path: "test.txt", Lines: map[string]string{"all": models.StateApproved}},
+		},
+	}
+
+	tests := map[string]string{
+		"":                   "[added.txt:unreviewed][test.txt:approved]",
+		"unreviewed":         "[added.txt:unreviewed]",
+		models.StateApproved: "[test.txt:approved]",
+		models.StateRejected: "",
+	}
+
+	for status, expected := range tests {
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&status="+status, nil)
+		w := httptest.NewRecorder()
+
+		server.handleDiffView(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d for filter %q, got %d", http.StatusOK, status, w.Code)
+		}
+		if got := strings.TrimSuffix(strings.TrimPrefix(w.Body.String(), "<!DOCTYPE html><html><body>"), "</body></html>"); got != expected {
+			t.Errorf("Expected %q for filter %q, got %q", expected, status, got)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&status=bogus", nil)
 	w := httptest.NewRecorder()
 
-	server.renderError(w, "Test Error", "This is a test error message", http.StatusBadRequest)
+	server.handleDiffView(w, req)
 
-	resp := w.Result()
-	body, _ := io.ReadAll(resp.Body)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for invalid filter, got %d", http.StatusBadRequest, w.Code)
+	}
+}
 
-	if resp.StatusCode != http.StatusBadRequest {
-		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, resp.StatusCode)
+// TestHandleDiffViewChangeTypeFilter tests the change_type query parameter of
+// the diff view, alone and combined with the status filter
+func TestHandleDiffViewChangeTypeFilter(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .Files}}[{{.Path}}:{{.Change}}:{{.Status}}]{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	writeFile(t, repoDir, "doomed.txt", "doomed\n")
+	writeFile(t, repoDir, "moved.txt", strings.Repeat("unchanged line\n", 20))
+	runGit(t, repoDir, "add", "doomed.txt", "moved.txt")
+	runGit(t, repoDir, "commit", "-m", "Add files to change")
+
+	runGit(t, repoDir, "checkout", "feature")
+	runGit(t, repoDir, "merge", "main")
+	writeFile(t, repoDir, "added.txt", "added\n")
+	writeFile(t, repoDir, "fresh.txt", "fresh\n")
+	runGit(t, repoDir, "add", "added.txt", "fresh.txt")
+	runGit(t, repoDir, "rm", "doomed.txt")
+	runGit(t, repoDir, "mv", "moved.txt", "renamed.txt")
+	runGit(t, repoDir, "commit", "-m", "Change files")
+	runGit(t, repoDir, "checkout", "main")
+
+	mockStorage.repositories = []string{repoDir}
+	mockStorage.reviewState = &models.ReviewState{
+		ReviewedFiles: []models.FileReview{
+			{Repo: repoDir, Path: "added.txt", Lines: map[string]string{"all": models.StateApproved}},
+			{Repo: repoDir, Path: "test.txt", Lines: map[string]string{"all": models.StateApproved}},
+		},
 	}
 
-	expectedContent := "Error: Test Error - This is a test error message"
-	if !strings.Contains(string(body), expectedContent) {
-		t.Errorf("Expected body to contain '%s', got '%s'", expectedContent, string(body))
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{query: "change_type=A", expected: "[fresh.txt:A:unreviewed][added.txt:A:approved]"},
+		{query: "change_type=M", expected: "[test.txt:M:approved]"},
+		{query: "change_type=D", expected: "[doomed.txt:D:unreviewed]"},
+		{query: "change_type=R", expected: "[renamed.txt:R:unreviewed]"},
+		{query: "change_type=C", expected: ""},
+		{query: "change_type=A&status=approved", expected: "[added.txt:A:approved]"},
+		{query: "change_type=A&status=unreviewed", expected: "[fresh.txt:A:unreviewed]"},
+		{query: "change_type=M&status=unreviewed", expected: ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&"+tt.query, nil)
+		w := httptest.NewRecorder()
+
+		server.handleDiffView(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d for %q, got %d", http.StatusOK, tt.query, w.Code)
+		}
+		if got := strings.TrimSuffix(strings.TrimPrefix(w.Body.String(), "<!DOCTYPE html><html><body>"), "</body></html>"); got != tt.expected {
+			t.Errorf("Expected %q for %q, got %q", tt.expected, tt.query, got)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&change_type=X", nil)
+	w := httptest.NewRecorder()
+
+	server.handleDiffView(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for invalid change type, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestBuildChangeTypeFilters(t *testing.T) {
+	files := []map[string]string{
+		{"Path": "a.go", "Change": "A"},
+		{"Path": "b.go", "Change": "A"},
+		{"Path": "c.go", "Change": "M"},
+	}
+
+	filters := buildChangeTypeFilters(files, "D")
+	expected := []ChangeTypeFilter{
+		{ChangeType: "A", Label: "added", Count: 2},
+		{ChangeType: "M", Label: "modified", Count: 1},
+		{ChangeType: "D", Label: "deleted", Count: 0, Active: true},
+	}
+	if !reflect.DeepEqual(filters, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, filters)
+	}
+}
+
+// TestParseChangeTypes tests that files with several sections in a patch
+// series, such as one deleted and re-added, get their net change type
+func TestParseChangeTypes(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "readd.patch"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	if paths := extractFilePathsFromDiff(string(content)); strings.Join(paths, " ") != "config.yml scratch.txt link notes.md" {
+		t.Errorf("Expected every file once, got %q", paths)
+	}
+
+	// scratch.txt is added and deleted again, leaving no net change
+	expected := []git.FileChange{
+		{Path: "config.yml", ChangeType: "M"},
+		{Path: "link", ChangeType: "T"},
+		{Path: "notes.md", ChangeType: "M"},
+	}
+	if changes := parseChangeTypes(string(content)); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+}
+
+// TestHandleDiffViewTypeChange tests that a symbolic link replaced by a
+// regular file, which git diffs as a deletion and an addition of the same
+// path, is listed once as a type change with both sections in its diff
+func TestHandleDiffViewTypeChange(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .Files}}[{{.Path}}:{{.Change}}]{{end}}{{range .ChangeTypeFilters}}({{.Label}} {{.Count}}){{end}}{{range .DiffLines}}{{.Text}}|{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	if err := os.Symlink("test.txt", filepath.Join(repoDir, "link")); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+	runGit(t, repoDir, "add", "link")
+	runGit(t, repoDir, "commit", "-m", "Add link")
+	runGit(t, repoDir, "branch", "-f", "base")
+	if err := os.Remove(filepath.Join(repoDir, "link")); err != nil {
+		t.Fatalf("Failed to remove link: %v", err)
+	}
+	writeFile(t, repoDir, "link", "now a file\n")
+	runGit(t, repoDir, "commit", "-am", "Replace link with a file")
+	runGit(t, repoDir, "checkout", "main")
+	mockStorage.repositories = []string{repoDir}
+
+	base := "/diff?repo=" + url.QueryEscape(repoDir) + "&source=feature&target=base"
+	req := httptest.NewRequest("GET", base, nil)
+	w := httptest.NewRecorder()
+	server.handleDiffView(w, req)
+	if body := w.Body.String(); !strings.Contains(body, "[link:T](type changed 1)") {
+		t.Errorf("Expected link listed once as a type change, got %s", body)
+	}
+
+	req = httptest.NewRequest("GET", base+"&file=link", nil)
+	w = httptest.NewRecorder()
+	server.handleDiffView(w, req)
+	if body := w.Body.String(); !strings.Contains(body, "|-test.txt|") || !strings.Contains(body, "|&#43;now a file|") {
+		t.Errorf("Expected the diff of link to show both the deletion and the addition, got %s", body)
+	}
+}
+
+// TestAddRepository tests the AddRepository method
+func TestAddRepository(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	// Create a temporary directory that will be our mock git repo
+	tempDir, err := os.MkdirTemp("", "diffty-test-repo")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create a .git directory to make it look like a git repo
+	if err := os.Mkdir(filepath.Join(tempDir, ".git"), 0755); err != nil {
+		t.Fatalf("Failed to create .git directory: %v", err)
+	}
+
+	// Add the repository
+	success, err := server.AddRepository(tempDir)
+
+	if !success || err != nil {
+		t.Errorf("AddRepository failed: %v", err)
+	}
+
+	// Check that the repository was added to the storage
+	if len(mockStorage.repositories) != 2 || mockStorage.repositories[1] != tempDir {
+		t.Errorf("Repository not added to storage correctly: %v", mockStorage.repositories)
+	}
+}
+
+// TestAddRepositoryLimit tests that the repository limit is enforced at the boundary
+func TestAddRepositoryLimit(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	server.maxRepos = 2
+
+	newRepo := func() string {
+		dir := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+			t.Fatalf("Failed to create .git directory: %v", err)
+		}
+		return dir
+	}
+
+	// One stored repository, so a second one fits exactly
+	second := newRepo()
+	if success, err := server.AddRepository(second); !success || err != nil {
+		t.Fatalf("Expected repository to be added within the limit, got %v", err)
+	}
+
+	// Re-adding an existing repository at the limit is still fine
+	if success, err := server.AddRepository(second); !success || err != nil {
+		t.Errorf("Expected re-adding an existing repository to succeed, got %v", err)
+	}
+
+	// A third repository exceeds the limit
+	success, err := server.AddRepository(newRepo())
+	if success || !errors.Is(err, ErrRepositoryLimit) {
+		t.Fatalf("Expected ErrRepositoryLimit, got success=%v err=%v", success, err)
+	}
+
+	if len(mockStorage.repositories) != 2 {
+		t.Errorf("Expected 2 stored repositories, got %d", len(mockStorage.repositories))
+	}
+
+	// The error is surfaced to the UI
+	formData := url.Values{}
+	formData.Set("path", newRepo())
+	req := httptest.NewRequest("POST", "/api/repository/add", strings.NewReader(formData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	server.handleAddRepository(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	if !strings.Contains(w.Body.String(), "Repository Limit Reached") {
+		t.Errorf("Expected limit error in body, got %s", w.Body.String())
+	}
+}
+
+// TestAddRepositoryAllowedRoots tests that only repositories inside the allowed
+// roots can be added once roots are configured
+func TestAddRepositoryAllowedRoots(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	base := t.TempDir()
+	newRepo := func(path string) string {
+		if err := os.MkdirAll(filepath.Join(path, ".git"), 0755); err != nil {
+			t.Fatalf("Failed to create .git directory: %v", err)
+		}
+		return path
+	}
+
+	root := newRepo(filepath.Join(base, "repos"))
+	WithAllowedRoots([]string{root})(server)
+
+	for _, path := range []string{root, newRepo(filepath.Join(root, "team", "app"))} {
+		if success, err := server.AddRepository(path); !success || err != nil {
+			t.Errorf("Expected %s to be allowed, got %v", path, err)
+		}
+	}
+
+	outside := newRepo(filepath.Join(base, "other"))
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	disallowed := []string{
+		outside,
+		newRepo(filepath.Join(base, "repos-evil")),
+		filepath.Join(root, "..", "other"),
+		filepath.Join(root, "link"),
+	}
+	for _, path := range disallowed {
+		if success, err := server.AddRepository(path); success || !errors.Is(err, ErrRepositoryNotAllowed) {
+			t.Errorf("Expected %s to be refused with ErrRepositoryNotAllowed, got success=%v err=%v", path, success, err)
+		}
+	}
+
+	if len(mockStorage.repositories) != 3 {
+		t.Errorf("Expected 3 stored repositories, got %v", mockStorage.repositories)
+	}
+
+	// The error is surfaced to the UI
+	formData := url.Values{}
+	formData.Set("path", outside)
+	req := httptest.NewRequest("POST", "/api/repository/add", strings.NewReader(formData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	server.handleAddRepository(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Repository Not Allowed") {
+		t.Errorf("Expected allowlist error in body, got %s", w.Body.String())
+	}
+}
+
+// TestHandleDiffViewInvalidUTF8 tests that diffs of files in legacy encodings
+// render as valid UTF-8 with the real templates
+func TestHandleDiffViewInvalidUTF8(t *testing.T) {
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "latin1.txt", "caf\xe9 cr\xe8me\n")
+	runGit(t, repoDir, "add", "latin1.txt")
+	runGit(t, repoDir, "commit", "-m", "Add latin-1 file")
+	runGit(t, repoDir, "checkout", "main")
+
+	server, err := New(&MockStorage{repositories: []string{repoDir}})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&file=latin1.txt", nil)
+	w := httptest.NewRecorder()
+	server.handleDiffView(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	body := w.Body.String()
+	if !utf8.ValidString(body) {
+		t.Error("Expected the page to be valid UTF-8")
+	}
+	if !strings.Contains(body, "caf\uFFFD cr\uFFFDme") {
+		t.Errorf("Expected invalid bytes to be replaced, got %s", body)
+	}
+
+	// The git layer still returns the raw bytes
+	raw, err := git.NewRepository(repoDir).GetFileDiff("feature", "main", "latin1.txt")
+	if err != nil {
+		t.Fatalf("Failed to get file diff: %v", err)
+	}
+	if !strings.Contains(raw, "caf\xe9") {
+		t.Errorf("Expected raw diff bytes to be preserved, got %q", raw)
+	}
+}
+
+// TestRenderDiffEscapesContent tests that file paths and diff lines coming from a
+// repository are HTML-escaped by the real templates
+func TestRenderDiffEscapesContent(t *testing.T) {
+	server, err := New(&MockStorage{})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	payload := `<script>alert("xss")</script>`
+	pathPayload := `"><img src=x onerror=alert(1)>.go`
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{
+			name: "file list",
+			data: map[string]interface{}{
+				"RepoPath":     "/test/repo",
+				"RepoName":     payload,
+				"SourceBranch": payload,
+				"TargetBranch": "main",
+				"Files":        []map[string]string{{"Path": pathPayload, "Status": "unreviewed"}, {"Path": payload, "Status": "approved"}},
+			},
+		},
+		{
+			name: "file diff",
+			data: map[string]interface{}{
+				"RepoPath":     "/test/repo",
+				"RepoName":     "test-repo",
+				"SourceBranch": "feature",
+				"TargetBranch": "main",
+				"SelectedFile": pathPayload,
+				"FileStatus":   "unreviewed",
+				"Files":        []map[string]string{{"Path": pathPayload, "Status": "unreviewed"}},
+				"DiffLines":    parseDiffLines(pathPayload, []string{"diff --git a/x b/x", "@@ -1,2 +1,2 @@", "+" + payload, "-" + payload, " " + payload}),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.render(w, httptest.NewRequest("GET", "/diff", nil), "diff.html", tt.data)
+
+			body := w.Body.String()
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, body)
+			}
+
+			if strings.Contains(body, payload) {
+				t.Errorf("Expected script payload to be escaped, found it verbatim in the output")
+			}
+
+			if strings.Contains(body, "<img src=x") {
+				t.Errorf("Expected path payload to be escaped, found raw img tag in the output")
+			}
+
+			if !strings.Contains(body, "&lt;script&gt;") {
+				t.Errorf("Expected escaped script payload in the output")
+			}
+		})
+	}
+}
+
+// TestUnavailableRepository tests repositories that were moved or deleted on disk
+func TestUnavailableRepository(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	repoDir := setupGitRepo(t)
+	missingDir := filepath.Join(t.TempDir(), "deleted-repo")
+	mockStorage.repositories = []string{repoDir, missingDir}
+
+	// The index lists both, flagging the missing one
+	repos, err := server.GetRepositories()
+	if err != nil {
+		t.Fatalf("GetRepositories failed: %v", err)
+	}
+	if !repos[repoDir].Available {
+		t.Errorf("Expected %s to be available", repoDir)
+	}
+	if repos[missingDir].Available {
+		t.Errorf("Expected %s to be unavailable", missingDir)
+	}
+
+	// Using it fails with a distinct error instead of a git failure
+	_, exists, err := server.GetRepository(missingDir)
+	if !exists || !errors.Is(err, ErrRepositoryUnavailable) {
+		t.Errorf("Expected ErrRepositoryUnavailable, got exists=%v err=%v", exists, err)
+	}
+
+	req := httptest.NewRequest("GET", "/compare?repo="+url.QueryEscape(missingDir), nil)
+	w := httptest.NewRecorder()
+	server.handleCompare(w, req)
+	if w.Code != http.StatusGone {
+		t.Errorf("Expected status code %d, got %d", http.StatusGone, w.Code)
+	}
+
+	// It can be removed from the list
+	formData := url.Values{}
+	formData.Set("path", missingDir)
+	req = httptest.NewRequest("POST", "/api/repository/remove", strings.NewReader(formData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	server.handleRemoveRepository(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("Expected status code %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	if len(mockStorage.repositories) != 1 || mockStorage.repositories[0] != repoDir {
+		t.Errorf("Expected only %s to remain, got %v", repoDir, mockStorage.repositories)
+	}
+
+	// Removing it again reports it as not found
+	req = httptest.NewRequest("POST", "/api/repository/remove", strings.NewReader(formData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	server.handleRemoveRepository(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// TestHandleClearReviews tests that clearing review states needs confirmation
+// and keeps the repository registered
+func TestHandleClearReviews(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	clearReviews := func(form url.Values) (int, clearReviewsResponse) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/repository/clear-reviews", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+
+		var resp clearReviewsResponse
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	// Without confirmation nothing is cleared
+	if code, _ := clearReviews(url.Values{"path": {"/test/repo"}}); code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without confirmation, got %d", http.StatusBadRequest, code)
+	}
+	if len(mockStorage.cleared) != 0 {
+		t.Errorf("Expected nothing to be cleared without confirmation, got %v", mockStorage.cleared)
+	}
+
+	// Unknown repositories aren't touched
+	if code, _ := clearReviews(url.Values{"path": {"/unknown"}, "confirm": {"1"}}); code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for an unknown repository, got %d", http.StatusNotFound, code)
+	}
+
+	// A view waiting to be saved would bring a cleared review back
+	server.lastViewed.record(comparison{RepoPath: "/test/repo", SourceBranch: "feature", TargetBranch: "main", SourceCommit: "abc", TargetCommit: "def"}, "a.txt")
+
+	code, resp := clearReviews(url.Values{"path": {"/test/repo"}, "confirm": {"1"}})
+	if code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, code)
+	}
+	if resp.Repo != "/test/repo" || resp.Cleared != 1 {
+		t.Errorf("Expected 1 comparison of /test/repo to be cleared, got %+v", resp)
+	}
+	if len(mockStorage.repositories) != 1 || mockStorage.repositories[0] != "/test/repo" {
+		t.Errorf("Expected the repository to stay registered, got %v", mockStorage.repositories)
+	}
+	if _, ok := server.lastViewed.pendingFile(comparison{RepoPath: "/test/repo", SourceBranch: "feature", TargetBranch: "main", SourceCommit: "abc", TargetCommit: "def"}); ok {
+		t.Error("Expected the pending view of the repository to be dropped")
+	}
+}
+
+// TestHandleListRepositories tests the repositories JSON endpoint
+func TestHandleListRepositories(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	repoDir := setupGitRepo(t)
+	missingDir := filepath.Join(t.TempDir(), "missing")
+	mockStorage.repositories = []string{repoDir, missingDir}
+
+	req := httptest.NewRequest("GET", "/api/repositories", nil)
+	w := httptest.NewRecorder()
+
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", ct)
+	}
+
+	var repos []repositoryResponse
+	if err := json.NewDecoder(w.Body).Decode(&repos); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	expected := []repositoryResponse{
+		{Path: repoDir, Name: filepath.Base(repoDir), Available: true},
+		{Path: missingDir, Name: "missing", Available: false},
+	}
+
+	if len(repos) != len(expected) {
+		t.Fatalf("Expected %d repositories, got %d: %+v", len(expected), len(repos), repos)
+	}
+
+	for i := range expected {
+		if repos[i] != expected[i] {
+			t.Errorf("Expected repository %d to be %+v, got %+v", i, expected[i], repos[i])
+		}
+	}
+
+	// No repositories is an empty list, not null
+	mockStorage.repositories = nil
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, httptest.NewRequest("GET", "/api/repositories", nil))
+
+	if body := strings.TrimSpace(w.Body.String()); body != "[]" {
+		t.Errorf("Expected empty JSON list, got %s", body)
+	}
+}
+
+// TestRenderError tests the renderError method
+func TestRenderError(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	w := httptest.NewRecorder()
+
+	server.renderError(w, httptest.NewRequest("GET", "/", nil), "Test Error", "This is a test error message", http.StatusBadRequest)
+
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	expectedContent := "Error: Test Error - This is a test error message"
+	if !strings.Contains(string(body), expectedContent) {
+		t.Errorf("Expected body to contain '%s', got '%s'", expectedContent, string(body))
+	}
+}
+
+// TestHandleCompareAheadBehind tests the ahead/behind indicator of the compare page
+func TestHandleCompareAheadBehind(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "compare.html", `{{if .Unrelated}}unrelated{{else if .AheadBehind}}{{.AheadBehind.Ahead}} ahead, {{.AheadBehind.Behind}} behind{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	writeFile(t, repoDir, "main.txt", "main\n")
+	runGit(t, repoDir, "add", "main.txt")
+	runGit(t, repoDir, "commit", "-m", "Main change")
+	runGit(t, repoDir, "checkout", "--orphan", "unrelated")
+	runGit(t, repoDir, "commit", "-m", "Unrelated root")
+	runGit(t, repoDir, "checkout", "main")
+	mockStorage.repositories = []string{repoDir}
+
+	tests := map[string]string{
+		"feature":   "1 ahead, 1 behind",
+		"unrelated": "unrelated",
+	}
+
+	for source, expected := range tests {
+		req := httptest.NewRequest("GET", "/compare?repo="+url.QueryEscape(repoDir)+"&source="+source+"&target=main", nil)
+		w := httptest.NewRecorder()
+		server.handleCompare(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status code %d, got %d: %s", source, http.StatusOK, w.Code, w.Body.String())
+		}
+		if body := w.Body.String(); !strings.Contains(body, expected) {
+			t.Errorf("%s: expected %q, got %s", source, expected, body)
+		}
+	}
+}
+
+// TestHandleCompareShallowClone tests that the compare page of a shallow clone
+// suggests fetching the history the branches share instead of calling them
+// unrelated
+func TestHandleCompareShallowClone(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "compare.html", `{{if .Unrelated}}unrelated{{else if .ShallowHistory}}shallow{{else if .AheadBehind}}{{.AheadBehind.Ahead}} ahead{{end}}`)
+
+	originDir := setupGitRepo(t)
+	writeFile(t, originDir, "main.txt", "main\n")
+	runGit(t, originDir, "add", "main.txt")
+	runGit(t, originDir, "commit", "-m", "Main change")
+
+	repoDir := t.TempDir()
+	runGit(t, originDir, "clone", "--quiet", "--depth", "1", "--no-single-branch", "file://"+originDir, repoDir)
+	runGit(t, repoDir, "branch", "feature", "origin/feature")
+	mockStorage.repositories = []string{repoDir}
+
+	req := httptest.NewRequest("GET", "/compare?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main", nil)
+	w := httptest.NewRecorder()
+	server.handleCompare(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "shallow") {
+		t.Errorf("Expected the shallow clone notice, got %s", body)
+	}
+}
+
+// TestDirtyWorkingTreeNotice tests that the compare and diff pages point out
+// uncommitted changes, which the diff doesn't include
+func TestDirtyWorkingTreeNotice(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "compare.html", `{{if .DirtyWorkingTree}}dirty{{else}}clean{{end}}`)
+	overrideTemplate(t, server, "diff.html", `{{if .DirtyWorkingTree}}dirty{{else}}clean{{end}}`)
+
+	now := time.Now()
+	server.dirtyWorkingTrees.now = func() time.Time { return now }
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	get := func(handler http.HandlerFunc, target string) string {
+		req := httptest.NewRequest("GET", target+"?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main", nil)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d for %s, got %d: %s", http.StatusOK, target, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	if body := get(server.handleCompare, "/compare"); !strings.Contains(body, "clean") {
+		t.Errorf("Expected no notice for a clean working tree, got %s", body)
+	}
+
+	// The notice shows once the cached clean state expires
+	writeFile(t, repoDir, "test.txt", "uncommitted\n")
+	now = now.Add(dirtyWorkingTreeTTL)
+	for _, page := range []struct {
+		handler http.HandlerFunc
+		target  string
+	}{
+		{server.handleCompare, "/compare"},
+		{server.handleDiffView, "/diff"},
+	} {
+		if body := get(page.handler, page.target); !strings.Contains(body, "dirty") {
+			t.Errorf("Expected the dirty working tree notice on %s, got %s", page.target, body)
+		}
+	}
+}
+
+// TestHandleCompareLatestCommit tests reviewing only the tip commit of the source branch
+func TestHandleCompareLatestCommit(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	compare := func(source string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Set("repo", repoDir)
+		form.Set("source", source)
+		form.Set("target", "main")
+		form.Set("latest_commit", "1")
+
+		req := httptest.NewRequest("POST", "/compare", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.handleCompare(w, req)
+		return w
+	}
+
+	tests := []struct {
+		source         string
+		expectedTarget string
+		expectedCommit string
+	}{
+		{source: "feature", expectedTarget: "feature^", expectedCommit: runGit(t, repoDir, "rev-parse", "feature^")},
+		// The root commit has no parent, so it's compared against the empty tree
+		{source: "main", expectedTarget: git.EmptyTreeHash, expectedCommit: git.EmptyTreeHash},
+	}
+
+	for _, tt := range tests {
+		w := compare(tt.source)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("%s: expected status code %d, got %d: %s", tt.source, http.StatusSeeOther, w.Code, w.Body.String())
+		}
+
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("Failed to parse redirect location: %v", err)
+		}
+		query := location.Query()
+
+		if got := query.Get("source_commit"); got != runGit(t, repoDir, "rev-parse", tt.source) {
+			t.Errorf("%s: expected source commit to be the branch tip, got %s", tt.source, got)
+		}
+		if got := query.Get("target"); got != tt.expectedTarget {
+			t.Errorf("%s: expected target %s, got %s", tt.source, tt.expectedTarget, got)
+		}
+		if got := query.Get("target_commit"); got != tt.expectedCommit {
+			t.Errorf("%s: expected target commit %s, got %s", tt.source, tt.expectedCommit, got)
+		}
+	}
+}
+
+// TestHandleCompareLatestRootCommit tests reviewing the latest commit of a
+// repository with a single commit, from the compare form to a saved review
+func TestHandleCompareLatestRootCommit(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `[{{.TargetCommit}}#{{range .Files}}{{.Path}};{{end}}]`)
+
+	repoDir := t.TempDir()
+	runGit(t, repoDir, "init", "-b", "main")
+	writeFile(t, repoDir, "root.txt", "first\n")
+	runGit(t, repoDir, "add", "root.txt")
+	runGit(t, repoDir, "commit", "-m", "Root commit")
+	mockStorage.repositories = []string{repoDir}
+
+	form := url.Values{"repo": {repoDir}, "source": {"main"}, "target": {"main"}, "latest_commit": {"1"}}
+	req := httptest.NewRequest("POST", "/compare", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, httptest.NewRequest("GET", location, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d for %s, got %d: %s", http.StatusOK, location, w.Code, w.Body.String())
+	}
+	if expected := "[" + git.EmptyTreeHash + "#root.txt;]"; !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("Expected the root commit diffed against the empty tree, got %s", w.Body.String())
+	}
+
+	// Its files can be reviewed
+	redirect, err := url.Parse(location)
+	if err != nil {
+		t.Fatalf("Failed to parse redirect location: %v", err)
+	}
+	query := redirect.Query()
+	query.Set("file", "root.txt")
+	query.Set("status", models.StateApproved)
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), nil))
+	if w.Code != http.StatusOK && w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected the review saved, got %d: %s", w.Code, w.Body.String())
+	}
+	if status, _ := mockStorage.reviewState.FileStatus(repoDir, "root.txt"); status != models.StateApproved {
+		t.Errorf("Expected root.txt approved, got %q", status)
+	}
+}
+
+// TestHandleCompareReflog tests that earlier states of the source branch are
+// offered as targets and that reflog revisions resolve, or fail as not found
+func TestHandleCompareReflog(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "compare.html", `{{range .Reflog}}{{.Ref}}={{.Commit}};{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+	earlier := runGit(t, repoDir, "rev-parse", "feature@{1}")
+
+	req := httptest.NewRequest("GET", "/compare?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main", nil)
+	w := httptest.NewRecorder()
+	server.handleCompare(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "feature@{1}="+earlier+";") {
+		t.Errorf("Expected feature@{1} to be offered, got %s", body)
+	}
+
+	compare := func(target string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Set("repo", repoDir)
+		form.Set("source", "feature")
+		form.Set("target", target)
+
+		req := httptest.NewRequest("POST", "/compare", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.handleCompare(w, req)
+		return w
+	}
+
+	w = compare("feature@{1}")
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to parse redirect location: %v", err)
+	}
+	if got := location.Query().Get("target_commit"); got != earlier {
+		t.Errorf("Expected target commit %s, got %s", earlier, got)
+	}
+
+	w = compare("feature@{42}")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status code %d for a missing reflog entry, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "reflog") {
+		t.Errorf("Expected the error to mention the reflog, got %s", body)
+	}
+}
+
+// TestBranchNamesRoundTrip tests that branch names with slashes and dots survive
+// the compare form, the diff view links and the git commands behind them
+func TestBranchNamesRoundTrip(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `<a href="/diff?source={{.SourceBranch}}&target={{.TargetBranch}}">{{range .Files}}{{.Path}};{{end}}</a>`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "branch", "topic/foo-bar", "feature")
+	runGit(t, repoDir, "branch", "release-1.2", "main")
+	mockStorage.repositories = []string{repoDir}
+
+	form := url.Values{}
+	form.Set("repo", repoDir)
+	form.Set("source", "topic/foo-bar")
+	form.Set("target", "release-1.2")
+
+	req := httptest.NewRequest("POST", "/compare", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.handleCompare(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to parse redirect location: %v", err)
+	}
+	query := location.Query()
+	if query.Get("source") != "topic/foo-bar" || query.Get("target") != "release-1.2" {
+		t.Errorf("Expected the branch names to round-trip, got %s and %s", query.Get("source"), query.Get("target"))
+	}
+	if query.Get("source_commit") != runGit(t, repoDir, "rev-parse", "feature") {
+		t.Errorf("Unexpected source commit %s", query.Get("source_commit"))
+	}
+
+	req = httptest.NewRequest("GET", location.String(), nil)
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "test.txt;") {
+		t.Errorf("Expected the diff to list test.txt, got %s", body)
+	}
+
+	match := regexp.MustCompile(`<a href="([^"]*)"`).FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("Expected a diff view link, got %s", body)
+	}
+	href := match[1]
+	link, err := url.Parse(html.UnescapeString(href))
+	if err != nil {
+		t.Fatalf("Failed to parse link %s: %v", href, err)
+	}
+	if link.Query().Get("source") != "topic/foo-bar" || link.Query().Get("target") != "release-1.2" {
+		t.Errorf("Expected the diff view links to carry the branch names, got %s", href)
+	}
+}
+
+// setupGitRepo creates a temporary git repository with a main branch and a
+// feature branch that modifies test.txt
+func setupGitRepo(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not available, skipping test")
+	}
+
+	repoDir := t.TempDir()
+
+	runGit(t, repoDir, "init", "-b", "main")
+	runGit(t, repoDir, "config", "--local", "commit.gpgsign", "false")
+	runGit(t, repoDir, "config", "--local", "user.name", "diffty")
+	runGit(t, repoDir, "config", "--local", "user.email", "diffty@example.com")
+
+	writeFile(t, repoDir, "test.txt", "initial content\n")
+	runGit(t, repoDir, "add", "test.txt")
+	runGit(t, repoDir, "commit", "-m", "Initial commit")
+
+	runGit(t, repoDir, "checkout", "-b", "feature")
+	writeFile(t, repoDir, "test.txt", "initial content\nnew line\n")
+	runGit(t, repoDir, "commit", "-am", "Add new line")
+	runGit(t, repoDir, "checkout", "main")
+
+	return repoDir
+}
+
+// runGit runs a git command in the given repository, failing the test on error
+func runGit(t *testing.T, repoDir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// writeFile writes a file relative to the repository root, creating parent directories
+func writeFile(t *testing.T, repoDir, name, content string) {
+	t.Helper()
+
+	path := filepath.Join(repoDir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory for %s: %v", name, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
+
+// overrideTemplate replaces a named template of the server, so tests can render
+// exactly the data they want to assert on
+func overrideTemplate(t *testing.T, server *Server, name, body string) {
+	t.Helper()
+
+	if _, err := server.tmpl.New(name).Parse(body); err != nil {
+		t.Fatalf("Failed to override template %s: %v", name, err)
+	}
+}
+
+// TestGetRepositoryPage tests that large repository lists are served a page at a time
+func TestGetRepositoryPage(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	// Stored out of order, with the paths sorting differently from insertion
+	mockStorage.repositories = nil
+	for i := 120; i >= 1; i-- {
+		mockStorage.repositories = append(mockStorage.repositories, fmt.Sprintf("/repos/repo-%03d", i))
+	}
+
+	tests := []struct {
+		page          int
+		expectedFirst string
+		expectedLen   int
+	}{
+		{page: 1, expectedFirst: "/repos/repo-001", expectedLen: 50},
+		{page: 2, expectedFirst: "/repos/repo-051", expectedLen: 50},
+		{page: 3, expectedFirst: "/repos/repo-101", expectedLen: 20},
+		// Out of range pages are clamped
+		{page: 0, expectedFirst: "/repos/repo-001", expectedLen: 50},
+		{page: 99, expectedFirst: "/repos/repo-101", expectedLen: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("page %d", tt.page), func(t *testing.T) {
+			repos, total, err := server.GetRepositoryPage(tt.page, 50)
+			if err != nil {
+				t.Fatalf("GetRepositoryPage failed: %v", err)
+			}
+			if total != 120 {
+				t.Errorf("Expected 120 repositories in total, got %d", total)
+			}
+			if len(repos) != tt.expectedLen {
+				t.Fatalf("Expected %d repositories, got %d", tt.expectedLen, len(repos))
+			}
+			if repos[0].Path != tt.expectedFirst {
+				t.Errorf("Expected the page to start at %s, got %s", tt.expectedFirst, repos[0].Path)
+			}
+		})
+	}
+
+	// The stored order is left alone
+	if mockStorage.repositories[0] != "/repos/repo-120" {
+		t.Errorf("Expected the stored list not to be reordered, got %s first", mockStorage.repositories[0])
+	}
+
+	// The index renders the requested page with links to its neighbours
+	overrideTemplate(t, server, "index.html", `{{define "index.html"}}{{range $i, $repo := .Repositories}}{{if eq $i 0}}{{$repo.Path}}{{end}}{{end}} {{.Page}}/{{.Pages}} prev={{.PrevPage}} next={{.NextPage}}{{end}}`)
+
+	w := httptest.NewRecorder()
+	server.handleIndex(w, httptest.NewRequest("GET", "/?page=2", nil))
+	if body := w.Body.String(); !strings.Contains(body, "/repos/repo-051 2/3 prev=1 next=3") {
+		t.Errorf("Unexpected index page: %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleIndex(w, httptest.NewRequest("GET", "/?page=nope", nil))
+	if body := w.Body.String(); !strings.Contains(body, "/repos/repo-001 1/3 prev= next=2") {
+		t.Errorf("Expected an invalid page to show the first one, got: %s", body)
+	}
+}
+
+// TestHandleReviewStateHunks tests reviewing the hunks of a multi-hunk file one at a time
+func TestHandleReviewStateHunks(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .DiffLines}}{{if .HunkStatus}}[{{.Hunk}}={{.HunkStatus}}]{{end}}{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	lines := make([]string, 30)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	writeFile(t, repoDir, "multi.txt", strings.Join(lines, "\n")+"\n")
+	runGit(t, repoDir, "add", "multi.txt")
+	runGit(t, repoDir, "commit", "-m", "Add multi-hunk file")
+
+	runGit(t, repoDir, "checkout", "feature")
+	runGit(t, repoDir, "merge", "main")
+	lines[1] = "changed near the top"
+	lines[27] = "changed near the bottom"
+	writeFile(t, repoDir, "multi.txt", strings.Join(lines, "\n")+"\n")
+	runGit(t, repoDir, "commit", "-am", "Change both ends")
+	runGit(t, repoDir, "checkout", "main")
+
+	mockStorage.repositories = []string{repoDir}
+	mockStorage.reviewState = nil
+
+	sourceCommit := strings.TrimSpace(runGit(t, repoDir, "rev-parse", "feature"))
+	targetCommit := strings.TrimSpace(runGit(t, repoDir, "rev-parse", "main"))
+	hunks := []string{"-1,5 +1,5", "-25,6 +25,6"}
+
+	review := func(hunk, status string) *httptest.ResponseRecorder {
+		t.Helper()
+		query := url.Values{
+			"repo":          {repoDir},
+			"source":        {"feature"},
+			"target":        {"main"},
+			"source_commit": {sourceCommit},
+			"target_commit": {targetCommit},
+			"file":          {"multi.txt"},
+			"status":        {status},
+			"hunk":          {hunk},
+			"next":          {"test.txt"},
+		}
+		req := httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		server.handleReviewState(w, req)
+		return w
+	}
+
+	render := func() string {
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&file=multi.txt", nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		return w.Body.String()
+	}
+
+	if body := render(); !strings.Contains(body, "[-1,5 &#43;1,5=unreviewed][-25,6 &#43;25,6=unreviewed]") {
+		t.Fatalf("Expected both hunks to be reviewable, got %s", body)
+	}
+
+	// Approving the first hunk leaves the file pending and stays on it
+	w := review(hunks[0], models.StateApproved)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp reviewStateResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Hunk != hunks[0] || resp.Status != models.StateApproved || resp.FileStatus != "unreviewed" || resp.NextFile != "" {
+		t.Errorf("Unexpected response after the first hunk: %+v", resp)
+	}
+
+	// Rejecting the second hunk rejects the file and moves on
+	w = review(hunks[1], models.StateRejected)
+	resp = reviewStateResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.FileStatus != models.StateRejected || resp.NextFile != "test.txt" {
+		t.Errorf("Unexpected response after the second hunk: %+v", resp)
+	}
+
+	file, ok := mockStorage.reviewState.File(repoDir, "multi.txt")
+	if !ok {
+		t.Fatal("Expected multi.txt to be reviewed")
+	}
+	if file.Lines[hunks[0]] != models.StateApproved || file.Lines[hunks[1]] != models.StateRejected || len(file.Lines) != 2 {
+		t.Errorf("Expected a status per hunk, got %v", file.Lines)
+	}
+	if !reflect.DeepEqual(file.Hunks, hunks) {
+		t.Errorf("Expected the hunks to be recorded, got %v", file.Hunks)
+	}
+	if body := render(); !strings.Contains(body, "[-1,5 &#43;1,5=approved][-25,6 &#43;25,6=rejected]") {
+		t.Errorf("Expected the hunk statuses in the file view, got %s", body)
+	}
+
+	// Hunks of another diff are refused
+	if w := review("-2,3 +2,3", models.StateApproved); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unknown hunk, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestStashReviewKeyedOnBase tests that a stash's review is stored against the
+// commit the stash was created on, so it's found whichever target it's
+// compared against
+func TestStashReviewKeyedOnBase(t *testing.T) {
+	store, err := storage.OpenStorage(storage.DefaultBackend, storage.Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	server, err := New(store)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	overrideTemplate(t, server, "diff.html", `[{{range .Files}}{{.Path}}={{.Status}};{{end}}]`)
+
+	repoDir := setupGitRepo(t)
+	if err := store.SaveRepositories([]string{repoDir}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+	base := runGit(t, repoDir, "rev-parse", "HEAD")
+	writeFile(t, repoDir, "test.txt", "initial content\nstashed\n")
+	runGit(t, repoDir, "stash", "push", "-m", "work in progress")
+
+	compare := func(target string) *url.URL {
+		t.Helper()
+		form := url.Values{"repo": {repoDir}, "source": {"stash@{0}"}, "target": {target}}
+		req := httptest.NewRequest("POST", "/compare", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+		}
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("Failed to parse redirect location: %v", err)
+		}
+		if got := location.Query().Get("target_commit"); got != base {
+			t.Errorf("Expected the stash against %s to be stored against its base %s, got %s", target, base, got)
+		}
+		return location
+	}
+
+	query := compare("main").Query()
+	query.Set("file", "test.txt")
+	query.Set("status", models.StateApproved)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), nil))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected the review saved, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The review is found against another target, which the diff doesn't depend on
+	compare("feature")
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=stash@{0}&target=feature", nil))
+	if body := w.Body.String(); !strings.Contains(body, "[test.txt=approved;]") {
+		t.Errorf("Expected the stash's review against feature too, got %s", body)
 	}
 }
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/models"
+)
+
+// squashMessage assembles the default message of a squash commit from the
+// subjects of the squashed commits, oldest first. A single commit keeps its
+// subject; several are titled after the first and listed in the body, the way
+// git hosts prefill squash merges.
+func squashMessage(subjects []string) string {
+	switch len(subjects) {
+	case 0:
+		return ""
+	case 1:
+		return subjects[0]
+	}
+
+	var b strings.Builder
+	b.WriteString(subjects[0])
+	b.WriteString("\n")
+	for _, subject := range subjects {
+		b.WriteString("\n* ")
+		b.WriteString(subject)
+	}
+	return b.String()
+}
+
+// maxSquashMessageLength is the most characters an edited squash message can have
+const maxSquashMessageLength = 10000
+
+// squashMessageResponse describes a comparison's saved squash message
+type squashMessageResponse struct {
+	SquashMessage string `json:"squash_message"`
+	Redirect      string `json:"redirect"`
+}
+
+// proposedSquashMessage assembles the squash commit message of the compared
+// refs and returns it with the number of squashed commits. Stashes aren't
+// merged, and failing to list the commits only leaves the proposal out.
+func proposedSquashMessage(repo *git.Repository, sourceBranch, source, target string) (string, int) {
+	if git.IsStashRef(sourceBranch) {
+		return "", 0
+	}
+
+	subjects, err := repo.GetCommitSubjects(source, target)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return "", 0
+	}
+	return squashMessage(subjects), len(subjects)
+}
+
+// setSquashMessage sets the squash commit message the diff view shows next to
+// the combined diff: the one saved with the review state if it was edited,
+// and the proposed one otherwise
+func (s *Server) setSquashMessage(data map[string]interface{}, repo *git.Repository, reviewState *models.ReviewState, sourceBranch, source, target string) {
+	proposed, commits := proposedSquashMessage(repo, sourceBranch, source, target)
+	if proposed == "" {
+		return
+	}
+	data["SquashMessage"] = proposed
+	data["SquashCommits"] = commits
+	if reviewState.SquashMessage != "" {
+		data["SquashMessage"] = reviewState.SquashMessage
+		data["SquashEdited"] = true
+	}
+}
+
+// handleSquashMessage saves an edited squash commit message with the
+// comparison's review state, so it's kept across browsers and included in the
+// report. An empty message, or the reset parameter, goes back to the proposed one.
+func (s *Server) handleSquashMessage(w http.ResponseWriter, r *http.Request) {
+	c := comparisonFromRequest(r)
+	if !c.complete() {
+		s.respondError(w, r, "Missing Parameters", "Missing required parameters for editing the squash message", http.StatusBadRequest)
+		return
+	}
+
+	message := strings.TrimSpace(strings.ReplaceAll(r.FormValue("message"), "\r\n", "\n"))
+	if r.FormValue("reset") != "" {
+		message = ""
+	}
+	if n := utf8.RuneCountInString(message); n > maxSquashMessageLength {
+		s.respondError(w, r, "Squash Message Too Long", fmt.Sprintf("The squash message has %d characters, the limit is %d", n, maxSquashMessageLength), http.StatusBadRequest)
+		return
+	}
+
+	redirectPath, ok := s.updateReviewState(w, r, c, func(state *models.ReviewState) {
+		state.SquashMessage = message
+	})
+	if !ok {
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, squashMessageResponse{SquashMessage: message, Redirect: redirectPath})
+		return
+	}
+
+	http.Redirect(w, r, redirectPath, http.StatusSeeOther)
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSquashMessage(t *testing.T) {
+	tests := []struct {
+		subjects []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"Add parser"}, "Add parser"},
+		{
+			[]string{"Add parser", "Fix typo", "Handle empty input"},
+			"Add parser\n\n* Add parser\n* Fix typo\n* Handle empty input",
+		},
+	}
+
+	for _, tt := range tests {
+		if message := squashMessage(tt.subjects); message != tt.expected {
+			t.Errorf("squashMessage(%q) = %q; expected %q", tt.subjects, message, tt.expected)
+		}
+	}
+}
+
+func TestHandleDiffViewSquashMessage(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{if .SquashMessage}}{{.SquashCommits}}: {{.SquashMessage}}{{else}}none{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "second.txt", "second\n")
+	runGit(t, repoDir, "add", "second.txt")
+	runGit(t, repoDir, "commit", "-m", "Add second file")
+	runGit(t, repoDir, "checkout", "main")
+	mockStorage.repositories = []string{repoDir}
+
+	get := func(params string) string {
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+params, nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	body := get("&source=feature&target=main")
+	if !strings.Contains(body, "2: Add new line\n\n* Add new line\n* Add second file") {
+		t.Errorf("Expected the squash message of both commits, got %s", body)
+	}
+
+	// Nothing to squash the other way around
+	if body := get("&source=main&target=feature"); !strings.Contains(body, "none") {
+		t.Errorf("Expected no squash message without commits, got %s", body)
+	}
+}
+
+// TestHandleSquashMessage tests that an edited squash message is kept with the
+// review state, shown in the diff view and included in the report
+func TestHandleSquashMessage(t *testing.T) {
+	server, query := setupReportTest(t)
+	overrideTemplate(t, server, "diff.html", `[{{.SquashMessage}}|{{if .SquashEdited}}edited{{end}}]`)
+
+	post := func(form url.Values) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/review-state/squash-message?"+query.Encode(), strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != http.StatusSeeOther || !strings.HasPrefix(w.Header().Get("Location"), "/diff?") {
+			t.Fatalf("Expected a redirect to the diff view, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	diffView := func() string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest("GET", "/diff?"+query.Encode(), nil))
+		return w.Body.String()
+	}
+
+	// The proposed message is shown and reported until it's edited
+	if body := diffView(); !strings.Contains(body, "[Add new line|]") {
+		t.Errorf("Expected the proposed message, got %s", body)
+	}
+	if body := getReport(t, server, query).Body.String(); !strings.Contains(body, "<code>Add new line</code>") {
+		t.Errorf("Expected the proposed message in the report, got %s", body)
+	}
+
+	post(url.Values{"message": {"Add a line\r\n\r\nCloses #12\n"}})
+	if body := diffView(); !strings.Contains(body, "[Add a line\n\nCloses #12|edited]") {
+		t.Errorf("Expected the edited message, got %s", body)
+	}
+	if body := getReport(t, server, query).Body.String(); !strings.Contains(body, "<code>Add a line\n\nCloses #12</code>") {
+		t.Errorf("Expected the edited message in the report, got %s", body)
+	}
+
+	// Resetting goes back to the proposed message
+	post(url.Values{"message": {"Add a line"}, "reset": {"1"}})
+	if body := diffView(); !strings.Contains(body, "[Add new line|]") {
+		t.Errorf("Expected the proposed message after a reset, got %s", body)
+	}
+
+	form := url.Values{"message": {strings.Repeat("x", maxSquashMessageLength+1)}}
+	req := httptest.NewRequest("POST", "/api/review-state/squash-message?"+query.Encode(), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a message over the limit, got %d", http.StatusBadRequest, w.Code)
+	}
+}
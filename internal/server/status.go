@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// ReviewStatus is the stored review of a comparison at its current branch
+// tips, as the status command reports it
+type ReviewStatus struct {
+	Repo         string       `json:"repo"`
+	User         string       `json:"user,omitempty"`
+	SourceBranch string       `json:"source"`
+	TargetBranch string       `json:"target"`
+	SourceCommit string       `json:"source_commit"`
+	TargetCommit string       `json:"target_commit"`
+	Files        []FileStatus `json:"files"`
+	Approved     int          `json:"approved"`
+	Rejected     int          `json:"rejected"`
+	Skipped      int          `json:"skipped"`
+	NeedsReview  int          `json:"needs_review"`
+	Mixed        int          `json:"mixed"`
+	Unreviewed   int          `json:"unreviewed"`
+	// Completed reports whether the review was signed off
+	Completed bool `json:"completed"`
+	// Description is the reviewer's note on the whole review
+	Description string `json:"description,omitempty"`
+}
+
+// FileStatus is the review status of a changed file, one of the models states
+type FileStatus struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+// ReviewStatus loads the review of the user comparing sourceBranch against
+// targetBranch in a registered repository, at the commits the branches
+// currently point at. Reviews recorded against earlier commits don't count,
+// as the files they approved may have changed since.
+func (s *Server) ReviewStatus(repoPath, user, sourceBranch, targetBranch string) (ReviewStatus, error) {
+	repo, exists, err := s.GetRepository(repoPath)
+	if err != nil {
+		return ReviewStatus{}, err
+	}
+	if !exists {
+		return ReviewStatus{}, fmt.Errorf("repository not found: %s, add it to diffty first", repoPath)
+	}
+
+	c := comparison{RepoPath: repoPath, User: user, SourceBranch: sourceBranch, TargetBranch: targetBranch}
+	if c.SourceCommit, err = repo.GetBranchCommitHash(sourceBranch); err != nil {
+		return ReviewStatus{}, err
+	}
+	if c.TargetCommit, err = targetCommitOf(repo, sourceBranch, c.SourceCommit, targetBranch); err != nil {
+		return ReviewStatus{}, err
+	}
+
+	paths, statuses, err := s.loadReviewFiles(c)
+	if err != nil {
+		return ReviewStatus{}, err
+	}
+
+	reviewState, err := s.storage.LoadReviewState(repoPath, user, sourceBranch, targetBranch, c.SourceCommit, c.TargetCommit)
+	if err != nil {
+		return ReviewStatus{}, fmt.Errorf("failed to load review state: %w", err)
+	}
+
+	progress := s.countProgress(paths, statuses)
+	status := ReviewStatus{
+		Repo:         repoPath,
+		User:         user,
+		SourceBranch: sourceBranch,
+		TargetBranch: targetBranch,
+		SourceCommit: c.SourceCommit,
+		TargetCommit: c.TargetCommit,
+		Files:        make([]FileStatus, 0, len(paths)),
+		Approved:     progress.Approved,
+		Rejected:     progress.Rejected,
+		Skipped:      progress.Skipped,
+		NeedsReview:  progress.NeedsReview,
+		Mixed:        progress.Mixed,
+		Unreviewed:   progress.Unreviewed,
+		Completed:    reviewState.IsCompleted(),
+		Description:  reviewState.Description,
+	}
+	for _, path := range paths {
+		fileStatus := statuses[path]
+		if fileStatus == "" {
+			fileStatus = models.StateUnreviewed
+		}
+		status.Files = append(status.Files, FileStatus{Path: path, Status: fileStatus})
+	}
+
+	return status, nil
+}
+
+// FilesWithStatus returns the files whose status is one of statuses, such as
+// the rejected and unreviewed files failing a CI gate
+func (st ReviewStatus) FilesWithStatus(statuses ...string) []FileStatus {
+	files := []FileStatus{}
+	for _, file := range st.Files {
+		if indexOf(statuses, file.Status) != -1 {
+			files = append(files, file)
+		}
+	}
+	return files
+}
@@ -0,0 +1,12 @@
+package server
+
+import "github.com/darccio/diffty/internal/models"
+
+// WithStatusMeta changes the label and color a review status is shown with,
+// for localized or team-specific names. Only the presentation changes: review
+// states keep storing the status values. Empty fields keep the default.
+func WithStatusMeta(status string, meta models.StatusMeta) Option {
+	return func(s *Server) {
+		s.statusMetas.Set(status, meta)
+	}
+}
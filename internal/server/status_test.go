@@ -0,0 +1,51 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// TestReviewStatus tests that the review status lists every changed file with
+// its status and counts them
+func TestReviewStatus(t *testing.T) {
+	server, _, query := setupReviewAPITest(t)
+	repoDir := query.Get("repo")
+
+	if code, _ := doReviewAPI(t, server, "POST", "/api/review/approve", query, "a.txt"); code != 200 {
+		t.Fatalf("Expected a.txt to be approved, got %d", code)
+	}
+	if code, _ := doReviewAPI(t, server, "POST", "/api/review/reject", query, "b.txt"); code != 200 {
+		t.Fatalf("Expected b.txt to be rejected, got %d", code)
+	}
+
+	status, err := server.ReviewStatus(repoDir, "", "feature", "main")
+	if err != nil {
+		t.Fatalf("ReviewStatus failed: %v", err)
+	}
+	if status.SourceCommit != query.Get("source_commit") || status.TargetCommit != query.Get("target_commit") {
+		t.Errorf("Expected the branch tips, got %s and %s", status.SourceCommit, status.TargetCommit)
+	}
+
+	expected := map[string]string{"a.txt": models.StateApproved, "b.txt": models.StateRejected, "test.txt": models.StateUnreviewed}
+	if len(status.Files) != len(expected) {
+		t.Fatalf("Expected %d files, got %+v", len(expected), status.Files)
+	}
+	for _, file := range status.Files {
+		if expected[file.Path] != file.Status {
+			t.Errorf("Expected %s to be %s, got %s", file.Path, expected[file.Path], file.Status)
+		}
+	}
+	if status.Approved != 1 || status.Rejected != 1 || status.Unreviewed != 1 {
+		t.Errorf("Unexpected counts: %+v", status)
+	}
+
+	failing := status.FilesWithStatus(models.StateRejected, models.StateUnreviewed)
+	if len(failing) != 2 {
+		t.Errorf("Expected the rejected and the unreviewed file, got %+v", failing)
+	}
+
+	if _, err := server.ReviewStatus(t.TempDir(), "", "feature", "main"); err == nil {
+		t.Error("Expected an unregistered repository to be refused")
+	}
+}
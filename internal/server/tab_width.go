@@ -0,0 +1,51 @@
+package server
+
+import "strings"
+
+// maxTabWidth is the widest tab the tabwidth view option expands to
+const maxTabWidth = 16
+
+// tabWidths lists the tab widths offered by the diff view
+var tabWidths = []int{2, 4, 8}
+
+// expandTabs replaces the tabs of the lines' content by spaces up to the next
+// multiple of width, so code mixing tabs and spaces lines up as it does in an
+// editor set to that width. Tab stops are counted from the start of the
+// content, after the +/-/space prefix column (one per parent in a combined
+// diff). Only the displayed text changes; headers are left alone, and a width
+// of zero or less leaves the lines unchanged.
+func expandTabs(lines []diffLine, width int) {
+	if width <= 0 {
+		return
+	}
+
+	prefix := 1
+	for i, line := range lines {
+		switch line.Kind {
+		case lineKindHunk:
+			prefix = len(line.Text) - len(strings.TrimLeft(line.Text, "@")) - 1
+		case lineKindAdded, lineKindRemoved, lineKindContext:
+			if len(line.Text) > prefix && strings.Contains(line.Text[prefix:], "\t") {
+				lines[i].Text = line.Text[:prefix] + expandTabStops(line.Text[prefix:], width)
+			}
+		}
+	}
+}
+
+// expandTabStops replaces each tab of s with the spaces up to the next
+// multiple of width, counting columns in runes
+func expandTabStops(s string, width int) string {
+	var b strings.Builder
+	column := 0
+	for _, r := range s {
+		if r == '\t' {
+			spaces := width - column%width
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		b.WriteRune(r)
+		column++
+	}
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExpandTabs(t *testing.T) {
+	lines := parseDiffLines("main.go", []string{
+		"diff --git a/main.go b/main.go",
+		"--- a/main.go",
+		"+++ b/main.go",
+		"@@ -1,4 +1,4 @@ func\tmain() {",
+		" \tx := 1",
+		"-  \ty := 2\t// two",
+		"+    y := 22\t// twenty-two",
+		"+\t\tz\t:= 3",
+		"\\ No newline at end of file",
+	})
+
+	expandTabs(lines, 4)
+
+	expected := []string{
+		"diff --git a/main.go b/main.go",
+		"--- a/main.go",
+		"+++ b/main.go",
+		// Hunk headers are left alone
+		"@@ -1,4 +1,4 @@ func\tmain() {",
+		"     x := 1",
+		// A tab after two spaces only reaches the next tab stop
+		"-    y := 2  // two",
+		// Spaces and tabs indenting to the same column line up
+		"+    y := 22 // twenty-two",
+		"+        z   := 3",
+		"\\ No newline at end of file",
+	}
+	for i, want := range expected {
+		if lines[i].Text != want {
+			t.Errorf("Line %d: expected %q, got %q", i, want, lines[i].Text)
+		}
+	}
+}
+
+// TestExpandTabsCombined tests that tab stops of a combined diff are counted
+// after its prefix columns, one per parent
+func TestExpandTabsCombined(t *testing.T) {
+	lines := parseDiffLines("app.txt", []string{
+		"diff --cc app.txt",
+		"@@@ -1,1 -1,1 +1,1 @@@",
+		"++\tmerged",
+		" -\tours",
+	})
+
+	expandTabs(lines, 8)
+
+	if lines[2].Text != "++        merged" || lines[3].Text != " -        ours" {
+		t.Errorf("Expected tabs expanded after the prefix columns, got %q and %q", lines[2].Text, lines[3].Text)
+	}
+}
+
+func TestExpandTabsDisabled(t *testing.T) {
+	lines := parseDiffLines("main.go", []string{"@@ -1 +1 @@", "+\tx"})
+	expandTabs(lines, 0)
+
+	if lines[1].Text != "+\tx" {
+		t.Errorf("Expected tabs kept without a tab width, got %q", lines[1].Text)
+	}
+}
+
+func TestParseViewOptionsTabWidth(t *testing.T) {
+	opts, err := parseViewOptions(url.Values{"tabwidth": {"4"}})
+	if err != nil {
+		t.Fatalf("parseViewOptions failed: %v", err)
+	}
+	if opts.TabWidth != 4 || opts.querySuffix() != "&tabwidth=4" {
+		t.Errorf("Expected tab width 4 to round-trip, got %d and %q", opts.TabWidth, opts.querySuffix())
+	}
+
+	for _, invalid := range []string{"0", "-2", "17", "four"} {
+		if _, err := parseViewOptions(url.Values{"tabwidth": {invalid}}); err == nil {
+			t.Errorf("Expected an error for tab width %q", invalid)
+		}
+	}
+}
+
+// TestHandleDiffViewTabWidth tests that the diff view expands tabs for
+// display only, keeping the option in its links
+func TestHandleDiffViewTabWidth(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .DiffLines}}{{.Text}}|{{end}}{{.ViewQuery}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "tabs.go", "func f() {\n\treturn\n}\n")
+	runGit(t, repoDir, "add", "tabs.go")
+	runGit(t, repoDir, "commit", "-m", "Add tabs")
+	runGit(t, repoDir, "checkout", "main")
+	mockStorage.repositories = []string{repoDir}
+
+	base := "/diff?repo=" + url.QueryEscape(repoDir) + "&source=feature&target=main&file=tabs.go"
+	get := func(target string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	if body := get(base + "&tabwidth=2"); !strings.Contains(body, "|&#43;  return|") || !strings.Contains(body, "&amp;tabwidth=2") {
+		t.Errorf("Expected the tab expanded to 2 columns and kept in links, got %s", body)
+	}
+	if body := get(base); !strings.Contains(body, "|&#43;\treturn|") {
+		t.Errorf("Expected the tab kept without the option, got %s", body)
+	}
+}
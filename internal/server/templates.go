@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+)
+
+// requiredTemplates are the templates every page, including error pages, is
+// rendered with. The server can't start without them.
+var requiredTemplates = []string{"layout.html", "error.html"}
+
+// parseTemplates parses each template file of fsys on its own, so a syntax
+// error in one of them only breaks the pages rendered with it. The errors of
+// the templates that failed are returned keyed by template name; the returned
+// error is only set when a required template or the file system itself fails.
+func parseTemplates(fsys fs.FS, funcMap template.FuncMap) (*template.Template, map[string]error, error) {
+	files, err := fs.Glob(fsys, "templates/*.html")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no templates found")
+	}
+
+	tmpl := template.New("").Funcs(funcMap)
+	broken := make(map[string]error)
+	for _, file := range files {
+		name := path.Base(file)
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			broken[name] = fmt.Errorf("failed to read template %s: %w", file, err)
+			continue
+		}
+
+		// Parse on its own first, so a broken file leaves the shared set untouched
+		if _, err := template.New(name).Funcs(funcMap).Parse(string(data)); err != nil {
+			broken[name] = fmt.Errorf("failed to parse template %s: %w", file, err)
+			continue
+		}
+
+		if _, err := tmpl.New(name).Parse(string(data)); err != nil {
+			broken[name] = fmt.Errorf("failed to parse template %s: %w", file, err)
+		}
+	}
+
+	for _, name := range requiredTemplates {
+		if err, ok := broken[name]; ok {
+			return nil, nil, err
+		}
+		if tmpl.Lookup(name) == nil {
+			return nil, nil, fmt.Errorf("missing template %s", name)
+		}
+	}
+
+	for _, err := range broken {
+		log.Printf("Warning: %v", err)
+	}
+
+	return tmpl, broken, nil
+}
+
+// renderBrokenTemplate reports that a page can't be shown because its template
+// failed to parse, naming the file and line at fault
+func (s *Server) renderBrokenTemplate(w http.ResponseWriter, r *http.Request, templateName string, err error) {
+	log.Printf("Error rendering content template %s: %v", templateName, err)
+	s.renderError(w, r, "Template Error", err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// templateFS returns a template file system holding the required templates
+// plus the given ones
+func templateFS(templates map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{
+		"templates/layout.html": &fstest.MapFile{Data: []byte(`{{define "layout.html"}}<html>{{.RenderedContent}}</html>{{end}}`)},
+		"templates/error.html":  &fstest.MapFile{Data: []byte(`{{define "error.html"}}Error: {{.Title}} - {{.Message}}{{end}}`)},
+	}
+	for name, body := range templates {
+		fsys["templates/"+name] = &fstest.MapFile{Data: []byte(body)}
+	}
+	return fsys
+}
+
+func TestParseTemplatesReportsBrokenFile(t *testing.T) {
+	fsys := templateFS(map[string]string{
+		"index.html":   `{{define "index.html"}}Index Page{{end}}`,
+		"compare.html": "{{define \"compare.html\"}}\nCompare\n{{if .Repo}}\n{{end}}",
+	})
+
+	tmpl, broken, err := parseTemplates(fsys, template.FuncMap{})
+	if err != nil {
+		t.Fatalf("Expected a broken page template not to fail parsing, got %v", err)
+	}
+
+	brokenErr, ok := broken["compare.html"]
+	if !ok || len(broken) != 1 {
+		t.Fatalf("Expected only compare.html to be broken, got %v", broken)
+	}
+	if message := brokenErr.Error(); !strings.Contains(message, "templates/compare.html") || !strings.Contains(message, "compare.html:4") {
+		t.Errorf("Expected the error to name the file and line, got %q", message)
+	}
+
+	// The other templates still render
+	var out strings.Builder
+	if err := tmpl.ExecuteTemplate(&out, "index.html", nil); err != nil || out.String() != "Index Page" {
+		t.Errorf("Expected index.html to render, got %q (%v)", out.String(), err)
+	}
+}
+
+func TestParseTemplatesRequiresLayoutAndError(t *testing.T) {
+	fsys := templateFS(nil)
+	fsys["templates/layout.html"] = &fstest.MapFile{Data: []byte(`{{define "layout.html"}}{{.RenderedContent}`)}
+
+	if _, _, err := parseTemplates(fsys, template.FuncMap{}); err == nil || !strings.Contains(err.Error(), "layout.html") {
+		t.Errorf("Expected a broken layout to be fatal and named, got %v", err)
+	}
+
+	delete(fsys, "templates/error.html")
+	fsys["templates/layout.html"] = &fstest.MapFile{Data: []byte(`{{define "layout.html"}}{{.RenderedContent}}{{end}}`)}
+	if _, _, err := parseTemplates(fsys, template.FuncMap{}); err == nil || !strings.Contains(err.Error(), "error.html") {
+		t.Errorf("Expected a missing error template to be fatal and named, got %v", err)
+	}
+}
+
+// TestBrokenTemplatePage tests that a page with a broken template shows the
+// parse error while the rest of the server keeps working
+func TestBrokenTemplatePage(t *testing.T) {
+	origFS := getTemplateDir
+	getTemplateDir = func() fs.FS {
+		return templateFS(map[string]string{
+			"index.html":   `{{define "index.html"}}Index Page{{end}}`,
+			"compare.html": `{{define "compare.html"}}{{range .Branches}}{{end}`,
+		})
+	}
+	t.Cleanup(func() {
+		getTemplateDir = origFS
+	})
+
+	server, err := New(&MockStorage{})
+	if err != nil {
+		t.Fatalf("Expected the server to start despite a broken template, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.render(w, httptest.NewRequest("GET", "/compare", nil), "compare.html", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "Template Error") || !strings.Contains(body, "templates/compare.html") {
+		t.Errorf("Expected the page to name the broken template, got %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	server.render(w, httptest.NewRequest("GET", "/", nil), "index.html", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Index Page") {
+		t.Errorf("Expected other pages to keep rendering, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// themeDir holds the bundled themes, one stylesheet per theme named after it
+const themeDir = "static/css/themes"
+
+// defaultTheme is the theme of clients that haven't picked one
+const defaultTheme = "light"
+
+// themeCookie is the cookie the picked theme is kept in
+const themeCookie = "diffty_theme"
+
+// themeCookieMaxAge keeps the picked theme for a year
+const themeCookieMaxAge = 365 * 24 * 60 * 60
+
+// listThemes returns the names of the themes bundled in fsys, sorted. A theme
+// is added by dropping its stylesheet in themeDir; the layout loads it and
+// sets the theme-<name> class on the body for it to style.
+func listThemes(fsys fs.FS) ([]string, error) {
+	files, err := fs.Glob(fsys, themeDir+"/*.css")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list themes: %w", err)
+	}
+
+	themes := make([]string, 0, len(files))
+	for _, file := range files {
+		themes = append(themes, strings.TrimSuffix(path.Base(file), ".css"))
+	}
+	slices.Sort(themes)
+	return themes, nil
+}
+
+// themeFromRequest returns the theme picked by the client, falling back to the
+// default theme when it picked none or one that is no longer bundled
+func (s *Server) themeFromRequest(r *http.Request) string {
+	cookie, err := r.Cookie(themeCookie)
+	if err != nil || !slices.Contains(s.themes, cookie.Value) {
+		return defaultTheme
+	}
+	return cookie.Value
+}
+
+// localReturnURL returns target when it's a path on this server, and "/"
+// otherwise, so the theme form can't redirect off-site
+func localReturnURL(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	return target
+}
+
+// returnURL is the page the theme form sends the client back to: the page it
+// was picked on, or the index when that page came from a form submission
+func returnURL(r *http.Request) string {
+	if r.Method != http.MethodGet {
+		return "/"
+	}
+	return r.URL.RequestURI()
+}
+
+// handleListThemes lists the bundled themes and the one the client picked
+func (s *Server) handleListThemes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"themes":  s.themes,
+		"current": s.themeFromRequest(r),
+	})
+}
+
+// handleSetTheme remembers the picked theme in a cookie and sends the client
+// back to the page it was picked on
+func (s *Server) handleSetTheme(w http.ResponseWriter, r *http.Request) {
+	theme := r.FormValue("theme")
+	if !slices.Contains(s.themes, theme) {
+		s.respondError(w, r, "Unknown Theme", fmt.Sprintf("Unknown theme %q, expected one of %s", theme, strings.Join(s.themes, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     themeCookie,
+		Value:    theme,
+		Path:     s.url("/"),
+		MaxAge:   themeCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]string{"theme": theme})
+		return
+	}
+	http.Redirect(w, r, s.url(localReturnURL(r.FormValue("return"))), http.StatusSeeOther)
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestListThemes(t *testing.T) {
+	themes, err := listThemes(staticDir)
+	if err != nil {
+		t.Fatalf("Failed to list themes: %v", err)
+	}
+	for _, want := range []string{"dark", "high-contrast", defaultTheme} {
+		if !slices.Contains(themes, want) {
+			t.Errorf("Expected bundled theme %q, got %v", want, themes)
+		}
+	}
+
+	// A dropped-in stylesheet is a theme; anything else in the directory isn't
+	fsys := fstest.MapFS{
+		themeDir + "/solarized.css": &fstest.MapFile{Data: []byte("body {}")},
+		themeDir + "/light.css":     &fstest.MapFile{Data: []byte("")},
+		themeDir + "/README.md":     &fstest.MapFile{Data: []byte("notes")},
+	}
+	themes, err = listThemes(fsys)
+	if err != nil {
+		t.Fatalf("Failed to list themes: %v", err)
+	}
+	if want := []string{"light", "solarized"}; !slices.Equal(themes, want) {
+		t.Errorf("Expected themes %v, got %v", want, themes)
+	}
+}
+
+// TestThemeCookieChangesLayout tests that the theme cookie picks the
+// stylesheet and body class of the rendered layout
+func TestThemeCookieChangesLayout(t *testing.T) {
+	server, err := New(&MockStorage{})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		cookie    string
+		wantTheme string
+	}{
+		{name: "no cookie", wantTheme: defaultTheme},
+		{name: "dark", cookie: "dark", wantTheme: "dark"},
+		{name: "high contrast", cookie: "high-contrast", wantTheme: "high-contrast"},
+		{name: "unknown theme", cookie: "../../secrets", wantTheme: defaultTheme},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/compare?repo=%2Frepo", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: themeCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			server.renderError(w, req, "Test Error", "Something broke", http.StatusBadRequest)
+
+			body := w.Body.String()
+			if !strings.Contains(body, `href="/static/css/themes/`+tt.wantTheme+`.css"`) {
+				t.Errorf("Expected the %s stylesheet, got %s", tt.wantTheme, body)
+			}
+			if !strings.Contains(body, `class="theme-`+tt.wantTheme+` `) {
+				t.Errorf("Expected the theme-%s body class, got %s", tt.wantTheme, body)
+			}
+			if !strings.Contains(body, `<option value="`+tt.wantTheme+`" selected>`) {
+				t.Errorf("Expected %s to be selected in the theme picker, got %s", tt.wantTheme, body)
+			}
+			if !strings.Contains(body, `name="return" value="/compare?repo=%2Frepo"`) {
+				t.Errorf("Expected the theme picker to return to the current page, got %s", body)
+			}
+		})
+	}
+}
+
+func TestHandleSetTheme(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	tests := []struct {
+		name         string
+		theme        string
+		returnURL    string
+		wantStatus   int
+		wantLocation string
+	}{
+		{name: "bundled theme", theme: "dark", returnURL: "/diff?repo=%2Frepo", wantStatus: http.StatusSeeOther, wantLocation: "/diff?repo=%2Frepo"},
+		{name: "no return page", theme: "high-contrast", wantStatus: http.StatusSeeOther, wantLocation: "/"},
+		{name: "off-site return page", theme: "dark", returnURL: "//evil.example/", wantStatus: http.StatusSeeOther, wantLocation: "/"},
+		{name: "absolute return URL", theme: "dark", returnURL: "https://evil.example/", wantStatus: http.StatusSeeOther, wantLocation: "/"},
+		{name: "unknown theme", theme: "neon", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"theme": {tt.theme}, "return": {tt.returnURL}}
+			req := httptest.NewRequest("POST", "/api/theme", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			cookies := w.Result().Cookies()
+			if tt.wantStatus != http.StatusSeeOther {
+				if len(cookies) != 0 {
+					t.Errorf("Expected no cookie for a refused theme, got %v", cookies)
+				}
+				return
+			}
+			if location := w.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Expected a redirect to %q, got %q", tt.wantLocation, location)
+			}
+			if len(cookies) != 1 || cookies[0].Name != themeCookie || cookies[0].Value != tt.theme {
+				t.Fatalf("Expected a %s cookie of %q, got %v", themeCookie, tt.theme, cookies)
+			}
+		})
+	}
+}
+
+func TestThemeStylesheetsServed(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	for _, theme := range server.themes {
+		req := httptest.NewRequest("GET", "/static/css/themes/"+theme+".css", nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected the %s stylesheet to be served, got %d", theme, w.Code)
+		}
+	}
+}
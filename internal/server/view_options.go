@@ -0,0 +1,207 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/darccio/diffty/internal/git"
+)
+
+// viewOptions holds the diff view settings that persist across navigation
+type viewOptions struct {
+	Diff git.DiffOptions
+	// Filter restricts the file list to files with this status
+	Filter string
+	// ChangeType restricts the file list to files with this change type, one of git.ChangeTypes
+	ChangeType string
+	// Owner restricts the file list to files the repository's CODEOWNERS
+	// gives to this user, team or email address
+	Owner string
+	// FileOrder sorts the file list, one of fileOrders
+	FileOrder string
+	// LineOrder groups deletions or additions first within each run of changes
+	LineOrder string
+	// Pinned shows the commits named in the query instead of the branch tips
+	Pinned bool
+	// FullFile shows the whole content of the selected file around its changes
+	FullFile bool
+	// Patch names the patch file reviewed instead of a repository, see WithPatchDir
+	Patch string
+	// Exclude lists commits of the source branch whose changes are taken out of the diff
+	Exclude []string
+	// NoMerges takes the changes of the source branch's merge commits out of the diff
+	NoMerges bool
+	// TabWidth expands the tabs of the displayed lines to this many columns;
+	// zero leaves them to the browser
+	TabWidth int
+	// Compact shows only the added and removed lines, without headers or
+	// context, and lists them under each file of the file list
+	Compact bool
+}
+
+// parseViewOptions reads the view options from the query parameters and validates them
+func parseViewOptions(query url.Values) (viewOptions, error) {
+	opts := viewOptions{
+		Diff: git.DiffOptions{
+			Algorithm:        query.Get("algorithm"),
+			IgnoreSubmodules: query.Get("ignore_submodules"),
+			SubmoduleDiff:    query.Get("submodule_diff") == "1",
+			NoRenames:        query.Get("no_renames") == "1",
+			FindCopiesHarder: query.Get("find_copies") == "1",
+			Pathspec:         strings.TrimSpace(query.Get("pathspec")),
+			FunctionContext:  query.Get("function_context") == "1",
+		},
+		Filter:     query.Get("status"),
+		ChangeType: query.Get("change_type"),
+		Owner:      strings.TrimSpace(query.Get("owner")),
+		FileOrder:  query.Get("sort"),
+		LineOrder:  query.Get("line_order"),
+		Pinned:     query.Get("pin") == "1",
+		FullFile:   query.Get("full_file") == "1",
+		Patch:      query.Get("patch"),
+		Exclude:    query["exclude"],
+		NoMerges:   query.Get("no_merges") == "1",
+		Compact:    query.Get("compact") == "1",
+	}
+
+	if err := opts.Diff.Validate(); err != nil {
+		return viewOptions{}, err
+	}
+
+	if tabWidth := query.Get("tabwidth"); tabWidth != "" {
+		width, err := strconv.Atoi(tabWidth)
+		if err != nil || width < 1 || width > maxTabWidth {
+			return viewOptions{}, fmt.Errorf("invalid tab width: %s, expected 1 to %d", tabWidth, maxTabWidth)
+		}
+		opts.TabWidth = width
+	}
+
+	if opts.Filter != "" && !isFilterableStatus(opts.Filter) {
+		return viewOptions{}, fmt.Errorf("invalid status filter: %s", opts.Filter)
+	}
+
+	if opts.ChangeType != "" && indexOf(git.ChangeTypes, opts.ChangeType) == -1 {
+		return viewOptions{}, fmt.Errorf("invalid change type filter: %s", opts.ChangeType)
+	}
+
+	if strings.ContainsFunc(opts.Owner, unicode.IsSpace) {
+		return viewOptions{}, fmt.Errorf("invalid owner filter: %s", opts.Owner)
+	}
+
+	if opts.FileOrder != "" && indexOf(fileOrders, opts.FileOrder) == -1 {
+		return viewOptions{}, fmt.Errorf("invalid file order: %s", opts.FileOrder)
+	}
+
+	if opts.LineOrder != "" && indexOf(lineOrders, opts.LineOrder) == -1 {
+		return viewOptions{}, fmt.Errorf("invalid line order: %s", opts.LineOrder)
+	}
+
+	for _, commit := range opts.Exclude {
+		if !git.IsCommitHash(commit) {
+			return viewOptions{}, fmt.Errorf("invalid excluded commit: %s", commit)
+		}
+	}
+
+	return opts, nil
+}
+
+// values returns the query parameters of the options that differ from their defaults
+func (o viewOptions) values() url.Values {
+	values := url.Values{}
+	if o.Diff.Algorithm != "" {
+		values.Set("algorithm", o.Diff.Algorithm)
+	}
+	if o.Diff.IgnoreSubmodules != "" {
+		values.Set("ignore_submodules", o.Diff.IgnoreSubmodules)
+	}
+	if o.Diff.SubmoduleDiff {
+		values.Set("submodule_diff", "1")
+	}
+	if o.Diff.NoRenames {
+		values.Set("no_renames", "1")
+	}
+	if o.Diff.FindCopiesHarder {
+		values.Set("find_copies", "1")
+	}
+	if o.Diff.Pathspec != "" {
+		values.Set("pathspec", o.Diff.Pathspec)
+	}
+	if o.Diff.FunctionContext {
+		values.Set("function_context", "1")
+	}
+	if o.Filter != "" {
+		values.Set("status", o.Filter)
+	}
+	if o.ChangeType != "" {
+		values.Set("change_type", o.ChangeType)
+	}
+	if o.Owner != "" {
+		values.Set("owner", o.Owner)
+	}
+	if o.FileOrder != "" {
+		values.Set("sort", o.FileOrder)
+	}
+	if o.LineOrder != "" {
+		values.Set("line_order", o.LineOrder)
+	}
+	if o.Pinned {
+		values.Set("pin", "1")
+	}
+	if o.FullFile {
+		values.Set("full_file", "1")
+	}
+	if o.Patch != "" {
+		values.Set("patch", o.Patch)
+	}
+	for _, commit := range o.Exclude {
+		values.Add("exclude", commit)
+	}
+	if o.NoMerges {
+		values.Set("no_merges", "1")
+	}
+	if o.TabWidth > 0 {
+		values.Set("tabwidth", strconv.Itoa(o.TabWidth))
+	}
+	if o.Compact {
+		values.Set("compact", "1")
+	}
+	return values
+}
+
+// excludesCommits reports whether commits are taken out of the diff
+func (o viewOptions) excludesCommits() bool {
+	return len(o.Exclude) > 0 || o.NoMerges
+}
+
+// withFilter returns a copy of the options using the given file list filter
+func (o viewOptions) withFilter(filter string) viewOptions {
+	o.Filter = filter
+	return o
+}
+
+// withChangeType returns a copy of the options using the given change type filter
+func (o viewOptions) withChangeType(changeType string) viewOptions {
+	o.ChangeType = changeType
+	return o
+}
+
+// withOwner returns a copy of the options using the given owner filter
+func (o viewOptions) withOwner(owner string) viewOptions {
+	o.Owner = owner
+	return o
+}
+
+// querySuffix returns the options as a query string fragment ("&key=value...")
+// ready to be appended to the diff view links in templates
+func (o viewOptions) querySuffix() template.URL {
+	values := o.values()
+	if len(values) == 0 {
+		return ""
+	}
+	// The values are URL-encoded, so the fragment is safe to emit as-is
+	return template.URL("&" + values.Encode())
+}
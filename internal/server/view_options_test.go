@@ -0,0 +1,335 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseViewOptions(t *testing.T) {
+	opts, err := parseViewOptions(url.Values{"algorithm": {"patience"}})
+	if err != nil {
+		t.Fatalf("parseViewOptions failed: %v", err)
+	}
+
+	if opts.Diff.Algorithm != "patience" {
+		t.Errorf("Expected algorithm patience, got %s", opts.Diff.Algorithm)
+	}
+
+	if suffix := opts.querySuffix(); suffix != "&algorithm=patience" {
+		t.Errorf("Expected query suffix '&algorithm=patience', got %q", suffix)
+	}
+
+	// Defaults produce no query parameters
+	opts, err = parseViewOptions(url.Values{})
+	if err != nil {
+		t.Fatalf("parseViewOptions failed: %v", err)
+	}
+
+	if suffix := opts.querySuffix(); suffix != "" {
+		t.Errorf("Expected empty query suffix, got %q", suffix)
+	}
+
+	if _, err := parseViewOptions(url.Values{"algorithm": {"--output=/tmp/x"}}); err == nil {
+		t.Error("Expected error for invalid algorithm, got nil")
+	}
+
+	// Submodule options round-trip through the query
+	opts, err = parseViewOptions(url.Values{"ignore_submodules": {"dirty"}, "submodule_diff": {"1"}})
+	if err != nil {
+		t.Fatalf("parseViewOptions failed: %v", err)
+	}
+
+	if opts.Diff.IgnoreSubmodules != "dirty" || !opts.Diff.SubmoduleDiff {
+		t.Errorf("Expected submodule options to be set, got %+v", opts.Diff)
+	}
+
+	if suffix := opts.querySuffix(); suffix != "&ignore_submodules=dirty&submodule_diff=1" {
+		t.Errorf("Expected submodule query suffix, got %q", suffix)
+	}
+
+	if _, err := parseViewOptions(url.Values{"ignore_submodules": {"bogus"}}); err == nil {
+		t.Error("Expected error for invalid ignore-submodules mode, got nil")
+	}
+
+	// The file order round-trips too
+	opts, err = parseViewOptions(url.Values{"sort": {fileOrderRejectedFirst}})
+	if err != nil {
+		t.Fatalf("parseViewOptions failed: %v", err)
+	}
+
+	if suffix := opts.querySuffix(); suffix != "&sort=rejected-first" {
+		t.Errorf("Expected sort query suffix, got %q", suffix)
+	}
+
+	if _, err := parseViewOptions(url.Values{"sort": {"bogus"}}); err == nil {
+		t.Error("Expected error for invalid file order, got nil")
+	}
+
+	// Excluded commits round-trip, one parameter each
+	opts, err = parseViewOptions(url.Values{"exclude": {"abc1234", "def5678"}, "no_merges": {"1"}})
+	if err != nil {
+		t.Fatalf("parseViewOptions failed: %v", err)
+	}
+
+	if suffix := opts.querySuffix(); suffix != "&exclude=abc1234&exclude=def5678&no_merges=1" {
+		t.Errorf("Expected exclusion query suffix, got %q", suffix)
+	}
+
+	if _, err := parseViewOptions(url.Values{"exclude": {"HEAD~1"}}); err == nil {
+		t.Error("Expected error for an excluded commit that isn't a hash, got nil")
+	}
+}
+
+func TestHandleDiffViewAlgorithm(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{.ViewOptions.Diff.Algorithm}}|{{range .DiffLines}}{{.}};{{end}}|{{.ViewQuery}}`)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&file=test.txt&algorithm=histogram", nil)
+	w := httptest.NewRecorder()
+
+	server.handleDiffView(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if body := w.Body.String(); !strings.Contains(body, "histogram|") || !strings.Contains(body, "&#43;new line;") || !strings.Contains(body, "&amp;algorithm=histogram") {
+		t.Errorf("Expected histogram diff with persisted option, got %s", body)
+	}
+
+	req = httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&algorithm=bogus", nil)
+	w = httptest.NewRecorder()
+
+	server.handleDiffView(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestHandleDiffViewFunctionContext tests that the function context option
+// widens the file's hunks to the enclosing function, numbered from its start
+func TestHandleDiffViewFunctionContext(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .DiffLines}}{{.OldLine}},{{.NewLine}},{{.Kind}}:{{.Text}};{{end}}|{{.ViewQuery}}`)
+
+	content := func(changed string) string {
+		lines := []string{"func run() {"}
+		for i := 1; i <= 11; i++ {
+			line := fmt.Sprintf("\tstep%d()", i)
+			if i == 10 {
+				line = changed
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(append(lines, "}"), "\n") + "\n"
+	}
+	repoDir := setupGitRepo(t)
+	writeFile(t, repoDir, "run.go", content("\tstep10()"))
+	runGit(t, repoDir, "add", "run.go")
+	runGit(t, repoDir, "commit", "-m", "Add run.go")
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "run.go", content("\tchanged()"))
+	runGit(t, repoDir, "add", "run.go")
+	runGit(t, repoDir, "commit", "-m", "Change run.go")
+	runGit(t, repoDir, "checkout", "main")
+	mockStorage.repositories = []string{repoDir}
+
+	view := func(query string) string {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&file=run.go"+query, nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	if body := view(""); strings.Contains(body, "context: func run()") || !strings.Contains(body, "hunk:@@ -8,6 &#43;8,6 @@") {
+		t.Errorf("Expected 3 lines of context by default, got %s", body)
+	}
+
+	body := view("&function_context=1")
+	for _, expected := range []string{
+		"hunk:@@ -1,13 &#43;1,13 @@;",
+		"1,1,context: func run() {;",
+		"11,0,removed:-\tstep10();",
+		"0,11,added:&#43;\tchanged();",
+		"13,13,context: };",
+		"|&amp;function_context=1",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %q in the function context diff, got %s", expected, body)
+		}
+	}
+}
+
+func TestPermalinkRoundTrip(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{.Permalink}}|{{range .DiffLines}}{{.}};{{end}}`)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	render := func(target string) (string, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		link, diff, _ := strings.Cut(html.UnescapeString(w.Body.String()), "|")
+		return strings.TrimPrefix(link, "<!DOCTYPE html><html><body>"), diff
+	}
+
+	link, diff := render("/diff?repo=" + url.QueryEscape(repoDir) + "&source=feature&target=main&file=test.txt&algorithm=patience")
+
+	permalink, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("Failed to parse permalink %q: %v", link, err)
+	}
+	query := permalink.Query()
+	if query.Get("source_commit") != runGit(t, repoDir, "rev-parse", "feature") || query.Get("pin") != "1" || query.Get("algorithm") != "patience" || query.Get("file") != "test.txt" {
+		t.Fatalf("Expected permalink pinned to the feature commit with the view options, got %s", link)
+	}
+
+	// Move the branch: the permalink keeps showing the original diff
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "test.txt", "initial content\nnew line\nnewer line\n")
+	runGit(t, repoDir, "commit", "-am", "Add newer line")
+	runGit(t, repoDir, "checkout", "main")
+
+	_, pinnedDiff := render(permalink.RequestURI())
+	if pinnedDiff != diff {
+		t.Errorf("Expected the permalink to show the original diff\n%s\ngot\n%s", diff, pinnedDiff)
+	}
+
+	_, movedDiff := render("/diff?repo=" + url.QueryEscape(repoDir) + "&source=feature&target=main&file=test.txt&algorithm=patience")
+	if !strings.Contains(movedDiff, "+newer line") {
+		t.Errorf("Expected the branch link to follow the branch, got %s", movedDiff)
+	}
+
+	// Pinned links only accept commit hashes
+	req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&source_commit=--output=x&target_commit=main&pin=1", nil)
+	w := httptest.NewRecorder()
+	server.handleDiffView(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestHandleDiffViewUndiffable tests that refs git can't diff get their own error view
+func TestHandleDiffViewUndiffable(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+
+	repoDir := setupGitRepo(t)
+	mockStorage.repositories = []string{repoDir}
+
+	// A commit whose tree went missing, as in a corrupt or partial clone
+	runGit(t, repoDir, "checkout", "-b", "broken", "feature")
+	writeFile(t, repoDir, "broken.txt", "unique content\n")
+	runGit(t, repoDir, "add", "broken.txt")
+	runGit(t, repoDir, "commit", "-m", "Add broken file")
+	broken := runGit(t, repoDir, "rev-parse", "HEAD")
+	tree := runGit(t, repoDir, "rev-parse", "HEAD^{tree}")
+	runGit(t, repoDir, "checkout", "main")
+	if err := os.Remove(filepath.Join(repoDir, ".git", "objects", tree[:2], tree[2:])); err != nil {
+		t.Fatalf("Failed to remove tree object: %v", err)
+	}
+
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("source", "feature")
+	query.Set("target", "main")
+	query.Set("source_commit", broken)
+	query.Set("target_commit", runGit(t, repoDir, "rev-parse", "main"))
+	query.Set("pin", "1")
+
+	req := httptest.NewRequest("GET", "/diff?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "Can&#39;t Be Diffed") {
+		t.Errorf("Expected the undiffable refs error, got %s", body)
+	}
+}
+
+// TestHandleDiffViewPathspec tests that a pathspec keeps files outside of it
+// out of the file list, the file view and the review API
+func TestHandleDiffViewPathspec(t *testing.T) {
+	server, mockStorage := setupTestServer(t)
+	overrideTemplate(t, server, "diff.html", `{{range .Files}}{{.Path}};{{end}}|{{.TotalFiles}}|{{range .DiffLines}}{{.}};{{end}}|{{.ViewQuery}}`)
+
+	repoDir := setupGitRepo(t)
+	runGit(t, repoDir, "checkout", "feature")
+	writeFile(t, repoDir, "services/payments/main.go", "package main\n")
+	writeFile(t, repoDir, "services/billing/main.go", "package main\n")
+	runGit(t, repoDir, "add", ".")
+	runGit(t, repoDir, "commit", "-m", "Add services")
+	runGit(t, repoDir, "checkout", "main")
+
+	mockStorage.repositories = []string{repoDir}
+	mockStorage.reviewState = nil
+
+	render := func(query string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/diff?repo="+url.QueryEscape(repoDir)+"&source=feature&target=main&"+query, nil)
+		w := httptest.NewRecorder()
+		server.handleDiffView(w, req)
+		return w.Code, html.UnescapeString(w.Body.String())
+	}
+
+	code, body := render("pathspec=services/payments")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, code, body)
+	}
+	if !strings.Contains(body, "services/payments/main.go;|1|") {
+		t.Errorf("Expected only the scoped file to be listed, got %s", body)
+	}
+	if strings.Contains(body, "test.txt") || strings.Contains(body, "billing") {
+		t.Errorf("Expected files outside the scope to be left out, got %s", body)
+	}
+	if !strings.Contains(body, "&pathspec=services%2Fpayments") {
+		t.Errorf("Expected the pathspec to persist in the view query, got %s", body)
+	}
+
+	// A file outside the scope shows no diff even when asked for directly
+	_, body = render("pathspec=services/payments&file=test.txt")
+	if strings.Contains(body, "new line") {
+		t.Errorf("Expected no diff for a file outside the scope, got %s", body)
+	}
+
+	// Navigation only visits the scoped files
+	query := url.Values{}
+	query.Set("repo", repoDir)
+	query.Set("source", "feature")
+	query.Set("target", "main")
+	query.Set("source_commit", runGit(t, repoDir, "rev-parse", "feature"))
+	query.Set("target_commit", runGit(t, repoDir, "rev-parse", "main"))
+	query.Set("pathspec", "services/payments")
+	code, resp := doReviewAPI(t, server, "GET", "/api/review/next-unreviewed", query, "")
+	if code != http.StatusOK || resp.File != "services/payments/main.go" || resp.Next != "" {
+		t.Errorf("Expected navigation to stay within the scope, got %d %+v", code, resp)
+	}
+
+	for _, pathspec := range []string{"../outside", "--output=x", "services/*"} {
+		if code, _ := render("pathspec=" + url.QueryEscape(pathspec)); code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for pathspec %q, got %d", http.StatusBadRequest, pathspec, code)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/git"
+	"github.com/darccio/diffty/internal/models"
+	"github.com/darccio/diffty/internal/storage"
+)
+
+// TestHandleDiffViewWorkingTree tests reviewing the working tree, with its
+// uncommitted changes and untracked files, from the compare form on
+func TestHandleDiffViewWorkingTree(t *testing.T) {
+	store, err := storage.OpenStorage(storage.DefaultBackend, storage.Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	server, err := New(store)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	overrideTemplate(t, server, "diff.html", `[{{range .Files}}{{.Path}}={{.Status}};{{end}}]`)
+
+	repoDir := setupGitRepo(t)
+	if err := store.SaveRepositories([]string{repoDir}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+	writeFile(t, repoDir, "test.txt", "initial content\nuncommitted\n")
+	writeFile(t, repoDir, "notes/todo.txt", "untracked\n")
+	writeFile(t, repoDir, ".git/info/exclude", "ignored.txt\n")
+	writeFile(t, repoDir, "ignored.txt", "ignored\n")
+
+	form := url.Values{"repo": {repoDir}, "source": {git.WorkingTree}, "target": {"main"}}
+	req := httptest.NewRequest("POST", "/compare", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusSeeOther, w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+
+	get := func() string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest("GET", location, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	// Untracked files are listed along with the changes, ignored ones aren't
+	if body := get(); !strings.Contains(body, "[notes/todo.txt=unreviewed;test.txt=unreviewed;]") {
+		t.Errorf("Expected the changed and untracked files, got %s", body)
+	}
+
+	// An untracked file is reviewed like any other
+	redirect, err := url.Parse(location)
+	if err != nil {
+		t.Fatalf("Failed to parse redirect location: %v", err)
+	}
+	query := redirect.Query()
+	query.Set("file", "notes/todo.txt")
+	query.Set("status", models.StateApproved)
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/review-state?"+query.Encode(), nil))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected the review saved, got %d: %s", w.Code, w.Body.String())
+	}
+	if body := get(); !strings.Contains(body, "notes/todo.txt=approved;") || !strings.Contains(body, "test.txt=unreviewed;") {
+		t.Errorf("Expected the untracked file approved, got %s", body)
+	}
+
+	// Editing another file gives a new snapshot, which keeps the review of the unchanged file
+	writeFile(t, repoDir, "test.txt", "initial content\nedited\n")
+	req = httptest.NewRequest("POST", "/compare", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+	if next := w.Header().Get("Location"); next == location {
+		t.Errorf("Expected a new snapshot once a file changed, got %s again", next)
+	} else {
+		location = next
+	}
+	if body := get(); !strings.Contains(body, "notes/todo.txt=approved;") {
+		t.Errorf("Expected the review of the unchanged file carried over, got %s", body)
+	}
+
+	// The branch itself isn't touched
+	if status := runGit(t, repoDir, "status", "--porcelain"); !strings.Contains(status, "?? notes/") {
+		t.Errorf("Expected notes/ still untracked, got %s", status)
+	}
+}
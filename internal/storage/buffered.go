@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// BufferedStorage wraps a Storage and keeps review state saves in memory,
+// writing them to the wrapped storage together once the flush interval has
+// passed since the first pending save. Rapid review actions on the same
+// comparison then cost a single write. At most one interval of reviews can be
+// lost on a crash; Close flushes whatever is pending on graceful shutdown.
+type BufferedStorage struct {
+	Storage
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[bufferKey]*pendingState
+	timer   *time.Timer
+	closed  bool
+}
+
+// bufferKey identifies a review state the way the wrapped storage files it
+type bufferKey struct {
+	repoPath, user, sourceCommit, targetCommit string
+}
+
+// pendingState is a review state saved but not yet written to the wrapped storage
+type pendingState struct {
+	state    *models.ReviewState
+	repoPath string
+	user     string
+}
+
+// NewBufferedStorage wraps backend so review state saves are written at most
+// once per interval
+func NewBufferedStorage(backend Storage, interval time.Duration) *BufferedStorage {
+	return &BufferedStorage{
+		Storage:  backend,
+		interval: interval,
+		pending:  make(map[bufferKey]*pendingState),
+	}
+}
+
+// SaveReviewState buffers the review state, scheduling a flush if none is
+// pending. Once closed, or without an interval, saves are written directly.
+func (b *BufferedStorage) SaveReviewState(state *models.ReviewState, repoPath, user string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || b.interval <= 0 || state.SourceCommit == "" || state.TargetCommit == "" {
+		return b.Storage.SaveReviewState(state, repoPath, user)
+	}
+
+	key := bufferKey{repoPath, user, state.SourceCommit, state.TargetCommit}
+	b.pending[key] = &pendingState{state: state.Clone(), repoPath: repoPath, user: user}
+
+	// The timer isn't pushed back by later saves, which bounds how long a save stays in memory
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, b.flushOnTimer)
+	}
+	return nil
+}
+
+// LoadReviewState returns the pending review state of the comparison if there
+// is one. Loading any other comparison means the reviewer moved on, so the
+// pending states are flushed first.
+func (b *BufferedStorage) LoadReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error) {
+	b.mu.Lock()
+	if pending, ok := b.pending[bufferKey{repoPath, user, sourceCommit, targetCommit}]; ok {
+		state := pending.state.Clone()
+		b.mu.Unlock()
+		return state, nil
+	}
+	err := b.flushLocked()
+	b.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Warning: failed to flush review states: %v", err)
+	}
+	return b.Storage.LoadReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit)
+}
+
+// HasReviewState reports pending review states as stored, without flushing
+func (b *BufferedStorage) HasReviewState(repoPath, user, sourceCommit, targetCommit string) (bool, error) {
+	b.mu.Lock()
+	_, ok := b.pending[bufferKey{repoPath, user, sourceCommit, targetCommit}]
+	b.mu.Unlock()
+	if ok {
+		return true, nil
+	}
+	return b.Storage.HasReviewState(repoPath, user, sourceCommit, targetCommit)
+}
+
+// FindPreviousReviewState flushes the pending review states so they are found too
+func (b *BufferedStorage) FindPreviousReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.Storage.FindPreviousReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit)
+}
+
+// LoadUserReviewStates flushes the pending review states so they are included
+func (b *BufferedStorage) LoadUserReviewStates(repoPath, sourceCommit, targetCommit string) ([]*models.ReviewState, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.Storage.LoadUserReviewStates(repoPath, sourceCommit, targetCommit)
+}
+
+// ListRecentReviews flushes the pending review states so they are listed
+func (b *BufferedStorage) ListRecentReviews(limit int) ([]ReviewStateSummary, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	return b.Storage.ListRecentReviews(limit)
+}
+
+// ScanFileReviews flushes the pending review states so they are scanned
+func (b *BufferedStorage) ScanFileReviews(repoPath, filePath string, fn func(FileReviewRecord) error) error {
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	return b.Storage.ScanFileReviews(repoPath, filePath, fn)
+}
+
+// ClearReviewStates drops the pending review states of the repository before
+// clearing the stored ones, so they aren't written back afterwards
+func (b *BufferedStorage) ClearReviewStates(repoPath string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key := range b.pending {
+		if key.repoPath == repoPath {
+			delete(b.pending, key)
+		}
+	}
+	return b.Storage.ClearReviewStates(repoPath)
+}
+
+// Flush writes the pending review states to the wrapped storage
+func (b *BufferedStorage) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked()
+}
+
+// Close flushes the pending review states and writes later saves directly
+func (b *BufferedStorage) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return b.flushLocked()
+}
+
+// flushOnTimer flushes when the interval passes
+func (b *BufferedStorage) flushOnTimer() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.timer = nil
+	if err := b.flushLocked(); err != nil {
+		log.Printf("Warning: failed to flush review states: %v", err)
+	}
+}
+
+// flushLocked writes the pending review states, keeping the ones that fail so
+// they are tried again one interval later. The caller must hold b.mu.
+func (b *BufferedStorage) flushLocked() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	var errs []error
+	for key, pending := range b.pending {
+		if err := b.Storage.SaveReviewState(pending.state, pending.repoPath, pending.user); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delete(b.pending, key)
+	}
+
+	if len(b.pending) > 0 && !b.closed && b.interval > 0 {
+		b.timer = time.AfterFunc(b.interval, b.flushOnTimer)
+	}
+
+	return errors.Join(errs...)
+}
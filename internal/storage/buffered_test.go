@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// countingStorage counts the review state saves reaching the wrapped storage
+// and can be made to fail them
+type countingStorage struct {
+	Storage
+
+	mu    sync.Mutex
+	saves int
+	fail  bool
+}
+
+func (c *countingStorage) SaveReviewState(state *models.ReviewState, repoPath, user string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fail {
+		return errors.New("disk full")
+	}
+	c.saves++
+	return c.Storage.SaveReviewState(state, repoPath, user)
+}
+
+func (c *countingStorage) saveCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.saves
+}
+
+func newCountingStorage(t *testing.T) *countingStorage {
+	t.Helper()
+	backend, err := newJSONStorageAt(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create JSON storage: %v", err)
+	}
+	return &countingStorage{Storage: backend}
+}
+
+// reviewFile loads a review state through the storage, sets a file's status and saves it back
+func reviewFile(t *testing.T, s Storage, path, status string) {
+	t.Helper()
+	state, err := s.LoadReviewState("/repo", "", "feature", "main", "source-commit", "target-commit")
+	if err != nil {
+		t.Fatalf("Failed to load review state: %v", err)
+	}
+	state.ReviewedFiles = append(state.ReviewedFiles, models.FileReview{Repo: "/repo", Path: path, Lines: map[string]string{"all": status}})
+	if err := s.SaveReviewState(state, "/repo", ""); err != nil {
+		t.Fatalf("Failed to save review state: %v", err)
+	}
+}
+
+func TestBufferedStorageCoalescesSaves(t *testing.T) {
+	backend := newCountingStorage(t)
+	buffered := NewBufferedStorage(backend, 50*time.Millisecond)
+
+	for _, path := range []string{"a.go", "b.go", "c.go"} {
+		reviewFile(t, buffered, path, models.StateApproved)
+	}
+
+	if saves := backend.saveCount(); saves != 0 {
+		t.Fatalf("Expected the saves to be buffered, got %d writes", saves)
+	}
+
+	// Reads see the buffered state
+	state, err := buffered.LoadReviewState("/repo", "", "feature", "main", "source-commit", "target-commit")
+	if err != nil {
+		t.Fatalf("Failed to load review state: %v", err)
+	}
+	if len(state.ReviewedFiles) != 3 {
+		t.Errorf("Expected the 3 buffered reviews, got %d", len(state.ReviewedFiles))
+	}
+
+	// Changing the loaded state doesn't touch the buffered one until it is saved
+	state.ReviewedFiles = nil
+	if again, _ := buffered.LoadReviewState("/repo", "", "feature", "main", "source-commit", "target-commit"); len(again.ReviewedFiles) != 3 {
+		t.Errorf("Expected the buffered state to be isolated from callers, got %d reviews", len(again.ReviewedFiles))
+	}
+
+	// The interval elapses and the three saves become one write
+	deadline := time.Now().Add(2 * time.Second)
+	for backend.saveCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if saves := backend.saveCount(); saves != 1 {
+		t.Fatalf("Expected a single coalesced write, got %d", saves)
+	}
+
+	stored, err := backend.LoadReviewState("/repo", "", "feature", "main", "source-commit", "target-commit")
+	if err != nil {
+		t.Fatalf("Failed to load stored review state: %v", err)
+	}
+	if len(stored.ReviewedFiles) != 3 {
+		t.Errorf("Expected the 3 reviews to be written, got %d", len(stored.ReviewedFiles))
+	}
+}
+
+func TestBufferedStorageFlushesOnClose(t *testing.T) {
+	backend := newCountingStorage(t)
+	buffered := NewBufferedStorage(backend, time.Hour)
+
+	reviewFile(t, buffered, "a.go", models.StateApproved)
+	reviewFile(t, buffered, "b.go", models.StateRejected)
+
+	if err := buffered.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if saves := backend.saveCount(); saves != 1 {
+		t.Fatalf("Expected the pending state to be written on close, got %d writes", saves)
+	}
+
+	stored, err := backend.LoadReviewState("/repo", "", "feature", "main", "source-commit", "target-commit")
+	if err != nil {
+		t.Fatalf("Failed to load stored review state: %v", err)
+	}
+	if status, _ := stored.FileStatus("/repo", "b.go"); status != models.StateRejected {
+		t.Errorf("Expected b.go to be stored as rejected, got %s", status)
+	}
+
+	// After closing, saves are written right away
+	reviewFile(t, buffered, "c.go", models.StateApproved)
+	if saves := backend.saveCount(); saves != 2 {
+		t.Errorf("Expected saves after close to be synchronous, got %d writes", saves)
+	}
+}
+
+func TestBufferedStorageFlushesOnNavigation(t *testing.T) {
+	backend := newCountingStorage(t)
+	buffered := NewBufferedStorage(backend, time.Hour)
+	defer buffered.Close()
+
+	reviewFile(t, buffered, "a.go", models.StateApproved)
+
+	// Opening another comparison writes the pending one
+	if _, err := buffered.LoadReviewState("/repo", "", "other", "main", "other-commit", "target-commit"); err != nil {
+		t.Fatalf("Failed to load review state: %v", err)
+	}
+	if saves := backend.saveCount(); saves != 1 {
+		t.Errorf("Expected the pending state to be written when moving on, got %d writes", saves)
+	}
+}
+
+func TestBufferedStorageHasPendingReviewState(t *testing.T) {
+	backend := newCountingStorage(t)
+	buffered := NewBufferedStorage(backend, time.Hour)
+	defer buffered.Close()
+
+	reviewFile(t, buffered, "a.go", models.StateApproved)
+
+	// A pending state counts as stored, and looking for states doesn't write it
+	if exists, err := buffered.HasReviewState("/repo", "", "source-commit", "target-commit"); err != nil || !exists {
+		t.Errorf("Expected the pending review state, got %v: %v", exists, err)
+	}
+	if exists, err := buffered.HasReviewState("/repo", "", "target-commit", "source-commit"); err != nil || exists {
+		t.Errorf("Expected no review state of the reverse ordering, got %v: %v", exists, err)
+	}
+	if saves := backend.saveCount(); saves != 0 {
+		t.Errorf("Expected the pending state to stay buffered, got %d writes", saves)
+	}
+}
+
+func TestBufferedStorageKeepsFailedFlushes(t *testing.T) {
+	backend := newCountingStorage(t)
+	backend.fail = true
+	buffered := NewBufferedStorage(backend, time.Hour)
+
+	reviewFile(t, buffered, "a.go", models.StateApproved)
+	if err := buffered.Flush(); err == nil {
+		t.Fatal("Expected the failed write to be reported")
+	}
+
+	backend.mu.Lock()
+	backend.fail = false
+	backend.mu.Unlock()
+
+	if err := buffered.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if saves := backend.saveCount(); saves != 1 {
+		t.Errorf("Expected the state to be written once the storage recovers, got %d writes", saves)
+	}
+}
+
+func TestBufferedStorageWithoutInterval(t *testing.T) {
+	backend := newCountingStorage(t)
+	buffered := NewBufferedStorage(backend, 0)
+
+	reviewFile(t, buffered, "a.go", models.StateApproved)
+	if saves := backend.saveCount(); saves != 1 {
+		t.Errorf("Expected saves to be synchronous without an interval, got %d writes", saves)
+	}
+}
+
+func TestBufferedStorageClearDropsPending(t *testing.T) {
+	backend := newCountingStorage(t)
+	buffered := NewBufferedStorage(backend, time.Hour)
+
+	reviewFile(t, buffered, "a.go", models.StateApproved)
+	if err := buffered.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	reviewFile(t, buffered, "b.go", models.StateApproved)
+
+	if cleared, err := buffered.ClearReviewStates("/repo"); err != nil || cleared != 1 {
+		t.Fatalf("Expected 1 comparison to be cleared, got %d (%v)", cleared, err)
+	}
+
+	// The pending save isn't written back over the cleared state
+	if err := buffered.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	state, err := backend.LoadReviewState("/repo", "", "feature", "main", "source-commit", "target-commit")
+	if err != nil {
+		t.Fatalf("Failed to load review state: %v", err)
+	}
+	if len(state.ReviewedFiles) != 0 {
+		t.Errorf("Expected the cleared state to stay empty, got %v", state.ReviewedFiles)
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Diagnostics describes the storage directory and what is stored in it
+type Diagnostics struct {
+	Path string
+	// WriteError is nil when the storage directory is writable
+	WriteError   error
+	Repositories int
+	// InRepo is set when review states are kept inside the repositories, so
+	// ReviewStates and ReviewStateBytes only count those stored elsewhere
+	InRepo           bool
+	ReviewStates     int
+	ReviewStateBytes int64
+}
+
+// Path returns the directory where diffty keeps its data
+func (s *JSONStorage) Path() string {
+	return s.baseStoragePath
+}
+
+// Diagnose inspects the storage directory without modifying any stored data
+func (s *JSONStorage) Diagnose() (*Diagnostics, error) {
+	diag := &Diagnostics{
+		Path:       s.baseStoragePath,
+		WriteError: s.checkWritable(),
+		InRepo:     s.inRepo,
+	}
+
+	repos, err := s.LoadRepositories()
+	if err != nil {
+		return nil, err
+	}
+	diag.Repositories = len(repos)
+
+	err = filepath.WalkDir(s.baseStoragePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != "review-state.json" {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		diag.ReviewStates++
+		diag.ReviewStateBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan review states: %w", err)
+	}
+
+	return diag, nil
+}
+
+// checkWritable verifies a file can be created in the storage directory
+func (s *JSONStorage) checkWritable() error {
+	f, err := os.CreateTemp(s.baseStoragePath, ".diffty-write-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
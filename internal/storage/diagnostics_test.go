@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+func TestDiagnose(t *testing.T) {
+	difftyDir := filepath.Join(t.TempDir(), ".diffty")
+	if err := os.MkdirAll(difftyDir, 0755); err != nil {
+		t.Fatalf("Failed to create .diffty directory: %v", err)
+	}
+
+	storage := &JSONStorage{
+		baseStoragePath: difftyDir,
+		reposPath:       filepath.Join(difftyDir, "repositories.json"),
+	}
+
+	if err := storage.SaveRepositories([]string{"/path/to/repo", "/path/to/other"}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+
+	for _, commits := range [][2]string{{"abc123", "def456"}, {"abc789", "def456"}} {
+		state := &models.ReviewState{
+			ReviewedFiles: []models.FileReview{},
+			SourceBranch:  "feature",
+			TargetBranch:  "main",
+			SourceCommit:  commits[0],
+			TargetCommit:  commits[1],
+		}
+		if err := storage.SaveReviewState(state, "/path/to/repo", ""); err != nil {
+			t.Fatalf("Failed to save review state: %v", err)
+		}
+	}
+
+	diag, err := storage.Diagnose()
+	if err != nil {
+		t.Fatalf("Failed to diagnose storage: %v", err)
+	}
+
+	if diag.Path != difftyDir {
+		t.Errorf("Expected path %s, got %s", difftyDir, diag.Path)
+	}
+	if diag.WriteError != nil {
+		t.Errorf("Expected storage to be writable, got %v", diag.WriteError)
+	}
+	if diag.Repositories != 2 {
+		t.Errorf("Expected 2 repositories, got %d", diag.Repositories)
+	}
+	if diag.ReviewStates != 2 {
+		t.Errorf("Expected 2 review states, got %d", diag.ReviewStates)
+	}
+	if diag.ReviewStateBytes <= 0 {
+		t.Errorf("Expected review states to take some space, got %d bytes", diag.ReviewStateBytes)
+	}
+
+	// The write check leaves nothing behind
+	matches, _ := filepath.Glob(filepath.Join(difftyDir, ".diffty-write-check-*"))
+	if len(matches) != 0 {
+		t.Errorf("Expected write check files to be removed, found %v", matches)
+	}
+}
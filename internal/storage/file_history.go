@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileReviewRecord is the review of a file in one stored comparison
+type FileReviewRecord struct {
+	User         string // empty in single-user mode
+	SourceBranch string
+	TargetBranch string
+	SourceCommit string
+	TargetCommit string
+	Status       string
+	Reason       string    // why the file was rejected, if it was
+	ModTime      time.Time // when the review state was last saved
+}
+
+// ErrStopScan can be returned by a ScanFileReviews callback to stop the scan
+// early without failing it
+var ErrStopScan = errors.New("stop scan")
+
+// ScanFileReviews calls fn with the review of filePath in every stored
+// comparison of a repository that has one, of all users, in no particular
+// order. Review states are read one at a time, so any number of comparisons
+// can be scanned without loading them all. An error returned by fn stops the
+// scan and is returned, except for ErrStopScan.
+func (s *JSONStorage) ScanFileReviews(repoPath, filePath string, fn func(FileReviewRecord) error) error {
+	if repoPath == "" || filePath == "" {
+		return fmt.Errorf("repository and file paths are required")
+	}
+
+	// States that don't mention the path at all are skipped without decoding them
+	needle, err := json.Marshal(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to encode file path: %w", err)
+	}
+
+	repoDir := s.getRepoStorageDir(repoPath)
+	err = filepath.WalkDir(repoDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || entry.Name() != "review-state.json" {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read review state: %w", err)
+		}
+		if !bytes.Contains(data, needle) {
+			return nil
+		}
+
+		state, err := decodeReviewState(data, path)
+		if err != nil {
+			// Skip corrupt states rather than failing the whole scan
+			return nil
+		}
+		review, ok := state.File(repoPath, filePath)
+		if !ok {
+			return nil
+		}
+
+		// <source commit>/<target commit>[/users/<user>]/review-state.json
+		rel, err := filepath.Rel(repoDir, path)
+		if err != nil {
+			return nil
+		}
+		parts := strings.Split(rel, string(os.PathSeparator))
+		// States saved without a user are named after their directory
+		if state.User == "" && len(parts) > 3 {
+			state.User = parts[3]
+		}
+
+		var modTime time.Time
+		if info, err := entry.Info(); err == nil {
+			modTime = info.ModTime()
+		}
+
+		return fn(FileReviewRecord{
+			User:         state.User,
+			SourceBranch: state.SourceBranch,
+			TargetBranch: state.TargetBranch,
+			SourceCommit: state.SourceCommit,
+			TargetCommit: state.TargetCommit,
+			Status:       review.Status(),
+			Reason:       review.Reason,
+			ModTime:      modTime,
+		})
+	})
+	if errors.Is(err, ErrStopScan) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+func TestScanFileReviews(t *testing.T) {
+	storage, err := newJSONStorageAt(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create JSON storage: %v", err)
+	}
+
+	save := func(repoPath, user, sourceCommit string, reviews ...models.FileReview) {
+		t.Helper()
+		state := &models.ReviewState{
+			ReviewedFiles: reviews,
+			SourceBranch:  "feature",
+			TargetBranch:  "main",
+			SourceCommit:  sourceCommit,
+			TargetCommit:  "target-commit",
+		}
+		if err := storage.SaveReviewState(state, repoPath, user); err != nil {
+			t.Fatalf("Failed to save review state: %v", err)
+		}
+	}
+	review := func(repoPath, path, status, reason string) models.FileReview {
+		return models.FileReview{Repo: repoPath, Path: path, Lines: map[string]string{"all": status}, Reason: reason}
+	}
+
+	repo := "/path/to/repo"
+	save(repo, "", "first", review(repo, "payment.go", models.StateApproved, ""), review(repo, "other.go", models.StateApproved, ""))
+	save(repo, "", "second", review(repo, "payment.go", models.StateRejected, "Needs tests"))
+	save(repo, "alice", "second", review(repo, "payment.go", models.StateSkipped, ""))
+	// Mentions the path, but as another file's reason
+	save(repo, "", "third", review(repo, "other.go", models.StateRejected, `Move it to "payment.go"`))
+	save("/path/to/other", "", "first", review("/path/to/other", "payment.go", models.StateApproved, ""))
+
+	// A corrupt state doesn't fail the scan
+	corrupt := storage.reviewStatePath(repo, "", "corrupt", "target-commit")
+	if err := os.MkdirAll(filepath.Dir(corrupt), 0755); err != nil {
+		t.Fatalf("Failed to create review directory: %v", err)
+	}
+	if err := os.WriteFile(corrupt, []byte(`{"reviewed_files": "payment.go`), 0644); err != nil {
+		t.Fatalf("Failed to write corrupt state: %v", err)
+	}
+
+	var got []string
+	err = storage.ScanFileReviews(repo, "payment.go", func(record FileReviewRecord) error {
+		got = append(got, record.SourceCommit+"/"+record.User+":"+record.Status+":"+record.Reason)
+		if record.SourceBranch != "feature" || record.TargetBranch != "main" || record.ModTime.IsZero() {
+			t.Errorf("Unexpected record: %+v", record)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ScanFileReviews failed: %v", err)
+	}
+	sort.Strings(got)
+	expected := "first/:approved:,second/:rejected:Needs tests,second/alice:skipped:"
+	if strings.Join(got, ",") != expected {
+		t.Errorf("Expected %s, got %s", expected, strings.Join(got, ","))
+	}
+
+	// The callback can stop the scan, or fail it
+	calls := 0
+	if err := storage.ScanFileReviews(repo, "payment.go", func(FileReviewRecord) error {
+		calls++
+		return ErrStopScan
+	}); err != nil || calls != 1 {
+		t.Errorf("Expected the scan to stop after one record without error, got %d calls, %v", calls, err)
+	}
+	failure := errors.New("client went away")
+	if err := storage.ScanFileReviews(repo, "payment.go", func(FileReviewRecord) error { return failure }); !errors.Is(err, failure) {
+		t.Errorf("Expected the callback's error, got %v", err)
+	}
+
+	// Repositories without reviews have no history
+	if err := storage.ScanFileReviews(filepath.Join("/", "nowhere"), "payment.go", func(FileReviewRecord) error {
+		t.Error("Expected no records")
+		return nil
+	}); err != nil {
+		t.Errorf("Expected no error for a repository without reviews, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// TestInRepoStorage tests that review states can be kept inside the
+// repositories, ignored by git until the user chooses to share them
+func TestInRepoStorage(t *testing.T) {
+	globalDir := t.TempDir()
+	repoDir := t.TempDir()
+	if _, err := exec.LookPath("git"); err == nil {
+		if out, err := exec.Command("git", "-C", repoDir, "init", "-q").CombinedOutput(); err != nil {
+			t.Fatalf("git init failed: %v\n%s", err, out)
+		}
+	}
+
+	opened, err := OpenStorage(DefaultBackend, Options{Dir: globalDir, InRepo: true})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	storage := opened.(*JSONStorage)
+	if err := storage.SaveRepositories([]string{repoDir}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+
+	state := &models.ReviewState{
+		ReviewedFiles: []models.FileReview{{Repo: repoDir, Path: "a.go", Lines: map[string]string{"all": models.StateApproved}}},
+		SourceBranch:  "feature",
+		TargetBranch:  "main",
+		SourceCommit:  "source-commit",
+		TargetCommit:  "target-commit",
+	}
+	if err := storage.SaveReviewState(state, repoDir, ""); err != nil {
+		t.Fatalf("Failed to save review state: %v", err)
+	}
+	if err := storage.SaveReviewState(state, repoDir, "alice"); err != nil {
+		t.Fatalf("Failed to save review state: %v", err)
+	}
+
+	statePath := filepath.Join(repoDir, RepoStorageDir, "source-commit", "target-commit", "review-state.json")
+	if _, err := os.Stat(statePath); err != nil {
+		t.Fatalf("Expected the review state in the repository: %v", err)
+	}
+	if entries, _ := os.ReadDir(globalDir); len(entries) != 1 {
+		t.Errorf("Expected only the repository list in the global directory, got %d entries", len(entries))
+	}
+
+	loaded, err := storage.LoadReviewState(repoDir, "", "feature", "main", "source-commit", "target-commit")
+	if err != nil {
+		t.Fatalf("Failed to load review state: %v", err)
+	}
+	if len(loaded.ReviewedFiles) != 1 || loaded.ReviewedFiles[0].Path != "a.go" {
+		t.Errorf("Unexpected review state: %+v", loaded)
+	}
+
+	summaries, err := storage.ListRecentReviews(0)
+	if err != nil {
+		t.Fatalf("Failed to list recent reviews: %v", err)
+	}
+	users := map[string]bool{}
+	for _, summary := range summaries {
+		if summary.RepoPath != repoDir {
+			t.Errorf("Unexpected repository: %+v", summary)
+		}
+		users[summary.User] = true
+	}
+	if len(summaries) != 2 || !users[""] || !users["alice"] {
+		t.Errorf("Expected both users' reviews, got %+v", summaries)
+	}
+
+	// git doesn't see the review states
+	gitignore := filepath.Join(repoDir, RepoStorageDir, ".gitignore")
+	if _, err := exec.LookPath("git"); err == nil {
+		out, err := exec.Command("git", "-C", repoDir, "status", "--porcelain", "--untracked-files=all").CombinedOutput()
+		if err != nil {
+			t.Fatalf("git status failed: %v\n%s", err, out)
+		}
+		if strings.Contains(string(out), RepoStorageDir) {
+			t.Errorf("Expected the review states to be ignored, got:\n%s", out)
+		}
+	} else if _, err := os.Stat(gitignore); err != nil {
+		t.Errorf("Expected a .gitignore in the storage directory: %v", err)
+	}
+
+	// A deleted .gitignore means the reviews are meant to be shared
+	if err := os.Remove(gitignore); err != nil {
+		t.Fatalf("Failed to remove .gitignore: %v", err)
+	}
+	state.SourceCommit = "new-commit"
+	if err := storage.SaveReviewState(state, repoDir, ""); err != nil {
+		t.Fatalf("Failed to save review state: %v", err)
+	}
+	if _, err := os.Stat(gitignore); !os.IsNotExist(err) {
+		t.Errorf("Expected the deleted .gitignore not to come back, got %v", err)
+	}
+
+	cleared, err := storage.ClearReviewStates(repoDir)
+	if err != nil || cleared != 2 {
+		t.Errorf("Expected 2 comparisons cleared, got %d, %v", cleared, err)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, RepoStorageDir)); !os.IsNotExist(err) {
+		t.Errorf("Expected the storage directory to be removed, got %v", err)
+	}
+}
+
+// TestInRepoStorageClearKeepsOtherFiles tests that clearing the review states
+// kept in a repository leaves the rest of its storage directory alone
+func TestInRepoStorageClearKeepsOtherFiles(t *testing.T) {
+	repoDir := t.TempDir()
+	storage, err := OpenStorage(DefaultBackend, Options{Dir: t.TempDir(), InRepo: true})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+
+	state := &models.ReviewState{SourceBranch: "feature", TargetBranch: "main", SourceCommit: "source-commit", TargetCommit: "target-commit"}
+	if err := storage.SaveReviewState(state, repoDir, ""); err != nil {
+		t.Fatalf("Failed to save review state: %v", err)
+	}
+	notes := filepath.Join(repoDir, RepoStorageDir, "notes.md")
+	if err := os.WriteFile(notes, []byte("shared notes\n"), 0644); err != nil {
+		t.Fatalf("Failed to write notes: %v", err)
+	}
+
+	if cleared, err := storage.ClearReviewStates(repoDir); err != nil || cleared != 1 {
+		t.Errorf("Expected 1 comparison cleared, got %d, %v", cleared, err)
+	}
+	for _, name := range []string{"notes.md", ".gitignore"} {
+		if _, err := os.Stat(filepath.Join(repoDir, RepoStorageDir, name)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, RepoStorageDir, "source-commit")); !os.IsNotExist(err) {
+		t.Errorf("Expected the review state's directory to be removed, got %v", err)
+	}
+}
+
+// TestGlobalStorageOutsideRepo tests that the default mode leaves the repositories untouched
+func TestGlobalStorageOutsideRepo(t *testing.T) {
+	repoDir := t.TempDir()
+	storage, err := OpenStorage(DefaultBackend, Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+
+	state := &models.ReviewState{SourceBranch: "feature", TargetBranch: "main", SourceCommit: "source-commit", TargetCommit: "target-commit"}
+	if err := storage.SaveReviewState(state, repoDir, ""); err != nil {
+		t.Fatalf("Failed to save review state: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, RepoStorageDir)); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing stored in the repository, got %v", err)
+	}
+}
+
+// TestInRepoStorageReadOnly tests that reading review states leaves the
+// working tree alone: the storage directory is only created by a save
+func TestInRepoStorageReadOnly(t *testing.T) {
+	repoDir := t.TempDir()
+	opened, err := OpenStorage(DefaultBackend, Options{Dir: t.TempDir(), InRepo: true})
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	if err := opened.SaveRepositories([]string{repoDir}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+
+	if _, err := opened.LoadReviewState(repoDir, "alice", "feature", "main", "source-commit", "target-commit"); err != nil {
+		t.Fatalf("Failed to load review state: %v", err)
+	}
+	if _, err := opened.FindPreviousReviewState(repoDir, "alice", "feature", "main", "source-commit", "target-commit"); err != nil {
+		t.Fatalf("Failed to find previous review state: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, RepoStorageDir)); !os.IsNotExist(err) {
+		t.Errorf("Expected no storage directory in the repository after reading, got %v", err)
+	}
+}
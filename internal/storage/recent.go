@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReviewStateSummary describes a stored review state without its file reviews
+type ReviewStateSummary struct {
+	RepoPath       string
+	User           string // empty in single-user mode
+	SourceBranch   string
+	TargetBranch   string
+	SourceCommit   string
+	TargetCommit   string
+	Files          int       // number of reviewed files
+	Completed      bool      // whether the comparison was signed off
+	LastViewedFile string    // file the reviewer viewed last, if any
+	ChangedFiles   int       // files of the comparison's diff, zero if never recorded
+	Unreviewed     int       // files of the diff without a review, zero if unknown
+	ModTime        time.Time // when the review state was last saved
+}
+
+// ListRecentReviews returns summaries of the most recently saved review states
+// across all repositories, newest first. A limit of zero or less returns them
+// all; otherwise only the newest states are read, until limit of them are
+// listed. States of repositories that can't be told apart from their storage
+// directory, recorded repository or reviewed files are left out.
+func (s *JSONStorage) ListRecentReviews(limit int) ([]ReviewStateSummary, error) {
+	repos, err := s.LoadRepositories()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.listReviewStateFiles(repos)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the modification times are needed to order the states, so they
+	// are read newest first and no more than needed
+	modTimes := make(map[string]time.Time, len(files))
+	stated := files[:0]
+	for _, file := range files {
+		info, err := os.Stat(file.path)
+		if err != nil {
+			continue
+		}
+		modTimes[file.path] = info.ModTime()
+		stated = append(stated, file)
+	}
+	sort.SliceStable(stated, func(i, j int) bool {
+		return modTimes[stated[i].path].After(modTimes[stated[j].path])
+	})
+
+	summaries := []ReviewStateSummary{}
+	for _, file := range stated {
+		if limit > 0 && len(summaries) == limit {
+			break
+		}
+
+		data, err := os.ReadFile(file.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read review state: %w", err)
+		}
+
+		state, err := decodeReviewState(data, file.path)
+		if err != nil {
+			// Skip corrupt states rather than failing the whole listing
+			continue
+		}
+
+		repoPath := file.repoPath
+		if repoPath == "" {
+			repoPath = state.RepoPath
+		}
+		if repoPath == "" && len(state.ReviewedFiles) > 0 {
+			repoPath = state.ReviewedFiles[0].Repo
+		}
+		if repoPath == "" || state.SourceBranch == "" || state.TargetBranch == "" {
+			continue
+		}
+
+		// States saved without a user are named after their directory
+		if state.User == "" {
+			state.User = file.user
+		}
+
+		unreviewed, _ := state.UnreviewedFiles()
+		summaries = append(summaries, ReviewStateSummary{
+			RepoPath:       repoPath,
+			User:           state.User,
+			SourceBranch:   state.SourceBranch,
+			TargetBranch:   state.TargetBranch,
+			SourceCommit:   state.SourceCommit,
+			TargetCommit:   state.TargetCommit,
+			Files:          len(state.ReviewedFiles),
+			Completed:      state.IsCompleted(),
+			ModTime:        modTimes[file.path],
+			LastViewedFile: state.LastViewedFile,
+			ChangedFiles:   state.ChangedFiles,
+			Unreviewed:     unreviewed,
+		})
+	}
+
+	return summaries, nil
+}
+
+// reviewStateFile is a stored review state file along with what its location tells
+type reviewStateFile struct {
+	path string
+	// repoPath is the repository of the state, empty when its storage
+	// directory doesn't match one of the known repositories
+	repoPath string
+	// user is the reviewer named by the users/<name> directory, if any
+	user string
+}
+
+// listReviewStateFiles returns the review state files of every repository.
+// States kept in the repositories are only found for the given ones.
+func (s *JSONStorage) listReviewStateFiles(repos []string) ([]reviewStateFile, error) {
+	var files []reviewStateFile
+	// <source commit>/<target commit>[/users/<user>]/review-state.json below the repository's directory
+	add := func(repoDir, repoPath string) error {
+		for _, pattern := range []string{
+			filepath.Join(repoDir, "*", "*", "review-state.json"),
+			filepath.Join(repoDir, "*", "*", "users", "*", "review-state.json"),
+		} {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return fmt.Errorf("failed to list review states: %w", err)
+			}
+			for _, match := range matches {
+				file := reviewStateFile{path: match, repoPath: repoPath}
+				if rel, err := filepath.Rel(repoDir, match); err == nil {
+					if parts := strings.Split(rel, string(os.PathSeparator)); len(parts) > 3 {
+						// The directory name is the escaped user name, see safeUserName
+						if user, err := url.PathUnescape(parts[3]); err == nil {
+							file.user = user
+						}
+					}
+				}
+				files = append(files, file)
+			}
+		}
+		return nil
+	}
+
+	if s.inRepo {
+		for _, repo := range repos {
+			if err := add(s.getRepoStorageDir(repo), repo); err != nil {
+				return nil, err
+			}
+		}
+		return files, nil
+	}
+
+	// Storage directories can't be turned back into paths, so match them against the known repositories
+	repoDirs := make(map[string]string, len(repos))
+	for _, repo := range repos {
+		repoDirs[s.getRepoStorageDir(repo)] = repo
+	}
+	repoStorageDirs, err := filepath.Glob(filepath.Join(s.baseStoragePath, "*"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list review states: %w", err)
+	}
+	for _, repoDir := range repoStorageDirs {
+		if err := add(repoDir, repoDirs[repoDir]); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
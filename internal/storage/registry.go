@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Options configures a storage backend when it is opened
+type Options struct {
+	// Dir is where the backend keeps its data; empty means the backend's default
+	Dir string
+	// InRepo keeps review states in a RepoStorageDir directory inside each
+	// repository instead of under Dir, so they can be shared through the
+	// repository. The list of repositories stays under Dir.
+	InRepo bool
+}
+
+// Factory opens a storage backend
+type Factory func(opts Options) (Storage, error)
+
+// DefaultBackend is the backend used when none is selected
+const DefaultBackend = "json"
+
+// ErrUnknownBackend is returned when opening a backend that was never registered
+var ErrUnknownBackend = errors.New("unknown storage backend")
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Factory)
+)
+
+func init() {
+	RegisterBackend(DefaultBackend, func(opts Options) (Storage, error) {
+		var s *JSONStorage
+		var err error
+		if opts.Dir == "" {
+			s, err = NewJSONStorage()
+		} else {
+			s, err = newJSONStorageAt(opts.Dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.inRepo = opts.InRepo
+		return s, nil
+	})
+}
+
+// RegisterBackend makes a storage backend available under name. Backends
+// register themselves from an init function; registering the same name twice
+// or a nil factory panics.
+func RegisterBackend(name string, factory Factory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if factory == nil {
+		panic("storage: RegisterBackend factory is nil")
+	}
+	if _, exists := backends[name]; exists {
+		panic("storage: RegisterBackend called twice for backend " + name)
+	}
+	backends[name] = factory
+}
+
+// OpenStorage opens the storage backend registered under name
+func OpenStorage(name string, opts Options) (Storage, error) {
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q (available: %v)", ErrUnknownBackend, name, Backends())
+	}
+	return factory(opts)
+}
+
+// Backends returns the names of the registered storage backends, sorted
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
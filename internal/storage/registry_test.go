@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/darccio/diffty/internal/models"
+)
+
+// fakeStorage is a do-nothing backend used to exercise the registry
+type fakeStorage struct {
+	opts Options
+}
+
+func (f *fakeStorage) SaveReviewState(state *models.ReviewState, repoPath, user string) error {
+	return nil
+}
+
+func (f *fakeStorage) LoadReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error) {
+	return &models.ReviewState{}, nil
+}
+
+func (f *fakeStorage) HasReviewState(repoPath, user, sourceCommit, targetCommit string) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeStorage) FindPreviousReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error) {
+	return nil, nil
+}
+
+func (f *fakeStorage) LoadUserReviewStates(repoPath, sourceCommit, targetCommit string) ([]*models.ReviewState, error) {
+	return nil, nil
+}
+
+func (f *fakeStorage) ListRecentReviews(limit int) ([]ReviewStateSummary, error) {
+	return nil, nil
+}
+
+func (f *fakeStorage) ScanFileReviews(repoPath, filePath string, fn func(FileReviewRecord) error) error {
+	return nil
+}
+
+func (f *fakeStorage) ClearReviewStates(repoPath string) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeStorage) SaveRepositories(repos []string) error {
+	return nil
+}
+
+func (f *fakeStorage) LoadRepositories() ([]string, error) {
+	return nil, nil
+}
+
+func TestRegisterAndOpenBackend(t *testing.T) {
+	RegisterBackend("fake", func(opts Options) (Storage, error) {
+		return &fakeStorage{opts: opts}, nil
+	})
+	t.Cleanup(func() {
+		backendsMu.Lock()
+		delete(backends, "fake")
+		backendsMu.Unlock()
+	})
+
+	store, err := OpenStorage("fake", Options{Dir: "/somewhere"})
+	if err != nil {
+		t.Fatalf("OpenStorage failed: %v", err)
+	}
+	fake, ok := store.(*fakeStorage)
+	if !ok || fake.opts.Dir != "/somewhere" {
+		t.Errorf("Expected the fake backend with its options, got %#v", store)
+	}
+
+	names := Backends()
+	if len(names) != 2 || names[0] != "fake" || names[1] != DefaultBackend {
+		t.Errorf("Expected the fake and default backends, got %v", names)
+	}
+
+	// Registering a name twice is a programming error
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a backend twice to panic")
+		}
+	}()
+	RegisterBackend("fake", func(opts Options) (Storage, error) { return nil, nil })
+}
+
+func TestOpenStorage(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), ".diffty")
+
+	store, err := OpenStorage(DefaultBackend, Options{Dir: dir})
+	if err != nil {
+		t.Fatalf("OpenStorage failed: %v", err)
+	}
+	if jsonStore, ok := store.(*JSONStorage); !ok || jsonStore.Path() != dir {
+		t.Errorf("Expected a JSON storage in %s, got %#v", dir, store)
+	}
+
+	if _, err := OpenStorage("bogus", Options{}); !errors.Is(err, ErrUnknownBackend) {
+		t.Errorf("Expected ErrUnknownBackend, got %v", err)
+	}
+}
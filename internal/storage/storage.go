@@ -3,17 +3,27 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/darccio/diffty/internal/models"
 )
 
-// Storage interface defines methods for persisting and retrieving data
+// Storage interface defines methods for persisting and retrieving data.
+// Review states are kept per user; the empty user is the single-user mode
+// used when authentication is disabled.
 type Storage interface {
-	SaveReviewState(state *models.ReviewState, repoPath string) error
-	LoadReviewState(repoPath, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error)
+	SaveReviewState(state *models.ReviewState, repoPath, user string) error
+	LoadReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error)
+	HasReviewState(repoPath, user, sourceCommit, targetCommit string) (bool, error)
+	FindPreviousReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error)
+	LoadUserReviewStates(repoPath, sourceCommit, targetCommit string) ([]*models.ReviewState, error)
+	ListRecentReviews(limit int) ([]ReviewStateSummary, error)
+	ScanFileReviews(repoPath, filePath string, fn func(FileReviewRecord) error) error
+	ClearReviewStates(repoPath string) (int, error)
 	SaveRepositories(repos []string) error
 	LoadRepositories() ([]string, error)
 }
@@ -22,8 +32,21 @@ type Storage interface {
 type JSONStorage struct {
 	baseStoragePath string
 	reposPath       string
+	// inRepo keeps review states inside the repositories, see Options.InRepo
+	inRepo bool
 }
 
+// RepoStorageDir is the directory review states are kept in inside a
+// repository when they are stored with it
+const RepoStorageDir = ".diffty"
+
+// repoStorageGitignore keeps in-repo review states out of commits until the
+// user deletes it to share them
+const repoStorageGitignore = `# Review states of diffty, kept out of commits.
+# Delete this file to commit them and share the reviews through the repository.
+*
+`
+
 // NewJSONStorage creates a new JSONStorage instance
 func NewJSONStorage() (*JSONStorage, error) {
 	homeDir, err := os.UserHomeDir()
@@ -31,8 +54,12 @@ func NewJSONStorage() (*JSONStorage, error) {
 		return nil, fmt.Errorf("failed to get home directory: %w", err)
 	}
 
-	// Ensure .diffty directory exists
-	storageDir := filepath.Join(homeDir, ".diffty")
+	return newJSONStorageAt(filepath.Join(homeDir, ".diffty"))
+}
+
+// newJSONStorageAt creates a JSONStorage keeping its files in storageDir
+func newJSONStorageAt(storageDir string) (*JSONStorage, error) {
+	// Ensure the storage directory exists
 	if err := os.MkdirAll(storageDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create storage directory: %w", err)
 	}
@@ -43,49 +70,152 @@ func NewJSONStorage() (*JSONStorage, error) {
 	}, nil
 }
 
-// getReviewStatePath returns the path to the review state file
-func (s *JSONStorage) getReviewStatePath(repoPath, sourceCommit, targetCommit string) string {
+// getRepoStorageDir returns the directory holding all review states of a repository
+func (s *JSONStorage) getRepoStorageDir(repoPath string) string {
+	if s.inRepo {
+		return filepath.Join(repoPath, RepoStorageDir)
+	}
+
 	// Create a safe repository path by replacing special characters
 	safeRepoPath := strings.ReplaceAll(repoPath, string(os.PathSeparator), "_")
 	safeRepoPath = strings.ReplaceAll(safeRepoPath, ":", "_")
 
-	// Create directory structure: .diffty/repository/first-branch-commit-hash/second-branch-commit-hash
-	reviewDir := filepath.Join(s.baseStoragePath, safeRepoPath, sourceCommit, targetCommit)
+	return filepath.Join(s.baseStoragePath, safeRepoPath)
+}
 
-	// Ensure the directory exists
-	if err := os.MkdirAll(reviewDir, 0755); err != nil {
-		// Just log error, don't fail
-		fmt.Printf("Warning: failed to create review directory: %v\n", err)
+// safeUserName turns a user name into a single, harmless path component.
+// Bytes other than letters, digits and ._@- are percent-escaped, '%' among
+// them, so two names never share a directory; "." and ".." are escaped whole.
+func safeUserName(user string) string {
+	if user == "." || user == ".." {
+		return strings.Repeat("%2E", len(user))
+	}
+	var safe strings.Builder
+	for i := 0; i < len(user); i++ {
+		if c := user[i]; isSafeUserChar(c) {
+			safe.WriteByte(c)
+		} else {
+			fmt.Fprintf(&safe, "%%%02X", c)
+		}
 	}
+	return safe.String()
+}
+
+// isSafeUserChar reports whether c is kept as is in user directory names
+func isSafeUserChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("._@-", c) >= 0
+}
 
+// reviewStatePath returns the path to the review state file, without creating
+// any directory: .diffty/repository/first-branch-commit-hash/second-branch-commit-hash,
+// with a users/<name> subdirectory per reviewer when a user is given
+func (s *JSONStorage) reviewStatePath(repoPath, user, sourceCommit, targetCommit string) string {
+	reviewDir := filepath.Join(s.getRepoStorageDir(repoPath), sourceCommit, targetCommit)
+	if user != "" {
+		reviewDir = filepath.Join(reviewDir, "users", safeUserName(user))
+	}
 	return filepath.Join(reviewDir, "review-state.json")
 }
 
+// createRepoStorageDir creates the in-repo storage directory of a repository
+// with a .gitignore ignoring it, so review states aren't committed by
+// accident. An existing directory is left alone: its .gitignore may have been
+// deleted on purpose to share the reviews.
+func (s *JSONStorage) createRepoStorageDir(repoPath string) error {
+	dir := s.getRepoStorageDir(repoPath)
+	if _, err := os.Stat(dir); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ".gitignore"), []byte(repoStorageGitignore), 0644)
+}
+
 // SaveReviewState saves the review state to a JSON file
-func (s *JSONStorage) SaveReviewState(state *models.ReviewState, repoPath string) error {
+func (s *JSONStorage) SaveReviewState(state *models.ReviewState, repoPath, user string) error {
 	if state.SourceCommit == "" || state.TargetCommit == "" {
 		return fmt.Errorf("source and target commit hashes are required")
 	}
 
-	storagePath := s.getReviewStatePath(repoPath, state.SourceCommit, state.TargetCommit)
+	storagePath := s.reviewStatePath(repoPath, user, state.SourceCommit, state.TargetCommit)
+
+	// Directories are only created once there's something to write, so
+	// reading a state never leaves any behind
+	if s.inRepo {
+		if err := s.createRepoStorageDir(repoPath); err != nil {
+			return fmt.Errorf("failed to create review directory: %w", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(storagePath), 0755); err != nil {
+		return fmt.Errorf("failed to create review directory: %w", err)
+	}
+
+	// States read from a newer version keep their version so it isn't downgraded
+	versioned := *state
+	versioned.RepoPath = repoPath
+	if versioned.SchemaVersion < models.CurrentSchemaVersion {
+		versioned.SchemaVersion = models.CurrentSchemaVersion
+	}
 
-	data, err := json.MarshalIndent(state, "", "  ")
+	data, err := json.MarshalIndent(&versioned, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal review state: %w", err)
 	}
 
-	if err := os.WriteFile(storagePath, data, 0644); err != nil {
+	if err := writeFileAtomic(storagePath, data); err != nil {
 		return fmt.Errorf("failed to write review state: %w", err)
 	}
 
 	return nil
 }
 
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// HasReviewState reports whether a review state is stored for the commits,
+// without creating anything on the way, so a state can be looked for without
+// leaving empty directories behind
+func (s *JSONStorage) HasReviewState(repoPath, user, sourceCommit, targetCommit string) (bool, error) {
+	if sourceCommit == "" || targetCommit == "" {
+		return false, nil
+	}
+	_, err := os.Stat(s.reviewStatePath(repoPath, user, sourceCommit, targetCommit))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 // LoadReviewState loads the review state from a JSON file
-func (s *JSONStorage) LoadReviewState(repoPath, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error) {
+func (s *JSONStorage) LoadReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error) {
 	if sourceCommit == "" || targetCommit == "" {
 		return &models.ReviewState{
+			SchemaVersion: models.CurrentSchemaVersion,
 			ReviewedFiles: []models.FileReview{},
+			User:          user,
 			SourceBranch:  sourceBranch,
 			TargetBranch:  targetBranch,
 			SourceCommit:  sourceCommit,
@@ -93,13 +223,15 @@ func (s *JSONStorage) LoadReviewState(repoPath, sourceBranch, targetBranch, sour
 		}, nil
 	}
 
-	storagePath := s.getReviewStatePath(repoPath, sourceCommit, targetCommit)
+	storagePath := s.reviewStatePath(repoPath, user, sourceCommit, targetCommit)
 
 	// Check if the file exists
 	if _, err := os.Stat(storagePath); os.IsNotExist(err) {
 		// Return empty state if file doesn't exist
 		return &models.ReviewState{
+			SchemaVersion: models.CurrentSchemaVersion,
 			ReviewedFiles: []models.FileReview{},
+			User:          user,
 			SourceBranch:  sourceBranch,
 			TargetBranch:  targetBranch,
 			SourceCommit:  sourceCommit,
@@ -112,14 +244,204 @@ func (s *JSONStorage) LoadReviewState(repoPath, sourceBranch, targetBranch, sour
 		return nil, fmt.Errorf("failed to read review state: %w", err)
 	}
 
+	state, err := decodeReviewState(data, storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal review state: %w", err)
+	}
+
+	return state, nil
+}
+
+// decodeReviewState parses a stored review state and upgrades it to the
+// current schema version. States saved by a newer diffty are read best-effort,
+// with a warning, rather than rejected.
+func decodeReviewState(data []byte, path string) (*models.ReviewState, error) {
 	var state models.ReviewState
 	if err := json.Unmarshal(data, &state); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal review state: %w", err)
+		return nil, err
+	}
+
+	if state.Migrate() {
+		fmt.Printf("Warning: review state %s has schema version %d, newer than the supported %d; reading it best-effort\n",
+			path, state.SchemaVersion, models.CurrentSchemaVersion)
 	}
 
 	return &state, nil
 }
 
+// FindPreviousReviewState returns the most recently saved review state for the
+// same branch pair recorded against a different commit pair, or nil if there is none
+func (s *JSONStorage) FindPreviousReviewState(repoPath, user, sourceBranch, targetBranch, sourceCommit, targetCommit string) (*models.ReviewState, error) {
+	pattern := filepath.Join(s.getRepoStorageDir(repoPath), "*", "*", "review-state.json")
+	if user != "" {
+		pattern = filepath.Join(s.getRepoStorageDir(repoPath), "*", "*", "users", safeUserName(user), "review-state.json")
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list review states: %w", err)
+	}
+
+	currentPath := s.reviewStatePath(repoPath, user, sourceCommit, targetCommit)
+
+	var latest *models.ReviewState
+	var latestModTime time.Time
+	for _, match := range matches {
+		if match == currentPath {
+			continue
+		}
+
+		info, err := os.Stat(match)
+		if err != nil || (latest != nil && !info.ModTime().After(latestModTime)) {
+			continue
+		}
+
+		data, err := os.ReadFile(match)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read review state: %w", err)
+		}
+
+		state, err := decodeReviewState(data, match)
+		if err != nil {
+			// Skip corrupt states rather than failing the whole lookup
+			continue
+		}
+
+		if state.SourceBranch != sourceBranch || state.TargetBranch != targetBranch {
+			continue
+		}
+
+		latest = state
+		latestModTime = info.ModTime()
+	}
+
+	return latest, nil
+}
+
+// LoadUserReviewStates loads the review states every user recorded for a commit
+// pair, so their reviews can be aggregated. The single-user state isn't included.
+func (s *JSONStorage) LoadUserReviewStates(repoPath, sourceCommit, targetCommit string) ([]*models.ReviewState, error) {
+	pattern := filepath.Join(s.getRepoStorageDir(repoPath), sourceCommit, targetCommit, "users", "*", "review-state.json")
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list review states: %w", err)
+	}
+
+	states := []*models.ReviewState{}
+	for _, match := range matches {
+		data, err := os.ReadFile(match)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read review state: %w", err)
+		}
+
+		state, err := decodeReviewState(data, match)
+		if err != nil {
+			// Skip corrupt states rather than failing the whole aggregate
+			continue
+		}
+
+		// States saved without a user are named after their directory
+		if state.User == "" {
+			state.User = filepath.Base(filepath.Dir(match))
+			if user, err := url.PathUnescape(state.User); err == nil {
+				state.User = user
+			}
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// ClearReviewStates removes every review state of a repository, of all users
+// and commit pairs, and returns how many comparisons had one. The repository
+// itself stays registered. Only review state files are removed, along with
+// the directories they leave empty: anything else in the storage directory,
+// such as the .gitignore of in-repo storage, is kept. A storage directory
+// other registered repositories map to as well is shared with them, so only
+// the states whose reviewed files are of repoPath are removed from it.
+func (s *JSONStorage) ClearReviewStates(repoPath string) (int, error) {
+	if repoPath == "" {
+		return 0, fmt.Errorf("repository path is required")
+	}
+
+	repoDir := s.getRepoStorageDir(repoPath)
+	shared := false
+	if !s.inRepo {
+		repos, err := s.LoadRepositories()
+		if err != nil {
+			return 0, err
+		}
+		for _, repo := range repos {
+			if repo != repoPath && s.getRepoStorageDir(repo) == repoDir {
+				shared = true
+			}
+		}
+	}
+
+	comparisons := make(map[string]bool)
+	for _, pattern := range []string{
+		filepath.Join(repoDir, "*", "*", "review-state.json"),
+		filepath.Join(repoDir, "*", "*", "users", "*", "review-state.json"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list review states: %w", err)
+		}
+		for _, match := range matches {
+			if shared && !isReviewStateOf(match, repoPath) {
+				continue
+			}
+			if err := os.Remove(match); err != nil {
+				return 0, fmt.Errorf("failed to remove review state: %w", err)
+			}
+			removeEmptyDirs(filepath.Dir(match), repoDir)
+
+			// <source commit>/<target commit> names the comparison
+			rel, err := filepath.Rel(repoDir, match)
+			if err != nil {
+				continue
+			}
+			parts := strings.SplitN(rel, string(os.PathSeparator), 3)
+			comparisons[filepath.Join(parts[0], parts[1])] = true
+		}
+	}
+
+	// Nothing else in the storage directory, so it goes too
+	os.Remove(repoDir)
+
+	return len(comparisons), nil
+}
+
+// isReviewStateOf reports whether the review state stored at path was saved
+// for repoPath, telling states in a shared storage directory apart. States
+// saved before the repository was recorded are told by their reviewed files.
+// Unreadable states aren't.
+func isReviewStateOf(path, repoPath string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	state, err := decodeReviewState(data, path)
+	if err != nil {
+		return false
+	}
+	if state.RepoPath != "" {
+		return state.RepoPath == repoPath
+	}
+	return len(state.ReviewedFiles) > 0 && state.ReviewedFiles[0].Repo == repoPath
+}
+
+// removeEmptyDirs removes dir and its parents up to, but not including, stop
+// for as long as they are empty
+func removeEmptyDirs(dir, stop string) {
+	for dir != stop && strings.HasPrefix(dir, stop+string(os.PathSeparator)) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
 // SaveRepositories saves the repository paths to a JSON file
 func (s *JSONStorage) SaveRepositories(repos []string) error {
 	data, err := json.MarshalIndent(repos, "", "  ")
@@ -3,7 +3,9 @@ package storage
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/darccio/diffty/internal/models"
 )
@@ -47,15 +49,16 @@ func TestJSONStorage(t *testing.T) {
 			TargetBranch: "main",
 			SourceCommit: "abc123",
 			TargetCommit: "def456",
+			Description:  "Payments refactor\nFocus on error handling",
 		}
 
 		// Save the test state
-		if err := storage.SaveReviewState(testState, "/path/to/repo"); err != nil {
+		if err := storage.SaveReviewState(testState, "/path/to/repo", ""); err != nil {
 			t.Fatalf("Failed to save review state: %v", err)
 		}
 
 		// Load the test state
-		loadedState, err := storage.LoadReviewState("/path/to/repo", "feature", "main", "abc123", "def456")
+		loadedState, err := storage.LoadReviewState("/path/to/repo", "", "feature", "main", "abc123", "def456")
 		if err != nil {
 			t.Fatalf("Failed to load review state: %v", err)
 		}
@@ -73,6 +76,10 @@ func TestJSONStorage(t *testing.T) {
 			t.Errorf("Expected file path to be 'test/file.go', got '%s'", loadedState.ReviewedFiles[0].Path)
 		}
 
+		if loadedState.Description != testState.Description {
+			t.Errorf("Expected description %q, got %q", testState.Description, loadedState.Description)
+		}
+
 		if len(loadedState.ReviewedFiles[0].Lines) != 3 {
 			t.Errorf("Expected 3 lines, got %d", len(loadedState.ReviewedFiles[0].Lines))
 		}
@@ -109,7 +116,7 @@ func TestJSONStorage(t *testing.T) {
 	// Test LoadReviewState with missing file
 	t.Run("LoadMissingReviewState", func(t *testing.T) {
 		// Load a non-existent review state
-		loadedState, err := storage.LoadReviewState("/nonexistent/repo", "feature", "main", "abc123", "def456")
+		loadedState, err := storage.LoadReviewState("/nonexistent/repo", "", "feature", "main", "abc123", "def456")
 		if err != nil {
 			t.Fatalf("Failed to load non-existent review state: %v", err)
 		}
@@ -136,6 +143,25 @@ func TestJSONStorage(t *testing.T) {
 		}
 	})
 
+	t.Run("HasReviewState", func(t *testing.T) {
+		exists, err := storage.HasReviewState("/unreviewed/repo", "", "abc123", "def456")
+		if err != nil || exists {
+			t.Errorf("Expected no review state, got %v: %v", exists, err)
+		}
+		// Looking doesn't create the state's directory
+		if _, err := os.Stat(storage.getRepoStorageDir("/unreviewed/repo")); !os.IsNotExist(err) {
+			t.Errorf("Expected no storage directory for the repository, got %v", err)
+		}
+
+		state := &models.ReviewState{SourceBranch: "feature", TargetBranch: "main", SourceCommit: "abc123", TargetCommit: "def456"}
+		if err := storage.SaveReviewState(state, "/unreviewed/repo", ""); err != nil {
+			t.Fatalf("Failed to save review state: %v", err)
+		}
+		if exists, err := storage.HasReviewState("/unreviewed/repo", "", "abc123", "def456"); err != nil || !exists {
+			t.Errorf("Expected the saved review state, got %v: %v", exists, err)
+		}
+	})
+
 	// Test SaveReviewState with missing commit hashes
 	t.Run("MissingCommitHashes", func(t *testing.T) {
 		testState := &models.ReviewState{
@@ -153,12 +179,122 @@ func TestJSONStorage(t *testing.T) {
 			// Missing commit hashes
 		}
 
-		err := storage.SaveReviewState(testState, "/path/to/repo")
+		err := storage.SaveReviewState(testState, "/path/to/repo", "")
 		if err == nil {
 			t.Errorf("Expected error for missing commit hashes, got nil")
 		}
 	})
 
+	// Test FindPreviousReviewState
+	t.Run("FindPreviousReviewState", func(t *testing.T) {
+		repoPath := "/path/to/moving/repo"
+
+		// Nothing stored yet
+		previous, err := storage.FindPreviousReviewState(repoPath, "", "feature", "main", "new111", "main111")
+		if err != nil {
+			t.Fatalf("Failed to find previous review state: %v", err)
+		}
+		if previous != nil {
+			t.Fatalf("Expected no previous review state, got %+v", previous)
+		}
+
+		states := []*models.ReviewState{
+			{SourceBranch: "feature", TargetBranch: "main", SourceCommit: "old111", TargetCommit: "main111"},
+			{SourceBranch: "feature", TargetBranch: "main", SourceCommit: "old222", TargetCommit: "main111"},
+			{SourceBranch: "other", TargetBranch: "main", SourceCommit: "other111", TargetCommit: "main111"},
+			{SourceBranch: "feature", TargetBranch: "main", SourceCommit: "new111", TargetCommit: "main111"},
+		}
+
+		base := time.Now().Add(-time.Hour)
+		for i, state := range states {
+			if err := storage.SaveReviewState(state, repoPath, ""); err != nil {
+				t.Fatalf("Failed to save review state: %v", err)
+			}
+
+			// Give each state a distinct, increasing modification time
+			statePath := storage.reviewStatePath(repoPath, "", state.SourceCommit, state.TargetCommit)
+			modTime := base.Add(time.Duration(i) * time.Minute)
+			if err := os.Chtimes(statePath, modTime, modTime); err != nil {
+				t.Fatalf("Failed to set modification time: %v", err)
+			}
+		}
+
+		previous, err = storage.FindPreviousReviewState(repoPath, "", "feature", "main", "new111", "main111")
+		if err != nil {
+			t.Fatalf("Failed to find previous review state: %v", err)
+		}
+
+		// The current pair and other branches are excluded; the newest remaining wins
+		if previous == nil || previous.SourceCommit != "old222" {
+			t.Errorf("Expected previous review state for commit old222, got %+v", previous)
+		}
+	})
+
+	// Test per-user review states
+	t.Run("UserReviewStates", func(t *testing.T) {
+		repoPath := "/path/to/shared/repo"
+
+		shared := &models.ReviewState{
+			ReviewedFiles: []models.FileReview{{Repo: repoPath, Path: "a.go", Lines: map[string]string{"all": models.StateSkipped}}},
+			SourceCommit:  "src111",
+			TargetCommit:  "tgt111",
+		}
+		if err := storage.SaveReviewState(shared, repoPath, ""); err != nil {
+			t.Fatalf("Failed to save shared review state: %v", err)
+		}
+
+		for user, status := range map[string]string{"alice": models.StateApproved, "../bob": models.StateRejected} {
+			state, err := storage.LoadReviewState(repoPath, user, "feature", "main", "src111", "tgt111")
+			if err != nil {
+				t.Fatalf("Failed to load review state of %s: %v", user, err)
+			}
+			if len(state.ReviewedFiles) != 0 || state.User != user {
+				t.Fatalf("Expected an empty state for %s, got %+v", user, state)
+			}
+
+			state.ReviewedFiles = append(state.ReviewedFiles, models.FileReview{Repo: repoPath, Path: "a.go", Lines: map[string]string{"all": status}})
+			if err := storage.SaveReviewState(state, repoPath, user); err != nil {
+				t.Fatalf("Failed to save review state of %s: %v", user, err)
+			}
+		}
+
+		// Users don't clobber each other nor the single-user state
+		alice, err := storage.LoadReviewState(repoPath, "alice", "feature", "main", "src111", "tgt111")
+		if err != nil {
+			t.Fatalf("Failed to load review state: %v", err)
+		}
+		if alice.ReviewedFiles[0].Lines["all"] != models.StateApproved {
+			t.Errorf("Expected alice's review to be kept, got %+v", alice.ReviewedFiles)
+		}
+
+		loaded, err := storage.LoadReviewState(repoPath, "", "feature", "main", "src111", "tgt111")
+		if err != nil {
+			t.Fatalf("Failed to load review state: %v", err)
+		}
+		if loaded.ReviewedFiles[0].Lines["all"] != models.StateSkipped {
+			t.Errorf("Expected the single-user review to be kept, got %+v", loaded.ReviewedFiles)
+		}
+
+		// User names can't escape their directory
+		bobPath := storage.reviewStatePath(repoPath, "../bob", "src111", "tgt111")
+		if !strings.Contains(bobPath, filepath.Join("users", "..%2Fbob")) {
+			t.Errorf("Expected a sanitized user directory, got %s", bobPath)
+		}
+
+		states, err := storage.LoadUserReviewStates(repoPath, "src111", "tgt111")
+		if err != nil {
+			t.Fatalf("Failed to load user review states: %v", err)
+		}
+
+		users := map[string]bool{}
+		for _, state := range states {
+			users[state.User] = true
+		}
+		if len(states) != 2 || !users["alice"] || !users["../bob"] {
+			t.Errorf("Expected the states of alice and ../bob, got %+v", states)
+		}
+	})
+
 	// Test SaveRepositories and LoadRepositories
 	t.Run("Repositories", func(t *testing.T) {
 		// Save repositories
@@ -242,3 +378,365 @@ func TestNewJSONStorage(t *testing.T) {
 		t.Errorf("Expected reposPath to be '%s', got '%s'", expectedReposPath, storage.reposPath)
 	}
 }
+
+func TestReviewStateSchemaVersion(t *testing.T) {
+	storage, err := newJSONStorageAt(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create JSON storage: %v", err)
+	}
+
+	repoPath := "/path/to/repo"
+	writeState := func(sourceCommit, document string) {
+		t.Helper()
+		path := storage.reviewStatePath(repoPath, "", sourceCommit, "target-commit")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create review directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(document), 0644); err != nil {
+			t.Fatalf("Failed to write review state: %v", err)
+		}
+	}
+
+	t.Run("UpgradesVersion0", func(t *testing.T) {
+		// A document saved before versioning, with a file lacking its line map
+		writeState("v0-commit", `{
+  "reviewed_files": [
+    {"repo": "/path/to/repo", "path": "a.go", "lines": {"all": "approved"}},
+    {"repo": "/path/to/repo", "path": "b.go"}
+  ],
+  "source_branch": "feature",
+  "target_branch": "main",
+  "source_commit": "v0-commit",
+  "target_commit": "target-commit"
+}`)
+
+		state, err := storage.LoadReviewState(repoPath, "", "feature", "main", "v0-commit", "target-commit")
+		if err != nil {
+			t.Fatalf("Failed to load version 0 review state: %v", err)
+		}
+
+		if state.SchemaVersion != models.CurrentSchemaVersion {
+			t.Errorf("Expected schema version %d, got %d", models.CurrentSchemaVersion, state.SchemaVersion)
+		}
+		if len(state.ReviewedFiles) != 2 {
+			t.Fatalf("Expected 2 reviewed files, got %d", len(state.ReviewedFiles))
+		}
+		if state.ReviewedFiles[0].Lines["all"] != models.StateApproved {
+			t.Errorf("Expected a.go to stay approved, got %v", state.ReviewedFiles[0].Lines)
+		}
+		if state.ReviewedFiles[1].Lines == nil {
+			t.Error("Expected the missing line map to be filled in")
+		}
+
+		// Saving the upgraded state records the current version
+		if err := storage.SaveReviewState(state, repoPath, ""); err != nil {
+			t.Fatalf("Failed to save review state: %v", err)
+		}
+		data, err := os.ReadFile(storage.reviewStatePath(repoPath, "", "v0-commit", "target-commit"))
+		if err != nil {
+			t.Fatalf("Failed to read saved review state: %v", err)
+		}
+		if !strings.Contains(string(data), `"schema_version": 1`) {
+			t.Errorf("Expected the saved state to carry its schema version, got:\n%s", data)
+		}
+	})
+
+	t.Run("MissingFileList", func(t *testing.T) {
+		writeState("empty-commit", `{"source_commit": "empty-commit", "target_commit": "target-commit"}`)
+
+		state, err := storage.LoadReviewState(repoPath, "", "feature", "main", "empty-commit", "target-commit")
+		if err != nil {
+			t.Fatalf("Failed to load review state: %v", err)
+		}
+		if state.ReviewedFiles == nil {
+			t.Error("Expected the missing file list to be filled in")
+		}
+	})
+
+	t.Run("NewerVersionReadBestEffort", func(t *testing.T) {
+		writeState("v99-commit", `{
+  "schema_version": 99,
+  "reviewed_files": [
+    {"repo": "/path/to/repo", "path": "a.go", "lines": {"all": "rejected"}, "future_field": true}
+  ],
+  "source_branch": "feature",
+  "target_branch": "main",
+  "source_commit": "v99-commit",
+  "target_commit": "target-commit",
+  "comments": []
+}`)
+
+		state, err := storage.LoadReviewState(repoPath, "", "feature", "main", "v99-commit", "target-commit")
+		if err != nil {
+			t.Fatalf("Expected a newer review state to load, got: %v", err)
+		}
+		if state.SchemaVersion != 99 {
+			t.Errorf("Expected the newer schema version to be kept, got %d", state.SchemaVersion)
+		}
+		if status, _ := state.FileStatus(repoPath, "a.go"); status != models.StateRejected {
+			t.Errorf("Expected the known fields to be read, got status %q", status)
+		}
+	})
+}
+
+// TestUserNamesDontCollide tests that user names differing only in the
+// characters escaped in directory names keep their own review states
+func TestUserNamesDontCollide(t *testing.T) {
+	storage, err := newJSONStorageAt(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create JSON storage: %v", err)
+	}
+
+	users := []string{"alice smith", "alice/smith", "alice_smith", "alice%20smith", ".", "%2E"}
+	dirs := map[string]string{}
+	for _, user := range users {
+		dir := safeUserName(user)
+		if other, ok := dirs[dir]; ok {
+			t.Errorf("Expected %q and %q in different directories, both got %q", user, other, dir)
+		}
+		dirs[dir] = user
+		if dir == "." || dir == ".." || strings.ContainsRune(dir, filepath.Separator) {
+			t.Errorf("Expected a single harmless path component for %q, got %q", user, dir)
+		}
+
+		state := &models.ReviewState{
+			SourceBranch:  "feature",
+			TargetBranch:  "main",
+			SourceCommit:  "src",
+			TargetCommit:  "tgt",
+			Description:   user,
+			ReviewedFiles: []models.FileReview{},
+		}
+		if err := storage.SaveReviewState(state, "/repo", user); err != nil {
+			t.Fatalf("Failed to save review state of %q: %v", user, err)
+		}
+	}
+
+	for _, user := range users {
+		state, err := storage.LoadReviewState("/repo", user, "feature", "main", "src", "tgt")
+		if err != nil {
+			t.Fatalf("Failed to load review state of %q: %v", user, err)
+		}
+		if state.Description != user {
+			t.Errorf("Expected %q to read their own review state, got the one of %q", user, state.Description)
+		}
+	}
+
+	states, err := storage.LoadUserReviewStates("/repo", "src", "tgt")
+	if err != nil {
+		t.Fatalf("Failed to load user review states: %v", err)
+	}
+	if len(states) != len(users) {
+		t.Errorf("Expected %d user review states, got %d", len(users), len(states))
+	}
+}
+
+func TestListRecentReviews(t *testing.T) {
+	storage, err := newJSONStorageAt(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create JSON storage: %v", err)
+	}
+
+	if err := storage.SaveRepositories([]string{"/path/to/repo", "/path/to/other"}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+
+	save := func(repoPath, user, sourceBranch, sourceCommit string, age time.Duration) {
+		t.Helper()
+		state := &models.ReviewState{
+			ReviewedFiles: []models.FileReview{
+				{Repo: repoPath, Path: "a.go", Lines: map[string]string{"all": models.StateApproved}},
+			},
+			SourceBranch: sourceBranch,
+			TargetBranch: "main",
+			SourceCommit: sourceCommit,
+			TargetCommit: "target-commit",
+		}
+		if err := storage.SaveReviewState(state, repoPath, user); err != nil {
+			t.Fatalf("Failed to save review state: %v", err)
+		}
+
+		modTime := time.Now().Add(-age)
+		path := storage.reviewStatePath(repoPath, user, sourceCommit, "target-commit")
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	save("/path/to/repo", "", "feature", "old-commit", 3*time.Hour)
+	save("/path/to/repo", "", "feature", "new-commit", time.Hour)
+	save("/path/to/other", "alice", "topic", "alice-commit", 2*time.Hour)
+	// Not in the repository list, so only its reviewed files tell where it belongs
+	save("/path/to/unlisted", "", "fix", "unlisted-commit", 4*time.Hour)
+
+	summaries, err := storage.ListRecentReviews(0)
+	if err != nil {
+		t.Fatalf("Failed to list recent reviews: %v", err)
+	}
+
+	var got []string
+	for _, summary := range summaries {
+		got = append(got, summary.RepoPath+"@"+summary.SourceCommit)
+	}
+	expected := []string{
+		"/path/to/repo@new-commit",
+		"/path/to/other@alice-commit",
+		"/path/to/repo@old-commit",
+		"/path/to/unlisted@unlisted-commit",
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected %v, newest first, got %v", expected, got)
+	}
+
+	alice := summaries[1]
+	if alice.User != "alice" || alice.SourceBranch != "topic" || alice.TargetBranch != "main" || alice.Files != 1 {
+		t.Errorf("Unexpected summary: %+v", alice)
+	}
+
+	limited, err := storage.ListRecentReviews(2)
+	if err != nil {
+		t.Fatalf("Failed to list recent reviews: %v", err)
+	}
+	if len(limited) != 2 || limited[0].SourceCommit != "new-commit" {
+		t.Errorf("Expected the 2 newest reviews, got %+v", limited)
+	}
+
+	// Older states aren't read once the limit is reached
+	unreadable := storage.reviewStatePath("/path/to/unlisted", "", "unlisted-commit", "target-commit")
+	if err := os.Remove(unreadable); err != nil {
+		t.Fatalf("Failed to remove review state: %v", err)
+	}
+	if err := os.Mkdir(unreadable, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	old := time.Now().Add(-4 * time.Hour)
+	if err := os.Chtimes(unreadable, old, old); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	if _, err := storage.ListRecentReviews(0); err == nil {
+		t.Error("Expected an error reading every state")
+	}
+	if limited, err := storage.ListRecentReviews(2); err != nil || len(limited) != 2 {
+		t.Errorf("Expected the 2 newest reviews without reading the older ones, got %+v, %v", limited, err)
+	}
+}
+
+func TestClearReviewStates(t *testing.T) {
+	storage, err := newJSONStorageAt(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create JSON storage: %v", err)
+	}
+
+	if err := storage.SaveRepositories([]string{"/repo", "/other"}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+
+	save := func(repoPath, user, sourceCommit, targetCommit string) {
+		t.Helper()
+		state := &models.ReviewState{
+			SourceBranch:  "feature",
+			TargetBranch:  "main",
+			SourceCommit:  sourceCommit,
+			TargetCommit:  targetCommit,
+			ReviewedFiles: []models.FileReview{{Repo: repoPath, Path: "a.go", Lines: map[string]string{"all": models.StateApproved}}},
+		}
+		if err := storage.SaveReviewState(state, repoPath, user); err != nil {
+			t.Fatalf("Failed to save review state: %v", err)
+		}
+	}
+
+	// Two comparisons of /repo, one of them reviewed by two users as well
+	save("/repo", "", "aaa", "bbb")
+	save("/repo", "alice", "aaa", "bbb")
+	save("/repo", "bob", "aaa", "bbb")
+	save("/repo", "", "ccc", "bbb")
+	save("/other", "", "aaa", "bbb")
+
+	cleared, err := storage.ClearReviewStates("/repo")
+	if err != nil {
+		t.Fatalf("ClearReviewStates failed: %v", err)
+	}
+	if cleared != 2 {
+		t.Errorf("Expected 2 comparisons to be cleared, got %d", cleared)
+	}
+
+	for _, user := range []string{"", "alice", "bob"} {
+		state, err := storage.LoadReviewState("/repo", user, "feature", "main", "aaa", "bbb")
+		if err != nil {
+			t.Fatalf("LoadReviewState failed: %v", err)
+		}
+		if len(state.ReviewedFiles) != 0 {
+			t.Errorf("Expected an empty review state for user %q after clearing, got %v", user, state.ReviewedFiles)
+		}
+	}
+	if state, _ := storage.LoadReviewState("/repo", "", "feature", "main", "ccc", "bbb"); len(state.ReviewedFiles) != 0 {
+		t.Errorf("Expected every comparison to be cleared, got %v", state.ReviewedFiles)
+	}
+
+	// Other repositories and the registration are left alone
+	if state, _ := storage.LoadReviewState("/other", "", "feature", "main", "aaa", "bbb"); len(state.ReviewedFiles) != 1 {
+		t.Errorf("Expected the other repository to keep its review, got %v", state.ReviewedFiles)
+	}
+	if repos, _ := storage.LoadRepositories(); len(repos) != 2 {
+		t.Errorf("Expected both repositories to stay registered, got %v", repos)
+	}
+
+	// Clearing again finds nothing
+	if cleared, err := storage.ClearReviewStates("/repo"); err != nil || cleared != 0 {
+		t.Errorf("Expected nothing left to clear, got %d (%v)", cleared, err)
+	}
+}
+
+// TestClearReviewStatesSharedDirectory tests that clearing a repository whose
+// storage directory another repository maps to leaves the other's states alone
+func TestClearReviewStatesSharedDirectory(t *testing.T) {
+	storage, err := newJSONStorageAt(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create JSON storage: %v", err)
+	}
+	if storage.getRepoStorageDir("/a/b_c") != storage.getRepoStorageDir("/a_b/c") {
+		t.Fatal("Expected /a/b_c and /a_b/c to share a storage directory")
+	}
+	if err := storage.SaveRepositories([]string{"/a/b_c", "/a_b/c"}); err != nil {
+		t.Fatalf("Failed to save repositories: %v", err)
+	}
+
+	for _, repo := range []struct{ path, sourceCommit string }{{"/a/b_c", "aaa"}, {"/a_b/c", "ccc"}} {
+		state := &models.ReviewState{
+			SourceBranch:  "feature",
+			TargetBranch:  "main",
+			SourceCommit:  repo.sourceCommit,
+			TargetCommit:  "bbb",
+			ReviewedFiles: []models.FileReview{{Repo: repo.path, Path: "a.go", Lines: map[string]string{"all": models.StateApproved}}},
+		}
+		if err := storage.SaveReviewState(state, repo.path, ""); err != nil {
+			t.Fatalf("Failed to save review state: %v", err)
+		}
+	}
+
+	// States without file reviews, or whose reviews name another clone, are
+	// told apart by the repository they were saved for
+	for _, state := range []*models.ReviewState{
+		{SourceBranch: "notes", TargetBranch: "main", SourceCommit: "ddd", TargetCommit: "bbb", Description: "Only a note", ChangedFiles: 3},
+		{SourceBranch: "imported", TargetBranch: "main", SourceCommit: "eee", TargetCommit: "bbb", ReviewedFiles: []models.FileReview{{Repo: "/elsewhere/clone", Path: "a.go", Lines: map[string]string{"all": models.StateApproved}}}},
+	} {
+		if err := storage.SaveReviewState(state, "/a/b_c", ""); err != nil {
+			t.Fatalf("Failed to save review state: %v", err)
+		}
+	}
+
+	if cleared, err := storage.ClearReviewStates("/a/b_c"); err != nil || cleared != 3 {
+		t.Errorf("Expected 3 comparisons cleared, got %d (%v)", cleared, err)
+	}
+	for _, sourceCommit := range []string{"ddd", "eee"} {
+		if _, err := os.Stat(storage.reviewStatePath("/a/b_c", "", sourceCommit, "bbb")); !os.IsNotExist(err) {
+			t.Errorf("Expected the state at %s cleared, got %v", sourceCommit, err)
+		}
+	}
+	if state, _ := storage.LoadReviewState("/a_b/c", "", "feature", "main", "ccc", "bbb"); len(state.ReviewedFiles) != 1 {
+		t.Errorf("Expected the other repository to keep its review, got %v", state.ReviewedFiles)
+	}
+	if _, err := os.Stat(filepath.Join(storage.getRepoStorageDir("/a/b_c"), "aaa")); !os.IsNotExist(err) {
+		t.Errorf("Expected the cleared comparison's directory to be removed, got %v", err)
+	}
+}